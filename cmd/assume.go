@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// canAssumeCmd represents the can-assume command
+var canAssumeCmd = &cobra.Command{
+	Use:   "can-assume [user...]",
+	Short: "Show which roles each user may switch into with SET ROLE",
+	Long: `Report, for every login role that is not a superuser or only for the given users, the
+roles it is a member of directly or through other groups, whether their privileges apply
+without SET ROLE (inherited) and whether the user may SET ROLE to them. NOINHERIT users only
+get the privileges of a group after SET ROLE.
+
+When the configuration file exists, its no_inherit users are also checked: each must be
+allowed to SET ROLE to its groups and be able to connect to the databases its groups hold
+privileges on, because CONNECT is checked before any SET ROLE. The command fails when a
+configured privilege is unreachable.`,
+	RunE: runCanAssume,
+}
+
+func init() {
+	rootCmd.AddCommand(canAssumeCmd)
+
+	canAssumeCmd.Flags().String("output", "text", "report format: text or json")
+}
+
+// canAssumeReport is the result of the can-assume command
+type canAssumeReport struct {
+	Roles       []structs.AssumableRole `json:"roles"`
+	Unreachable []string                `json:"unreachable"`
+}
+
+// runCanAssume handles the can-assume command
+func runCanAssume(cmd *cobra.Command, args []string) error {
+	output, _ := cmd.Flags().GetString("output")
+	if output != "text" && output != "json" {
+		return fmt.Errorf("invalid output format: %s (must be 'text' or 'json')", output)
+	}
+
+	configManager, cfg, err := optionalConfig()
+	if err != nil {
+		return err
+	}
+	dbManager, err := newDatabaseManager(configManager)
+	if err != nil {
+		return err
+	}
+	defer dbManager.Close()
+
+	report := canAssumeReport{Unreachable: []string{}}
+	if report.Roles, err = dbManager.AssumableRoles(args); err != nil {
+		return err
+	}
+	if cfg != nil {
+		unreachable, err := dbManager.CheckSetRoleReachability(cfg)
+		if err != nil {
+			return err
+		}
+		report.Unreachable = append(report.Unreachable, unreachable...)
+	}
+
+	if output == "json" {
+		if err := printJSON(report); err != nil {
+			return err
+		}
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "USER\tROLE\tINHERITED\tSET ROLE")
+		for _, role := range report.Roles {
+			fmt.Fprintf(w, "%s\t%s\t%t\t%t\n", role.User, role.Role, role.Inherited, role.CanSet)
+		}
+		w.Flush()
+		if len(report.Unreachable) > 0 {
+			fmt.Println("\nUnreachable privileges:")
+			for _, problem := range report.Unreachable {
+				fmt.Printf("  - %s\n", problem)
+			}
+		}
+	}
+
+	logger.WithFields(logrus.Fields{
+		"roles":       len(report.Roles),
+		"unreachable": len(report.Unreachable),
+	}).Info("Assumable roles report completed")
+
+	if len(report.Unreachable) > 0 {
+		return fmt.Errorf("%d configured privilege(s) cannot be reached with SET ROLE", len(report.Unreachable))
+	}
+	return nil
+}
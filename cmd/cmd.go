@@ -1,10 +1,25 @@
 package cmd
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/config"
 	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/database"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/events"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/metrics"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/principal"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/rotation"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/secrets"
 	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -19,7 +34,27 @@ var (
 	configPath string
 	dryRun     bool
 	verbose    bool
+	againstDB  bool
 	logger     *logrus.Logger
+
+	principalSource string
+	principalName   string
+
+	profile         string
+	redactPasswords bool
+	noSecretLogging bool
+	timeout         time.Duration
+
+	// commandCtx is cancelled on SIGINT or SIGTERM and once --timeout elapses; stopCommand
+	// releases it
+	commandCtx  = context.Background()
+	stopCommand = func() {}
+
+	// toolVersion is the version of this build, recorded with applied configuration revisions
+	toolVersion = "dev"
+
+	// principalHook adds the principal to every log entry; it is installed on first use
+	principalHook *principal.Hook
 )
 
 // rootCmd represents the base command
@@ -37,7 +72,7 @@ Environment Variables:
   POSTGRES_PORT         - Database port (default: 5432)
   POSTGRES_DB           - Database name (default: postgres)
   POSTGRES_USER         - Database username (default: postgres)
-  POSTGRES_SSLMODE      - SSL mode (default: require for IAM, prefer for password)
+  POSTGRES_SSLMODE      - SSL mode (default: require, or the ssl_mode of the configuration)
   
 Authentication Options:
   Password Authentication:
@@ -54,10 +89,17 @@ Authentication Options:
 
 // syncCmd represents the sync command
 var syncCmd = &cobra.Command{
-	Use:   "sync",
-	Short: "Synchronize database state with configuration",
-	Long:  `Synchronize the PostgreSQL database state with the configuration file. This will create users, groups, and grant privileges as defined in the configuration.`,
-	RunE:  runSync,
+	Use:     "sync",
+	Aliases: []string{"apply"},
+	Short:   "Synchronize database state with configuration",
+	Long: `Synchronize the PostgreSQL database state with the configuration file. This will create users, groups, and grant privileges as defined in the configuration.
+
+Use --expect-checksum with the checksum printed by validate to refuse to apply a configuration
+that differs from the reviewed one.
+
+With --all-profiles the cluster of every profile in the configuration is synced in turn, each
+with the connection overrides of its profiles entry, and the results are reported per cluster.`,
+	RunE: runSync,
 }
 
 // createUserCmd represents the create-user command
@@ -72,22 +114,61 @@ var createUserCmd = &cobra.Command{
 var dropUserCmd = &cobra.Command{
 	Use:   "drop-user [username]",
 	Short: "Drop a single user",
-	Args:  cobra.ExactArgs(1),
-	RunE:  runDropUser,
+	Long: `Drop a login role. PostgreSQL refuses to drop a user that owns objects or holds privileges:
+pass --reassign-to to hand its objects in the connected database to another role, or --cascade
+to drop them, before the user is dropped. --terminate-sessions ends the user's connections
+first, after giving them --grace-period to disconnect on their own.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runDropUser,
+}
+
+// dropGroupCmd represents the drop-group command
+var dropGroupCmd = &cobra.Command{
+	Use:     "drop-group [group]",
+	Aliases: []string{"delete-group"},
+	Short:   "Drop a single group",
+	Long: `Drop a group role. Its members lose the membership. PostgreSQL refuses to drop a group
+that owns objects or holds privileges: pass --reassign-to to hand its objects in the connected
+database to another role, or --cascade to drop them, before the group is dropped.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runDropGroup,
 }
 
 // listUsersCmd represents the list-users command
 var listUsersCmd = &cobra.Command{
 	Use:   "list-users",
 	Short: "List all database users",
-	RunE:  runListUsers,
+	Long: `List the roles in the database with their login ability, connection limit, direct
+group memberships and password validity. Built-in pg_ roles are omitted.`,
+	RunE: runListUsers,
 }
 
 // validateCmd represents the validate command
 var validateCmd = &cobra.Command{
 	Use:   "validate",
 	Short: "Validate configuration file",
-	RunE:  runValidate,
+	Long: `Validate the configuration file without making changes. Checks the file against the
+configuration schema (unknown fields and values of the wrong type), then for duplicate names,
+privileges that do not match the object they are granted on, invalid auth methods, IAM users
+with passwords, connection limits out of range, and references to groups, roles and
+databases that are not declared in the configuration. All problems are reported at once;
+--print-schema prints the schema for editors and CI linters. With --against-db,
+roles and databases that already exist in the cluster are accepted as well, and the
+cluster is checked for readiness: referenced databases exist and accept grants from the
+connected role, the connected role has CREATEROLE, and the rds_iam role is present when
+users use IAM authentication.`,
+	RunE: runValidate,
+}
+
+// certMappingsCmd represents the cert-mappings command
+var certMappingsCmd = &cobra.Command{
+	Use:   "cert-mappings",
+	Short: "Show pg_hba.conf and pg_ident.conf entries for certificate users",
+	Long: `Print the pg_hba.conf and pg_ident.conf entries needed for users configured with
+cert authentication. PostgreSQL matches the certificate CN (or subject DN with cert_dn)
+against the username; users whose certificate name differs from their username are
+mapped through the pgum_cert ident map.`,
+	RunE: runCertMappings,
 }
 
 func init() {
@@ -97,24 +178,91 @@ func init() {
 	rootCmd.PersistentFlags().StringVarP(&configPath, "config", "c", "./config.json", "path to configuration file")
 	rootCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "show what would be done without executing")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose output")
+	rootCmd.PersistentFlags().StringVar(&principalSource, "principal-source", principal.SourceAuto, "how to identify who is making changes: auto, os or aws")
+	rootCmd.PersistentFlags().StringVar(&principalName, "principal", "", "principal to record for changes, overriding --principal-source")
+	rootCmd.PersistentFlags().BoolVar(&redactPasswords, "redact-passwords", false, "show passwords as '********' in dry-run output and logged statements")
+	rootCmd.PersistentFlags().BoolVar(&noSecretLogging, "no-secret-logging", false, "never show password material in any output, including dry-run statements (implies --redact-passwords)")
+	rootCmd.PersistentFlags().DurationVar(&timeout, "timeout", 0, "abort database work after this long, rolling back an open sync transaction (0 means no limit)")
+	rootCmd.PersistentFlags().StringVar(&profile, "profile", "", "cluster to apply: only users and groups without a clusters selector or listing it are used")
 
 	// Add subcommands
 	rootCmd.AddCommand(syncCmd)
 	rootCmd.AddCommand(createUserCmd)
 	rootCmd.AddCommand(dropUserCmd)
+	rootCmd.AddCommand(dropGroupCmd)
 	rootCmd.AddCommand(listUsersCmd)
 	rootCmd.AddCommand(validateCmd)
+	rootCmd.AddCommand(certMappingsCmd)
 
 	// User creation flags
 	createUserCmd.Flags().StringP("password", "p", "", "user password (not used for IAM auth)")
-	createUserCmd.Flags().StringSliceP("groups", "g", []string{}, "groups to add user to")
+	createUserCmd.Flags().Bool("generate-password", false, "generate a random password and print it once instead of passing --password")
+	createUserCmd.Flags().Int("password-length", secrets.DefaultPasswordLength, "length of a generated password")
+	createUserCmd.Flags().String("password-charset", "", "characters a generated password is drawn from (default: letters, digits and shell-safe symbols)")
+	createUserCmd.Flags().StringSliceP("groups", "g", []string{}, "groups to add user to, on top of the default groups of the configuration")
 	createUserCmd.Flags().StringSlice("privileges", []string{}, "privileges to grant")
 	createUserCmd.Flags().StringSlice("databases", []string{}, "databases to grant privileges on")
-	createUserCmd.Flags().String("auth-method", "password", "authentication method: 'password' or 'iam'")
+	createUserCmd.Flags().String("auth-method", "password", "authentication method: 'password', 'iam', 'cert' or 'iam,password' for an IAM user with a password fallback")
+	createUserCmd.Flags().String("cert-cn", "", "client certificate CN mapped to the user (cert auth, default: username)")
 	createUserCmd.Flags().String("iam-role", "", "IAM role ARN for IAM authentication")
 	createUserCmd.Flags().Bool("can-login", true, "whether user can login")
 	createUserCmd.Flags().Int("connection-limit", 0, "maximum connections (0 = unlimited)")
 	createUserCmd.Flags().String("description", "", "user description")
+	createUserCmd.Flags().String("owner", "", "person accountable for the user, recorded in its comment")
+	createUserCmd.Flags().String("team", "", "team accountable for the user, recorded in its comment")
+	createUserCmd.Flags().String("ticket", "", "ticket that requested the user, recorded in its comment")
+	createUserCmd.Flags().String("valid-until", "", "password expiry as a date (2006-01-02) or RFC 3339 time")
+	createUserCmd.Flags().Bool("raw-username", false, "create the role with the username exactly as given instead of sanitizing it like identity provider logins")
+
+	// List users flags
+	listUsersCmd.Flags().String("output", "text", "output format: text or json")
+	listUsersCmd.Flags().Bool("login-only", false, "only list roles that can log in")
+
+	// Drop user flags
+	dropUserCmd.Flags().Bool("override-protection", false, "drop the user even if it has deletion protection")
+	dropUserCmd.Flags().String("reassign-to", "", "reassign the objects the user owns in the connected database to this role and drop its privileges there first")
+	dropUserCmd.Flags().Bool("cascade", false, "drop the objects the user owns in the connected database and its privileges there first")
+	dropUserCmd.Flags().Bool("terminate-sessions", false, "terminate the user's active sessions before dropping it")
+	dropUserCmd.Flags().Duration("grace-period", 0, "with --terminate-sessions, give sessions this long to disconnect on their own first")
+
+	// Drop group flags
+	dropGroupCmd.Flags().Bool("override-protection", false, "drop the group even if it has deletion protection")
+	dropGroupCmd.Flags().String("reassign-to", "", "reassign the objects the group owns in the connected database to this role and drop its privileges there first")
+	dropGroupCmd.Flags().Bool("cascade", false, "drop the objects the group owns in the connected database and its privileges there first")
+
+	// Sync flags
+	syncCmd.Flags().Duration("slow-threshold", database.DefaultSlowOperationThreshold, "log sync operations slower than this duration (0 disables)")
+	syncCmd.Flags().Bool("exact-memberships", false, "revoke memberships in managed groups that are not in the configuration")
+	syncCmd.Flags().Bool("exact-privileges", false, "revoke database privileges that are not in the configuration")
+	syncCmd.Flags().Bool("override-protection", false, "allow absent users with deletion protection to be dropped")
+	syncCmd.Flags().Bool("prune", false, "remove managed users and groups that are no longer in the configuration")
+	syncCmd.Flags().String("prune-action", database.PruneDrop, "how --prune removes users: drop or disable (groups are only dropped)")
+	syncCmd.Flags().String("reassign-to", "", "reassign the objects of the roles sync drops to this role and drop their privileges first (overrides role_removal)")
+	syncCmd.Flags().Bool("cascade", false, "drop the objects and privileges of the roles sync drops first (overrides role_removal)")
+	syncCmd.Flags().Bool("terminate-sessions", false, "terminate the active sessions of the users sync drops first (overrides role_removal)")
+	syncCmd.Flags().Duration("grace-period", 0, "with --terminate-sessions, give sessions this long to disconnect on their own first (overrides role_removal, 0 uses the configuration)")
+	syncCmd.Flags().Bool("auto-grant-admin", false, "let the connected role grant itself ADMIN OPTION on groups it cannot administer, revoked after the sync")
+	syncCmd.Flags().Int("grant-workers", database.DefaultGrantWorkers, "how many databases extension schema and large object grants are applied to at the same time")
+	syncCmd.Flags().Int("user-workers", database.DefaultUserWorkers, "how many new users are created at the same time")
+	syncCmd.Flags().Bool("skip-preflight", false, "do not check the privileges of the connected role before syncing")
+	syncCmd.Flags().String("elevated-sql", "", "apply what the connected role has the privileges for and write the statements that need more to this SQL file for a superuser to review and run")
+	syncCmd.Flags().Int("max-removals", 0, "refuse to drop, disable or revoke more than this many roles, memberships and privileges (overrides change_limits, 0 uses the configuration)")
+	syncCmd.Flags().Float64("max-removal-percent", 0, "refuse to drop, disable or prune more than this percentage of the managed roles (overrides change_limits, 0 uses the configuration)")
+	syncCmd.Flags().Bool("allow-large-change", false, "sync even when the removals exceed the change limits")
+	syncCmd.Flags().Bool("rotate-expired", false, "rotate generated passwords older than rotation.max_age_days and publish them to the rotation backend")
+	syncCmd.Flags().String("output", "text", "result format: text (logged) or json (printed to stdout)")
+	syncCmd.Flags().Bool("continue-on-error", false, "apply changes one by one and keep going after errors instead of in one transaction that is rolled back on the first error")
+	syncCmd.Flags().Bool("resume", false, "skip the users, groups, schemas and policies an interrupted sync of the same configuration completed")
+	syncCmd.Flags().String("checkpoint-file", "", "where sync records completed entities for --resume (default: the --config file with .checkpoint appended)")
+	syncCmd.Flags().String("pushgateway", "", "Prometheus pushgateway URL to push the sync metrics to when the run ends")
+	syncCmd.Flags().String("pushgateway-job", metrics.DefaultJob, "job name to push the sync metrics under")
+	syncCmd.Flags().String("history", "", "record a summary of the run for the history command: a local file or s3://bucket/prefix")
+	syncCmd.Flags().Bool("all-profiles", false, "sync the cluster of every profile in the configuration, one after another")
+	syncCmd.Flags().String("expect-checksum", "", "refuse to sync unless the configuration file has this checksum (sha256:...)")
+
+	// Validation flags
+	validateCmd.Flags().BoolVar(&againstDB, "against-db", false, "also check references against roles and databases in the live cluster")
+	validateCmd.Flags().Bool("print-schema", false, "print the JSON Schema of the configuration file and exit")
 }
 
 // initConfig initializes the logger and configuration
@@ -129,15 +277,169 @@ func initConfig() {
 	} else {
 		logger.SetLevel(logrus.InfoLevel)
 	}
+
+	// Mask every password and token the run has seen, and anything shaped like one, before
+	// an entry is formatted
+	logger.AddHook(secrets.NewHook())
+	if noSecretLogging {
+		redactPasswords = true
+	}
+
+	// Interrupting the command or exceeding --timeout cancels in-flight queries, so a
+	// transactional sync is rolled back instead of left half-applied
+	ctx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	stopCommand = stopSignals
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		stopCommand = func() {
+			cancel()
+			stopSignals()
+		}
+	}
+	commandCtx = ctx
+}
+
+// secretEnv reads a secret from an environment variable, registering it so it is masked in
+// log output
+func secretEnv(key string) string {
+	value := os.Getenv(key)
+	secrets.Register(value)
+	return value
+}
+
+// SetVersion sets the version of this build, reported by --version and recorded with applied
+// configuration revisions
+func SetVersion(version string) {
+	toolVersion = version
+	rootCmd.Version = version
 }
 
 // Execute executes the root command
 func Execute() error {
-	return rootCmd.Execute()
+	defer func() { stopCommand() }()
+	defer secrets.Wipe()
+	if lambdaBootstrap() {
+		rootCmd.SetArgs([]string{serveLambdaCmd.Name()})
+	}
+	err := rootCmd.Execute()
+	printRemediationHint(err)
+	return err
+}
+
+// connectionManager returns a configuration manager for commands that connect to the database
+// without applying the configuration. The configuration file is still loaded when it exists,
+// so its SSL modes and the connection overrides of --profile apply to every command.
+func connectionManager() (*config.Manager, error) {
+	configManager, _, err := optionalConfig()
+	return configManager, err
+}
+
+// optionalConfig loads the configuration file when it exists, narrowed to the users and
+// groups of --profile, and returns a nil configuration when it does not
+func optionalConfig() (*config.Manager, *structs.Config, error) {
+	configManager := config.NewManager(logger)
+	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+		return configManager, nil, nil
+	}
+
+	cfg, err := configManager.LoadConfig(configPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+	if profile != "" {
+		if cfg, err = configManager.SelectProfile(cfg, profile); err != nil {
+			return nil, nil, err
+		}
+	}
+	return configManager, cfg, nil
+}
+
+// newEventHandler returns an events handler mapping groups and sanitizing usernames with the
+// group mappings and username rules of the loaded configuration, or the defaults when it has
+// none, and granting its default groups to provisioned users
+func newEventHandler(configManager *config.Manager) (*events.EventHandler, error) {
+	handler := events.NewEventHandler(logger)
+	if mappings := configManager.GroupMappings(); mappings != nil {
+		mapper, err := events.NewGroupMapper(*mappings)
+		if err != nil {
+			return nil, err
+		}
+		handler.SetGroupMapper(mapper)
+	}
+	if rules := configManager.UsernameRules(); rules != nil {
+		sanitizer, err := events.NewSanitizer(*rules)
+		if err != nil {
+			return nil, err
+		}
+		handler.SetSanitizer(sanitizer)
+	}
+	handler.SetDefaultGroups(configManager.DefaultGroups())
+	return handler, nil
+}
+
+// newDatabaseManager reads the connection settings from the environment and connects to the database
+func newDatabaseManager(configManager *config.Manager) (*database.Manager, error) {
+	dbConn, err := configManager.GetDatabaseConnection()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database connection: %w", err)
+	}
+
+	// Identify who is making changes so they can be attributed in logs and role comments
+	p, err := principal.Resolve(commandCtx, principalSource, principalName, dbConn.IAMAuth, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine principal: %w", err)
+	}
+	if principalHook == nil {
+		principalHook = &principal.Hook{}
+		logger.AddHook(principalHook)
+	}
+	principalHook.Principal = p
+
+	dbManager, err := database.NewManagerContext(commandCtx, dbConn, logger, dryRun)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize database manager: %w", err)
+	}
+	dbManager.SetPrincipal(p.String())
+	dbManager.SetRedactPasswords(redactPasswords)
+	if err := dbManager.SetHooks(configManager.Hooks()); err != nil {
+		dbManager.Close()
+		return nil, err
+	}
+	tagRoleSource(dbManager, configManager, filepath.Base(configPath))
+
+	return dbManager, nil
+}
+
+// newSyncer connects the manager a sync runs through. It is a variable so the sync command
+// can be driven by an in-memory manager.
+var newSyncer = func(configManager *config.Manager) (database.Syncer, error) {
+	return newDatabaseManager(configManager)
+}
+
+// Sources recorded on the roles created outside sync when the configuration sets
+// tag_created_roles, so sync does not prune them as its own
+const (
+	roleSourceCLI    = "cli"
+	roleSourceServe  = "serve"
+	roleSourceLambda = "lambda"
+)
+
+// tagRoleSource makes the database manager tag the roles it creates with a source when the
+// configuration sets tag_created_roles
+func tagRoleSource(dbManager *database.Manager, configManager *config.Manager, source string) {
+	if configManager.TagCreatedRoles() {
+		dbManager.SetRoleSource(source)
+	}
 }
 
 // runSync handles the sync command
 func runSync(cmd *cobra.Command, args []string) error {
+	output, _ := cmd.Flags().GetString("output")
+	if output != "text" && output != "json" {
+		return fmt.Errorf("invalid output format: %s (must be 'text' or 'json')", output)
+	}
+
 	logger.Info("Starting sync operation")
 
 	// Load configuration
@@ -147,37 +449,321 @@ func runSync(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to load configuration: %w", err)
 	}
 
-	// Get database connection
-	dbConn, err := configManager.GetDatabaseConnection()
+	// Passwords printed by the stdout backend would break the JSON result
+	if rotateExpired, _ := cmd.Flags().GetBool("rotate-expired"); rotateExpired && output == "json" && !dryRun {
+		if cfg.Rotation == nil || cfg.Rotation.Backend == "" || cfg.Rotation.Backend == structs.RotationBackendStdout {
+			return fmt.Errorf("--rotate-expired with the stdout rotation backend cannot be combined with --output json")
+		}
+	}
+
+	// Refuse to apply a configuration that differs from the reviewed one
+	if expectChecksum, _ := cmd.Flags().GetString("expect-checksum"); expectChecksum != "" {
+		if err := configManager.VerifyChecksum(expectChecksum); err != nil {
+			return err
+		}
+	}
+
+	allProfiles, _ := cmd.Flags().GetBool("all-profiles")
+	if !allProfiles {
+		result, err := syncProfile(cmd, configManager, cfg, profile)
+		if err != nil {
+			failed := &structs.SyncResult{Profile: profile, Errors: []error{err}}
+			pushSyncMetrics(cmd, failed)
+			recordSyncHistory(cmd, failed)
+			return err
+		}
+		pushSyncMetrics(cmd, result)
+		recordSyncHistory(cmd, result)
+		sendSyncNotifications(configManager, result)
+		return reportSyncResult(result, output)
+	}
+
+	if profile != "" {
+		return fmt.Errorf("--all-profiles cannot be combined with --profile")
+	}
+	clusters := config.ClusterNames(cfg)
+	if len(clusters) == 0 {
+		return fmt.Errorf("--all-profiles needs a configuration that declares profiles or clusters")
+	}
+
+	// Validate every cluster before connecting to any, so a typo does not leave the fleet half-synced
+	if err := configManager.ValidateProfiles(cfg, ""); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	results := make([]*structs.SyncResult, 0, len(clusters))
+	for _, name := range clusters {
+		logger.WithField("profile", name).Info("Syncing cluster")
+
+		result, err := syncProfile(cmd, configManager, cfg, name)
+		if err != nil {
+			// One unreachable cluster should not stop the others from being synced
+			logger.WithError(err).WithField("profile", name).Error("Failed to sync cluster")
+			result = &structs.SyncResult{Errors: []error{err}}
+		}
+		result.Profile = name
+		results = append(results, result)
+	}
+
+	pushSyncMetrics(cmd, results...)
+	recordSyncHistory(cmd, results...)
+	sendSyncNotifications(configManager, results...)
+	return reportSyncResults(results, output)
+}
+
+// syncProfile syncs the users and groups of one cluster (sync profile), connecting with the
+// profile's connection overrides
+func syncProfile(cmd *cobra.Command, configManager *config.Manager, cfg *structs.Config, name string) (*structs.SyncResult, error) {
+	// Only apply the users and groups that target this cluster
+	cfg, err := configManager.SelectProfile(cfg, name)
 	if err != nil {
-		return fmt.Errorf("failed to get database connection: %w", err)
+		return nil, err
 	}
 
-	// Initialize database manager
-	dbManager, err := database.NewManager(dbConn, logger, dryRun)
+	if err := configManager.ValidateConfig(cfg); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	// Connect to the database
+	dbManager, err := newSyncer(configManager)
 	if err != nil {
-		return fmt.Errorf("failed to initialize database manager: %w", err)
+		return nil, err
 	}
 	defer dbManager.Close()
 
+	slowThreshold, _ := cmd.Flags().GetDuration("slow-threshold")
+	dbManager.SetSlowOperationThreshold(slowThreshold)
+	exactMemberships, _ := cmd.Flags().GetBool("exact-memberships")
+	dbManager.SetExactMemberships(exactMemberships)
+	exactPrivileges, _ := cmd.Flags().GetBool("exact-privileges")
+	dbManager.SetExactPrivileges(exactPrivileges)
+	autoGrantAdmin, _ := cmd.Flags().GetBool("auto-grant-admin")
+	dbManager.SetAutoGrantAdmin(autoGrantAdmin)
+	grantWorkers, _ := cmd.Flags().GetInt("grant-workers")
+	dbManager.SetGrantWorkers(grantWorkers)
+	userWorkers, _ := cmd.Flags().GetInt("user-workers")
+	dbManager.SetUserWorkers(userWorkers)
+	skipPreflight, _ := cmd.Flags().GetBool("skip-preflight")
+	dbManager.SetSkipPreflight(skipPreflight)
+	if elevatedSQL, _ := cmd.Flags().GetString("elevated-sql"); elevatedSQL != "" {
+		// The preflight check finds the statements that need elevated access
+		if skipPreflight {
+			return nil, fmt.Errorf("--elevated-sql cannot be combined with --skip-preflight")
+		}
+		dbManager.SetDeferElevated(true)
+	}
+	dbManager.SetChangeLimits(changeLimits(cmd, cfg))
+	allowLargeChange, _ := cmd.Flags().GetBool("allow-large-change")
+	dbManager.SetAllowLargeChange(allowLargeChange)
+	if err := setRoleRemoval(cmd, dbManager, cfg); err != nil {
+		return nil, err
+	}
+	overrideProtection, _ := cmd.Flags().GetBool("override-protection")
+	dbManager.SetOverrideProtection(overrideProtection)
+	continueOnError, _ := cmd.Flags().GetBool("continue-on-error")
+	dbManager.SetTransactional(!continueOnError)
+	if prune, _ := cmd.Flags().GetBool("prune"); prune {
+		pruneAction, _ := cmd.Flags().GetString("prune-action")
+		if err := dbManager.SetPrune(pruneAction); err != nil {
+			return nil, err
+		}
+	}
+
+	// Rotated passwords are published once the sync is done, so set up the backend first
+	var publisher rotation.Publisher
+	if rotateExpired, _ := cmd.Flags().GetBool("rotate-expired"); rotateExpired {
+		maxAge := cfg.Rotation.MaxAge()
+		if maxAge <= 0 {
+			return nil, fmt.Errorf("--rotate-expired needs rotation.max_age_days in the configuration")
+		}
+		if !dryRun {
+			if publisher, err = newPublisher(cmd, configManager); err != nil {
+				return nil, err
+			}
+		}
+		dbManager.SetRotateExpired(maxAge)
+	}
+
+	checkpoint, err := openCheckpoint(cmd, configManager, name)
+	if err != nil {
+		return nil, err
+	}
+	dbManager.SetCheckpoint(checkpoint)
+
 	// Sync configuration
 	result, err := dbManager.SyncConfiguration(cfg)
 	if err != nil {
-		return fmt.Errorf("sync failed: %w", err)
+		return nil, fmt.Errorf("sync failed: %w", err)
 	}
+	result.Profile = name
 
-	// Report results
-	logger.WithFields(logrus.Fields{
-		"users_created":  len(result.UsersCreated),
-		"users_modified": len(result.UsersModified),
-		"users_removed":  len(result.UsersRemoved),
-		"groups_created": len(result.GroupsCreated),
-		"errors":         len(result.Errors),
-	}).Info("Sync completed")
+	if err := writeElevatedSQL(cmd, configManager, result, name); err != nil {
+		result.Errors = append(result.Errors, err)
+	}
 
-	// Report errors
-	for _, err := range result.Errors {
-		logger.Error(err)
+	// A rolled back sync rotated nothing, so only committed passwords are published
+	if publisher != nil && len(result.RotatedPasswords) > 0 {
+		dbConn, err := configManager.GetDatabaseConnection()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get database connection: %w", err)
+		}
+		for _, r := range result.RotatedPasswords {
+			if err := publishRotatedPassword(publisher, dbConn, r.Username, r.Password); err != nil {
+				result.Errors = append(result.Errors, err)
+			}
+		}
+	}
+
+	// A sync without errors leaves nothing to resume
+	if checkpoint != nil && !dryRun && len(result.Errors) == 0 {
+		if err := checkpoint.Remove(); err != nil {
+			result.Warn("", err.Error())
+		}
+	}
+
+	// Only a sync that applied everything moves the cluster to the configuration's revision,
+	// which statements left to the elevated script have not been
+	if !dryRun && len(result.Errors) == 0 && len(result.Elevated) == 0 {
+		revision := structs.ConfigRevision{Checksum: configManager.LoadedChecksum(), Profile: name, ToolVersion: toolVersion}
+		if err := dbManager.RecordRevision(revision); err != nil {
+			result.Warn("", fmt.Sprintf("failed to record the configuration revision: %v", err))
+		}
+	}
+
+	return result, nil
+}
+
+// changeLimits returns the change limits of the configuration, overridden by the
+// --max-removals and --max-removal-percent flags when they are given
+func changeLimits(cmd *cobra.Command, cfg *structs.Config) structs.ChangeLimitsConfig {
+	var limits structs.ChangeLimitsConfig
+	if cfg.ChangeLimits != nil {
+		limits = *cfg.ChangeLimits
+	}
+	if maxRemovals, _ := cmd.Flags().GetInt("max-removals"); maxRemovals > 0 {
+		limits.MaxRemovals = maxRemovals
+	}
+	if maxPercent, _ := cmd.Flags().GetFloat64("max-removal-percent"); maxPercent > 0 {
+		limits.MaxRemovalPercent = maxPercent
+	}
+	return limits
+}
+
+// setRoleRemoval makes the database manager reassign or drop the objects of the roles it
+// drops, and terminate the sessions of users first, as set by role_removal in the
+// configuration, overridden by the --reassign-to, --cascade, --terminate-sessions and
+// --grace-period flags when they are given
+func setRoleRemoval(cmd *cobra.Command, dbManager database.Syncer, cfg *structs.Config) error {
+	var removal structs.RoleRemovalConfig
+	if cfg.RoleRemoval != nil {
+		removal = *cfg.RoleRemoval
+	}
+	reassignTo, _ := cmd.Flags().GetString("reassign-to")
+	cascade, _ := cmd.Flags().GetBool("cascade")
+	if reassignTo != "" && cascade {
+		return fmt.Errorf("--reassign-to and --cascade cannot be combined: objects are either reassigned or dropped")
+	}
+	if reassignTo != "" {
+		removal.ReassignTo, removal.Cascade = structs.NormalizeIdentifier(reassignTo), false
+	} else if cascade {
+		removal.ReassignTo, removal.Cascade = "", true
+	}
+	if terminate, _ := cmd.Flags().GetBool("terminate-sessions"); terminate {
+		removal.TerminateSessions = true
+	}
+	grace := removal.GracePeriod()
+	if flagGrace, _ := cmd.Flags().GetDuration("grace-period"); flagGrace > 0 {
+		grace = flagGrace
+	}
+
+	dbManager.SetReassignTo(removal.ReassignTo)
+	dbManager.SetCascade(removal.Cascade)
+	dbManager.SetTerminateSessions(removal.TerminateSessions, grace)
+	return nil
+}
+
+// syncReport is the outcome of a sync as printed with --output json
+type syncReport struct {
+	Profile            string                      `json:"profile,omitempty"`
+	Principal          string                      `json:"principal,omitempty"`
+	UsersCreated       []string                    `json:"users_created"`
+	UsersModified      []string                    `json:"users_modified"`
+	UsersRemoved       []string                    `json:"users_removed"`
+	UsersDisabled      []string                    `json:"users_disabled"`
+	UsersRenamed       []structs.RoleRename        `json:"users_renamed"`
+	GroupsCreated      []string                    `json:"groups_created"`
+	GroupsModified     []string                    `json:"groups_modified"`
+	GroupsRemoved      []string                    `json:"groups_removed"`
+	PoliciesApplied    []string                    `json:"policies_applied"`
+	SchemasApplied     []string                    `json:"schemas_applied"`
+	MembershipsRevoked []structs.Membership        `json:"memberships_revoked"`
+	MembershipsExpired []structs.MembershipExpiry  `json:"memberships_expired"`
+	PrivilegesRevoked  []structs.PrivilegeGrant    `json:"privileges_revoked"`
+	Resumed            []string                    `json:"resumed,omitempty"`
+	RolledBack         bool                        `json:"rolled_back,omitempty"`
+	Warnings           []structs.SyncWarning       `json:"warnings"`
+	Statements         []structs.PlannedStatement  `json:"statements,omitempty"`
+	Elevated           []structs.PlannedStatement  `json:"elevated_statements,omitempty"`
+	GeneratedPasswords []structs.GeneratedPassword `json:"generated_passwords,omitempty"`
+	PasswordsRotated   []string                    `json:"passwords_rotated"`
+	Errors             []string                    `json:"errors"`
+	StatementsExecuted int                         `json:"statements_executed"`
+	QueriesRun         int                         `json:"queries_run"`
+	Duration           string                      `json:"duration"`
+}
+
+// newSyncReport converts a sync result for JSON output, using empty lists instead of null
+func newSyncReport(result *structs.SyncResult) syncReport {
+	report := syncReport{
+		Profile:            result.Profile,
+		Principal:          result.Principal,
+		UsersCreated:       append([]string{}, result.UsersCreated...),
+		UsersModified:      append([]string{}, result.UsersModified...),
+		UsersRemoved:       append([]string{}, result.UsersRemoved...),
+		UsersDisabled:      append([]string{}, result.UsersDisabled...),
+		UsersRenamed:       append([]structs.RoleRename{}, result.UsersRenamed...),
+		GroupsCreated:      append([]string{}, result.GroupsCreated...),
+		GroupsModified:     append([]string{}, result.GroupsModified...),
+		GroupsRemoved:      append([]string{}, result.GroupsRemoved...),
+		PoliciesApplied:    append([]string{}, result.PoliciesApplied...),
+		SchemasApplied:     append([]string{}, result.SchemasApplied...),
+		MembershipsRevoked: append([]structs.Membership{}, result.MembershipsRevoked...),
+		MembershipsExpired: append([]structs.MembershipExpiry{}, result.MembershipsExpired...),
+		PrivilegesRevoked:  append([]structs.PrivilegeGrant{}, result.PrivilegesRevoked...),
+		Resumed:            result.Resumed,
+		RolledBack:         result.RolledBack,
+		Warnings:           append([]structs.SyncWarning{}, result.Warnings...),
+		Statements:         result.Statements,
+		Elevated:           result.Elevated,
+		GeneratedPasswords: result.GeneratedPasswords,
+		PasswordsRotated:   []string{},
+		Errors:             make([]string, len(result.Errors)),
+		StatementsExecuted: result.StatementsExecuted,
+		QueriesRun:         result.QueriesRun,
+		Duration:           result.Duration.String(),
+	}
+	for _, r := range result.RotatedPasswords {
+		report.PasswordsRotated = append(report.PasswordsRotated, r.Username)
+	}
+	for i, err := range result.Errors {
+		report.Errors[i] = err.Error()
+	}
+	return report
+}
+
+// reportSyncResult reports the outcome of a sync, logged as text or printed as JSON, and
+// returns an error when any operation failed
+func reportSyncResult(result *structs.SyncResult, output string) error {
+	if output == "json" {
+		data, err := json.MarshalIndent(newSyncReport(result), "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal sync result: %w", err)
+		}
+		fmt.Println(string(data))
+	} else {
+		logSyncResult(result)
+		printStatementPreview(result.Statements)
+		printGeneratedPasswords(result.GeneratedPasswords)
 	}
 
 	if len(result.Errors) > 0 {
@@ -187,11 +773,247 @@ func runSync(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// pushSyncMetrics publishes the metrics of sync results to the pushgateway given with
+// --pushgateway, one group per profile. A failed push is logged and does not fail the sync.
+func pushSyncMetrics(cmd *cobra.Command, results ...*structs.SyncResult) {
+	gateway, _ := cmd.Flags().GetString("pushgateway")
+	if gateway == "" {
+		return
+	}
+	job, _ := cmd.Flags().GetString("pushgateway-job")
+
+	pusher := metrics.NewPusher(gateway, job)
+	for _, result := range results {
+		fields := logrus.Fields{
+			"pushgateway": gateway,
+			"job":         pusher.Job,
+			"profile":     result.Profile,
+		}
+		if err := pusher.PushSyncResult(context.Background(), result, dryRun); err != nil {
+			logger.WithError(err).WithFields(fields).Warn("Failed to push sync metrics")
+			continue
+		}
+		logger.WithFields(fields).Debug("Pushed sync metrics")
+	}
+}
+
+// openCheckpoint loads the checkpoint of an interrupted sync of a profile with --resume, or
+// starts a new one. Dry runs only read checkpoints.
+func openCheckpoint(cmd *cobra.Command, configManager *config.Manager, name string) (*database.Checkpoint, error) {
+	path, _ := cmd.Flags().GetString("checkpoint-file")
+	if path == "" {
+		path = configPath + ".checkpoint"
+	}
+	if name != "" {
+		path += "." + name
+	}
+
+	if resume, _ := cmd.Flags().GetBool("resume"); resume {
+		checkpoint, err := database.LoadCheckpoint(path, configManager.LoadedChecksum(), name)
+		if err != nil {
+			return nil, err
+		}
+		logger.WithFields(logrus.Fields{
+			"checkpoint": path,
+			"completed":  len(checkpoint.Completed),
+			"started_at": checkpoint.StartedAt,
+		}).Info("Resuming interrupted sync")
+		return checkpoint, nil
+	}
+
+	// A transactional sync either applies everything or nothing, so there is nothing to resume
+	if continueOnError, _ := cmd.Flags().GetBool("continue-on-error"); dryRun || !continueOnError {
+		return nil, nil
+	}
+	return database.NewCheckpoint(path, configManager.LoadedChecksum(), name), nil
+}
+
+// reportSyncResults reports the outcome of syncing every cluster: logged one cluster after
+// another as text, or printed as one JSON object keyed by profile. It returns an error when
+// any cluster had errors.
+func reportSyncResults(results []*structs.SyncResult, output string) error {
+	failed := 0
+	for _, result := range results {
+		if len(result.Errors) > 0 {
+			failed++
+		}
+	}
+
+	if output == "json" {
+		reports := make(map[string]syncReport, len(results))
+		for _, result := range results {
+			reports[result.Profile] = newSyncReport(result)
+		}
+		data, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal sync results: %w", err)
+		}
+		fmt.Println(string(data))
+	} else {
+		for _, result := range results {
+			logSyncResult(result)
+			printStatementPreview(result.Statements)
+			printGeneratedPasswords(result.GeneratedPasswords)
+		}
+		for _, result := range results {
+			logger.WithFields(logrus.Fields{
+				"profile": result.Profile,
+				"errors":  len(result.Errors),
+			}).Info("Cluster sync summary")
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("sync completed with errors on %d of %d cluster(s)", failed, len(results))
+	}
+	return nil
+}
+
+// printGeneratedPasswords prints the passwords generated for new users to stdout, never to
+// the log. They are not stored anywhere, so this is the only time they are shown.
+func printGeneratedPasswords(generated []structs.GeneratedPassword) {
+	if len(generated) == 0 {
+		return
+	}
+	fmt.Println("Generated passwords (shown once, store them now):")
+	for _, g := range generated {
+		fmt.Printf("  %s: %s\n", g.Username, g.Password)
+	}
+}
+
+// printStatementPreview prints the statements of a dry run grouped under the entity they
+// belong to, in the order the entities were synced, marking those that would fail
+func printStatementPreview(statements []structs.PlannedStatement) {
+	if len(statements) == 0 {
+		return
+	}
+
+	var entities []string
+	failing := 0
+	byEntity := make(map[string][]structs.PlannedStatement)
+	for _, statement := range statements {
+		entity := statement.Entity
+		if entity == "" {
+			entity = "sync"
+		}
+		if _, seen := byEntity[entity]; !seen {
+			entities = append(entities, entity)
+		}
+		byEntity[entity] = append(byEntity[entity], statement)
+		if statement.Problem != "" {
+			failing++
+		}
+	}
+
+	if failing > 0 {
+		fmt.Printf("Dry run: %d statement(s), %d would fail, grouped by entity:\n", len(statements), failing)
+	} else {
+		fmt.Printf("Dry run: %d statement(s), grouped by entity:\n", len(statements))
+	}
+	for _, entity := range entities {
+		fmt.Printf("\n%s (%d)\n", entity, len(byEntity[entity]))
+		for _, statement := range byEntity[entity] {
+			fmt.Printf("  %s\n", strings.Join(strings.Fields(statement.Query), " "))
+			if statement.Problem != "" {
+				fmt.Printf("    would fail: %s\n", statement.Problem)
+			}
+		}
+	}
+}
+
+// logSyncResult logs the outcome of a sync, with warnings and errors reported separately
+func logSyncResult(result *structs.SyncResult) {
+	// Report results
+	logger.WithFields(logrus.Fields{
+		"profile":           result.Profile,
+		"principal":         result.Principal,
+		"users_created":     len(result.UsersCreated),
+		"users_modified":    len(result.UsersModified),
+		"users_removed":     len(result.UsersRemoved),
+		"users_disabled":    len(result.UsersDisabled),
+		"users_renamed":     len(result.UsersRenamed),
+		"passwords_rotated": len(result.RotatedPasswords),
+		"groups_created":    len(result.GroupsCreated),
+		"groups_modified":   len(result.GroupsModified),
+		"groups_removed":    len(result.GroupsRemoved),
+		"policies":          len(result.PoliciesApplied),
+		"schemas":           len(result.SchemasApplied),
+		"resumed":           len(result.Resumed),
+		"rolled_back":       result.RolledBack,
+		"warnings":          len(result.Warnings),
+		"errors":            len(result.Errors),
+		"duration":          result.Duration.String(),
+	}).Info("Sync completed")
+
+	for _, rename := range result.UsersRenamed {
+		logger.WithFields(logrus.Fields{
+			"from": rename.From,
+			"to":   rename.To,
+		}).Info("User renamed")
+	}
+
+	// Report memberships that differ from the configuration
+	for _, membership := range result.MembershipsRevoked {
+		logger.WithFields(logrus.Fields{
+			"member": membership.Member,
+			"group":  membership.Group,
+		}).Info("Membership revoked")
+	}
+	for _, membership := range result.MembershipsExpired {
+		logger.WithFields(logrus.Fields{
+			"member":     membership.Member,
+			"group":      membership.Group,
+			"expires_at": membership.ExpiresAt.Format(time.RFC3339),
+		}).Info("Temporary membership expired")
+	}
+	for _, grant := range result.PrivilegesRevoked {
+		logger.WithFields(logrus.Fields{
+			"target":    grant.Target,
+			"privilege": grant.Privilege,
+			"database":  grant.Database,
+		}).Info("Privilege revoked")
+	}
+
+	// Report aggregate timings per operation type
+	for _, summary := range database.SummarizeTimings(result.Timings) {
+		logger.WithFields(logrus.Fields{
+			"operation": summary.Operation,
+			"count":     summary.Count,
+			"total":     summary.Total.String(),
+			"max":       summary.Max.String(),
+			"slowest":   summary.SlowestEntity,
+		}).Info("Sync timing")
+	}
+
+	// Report warnings, which did not stop anything, separately from errors
+	for _, warning := range result.Warnings {
+		if warning.Role == "" {
+			logger.Warn(warning.Message)
+			continue
+		}
+		logger.WithField("role", warning.Role).Warn(warning.Message)
+	}
+
+	// Report errors
+	for _, err := range result.Errors {
+		if hint := remediationHint(err); hint != "" {
+			logger.WithField("hint", hint).Error(err)
+			continue
+		}
+		logger.Error(err)
+	}
+}
+
 // runCreateUser handles the create-user command
 func runCreateUser(cmd *cobra.Command, args []string) error {
-	username := args[0]
+	// Role names typed on another system may arrive decomposed; the configuration is in NFC
+	username := structs.NormalizeIdentifier(args[0])
 	password, _ := cmd.Flags().GetString("password")
+	secrets.Register(password)
 	groups, _ := cmd.Flags().GetStringSlice("groups")
+	for i, group := range groups {
+		groups[i] = structs.NormalizeIdentifier(group)
+	}
 	privileges, _ := cmd.Flags().GetStringSlice("privileges")
 	databases, _ := cmd.Flags().GetStringSlice("databases")
 	authMethod, _ := cmd.Flags().GetString("auth-method")
@@ -199,56 +1021,143 @@ func runCreateUser(cmd *cobra.Command, args []string) error {
 	canLogin, _ := cmd.Flags().GetBool("can-login")
 	connectionLimit, _ := cmd.Flags().GetInt("connection-limit")
 	description, _ := cmd.Flags().GetString("description")
+	owner, _ := cmd.Flags().GetString("owner")
+	team, _ := cmd.Flags().GetString("team")
+	ticket, _ := cmd.Flags().GetString("ticket")
+	validUntilFlag, _ := cmd.Flags().GetString("valid-until")
+	certCN, _ := cmd.Flags().GetString("cert-cn")
+	generatePassword, _ := cmd.Flags().GetBool("generate-password")
+	passwordLength, _ := cmd.Flags().GetInt("password-length")
+	passwordCharset, _ := cmd.Flags().GetString("password-charset")
+
+	if generatePassword {
+		if password != "" {
+			return fmt.Errorf("--password and --generate-password cannot be used together")
+		}
+		if err := secrets.CheckPasswordPolicy(passwordLength, passwordCharset); err != nil {
+			return err
+		}
+	}
 
 	logger.WithFields(logrus.Fields{
 		"username":    username,
 		"auth_method": authMethod,
 	}).Info("Creating user")
 
-	// Validate authentication method
-	if authMethod != "password" && authMethod != "iam" {
-		return fmt.Errorf("invalid auth-method: %s (must be 'password' or 'iam')", authMethod)
+	// Validate authentication methods
+	methods := strings.Split(authMethod, ",")
+	for _, method := range methods {
+		if method != structs.AuthMethodPassword && method != structs.AuthMethodIAM && method != structs.AuthMethodCert {
+			return fmt.Errorf("invalid auth-method: %s (must be 'password', 'iam', 'cert' or 'iam,password')", method)
+		}
+	}
+	if len(methods) > 1 && strings.Contains(authMethod, structs.AuthMethodCert) {
+		return fmt.Errorf("cert authentication cannot be combined with other auth methods")
+	}
+
+	var additionalMethods []string
+	if len(methods) > 1 {
+		additionalMethods = methods
+	}
+
+	// Create user configuration
+	userConfig := &structs.UserConfig{
+		Username:         username,
+		Password:         password,
+		GeneratePassword: generatePassword,
+		PasswordLength:   passwordLength,
+		PasswordCharset:  passwordCharset,
+		Groups:           groups,
+		Privileges:       privileges,
+		Databases:        databases,
+		Enabled:          true,
+		Description:      description,
+		AuthMethod:       methods[0],
+		AuthMethods:      additionalMethods,
+		IAMRole:          iamRole,
+		CanLogin:         canLogin,
+		ConnectionLimit:  connectionLimit,
+		CertCommonName:   certCN,
+		Owner:            owner,
+		Team:             team,
+		Ticket:           ticket,
+	}
+
+	if validUntilFlag != "" {
+		validUntil, err := time.Parse(time.RFC3339, validUntilFlag)
+		if err != nil {
+			if validUntil, err = time.Parse("2006-01-02", validUntilFlag); err != nil {
+				return fmt.Errorf("invalid --valid-until %q: must be a date (2006-01-02) or RFC 3339 time", validUntilFlag)
+			}
+		}
+		userConfig.ValidUntil = &validUntil
+	}
+
+	// Ownership is recorded in the role comment metadata, which these characters would break
+	for name, value := range map[string]string{"owner": owner, "team": team, "ticket": ticket} {
+		if strings.ContainsAny(value, ";=|\n") {
+			return fmt.Errorf("--%s must not contain ';', '=', '|' or line breaks", name)
+		}
 	}
 
 	// Validate IAM-specific requirements
-	if authMethod == "iam" {
+	switch {
+	case userConfig.HasAuthMethod(structs.AuthMethodCert):
+		if password != "" {
+			logger.Warn("Password specified for certificate authentication user - password will be ignored")
+			userConfig.Password = ""
+		}
+	case userConfig.HasAuthMethod(structs.AuthMethodIAM) && userConfig.HasAuthMethod(structs.AuthMethodPassword):
+		if password == "" && !generatePassword {
+			return fmt.Errorf("a password is required when combining iam and password authentication")
+		}
+	case userConfig.HasAuthMethod(structs.AuthMethodIAM):
 		if password != "" {
 			logger.Warn("Password specified for IAM authentication user - password will be ignored")
 		}
-	} else {
+	default:
 		if iamRole != "" {
 			logger.Warn("IAM role specified for password authentication user - IAM role will be ignored")
 		}
 	}
+	if certCN != "" && !userConfig.HasAuthMethod(structs.AuthMethodCert) {
+		return fmt.Errorf("--cert-cn requires --auth-method cert")
+	}
+	if generatePassword && !userConfig.HasAuthMethod(structs.AuthMethodPassword) {
+		return fmt.Errorf("--generate-password requires password authentication")
+	}
 
-	// Get database connection
-	configManager := config.NewManager(logger)
-	dbConn, err := configManager.GetDatabaseConnection()
+	// Connect to the database
+	configManager, err := connectionManager()
 	if err != nil {
-		return fmt.Errorf("failed to get database connection: %w", err)
+		return err
 	}
 
-	// Initialize database manager
-	dbManager, err := database.NewManager(dbConn, logger, dryRun)
-	if err != nil {
-		return fmt.Errorf("failed to initialize database manager: %w", err)
+	// Turn logins such as emails into the role names events would give them
+	if rawUsername, _ := cmd.Flags().GetBool("raw-username"); !rawUsername {
+		eventHandler, err := newEventHandler(configManager)
+		if err != nil {
+			return err
+		}
+		if sanitized := eventHandler.SanitizeUsername(username); sanitized != username {
+			logger.WithFields(logrus.Fields{
+				"login":    username,
+				"username": sanitized,
+			}).Info("Sanitized username (use --raw-username to keep it as given)")
+			username = sanitized
+			userConfig.Username = sanitized
+		}
 	}
-	defer dbManager.Close()
 
-	// Create user configuration
-	userConfig := &structs.UserConfig{
-		Username:        username,
-		Password:        password,
-		Groups:          groups,
-		Privileges:      privileges,
-		Databases:       databases,
-		Enabled:         true,
-		Description:     description,
-		AuthMethod:      authMethod,
-		IAMRole:         iamRole,
-		CanLogin:        canLogin,
-		ConnectionLimit: connectionLimit,
+	// Every new user joins the default groups of the configuration
+	userConfig.AddDefaultGroups(configManager.DefaultGroups())
+
+	dbManager, err := newDatabaseManager(configManager)
+	if err != nil {
+		return err
 	}
+	defer dbManager.Close()
+	tagRoleSource(dbManager, configManager, roleSourceCLI)
 
 	// Create user
 	if err := dbManager.CreateUser(userConfig); err != nil {
@@ -256,7 +1165,7 @@ func runCreateUser(cmd *cobra.Command, args []string) error {
 	}
 
 	// Add to groups and grant privileges
-	for _, group := range groups {
+	for _, group := range userConfig.Groups {
 		if err := dbManager.AddUserToGroup(username, group); err != nil {
 			logger.WithError(err).Warnf("Failed to add user to group %s", group)
 		}
@@ -272,29 +1181,44 @@ func runCreateUser(cmd *cobra.Command, args []string) error {
 		"username":    username,
 		"auth_method": authMethod,
 	}).Info("User created successfully")
+
+	if generatePassword && userConfig.Password != "" {
+		printGeneratedPasswords([]structs.GeneratedPassword{{Username: username, Password: userConfig.Password}})
+	}
 	return nil
 }
 
 // runDropUser handles the drop-user command
 func runDropUser(cmd *cobra.Command, args []string) error {
-	username := args[0]
+	username := structs.NormalizeIdentifier(args[0])
+	reassignTo, _ := cmd.Flags().GetString("reassign-to")
+	cascade, _ := cmd.Flags().GetBool("cascade")
+
+	if reassignTo != "" && cascade {
+		return fmt.Errorf("--reassign-to and --cascade cannot be combined: objects are either reassigned or dropped")
+	}
 
 	logger.WithField("username", username).Info("Dropping user")
 
-	// Get database connection
-	configManager := config.NewManager(logger)
-	dbConn, err := configManager.GetDatabaseConnection()
+	// Connect to the database
+	configManager, err := connectionManager()
 	if err != nil {
-		return fmt.Errorf("failed to get database connection: %w", err)
+		return err
 	}
-
-	// Initialize database manager
-	dbManager, err := database.NewManager(dbConn, logger, dryRun)
+	dbManager, err := newDatabaseManager(configManager)
 	if err != nil {
-		return fmt.Errorf("failed to initialize database manager: %w", err)
+		return err
 	}
 	defer dbManager.Close()
 
+	overrideProtection, _ := cmd.Flags().GetBool("override-protection")
+	dbManager.SetOverrideProtection(overrideProtection)
+	dbManager.SetReassignTo(reassignTo)
+	dbManager.SetCascade(cascade)
+	terminate, _ := cmd.Flags().GetBool("terminate-sessions")
+	grace, _ := cmd.Flags().GetDuration("grace-period")
+	dbManager.SetTerminateSessions(terminate, grace)
+
 	// Drop user
 	if err := dbManager.DropUser(username); err != nil {
 		return fmt.Errorf("failed to drop user: %w", err)
@@ -304,42 +1228,239 @@ func runDropUser(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// runDropGroup handles the drop-group command
+func runDropGroup(cmd *cobra.Command, args []string) error {
+	group := structs.NormalizeIdentifier(args[0])
+	reassignTo, _ := cmd.Flags().GetString("reassign-to")
+	cascade, _ := cmd.Flags().GetBool("cascade")
+
+	if reassignTo != "" && cascade {
+		return fmt.Errorf("--reassign-to and --cascade cannot be combined: objects are either reassigned or dropped")
+	}
+
+	logger.WithField("group", group).Info("Dropping group")
+
+	// Connect to the database
+	configManager, err := connectionManager()
+	if err != nil {
+		return err
+	}
+	dbManager, err := newDatabaseManager(configManager)
+	if err != nil {
+		return err
+	}
+	defer dbManager.Close()
+
+	overrideProtection, _ := cmd.Flags().GetBool("override-protection")
+	dbManager.SetOverrideProtection(overrideProtection)
+	dbManager.SetReassignTo(reassignTo)
+	dbManager.SetCascade(cascade)
+
+	if err := dbManager.DropGroup(group); err != nil {
+		return fmt.Errorf("failed to drop group: %w", err)
+	}
+
+	logger.WithField("group", group).Info("Group dropped successfully")
+	return nil
+}
+
 // runListUsers handles the list-users command
 func runListUsers(cmd *cobra.Command, args []string) error {
+	output, _ := cmd.Flags().GetString("output")
+	if output != "text" && output != "json" {
+		return fmt.Errorf("invalid output format: %s (must be 'text' or 'json')", output)
+	}
+
 	logger.Info("Listing users")
 
-	// Get database connection
-	configManager := config.NewManager(logger)
-	dbConn, err := configManager.GetDatabaseConnection()
+	// Connect to the database
+	configManager, err := connectionManager()
 	if err != nil {
-		return fmt.Errorf("failed to get database connection: %w", err)
+		return err
 	}
-
-	// Initialize database manager
-	dbManager, err := database.NewManager(dbConn, logger, dryRun)
+	dbManager, err := newDatabaseManager(configManager)
 	if err != nil {
-		return fmt.Errorf("failed to initialize database manager: %w", err)
+		return err
 	}
 	defer dbManager.Close()
 
-	// This would require implementing a ListUsers method in the database manager
-	// For now, we'll just indicate that this is a placeholder
-	fmt.Println("User listing functionality to be implemented")
-	
-	return nil
+	users, err := dbManager.ListUsers()
+	if err != nil {
+		return err
+	}
+
+	if loginOnly, _ := cmd.Flags().GetBool("login-only"); loginOnly {
+		loginUsers := users[:0]
+		for _, user := range users {
+			if user.CanLogin {
+				loginUsers = append(loginUsers, user)
+			}
+		}
+		users = loginUsers
+	}
+
+	if output == "json" {
+		data, err := json.MarshalIndent(users, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal users: %w", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "USERNAME\tLOGIN\tCONN LIMIT\tMEMBER OF\tVALID UNTIL\tDESCRIPTION")
+	for _, user := range users {
+		limit := "unlimited"
+		if user.ConnectionLimit >= 0 {
+			limit = strconv.Itoa(user.ConnectionLimit)
+		}
+		validUntil := "-"
+		if user.ValidUntil != nil {
+			validUntil = user.ValidUntil.UTC().Format(time.RFC3339)
+		}
+		memberOf := strings.Join(user.Groups, ",")
+		if memberOf == "" {
+			memberOf = "-"
+		}
+		fmt.Fprintf(w, "%s\t%t\t%s\t%s\t%s\t%s\n", user.Username, user.CanLogin, limit, memberOf, validUntil, user.Description)
+	}
+	return w.Flush()
 }
 
 // runValidate handles the validate command
 func runValidate(cmd *cobra.Command, args []string) error {
+	if printSchema, _ := cmd.Flags().GetBool("print-schema"); printSchema {
+		return printJSON(config.Schema())
+	}
+
 	logger.WithField("config", configPath).Info("Validating configuration")
 
 	// Load configuration
 	configManager := config.NewManager(logger)
-	_, err := configManager.LoadConfig(configPath)
+	cfg, err := configManager.LoadConfig(configPath)
 	if err != nil {
 		return fmt.Errorf("configuration validation failed: %w", err)
 	}
 
-	logger.Info("Configuration is valid")
+	// Check references against the config, and optionally against the live cluster
+	var catalog *structs.ClusterCatalog
+	if againstDB {
+		if profile == "" && len(config.ClusterNames(cfg)) > 0 {
+			return fmt.Errorf("--against-db checks a single cluster: select it with --profile")
+		}
+
+		dbManager, err := newDatabaseManager(configManager)
+		if err != nil {
+			return err
+		}
+		defer dbManager.Close()
+
+		catalog, err = dbManager.GetClusterCatalog()
+		if err != nil {
+			return fmt.Errorf("failed to read cluster catalog: %w", err)
+		}
+	}
+
+	// Loading only warns about unknown fields; validation reports them with the other problems
+	schemaErr := configManager.ValidateSchema()
+
+	// Each cluster is validated separately, since a user or group may be declared once per cluster
+	for _, name := range config.ValidationProfiles(cfg, profile) {
+		selected, err := configManager.SelectProfile(cfg, name)
+		if err != nil {
+			return err
+		}
+		err = config.JoinValidationErrors(
+			schemaErr,
+			configManager.ValidateConfig(selected),
+			configManager.ValidateReferences(selected, catalog),
+		)
+		if err != nil {
+			return fmt.Errorf("configuration validation failed%s: %w", profileSuffix(name), err)
+		}
+	}
+
+	if catalog != nil {
+		selected, err := configManager.SelectProfile(cfg, profile)
+		if err != nil {
+			return err
+		}
+		if err := reportReadiness(config.CheckReadiness(selected, catalog)); err != nil {
+			return err
+		}
+	}
+
+	logger.WithField("checksum", configManager.LoadedChecksum()).Info("Configuration is valid")
 	return nil
-}
\ No newline at end of file
+}
+
+// reportReadiness logs a readiness summary and returns an error when any check failed
+func reportReadiness(checks []config.ReadinessCheck) error {
+	failed := 0
+	for _, check := range checks {
+		entry := logger.WithFields(logrus.Fields{
+			"check":  check.Name,
+			"detail": check.Detail,
+		})
+		if check.Ready {
+			entry.Info("Ready")
+		} else {
+			failed++
+			entry.Error("Not ready")
+		}
+	}
+
+	logger.WithFields(logrus.Fields{
+		"checks": len(checks),
+		"failed": failed,
+	}).Info("Cluster readiness summary")
+
+	if failed > 0 {
+		return fmt.Errorf("cluster is not ready: %d of %d check(s) failed", failed, len(checks))
+	}
+	return nil
+}
+
+// profileSuffix describes the profile being validated in error messages
+func profileSuffix(profile string) string {
+	if profile == "" {
+		return ""
+	}
+	return fmt.Sprintf(" for profile %s", profile)
+}
+
+// runCertMappings handles the cert-mappings command
+func runCertMappings(cmd *cobra.Command, args []string) error {
+	configManager := config.NewManager(logger)
+	cfg, err := configManager.LoadConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	cfg, err = configManager.SelectProfile(cfg, profile)
+	if err != nil {
+		return err
+	}
+
+	mappings := config.CertMappings(cfg)
+	if len(mappings) == 0 {
+		logger.Info("No users are configured for cert authentication")
+		return nil
+	}
+
+	fmt.Println("# pg_hba.conf")
+	for _, mapping := range mappings {
+		fmt.Println(mapping.HBALine)
+	}
+
+	fmt.Println()
+	fmt.Println("# pg_ident.conf")
+	for _, mapping := range mappings {
+		if mapping.IdentLine != "" {
+			fmt.Println(mapping.IdentLine)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// connectionReportCmd represents the connection-report command
+var connectionReportCmd = &cobra.Command{
+	Use:   "connection-report",
+	Short: "Compare each role's connection limit with its current connections",
+	Long: `Report the CONNECTION LIMIT of every login role next to its current connection count
+from pg_stat_activity, so limits can be tuned. Roles using at least --threshold of their
+limit are flagged as near exhaustion.`,
+	RunE: runConnectionReport,
+}
+
+// setConnectionLimitCmd represents the set-connection-limit command
+var setConnectionLimitCmd = &cobra.Command{
+	Use:   "set-connection-limit <user> <limit>",
+	Short: "Change the connection limit of a user without a sync",
+	Long: `Set the CONNECTION LIMIT of a user straight away, for example to contain a service that
+exhausts the connections of the cluster during an incident. A limit of -1 is unlimited and 0
+refuses new connections; existing sessions are not closed.
+
+The change is logged with the principal and recorded in the role comment. When the
+configuration declares the user with a different connection_limit, a warning says that the
+next sync will set it back, so update the configuration to keep the new limit.`,
+	Args: cobra.ExactArgs(2),
+	RunE: runSetConnectionLimit,
+}
+
+func init() {
+	rootCmd.AddCommand(connectionReportCmd)
+	rootCmd.AddCommand(setConnectionLimitCmd)
+
+	connectionReportCmd.Flags().Float64("threshold", 0.8, "flag roles using at least this fraction of their connection limit")
+	connectionReportCmd.Flags().String("output", "text", "report format: text or json")
+}
+
+// connectionReportEntry is a role's connection usage as reported
+type connectionReportEntry struct {
+	structs.ConnectionUsage
+	Utilization float64 `json:"utilization"`
+	NearLimit   bool    `json:"near_limit"`
+}
+
+// runConnectionReport handles the connection-report command
+func runConnectionReport(cmd *cobra.Command, args []string) error {
+	threshold, _ := cmd.Flags().GetFloat64("threshold")
+	output, _ := cmd.Flags().GetString("output")
+
+	if output != "text" && output != "json" {
+		return fmt.Errorf("invalid output format: %s (must be 'text' or 'json')", output)
+	}
+
+	configManager, err := connectionManager()
+	if err != nil {
+		return err
+	}
+	dbManager, err := newDatabaseManager(configManager)
+	if err != nil {
+		return err
+	}
+	defer dbManager.Close()
+
+	usage, err := dbManager.GetConnectionUsage()
+	if err != nil {
+		return err
+	}
+
+	entries := make([]connectionReportEntry, len(usage))
+	nearLimit := 0
+	for i := range usage {
+		entries[i] = connectionReportEntry{ConnectionUsage: usage[i], Utilization: usage[i].Utilization()}
+		if usage[i].Limit > 0 && entries[i].Utilization >= threshold {
+			entries[i].NearLimit = true
+			nearLimit++
+		}
+	}
+
+	if output == "json" {
+		data, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal report: %w", err)
+		}
+		fmt.Println(string(data))
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ROLE\tLIMIT\tCONNECTIONS\tUSED\tSTATUS")
+		for _, entry := range entries {
+			limit, used := "unlimited", "-"
+			if entry.Limit >= 0 {
+				limit = fmt.Sprintf("%d", entry.Limit)
+			}
+			if entry.Limit > 0 {
+				used = fmt.Sprintf("%.0f%%", entry.Utilization*100)
+			}
+			status := "ok"
+			if entry.NearLimit {
+				status = "near limit"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", entry.Role, limit, entry.Connections, used, status)
+		}
+		w.Flush()
+	}
+
+	logger.WithFields(logrus.Fields{
+		"roles":      len(entries),
+		"near_limit": nearLimit,
+		"threshold":  threshold,
+	}).Info("Connection report completed")
+
+	return nil
+}
+
+// runSetConnectionLimit handles the set-connection-limit command
+func runSetConnectionLimit(cmd *cobra.Command, args []string) error {
+	username := structs.NormalizeIdentifier(args[0])
+	limit, err := strconv.Atoi(args[1])
+	if err != nil {
+		return fmt.Errorf("invalid connection limit: %s (must be -1 for unlimited or a number of connections)", args[1])
+	}
+
+	configManager, cfg, err := optionalConfig()
+	if err != nil {
+		return err
+	}
+	dbManager, err := newDatabaseManager(configManager)
+	if err != nil {
+		return err
+	}
+	defer dbManager.Close()
+
+	previous, err := dbManager.SetConnectionLimit(username, limit)
+	if err != nil {
+		return err
+	}
+
+	// The next sync restores the limit the configuration declares
+	if configured, ok := configuredConnectionLimit(cfg, username); ok && configured != limit {
+		logger.WithFields(logrus.Fields{
+			"username":   username,
+			"limit":      limit,
+			"configured": configured,
+		}).Warn("Connection limit differs from the configuration and will be set back by the next sync")
+	}
+
+	switch {
+	case previous == limit:
+		fmt.Printf("Connection limit of %s is already %s\n", username, connectionLimitLabel(limit))
+	case dryRun:
+		logger.WithField("username", username).Info("DRY RUN: Connection limit would be changed")
+	default:
+		fmt.Printf("Connection limit of %s changed from %s to %s\n", username, connectionLimitLabel(previous), connectionLimitLabel(limit))
+	}
+	return nil
+}
+
+// configuredConnectionLimit returns the connection limit the configuration declares for an
+// enabled user, where an unset limit is unlimited
+func configuredConnectionLimit(cfg *structs.Config, username string) (int, bool) {
+	if cfg == nil {
+		return 0, false
+	}
+	for _, user := range cfg.Users {
+		if user.Username != username || !user.Enabled || user.Absent {
+			continue
+		}
+		if user.ConnectionLimit == 0 {
+			return -1, true
+		}
+		return user.ConnectionLimit, true
+	}
+	return 0, false
+}
+
+// connectionLimitLabel formats a connection limit, where -1 is unlimited
+func connectionLimitLabel(limit int) string {
+	if limit < 0 {
+		return "unlimited"
+	}
+	return strconv.Itoa(limit)
+}
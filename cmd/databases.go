@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/config"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// listDatabasesCmd represents the list-databases command
+var listDatabasesCmd = &cobra.Command{
+	Use:   "list-databases",
+	Short: "List databases with their owner and the managed groups that can connect",
+	Long: `List every database in the cluster except templates with its owner, connection limit
+and the groups from the configuration that hold CONNECT on it, a quick map of who can reach
+what. PUBLIC is always shown when everyone may connect. Pass --all-roles to show every role
+holding CONNECT instead of only the managed groups.`,
+	RunE: runListDatabases,
+}
+
+func init() {
+	rootCmd.AddCommand(listDatabasesCmd)
+
+	listDatabasesCmd.Flags().String("output", "text", "output format: text or json")
+	listDatabasesCmd.Flags().Bool("all-roles", false, "show every role holding CONNECT, not only the groups in the configuration")
+}
+
+// runListDatabases handles the list-databases command
+func runListDatabases(cmd *cobra.Command, args []string) error {
+	output, _ := cmd.Flags().GetString("output")
+	allRoles, _ := cmd.Flags().GetBool("all-roles")
+
+	if output != "text" && output != "json" {
+		return fmt.Errorf("invalid output format: %s (must be 'text' or 'json')", output)
+	}
+
+	var configManager *config.Manager
+	var managed map[string]bool
+	if allRoles {
+		var err error
+		if configManager, err = connectionManager(); err != nil {
+			return err
+		}
+	} else {
+		configManager = config.NewManager(logger)
+		cfg, err := configManager.LoadConfig(configPath)
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %w", err)
+		}
+		if cfg, err = configManager.SelectProfile(cfg, profile); err != nil {
+			return err
+		}
+		managed = map[string]bool{"PUBLIC": true}
+		for _, group := range cfg.Groups {
+			managed[group.Name] = true
+		}
+	}
+
+	dbManager, err := newDatabaseManager(configManager)
+	if err != nil {
+		return err
+	}
+	defer dbManager.Close()
+
+	databases, err := dbManager.ListDatabases()
+	if err != nil {
+		return err
+	}
+
+	if managed != nil {
+		for i := range databases {
+			connect := []string{}
+			for _, role := range databases[i].Connect {
+				if managed[role] {
+					connect = append(connect, role)
+				}
+			}
+			databases[i].Connect = connect
+		}
+	}
+
+	if output == "json" {
+		data, err := json.MarshalIndent(databases, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal databases: %w", err)
+		}
+		fmt.Println(string(data))
+	} else {
+		printDatabases(databases)
+	}
+
+	logger.WithFields(logrus.Fields{
+		"databases": len(databases),
+		"all_roles": allRoles,
+	}).Info("Database listing completed")
+
+	return nil
+}
+
+// printDatabases writes the databases as a table
+func printDatabases(databases []structs.DatabaseAccess) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DATABASE\tOWNER\tCONN LIMIT\tCONNECT")
+	for _, d := range databases {
+		limit := "unlimited"
+		if d.ConnectionLimit >= 0 {
+			limit = strconv.Itoa(d.ConnectionLimit)
+		}
+		connect := strings.Join(d.Connect, ",")
+		if connect == "" {
+			connect = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", d.Name, d.Owner, limit, connect)
+	}
+	w.Flush()
+}
@@ -0,0 +1,204 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/config"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/database"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Compare live clusters with the configuration without changing anything",
+	Long: `Connect to the cluster of every profile in the configuration and report, in one combined
+report, how far each is from the configuration: missing roles, users still to be removed or
+disabled, and memberships and database privileges that differ. Use it before rolling a
+configuration out fleet-wide. With --profile only that cluster is compared.
+
+Each profile connects using the POSTGRES_* environment variables, with the host, port and
+database overridden by the profile's entry in the profiles section.`,
+	RunE: runDiff,
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+
+	diffCmd.Flags().String("output", "text", "report format: text or json")
+	diffCmd.Flags().Bool("exit-code", false, "exit with an error when any cluster differs from the configuration")
+}
+
+// runDiff handles the diff command
+func runDiff(cmd *cobra.Command, args []string) error {
+	output, _ := cmd.Flags().GetString("output")
+	exitCode, _ := cmd.Flags().GetBool("exit-code")
+
+	if output != "text" && output != "json" {
+		return fmt.Errorf("invalid output format: %s (must be 'text' or 'json')", output)
+	}
+
+	configManager := config.NewManager(logger)
+	cfg, err := configManager.LoadConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	var reports []*structs.DriftReport
+	for _, name := range config.ValidationProfiles(cfg, profile) {
+		report, err := diffProfile(configManager, cfg, name)
+		if err != nil {
+			// One unreachable cluster should not hide the state of the others
+			logger.WithError(err).WithField("profile", name).Error("Failed to compare cluster")
+			report = &structs.DriftReport{Error: err.Error()}
+		}
+		report.Profile = name
+		reports = append(reports, report)
+	}
+
+	if output == "json" {
+		data, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal report: %w", err)
+		}
+		fmt.Println(string(data))
+	} else {
+		printDriftReports(reports)
+	}
+
+	drifted := 0
+	for _, report := range reports {
+		if report.Error != "" {
+			return fmt.Errorf("failed to compare profile %s: %s", report.Profile, report.Error)
+		}
+		if report.Differences() > 0 {
+			drifted++
+		}
+	}
+	if exitCode && drifted > 0 {
+		return fmt.Errorf("%d of %d cluster(s) differ from the configuration", drifted, len(reports))
+	}
+
+	return nil
+}
+
+// diffProfile compares the cluster of one profile with the configuration as it applies to it
+func diffProfile(configManager *config.Manager, cfg *structs.Config, name string) (*structs.DriftReport, error) {
+	selected, err := configManager.SelectProfile(cfg, name)
+	if err != nil {
+		return nil, err
+	}
+
+	dbConn, err := configManager.GetDatabaseConnection()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database connection: %w", err)
+	}
+
+	// diff only reads, so it always connects for real, even with --dry-run
+	dbManager, err := database.NewManager(dbConn, logger, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize database manager: %w", err)
+	}
+	defer dbManager.Close()
+
+	logger.WithFields(logrus.Fields{
+		"profile": name,
+		"host":    dbConn.Host,
+	}).Info("Comparing cluster with configuration")
+
+	return dbManager.Diff(selected)
+}
+
+// printDriftReports prints a summary table of the drift of every cluster followed by the differences
+func printDriftReports(reports []*structs.DriftReport) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PROFILE\tMISSING ROLES\tTO REMOVE\tTO DISABLE\tATTRIBUTES\tMEMBERSHIPS +/-\tPRIVILEGES +/-\tSTATUS")
+	for _, report := range reports {
+		status := "in sync"
+		switch {
+		case report.Error != "":
+			status = "error"
+		case report.Differences() > 0:
+			status = fmt.Sprintf("%d difference(s)", report.Differences())
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t+%d/-%d\t+%d/-%d\t%s\n",
+			profileLabel(report.Profile),
+			len(report.RolesMissing), len(report.UsersToRemove), len(report.UsersToDisable), len(report.AttributesChanged),
+			len(report.MembershipsMissing), len(report.MembershipsExtra),
+			len(report.PrivilegesMissing), len(report.PrivilegesExtra),
+			status)
+	}
+	w.Flush()
+
+	for _, report := range reports {
+		if report.Error == "" && report.Differences() == 0 {
+			continue
+		}
+
+		fmt.Printf("\n%s:\n", profileLabel(report.Profile))
+		printDriftDetails(report)
+	}
+}
+
+// printDriftDetails prints one line per difference of a cluster, and why it could not be compared
+func printDriftDetails(report *structs.DriftReport) {
+	if report.Error != "" {
+		fmt.Printf("  ! %s\n", report.Error)
+	}
+	for _, conflict := range report.RoleConflicts {
+		fmt.Printf("  ! role %s is managed as a %s but declared as a %s (users and groups share one role namespace)\n",
+			conflict.Role, conflict.Existing, conflict.Declared)
+	}
+	for _, role := range report.RolesMissing {
+		fmt.Printf("  + role %s\n", role)
+	}
+	for _, user := range report.UsersToRemove {
+		fmt.Printf("  - role %s (absent)\n", user)
+	}
+	for _, user := range report.UsersToDisable {
+		fmt.Printf("  ~ role %s (disable login)\n", user)
+	}
+	for _, rename := range report.RolesToRename {
+		fmt.Printf("  ~ role %s -> %s (renamed)\n", rename.From, rename.To)
+	}
+	for _, change := range report.AttributesChanged {
+		fmt.Printf("  ~ role %s %s: %q -> %q\n", change.Role, change.Attribute, change.Current, change.Desired)
+	}
+	for _, membership := range report.MembershipsMissing {
+		fmt.Printf("  + %s member of %s\n", membership.Member, membership.Group)
+	}
+	for _, membership := range report.MembershipsExtra {
+		fmt.Printf("  - %s member of %s\n", membership.Member, membership.Group)
+	}
+	for _, grant := range report.PrivilegesMissing {
+		fmt.Printf("  + %s %s on %s\n", grant.Target, grant.Privilege, grant.Database)
+	}
+	for _, grant := range report.PrivilegesExtra {
+		fmt.Printf("  - %s %s on %s\n", grant.Target, grant.Privilege, grant.Database)
+	}
+	for _, role := range report.RolesToPrune {
+		fmt.Printf("  - role %s (no longer configured)\n", role)
+	}
+	for _, schema := range report.SchemasMissing {
+		fmt.Printf("  + schema %s\n", schema)
+	}
+	for _, owner := range report.SchemaOwnersChanged {
+		fmt.Printf("  ~ schema %s owner: %q -> %q\n", owner.Schema, owner.Current, owner.Desired)
+	}
+	for _, grant := range report.SchemaPrivilegesMissing {
+		fmt.Printf("  + %s %s on schema %s\n", grant.Target, grant.Privilege, grant.Schema)
+	}
+}
+
+// profileLabel names a profile in reports, including the unnamed default
+func profileLabel(profile string) string {
+	if profile == "" {
+		return "(default)"
+	}
+	return profile
+}
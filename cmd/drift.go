@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/config"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// driftCmd represents the drift command
+var driftCmd = &cobra.Command{
+	Use:   "drift",
+	Short: "Fail when live clusters have drifted from the configuration",
+	Long: `Compare the cluster of every profile in the configuration with the configuration, as diff
+does, print only what has drifted, one line per difference, and exit non-zero when any
+cluster differs or cannot be compared. Run it on a schedule in CI to be alerted when roles,
+memberships or privileges are changed by hand. With --profile only that cluster is checked.`,
+	RunE: runDrift,
+}
+
+func init() {
+	rootCmd.AddCommand(driftCmd)
+
+	driftCmd.Flags().String("output", "text", "report format: text or json")
+}
+
+// runDrift handles the drift command
+func runDrift(cmd *cobra.Command, args []string) error {
+	output, _ := cmd.Flags().GetString("output")
+	if output != "text" && output != "json" {
+		return fmt.Errorf("invalid output format: %s (must be 'text' or 'json')", output)
+	}
+
+	configManager := config.NewManager(logger)
+	cfg, err := configManager.LoadConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	reports := []*structs.DriftReport{}
+	drifted, failed := 0, 0
+	for _, name := range config.ValidationProfiles(cfg, profile) {
+		report, err := diffProfile(configManager, cfg, name)
+		if err != nil {
+			logger.WithError(err).WithField("profile", name).Error("Failed to compare cluster")
+			report = &structs.DriftReport{Error: err.Error()}
+		}
+		report.Profile = name
+		reports = append(reports, report)
+
+		switch {
+		case report.Error != "":
+			failed++
+		case report.Differences() > 0:
+			drifted++
+		}
+	}
+
+	if output == "json" {
+		if err := printJSON(reports); err != nil {
+			return err
+		}
+	} else {
+		for _, report := range reports {
+			switch {
+			case report.Error != "":
+				fmt.Printf("%s: not compared\n", profileLabel(report.Profile))
+			case report.Differences() > 0:
+				fmt.Printf("%s: %d difference(s)\n", profileLabel(report.Profile), report.Differences())
+			default:
+				fmt.Printf("%s: in sync\n", profileLabel(report.Profile))
+				continue
+			}
+			printDriftDetails(report)
+		}
+	}
+
+	logger.WithFields(logrus.Fields{
+		"clusters": len(reports),
+		"drifted":  drifted,
+		"failed":   failed,
+	}).Info("Drift check completed")
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d cluster(s) could not be compared with the configuration", failed, len(reports))
+	}
+	if drifted > 0 {
+		return fmt.Errorf("%d of %d cluster(s) have drifted from the configuration", drifted, len(reports))
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/config"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/database"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// writeElevatedSQL writes the statements a sync left to a role with elevated access to the
+// file given with --elevated-sql, with the profile appended when syncing one. The file is
+// written even when nothing was left, so a script from an earlier run is not run by mistake.
+func writeElevatedSQL(cmd *cobra.Command, configManager *config.Manager, result *structs.SyncResult, name string) error {
+	path, _ := cmd.Flags().GetString("elevated-sql")
+	if path == "" {
+		return nil
+	}
+	if name != "" {
+		path += "." + name
+	}
+
+	// The statements of a rolled back sync refer to roles that were never created
+	statements := result.Elevated
+	if result.RolledBack {
+		statements = nil
+	}
+
+	dbConn, err := configManager.GetDatabaseConnection()
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer file.Close()
+
+	if err := database.WriteElevatedScript(file, dbConn.Database, statements); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	logger.WithFields(logrus.Fields{
+		"file":       path,
+		"statements": len(statements),
+	}).Info("Wrote the statements that need elevated access")
+	return nil
+}
@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/config"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/database"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/events"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/spf13/cobra"
+)
+
+// eventsCmd groups the commands for the Cognito event pipeline
+var eventsCmd = &cobra.Command{
+	Use:   "events",
+	Short: "Debug the event pipeline of serve-lambda and serve",
+}
+
+// eventsSimulateCmd represents the events simulate command
+var eventsSimulateCmd = &cobra.Command{
+	Use:   "simulate [file]",
+	Short: "Show what the event pipeline would do with an event, without applying it",
+	Long: `Run a sample event through the pipeline serve-lambda and serve's /events apply events
+with, printing the output of each stage: the parsed event, validation, the role name of the
+login, the roles its groups map to and the SQL that applying it would execute. The event is a
+Cognito user pool trigger or an event payload, read from the file or from stdin with -.
+
+Group mappings and username rules come from the configuration file when it exists. The SQL
+stage looks up the roles in the database, always as a dry run; --offline skips it so no
+database is needed.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runEventsSimulate,
+}
+
+func init() {
+	rootCmd.AddCommand(eventsCmd)
+	eventsCmd.AddCommand(eventsSimulateCmd)
+
+	eventsSimulateCmd.Flags().String("auth-method", structs.AuthMethodIAM, "auth method for users provisioned from events, as for serve-lambda")
+	eventsSimulateCmd.Flags().Bool("offline", false, "skip the SQL stage, which needs the database")
+	eventsSimulateCmd.Flags().String("output", "text", "output format: text or json")
+}
+
+// eventSimulation is the output of events simulate
+type eventSimulation struct {
+	*events.Simulation
+	Statements []structs.PlannedStatement `json:"statements,omitempty"`
+	Error      string                     `json:"error,omitempty"` // Why applying the event would fail
+}
+
+// runEventsSimulate handles the events simulate command
+func runEventsSimulate(cmd *cobra.Command, args []string) error {
+	authMethod, _ := cmd.Flags().GetString("auth-method")
+	offline, _ := cmd.Flags().GetBool("offline")
+	output, _ := cmd.Flags().GetString("output")
+	if output != "text" && output != "json" {
+		return fmt.Errorf("invalid output format: %s (must be 'text' or 'json')", output)
+	}
+
+	var raw []byte
+	var err error
+	if args[0] == "-" {
+		raw, err = io.ReadAll(os.Stdin)
+	} else {
+		raw, err = os.ReadFile(args[0])
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read event: %w", err)
+	}
+
+	configManager, err := connectionManager()
+	if err != nil {
+		return err
+	}
+	eventHandler, err := newEventHandler(configManager)
+	if err != nil {
+		return err
+	}
+
+	simulation, err := eventHandler.Simulate(raw)
+	if err != nil {
+		return err
+	}
+	result := &eventSimulation{Simulation: simulation}
+
+	if !offline && !simulation.Ignored {
+		statements, err := simulateApply(configManager, eventHandler, authMethod, simulation.Event)
+		result.Statements = statements
+		if err != nil {
+			result.Error = err.Error()
+		}
+	}
+
+	if output == "json" {
+		return printJSON(result)
+	}
+	printEventSimulation(os.Stdout, result, offline)
+	return nil
+}
+
+// simulateApply applies an event to a dry-run database manager and returns the statements
+// it would have executed
+func simulateApply(configManager *config.Manager, eventHandler *events.EventHandler, authMethod string, event *structs.EventPayload) ([]structs.PlannedStatement, error) {
+	dbConn, err := configManager.GetDatabaseConnection()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database connection: %w", err)
+	}
+
+	// Whatever --dry-run says, simulating never changes the database
+	dbManager, err := database.NewManagerContext(commandCtx, dbConn, logger, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize database manager: %w", err)
+	}
+	defer dbManager.Close()
+	if err := dbManager.SetHooks(configManager.Hooks()); err != nil {
+		return nil, err
+	}
+	tagRoleSource(dbManager, configManager, roleSourceLambda)
+
+	dbManager.CollectStatements()
+	err = events.NewApplier(eventHandler, dbManager, authMethod).ApplyPayload(event)
+	return dbManager.CollectedStatements(), err
+}
+
+// printEventSimulation prints the output of each stage of the pipeline for an event
+func printEventSimulation(w io.Writer, result *eventSimulation, offline bool) {
+	event := result.Event
+	fmt.Fprintf(w, "Event (%s):\n", result.Format)
+	fmt.Fprintf(w, "  type:     %s\n", event.EventType)
+	fmt.Fprintf(w, "  user ID:  %s\n", event.UserID)
+	fmt.Fprintf(w, "  login:    %s\n", event.Username)
+	if len(event.Groups) > 0 {
+		fmt.Fprintf(w, "  groups:   %s\n", strings.Join(event.Groups, ", "))
+	}
+
+	if result.Ignored {
+		fmt.Fprintf(w, "\nIgnored: Cognito %s triggers pass through without changes\n", event.EventType)
+		return
+	}
+
+	fmt.Fprintln(w, "\nValidation:")
+	if result.Validation == "" && result.Processing == "" {
+		fmt.Fprintln(w, "  ok")
+	}
+	for _, problem := range []string{result.Validation, result.Processing} {
+		if problem != "" {
+			fmt.Fprintf(w, "  %s\n", problem)
+		}
+	}
+
+	fmt.Fprintln(w, "\nUsername:")
+	fmt.Fprintf(w, "  %s -> %s\n", event.Username, result.Username)
+
+	if len(result.Groups) > 0 {
+		fmt.Fprintln(w, "\nGroup mappings:")
+		for _, mapping := range result.Groups {
+			role := mapping.Role
+			if role == "" {
+				role = "(no role)"
+			}
+			fmt.Fprintf(w, "  %s -> %s\n", mapping.Group, role)
+		}
+	}
+
+	fmt.Fprintln(w, "\nSQL (dry run):")
+	switch {
+	case offline:
+		fmt.Fprintln(w, "  skipped (--offline)")
+		return
+	case len(result.Statements) == 0 && result.Error == "":
+		fmt.Fprintln(w, "  nothing to execute")
+	}
+	for _, statement := range result.Statements {
+		fmt.Fprintf(w, "  %s\n", statement.Query)
+		if statement.Problem != "" {
+			fmt.Fprintf(w, "    would fail: %s\n", statement.Problem)
+		}
+	}
+	if result.Error != "" {
+		fmt.Fprintf(w, "  error: %s\n", result.Error)
+	}
+}
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/config"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/database"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/spf13/cobra"
+)
+
+// expireCmd represents the expire command
+var expireCmd = &cobra.Command{
+	Use:   "expire",
+	Short: "Revoke temporary group memberships that have expired",
+	Long: `Revoke the temporary_groups memberships of configured users whose expires_at has passed,
+and report the ones that expire within --within. Only memberships are changed; run sync to
+apply the rest of the configuration. With --interval the check repeats on a schedule until
+interrupted, so expirations take effect without waiting for the next sync.`,
+	RunE: runExpire,
+}
+
+func init() {
+	rootCmd.AddCommand(expireCmd)
+
+	expireCmd.Flags().Duration("within", database.DefaultExpiryWindow, "report memberships that expire within this duration")
+	expireCmd.Flags().Duration("interval", 0, "repeat the check on this interval until interrupted (0 runs once)")
+	expireCmd.Flags().String("output", "text", "report format: text or json")
+}
+
+// expiryReport is the outcome of expire as printed with --output json
+type expiryReport struct {
+	Expired  []structs.MembershipExpiry `json:"expired"`
+	Upcoming []structs.MembershipExpiry `json:"upcoming"`
+	Errors   []string                   `json:"errors"`
+}
+
+// runExpire handles the expire command
+func runExpire(cmd *cobra.Command, args []string) error {
+	within, _ := cmd.Flags().GetDuration("within")
+	interval, _ := cmd.Flags().GetDuration("interval")
+	output, _ := cmd.Flags().GetString("output")
+
+	if output != "text" && output != "json" {
+		return fmt.Errorf("invalid output format: %s (must be 'text' or 'json')", output)
+	}
+
+	ctx, stop := signal.NotifyContext(commandCtx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	return runScheduled(ctx, "membership expiry", interval, func() error {
+		return expireOnce(within, output)
+	})
+}
+
+// expireOnce loads the configuration and revokes the temporary memberships that have expired
+func expireOnce(within time.Duration, output string) error {
+	configManager := config.NewManager(logger)
+	cfg, err := configManager.LoadConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	if cfg, err = configManager.SelectProfile(cfg, profile); err != nil {
+		return err
+	}
+
+	dbManager, err := newDatabaseManager(configManager)
+	if err != nil {
+		return err
+	}
+	defer dbManager.Close()
+
+	result := dbManager.ExpireMemberships(cfg.Users, time.Now(), within)
+
+	if output == "json" {
+		report := expiryReport{
+			Expired:  append([]structs.MembershipExpiry{}, result.Expired...),
+			Upcoming: append([]structs.MembershipExpiry{}, result.Upcoming...),
+			Errors:   make([]string, len(result.Errors)),
+		}
+		for i, err := range result.Errors {
+			report.Errors[i] = err.Error()
+		}
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal expiry report: %w", err)
+		}
+		fmt.Println(string(data))
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "MEMBER\tGROUP\tEXPIRES AT\tSTATUS")
+		for _, membership := range result.Expired {
+			fmt.Fprintf(w, "%s\t%s\t%s\trevoked\n", membership.Member, membership.Group, membership.ExpiresAt.Format(time.RFC3339))
+		}
+		for _, membership := range result.Upcoming {
+			fmt.Fprintf(w, "%s\t%s\t%s\texpires in %s\n", membership.Member, membership.Group, membership.ExpiresAt.Format(time.RFC3339),
+				time.Until(membership.ExpiresAt).Round(time.Minute))
+		}
+		w.Flush()
+
+		for _, err := range result.Errors {
+			logger.Error(err)
+		}
+	}
+
+	if len(result.Errors) > 0 {
+		return fmt.Errorf("membership expiry completed with %d errors", len(result.Errors))
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// listExpiringCmd represents the list-expiring command
+var listExpiringCmd = &cobra.Command{
+	Use:   "list-expiring",
+	Short: "List users whose password validity expires soon",
+	Long: `List the login roles whose VALID UNTIL passes within --days, soonest first, together with
+the ones that have already expired, so passwords can be rotated or valid_until extended before
+users are locked out. Roles without a VALID UNTIL never expire and are not listed.`,
+	RunE: runListExpiring,
+}
+
+func init() {
+	rootCmd.AddCommand(listExpiringCmd)
+
+	listExpiringCmd.Flags().Int("days", 30, "list users whose validity expires within this number of days")
+	listExpiringCmd.Flags().Bool("include-expired", true, "also list users whose validity has already expired")
+	listExpiringCmd.Flags().String("output", "text", "report format: text or json")
+}
+
+// expiringUser is a login role whose password validity is about to expire, or has expired
+type expiringUser struct {
+	Username   string    `json:"username"`
+	ValidUntil time.Time `json:"valid_until"`
+	DaysLeft   int       `json:"days_left"` // Whole days until expiry, negative once expired
+	Expired    bool      `json:"expired"`
+}
+
+// runListExpiring handles the list-expiring command
+func runListExpiring(cmd *cobra.Command, args []string) error {
+	days, _ := cmd.Flags().GetInt("days")
+	includeExpired, _ := cmd.Flags().GetBool("include-expired")
+	output, _ := cmd.Flags().GetString("output")
+
+	if output != "text" && output != "json" {
+		return fmt.Errorf("invalid output format: %s (must be 'text' or 'json')", output)
+	}
+	if days < 0 {
+		return fmt.Errorf("--days must not be negative")
+	}
+
+	configManager, err := connectionManager()
+	if err != nil {
+		return err
+	}
+	dbManager, err := newDatabaseManager(configManager)
+	if err != nil {
+		return err
+	}
+	defer dbManager.Close()
+
+	users, err := dbManager.ListUsers()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	cutoff := now.AddDate(0, 0, days)
+	expiring := []expiringUser{}
+	expired := 0
+	for _, user := range users {
+		if !user.CanLogin || user.ValidUntil == nil || user.ValidUntil.After(cutoff) {
+			continue
+		}
+		entry := expiringUser{
+			Username:   user.Username,
+			ValidUntil: user.ValidUntil.UTC(),
+			DaysLeft:   int(user.ValidUntil.Sub(now).Hours() / 24),
+			Expired:    !user.ValidUntil.After(now),
+		}
+		if entry.Expired {
+			if !includeExpired {
+				continue
+			}
+			expired++
+		}
+		expiring = append(expiring, entry)
+	}
+	sort.SliceStable(expiring, func(i, j int) bool { return expiring[i].ValidUntil.Before(expiring[j].ValidUntil) })
+
+	if output == "json" {
+		data, err := json.MarshalIndent(expiring, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal report: %w", err)
+		}
+		fmt.Println(string(data))
+	} else if len(expiring) == 0 {
+		fmt.Printf("No users expire within %d days\n", days)
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "USERNAME\tVALID UNTIL\tDAYS LEFT\tSTATUS")
+		for _, entry := range expiring {
+			status := "expiring"
+			if entry.Expired {
+				status = "expired"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", entry.Username, entry.ValidUntil.Format(time.RFC3339), entry.DaysLeft, status)
+		}
+		w.Flush()
+	}
+
+	logger.WithFields(logrus.Fields{
+		"days":     days,
+		"expiring": len(expiring) - expired,
+		"expired":  expired,
+	}).Info("Expiring users listed")
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/config"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/sources"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// rdsReservedRoles are the roles RDS and Aurora create for themselves, which export leaves
+// out unless --exclude is given
+var rdsReservedRoles = []string{"rds_ad", "rds_iam", "rds_password", "rds_replication", "rds_superuser", "rdsadmin", "rdsrepladmin", "rdstopmgr"}
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Create a configuration from the roles of an existing cluster",
+	Long: `Read the roles of the cluster, their direct memberships, their database grants and
+their grants on the schemas of the connected database, and write the configuration they
+describe, so an existing cluster can be adopted without writing the configuration by hand.
+Roles are mapped as import-roles maps the roles of a dump: LOGIN roles become users and
+NOLOGIN roles become groups, and members of rds_iam use IAM authentication.
+
+Roles this tool already manages keep what it recorded in their comments: users it disabled
+are exported as disabled users, with their description, ownership, auth methods and deletion
+protection. Grants on schemas an extension is installed in become extension_schemas.
+
+Superusers, pg_* roles, the connected role and the roles given with --exclude (by default
+the roles RDS reserves for itself) are left out. Passwords are not exported. Everything else
+that cannot be expressed in the configuration, such as CREATEDB or grants on other schemas,
+is reported as a warning.`,
+	RunE: runExport,
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+
+	exportCmd.Flags().StringSlice("exclude", rdsReservedRoles, "roles to leave out")
+	exportCmd.Flags().String("output", "", "write the configuration to this file, as JSON or YAML by its extension (default: print JSON)")
+}
+
+// runExport handles the export command
+func runExport(cmd *cobra.Command, args []string) error {
+	exclude, _ := cmd.Flags().GetStringSlice("exclude")
+	output, _ := cmd.Flags().GetString("output")
+
+	configManager, err := connectionManager()
+	if err != nil {
+		return err
+	}
+	dbManager, err := newDatabaseManager(configManager)
+	if err != nil {
+		return err
+	}
+	defer dbManager.Close()
+
+	// The connected role administers the others and is not managed by its own configuration
+	catalog, err := dbManager.GetClusterCatalog()
+	if err != nil {
+		return err
+	}
+	roles, err := dbManager.ListClusterRoles()
+	if err != nil {
+		return err
+	}
+
+	export := sources.ExportClusterRoles(roles, append(exclude, catalog.CurrentUser))
+	for _, warning := range export.Warnings {
+		logger.Warn(warning)
+	}
+
+	// Roles PostgreSQL accepts can still break the rules of the configuration, e.g. names
+	// that only differ in case, so problems are reported but do not stop the export
+	exportManager := config.NewManager(logger)
+	if err := exportManager.ValidateConfig(export.Config); err != nil {
+		logger.WithError(err).Warn("Exported configuration needs changes before it can be synced")
+	}
+
+	logger.WithFields(logrus.Fields{
+		"users":    len(export.Config.Users),
+		"groups":   len(export.Config.Groups),
+		"warnings": len(export.Warnings),
+	}).Info("Exported roles")
+
+	switch {
+	case output == "":
+		return printJSON(export.Config)
+	case dryRun:
+		logger.WithField("output", output).Info("DRY RUN: Would write configuration")
+		return nil
+	default:
+		return exportManager.SaveConfig(export.Config, output)
+	}
+}
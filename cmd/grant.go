@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/database"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/spf13/cobra"
+)
+
+// grantCmd represents the grant command
+var grantCmd = &cobra.Command{
+	Use:   "grant",
+	Short: "Grant privileges on databases, schemas or tables to a user or group",
+	Long: `Grant privileges to a role directly, without a sync. Give the objects with exactly one of
+--databases, --schemas or --tables. Schemas and tables belong to the database connected to
+(POSTGRES_DB or the database of --profile), or to the database given with --database; tables
+are schema.table, a table name in the public schema, or schema.* for every table currently in
+the schema.
+
+Database privileges granted here are not in the configuration, so a sync reports them and
+revokes them with --exact-privileges.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error { return runPrivileges(cmd, true) },
+}
+
+// revokeCmd represents the revoke command
+var revokeCmd = &cobra.Command{
+	Use:   "revoke",
+	Short: "Revoke privileges on databases, schemas or tables from a user or group",
+	Long: `Revoke privileges from a role directly, without a sync, taking the same flags as grant.
+Privileges the configuration declares are granted again by the next sync.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error { return runPrivileges(cmd, false) },
+}
+
+func init() {
+	for _, command := range []*cobra.Command{grantCmd, revokeCmd} {
+		rootCmd.AddCommand(command)
+
+		command.Flags().String("target", "", "user or group the privileges apply to (required)")
+		command.Flags().StringSlice("privileges", []string{}, "privileges, e.g. CONNECT, USAGE or SELECT (required)")
+		command.Flags().StringSlice("databases", []string{}, "databases the privileges apply to")
+		command.Flags().StringSlice("schemas", []string{}, "schemas the privileges apply to")
+		command.Flags().StringSlice("tables", []string{}, "tables the privileges apply to: schema.table, table or schema.*")
+		command.Flags().String("database", "", "database the schemas or tables belong to (default: the connected database)")
+		command.MarkFlagRequired("target")
+		command.MarkFlagRequired("privileges")
+		command.MarkFlagsOneRequired("databases", "schemas", "tables")
+		command.MarkFlagsMutuallyExclusive("databases", "schemas", "tables")
+		command.MarkFlagsMutuallyExclusive("databases", "database")
+	}
+}
+
+// runPrivileges handles the grant and revoke commands
+func runPrivileges(cmd *cobra.Command, grant bool) error {
+	target, _ := cmd.Flags().GetString("target")
+	target = structs.NormalizeIdentifier(target)
+	privileges, _ := cmd.Flags().GetStringSlice("privileges")
+	databases, _ := cmd.Flags().GetStringSlice("databases")
+	schemas, _ := cmd.Flags().GetStringSlice("schemas")
+	tables, _ := cmd.Flags().GetStringSlice("tables")
+	databaseName, _ := cmd.Flags().GetString("database")
+
+	// Database privileges go straight into the statement, so check them before connecting
+	if len(databases) > 0 {
+		if err := database.CheckDatabasePrivileges(privileges); err != nil {
+			return err
+		}
+	}
+
+	configManager, err := connectionManager()
+	if err != nil {
+		return err
+	}
+	dbManager, err := newDatabaseManager(configManager)
+	if err != nil {
+		return err
+	}
+	defer dbManager.Close()
+
+	exists, err := dbManager.GroupExists(target)
+	if err != nil {
+		return fmt.Errorf("failed to check if role exists: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("role %s does not exist", target)
+	}
+
+	if len(databases) > 0 {
+		if grant {
+			return dbManager.GrantPrivileges(target, privileges, databases)
+		}
+		return dbManager.RevokePrivileges(target, privileges, databases)
+	}
+
+	// Schema and table privileges are granted while connected to the database they belong to
+	return dbManager.InDatabase(databaseName, func(db *database.Manager) error {
+		switch {
+		case len(schemas) > 0 && grant:
+			return db.GrantSchemaPrivileges(target, privileges, schemas)
+		case len(schemas) > 0:
+			return db.RevokeSchemaPrivileges(target, privileges, schemas)
+		case grant:
+			return db.GrantTablePrivileges(target, privileges, tables)
+		default:
+			return db.RevokeTablePrivileges(target, privileges, tables)
+		}
+	})
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/database"
+)
+
+// remediationHints tells the operator what to do about each kind of database failure
+var remediationHints = map[database.ErrorKind]string{
+	database.ErrorKindConnection:        "check POSTGRES_HOST and POSTGRES_PORT (or the profile's host and port) and that the server accepts connections from this machine; for a paused Aurora Serverless cluster set POSTGRES_RESUME_TIMEOUT to wait for it to resume",
+	database.ErrorKindAuthentication:    "check POSTGRES_USER and POSTGRES_PASSWORD; with IAM authentication check that the AWS identity has rds-db:connect for the user and that the user is granted rds_iam",
+	database.ErrorKindHostRejected:      "check the pg_hba.conf entries for this host, user and database",
+	database.ErrorKindSSLRequired:       "the server only accepts encrypted connections from this host; check the pg_hba.conf hostssl entries or set POSTGRES_SSLMODE (or ssl_mode in the configuration) to require",
+	database.ErrorKindSSLUnavailable:    "the server does not have SSL enabled; check its ssl setting in postgresql.conf or, for a local server only, set POSTGRES_SSLMODE to prefer or disable",
+	database.ErrorKindPermission:        "the connected role lacks the privilege; run whoami to check it is a superuser or has CREATEROLE, and validate --against-db to check its grant options",
+	database.ErrorKindAlreadyExists:     "the role already exists, possibly created outside this tool; run sync to manage it from the configuration",
+	database.ErrorKindAlreadyMember:     "the membership already exists; run sync, which skips memberships that are already granted",
+	database.ErrorKindDependentObjects:  "the role still owns objects or holds privileges; run drop-user or drop-group with --reassign-to <role> to hand them over, or set role_removal for sync, in every database it owns objects in",
+	database.ErrorKindDeletionProtected: "the role has deletion protection; pass --override-protection if dropping it is intended",
+	database.ErrorKindTimeout:           "the command ran out of time; raise --timeout or sync fewer entities at once",
+	database.ErrorKindReadReplica:       "the server is a read replica; point POSTGRES_HOST (or the profile's host) at the writer or cluster endpoint, or list the cluster's endpoints in POSTGRES_ENDPOINTS (or the profile's endpoints) to fail over to the writer",
+}
+
+// remediationHint returns what to do about a failure, or an empty string when there is no
+// specific advice
+func remediationHint(err error) string {
+	classified := database.Classify(err)
+	if classified == nil {
+		return ""
+	}
+	return remediationHints[classified.Kind]
+}
+
+// printRemediationHint writes the hint for a failure to stderr, if there is one
+func printRemediationHint(err error) {
+	if hint := remediationHint(err); hint != "" {
+		fmt.Fprintf(os.Stderr, "Hint: %s\n", hint)
+	}
+}
@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/history"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// historyTimeout bounds recording the results of a sync in the history
+const historyTimeout = 30 * time.Second
+
+// historyCmd represents the history command
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show trends across the sync runs recorded with --history",
+	Long: `Summarize the sync runs recorded with sync --history per day, week or month: how many
+runs there were and how many failed, how much drift they corrected, how many users and groups
+were declared and who triggered the runs that changed something. The history is a local file
+or an s3://bucket/prefix location, so runs from CI, cron and laptops can share one history.`,
+	RunE: runHistory,
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+
+	historyCmd.Flags().String("history", "", "history to read: a local file or s3://bucket/prefix (required)")
+	historyCmd.Flags().Int("days", 90, "only report runs from the last number of days")
+	historyCmd.Flags().String("period", string(history.PeriodWeek), "group runs by day, week or month")
+	historyCmd.Flags().String("output", "text", "output format: text or json")
+	historyCmd.MarkFlagRequired("history")
+}
+
+// historyReport is the result of the history command
+type historyReport struct {
+	Since      time.Time       `json:"since"`
+	Period     history.Period  `json:"period"`
+	Runs       int             `json:"runs"`
+	Trends     []history.Trend `json:"trends"`
+	Principals map[string]int  `json:"principals"` // Runs that changed something over the whole range, by who triggered them
+}
+
+// runHistory handles the history command
+func runHistory(cmd *cobra.Command, args []string) error {
+	location, _ := cmd.Flags().GetString("history")
+	days, _ := cmd.Flags().GetInt("days")
+	periodName, _ := cmd.Flags().GetString("period")
+	output, _ := cmd.Flags().GetString("output")
+
+	if output != "text" && output != "json" {
+		return fmt.Errorf("invalid output format: %s (must be 'text' or 'json')", output)
+	}
+	period, err := history.ParsePeriod(periodName)
+	if err != nil {
+		return err
+	}
+	if days <= 0 {
+		return fmt.Errorf("--days must be positive")
+	}
+
+	store, err := history.Open(commandCtx, location)
+	if err != nil {
+		return err
+	}
+
+	since := time.Now().UTC().AddDate(0, 0, -days)
+	entries, err := store.List(commandCtx, since)
+	if err != nil {
+		return err
+	}
+
+	// --profile narrows the report to one cluster
+	if profile != "" {
+		selected := entries[:0]
+		for _, entry := range entries {
+			if entry.Profile == profile {
+				selected = append(selected, entry)
+			}
+		}
+		entries = selected
+	}
+
+	report := historyReport{
+		Since:      since,
+		Period:     period,
+		Runs:       len(entries),
+		Trends:     history.Summarize(entries, period),
+		Principals: map[string]int{},
+	}
+	if report.Trends == nil {
+		report.Trends = []history.Trend{}
+	}
+	for _, trend := range report.Trends {
+		for principal, runs := range trend.Principals {
+			report.Principals[principal] += runs
+		}
+	}
+
+	if output == "json" {
+		return printJSON(report)
+	}
+	printHistory(report)
+	return nil
+}
+
+// printHistory writes a trend table followed by who triggered the runs that changed something
+func printHistory(report historyReport) {
+	if report.Runs == 0 {
+		fmt.Printf("No sync runs recorded since %s\n", report.Since.Format("2006-01-02"))
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PERIOD\tRUNS\tFAILED\tERROR RATE\tDRIFT\tUSERS\tGROUPS")
+	for _, trend := range report.Trends {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.0f%%\t%d\t%d\t%d\n",
+			periodLabel(report.Period, trend.Start), trend.Runs, trend.FailedRuns, trend.ErrorRate*100,
+			trend.Drift, trend.Users, trend.Groups)
+	}
+	w.Flush()
+
+	if len(report.Principals) == 0 {
+		return
+	}
+	principals := make([]string, 0, len(report.Principals))
+	for principal := range report.Principals {
+		principals = append(principals, principal)
+	}
+	sort.Slice(principals, func(i, j int) bool {
+		if report.Principals[principals[i]] != report.Principals[principals[j]] {
+			return report.Principals[principals[i]] > report.Principals[principals[j]]
+		}
+		return principals[i] < principals[j]
+	})
+
+	fmt.Println("\nRuns that changed the cluster, by who triggered them:")
+	for _, principal := range principals {
+		fmt.Printf("  %-6d %s\n", report.Principals[principal], principal)
+	}
+}
+
+// periodLabel formats the start of a period, e.g. 2024-05, 2024-W18 or 2024-05-01
+func periodLabel(period history.Period, start time.Time) string {
+	switch period {
+	case history.PeriodMonth:
+		return start.Format("2006-01")
+	case history.PeriodWeek:
+		year, week := start.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	default:
+		return start.Format("2006-01-02")
+	}
+}
+
+// recordSyncHistory appends the results of a sync to the history given with --history. A
+// failed write is logged and does not fail the sync.
+func recordSyncHistory(cmd *cobra.Command, results ...*structs.SyncResult) {
+	location, _ := cmd.Flags().GetString("history")
+	if location == "" {
+		return
+	}
+
+	// An interrupted sync is still recorded, but an unreachable store does not stall the exit
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(commandCtx), historyTimeout)
+	defer cancel()
+	store, err := history.Open(ctx, location)
+	if err != nil {
+		logger.WithError(err).WithField("history", location).Warn("Failed to open sync history")
+		return
+	}
+
+	now := time.Now()
+	for _, result := range results {
+		fields := logrus.Fields{
+			"history": location,
+			"profile": result.Profile,
+		}
+		if err := store.Append(ctx, history.NewEntry(result, dryRun, now)); err != nil {
+			logger.WithError(err).WithFields(fields).Warn("Failed to record sync history")
+			continue
+		}
+		logger.WithFields(fields).Debug("Recorded sync history")
+	}
+}
@@ -0,0 +1,394 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/config"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/sources"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// importLDAPCmd represents the import-ldap command
+var importLDAPCmd = &cobra.Command{
+	Use:   "import-ldap",
+	Short: "Import users from LDAP or Active Directory group membership",
+	Long: `Query LDAP or Active Directory groups and update the users section of the configuration
+so database access follows directory group membership. Each --group-map maps a directory
+group DN to a database group. Users that are no longer members of any mapped group are
+disabled. Users added by hand are never modified.
+
+Environment Variables:
+  LDAP_URL            - LDAP server URL (or --ldap-url)
+  LDAP_BIND_DN        - DN to bind as (or --bind-dn)
+  LDAP_BIND_PASSWORD  - Password of the bind DN`,
+	RunE: runImportLDAP,
+}
+
+// importIdPCmd represents the import-idp command
+var importIdPCmd = &cobra.Command{
+	Use:   "import-idp",
+	Short: "Import users from Okta or a SCIM 2.0 identity provider",
+	Long: `Read the members of identity provider groups from Okta or any SCIM 2.0 service provider,
+map the groups to database roles with the Cognito group mapping, and update the users
+section of the configuration. With --interval the import repeats on a schedule until
+interrupted, so database access keeps following the identity provider.
+
+Environment Variables:
+  IDP_URL    - Okta org URL or SCIM base URL (or --idp-url)
+  IDP_TOKEN  - API token (Okta SSWS token or SCIM bearer token)`,
+	RunE: runImportIdP,
+}
+
+// importSSOCmd represents the import-sso command
+var importSSOCmd = &cobra.Command{
+	Use:   "import-sso",
+	Short: "Import users from AWS IAM Identity Center permission set assignments",
+	Long: `Read the users and groups assigned to a permission set in an AWS account through
+IAM Identity Center, map the groups to database roles with the Cognito group mapping,
+and update the users section of the configuration with IAM-authenticated users. Users
+assigned directly to the permission set are imported without any groups. With --interval
+the import repeats on a schedule until interrupted.
+
+AWS credentials are loaded from the default credential chain.`,
+	RunE: runImportSSO,
+}
+
+// importRolesCmd represents the import-roles command
+var importRolesCmd = &cobra.Command{
+	Use:   "import-roles [file]",
+	Short: "Create a configuration from a pg_dumpall --roles-only dump or pgAdmin role export",
+	Long: `Read the CREATE ROLE, ALTER ROLE, COMMENT ON ROLE and GRANT statements of a
+pg_dumpall --roles-only dump or a pgAdmin role export, from the file or from stdin with -,
+and write the configuration they describe. LOGIN roles become users and NOLOGIN roles become
+groups, role memberships become groups and member_of, database grants become privileges
+and databases, and members of rds_iam use IAM authentication.
+
+Superusers and pg_* roles are left out, as are the roles given with --exclude, such as
+rdsadmin on RDS. Password hashes are not imported; sync keeps the passwords of existing
+roles. Everything else that cannot be expressed in the configuration, such as CREATEDB or
+role settings, is reported as a warning so it can be carried over by hand.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runImportRoles,
+}
+
+func init() {
+	rootCmd.AddCommand(importLDAPCmd)
+	rootCmd.AddCommand(importIdPCmd)
+	rootCmd.AddCommand(importSSOCmd)
+	rootCmd.AddCommand(importRolesCmd)
+
+	importLDAPCmd.Flags().String("ldap-url", os.Getenv("LDAP_URL"), "LDAP server URL, e.g. ldaps://ldap.example.com")
+	importLDAPCmd.Flags().String("bind-dn", os.Getenv("LDAP_BIND_DN"), "DN to bind as")
+	importLDAPCmd.Flags().String("base-dn", "", "base DN to search for users")
+	importLDAPCmd.Flags().StringArray("group-map", []string{}, "directory group mapping as db_group=group DN (repeatable)")
+	importLDAPCmd.Flags().String("username-attribute", "uid", "attribute holding the database username (sAMAccountName for Active Directory)")
+	importLDAPCmd.Flags().Bool("nested", false, "resolve nested group membership (Active Directory only)")
+	importLDAPCmd.Flags().Bool("start-tls", false, "upgrade a plain ldap:// connection with StartTLS")
+	importLDAPCmd.Flags().String("auth-method", structs.AuthMethodIAM, "auth method for imported users")
+	importLDAPCmd.Flags().String("output", "", "write the updated configuration to this file (default: the --config file)")
+	importLDAPCmd.Flags().Bool("sync", false, "sync the updated configuration to the database")
+
+	importIdPCmd.Flags().String("provider", sources.OktaSourceName, "identity provider API: okta or scim")
+	importIdPCmd.Flags().String("idp-url", os.Getenv("IDP_URL"), "Okta org URL or SCIM base URL")
+	importIdPCmd.Flags().StringArray("group", []string{}, "identity provider group to import (repeatable)")
+	importIdPCmd.Flags().String("auth-method", structs.AuthMethodIAM, "auth method for imported users")
+	importIdPCmd.Flags().Duration("interval", 0, "repeat the import on this interval until interrupted (0 runs once)")
+	importIdPCmd.Flags().String("output", "", "write the updated configuration to this file (default: the --config file)")
+	importIdPCmd.Flags().Bool("sync", false, "sync the updated configuration to the database")
+
+	importSSOCmd.Flags().String("instance-arn", "", "IAM Identity Center instance ARN")
+	importSSOCmd.Flags().String("identity-store-id", "", "identity store ID of the IAM Identity Center instance")
+	importSSOCmd.Flags().String("account-id", "", "AWS account ID the permission set is assigned in")
+	importSSOCmd.Flags().String("permission-set-arn", "", "permission set ARN granting database access")
+	importSSOCmd.Flags().Duration("interval", 0, "repeat the import on this interval until interrupted (0 runs once)")
+	importSSOCmd.Flags().String("output", "", "write the updated configuration to this file (default: the --config file)")
+	importSSOCmd.Flags().Bool("sync", false, "sync the updated configuration to the database")
+
+	importRolesCmd.Flags().StringSlice("exclude", []string{}, "roles to leave out, e.g. rdsadmin")
+	importRolesCmd.Flags().String("output", "", "write the configuration to this file, as JSON or YAML by its extension (default: print JSON)")
+}
+
+// runImportLDAP handles the import-ldap command
+func runImportLDAP(cmd *cobra.Command, args []string) error {
+	ldapURL, _ := cmd.Flags().GetString("ldap-url")
+	bindDN, _ := cmd.Flags().GetString("bind-dn")
+	baseDN, _ := cmd.Flags().GetString("base-dn")
+	groupMappings, _ := cmd.Flags().GetStringArray("group-map")
+	usernameAttribute, _ := cmd.Flags().GetString("username-attribute")
+	nested, _ := cmd.Flags().GetBool("nested")
+	startTLS, _ := cmd.Flags().GetBool("start-tls")
+	authMethod, _ := cmd.Flags().GetString("auth-method")
+
+	groupMap, err := sources.ParseGroupMap(groupMappings)
+	if err != nil {
+		return err
+	}
+
+	source, err := sources.NewLDAPSource(sources.LDAPConfig{
+		URL:               ldapURL,
+		BindDN:            bindDN,
+		BindPassword:      secretEnv("LDAP_BIND_PASSWORD"),
+		BaseDN:            baseDN,
+		UsernameAttribute: usernameAttribute,
+		GroupMap:          groupMap,
+		Nested:            nested,
+		StartTLS:          startTLS,
+	}, logger)
+	if err != nil {
+		return err
+	}
+
+	users, err := source.FetchUsers()
+	if err != nil {
+		return fmt.Errorf("failed to read users from LDAP: %w", err)
+	}
+
+	template := structs.UserConfig{AuthMethod: authMethod, CanLogin: true}
+	return importUsers(cmd, sources.LDAPSourceName, users, template)
+}
+
+// runImportIdP handles the import-idp command
+func runImportIdP(cmd *cobra.Command, args []string) error {
+	provider, _ := cmd.Flags().GetString("provider")
+	idpURL, _ := cmd.Flags().GetString("idp-url")
+	groups, _ := cmd.Flags().GetStringArray("group")
+	authMethod, _ := cmd.Flags().GetString("auth-method")
+	interval, _ := cmd.Flags().GetDuration("interval")
+
+	if len(groups) == 0 {
+		return fmt.Errorf("at least one --group is required")
+	}
+
+	idpConfig := sources.IdPConfig{URL: idpURL, Token: secretEnv("IDP_TOKEN")}
+
+	var source sources.GroupSource
+	var err error
+	switch provider {
+	case sources.OktaSourceName:
+		source, err = sources.NewOktaSource(idpConfig)
+	case sources.SCIMSourceName:
+		source, err = sources.NewSCIMSource(idpConfig)
+	default:
+		return fmt.Errorf("invalid provider: %s (must be 'okta' or 'scim')", provider)
+	}
+	if err != nil {
+		return err
+	}
+
+	configManager, err := connectionManager()
+	if err != nil {
+		return err
+	}
+	eventHandler, err := newEventHandler(configManager)
+	if err != nil {
+		return err
+	}
+	mapper := eventHandler.MapCognitoGroupsToRoles
+	template := structs.UserConfig{AuthMethod: authMethod, CanLogin: true}
+
+	ctx, stop := signal.NotifyContext(commandCtx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	importOnce := func() error {
+		users, err := sources.FetchGroupUsers(ctx, source, groups, mapper, logger)
+		if err != nil {
+			return err
+		}
+		return importUsers(cmd, source.Name(), users, template)
+	}
+
+	return runScheduled(ctx, "import", interval, importOnce)
+}
+
+// runImportSSO handles the import-sso command
+func runImportSSO(cmd *cobra.Command, args []string) error {
+	instanceArn, _ := cmd.Flags().GetString("instance-arn")
+	identityStoreID, _ := cmd.Flags().GetString("identity-store-id")
+	accountID, _ := cmd.Flags().GetString("account-id")
+	permissionSetArn, _ := cmd.Flags().GetString("permission-set-arn")
+	interval, _ := cmd.Flags().GetDuration("interval")
+
+	ctx, stop := signal.NotifyContext(commandCtx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	awsConfig, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
+
+	source, err := sources.NewSSOSource(sources.SSOConfig{
+		InstanceArn:      instanceArn,
+		IdentityStoreID:  identityStoreID,
+		AccountID:        accountID,
+		PermissionSetArn: permissionSetArn,
+	}, awsConfig, logger)
+	if err != nil {
+		return err
+	}
+
+	configManager, err := connectionManager()
+	if err != nil {
+		return err
+	}
+	eventHandler, err := newEventHandler(configManager)
+	if err != nil {
+		return err
+	}
+	mapper := eventHandler.MapCognitoGroupsToRoles
+	template := structs.UserConfig{AuthMethod: structs.AuthMethodIAM, CanLogin: true}
+
+	importOnce := func() error {
+		users, err := source.FetchUsers(ctx, mapper)
+		if err != nil {
+			return fmt.Errorf("failed to read users from IAM Identity Center: %w", err)
+		}
+		return importUsers(cmd, sources.SSOSourceName, users, template)
+	}
+
+	return runScheduled(ctx, "import", interval, importOnce)
+}
+
+// runScheduled runs a task such as an import once, or repeatedly on the interval until the
+// context is cancelled
+func runScheduled(ctx context.Context, task string, interval time.Duration, runOnce func() error) error {
+	if interval <= 0 {
+		return runOnce()
+	}
+
+	logger.WithField("interval", interval.String()).Info("Starting scheduled " + task)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// A failed run is retried on the next tick rather than stopping the schedule
+		if err := runOnce(); err != nil {
+			logger.WithError(err).Error("Scheduled " + task + " failed")
+		}
+
+		select {
+		case <-ctx.Done():
+			logger.Info("Stopping scheduled " + task)
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// importUsers merges users from an identity source into the configuration, saves it and optionally syncs it
+func importUsers(cmd *cobra.Command, source string, users []sources.DirectoryUser, template structs.UserConfig) error {
+	output, _ := cmd.Flags().GetString("output")
+	syncAfter, _ := cmd.Flags().GetBool("sync")
+	if output == "" {
+		output = configPath
+	}
+
+	configManager := config.NewManager(logger)
+	cfg, err := configManager.LoadConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	result := sources.MergeUsers(cfg, source, users, template)
+
+	logger.WithFields(logrus.Fields{
+		"source":   source,
+		"users":    len(users),
+		"added":    len(result.Added),
+		"updated":  len(result.Updated),
+		"disabled": len(result.Disabled),
+	}).Info("Imported users")
+
+	if err := configManager.ValidateProfiles(cfg, profile); err != nil {
+		return fmt.Errorf("imported configuration is invalid: %w", err)
+	}
+
+	if dryRun {
+		logger.WithFields(logrus.Fields{
+			"added":    result.Added,
+			"updated":  result.Updated,
+			"disabled": result.Disabled,
+		}).Info("DRY RUN: Would update configuration")
+	} else if err := configManager.SaveConfig(cfg, output); err != nil {
+		return err
+	}
+
+	if !syncAfter {
+		return nil
+	}
+
+	selected, err := configManager.SelectProfile(cfg, profile)
+	if err != nil {
+		return err
+	}
+
+	dbManager, err := newDatabaseManager(configManager)
+	if err != nil {
+		return err
+	}
+	defer dbManager.Close()
+
+	syncResult, err := dbManager.SyncConfiguration(selected)
+	if err != nil {
+		return fmt.Errorf("sync failed: %w", err)
+	}
+
+	return reportSyncResult(syncResult, "text")
+}
+
+// runImportRoles handles the import-roles command
+func runImportRoles(cmd *cobra.Command, args []string) error {
+	exclude, _ := cmd.Flags().GetStringSlice("exclude")
+	output, _ := cmd.Flags().GetString("output")
+
+	var data []byte
+	var err error
+	if args[0] == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(args[0])
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read role dump: %w", err)
+	}
+
+	dump, err := sources.ParseRoleDump(data, exclude)
+	if err != nil {
+		return fmt.Errorf("failed to parse role dump: %w", err)
+	}
+	for _, warning := range dump.Warnings {
+		logger.Warn(warning)
+	}
+
+	// Roles PostgreSQL accepts can still break the rules of the configuration, e.g. names
+	// that only differ in case, so problems are reported but do not stop the import
+	configManager := config.NewManager(logger)
+	if err := configManager.ValidateConfig(dump.Config); err != nil {
+		logger.WithError(err).Warn("Imported configuration needs changes before it can be synced")
+	}
+
+	logger.WithFields(logrus.Fields{
+		"users":    len(dump.Config.Users),
+		"groups":   len(dump.Config.Groups),
+		"warnings": len(dump.Warnings),
+	}).Info("Imported roles")
+
+	switch {
+	case output == "":
+		return printJSON(dump.Config)
+	case dryRun:
+		logger.WithField("output", output).Info("DRY RUN: Would write configuration")
+		return nil
+	default:
+		return configManager.SaveConfig(dump.Config, output)
+	}
+}
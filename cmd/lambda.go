@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/events"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/spf13/cobra"
+)
+
+// serveLambdaCmd represents the serve-lambda command
+var serveLambdaCmd = &cobra.Command{
+	Use:   "serve-lambda",
+	Short: "Run as an AWS Lambda function applying Cognito events",
+	Long: `Run as an AWS Lambda function. Cognito PostConfirmation triggers create a login role for
+the confirmed user, and group membership events grant or revoke the mapped group roles.
+Cognito triggers are returned unchanged; other trigger sources pass through untouched.
+
+When the binary runs inside Lambda without arguments (the bootstrap of a custom runtime),
+this command is selected automatically.
+
+Environment Variables:
+  EVENTS_AUTH_METHOD  - Auth method for provisioned users when --auth-method is not set (default: iam)`,
+	RunE: runServeLambda,
+}
+
+func init() {
+	rootCmd.AddCommand(serveLambdaCmd)
+
+	serveLambdaCmd.Flags().String("auth-method", structs.AuthMethodIAM, "auth method for users provisioned from events")
+}
+
+// lambdaBootstrap reports whether the process is a Lambda custom runtime started without arguments
+func lambdaBootstrap() bool {
+	return len(os.Args) == 1 && os.Getenv("AWS_LAMBDA_RUNTIME_API") != ""
+}
+
+// runServeLambda handles the serve-lambda command
+func runServeLambda(cmd *cobra.Command, args []string) error {
+	authMethod, _ := cmd.Flags().GetString("auth-method")
+	if !cmd.Flags().Changed("auth-method") {
+		if value := os.Getenv("EVENTS_AUTH_METHOD"); value != "" {
+			authMethod = value
+		}
+	}
+
+	configManager, err := connectionManager()
+	if err != nil {
+		return err
+	}
+	dbManager, err := newDatabaseManager(configManager)
+	if err != nil {
+		return err
+	}
+	defer dbManager.Close()
+
+	// The execution environment is reused across invocations, so lookups are not cached
+	dbManager.SetCatalogCache(false)
+	tagRoleSource(dbManager, configManager, roleSourceLambda)
+
+	eventHandler, err := newEventHandler(configManager)
+	if err != nil {
+		return err
+	}
+
+	applier := events.NewApplier(eventHandler, dbManager, authMethod)
+	lambda.StartWithOptions(applier.HandleLambda, lambda.WithContext(commandCtx))
+	return nil
+}
@@ -0,0 +1,216 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/database"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// testLoginCmd represents the test-login command
+var testLoginCmd = &cobra.Command{
+	Use:   "test-login",
+	Short: "Verify that a user can connect to the database",
+	Long: `Open a real connection as a provisioned user, with its password or an IAM token, to
+verify end to end that the role, its LOGIN attribute, its CONNECT privilege, pg_hba.conf
+and IAM authentication all let it in. The administrative credentials are not used.
+
+The password is read from a secret reference: env:NAME reads the environment variable
+NAME and file:PATH reads a file, such as a mounted Secrets Manager or Kubernetes secret.`,
+	RunE: runTestLogin,
+}
+
+func init() {
+	rootCmd.AddCommand(testLoginCmd)
+
+	testLoginCmd.Flags().String("user", "", "user to log in as (required)")
+	testLoginCmd.Flags().String("database", "", "database to connect to (default: POSTGRES_DB or the profile's database)")
+	testLoginCmd.Flags().String("password-from-secret", "", "password reference: env:NAME or file:PATH")
+	testLoginCmd.Flags().Bool("iam", false, "log in with an IAM auth token generated for the user")
+	testLoginCmd.Flags().String("output", "text", "output format: text or json")
+	testLoginCmd.MarkFlagRequired("user")
+	testLoginCmd.MarkFlagsMutuallyExclusive("password-from-secret", "iam")
+}
+
+// loginReport is the result of the test-login command
+type loginReport struct {
+	User     string        `json:"user"`
+	Database string        `json:"database"`
+	Success  bool          `json:"success"`
+	Latency  time.Duration `json:"latency_ns,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Hint     string        `json:"hint,omitempty"`
+	*structs.ConnectionInfo
+}
+
+// loginHints explains login failures from the point of view of the user logging in
+var loginHints = map[database.ErrorKind]string{
+	database.ErrorKindAuthentication: "the user does not exist, cannot log in (NOLOGIN or disabled) or the password is wrong; run list-users to check it",
+	database.ErrorKindHostRejected:   "no pg_hba.conf entry allows this user to connect from this host to this database",
+	database.ErrorKindPermission:     "the user lacks CONNECT on the database; add the database to the user's or one of its groups' databases and run sync",
+}
+
+// iamLoginHint explains IAM authentication failures
+const iamLoginHint = "check that the user is granted rds_iam and that the AWS identity running this command has rds-db:connect on dbuser:<resource-id>/<user>"
+
+// errLoginFailed is returned once a failed login has been reported, so no generic hint follows
+var errLoginFailed = errors.New("login failed")
+
+// runTestLogin handles the test-login command
+func runTestLogin(cmd *cobra.Command, args []string) error {
+	output, _ := cmd.Flags().GetString("output")
+	if output != "text" && output != "json" {
+		return fmt.Errorf("invalid output format: %s (must be 'text' or 'json')", output)
+	}
+	username, _ := cmd.Flags().GetString("user")
+	databaseName, _ := cmd.Flags().GetString("database")
+	passwordRef, _ := cmd.Flags().GetString("password-from-secret")
+	iamAuth, _ := cmd.Flags().GetBool("iam")
+
+	if passwordRef == "" && !iamAuth {
+		return fmt.Errorf("one of --password-from-secret or --iam is required")
+	}
+
+	var password string
+	if passwordRef != "" {
+		var err error
+		if password, err = readSecretReference(passwordRef); err != nil {
+			return err
+		}
+	}
+
+	configManager, err := connectionManager()
+	if err != nil {
+		return err
+	}
+	conn, err := configManager.GetLoginConnection(username, password, iamAuth)
+	if err != nil {
+		return err
+	}
+	if databaseName != "" {
+		conn.Database = databaseName
+	}
+
+	report := testLogin(conn)
+
+	if output == "json" {
+		if err := printJSON(report); err != nil {
+			return err
+		}
+	} else {
+		printLoginReport(report)
+	}
+
+	if !report.Success {
+		return errLoginFailed
+	}
+	return nil
+}
+
+// testLogin connects as the user and describes the connection
+func testLogin(conn *structs.DatabaseConnection) *loginReport {
+	report := &loginReport{User: conn.Username, Database: conn.Database}
+
+	start := time.Now()
+	info, err := loginConnectionInfo(conn)
+	if err != nil {
+		report.Error = err.Error()
+		report.Hint = loginHint(err, conn.IAMAuth)
+		logger.WithError(err).WithField("user", conn.Username).Warn("Login failed")
+		return report
+	}
+
+	report.Success = true
+	report.Latency = time.Since(start)
+	report.ConnectionInfo = info
+	logger.WithFields(logrus.Fields{
+		"user":     conn.Username,
+		"database": conn.Database,
+		"ssl":      info.SSL,
+	}).Info("Login succeeded")
+	return report
+}
+
+// loginConnectionInfo opens a connection as the user and describes it
+func loginConnectionInfo(conn *structs.DatabaseConnection) (*structs.ConnectionInfo, error) {
+	dbManager, err := database.NewManagerContext(commandCtx, conn, logger, false)
+	if err != nil {
+		return nil, err
+	}
+	defer dbManager.Close()
+
+	return dbManager.ConnectionInfo()
+}
+
+// loginHint returns what to check after a failed login
+func loginHint(err error, iamAuth bool) string {
+	classified := database.Classify(err)
+	if classified == nil {
+		return ""
+	}
+	if iamAuth && classified.Kind == database.ErrorKindAuthentication {
+		return iamLoginHint
+	}
+	if hint, ok := loginHints[classified.Kind]; ok {
+		return hint
+	}
+	return remediationHints[classified.Kind]
+}
+
+// printLoginReport writes the result of a login attempt
+func printLoginReport(report *loginReport) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+
+	if !report.Success {
+		fmt.Fprintf(w, "Login:\tFAILED as %s to %s\n", report.User, report.Database)
+		fmt.Fprintf(w, "Error:\t%s\n", report.Error)
+		if report.Hint != "" {
+			fmt.Fprintf(w, "Hint:\t%s\n", report.Hint)
+		}
+		return
+	}
+
+	info := report.ConnectionInfo
+	fmt.Fprintf(w, "Login:\tOK as %s\n", info.Role)
+	fmt.Fprintf(w, "Server:\t%s:%d/%s\n", info.Host, info.Port, info.Database)
+	fmt.Fprintf(w, "Version:\tPostgreSQL %s\n", info.ServerVersion)
+	fmt.Fprintf(w, "Latency:\t%s\n", report.Latency.Round(time.Microsecond))
+	printConnectionSecurity(w, info)
+}
+
+// readSecretReference reads a secret from env:NAME or file:PATH
+func readSecretReference(ref string) (string, error) {
+	kind, value, ok := strings.Cut(ref, ":")
+	if !ok || value == "" {
+		return "", fmt.Errorf("invalid secret reference %q (must be env:NAME or file:PATH)", ref)
+	}
+
+	switch kind {
+	case "env":
+		secret := secretEnv(value)
+		if secret == "" {
+			return "", fmt.Errorf("environment variable %s is not set", value)
+		}
+		return secret, nil
+	case "file":
+		data, err := os.ReadFile(value)
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret file: %w", err)
+		}
+		secret := strings.TrimRight(string(data), "\r\n")
+		if secret == "" {
+			return "", fmt.Errorf("secret file %s is empty", value)
+		}
+		return secret, nil
+	default:
+		return "", fmt.Errorf("invalid secret reference %q (must be env:NAME or file:PATH)", ref)
+	}
+}
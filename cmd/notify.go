@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"context"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/config"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/notify"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+// notificationTimeout bounds sending the change notifications of a sync
+const notificationTimeout = 60 * time.Second
+
+// sendSyncNotifications sends an event for every change of the sync results to the
+// notification targets of the configuration. A dry run changed nothing, so it sends nothing.
+// A failed send is logged and does not fail the sync.
+func sendSyncNotifications(configManager *config.Manager, results ...*structs.SyncResult) {
+	targets := configManager.Notifications()
+	if dryRun || len(targets) == 0 {
+		return
+	}
+
+	now := time.Now()
+	var events []notify.Event
+	for _, result := range results {
+		events = append(events, notify.Events(result, now)...)
+	}
+	if len(events) == 0 {
+		return
+	}
+
+	// An interrupted sync still reports what it changed, but an unreachable target does not stall the exit
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(commandCtx), notificationTimeout)
+	defer cancel()
+
+	for _, target := range targets {
+		fields := logrus.Fields{
+			"notification": target.Name,
+			"type":         target.Type,
+		}
+		notifier, err := notify.New(ctx, target)
+		if err != nil {
+			logger.WithError(err).WithFields(fields).Warn("Failed to set up change notifications")
+			continue
+		}
+		fields["location"] = notifier.Location()
+
+		sent := 0
+		for _, event := range events {
+			if err := notifier.Notify(ctx, event); err != nil {
+				logger.WithError(err).WithFields(fields).Warn("Failed to send change notification")
+				continue
+			}
+			sent++
+		}
+		fields["events"] = sent
+		logger.WithFields(fields).Info("Sent change notifications")
+	}
+}
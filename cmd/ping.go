@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// pingCmd represents the ping command
+var pingCmd = &cobra.Command{
+	Use:   "ping",
+	Short: "Check that the database is reachable and show the effective connection settings",
+	Long: `Connect to the database and report the server version, the round trip time of a query
+and the effective connection settings, including the SSL mode, where it came from and
+whether the connection is actually encrypted.`,
+	RunE: runPing,
+}
+
+// whoamiCmd represents the whoami command
+var whoamiCmd = &cobra.Command{
+	Use:   "whoami",
+	Short: "Show who changes are attributed to and the role the tool connects as",
+	Long: `Report the principal changes are attributed to, the database role the connection
+authenticated as with its administrative attributes, and how it authenticated, including
+the effective SSL mode.`,
+	RunE: runWhoami,
+}
+
+func init() {
+	rootCmd.AddCommand(pingCmd)
+	rootCmd.AddCommand(whoamiCmd)
+
+	pingCmd.Flags().String("output", "text", "output format: text or json")
+	whoamiCmd.Flags().String("output", "text", "output format: text or json")
+}
+
+// pingReport is the result of the ping command
+type pingReport struct {
+	*structs.ConnectionInfo
+	Latency time.Duration `json:"latency_ns"`
+}
+
+// whoamiReport is the result of the whoami command
+type whoamiReport struct {
+	Principal string `json:"principal"`
+	*structs.ConnectionInfo
+}
+
+// runPing handles the ping command
+func runPing(cmd *cobra.Command, args []string) error {
+	output, _ := cmd.Flags().GetString("output")
+	if output != "text" && output != "json" {
+		return fmt.Errorf("invalid output format: %s (must be 'text' or 'json')", output)
+	}
+
+	info, latency, err := connectionInfo()
+	if err != nil {
+		return err
+	}
+
+	if output == "json" {
+		return printJSON(pingReport{ConnectionInfo: info, Latency: latency})
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Server:\t%s:%d/%s\n", info.Host, info.Port, info.Database)
+	fmt.Fprintf(w, "Version:\tPostgreSQL %s\n", info.ServerVersion)
+	fmt.Fprintf(w, "Latency:\t%s\n", latency.Round(time.Microsecond))
+	printConnectionSecurity(w, info)
+	w.Flush()
+
+	logger.WithFields(logrus.Fields{
+		"latency": latency,
+		"ssl":     info.SSL,
+	}).Info("Database is reachable")
+
+	return nil
+}
+
+// runWhoami handles the whoami command
+func runWhoami(cmd *cobra.Command, args []string) error {
+	output, _ := cmd.Flags().GetString("output")
+	if output != "text" && output != "json" {
+		return fmt.Errorf("invalid output format: %s (must be 'text' or 'json')", output)
+	}
+
+	info, _, err := connectionInfo()
+	if err != nil {
+		return err
+	}
+	report := whoamiReport{Principal: principalHook.Principal.String(), ConnectionInfo: info}
+
+	if output == "json" {
+		return printJSON(report)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Principal:\t%s\n", report.Principal)
+	fmt.Fprintf(w, "Role:\t%s\n", info.Role)
+	if info.CurrentRole != info.Role {
+		fmt.Fprintf(w, "Current role:\t%s\n", info.CurrentRole)
+	}
+	fmt.Fprintf(w, "Superuser:\t%t\n", info.Superuser)
+	fmt.Fprintf(w, "Create role:\t%t\n", info.CreateRole)
+	fmt.Fprintf(w, "Server:\t%s:%d/%s\n", info.Host, info.Port, info.Database)
+	printConnectionSecurity(w, info)
+	return w.Flush()
+}
+
+// connectionInfo connects to the database and describes the connection, returning the round
+// trip time of the query
+func connectionInfo() (*structs.ConnectionInfo, time.Duration, error) {
+	configManager, err := connectionManager()
+	if err != nil {
+		return nil, 0, err
+	}
+	dbManager, err := newDatabaseManager(configManager)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer dbManager.Close()
+
+	start := time.Now()
+	info, err := dbManager.ConnectionInfo()
+	if err != nil {
+		return nil, 0, err
+	}
+	return info, time.Since(start), nil
+}
+
+// printConnectionSecurity writes how the connection authenticated and whether it is encrypted
+func printConnectionSecurity(w *tabwriter.Writer, info *structs.ConnectionInfo) {
+	fmt.Fprintf(w, "Auth method:\t%s\n", info.AuthMethod)
+	fmt.Fprintf(w, "SSL mode:\t%s (from %s)\n", info.SSLMode, info.SSLModeSource)
+	if info.SSL {
+		fmt.Fprintf(w, "Encrypted:\tyes (%s)\n", info.SSLVersion)
+	} else {
+		fmt.Fprintln(w, "Encrypted:\tno")
+	}
+}
+
+// printJSON writes a value to stdout as indented JSON
+func printJSON(value any) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal output: %w", err)
+	}
+	fmt.Println(string(data))
+	return nil
+}
@@ -0,0 +1,270 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/config"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/database"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/spf13/cobra"
+)
+
+// planCmd represents the plan command
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Show the changes sync would make without executing anything",
+	Long: `Compare the configuration with the current state of the database and print the
+changes a sync with the same flags would make: roles to create, attributes to change,
+memberships and database privileges to grant or revoke, and roles to disable or remove.
+Nothing is executed.
+
+Extra memberships and privileges are only planned for removal with --exact-memberships and
+--exact-privileges, and managed roles that are no longer configured only with --prune, as in sync.`,
+	RunE: runPlan,
+}
+
+func init() {
+	rootCmd.AddCommand(planCmd)
+
+	planCmd.Flags().Bool("exact-memberships", false, "plan revoking memberships in managed groups that are not in the configuration")
+	planCmd.Flags().Bool("exact-privileges", false, "plan revoking database privileges that are not in the configuration")
+	planCmd.Flags().Bool("prune", false, "plan removing managed users and groups that are no longer in the configuration")
+	planCmd.Flags().String("prune-action", database.PruneDrop, "how --prune removes users: drop or disable (groups are only dropped)")
+	planCmd.Flags().String("output", "text", "plan format: text or json")
+	planCmd.Flags().Bool("exit-code", false, "exit with an error when the plan has changes")
+}
+
+// planOptions are the sync flags that decide which differences a sync acts on
+type planOptions struct {
+	ExactMemberships bool
+	ExactPrivileges  bool
+	PruneAction      string
+}
+
+// runPlan handles the plan command
+func runPlan(cmd *cobra.Command, args []string) error {
+	output, _ := cmd.Flags().GetString("output")
+	exitCode, _ := cmd.Flags().GetBool("exit-code")
+	if output != "text" && output != "json" {
+		return fmt.Errorf("invalid output format: %s (must be 'text' or 'json')", output)
+	}
+
+	var options planOptions
+	options.ExactMemberships, _ = cmd.Flags().GetBool("exact-memberships")
+	options.ExactPrivileges, _ = cmd.Flags().GetBool("exact-privileges")
+	if prune, _ := cmd.Flags().GetBool("prune"); prune {
+		options.PruneAction, _ = cmd.Flags().GetString("prune-action")
+	}
+
+	configManager := config.NewManager(logger)
+	cfg, err := configManager.LoadConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	// Only plan the users and groups that target this cluster
+	cfg, err = configManager.SelectProfile(cfg, profile)
+	if err != nil {
+		return err
+	}
+
+	if err := configManager.ValidateConfig(cfg); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	dbConn, err := configManager.GetDatabaseConnection()
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+
+	// plan only reads, so it always connects for real, even with --dry-run
+	dbManager, err := database.NewManager(dbConn, logger, false)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database manager: %w", err)
+	}
+	defer dbManager.Close()
+
+	if err := dbManager.SetPrune(options.PruneAction); err != nil {
+		return err
+	}
+
+	report, err := dbManager.Diff(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to compare cluster with configuration: %w", err)
+	}
+	report.Profile = profile
+
+	// Differences sync leaves alone with these flags are not part of the plan
+	if !options.ExactMemberships {
+		report.MembershipsExtra = nil
+	}
+	if !options.ExactPrivileges {
+		report.PrivilegesExtra = nil
+	}
+
+	if output == "json" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal plan: %w", err)
+		}
+		fmt.Println(string(data))
+	} else {
+		printPlan(os.Stdout, cfg, report, options)
+	}
+
+	if exitCode && report.Differences() > 0 {
+		return fmt.Errorf("plan has %d change(s)", report.Differences())
+	}
+	return nil
+}
+
+// printPlan prints a drift report as the actions a sync would take, grouped by role,
+// followed by a count of additions, changes and removals
+func printPlan(w io.Writer, cfg *structs.Config, report *structs.DriftReport, options planOptions) {
+	if report.Differences() == 0 {
+		fmt.Fprintf(w, "No changes. %s matches the configuration.\n", profileLabel(report.Profile))
+		return
+	}
+
+	fmt.Fprintf(w, "Sync will perform the following actions on %s:\n\n", profileLabel(report.Profile))
+
+	add, change, destroy := 0, 0, 0
+
+	// Sync refuses roles declared as the other kind of role than it manages them as
+	for _, conflict := range report.RoleConflicts {
+		fmt.Fprintf(w, "  ! %s %s is managed as a %s and will not be synced (users and groups share one role namespace)\n",
+			conflict.Declared, conflict.Role, conflict.Existing)
+	}
+
+	for _, role := range report.RolesMissing {
+		add++
+		kind, details := plannedRole(cfg, role)
+		fmt.Fprintf(w, "  + %s %s\n", kind, role)
+		for _, detail := range details {
+			fmt.Fprintf(w, "      %s\n", detail)
+		}
+	}
+
+	for _, role := range rolesInOrder(report.AttributesChanged) {
+		change++
+		fmt.Fprintf(w, "  ~ role %s\n", role)
+		for _, attribute := range report.AttributesChanged {
+			if attribute.Role == role {
+				fmt.Fprintf(w, "      %s: %q -> %q\n", attribute.Attribute, attribute.Current, attribute.Desired)
+			}
+		}
+	}
+	for _, rename := range report.RolesToRename {
+		change++
+		fmt.Fprintf(w, "  ~ user %s -> %s (renamed)\n", rename.From, rename.To)
+	}
+	for _, user := range report.UsersToDisable {
+		change++
+		fmt.Fprintf(w, "  ~ user %s\n      login: true -> false\n", user)
+	}
+
+	for _, membership := range report.MembershipsMissing {
+		add++
+		fmt.Fprintf(w, "  + membership %s in %s\n", membership.Member, membership.Group)
+	}
+	for _, membership := range report.MembershipsExtra {
+		destroy++
+		fmt.Fprintf(w, "  - membership %s in %s\n", membership.Member, membership.Group)
+	}
+	for _, grant := range report.PrivilegesMissing {
+		add++
+		fmt.Fprintf(w, "  + grant %s on database %s to %s\n", grant.Privilege, grant.Database, grant.Target)
+	}
+	for _, grant := range report.PrivilegesExtra {
+		destroy++
+		fmt.Fprintf(w, "  - grant %s on database %s from %s\n", grant.Privilege, grant.Database, grant.Target)
+	}
+
+	for _, schema := range report.SchemasMissing {
+		add++
+		fmt.Fprintf(w, "  + schema %s\n", schema)
+	}
+	for _, owner := range report.SchemaOwnersChanged {
+		change++
+		fmt.Fprintf(w, "  ~ schema %s\n      owner: %q -> %q\n", owner.Schema, owner.Current, owner.Desired)
+	}
+	for _, grant := range report.SchemaPrivilegesMissing {
+		add++
+		fmt.Fprintf(w, "  + grant %s on schema %s to %s\n", grant.Privilege, grant.Schema, grant.Target)
+	}
+
+	for _, user := range report.UsersToRemove {
+		destroy++
+		fmt.Fprintf(w, "  - user %s (absent)\n", user)
+	}
+	for _, role := range report.RolesToPrune {
+		if options.PruneAction == database.PruneDisable {
+			change++
+			fmt.Fprintf(w, "  ~ user %s (pruned)\n      login: true -> false\n", role)
+			continue
+		}
+		destroy++
+		fmt.Fprintf(w, "  - role %s (pruned)\n", role)
+	}
+
+	fmt.Fprintf(w, "\nPlan: %d to add, %d to change, %d to destroy.\n", add, change, destroy)
+	if len(report.RoleConflicts) > 0 {
+		fmt.Fprintf(w, "%d role(s) conflict with the configuration and need to be resolved by hand.\n", len(report.RoleConflicts))
+	}
+}
+
+// plannedRole returns whether a configured role is a user or a group and what it will be
+// created with
+func plannedRole(cfg *structs.Config, role string) (string, []string) {
+	var details []string
+	addDetail := func(name string, values []string) {
+		if len(values) > 0 {
+			details = append(details, fmt.Sprintf("%s: %s", name, strings.Join(values, ", ")))
+		}
+	}
+
+	for _, group := range cfg.Groups {
+		if group.Name == role {
+			addDetail("member_of", group.MemberOf)
+			addDetail("privileges", plannedPrivileges(group.Privileges, group.Databases))
+			return "group", details
+		}
+	}
+	for _, user := range cfg.Users {
+		if user.Username == role {
+			addDetail("auth", user.EffectiveAuthMethods())
+			addDetail("groups", user.Groups)
+			addDetail("privileges", plannedPrivileges(user.Privileges, user.Databases))
+			return "user", details
+		}
+	}
+	return "role", details
+}
+
+// plannedPrivileges describes configured privileges as "PRIVILEGE on database"
+func plannedPrivileges(privileges, databases []string) []string {
+	var planned []string
+	for _, db := range databases {
+		for _, privilege := range privileges {
+			planned = append(planned, fmt.Sprintf("%s on %s", privilege, db))
+		}
+	}
+	return planned
+}
+
+// rolesInOrder returns the roles of attribute changes in the order they first appear
+func rolesInOrder(changes []structs.AttributeChange) []string {
+	seen := make(map[string]bool)
+	var roles []string
+	for _, change := range changes {
+		if !seen[change.Role] {
+			seen[change.Role] = true
+			roles = append(roles, change.Role)
+		}
+	}
+	return roles
+}
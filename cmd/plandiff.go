@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// planDiffCmd represents the plan-diff command
+var planDiffCmd = &cobra.Command{
+	Use:   "plan-diff <old.json> <new.json>",
+	Short: "Compare two plans saved with plan --output json",
+	Long: `Compare two plans saved with plan --output json and print how the actions of the new plan
+differ from those of the old one: actions only the new plan takes, actions it no longer takes,
+and actions both take on the same role, membership or grant but differently, such as an
+attribute changed to another value. Use it to see how a change to the configuration alters
+what sync would do, for example while refactoring a large access model.
+
+Nothing connects to a cluster. Both plans should be saved with the same flags and profile.`,
+	Args: cobra.ExactArgs(2),
+	RunE: runPlanDiff,
+}
+
+func init() {
+	rootCmd.AddCommand(planDiffCmd)
+
+	planDiffCmd.Flags().String("output", "text", "comparison format: text or json")
+	planDiffCmd.Flags().Bool("exit-code", false, "exit with an error when the plans differ")
+}
+
+// runPlanDiff handles the plan-diff command
+func runPlanDiff(cmd *cobra.Command, args []string) error {
+	output, _ := cmd.Flags().GetString("output")
+	exitCode, _ := cmd.Flags().GetBool("exit-code")
+	if output != "text" && output != "json" {
+		return fmt.Errorf("invalid output format: %s (must be 'text' or 'json')", output)
+	}
+
+	previous, err := readPlan(args[0])
+	if err != nil {
+		return err
+	}
+	current, err := readPlan(args[1])
+	if err != nil {
+		return err
+	}
+	if previous.Profile != current.Profile {
+		logger.WithFields(logrus.Fields{
+			"old_profile": profileLabel(previous.Profile),
+			"new_profile": profileLabel(current.Profile),
+		}).Warn("The plans were made for different profiles")
+	}
+
+	comparison := structs.ComparePlans(previous, current)
+
+	if output == "json" {
+		if err := printJSON(comparison); err != nil {
+			return err
+		}
+	} else {
+		printPlanComparison(os.Stdout, args[0], args[1], comparison)
+	}
+
+	if exitCode && comparison.Differences() > 0 {
+		return fmt.Errorf("plans differ in %d action(s)", comparison.Differences())
+	}
+	return nil
+}
+
+// readPlan reads a plan saved with plan --output json
+func readPlan(path string) (*structs.DriftReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan %s: %w", path, err)
+	}
+
+	var report structs.DriftReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("failed to parse plan %s (expected the output of plan --output json): %w", path, err)
+	}
+	if report.Error != "" {
+		return nil, fmt.Errorf("plan %s could not be made: %s", path, report.Error)
+	}
+	return &report, nil
+}
+
+// printPlanComparison prints the actions that differ between two plans, marked as plan
+// marks them, followed by a count of the differences
+func printPlanComparison(w io.Writer, previousPath, currentPath string, comparison *structs.PlanComparison) {
+	if comparison.Differences() == 0 {
+		fmt.Fprintf(w, "No changes. %s and %s plan the same actions.\n", previousPath, currentPath)
+		return
+	}
+
+	if len(comparison.Added) > 0 {
+		fmt.Fprintf(w, "Only planned by %s:\n", currentPath)
+		for _, action := range comparison.Added {
+			fmt.Fprintf(w, "  %s\n", plannedActionLine(action))
+		}
+		fmt.Fprintln(w)
+	}
+	if len(comparison.Removed) > 0 {
+		fmt.Fprintf(w, "No longer planned (only in %s):\n", previousPath)
+		for _, action := range comparison.Removed {
+			fmt.Fprintf(w, "  %s\n", plannedActionLine(action))
+		}
+		fmt.Fprintln(w)
+	}
+	if len(comparison.Changed) > 0 {
+		fmt.Fprintln(w, "Planned differently:")
+		for _, change := range comparison.Changed {
+			fmt.Fprintf(w, "  %s\n      was: %s\n", plannedActionLine(change.Current), change.Previous.Detail)
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintf(w, "Plan diff: %d newly planned, %d no longer planned, %d changed.\n",
+		len(comparison.Added), len(comparison.Removed), len(comparison.Changed))
+}
+
+// plannedActionLine formats a planned action with the marker plan uses for its kind
+func plannedActionLine(action structs.PlannedAction) string {
+	marker := map[string]string{"add": "+", "change": "~", "destroy": "-", "conflict": "!"}[action.Kind]
+	if action.Detail == "" {
+		return marker + " " + action.Target
+	}
+	return fmt.Sprintf("%s %s (%s)", marker, action.Target, action.Detail)
+}
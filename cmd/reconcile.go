@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/database"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/sources"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/spf13/cobra"
+)
+
+// reconcileIdentitiesCmd represents the reconcile-identities command
+var reconcileIdentitiesCmd = &cobra.Command{
+	Use:   "reconcile-identities",
+	Short: "Lock or drop users whose identity provider identity no longer exists",
+	Long: `Cross-check the users created from Cognito or identity provider events, which record the
+ID of their identity, with the users of the identity provider, and lock (--action disable)
+or drop (--action drop) the ones whose identity has been deleted, disabled or deactivated,
+so database access does not outlive it. Users without a recorded identity are left alone.
+
+An identity provider that returns no users is treated as a misconfiguration and nothing is
+changed, and the change limits of sync apply, so a partial user list cannot lock everyone
+out. With --interval the check repeats on a schedule until interrupted.
+
+Environment Variables:
+  COGNITO_USER_POOL_ID  - Cognito user pool ID (or --user-pool-id)
+  IDP_URL               - Okta org URL or SCIM base URL (or --idp-url)
+  IDP_TOKEN             - API token (Okta SSWS token or SCIM bearer token)
+
+Cognito is read with AWS credentials from the default credential chain.`,
+	RunE: runReconcileIdentities,
+}
+
+func init() {
+	rootCmd.AddCommand(reconcileIdentitiesCmd)
+
+	reconcileIdentitiesCmd.Flags().String("provider", sources.CognitoSourceName, "identity provider: cognito, okta or scim")
+	reconcileIdentitiesCmd.Flags().String("user-pool-id", os.Getenv("COGNITO_USER_POOL_ID"), "Cognito user pool ID")
+	reconcileIdentitiesCmd.Flags().String("idp-url", os.Getenv("IDP_URL"), "Okta org URL or SCIM base URL")
+	reconcileIdentitiesCmd.Flags().String("action", database.PruneDisable, "what to do with users whose identity is gone: disable or drop")
+	reconcileIdentitiesCmd.Flags().Duration("interval", 0, "repeat the check on this interval until interrupted (0 runs once)")
+	reconcileIdentitiesCmd.Flags().String("output", "text", "report format: text or json")
+	reconcileIdentitiesCmd.Flags().Int("max-removals", 0, "refuse to lock or drop more than this many users (overrides change_limits, 0 uses the configuration)")
+	reconcileIdentitiesCmd.Flags().Float64("max-removal-percent", 0, "refuse to lock or drop more than this percentage of the users with an identity (overrides change_limits, 0 uses the configuration)")
+	reconcileIdentitiesCmd.Flags().Bool("allow-large-change", false, "reconcile even when the users to lock or drop exceed the change limits")
+	reconcileIdentitiesCmd.Flags().String("reassign-to", "", "with --action drop, reassign the objects of dropped users to this role and drop their privileges first (overrides role_removal)")
+	reconcileIdentitiesCmd.Flags().Bool("cascade", false, "with --action drop, drop the objects and privileges of dropped users first (overrides role_removal)")
+	reconcileIdentitiesCmd.Flags().Bool("terminate-sessions", false, "with --action drop, terminate the active sessions of dropped users first (overrides role_removal)")
+	reconcileIdentitiesCmd.Flags().Duration("grace-period", 0, "with --terminate-sessions, give sessions this long to disconnect on their own first (overrides role_removal, 0 uses the configuration)")
+}
+
+// reconcileReport is the outcome of reconcile-identities as printed with --output json
+type reconcileReport struct {
+	Provider string                     `json:"provider"`
+	Checked  int                        `json:"checked"`
+	Orphaned []structs.OrphanedIdentity `json:"orphaned"`
+	Errors   []string                   `json:"errors"`
+}
+
+// runReconcileIdentities handles the reconcile-identities command
+func runReconcileIdentities(cmd *cobra.Command, args []string) error {
+	provider, _ := cmd.Flags().GetString("provider")
+	action, _ := cmd.Flags().GetString("action")
+	interval, _ := cmd.Flags().GetDuration("interval")
+	output, _ := cmd.Flags().GetString("output")
+
+	if output != "text" && output != "json" {
+		return fmt.Errorf("invalid output format: %s (must be 'text' or 'json')", output)
+	}
+	if action != database.PruneDisable && action != database.PruneDrop {
+		return fmt.Errorf("invalid action: %s (must be '%s' or '%s')", action, database.PruneDisable, database.PruneDrop)
+	}
+
+	ctx, stop := signal.NotifyContext(commandCtx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	source, err := identitySource(ctx, cmd, provider)
+	if err != nil {
+		return err
+	}
+
+	return runScheduled(ctx, "identity reconciliation", interval, func() error {
+		return reconcileOnce(ctx, cmd, source, action, output)
+	})
+}
+
+// identitySource creates the identity source of a provider from the command flags
+func identitySource(ctx context.Context, cmd *cobra.Command, provider string) (sources.IdentitySource, error) {
+	idpURL, _ := cmd.Flags().GetString("idp-url")
+	idpConfig := sources.IdPConfig{URL: idpURL, Token: secretEnv("IDP_TOKEN")}
+
+	switch provider {
+	case sources.CognitoSourceName:
+		userPoolID, _ := cmd.Flags().GetString("user-pool-id")
+		awsConfig, err := awsconfig.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load AWS configuration: %w", err)
+		}
+		return sources.NewCognitoSource(userPoolID, awsConfig)
+	case sources.OktaSourceName:
+		return sources.NewOktaSource(idpConfig)
+	case sources.SCIMSourceName:
+		return sources.NewSCIMSource(idpConfig)
+	default:
+		return nil, fmt.Errorf("invalid provider: %s (must be 'cognito', 'okta' or 'scim')", provider)
+	}
+}
+
+// reconcileOnce reads the active identities and locks or drops the users whose identity is gone
+func reconcileOnce(ctx context.Context, cmd *cobra.Command, source sources.IdentitySource, action, output string) error {
+	active, err := source.ActiveIdentities(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read identities from %s: %w", source.Name(), err)
+	}
+
+	configManager, cfg, err := optionalConfig()
+	if err != nil {
+		return err
+	}
+	if cfg == nil {
+		cfg = &structs.Config{}
+	}
+
+	dbManager, err := newDatabaseManager(configManager)
+	if err != nil {
+		return err
+	}
+	defer dbManager.Close()
+
+	dbManager.SetChangeLimits(changeLimits(cmd, cfg))
+	allowLargeChange, _ := cmd.Flags().GetBool("allow-large-change")
+	dbManager.SetAllowLargeChange(allowLargeChange)
+	if err := setRoleRemoval(cmd, dbManager, cfg); err != nil {
+		return err
+	}
+
+	result, err := dbManager.ReconcileIdentities(active, action)
+	if err != nil {
+		return err
+	}
+
+	if output == "json" {
+		report := reconcileReport{
+			Provider: source.Name(),
+			Checked:  result.Checked,
+			Orphaned: append([]structs.OrphanedIdentity{}, result.Orphaned...),
+			Errors:   make([]string, len(result.Errors)),
+		}
+		for i, err := range result.Errors {
+			report.Errors[i] = err.Error()
+		}
+		if err := printJSON(report); err != nil {
+			return err
+		}
+	} else {
+		if len(result.Orphaned) == 0 {
+			fmt.Printf("No users to lock or drop (%d user(s) with a %s identity checked)\n", result.Checked, source.Name())
+		} else {
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "USERNAME\tEXTERNAL ID\tACTION")
+			for _, orphan := range result.Orphaned {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", orphan.Username, orphan.ExternalID, orphan.Action)
+			}
+			w.Flush()
+		}
+
+		for _, err := range result.Errors {
+			logger.Error(err)
+		}
+	}
+
+	if len(result.Errors) > 0 {
+		return fmt.Errorf("identity reconciliation completed with %d errors", len(result.Errors))
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/config"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/database"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/rotation"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/secrets"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// rotatePasswordCmd represents the rotate-password command
+var rotatePasswordCmd = &cobra.Command{
+	Use:   "rotate-password [username]",
+	Short: "Replace the password of a user and publish the new one",
+	Long: `Generate a new password for a user, or for every managed user that logs in with a
+password with --all-managed, set it with ALTER ROLE and publish it to the backend of the
+rotation section of the configuration: AWS Secrets Manager, SSM Parameter Store, Vault or
+stdout. The role is changed before the password is published, so when publishing fails the
+command reports it and the user has to be rotated again.
+
+Users whose password is in the configuration are left alone, since the next sync would set
+it back. With --dry-run the statements are shown and nothing is published.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runRotatePassword,
+}
+
+func init() {
+	rootCmd.AddCommand(rotatePasswordCmd)
+
+	rotatePasswordCmd.Flags().Bool("all-managed", false, "rotate every managed user that logs in with a password")
+	rotatePasswordCmd.Flags().String("backend", "", "publish to stdout, secretsmanager, ssm or vault (overrides rotation.backend)")
+}
+
+// runRotatePassword handles the rotate-password command
+func runRotatePassword(cmd *cobra.Command, args []string) error {
+	allManaged, _ := cmd.Flags().GetBool("all-managed")
+	if allManaged == (len(args) == 1) {
+		return fmt.Errorf("specify either a username or --all-managed")
+	}
+
+	configManager, cfg, err := optionalConfig()
+	if err != nil {
+		return err
+	}
+	// A dry run publishes nothing, so it does not need the backend's credentials
+	var publisher rotation.Publisher
+	if !dryRun {
+		if publisher, err = newPublisher(cmd, configManager); err != nil {
+			return err
+		}
+	}
+	dbConn, err := configManager.GetDatabaseConnection()
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+
+	dbManager, err := newDatabaseManager(configManager)
+	if err != nil {
+		return err
+	}
+	defer dbManager.Close()
+
+	var usernames []string
+	if allManaged {
+		if usernames, _, err = dbManager.ManagedRoles(); err != nil {
+			return err
+		}
+	} else {
+		usernames = []string{structs.NormalizeIdentifier(args[0])}
+	}
+
+	// Declared users keep the length and charset of their generated password
+	declared := make(map[string]structs.UserConfig)
+	if cfg != nil {
+		for _, user := range cfg.Users {
+			declared[user.Username] = user
+		}
+	}
+
+	rotated, failed := 0, 0
+	for _, username := range usernames {
+		user := declared[username]
+		reason, err := rotationSkipReason(dbManager, username, user)
+		if err != nil {
+			return err
+		}
+		if reason != "" {
+			if !allManaged {
+				return fmt.Errorf("cannot rotate the password of user %s: %s", username, reason)
+			}
+			logger.WithField("username", username).Debugf("Skipping user: %s", reason)
+			continue
+		}
+
+		// Each password is published right after it is set, so a later failure loses none
+		password, err := secrets.GeneratePassword(user.PasswordLength, user.PasswordCharset)
+		if err == nil {
+			err = dbManager.RotatePassword(username, password)
+		}
+		if err == nil && !dryRun {
+			err = publishRotatedPassword(publisher, dbConn, username, password)
+		}
+		if err != nil {
+			logger.WithError(err).WithField("username", username).Error("Failed to rotate password")
+			failed++
+			continue
+		}
+		rotated++
+	}
+
+	if dryRun {
+		logger.WithField("users", rotated).Info("DRY RUN: Passwords would be rotated and published")
+	} else {
+		logger.WithField("users", rotated).Info("Passwords rotated")
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to rotate %d password(s)", failed)
+	}
+	return nil
+}
+
+// rotationSkipReason returns why the password of a user cannot be rotated, or an empty
+// string when it can
+func rotationSkipReason(dbManager *database.Manager, username string, user structs.UserConfig) (string, error) {
+	attributes, err := dbManager.GetRoleAttributes(username)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case attributes == nil:
+		return "the user does not exist", nil
+	case !database.HasPasswordAuth(attributes):
+		return "the user does not log in with a password", nil
+	case user.Password != "":
+		return "the password is set in the configuration and sync would set it back", nil
+	}
+	return "", nil
+}
+
+// newPublisher returns the publisher of the configuration's rotation settings, with the
+// backend overridden by --backend when it is given
+func newPublisher(cmd *cobra.Command, configManager *config.Manager) (rotation.Publisher, error) {
+	var settings structs.RotationConfig
+	if configured := configManager.Rotation(); configured != nil {
+		settings = *configured
+	}
+	if backend, _ := cmd.Flags().GetString("backend"); backend != "" {
+		settings.Backend = backend
+	}
+	return rotation.NewPublisher(commandCtx, &settings, os.Stdout)
+}
+
+// publishRotatedPassword publishes the rotated password of a user, logging where it went
+func publishRotatedPassword(publisher rotation.Publisher, conn *structs.DatabaseConnection, username, password string) error {
+	secret := rotation.NewSecret(username, password, conn, profile, time.Now())
+	if err := publisher.Publish(commandCtx, secret); err != nil {
+		return fmt.Errorf("password of user %s was rotated but not published, rotate it again: %w", username, err)
+	}
+	logger.WithFields(logrus.Fields{
+		"username": username,
+		"location": publisher.Location(secret),
+	}).Info("Published rotated password")
+	return nil
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/events"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/principal"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/server"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/spf13/cobra"
+)
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run an HTTP server for push provisioning",
+	Long: `Run an HTTP server exposing a SCIM 2.0 Users and Groups endpoint under /scim/v2, so
+enterprise identity providers can push provisioning and deprovisioning directly. Requests
+must carry the token from SERVE_TOKEN as a bearer token, or one of the delegated tokens
+from --tokens-file, which may only manage the roles matching their patterns.
+
+SCIM operations map to role operations: creating a user creates a login role, setting
+active to false locks it (NOLOGIN and terminated sessions), deleting it drops the role,
+and group membership changes grant or revoke the group role.
+
+Event payloads posted to /events are applied the way serve-lambda applies them. They must
+carry SERVE_TOKEN as a bearer token or an HMAC-SHA256 signature made with
+EVENTS_HMAC_SECRET in the X-Signature-256 header (sha256=<hex>). The signature covers the
+Unix time in the X-Signature-Timestamp header, a dot and the body, and is rejected when the
+timestamp is more than 5 minutes off. /healthz reports that the server is up and /readyz that the database is reachable; neither needs a token.
+
+Environment Variables:
+  SERVE_TOKEN         - Bearer token with access to every role
+  EVENTS_HMAC_SECRET  - Secret of the signatures accepted on /events (optional)
+
+At least one of SERVE_TOKEN, --tokens-file or EVENTS_HMAC_SECRET is required.`,
+	RunE: runServe,
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	serveCmd.Flags().String("listen", ":8080", "address to listen on")
+	serveCmd.Flags().String("token-subject", "scim", "principal recorded for changes made through the API")
+	serveCmd.Flags().String("scim-auth-method", structs.AuthMethodIAM, "auth method for users provisioned over SCIM or events")
+	serveCmd.Flags().String("tokens-file", "", "YAML or JSON file of delegated tokens limited to role name patterns")
+}
+
+// runServe handles the serve command
+func runServe(cmd *cobra.Command, args []string) error {
+	listen, _ := cmd.Flags().GetString("listen")
+	tokenSubject, _ := cmd.Flags().GetString("token-subject")
+	authMethod, _ := cmd.Flags().GetString("scim-auth-method")
+	tokensFile, _ := cmd.Flags().GetString("tokens-file")
+
+	var delegated []server.DelegatedToken
+	if tokensFile != "" {
+		var err error
+		if delegated, err = server.LoadTokens(tokensFile); err != nil {
+			return err
+		}
+	}
+
+	token := secretEnv("SERVE_TOKEN")
+	eventSecret := secretEnv("EVENTS_HMAC_SECRET")
+	if token == "" && len(delegated) == 0 && eventSecret == "" {
+		return fmt.Errorf("SERVE_TOKEN, --tokens-file or EVENTS_HMAC_SECRET is required")
+	}
+
+	configManager, err := connectionManager()
+	if err != nil {
+		return err
+	}
+	dbManager, err := newDatabaseManager(configManager)
+	if err != nil {
+		return err
+	}
+	defer dbManager.Close()
+
+	// Roles can change outside of the server between requests, so lookups are not cached
+	dbManager.SetCatalogCache(false)
+	// SCIM only locks and drops the users the tool manages, so the roles the server creates
+	// are always marked as managed
+	dbManager.SetRoleSource(roleSourceServe)
+
+	// Changes made through the API are attributed to the token, not the process
+	dbManager.SetPrincipal(principal.FromToken(tokenSubject).String())
+
+	eventHandler, err := newEventHandler(configManager)
+	if err != nil {
+		return err
+	}
+	srv, err := server.NewServer(dbManager, logger, server.Options{
+		Token:           token,
+		DelegatedTokens: delegated,
+		AuthMethod:      authMethod,
+		MapGroups:       eventHandler.MapCognitoGroupsToRoles,
+		NamesRole:       eventHandler.NamesRole,
+		Events:          events.NewApplier(eventHandler, dbManager, authMethod),
+		EventSecret:     eventSecret,
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	return srv.ListenAndServe(ctx, listen)
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/spf13/cobra"
+)
+
+// statusCmd represents the status command
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the configuration revision last applied to the cluster",
+	Long: `Report the checksum of the configuration last synced to the cluster without errors, when it
+was applied, by whom and with which version of the tool. When the --config file exists its
+checksum is compared with the applied one.`,
+	RunE: runStatus,
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+
+	statusCmd.Flags().String("output", "text", "output format: text or json")
+	statusCmd.Flags().Bool("exit-code", false, "exit with an error when the cluster is not at the revision of the --config file")
+}
+
+// statusReport is the result of the status command
+type statusReport struct {
+	Applied *structs.ConfigRevision `json:"applied"`          // nil when no revision was recorded
+	Config  string                  `json:"config,omitempty"` // Checksum of the --config file, when it exists
+	Current bool                    `json:"current"`          // Whether the cluster is at the --config file's revision
+}
+
+// runStatus handles the status command
+func runStatus(cmd *cobra.Command, args []string) error {
+	output, _ := cmd.Flags().GetString("output")
+	exitCode, _ := cmd.Flags().GetBool("exit-code")
+
+	if output != "text" && output != "json" {
+		return fmt.Errorf("invalid output format: %s (must be 'text' or 'json')", output)
+	}
+
+	configManager, err := connectionManager()
+	if err != nil {
+		return err
+	}
+	dbManager, err := newDatabaseManager(configManager)
+	if err != nil {
+		return err
+	}
+	defer dbManager.Close()
+
+	revision, err := dbManager.GetRevision()
+	if err != nil {
+		return err
+	}
+
+	report := statusReport{Applied: revision, Config: configManager.LoadedChecksum()}
+	report.Current = revision != nil && revision.Checksum == report.Config
+
+	if output == "json" {
+		if err := printJSON(report); err != nil {
+			return err
+		}
+	} else {
+		printStatus(report)
+	}
+
+	if exitCode && !report.Current {
+		return fmt.Errorf("cluster is not at the revision of %s", configPath)
+	}
+	return nil
+}
+
+// printStatus writes the applied revision and how it compares with the configuration file
+func printStatus(report statusReport) {
+	if report.Applied == nil {
+		fmt.Println("No configuration revision has been applied to this cluster")
+	} else {
+		applied := report.Applied
+		fmt.Printf("Cluster is at config revision %s applied at %s", applied.Checksum, applied.AppliedAt.UTC().Format(time.RFC3339))
+		if applied.AppliedBy != "" {
+			fmt.Printf(" by %s", applied.AppliedBy)
+		}
+		fmt.Println()
+		if applied.Profile != "" {
+			fmt.Printf("  profile:      %s\n", applied.Profile)
+		}
+		if applied.ToolVersion != "" {
+			fmt.Printf("  tool version: %s\n", applied.ToolVersion)
+		}
+	}
+
+	switch {
+	case report.Config == "":
+		return
+	case report.Current:
+		fmt.Printf("%s matches the applied revision\n", configPath)
+	default:
+		fmt.Printf("%s is at %s, which has not been applied\n", configPath, report.Config)
+	}
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/config"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/database"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/database/fake"
+	"github.com/sirupsen/logrus"
+)
+
+const testSyncConfig = `{
+  "groups": [
+    {"name": "analysts", "inherit": true, "privileges": ["CONNECT"], "databases": ["app"]}
+  ],
+  "users": [
+    {"username": "alice", "groups": ["analysts"], "enabled": true, "can_login": true, "auth_method": "iam"}
+  ]
+}`
+
+// syncWithFake runs syncProfile for a configuration file against a fake manager
+func syncWithFake(t *testing.T, manager *fake.Manager, contents string) *config.Manager {
+	t.Helper()
+
+	logger = logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	configPath = filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(configPath, []byte(contents), 0o600); err != nil {
+		t.Fatalf("Failed to write configuration: %v", err)
+	}
+
+	previous := newSyncer
+	newSyncer = func(*config.Manager) (database.Syncer, error) { return manager, nil }
+	t.Cleanup(func() { newSyncer = previous })
+
+	configManager := config.NewManager(logger)
+	cfg, err := configManager.LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+	result, err := syncProfile(syncCmd, configManager, cfg, "")
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if len(result.Errors) > 0 {
+		t.Fatalf("Sync reported errors: %v", result.Errors)
+	}
+	return configManager
+}
+
+func TestSyncProfileAppliesConfiguration(t *testing.T) {
+	manager := fake.NewManager()
+	configManager := syncWithFake(t, manager, testSyncConfig)
+
+	if members, _ := manager.GetGroupMembers("analysts"); !slices.Equal(members, []string{"alice"}) {
+		t.Errorf("Expected alice in analysts, got %v", members)
+	}
+	if grants, _ := manager.GetDatabasePrivileges("analysts"); len(grants) != 1 || grants[0].Privilege != "CONNECT" {
+		t.Errorf("Expected CONNECT on app for analysts, got %v", grants)
+	}
+
+	revisions := manager.Revisions()
+	if len(revisions) != 1 || revisions[0].Checksum != configManager.LoadedChecksum() {
+		t.Errorf("Expected the revision of the configuration to be recorded, got %v", revisions)
+	}
+}
+
+func TestSyncProfilePrunesWithFlag(t *testing.T) {
+	manager := fake.NewManager(
+		fake.Role{Name: "bob", CanLogin: true, Managed: database.ManagedKindUser},
+		fake.Role{Name: "app_owner", CanLogin: true},
+	)
+	if err := syncCmd.Flags().Set("prune", "true"); err != nil {
+		t.Fatalf("Failed to set --prune: %v", err)
+	}
+	t.Cleanup(func() { syncCmd.Flags().Set("prune", "false") })
+
+	syncWithFake(t, manager, testSyncConfig)
+
+	if manager.Role("bob") != nil {
+		t.Error("Expected the undeclared managed user bob to be pruned")
+	}
+	if manager.Role("app_owner") == nil {
+		t.Error("Expected the unmanaged role app_owner to be kept")
+	}
+}
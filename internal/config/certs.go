@@ -0,0 +1,65 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+const (
+	// CertIdentMap is the pg_ident.conf map name used for certificate users whose
+	// certificate name differs from their username
+	CertIdentMap = "pgum_cert"
+)
+
+// CertMapping describes the pg_hba.conf and pg_ident.conf entries a client certificate user needs
+type CertMapping struct {
+	Username   string
+	ClientName string // Certificate field matched against the user: CN or DN
+	Subject    string // Expected certificate CN or subject DN
+	HBALine    string // pg_hba.conf line authenticating the user by certificate
+	IdentLine  string // pg_ident.conf line mapping the certificate to the user, empty when none is needed
+}
+
+// CertMappings returns the certificate mapping guidance for every enabled cert authenticated user, by username
+func CertMappings(config *structs.Config) []CertMapping {
+	var mappings []CertMapping
+
+	for i := range config.Users {
+		user := &config.Users[i]
+		if !user.HasAuthMethod(structs.AuthMethodCert) || !user.Enabled || user.Absent {
+			continue
+		}
+
+		mapping := CertMapping{Username: user.Username, ClientName: "CN", Subject: user.Username}
+		switch {
+		case user.CertSubjectDN != "":
+			mapping.ClientName = "DN"
+			mapping.Subject = user.CertSubjectDN
+		case user.CertCommonName != "":
+			mapping.Subject = user.CertCommonName
+		}
+
+		options := ""
+		if mapping.ClientName == "DN" {
+			options = " clientname=DN"
+		}
+
+		// A certificate CN matching the username needs no ident map
+		if mapping.ClientName == "CN" && mapping.Subject == user.Username {
+			mapping.HBALine = fmt.Sprintf("hostssl all %s all cert", user.Username)
+		} else {
+			mapping.HBALine = fmt.Sprintf("hostssl all %s all cert%s map=%s", user.Username, options, CertIdentMap)
+			mapping.IdentLine = fmt.Sprintf("%s %q %s", CertIdentMap, mapping.Subject, user.Username)
+		}
+
+		mappings = append(mappings, mapping)
+	}
+
+	sort.Slice(mappings, func(i, j int) bool {
+		return mappings[i].Username < mappings[j].Username
+	})
+
+	return mappings
+}
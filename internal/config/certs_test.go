@@ -0,0 +1,42 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+func TestCertMappings(t *testing.T) {
+	config := &structs.Config{
+		Users: []structs.UserConfig{
+			{Username: "svc_reports", AuthMethod: "cert", CertSubjectDN: "CN=reports,O=Example", Enabled: true},
+			{Username: "svc_batch", AuthMethod: "cert", Enabled: true},
+			{Username: "svc_etl", AuthMethod: "cert", CertCommonName: "etl.example.com", Enabled: true},
+			{Username: "app_user", AuthMethod: "password", Enabled: true},
+			{Username: "old_cert", AuthMethod: "cert", Enabled: false},
+		},
+	}
+
+	mappings := CertMappings(config)
+	if len(mappings) != 3 {
+		t.Fatalf("Expected 3 mappings, got %d: %+v", len(mappings), mappings)
+	}
+
+	// Sorted by username
+	batch, etl, reports := mappings[0], mappings[1], mappings[2]
+
+	if batch.HBALine != "hostssl all svc_batch all cert" || batch.IdentLine != "" {
+		t.Errorf("Expected CN matching the username to need no ident map, got %+v", batch)
+	}
+
+	if etl.HBALine != "hostssl all svc_etl all cert map=pgum_cert" {
+		t.Errorf("Unexpected hba line: %s", etl.HBALine)
+	}
+	if etl.IdentLine != `pgum_cert "etl.example.com" svc_etl` {
+		t.Errorf("Unexpected ident line: %s", etl.IdentLine)
+	}
+
+	if reports.ClientName != "DN" || reports.HBALine != "hostssl all svc_reports all cert clientname=DN map=pgum_cert" {
+		t.Errorf("Expected DN mapping, got %+v", reports)
+	}
+}
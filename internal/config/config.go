@@ -1,19 +1,42 @@
 package config
 
 import (
-	"encoding/json"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/secrets"
 	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
 
+const (
+	// checksumPrefix identifies the hash algorithm of a configuration checksum
+	checksumPrefix = "sha256:"
+)
+
 // Manager handles configuration loading and environment variables
 type Manager struct {
-	logger *logrus.Logger
+	logger         *logrus.Logger
+	checksum       string                         // Checksum of the last loaded configuration file
+	format         string                         // Format of the last loaded configuration file, json or yaml
+	profile        *structs.ProfileConfig         // Metadata of the last selected profile, if declared
+	sslMode        *structs.SSLModeConfig         // SSL mode defaults of the last loaded configuration file
+	hooks          []structs.HookConfig           // Hooks of the last loaded configuration file
+	groupMappings  *structs.GroupMappingConfig    // Group mappings of the last loaded configuration file
+	usernameRules  *structs.UsernameRulesConfig   // Username rules of the last loaded configuration file
+	rotation       *structs.RotationConfig        // Password rotation settings of the last loaded configuration file
+	notifications  []structs.NotificationConfig   // Change notification targets of the last loaded configuration file
+	connection     *structs.ConnectionConfig      // Connection retries and pool limits of the last loaded configuration file
+	defaultGroups  []string                       // Groups every enabled user of the last loaded configuration file is a member of
+	sslCerts       *structs.SSLCertificatesConfig // Certificate files of the last loaded configuration file
+	tagRoles       bool                           // Whether the last loaded configuration file tags created roles
+	schemaProblems []string                       // Fields of the last loaded configuration file that are not part of the schema
 }
 
 // NewManager creates a new configuration manager
@@ -38,41 +61,119 @@ func (m *Manager) LoadConfig(configPath string) (*structs.Config, error) {
 		return nil, fmt.Errorf("failed to read configuration file: %w", err)
 	}
 
-	// Parse JSON
-	var config structs.Config
-	if err := json.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("failed to parse configuration file: %w", err)
+	m.checksum = Checksum(data)
+	m.format = DetectFormat(configPath, data)
+
+	// Decoding stops at the first value of the wrong type and skips unknown fields, so the
+	// document is checked against the schema first to report every problem
+	problems, err := checkSchema(data, m.format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s configuration file: %w", m.format, err)
+	}
+	config, err := parseConfig(data, m.format)
+	if err != nil {
+		if len(problems) > 0 {
+			err = &ValidationError{Problems: problems}
+		}
+		return nil, fmt.Errorf("failed to parse %s configuration file: %w", m.format, err)
+	}
+	m.schemaProblems = problems
+	for _, problem := range problems {
+		m.logger.WithField("problem", problem).Warn("Configuration field is ignored")
 	}
+	normalizeIdentifiers(config)
+	m.SetConfig(config)
 
 	m.logger.WithFields(logrus.Fields{
-		"users":  len(config.Users),
-		"groups": len(config.Groups),
+		"users":    len(config.Users),
+		"groups":   len(config.Groups),
+		"format":   m.format,
+		"checksum": m.checksum,
 	}).Info("Configuration loaded successfully")
 
-	return &config, nil
+	return config, nil
 }
 
-// GetDatabaseConnection reads database connection details from environment variables
-func (m *Manager) GetDatabaseConnection() (*structs.DatabaseConnection, error) {
-	m.logger.Info("Reading database connection from environment variables")
+// SetConfig makes the manager use the settings of a configuration built in code as it uses
+// those of a loaded file: its SSL modes and certificates, hooks, group mappings, username
+// rules, rotation, notifications, connection settings, default groups and role tagging. Its
+// passwords are registered as secrets.
+func (m *Manager) SetConfig(config *structs.Config) {
+	registerPasswords(config)
+	m.sslMode = config.SSLMode
+	m.hooks = config.Hooks
+	m.groupMappings = config.GroupMappings
+	m.usernameRules = config.UsernameRules
+	m.rotation = config.Rotation
+	m.notifications = config.Notifications
+	m.connection = config.Connection
+	m.defaultGroups = config.DefaultGroups()
+	m.sslCerts = config.SSLCertificates
+	m.tagRoles = config.TagCreatedRoles
+}
 
-	conn := &structs.DatabaseConnection{
-		Host:      getEnvOrDefault("POSTGRES_HOST", "localhost"),
-		Database:  getEnvOrDefault("POSTGRES_DB", "postgres"),
-		Username:  getEnvOrDefault("POSTGRES_USER", "postgres"),
-		Password:  os.Getenv("POSTGRES_PASSWORD"),
-		SSLMode:   getEnvOrDefault("POSTGRES_SSLMODE", "require"), // Default to require for RDS
-		IAMAuth:   getEnvOrDefault("POSTGRES_IAM_AUTH", "false") == "true",
-		AWSRegion: getEnvOrDefault("AWS_REGION", "us-east-1"),
+// TagCreatedRoles reports whether the last loaded configuration file sets tag_created_roles,
+// so every role the tool creates is marked as managed with its source
+func (m *Manager) TagCreatedRoles() bool {
+	return m.tagRoles
+}
+
+// registerPasswords registers the user passwords of a configuration as secrets so they are
+// masked in log output
+func registerPasswords(config *structs.Config) {
+	for _, user := range config.Users {
+		secrets.Register(user.Password)
 	}
+}
 
-	// Parse port
-	portStr := getEnvOrDefault("POSTGRES_PORT", "5432")
-	port, err := strconv.Atoi(portStr)
+// Checksum returns the checksum of configuration file contents as "sha256:<hex>"
+func Checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return checksumPrefix + hex.EncodeToString(sum[:])
+}
+
+// LoadedChecksum returns the checksum of the last configuration file loaded by this manager
+func (m *Manager) LoadedChecksum() string {
+	return m.checksum
+}
+
+// VerifyChecksum checks that the last loaded configuration file matches a reviewed checksum.
+// The algorithm prefix is optional and the comparison is case-insensitive.
+func (m *Manager) VerifyChecksum(expected string) error {
+	if m.checksum == "" {
+		return fmt.Errorf("no configuration has been loaded")
+	}
+
+	normalized := strings.ToLower(strings.TrimSpace(expected))
+	if !strings.HasPrefix(normalized, checksumPrefix) {
+		if strings.Contains(normalized, ":") {
+			return fmt.Errorf("unsupported checksum %s (only sha256 is supported)", expected)
+		}
+		normalized = checksumPrefix + normalized
+	}
+
+	if normalized != m.checksum {
+		return fmt.Errorf("configuration checksum mismatch: expected %s, loaded file has %s", expected, m.checksum)
+	}
+
+	m.logger.WithField("checksum", m.checksum).Info("Configuration checksum verified")
+	return nil
+}
+
+// GetDatabaseConnection reads database connection details from environment variables,
+// applying the host, port and database of the profile last selected with SelectProfile
+func (m *Manager) GetDatabaseConnection() (*structs.DatabaseConnection, error) {
+	m.logger.Info("Reading database connection from environment variables")
+
+	conn, err := m.connectionTarget()
 	if err != nil {
-		return nil, fmt.Errorf("invalid POSTGRES_PORT: %s", portStr)
+		return nil, err
 	}
-	conn.Port = port
+	conn.Username = getEnvOrDefault("POSTGRES_USER", "postgres")
+	conn.Password = os.Getenv("POSTGRES_PASSWORD")
+	conn.IAMAuth = getEnvOrDefault("POSTGRES_IAM_AUTH", "false") == "true"
+
+	conn.SSLMode, conn.SSLModeSource = m.effectiveSSLMode(conn.IAMAuth)
 
 	// Validate required fields based on authentication method
 	if conn.IAMAuth {
@@ -91,7 +192,8 @@ func (m *Manager) GetDatabaseConnection() (*structs.DatabaseConnection, error) {
 		
 		// IAM token can be provided or will be generated
 		conn.IAMToken = os.Getenv("POSTGRES_IAM_TOKEN")
-		
+		secrets.Register(conn.IAMToken)
+
 	} else {
 		m.logger.Info("Using password authentication for database connection")
 		
@@ -99,26 +201,141 @@ func (m *Manager) GetDatabaseConnection() (*structs.DatabaseConnection, error) {
 		if conn.Password == "" {
 			return nil, fmt.Errorf("POSTGRES_PASSWORD environment variable is required for password authentication")
 		}
+		secrets.Register(conn.Password)
 	}
 
 	m.logger.WithFields(logrus.Fields{
-		"host":      conn.Host,
-		"port":      conn.Port,
-		"database":  conn.Database,
-		"username":  conn.Username,
-		"sslmode":   conn.SSLMode,
-		"iam_auth":  conn.IAMAuth,
-		"aws_region": conn.AWSRegion,
+		"host":           conn.Host,
+		"port":           conn.Port,
+		"database":       conn.Database,
+		"username":       conn.Username,
+		"driver":         conn.Driver,
+		"sslmode":        conn.SSLMode,
+		"sslmode_source": conn.SSLModeSource,
+		"sslrootcert":    conn.SSLRootCert,
+		"sslcert":        conn.SSLCert,
+		"iam_auth":       conn.IAMAuth,
+		"aws_region":     conn.AWSRegion,
+		"resume_timeout": conn.ResumeTimeout,
+		"retries":        conn.ConnectRetries,
+		"max_open_conns": conn.Pool.MaxOpenConns,
 	}).Info("Database connection configuration loaded")
 
 	return conn, nil
 }
 
-// SaveConfig saves the configuration to a file
+// GetLoginConnection returns the connection details for logging in as another user on the
+// cluster GetDatabaseConnection connects to. The administrative credentials are not used; a
+// password user gets the given password and an IAM user a token generated for it.
+func (m *Manager) GetLoginConnection(username, password string, iamAuth bool) (*structs.DatabaseConnection, error) {
+	conn, err := m.connectionTarget()
+	if err != nil {
+		return nil, err
+	}
+	conn.Username = username
+	conn.IAMAuth = iamAuth
+	conn.SSLMode, conn.SSLModeSource = m.effectiveSSLMode(iamAuth)
+
+	if iamAuth {
+		if conn.SSLMode == "disable" {
+			conn.SSLMode = "require"
+		}
+	} else {
+		if password == "" {
+			return nil, fmt.Errorf("a password is required to log in as %s", username)
+		}
+		conn.Password = password
+		secrets.Register(password)
+	}
+
+	return conn, nil
+}
+
+// connectionTarget returns the host, port, database and AWS region of the connection, from
+// the environment and the profile last selected with SelectProfile
+func (m *Manager) connectionTarget() (*structs.DatabaseConnection, error) {
+	conn := &structs.DatabaseConnection{
+		Host:      getEnvOrDefault("POSTGRES_HOST", "localhost"),
+		Database:  getEnvOrDefault("POSTGRES_DB", "postgres"),
+		AWSRegion: getEnvOrDefault("AWS_REGION", "us-east-1"),
+	}
+
+	// Parse port
+	portStr := getEnvOrDefault("POSTGRES_PORT", "5432")
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid POSTGRES_PORT: %s", portStr)
+	}
+	conn.Port = port
+
+	if conn.ConnectTimeout, err = envSeconds("POSTGRES_CONNECT_TIMEOUT"); err != nil {
+		return nil, err
+	}
+	if conn.ResumeTimeout, err = envSeconds("POSTGRES_RESUME_TIMEOUT"); err != nil {
+		return nil, err
+	}
+	if err := m.connectionSettings(conn); err != nil {
+		return nil, err
+	}
+	m.sslCertificates(conn)
+	for _, endpoint := range strings.Split(os.Getenv("POSTGRES_ENDPOINTS"), ",") {
+		if endpoint = strings.TrimSpace(endpoint); endpoint != "" {
+			conn.Endpoints = append(conn.Endpoints, endpoint)
+		}
+	}
+
+	// The selected profile points at its own cluster
+	if m.profile != nil {
+		if m.profile.Host != "" {
+			conn.Host = m.profile.Host
+		}
+		if m.profile.Port != 0 {
+			conn.Port = m.profile.Port
+		}
+		if m.profile.Database != "" {
+			conn.Database = m.profile.Database
+		}
+		if m.profile.ResumeTimeoutSeconds != 0 {
+			conn.ResumeTimeout = time.Duration(m.profile.ResumeTimeoutSeconds) * time.Second
+		}
+		if len(m.profile.Endpoints) > 0 {
+			conn.Endpoints = m.profile.Endpoints
+		}
+	}
+
+	return conn, nil
+}
+
+// envSeconds reads a number of seconds from an environment variable, zero when it is not set
+func envSeconds(name string) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0, nil
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		return 0, fmt.Errorf("invalid %s: %s (must be a number of seconds)", name, value)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// SaveConfig saves the configuration to a file, as YAML or JSON depending on its extension.
+// Files without a known extension are written in the format the configuration was read in.
 func (m *Manager) SaveConfig(config *structs.Config, configPath string) error {
-	m.logger.WithField("path", configPath).Info("Saving configuration file")
+	format := formatFromExtension(configPath)
+	if format == "" {
+		format = m.format
+	}
+	if format == "" {
+		format = FormatJSON
+	}
+
+	m.logger.WithFields(logrus.Fields{
+		"path":   configPath,
+		"format": format,
+	}).Info("Saving configuration file")
 
-	data, err := json.MarshalIndent(config, "", "  ")
+	data, err := marshalConfig(config, format)
 	if err != nil {
 		return fmt.Errorf("failed to marshal configuration: %w", err)
 	}
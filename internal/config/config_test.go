@@ -2,7 +2,9 @@ package config
 
 import (
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
 	"github.com/sirupsen/logrus"
@@ -207,6 +209,42 @@ func TestGetDatabaseConnectionWithIAM(t *testing.T) {
 	}
 }
 
+func TestGetLoginConnection(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	t.Setenv("POSTGRES_HOST", "db.example.com")
+	t.Setenv("POSTGRES_USER", "admin")
+	t.Setenv("POSTGRES_PASSWORD", "")
+	t.Setenv("POSTGRES_SSLMODE", "")
+
+	manager := NewManager(logger)
+	manager.sslMode = &structs.SSLModeConfig{Password: "prefer", IAM: "verify-full"}
+
+	// The administrative password is not needed to log in as another user
+	conn, err := manager.GetLoginConnection("app_user", "app_password", false)
+	if err != nil {
+		t.Fatalf("Failed to get login connection: %v", err)
+	}
+	if conn.Host != "db.example.com" || conn.Username != "app_user" || conn.Password != "app_password" || conn.IAMAuth {
+		t.Errorf("Unexpected login connection %+v", conn)
+	}
+	if conn.SSLMode != "prefer" {
+		t.Errorf("Expected the password SSL mode, got %s", conn.SSLMode)
+	}
+
+	conn, err = manager.GetLoginConnection("iam_user", "", true)
+	if err != nil {
+		t.Fatalf("Failed to get IAM login connection: %v", err)
+	}
+	if !conn.IAMAuth || conn.Password != "" || conn.SSLMode != "verify-full" {
+		t.Errorf("Unexpected IAM login connection %+v", conn)
+	}
+
+	if _, err := manager.GetLoginConnection("app_user", "", false); err == nil {
+		t.Error("Expected a password login without a password to be rejected")
+	}
+}
+
 func TestEnvironmentVariableHandling(t *testing.T) {
 	logger := logrus.New()
 	logger.SetLevel(logrus.ErrorLevel)
@@ -347,3 +385,112 @@ func TestInitializeViper(t *testing.T) {
 	// We can't easily test the internal state without coupling to viper internals
 	// But we can ensure it doesn't panic and runs successfully
 }
+
+func TestVerifyChecksum(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	manager := NewManager(logger)
+
+	if err := manager.VerifyChecksum("sha256:abc"); err == nil {
+		t.Error("Expected error when no configuration has been loaded")
+	}
+
+	configContent := []byte(`{"users": [], "groups": []}`)
+
+	tmpFile, err := os.CreateTemp("", "test_config_*.json")
+	if err != nil {
+		t.Fatalf(failedCreateTempFile, err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.Write(configContent); err != nil {
+		t.Fatalf("Failed to write temp file: %v", err)
+	}
+	tmpFile.Close()
+
+	if _, err := manager.LoadConfig(tmpFile.Name()); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	checksum := Checksum(configContent)
+	if manager.LoadedChecksum() != checksum {
+		t.Errorf("Expected loaded checksum %s, got %s", checksum, manager.LoadedChecksum())
+	}
+
+	tests := []struct {
+		name     string
+		expected string
+		wantErr  bool
+	}{
+		{name: "exact", expected: checksum},
+		{name: "without prefix", expected: strings.TrimPrefix(checksum, "sha256:")},
+		{name: "upper case", expected: strings.ToUpper(checksum)},
+		{name: "mismatch", expected: Checksum([]byte("edited")), wantErr: true},
+		{name: "unsupported algorithm", expected: "md5:" + strings.TrimPrefix(checksum, "sha256:"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := manager.VerifyChecksum(tt.expected)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("VerifyChecksum(%s) error = %v, wantErr %v", tt.expected, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConnectionTimeouts(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	t.Setenv("POSTGRES_PASSWORD", "test_password")
+	t.Setenv("POSTGRES_CONNECT_TIMEOUT", "5")
+	t.Setenv("POSTGRES_RESUME_TIMEOUT", "30")
+
+	manager := NewManager(logger)
+	conn, err := manager.GetDatabaseConnection()
+	if err != nil {
+		t.Fatalf("Failed to get database connection: %v", err)
+	}
+	if conn.ConnectTimeout != 5*time.Second || conn.ResumeTimeout != 30*time.Second {
+		t.Errorf("Expected timeouts 5s and 30s, got %s and %s", conn.ConnectTimeout, conn.ResumeTimeout)
+	}
+
+	// A serverless cluster's profile waits longer than the others
+	manager.profile = &structs.ProfileConfig{ResumeTimeoutSeconds: 90}
+	if conn, err = manager.GetDatabaseConnection(); err != nil {
+		t.Fatalf("Failed to get database connection: %v", err)
+	}
+	if conn.ResumeTimeout != 90*time.Second {
+		t.Errorf("Expected the profile's resume timeout, got %s", conn.ResumeTimeout)
+	}
+
+	t.Setenv("POSTGRES_RESUME_TIMEOUT", "1m")
+	if _, err := manager.GetDatabaseConnection(); err == nil || !strings.Contains(err.Error(), "invalid POSTGRES_RESUME_TIMEOUT") {
+		t.Errorf("Expected an invalid resume timeout to be rejected, got %v", err)
+	}
+}
+
+func TestConnectionEndpoints(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	t.Setenv("POSTGRES_PASSWORD", "test_password")
+	t.Setenv("POSTGRES_ENDPOINTS", "reader.example.com, writer.example.com:5433,")
+
+	manager := NewManager(logger)
+	conn, err := manager.GetDatabaseConnection()
+	if err != nil {
+		t.Fatalf("Failed to get database connection: %v", err)
+	}
+	if strings.Join(conn.Endpoints, ",") != "reader.example.com,writer.example.com:5433" {
+		t.Errorf("Expected the endpoints from the environment, got %v", conn.Endpoints)
+	}
+
+	manager.profile = &structs.ProfileConfig{Endpoints: []string{"prod-writer.example.com"}}
+	if conn, err = manager.GetDatabaseConnection(); err != nil {
+		t.Fatalf("Failed to get database connection: %v", err)
+	}
+	if strings.Join(conn.Endpoints, ",") != "prod-writer.example.com" {
+		t.Errorf("Expected the profile's endpoints, got %v", conn.Endpoints)
+	}
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+// connectionSettings sets the driver, connection retries and pool limits of a connection
+// from the POSTGRES_* environment variables, or from the configuration's connection section
+// for those that are not set
+func (m *Manager) connectionSettings(conn *structs.DatabaseConnection) error {
+	settings := structs.ConnectionConfig{}
+	if m.connection != nil {
+		settings = *m.connection
+	}
+
+	if driver := os.Getenv("POSTGRES_DRIVER"); driver != "" {
+		if !validDriver(driver) {
+			return fmt.Errorf("invalid POSTGRES_DRIVER: %s (must be '%s' or '%s')", driver, structs.DriverPQ, structs.DriverPGX)
+		}
+		settings.Driver = driver
+	}
+
+	for _, setting := range []struct {
+		env   string
+		value *int
+	}{
+		{"POSTGRES_CONNECT_RETRIES", &settings.ConnectRetries},
+		{"POSTGRES_MAX_OPEN_CONNS", &settings.MaxOpenConns},
+		{"POSTGRES_MAX_IDLE_CONNS", &settings.MaxIdleConns},
+		{"POSTGRES_CONN_MAX_LIFETIME", &settings.ConnMaxLifetimeSeconds},
+		{"POSTGRES_CONN_MAX_IDLE_TIME", &settings.ConnMaxIdleTimeSeconds},
+	} {
+		value := os.Getenv(setting.env)
+		if value == "" {
+			continue
+		}
+		number, err := strconv.Atoi(value)
+		if err != nil || number < 0 {
+			return fmt.Errorf("invalid %s: %s (must be a non-negative number)", setting.env, value)
+		}
+		*setting.value = number
+	}
+
+	conn.Driver = settings.Driver
+	conn.ConnectRetries = settings.ConnectRetries
+	conn.Pool = structs.PoolConfig{
+		MaxOpenConns:    settings.MaxOpenConns,
+		MaxIdleConns:    settings.MaxIdleConns,
+		ConnMaxLifetime: time.Duration(settings.ConnMaxLifetimeSeconds) * time.Second,
+		ConnMaxIdleTime: time.Duration(settings.ConnMaxIdleTimeSeconds) * time.Second,
+	}
+	return nil
+}
+
+// checkConnectionConfig reports unknown drivers, negative connection settings and idle
+// limits above the open limit, which database/sql would silently lower
+func checkConnectionConfig(settings *structs.ConnectionConfig) []string {
+	if settings == nil {
+		return nil
+	}
+
+	var problems []string
+	if settings.Driver != "" && !validDriver(settings.Driver) {
+		problems = append(problems, fmt.Sprintf("connection: driver must be '%s' or '%s', got %q", structs.DriverPQ, structs.DriverPGX, settings.Driver))
+	}
+	for _, field := range []struct {
+		name  string
+		value int
+	}{
+		{"connect_retries", settings.ConnectRetries},
+		{"max_open_conns", settings.MaxOpenConns},
+		{"max_idle_conns", settings.MaxIdleConns},
+		{"conn_max_lifetime_seconds", settings.ConnMaxLifetimeSeconds},
+		{"conn_max_idle_time_seconds", settings.ConnMaxIdleTimeSeconds},
+	} {
+		if field.value < 0 {
+			problems = append(problems, fmt.Sprintf("connection: %s must not be negative, got %d", field.name, field.value))
+		}
+	}
+	if settings.MaxOpenConns > 0 && settings.MaxIdleConns > settings.MaxOpenConns {
+		problems = append(problems, fmt.Sprintf("connection: max_idle_conns (%d) is above max_open_conns (%d)", settings.MaxIdleConns, settings.MaxOpenConns))
+	}
+	return problems
+}
+
+// validDriver reports whether a database driver is supported
+func validDriver(driver string) bool {
+	return driver == structs.DriverPQ || driver == structs.DriverPGX
+}
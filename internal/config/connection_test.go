@@ -0,0 +1,75 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+func TestConnectionSettings(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	t.Setenv("POSTGRES_PASSWORD", "test_password")
+	t.Setenv("POSTGRES_MAX_OPEN_CONNS", "4")
+
+	manager := NewManager(logger)
+	manager.SetConfig(&structs.Config{Connection: &structs.ConnectionConfig{
+		Driver:                 structs.DriverPGX,
+		ConnectRetries:         3,
+		MaxOpenConns:           10,
+		ConnMaxLifetimeSeconds: 600,
+	}})
+
+	conn, err := manager.GetDatabaseConnection()
+	if err != nil {
+		t.Fatalf("Failed to get database connection: %v", err)
+	}
+	expected := structs.PoolConfig{MaxOpenConns: 4, ConnMaxLifetime: 10 * time.Minute}
+	if conn.ConnectRetries != 3 || conn.Pool != expected {
+		t.Errorf("Expected 3 retries and pool %+v, got %d and %+v", expected, conn.ConnectRetries, conn.Pool)
+	}
+
+	if conn.Driver != structs.DriverPGX {
+		t.Errorf("Expected driver %s from the configuration, got %q", structs.DriverPGX, conn.Driver)
+	}
+
+	// The environment overrides the configured driver
+	t.Setenv("POSTGRES_DRIVER", structs.DriverPQ)
+	if conn, err = manager.GetDatabaseConnection(); err != nil || conn.Driver != structs.DriverPQ {
+		t.Errorf("Expected driver %s from POSTGRES_DRIVER, got %+v (err: %v)", structs.DriverPQ, conn, err)
+	}
+	t.Setenv("POSTGRES_DRIVER", "mysql")
+	if _, err := manager.GetDatabaseConnection(); err == nil || !strings.Contains(err.Error(), "invalid POSTGRES_DRIVER") {
+		t.Errorf("Expected unknown driver to be rejected, got %v", err)
+	}
+	t.Setenv("POSTGRES_DRIVER", "")
+
+	t.Setenv("POSTGRES_CONNECT_RETRIES", "-1")
+	if _, err := manager.GetDatabaseConnection(); err == nil || !strings.Contains(err.Error(), "invalid POSTGRES_CONNECT_RETRIES") {
+		t.Errorf("Expected negative retries to be rejected, got %v", err)
+	}
+}
+
+func TestValidateConfigConnection(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewManager(logger)
+
+	config := &structs.Config{Connection: &structs.ConnectionConfig{Driver: "pgx5", ConnectRetries: -1, MaxOpenConns: 2, MaxIdleConns: 5}}
+	err := manager.ValidateConfig(config)
+	if err == nil {
+		t.Fatal("Expected invalid connection settings to be rejected")
+	}
+	for _, expected := range []string{
+		`connection: driver must be 'pq' or 'pgx', got "pgx5"`,
+		"connection: connect_retries must not be negative",
+		"connection: max_idle_conns (5) is above max_open_conns (2)",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected %q in %v", expected, err)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+// DefaultGroups returns the groups every enabled user of the last loaded configuration file
+// is a member of, from its global_defaults
+func (m *Manager) DefaultGroups() []string {
+	return m.defaultGroups
+}
+
+// checkGlobalDefaults reports default groups that are empty, listed twice or not valid role
+// names
+func checkGlobalDefaults(defaults *structs.GlobalDefaultsConfig) []string {
+	if defaults == nil {
+		return nil
+	}
+
+	var problems []string
+	seen := make(map[string]bool, len(defaults.Groups))
+	for _, group := range defaults.Groups {
+		switch {
+		case group == "":
+			problems = append(problems, "global_defaults: empty group name")
+		case seen[group]:
+			problems = append(problems, fmt.Sprintf("global_defaults: group %q is listed more than once", group))
+		default:
+			if err := structs.CheckIdentifier(group); err != nil {
+				problems = append(problems, fmt.Sprintf("global_defaults: group %q: %v", group, err))
+			}
+		}
+		seen[group] = true
+	}
+	return problems
+}
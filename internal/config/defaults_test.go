@@ -0,0 +1,69 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+func TestValidateConfigGlobalDefaults(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewManager(logger)
+
+	config := &structs.Config{
+		Groups:         []structs.GroupConfig{{Name: "base_access"}},
+		GlobalDefaults: &structs.GlobalDefaultsConfig{Groups: []string{"base_access", "", "base_access", "audit"}},
+	}
+
+	err := manager.ValidateConfig(config)
+	if err == nil {
+		t.Fatal("Expected invalid default groups to be rejected")
+	}
+	for _, expected := range []string{"global_defaults: empty group name", `global_defaults: group "base_access" is listed more than once`} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected %q in %v", expected, err)
+		}
+	}
+
+	// Default groups must be declared like the groups of users
+	err = manager.ValidateReferences(config, nil)
+	if err == nil || !strings.Contains(err.Error(), `global_defaults references undeclared group "audit"`) {
+		t.Errorf("Expected the undeclared default group to be reported, got %v", err)
+	}
+
+	config.GlobalDefaults.Groups = []string{"base_access"}
+	if err := manager.ValidateConfig(config); err != nil {
+		t.Errorf("Expected valid default groups, got %v", err)
+	}
+	if err := manager.ValidateReferences(config, nil); err != nil {
+		t.Errorf("Expected the declared default group to be accepted, got %v", err)
+	}
+}
+
+func TestSetConfigDefaultGroups(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewManager(logger)
+
+	manager.SetConfig(&structs.Config{GlobalDefaults: &structs.GlobalDefaultsConfig{Groups: []string{"base_access"}}})
+	if groups := manager.DefaultGroups(); strings.Join(groups, ",") != "base_access" {
+		t.Errorf("Expected the default groups of the configuration, got %v", groups)
+	}
+}
+
+func TestSetConfigTagCreatedRoles(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewManager(logger)
+
+	if manager.TagCreatedRoles() {
+		t.Error("Expected roles not to be tagged without a configuration")
+	}
+	manager.SetConfig(&structs.Config{TagCreatedRoles: true})
+	if !manager.TagCreatedRoles() {
+		t.Error("Expected tag_created_roles of the configuration to be used")
+	}
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// FormatJSON is the JSON configuration format
+	FormatJSON = "json"
+	// FormatYAML is the YAML configuration format
+	FormatYAML = "yaml"
+)
+
+// DetectFormat returns the format of a configuration file from its extension, falling back
+// to its contents: JSON documents start with '{', anything else is read as YAML
+func DetectFormat(path string, data []byte) string {
+	if format := formatFromExtension(path); format != "" {
+		return format
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return FormatJSON
+	}
+	return FormatYAML
+}
+
+// formatFromExtension returns the format a file extension stands for, or an empty string
+func formatFromExtension(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FormatJSON
+	case ".yaml", ".yml":
+		return FormatYAML
+	}
+	return ""
+}
+
+// parseConfig decodes a configuration in the given format. YAML is converted to JSON first,
+// so both formats use the same field names and decoding rules.
+func parseConfig(data []byte, format string) (*structs.Config, error) {
+	data, err := documentJSON(data, format)
+	if err != nil {
+		return nil, err
+	}
+
+	var config structs.Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// documentJSON returns a configuration document as JSON, converting YAML
+func documentJSON(data []byte, format string) ([]byte, error) {
+	if format != FormatYAML {
+		return data, nil
+	}
+
+	var document interface{}
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	if document == nil {
+		return nil, fmt.Errorf("configuration is empty")
+	}
+
+	data, err := json.Marshal(document)
+	if err != nil {
+		return nil, fmt.Errorf("configuration is not representable as JSON: %w", err)
+	}
+	return data, nil
+}
+
+// marshalConfig encodes a configuration in the given format. YAML keeps the field order of
+// the JSON encoding rather than sorting keys.
+func marshalConfig(config *structs.Config, format string) ([]byte, error) {
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil || format != FormatYAML {
+		return data, err
+	}
+
+	// JSON is valid YAML, so decoding it into a node keeps the order of the keys
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	blockStyle(&document)
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&document); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// blockStyle clears the flow style and quoting a node inherited from JSON, so it is written
+// as plain block YAML. Strings that would read back as another type stay quoted.
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
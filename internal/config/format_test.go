@@ -0,0 +1,143 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		path string
+		data string
+		want string
+	}{
+		{"config.json", "users: []", FormatJSON},
+		{"config.yaml", `{"users": []}`, FormatYAML},
+		{"config.YML", "", FormatYAML},
+		{"config", "  \n{\"users\": []}", FormatJSON},
+		{"config", "users:\n  - username: app_user\n", FormatYAML},
+	}
+
+	for _, tt := range tests {
+		if got := DetectFormat(tt.path, []byte(tt.data)); got != tt.want {
+			t.Errorf("DetectFormat(%q, %q) = %s, expected %s", tt.path, tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestLoadConfigYAML(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	manager := NewManager(logger)
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	yamlConfig := `
+# Application roles
+groups:
+  - name: app_readers
+    inherit: true
+    privileges: [CONNECT]
+    databases: [app]
+users:
+  - username: app_user
+    auth_methods: [iam]
+    groups: [app_readers]
+    enabled: true
+    can_login: true
+    connection_limit: 5
+`
+	if err := os.WriteFile(path, []byte(yamlConfig), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	config, err := manager.LoadConfig(path)
+	if err != nil {
+		t.Fatalf("Failed to load YAML config: %v", err)
+	}
+
+	if len(config.Users) != 1 || config.Users[0].Username != "app_user" || config.Users[0].ConnectionLimit != 5 {
+		t.Fatalf("Unexpected users: %+v", config.Users)
+	}
+	if !config.Users[0].CanLogin || len(config.Users[0].Groups) != 1 {
+		t.Errorf("Unexpected user settings: %+v", config.Users[0])
+	}
+	if len(config.Groups) != 1 || !config.Groups[0].Inherit || config.Groups[0].Databases[0] != "app" {
+		t.Errorf("Unexpected groups: %+v", config.Groups)
+	}
+}
+
+func TestLoadConfigInvalidYAML(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	manager := NewManager(logger)
+
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte("users:\n  - username: [unclosed\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	if _, err := manager.LoadConfig(path); err == nil || !strings.Contains(err.Error(), "yaml") {
+		t.Errorf("Expected a YAML parse error, got %v", err)
+	}
+}
+
+func TestSaveConfigKeepsFormat(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	manager := NewManager(logger)
+
+	// A file without an extension is written back in the format it was read in
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte("users:\n  - username: app_user\n    enabled: true\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	config, err := manager.LoadConfig(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	config.Users = append(config.Users, structs.UserConfig{Username: "123", Description: "true", Enabled: true})
+
+	if err := manager.SaveConfig(config, path); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read saved config: %v", err)
+	}
+	if DetectFormat(path, data) != FormatYAML || strings.Contains(string(data), "{") {
+		t.Fatalf("Expected block YAML, got:\n%s", data)
+	}
+	// Keys keep the order of the configuration structs
+	if strings.Index(string(data), "username:") > strings.Index(string(data), "enabled:") {
+		t.Errorf("Expected username before enabled, got:\n%s", data)
+	}
+
+	reloaded, err := manager.LoadConfig(path)
+	if err != nil {
+		t.Fatalf("Failed to reload saved config: %v", err)
+	}
+	// Strings that look like numbers or booleans stay strings
+	if len(reloaded.Users) != 2 || reloaded.Users[1].Username != "123" || reloaded.Users[1].Description != "true" {
+		t.Errorf("Unexpected users after round trip: %+v", reloaded.Users)
+	}
+
+	// An explicit extension wins over the format that was read
+	jsonPath := filepath.Join(t.TempDir(), "config.json")
+	if err := manager.SaveConfig(config, jsonPath); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	data, _ = os.ReadFile(jsonPath)
+	if !strings.HasPrefix(string(data), "{") {
+		t.Errorf("Expected JSON for a .json path, got:\n%s", data)
+	}
+}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+// hookEvents lists the events a hook can run on
+var hookEvents = []string{structs.HookEventUserCreated, structs.HookEventGroupCreated}
+
+// Hooks returns the hooks of the last loaded configuration file
+func (m *Manager) Hooks() []structs.HookConfig {
+	return m.hooks
+}
+
+// checkHooks reports hooks without a name, with an unknown event, with nothing to run or
+// with databases but no SQL to run in them
+func checkHooks(hooks []structs.HookConfig) []string {
+	var problems []string
+
+	for _, hook := range hooks {
+		if hook.Name == "" {
+			problems = append(problems, "hook without a name")
+			continue
+		}
+
+		entity := fmt.Sprintf("hook %q", hook.Name)
+		if !containsString(hookEvents, hook.Event) {
+			problems = append(problems, fmt.Sprintf("%s: unknown event %q (must be one of %v)", entity, hook.Event, hookEvents))
+		}
+		if len(hook.SQL) == 0 && len(hook.Command) == 0 {
+			problems = append(problems, fmt.Sprintf("%s: no sql or command to run", entity))
+		}
+		if len(hook.Databases) > 0 && len(hook.SQL) == 0 {
+			problems = append(problems, fmt.Sprintf("%s: databases is set but there is no sql to run in them", entity))
+		}
+		for _, database := range hook.Databases {
+			if database == "" {
+				problems = append(problems, fmt.Sprintf("%s: empty database name", entity))
+			}
+		}
+	}
+
+	return problems
+}
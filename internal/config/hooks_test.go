@@ -0,0 +1,38 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+func TestValidateConfigHooks(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewManager(logger)
+
+	config := &structs.Config{
+		Hooks: []structs.HookConfig{
+			{Name: "resource-group", Event: structs.HookEventUserCreated, SQL: []string{"SELECT 1"}},
+			{Name: "priority", Event: "user_dropped", Command: []string{"assign-priority"}},
+			{Name: "empty", Event: structs.HookEventUserCreated},
+			{Name: "bootstrap", Event: structs.HookEventGroupCreated, Databases: []string{"app"}, SQL: []string{"SELECT 1"}},
+			{Name: "no-sql", Event: structs.HookEventGroupCreated, Databases: []string{"app"}, Command: []string{"bootstrap"}},
+		},
+	}
+
+	err := manager.ValidateConfig(config)
+	if err == nil {
+		t.Fatal("Expected invalid hooks to be rejected")
+	}
+	for _, expected := range []string{`hook "priority": unknown event "user_dropped"`, `hook "empty": no sql or command to run`, `hook "no-sql": databases is set but there is no sql to run in them`} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected %q in %v", expected, err)
+		}
+	}
+	if problems := err.(*ValidationError).Problems; len(problems) != 3 {
+		t.Errorf("Expected 3 problems, got %v", problems)
+	}
+}
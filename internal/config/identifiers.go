@@ -0,0 +1,67 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+// normalizeIdentifiers puts the role names of a configuration, and the identity provider
+// groups mapped to roles, in Unicode NFC form, so a name typed precomposed in one place and
+// decomposed in another refers to the same role
+func normalizeIdentifiers(config *structs.Config) {
+	for i := range config.Users {
+		user := &config.Users[i]
+		user.Username = structs.NormalizeIdentifier(user.Username)
+		normalizeAll(user.Groups)
+		normalizeAll(user.PreviousNames)
+		for j := range user.TemporaryGroups {
+			user.TemporaryGroups[j].Group = structs.NormalizeIdentifier(user.TemporaryGroups[j].Group)
+		}
+	}
+	for i := range config.Groups {
+		group := &config.Groups[i]
+		group.Name = structs.NormalizeIdentifier(group.Name)
+		normalizeAll(group.MemberOf)
+	}
+	if config.GlobalDefaults != nil {
+		normalizeAll(config.GlobalDefaults.Groups)
+	}
+	if config.RoleRemoval != nil {
+		config.RoleRemoval.ReassignTo = structs.NormalizeIdentifier(config.RoleRemoval.ReassignTo)
+	}
+
+	if mappings := config.GroupMappings; mappings != nil {
+		groups := make(map[string]string, len(mappings.Groups))
+		for group, role := range mappings.Groups {
+			groups[structs.NormalizeIdentifier(group)] = structs.NormalizeIdentifier(role)
+		}
+		if mappings.Groups != nil {
+			mappings.Groups = groups
+		}
+		mappings.DefaultRole = structs.NormalizeIdentifier(mappings.DefaultRole)
+	}
+}
+
+// normalizeAll normalizes a list of role names in place
+func normalizeAll(names []string) {
+	for i, name := range names {
+		names[i] = structs.NormalizeIdentifier(name)
+	}
+}
+
+// checkIdentifiers reports user and group names PostgreSQL would reject or truncate
+func checkIdentifiers(config *structs.Config) []string {
+	var problems []string
+	for _, user := range config.Users {
+		if err := structs.CheckIdentifier(user.Username); err != nil {
+			problems = append(problems, fmt.Sprintf("user %q: %v", user.Username, err))
+		}
+	}
+	for _, group := range config.Groups {
+		if err := structs.CheckIdentifier(group.Name); err != nil {
+			problems = append(problems, fmt.Sprintf("group %q: %v", group.Name, err))
+		}
+	}
+	return problems
+}
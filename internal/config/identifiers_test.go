@@ -0,0 +1,80 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+func TestLoadConfigNormalizesIdentifiers(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewManager(logger)
+
+	// Names written decomposed, an e followed by a combining acute accent, as some systems send them
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := `{
+		"users": [{"username": "jose\u0301", "groups": ["e\u0301quipe"], "previous_names": ["old_jose\u0301"],
+			"temporary_groups": [{"group": "on_call_e\u0301quipe", "expires_at": "2030-01-01T00:00:00Z"}]}],
+		"groups": [{"name": "e\u0301quipe", "member_of": ["de\u0301partement"]}],
+		"group_mappings": {"groups": {"E\u0301quipe": "e\u0301quipe"}}
+	}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	config, err := manager.LoadConfig(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	user := config.Users[0]
+	if user.Username != "jos\u00e9" || user.Groups[0] != "\u00e9quipe" || user.PreviousNames[0] != "old_jos\u00e9" || user.TemporaryGroups[0].Group != "on_call_\u00e9quipe" {
+		t.Errorf("Expected the user's role names in NFC form, got %+v", user)
+	}
+	if group := config.Groups[0]; group.Name != "\u00e9quipe" || group.MemberOf[0] != "d\u00e9partement" {
+		t.Errorf("Expected the group's role names in NFC form, got %+v", group)
+	}
+	if role := config.GroupMappings.Groups["\u00c9quipe"]; role != "\u00e9quipe" {
+		t.Errorf("Expected the group mapping in NFC form, got %v", config.GroupMappings.Groups)
+	}
+}
+
+func TestValidateConfigIdentifiers(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewManager(logger)
+
+	valid := &structs.Config{
+		Users:  []structs.UserConfig{{Username: "jürgen", AuthMethod: structs.AuthMethodCert}},
+		Groups: []structs.GroupConfig{{Name: "équipe_données"}},
+	}
+	if err := manager.ValidateConfig(valid); err != nil {
+		t.Errorf("Expected non-ASCII names to be valid, got %v", err)
+	}
+
+	config := &structs.Config{
+		Users: []structs.UserConfig{
+			{Username: strings.Repeat("é", 32), AuthMethod: structs.AuthMethodCert},
+			{Username: "tab\tuser", AuthMethod: structs.AuthMethodCert},
+		},
+		Groups: []structs.GroupConfig{{Name: ""}},
+	}
+	err := manager.ValidateConfig(config)
+	if err == nil {
+		t.Fatal("Expected invalid names to be rejected")
+	}
+	for _, expected := range []string{
+		"is 64 bytes long, PostgreSQL keeps only 63",
+		`user "tab\tuser": role name "tab\tuser" contains a control character`,
+		`group "": empty role name`,
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected %q in %v", expected, err)
+		}
+	}
+}
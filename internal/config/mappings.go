@@ -0,0 +1,57 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+// GroupMappings returns the group mappings of the last loaded configuration file, or nil
+// when it has none
+func (m *Manager) GroupMappings() *structs.GroupMappingConfig {
+	return m.groupMappings
+}
+
+// checkGroupMappings reports group mappings without a role, empty prefixes and rules whose
+// pattern does not compile
+func checkGroupMappings(mappings *structs.GroupMappingConfig) []string {
+	if mappings == nil {
+		return nil
+	}
+
+	var problems []string
+
+	groups := make([]string, 0, len(mappings.Groups))
+	for group := range mappings.Groups {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	for _, group := range groups {
+		if mappings.Groups[group] == "" {
+			problems = append(problems, fmt.Sprintf("group mapping %q: no role", group))
+		}
+	}
+
+	for _, prefix := range mappings.Prefixes {
+		if prefix.Prefix == "" {
+			problems = append(problems, "group mapping prefix without a prefix")
+		}
+	}
+
+	for _, rule := range mappings.Rules {
+		if rule.Pattern == "" {
+			problems = append(problems, "group mapping rule without a pattern")
+			continue
+		}
+		if _, err := regexp.Compile(rule.Pattern); err != nil {
+			problems = append(problems, fmt.Sprintf("group mapping rule %q: invalid pattern: %v", rule.Pattern, err))
+		}
+		if rule.Role == "" {
+			problems = append(problems, fmt.Sprintf("group mapping rule %q: no role", rule.Pattern))
+		}
+	}
+
+	return problems
+}
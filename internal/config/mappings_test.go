@@ -0,0 +1,41 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+func TestValidateConfigGroupMappings(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewManager(logger)
+
+	config := &structs.Config{
+		GroupMappings: &structs.GroupMappingConfig{
+			Groups:   map[string]string{"Admins": "admin_group", "Users": ""},
+			Prefixes: []structs.PrefixMapping{{Prefix: "", Replace: "team_"}},
+			Rules:    []structs.RuleMapping{{Pattern: "dept-(", Role: "dept"}, {Pattern: "ops-.*"}},
+		},
+	}
+
+	err := manager.ValidateConfig(config)
+	if err == nil {
+		t.Fatal("Expected invalid group mappings to be rejected")
+	}
+	for _, expected := range []string{
+		`group mapping "Users": no role`,
+		"group mapping prefix without a prefix",
+		`group mapping rule "dept-(": invalid pattern`,
+		`group mapping rule "ops-.*": no role`,
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected %q in %v", expected, err)
+		}
+	}
+	if problems := err.(*ValidationError).Problems; len(problems) != 4 {
+		t.Errorf("Expected 4 problems, got %v", problems)
+	}
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+// notificationTypes lists the targets change notifications can be sent to
+var notificationTypes = []string{
+	structs.NotificationTypeWebhook,
+	structs.NotificationTypeSNS,
+	structs.NotificationTypeEventBridge,
+}
+
+// notificationFormats lists the formats change notifications can be sent in
+var notificationFormats = []string{
+	structs.NotificationFormatJSON,
+	structs.NotificationFormatCloudEvents,
+}
+
+// Notifications returns the notification targets of the last loaded configuration file
+func (m *Manager) Notifications() []structs.NotificationConfig {
+	return m.notifications
+}
+
+// checkNotifications reports targets without a name or with a duplicate one, unknown types
+// and formats, and targets missing the destination their type sends to
+func checkNotifications(notifications []structs.NotificationConfig) []string {
+	var problems []string
+	seen := make(map[string]bool)
+
+	for _, notification := range notifications {
+		if notification.Name == "" {
+			problems = append(problems, "notification without a name")
+			continue
+		}
+		entity := fmt.Sprintf("notification %q", notification.Name)
+		if seen[notification.Name] {
+			problems = append(problems, fmt.Sprintf("%s: declared more than once", entity))
+		}
+		seen[notification.Name] = true
+
+		if notification.Format != "" && !slices.Contains(notificationFormats, notification.Format) {
+			problems = append(problems, fmt.Sprintf("%s: unknown format %q (must be one of %s)", entity, notification.Format, strings.Join(notificationFormats, ", ")))
+		}
+
+		switch notification.Type {
+		case structs.NotificationTypeWebhook:
+			if target, err := url.Parse(notification.URL); err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+				problems = append(problems, fmt.Sprintf("%s: webhook needs an http or https url", entity))
+			}
+		case structs.NotificationTypeSNS:
+			if !strings.HasPrefix(notification.TopicARN, "arn:") {
+				problems = append(problems, fmt.Sprintf("%s: sns needs a topic_arn", entity))
+			}
+		case structs.NotificationTypeEventBridge:
+			// EventBridge reserves sources starting with aws. for AWS services
+			if strings.HasPrefix(notification.Source, "aws.") {
+				problems = append(problems, fmt.Sprintf("%s: source %q must not start with aws.", entity, notification.Source))
+			}
+		default:
+			problems = append(problems, fmt.Sprintf("%s: unknown type %q (must be one of %s)", entity, notification.Type, strings.Join(notificationTypes, ", ")))
+			continue
+		}
+
+		if notification.URL != "" && notification.Type != structs.NotificationTypeWebhook {
+			problems = append(problems, fmt.Sprintf("%s: url only applies to webhook notifications", entity))
+		}
+		if notification.TopicARN != "" && notification.Type != structs.NotificationTypeSNS {
+			problems = append(problems, fmt.Sprintf("%s: topic_arn only applies to sns notifications", entity))
+		}
+		if notification.EventBus != "" && notification.Type != structs.NotificationTypeEventBridge {
+			problems = append(problems, fmt.Sprintf("%s: event_bus only applies to eventbridge notifications", entity))
+		}
+	}
+
+	return problems
+}
@@ -0,0 +1,48 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+func TestValidateConfigNotifications(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewManager(logger)
+
+	valid := []structs.NotificationConfig{
+		{Name: "audit", Type: structs.NotificationTypeWebhook, URL: "https://hooks.example.com/pgum"},
+		{Name: "topic", Type: structs.NotificationTypeSNS, TopicARN: "arn:aws:sns:eu-west-1:123456789012:role-changes", Format: structs.NotificationFormatCloudEvents},
+		{Name: "bus", Type: structs.NotificationTypeEventBridge, EventBus: "access-events", Source: "com.example.pgum"},
+	}
+	if err := manager.ValidateConfig(&structs.Config{Notifications: valid}); err != nil {
+		t.Errorf("Expected valid notifications, got %v", err)
+	}
+
+	tests := []struct {
+		notification structs.NotificationConfig
+		expected     string
+	}{
+		{structs.NotificationConfig{Type: structs.NotificationTypeWebhook}, "notification without a name"},
+		{structs.NotificationConfig{Name: "n", Type: "email"}, `notification "n": unknown type "email"`},
+		{structs.NotificationConfig{Name: "n", Type: structs.NotificationTypeWebhook, URL: "https://hooks.example.com", Format: "xml"}, `unknown format "xml"`},
+		{structs.NotificationConfig{Name: "n", Type: structs.NotificationTypeWebhook, URL: "hooks.example.com/pgum"}, "webhook needs an http or https url"},
+		{structs.NotificationConfig{Name: "n", Type: structs.NotificationTypeSNS}, "sns needs a topic_arn"},
+		{structs.NotificationConfig{Name: "n", Type: structs.NotificationTypeEventBridge, Source: "aws.rds"}, "must not start with aws."},
+		{structs.NotificationConfig{Name: "n", Type: structs.NotificationTypeEventBridge, URL: "https://hooks.example.com"}, "url only applies to webhook notifications"},
+	}
+	for _, tt := range tests {
+		err := manager.ValidateConfig(&structs.Config{Notifications: []structs.NotificationConfig{tt.notification}})
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("Expected %q for %+v, got %v", tt.expected, tt.notification, err)
+		}
+	}
+
+	duplicate := []structs.NotificationConfig{valid[0], valid[0]}
+	if err := manager.ValidateConfig(&structs.Config{Notifications: duplicate}); err == nil || !strings.Contains(err.Error(), "declared more than once") {
+		t.Errorf("Expected duplicate names to be rejected, got %v", err)
+	}
+}
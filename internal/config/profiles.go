@@ -0,0 +1,146 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+// ClusterNames returns the sorted cluster names referenced by users and groups or declared in profiles
+func ClusterNames(config *structs.Config) []string {
+	seen := make(map[string]bool)
+	for _, user := range config.Users {
+		for _, cluster := range user.Clusters {
+			seen[cluster] = true
+		}
+	}
+	for _, group := range config.Groups {
+		for _, cluster := range group.Clusters {
+			seen[cluster] = true
+		}
+	}
+	for name := range config.Profiles {
+		seen[name] = true
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SelectProfile returns a copy of the configuration holding only the users and groups that
+// apply to the profile: those without a clusters selector and those listing the profile.
+// With an empty profile only entities without a selector are kept. Templated values are
+// rendered with the profile metadata
+func (m *Manager) SelectProfile(config *structs.Config, profile string) (*structs.Config, error) {
+	if profile != "" && !containsString(ClusterNames(config), profile) {
+		return nil, fmt.Errorf("profile %q is not declared in profiles and does not match the clusters of any user or group", profile)
+	}
+
+	m.profile = nil
+	if meta, ok := config.Profiles[profile]; ok {
+		m.profile = &meta
+	}
+
+	selected := *config
+	selected.Users = make([]structs.UserConfig, 0, len(config.Users))
+	for _, user := range config.Users {
+		if inCluster(user.Clusters, profile) {
+			selected.Users = append(selected.Users, user)
+		}
+	}
+	selected.Groups = make([]structs.GroupConfig, 0, len(config.Groups))
+	for _, group := range config.Groups {
+		if inCluster(group.Clusters, profile) {
+			selected.Groups = append(selected.Groups, group)
+		}
+	}
+
+	if err := renderProfile(&selected, profile); err != nil {
+		return nil, fmt.Errorf("failed to render configuration for profile %q: %w", profile, err)
+	}
+	registerPasswords(&selected)
+
+	skipped := len(config.Users) + len(config.Groups) - len(selected.Users) - len(selected.Groups)
+	fields := logrus.Fields{
+		"profile": profile,
+		"users":   len(selected.Users),
+		"groups":  len(selected.Groups),
+		"skipped": skipped,
+	}
+	if profile == "" && skipped > 0 {
+		m.logger.WithFields(fields).Warn("Skipping users and groups with a clusters selector (use --profile to apply them)")
+	} else {
+		m.logger.WithFields(fields).Debug("Selected profile")
+	}
+
+	return &selected, nil
+}
+
+// ValidationProfiles returns the profiles a configuration should be validated for: the given
+// profile, or every cluster the configuration references when no profile is given. The same
+// user or group may be declared once per cluster, so each cluster is validated on its own
+func ValidationProfiles(config *structs.Config, profile string) []string {
+	if clusters := ClusterNames(config); profile == "" && len(clusters) > 0 {
+		return clusters
+	}
+	return []string{profile}
+}
+
+// ValidateProfiles validates the configuration as it applies to each of its validation profiles
+func (m *Manager) ValidateProfiles(config *structs.Config, profile string) error {
+	for _, name := range ValidationProfiles(config, profile) {
+		selected, err := m.SelectProfile(config, name)
+		if err != nil {
+			return err
+		}
+		if err := m.ValidateConfig(selected); err != nil {
+			if name == "" {
+				return err
+			}
+			return fmt.Errorf("profile %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// inCluster reports whether an entity with the given clusters selector applies to the profile
+func inCluster(clusters []string, profile string) bool {
+	if len(clusters) == 0 {
+		return true
+	}
+	return profile != "" && containsString(clusters, profile)
+}
+
+// containsString reports whether a slice contains a value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// checkProfileConnections reports profiles with a negative resume timeout or endpoints that
+// are not a host or host:port
+func checkProfileConnections(config *structs.Config) []string {
+	var problems []string
+	for _, name := range ClusterNames(config) {
+		profile := config.Profiles[name]
+		if profile.ResumeTimeoutSeconds < 0 {
+			problems = append(problems, fmt.Sprintf("profile %q: resume_timeout_seconds must not be negative, got %d", name, profile.ResumeTimeoutSeconds))
+		}
+		for _, endpoint := range profile.Endpoints {
+			if _, _, err := structs.ParseEndpoint(endpoint, 5432); err != nil {
+				problems = append(problems, fmt.Sprintf("profile %q: %v", name, err))
+			}
+		}
+	}
+	return problems
+}
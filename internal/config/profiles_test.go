@@ -0,0 +1,99 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+func newProfileTestConfig() *structs.Config {
+	return &structs.Config{
+		Users: []structs.UserConfig{
+			{Username: "app_user", Enabled: true},
+			{Username: "analyst", Enabled: true, Clusters: []string{"prod"}},
+			{Username: "analyst", Enabled: true, Clusters: []string{"staging"}, Groups: []string{"dev_group"}},
+		},
+		Groups: []structs.GroupConfig{
+			{Name: "app_group"},
+			{Name: "dev_group", Clusters: []string{"staging"}},
+		},
+	}
+}
+
+func TestSelectProfile(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewManager(logger)
+	config := newProfileTestConfig()
+
+	if names := ClusterNames(config); strings.Join(names, ",") != "prod,staging" {
+		t.Errorf("Expected clusters prod,staging, got %v", names)
+	}
+
+	staging, err := manager.SelectProfile(config, "staging")
+	if err != nil {
+		t.Fatalf("SelectProfile failed: %v", err)
+	}
+	if len(staging.Users) != 2 || len(staging.Users[1].Groups) != 1 || len(staging.Groups) != 2 {
+		t.Errorf("Unexpected staging selection: %+v", staging)
+	}
+
+	unselected, err := manager.SelectProfile(config, "")
+	if err != nil {
+		t.Fatalf("SelectProfile failed: %v", err)
+	}
+	if len(unselected.Users) != 1 || len(unselected.Groups) != 1 {
+		t.Errorf("Expected only entities without a selector, got %+v", unselected)
+	}
+
+	if _, err := manager.SelectProfile(config, "prd"); err == nil {
+		t.Error("Expected an error for a profile that matches no clusters")
+	}
+
+	// The original configuration is left untouched
+	if len(config.Users) != 3 || len(config.Groups) != 2 {
+		t.Errorf("SelectProfile modified the configuration: %+v", config)
+	}
+}
+
+func TestValidateProfiles(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewManager(logger)
+	config := newProfileTestConfig()
+
+	// analyst is declared once per cluster, which is not a duplicate
+	if err := manager.ValidateProfiles(config, ""); err != nil {
+		t.Errorf("Expected configuration to be valid, got: %v", err)
+	}
+
+	config.Users = append(config.Users, structs.UserConfig{Username: "ANALYST", Enabled: true, Clusters: []string{"prod"}})
+	err := manager.ValidateProfiles(config, "")
+	if err == nil || !strings.Contains(err.Error(), "profile prod") {
+		t.Errorf("Expected a duplicate username in profile prod, got: %v", err)
+	}
+	if err := manager.ValidateProfiles(config, "staging"); err != nil {
+		t.Errorf("Expected staging to be valid, got: %v", err)
+	}
+}
+
+func TestValidateConfigProfileEndpoints(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewManager(logger)
+	config := newProfileTestConfig()
+	config.Profiles = map[string]structs.ProfileConfig{
+		"prod":    {Endpoints: []string{"prod-writer.example.com", "prod-reader.example.com:5432"}},
+		"staging": {Endpoints: []string{"staging.example.com:postgres"}},
+	}
+
+	err := manager.ValidateConfig(config)
+	if err == nil || !strings.Contains(err.Error(), `profile "staging": invalid endpoint`) {
+		t.Fatalf("Expected the staging endpoint to be rejected, got: %v", err)
+	}
+	if strings.Contains(err.Error(), `profile "prod"`) {
+		t.Errorf("Expected the prod endpoints to be valid, got: %v", err)
+	}
+}
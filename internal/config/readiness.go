@@ -0,0 +1,119 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+// rdsIAMRole is the role that enables IAM authentication on AWS RDS
+const rdsIAMRole = "rds_iam"
+
+// ReadinessCheck is the outcome of one check of a cluster against a configuration
+type ReadinessCheck struct {
+	Name   string
+	Ready  bool
+	Detail string
+}
+
+// CheckReadiness checks that a cluster is ready for a configuration to be synced: the
+// connected role can create roles, referenced databases exist and accept grants from it,
+// and IAM authentication is available when any user needs it
+func CheckReadiness(config *structs.Config, catalog *structs.ClusterCatalog) []ReadinessCheck {
+	var checks []ReadinessCheck
+
+	admin := ReadinessCheck{Name: "admin role", Ready: true}
+	switch {
+	case catalog.Superuser:
+		admin.Detail = fmt.Sprintf("%s is a superuser", catalog.CurrentUser)
+	case catalog.CreateRole:
+		admin.Detail = fmt.Sprintf("%s has CREATEROLE", catalog.CurrentUser)
+	default:
+		admin.Ready = false
+		admin.Detail = fmt.Sprintf("%s lacks CREATEROLE", catalog.CurrentUser)
+	}
+	checks = append(checks, admin)
+
+	existing := toSet(catalog.Databases)
+	grantable := toSet(catalog.GrantableDatabases)
+	var missing, ungrantable []string
+	for _, db := range referencedDatabases(config) {
+		switch {
+		case !existing[db]:
+			missing = append(missing, db)
+		case !grantable[db]:
+			ungrantable = append(ungrantable, db)
+		}
+	}
+
+	databases := ReadinessCheck{Name: "databases", Ready: len(missing) == 0, Detail: "all referenced databases exist"}
+	if len(missing) > 0 {
+		databases.Detail = "missing: " + strings.Join(missing, ", ")
+	}
+	checks = append(checks, databases)
+
+	grants := ReadinessCheck{Name: "database grants", Ready: len(ungrantable) == 0, Detail: fmt.Sprintf("%s can grant on all referenced databases", catalog.CurrentUser)}
+	if len(ungrantable) > 0 {
+		grants.Detail = fmt.Sprintf("%s cannot grant privileges on: %s", catalog.CurrentUser, strings.Join(ungrantable, ", "))
+	}
+	checks = append(checks, grants)
+
+	iam := ReadinessCheck{Name: "iam", Ready: true, Detail: "no users use IAM authentication"}
+	if iamUsers := countIAMUsers(config); iamUsers > 0 {
+		iam.Ready = toSet(catalog.Roles)[rdsIAMRole]
+		iam.Detail = fmt.Sprintf("%s role present for %d IAM user(s)", rdsIAMRole, iamUsers)
+		if !iam.Ready {
+			iam.Detail = fmt.Sprintf("%s role missing but %d user(s) use IAM authentication (enable IAM database authentication on the instance)", rdsIAMRole, iamUsers)
+		}
+	}
+	checks = append(checks, iam)
+
+	return checks
+}
+
+// referencedDatabases returns the sorted databases declared or referenced by users and groups
+func referencedDatabases(config *structs.Config) []string {
+	seen := toSet(config.Databases)
+	for _, user := range config.Users {
+		if user.Absent {
+			continue
+		}
+		for _, db := range user.Databases {
+			seen[db] = true
+		}
+	}
+	for _, group := range config.Groups {
+		for _, db := range group.Databases {
+			seen[db] = true
+		}
+	}
+
+	databases := make([]string, 0, len(seen))
+	for db := range seen {
+		databases = append(databases, db)
+	}
+	sort.Strings(databases)
+	return databases
+}
+
+// countIAMUsers counts the users present in the configuration that use IAM authentication
+func countIAMUsers(config *structs.Config) int {
+	count := 0
+	for i := range config.Users {
+		if !config.Users[i].Absent && config.Users[i].HasAuthMethod(structs.AuthMethodIAM) {
+			count++
+		}
+	}
+	return count
+}
+
+// toSet converts a slice of names to a set
+func toSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[value] = true
+	}
+	return set
+}
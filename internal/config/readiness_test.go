@@ -0,0 +1,63 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+func TestCheckReadiness(t *testing.T) {
+	config := &structs.Config{
+		Databases: []string{"app_db"},
+		Users: []structs.UserConfig{
+			{Username: "app_user", AuthMethod: "iam", Databases: []string{"app_db"}, Enabled: true},
+			{Username: "old_user", Databases: []string{"gone_db"}, Absent: true},
+		},
+		Groups: []structs.GroupConfig{
+			{Name: "reporting", Databases: []string{"reports_db", "missing_db"}},
+		},
+	}
+
+	catalog := &structs.ClusterCatalog{
+		Roles:              []string{"postgres"},
+		Databases:          []string{"app_db", "reports_db"},
+		CurrentUser:        "admin",
+		CreateRole:         true,
+		GrantableDatabases: []string{"app_db"},
+	}
+
+	checks := make(map[string]ReadinessCheck)
+	for _, check := range CheckReadiness(config, catalog) {
+		checks[check.Name] = check
+	}
+
+	if !checks["admin role"].Ready {
+		t.Errorf("Expected CREATEROLE to be enough, got %+v", checks["admin role"])
+	}
+	// Absent users are not provisioned, so their databases are not needed
+	if checks["databases"].Ready || checks["databases"].Detail != "missing: missing_db" {
+		t.Errorf("Unexpected databases check: %+v", checks["databases"])
+	}
+	if checks["database grants"].Ready || !strings.Contains(checks["database grants"].Detail, "reports_db") {
+		t.Errorf("Unexpected database grants check: %+v", checks["database grants"])
+	}
+	if checks["iam"].Ready {
+		t.Errorf("Expected missing rds_iam to fail the iam check, got %+v", checks["iam"])
+	}
+
+	catalog.CreateRole = false
+	catalog.Roles = append(catalog.Roles, "rds_iam")
+	for _, check := range CheckReadiness(config, catalog) {
+		switch check.Name {
+		case "admin role":
+			if check.Ready {
+				t.Errorf("Expected a role without CREATEROLE to fail, got %+v", check)
+			}
+		case "iam":
+			if !check.Ready {
+				t.Errorf("Expected rds_iam to pass the iam check, got %+v", check)
+			}
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+// rotationBackends lists the backends rotated passwords can be published to
+var rotationBackends = []string{
+	structs.RotationBackendStdout,
+	structs.RotationBackendSecretsManager,
+	structs.RotationBackendSSM,
+	structs.RotationBackendVault,
+}
+
+// Rotation returns the password rotation settings of the last loaded configuration file, or
+// nil when it has none
+func (m *Manager) Rotation() *structs.RotationConfig {
+	return m.rotation
+}
+
+// checkRotation reports unknown backends, negative maximum ages and prefixes the backend
+// cannot name a secret with
+func checkRotation(rotation *structs.RotationConfig) []string {
+	if rotation == nil {
+		return nil
+	}
+
+	var problems []string
+	if rotation.Backend != "" && !slices.Contains(rotationBackends, rotation.Backend) {
+		problems = append(problems, fmt.Sprintf("rotation: unknown backend %q (must be one of %s)", rotation.Backend, strings.Join(rotationBackends, ", ")))
+	}
+	if rotation.MaxAgeDays < 0 {
+		problems = append(problems, fmt.Sprintf("rotation: max_age_days %d must not be negative", rotation.MaxAgeDays))
+	}
+	if strings.ContainsAny(rotation.Prefix, " \t\n") {
+		problems = append(problems, fmt.Sprintf("rotation: prefix %q must not contain whitespace", rotation.Prefix))
+	}
+	// Parameter Store only accepts hierarchical names that start with a slash
+	if rotation.Backend == structs.RotationBackendSSM && strings.Contains(rotation.Prefix, "/") && !strings.HasPrefix(rotation.Prefix, "/") {
+		problems = append(problems, fmt.Sprintf("rotation: ssm prefix %q must start with / when it contains one", rotation.Prefix))
+	}
+	if rotation.Backend != structs.RotationBackendVault && (rotation.VaultAddr != "" || rotation.VaultMount != "") {
+		problems = append(problems, "rotation: vault_addr and vault_mount only apply to the vault backend")
+	}
+	return problems
+}
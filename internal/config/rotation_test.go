@@ -0,0 +1,44 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+func TestValidateConfigRotation(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewManager(logger)
+
+	valid := []*structs.RotationConfig{
+		{MaxAgeDays: 90},
+		{Backend: structs.RotationBackendSecretsManager, Prefix: "prod/postgres/", KMSKeyID: "alias/postgres"},
+		{Backend: structs.RotationBackendSSM, Prefix: "/prod/postgres/"},
+		{Backend: structs.RotationBackendVault, VaultAddr: "https://vault.example.com:8200", VaultMount: "kv"},
+	}
+	for _, rotation := range valid {
+		if err := manager.ValidateConfig(&structs.Config{Rotation: rotation}); err != nil {
+			t.Errorf("Expected %+v to be valid, got %v", rotation, err)
+		}
+	}
+
+	tests := []struct {
+		rotation *structs.RotationConfig
+		expected string
+	}{
+		{&structs.RotationConfig{Backend: "keychain"}, `rotation: unknown backend "keychain"`},
+		{&structs.RotationConfig{MaxAgeDays: -1}, "rotation: max_age_days -1 must not be negative"},
+		{&structs.RotationConfig{Prefix: "prod postgres/"}, "must not contain whitespace"},
+		{&structs.RotationConfig{Backend: structs.RotationBackendSSM, Prefix: "prod/postgres/"}, `ssm prefix "prod/postgres/" must start with /`},
+		{&structs.RotationConfig{VaultAddr: "https://vault.example.com:8200"}, "only apply to the vault backend"},
+	}
+	for _, tt := range tests {
+		err := manager.ValidateConfig(&structs.Config{Rotation: tt.rotation})
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("Expected %q for %+v, got %v", tt.expected, tt.rotation, err)
+		}
+	}
+}
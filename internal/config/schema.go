@@ -0,0 +1,257 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+// SchemaID identifies the JSON Schema of the configuration file
+const SchemaID = "https://github.com/ben-vaughan-nttd/postgres-user-manager/config.schema.json"
+
+var (
+	configType = reflect.TypeOf(structs.Config{})
+	timeType   = reflect.TypeOf(time.Time{})
+)
+
+// Schema returns the JSON Schema of the configuration file, derived from the configuration
+// structs so it always matches what is decoded. Editors and CI linters can check files with
+// it; validate checks them the same way.
+func Schema() map[string]interface{} {
+	schema := typeSchema(configType)
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["$id"] = SchemaID
+	schema["title"] = "postgres-user-manager configuration"
+	return schema
+}
+
+// ValidateSchema reports the fields of the last loaded configuration file that are not part
+// of the configuration. Loading fails on values of the wrong type but only warns about
+// unknown fields, which are usually misspelt and would otherwise be silently ignored.
+func (m *Manager) ValidateSchema() error {
+	if len(m.schemaProblems) > 0 {
+		return &ValidationError{Problems: m.schemaProblems}
+	}
+	return nil
+}
+
+// typeSchema returns the schema of the values a Go type is decoded from
+func typeSchema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		properties := make(map[string]interface{})
+		for _, field := range jsonFields(t) {
+			properties[field.name] = typeSchema(field.typ)
+		}
+		return map[string]interface{}{"type": "object", "properties": properties, "additionalProperties": false}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	}
+	return map[string]interface{}{}
+}
+
+// jsonField is a struct field as it appears in the configuration file
+type jsonField struct {
+	name string
+	typ  reflect.Type
+}
+
+// jsonFields returns the fields of a struct that are decoded from JSON, by their JSON names
+func jsonFields(t reflect.Type) []jsonField {
+	var fields []jsonField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, jsonField{name: name, typ: field.Type})
+	}
+	return fields
+}
+
+// checkSchema reports every field of a configuration document that is not part of the
+// configuration and every value of the wrong type, with its path. Decoding ignores unknown
+// fields, so a misspelt field is silently lost, and stops at the first wrong type.
+func checkSchema(data []byte, format string) ([]string, error) {
+	data, err := documentJSON(data, format)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return nil, err
+	}
+
+	var problems []string
+	checkValue(document, configType, "", &problems)
+	return problems, nil
+}
+
+// checkValue checks a decoded JSON value against the Go type it is decoded into. Null is
+// accepted anywhere, as decoding leaves the zero value.
+func checkValue(value interface{}, t reflect.Type, path string, problems *[]string) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if value == nil {
+		return
+	}
+
+	mismatch := func(expected string) {
+		*problems = append(*problems, fmt.Sprintf("%s: expected %s, got %s", schemaPath(path), expected, jsonKind(value)))
+	}
+
+	if t == timeType {
+		text, ok := value.(string)
+		if !ok {
+			mismatch("a date-time string")
+		} else if _, err := time.Parse(time.RFC3339, text); err != nil {
+			*problems = append(*problems, fmt.Sprintf("%s: %q is not an RFC 3339 date-time, e.g. 2025-01-31T00:00:00Z", schemaPath(path), text))
+		}
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			mismatch("an object")
+			return
+		}
+		fields := make(map[string]reflect.Type)
+		for _, field := range jsonFields(t) {
+			fields[field.name] = field.typ
+		}
+		for _, key := range sortedKeys(object) {
+			typ, known := fields[key]
+			if !known {
+				// Decoding matches field names case-insensitively
+				for name, candidate := range fields {
+					if strings.EqualFold(name, key) {
+						typ, known = candidate, true
+						break
+					}
+				}
+			}
+			if !known {
+				*problems = append(*problems, fmt.Sprintf("%s: unknown field %q", schemaPath(path), key))
+				continue
+			}
+			checkValue(object[key], typ, joinPath(path, key), problems)
+		}
+	case reflect.Slice, reflect.Array:
+		array, ok := value.([]interface{})
+		if !ok {
+			mismatch("an array")
+			return
+		}
+		for i, element := range array {
+			checkValue(element, t.Elem(), fmt.Sprintf("%s[%d]", path, i), problems)
+		}
+	case reflect.Map:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			mismatch("an object")
+			return
+		}
+		for _, key := range sortedKeys(object) {
+			checkValue(object[key], t.Elem(), joinPath(path, key), problems)
+		}
+	case reflect.String:
+		if _, ok := value.(string); !ok {
+			mismatch("a string")
+		}
+	case reflect.Bool:
+		if _, ok := value.(bool); !ok {
+			mismatch("a boolean")
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if number, ok := value.(json.Number); !ok {
+			mismatch("an integer")
+		} else if _, err := number.Int64(); err != nil {
+			mismatch("an integer")
+		}
+	case reflect.Float32, reflect.Float64:
+		if _, ok := value.(json.Number); !ok {
+			mismatch("a number")
+		}
+	}
+}
+
+// jsonKind describes the JSON type of a decoded value for problem messages
+func jsonKind(value interface{}) string {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		return "an object"
+	case []interface{}:
+		return "an array"
+	case string:
+		return "a string"
+	case bool:
+		return "a boolean"
+	case json.Number:
+		return "the number " + value.String()
+	}
+	return "null"
+}
+
+// joinPath appends an object key to a path
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// schemaPath returns the path of a value for problem messages, naming the root document
+func schemaPath(path string) string {
+	if path == "" {
+		return "configuration"
+	}
+	return path
+}
+
+// sortedKeys returns the keys of an object in order, so problems are reported in a stable order
+func sortedKeys(object map[string]interface{}) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
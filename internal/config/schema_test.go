@@ -0,0 +1,151 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestCheckSchema(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		format string
+		want   []string
+	}{
+		{
+			name:   "valid configuration",
+			data:   `{"users": [{"username": "app_user", "connection_limit": 5, "valid_until": "2030-01-31T00:00:00Z"}], "databases": ["app"]}`,
+			format: FormatJSON,
+		},
+		{
+			name:   "null values",
+			data:   `{"users": [{"username": "app_user", "groups": null}], "databases": null}`,
+			format: FormatJSON,
+		},
+		{
+			name:   "field names match case-insensitively",
+			data:   `{"Users": [{"UserName": "app_user"}]}`,
+			format: FormatJSON,
+		},
+		{
+			name:   "unknown fields",
+			data:   `{"user": [], "users": [{"username": "app_user", "can_loginn": true}]}`,
+			format: FormatJSON,
+			want: []string{
+				`configuration: unknown field "user"`,
+				`users[0]: unknown field "can_loginn"`,
+			},
+		},
+		{
+			name:   "wrong types",
+			data:   `{"users": [{"username": 5, "connection_limit": "5", "groups": "readers", "enabled": "yes"}]}`,
+			format: FormatJSON,
+			want: []string{
+				`users[0].connection_limit: expected an integer, got a string`,
+				`users[0].enabled: expected a boolean, got a string`,
+				`users[0].groups: expected an array, got a string`,
+				`users[0].username: expected a string, got the number 5`,
+			},
+		},
+		{
+			name:   "fractional integer",
+			data:   `{"users": [{"username": "app_user", "connection_limit": 1.5}]}`,
+			format: FormatJSON,
+			want:   []string{`users[0].connection_limit: expected an integer, got the number 1.5`},
+		},
+		{
+			name:   "invalid date-time",
+			data:   `{"users": [{"username": "app_user", "valid_until": "31/01/2030"}]}`,
+			format: FormatJSON,
+			want:   []string{`users[0].valid_until: "31/01/2030" is not an RFC 3339 date-time, e.g. 2025-01-31T00:00:00Z`},
+		},
+		{
+			name:   "yaml",
+			data:   "users:\n  - username: app_user\n    conection_limit: 5\n",
+			format: FormatYAML,
+			want:   []string{`users[0]: unknown field "conection_limit"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems, err := checkSchema([]byte(tt.data), tt.format)
+			if err != nil {
+				t.Fatalf("checkSchema failed: %v", err)
+			}
+			if !reflect.DeepEqual(problems, tt.want) {
+				t.Errorf("Expected problems %q, got %q", tt.want, problems)
+			}
+		})
+	}
+}
+
+func TestSchema(t *testing.T) {
+	schema := Schema()
+
+	if schema["$id"] != SchemaID || schema["additionalProperties"] != false {
+		t.Errorf("Unexpected schema root: %v", schema)
+	}
+
+	properties := schema["properties"].(map[string]interface{})
+	users, ok := properties["users"].(map[string]interface{})
+	if !ok || users["type"] != "array" {
+		t.Fatalf("Expected users to be an array, got %v", properties["users"])
+	}
+
+	user := users["items"].(map[string]interface{})["properties"].(map[string]interface{})
+	if limit := user["connection_limit"].(map[string]interface{}); limit["type"] != "integer" {
+		t.Errorf("Expected connection_limit to be an integer, got %v", limit)
+	}
+	if validUntil := user["valid_until"].(map[string]interface{}); validUntil["format"] != "date-time" {
+		t.Errorf("Expected valid_until to be a date-time, got %v", validUntil)
+	}
+}
+
+func TestLoadConfigSchemaProblems(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	manager := NewManager(logger)
+	dir := t.TempDir()
+
+	// Unknown fields are ignored when loading, but reported by ValidateSchema
+	path := filepath.Join(dir, "unknown.json")
+	if err := os.WriteFile(path, []byte(`{"users": [{"username": "app_user", "can_loginn": true}]}`), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	if _, err := manager.LoadConfig(path); err != nil {
+		t.Fatalf("Expected unknown fields to load, got %v", err)
+	}
+	var validationErr *ValidationError
+	if err := manager.ValidateSchema(); !errors.As(err, &validationErr) || len(validationErr.Problems) != 1 {
+		t.Errorf("Expected one schema problem, got %v", err)
+	}
+
+	// Values of the wrong type fail the load, with every problem reported
+	path = filepath.Join(dir, "types.json")
+	if err := os.WriteFile(path, []byte(`{"users": [{"username": 1, "connection_limit": "5"}]}`), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	_, err := manager.LoadConfig(path)
+	if !errors.As(err, &validationErr) || len(validationErr.Problems) != 2 {
+		t.Errorf("Expected a ValidationError with two problems, got %v", err)
+	}
+
+	// A valid file clears the problems of the previous one
+	path = filepath.Join(dir, "valid.json")
+	if err := os.WriteFile(path, []byte(`{"users": [{"username": "app_user"}]}`), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	if _, err := manager.LoadConfig(path); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if err := manager.ValidateSchema(); err != nil {
+		t.Errorf("Expected no schema problems, got %v", err)
+	}
+}
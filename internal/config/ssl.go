@@ -0,0 +1,127 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+const (
+	// DefaultPasswordSSLMode is the sslmode of password connections when nothing sets one
+	DefaultPasswordSSLMode = "require"
+	// DefaultIAMSSLMode is the sslmode of IAM connections when nothing sets one; RDS rejects
+	// IAM tokens sent over unencrypted connections
+	DefaultIAMSSLMode = "require"
+)
+
+// Sources of the effective SSL mode, in order of precedence
+const (
+	SSLModeSourceProfile = "profile"
+	SSLModeSourceEnv     = "env"
+	SSLModeSourceConfig  = "config"
+	SSLModeSourceDefault = "default"
+)
+
+// sslModes lists the sslmode values libpq accepts, weakest first
+var sslModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+// effectiveSSLMode returns the SSL mode of a connection using the authentication method and
+// where it came from. The selected profile takes precedence over POSTGRES_SSLMODE, as it does
+// for the host, followed by the configuration's defaults and the built-in defaults.
+func (m *Manager) effectiveSSLMode(iamAuth bool) (string, string) {
+	if m.profile != nil {
+		if mode := m.profile.SSLMode.For(iamAuth); mode != "" {
+			return mode, SSLModeSourceProfile
+		}
+	}
+	if mode := os.Getenv("POSTGRES_SSLMODE"); mode != "" {
+		return mode, SSLModeSourceEnv
+	}
+	if mode := m.sslMode.For(iamAuth); mode != "" {
+		return mode, SSLModeSourceConfig
+	}
+	if iamAuth {
+		return DefaultIAMSSLMode, SSLModeSourceDefault
+	}
+	return DefaultPasswordSSLMode, SSLModeSourceDefault
+}
+
+// sslCertificates sets the certificate files of a connection. Each file of the selected
+// profile takes precedence over its POSTGRES_SSLROOTCERT, POSTGRES_SSLCERT or POSTGRES_SSLKEY
+// variable, which takes precedence over the configuration's ssl_certificates.
+func (m *Manager) sslCertificates(conn *structs.DatabaseConnection) {
+	sources := []*structs.SSLCertificatesConfig{m.sslCerts, {
+		RootCert: os.Getenv("POSTGRES_SSLROOTCERT"),
+		Cert:     os.Getenv("POSTGRES_SSLCERT"),
+		Key:      os.Getenv("POSTGRES_SSLKEY"),
+	}}
+	if m.profile != nil {
+		sources = append(sources, m.profile.SSLCertificates)
+	}
+
+	for _, certs := range sources {
+		if certs == nil {
+			continue
+		}
+		if certs.RootCert != "" {
+			conn.SSLRootCert = certs.RootCert
+		}
+		if certs.Cert != "" {
+			conn.SSLCert = certs.Cert
+		}
+		if certs.Key != "" {
+			conn.SSLKey = certs.Key
+		}
+	}
+}
+
+// checkSSLModes reports SSL modes in the configuration and its profiles that libpq does not
+// accept, and client certificates configured without their keys
+func checkSSLModes(config *structs.Config) []string {
+	problems := checkSSLMode("ssl_mode", config.SSLMode)
+
+	names := make([]string, 0, len(config.Profiles))
+	for name := range config.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		problems = append(problems, checkSSLMode(fmt.Sprintf("profile %q ssl_mode", name), config.Profiles[name].SSLMode)...)
+		problems = append(problems, checkSSLCertificates(fmt.Sprintf("profile %q ssl_certificates", name), config.Profiles[name].SSLCertificates)...)
+	}
+	return append(problems, checkSSLCertificates("ssl_certificates", config.SSLCertificates)...)
+}
+
+// checkSSLCertificates reports a client certificate without its key, or a key without its
+// certificate, in one ssl_certificates section
+func checkSSLCertificates(entity string, certs *structs.SSLCertificatesConfig) []string {
+	if certs == nil || (certs.Cert == "") == (certs.Key == "") {
+		return nil
+	}
+	if certs.Cert == "" {
+		return []string{fmt.Sprintf("%s: key is set without cert", entity)}
+	}
+	return []string{fmt.Sprintf("%s: cert is set without key", entity)}
+}
+
+// checkSSLMode reports the SSL modes of one ssl_mode section that libpq does not accept
+func checkSSLMode(entity string, modes *structs.SSLModeConfig) []string {
+	if modes == nil {
+		return nil
+	}
+
+	var problems []string
+	for _, field := range []struct{ name, mode string }{{"password", modes.Password}, {"iam", modes.IAM}} {
+		if field.mode != "" && !slices.Contains(sslModes, field.mode) {
+			problems = append(problems, fmt.Sprintf("%s: unknown %s SSL mode %q (must be one of %s)", entity, field.name, field.mode, strings.Join(sslModes, ", ")))
+		}
+	}
+	if modes.IAM == "disable" {
+		problems = append(problems, fmt.Sprintf("%s: IAM authentication requires SSL, iam cannot be \"disable\"", entity))
+	}
+	return problems
+}
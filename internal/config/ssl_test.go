@@ -0,0 +1,139 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+func TestEffectiveSSLMode(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	t.Setenv("POSTGRES_PASSWORD", "test_password")
+	t.Setenv("POSTGRES_SSLMODE", "")
+
+	manager := NewManager(logger)
+	conn, err := manager.GetDatabaseConnection()
+	if err != nil {
+		t.Fatalf("Failed to get database connection: %v", err)
+	}
+	if conn.SSLMode != DefaultPasswordSSLMode || conn.SSLModeSource != SSLModeSourceDefault {
+		t.Errorf("Expected the built-in default, got %s from %s", conn.SSLMode, conn.SSLModeSource)
+	}
+
+	config := &structs.Config{
+		SSLMode: &structs.SSLModeConfig{Password: "verify-full", IAM: "verify-ca"},
+		Profiles: map[string]structs.ProfileConfig{
+			"prod": {SSLMode: &structs.SSLModeConfig{IAM: "verify-full"}},
+		},
+	}
+	manager.sslMode = config.SSLMode
+
+	tests := []struct {
+		name     string
+		env      string
+		iamAuth  bool
+		profile  string
+		expected string
+		source   string
+	}{
+		{name: "config password default", expected: "verify-full", source: SSLModeSourceConfig},
+		{name: "config iam default", iamAuth: true, expected: "verify-ca", source: SSLModeSourceConfig},
+		{name: "environment overrides config", env: "prefer", expected: "prefer", source: SSLModeSourceEnv},
+		{name: "profile overrides environment", env: "prefer", iamAuth: true, profile: "prod", expected: "verify-full", source: SSLModeSourceProfile},
+		{name: "profile without the method falls back", iamAuth: false, profile: "prod", expected: "verify-full", source: SSLModeSourceConfig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("POSTGRES_SSLMODE", tt.env)
+			if _, err := manager.SelectProfile(config, tt.profile); err != nil {
+				t.Fatalf("SelectProfile failed: %v", err)
+			}
+			mode, source := manager.effectiveSSLMode(tt.iamAuth)
+			if mode != tt.expected || source != tt.source {
+				t.Errorf("Expected %s from %s, got %s from %s", tt.expected, tt.source, mode, source)
+			}
+		})
+	}
+}
+
+func TestValidateConfigSSLModes(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewManager(logger)
+
+	config := &structs.Config{
+		SSLMode: &structs.SSLModeConfig{Password: "required"},
+		Profiles: map[string]structs.ProfileConfig{
+			"prod": {SSLMode: &structs.SSLModeConfig{Password: "verify-full", IAM: "disable"}},
+		},
+	}
+
+	err := manager.ValidateConfig(config)
+	if err == nil {
+		t.Fatal("Expected invalid SSL modes to be rejected")
+	}
+	for _, expected := range []string{`unknown password SSL mode "required"`, `profile "prod" ssl_mode: IAM authentication requires SSL`} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected %q in %v", expected, err)
+		}
+	}
+	if problems := err.(*ValidationError).Problems; len(problems) != 2 {
+		t.Errorf("Expected 2 problems, got %v", problems)
+	}
+}
+
+func TestSSLCertificates(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	t.Setenv("POSTGRES_PASSWORD", "test_password")
+	t.Setenv("POSTGRES_SSLROOTCERT", "/env/root.pem")
+	t.Setenv("POSTGRES_SSLCERT", "")
+	t.Setenv("POSTGRES_SSLKEY", "")
+
+	manager := NewManager(logger)
+	manager.SetConfig(&structs.Config{SSLCertificates: &structs.SSLCertificatesConfig{RootCert: "/config/root.pem", Cert: "/config/admin.crt", Key: "/config/admin.key"}})
+
+	// The environment overrides the configuration one file at a time
+	conn, err := manager.GetDatabaseConnection()
+	if err != nil {
+		t.Fatalf("Failed to get database connection: %v", err)
+	}
+	if conn.SSLRootCert != "/env/root.pem" || conn.SSLCert != "/config/admin.crt" || conn.SSLKey != "/config/admin.key" {
+		t.Errorf("Unexpected certificates %q, %q and %q", conn.SSLRootCert, conn.SSLCert, conn.SSLKey)
+	}
+
+	manager.profile = &structs.ProfileConfig{SSLCertificates: &structs.SSLCertificatesConfig{RootCert: structs.SSLRootCertRDS}}
+	if conn, err = manager.GetDatabaseConnection(); err != nil {
+		t.Fatalf("Failed to get database connection: %v", err)
+	}
+	if conn.SSLRootCert != structs.SSLRootCertRDS {
+		t.Errorf("Expected the profile's root certificate, got %q", conn.SSLRootCert)
+	}
+}
+
+func TestValidateConfigSSLCertificates(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewManager(logger)
+
+	config := &structs.Config{
+		SSLCertificates: &structs.SSLCertificatesConfig{RootCert: structs.SSLRootCertRDS, Cert: "/certs/admin.crt"},
+		Profiles: map[string]structs.ProfileConfig{
+			"prod": {SSLCertificates: &structs.SSLCertificatesConfig{Key: "/certs/prod.key"}},
+		},
+	}
+
+	err := manager.ValidateConfig(config)
+	if err == nil {
+		t.Fatal("Expected certificates without keys to be rejected")
+	}
+	for _, expected := range []string{"ssl_certificates: cert is set without key", `profile "prod" ssl_certificates: key is set without cert`} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected %q in %v", expected, err)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+// TemplateData is the data available to templated configuration values
+type TemplateData struct {
+	Cluster string            // Selected profile
+	Env     string            // Environment of the profile (default: the profile name)
+	Vars    map[string]string // Additional profile variables
+}
+
+// profileTemplateData returns the template data for a profile from the profile metadata
+func profileTemplateData(config *structs.Config, profile string) TemplateData {
+	data := TemplateData{Cluster: profile, Env: profile, Vars: map[string]string{}}
+	if meta, ok := config.Profiles[profile]; ok {
+		if meta.Env != "" {
+			data.Env = meta.Env
+		}
+		for name, value := range meta.Vars {
+			data.Vars[name] = value
+		}
+	}
+	return data
+}
+
+// renderProfile renders the templated values of a selected configuration in place. Nested
+// slices are replaced rather than modified, so the configuration the selection was taken
+// from keeps its templates. Policy names and expressions are left for policy rendering
+func renderProfile(config *structs.Config, profile string) error {
+	data := profileTemplateData(config, profile)
+
+	render := func(entity string, fields []*string, lists ...*[]string) error {
+		for _, field := range fields {
+			value, err := renderValue(*field, profile, data)
+			if err != nil {
+				return fmt.Errorf("%s: %w", entity, err)
+			}
+			*field = value
+		}
+		for _, list := range lists {
+			values, err := renderValues(*list, profile, data)
+			if err != nil {
+				return fmt.Errorf("%s: %w", entity, err)
+			}
+			*list = values
+		}
+		return nil
+	}
+
+	if err := render("databases", nil, &config.Databases); err != nil {
+		return err
+	}
+
+	for i := range config.Users {
+		user := &config.Users[i]
+		entity := fmt.Sprintf("user %q", user.Username)
+		fields := []*string{&user.Username, &user.Password, &user.Description, &user.IAMRole, &user.CertCommonName, &user.CertSubjectDN}
+		if err := render(entity, fields, &user.Groups, &user.Databases); err != nil {
+			return err
+		}
+		if user.Metadata != nil {
+			metadata := make(map[string]string, len(user.Metadata))
+			for name, value := range user.Metadata {
+				rendered, err := renderValue(value, profile, data)
+				if err != nil {
+					return fmt.Errorf("%s: %w", entity, err)
+				}
+				metadata[name] = rendered
+			}
+			user.Metadata = metadata
+		}
+	}
+
+	for i := range config.Groups {
+		group := &config.Groups[i]
+		entity := fmt.Sprintf("group %q", group.Name)
+		fields := []*string{&group.Name, &group.Description}
+		if err := render(entity, fields, &group.Databases, &group.MemberOf); err != nil {
+			return err
+		}
+	}
+
+	policies := make([]structs.PolicyConfig, len(config.Policies))
+	copy(policies, config.Policies)
+	config.Policies = policies
+	for i := range config.Policies {
+		policy := &config.Policies[i]
+		entity := fmt.Sprintf("policy %q", policy.Name)
+		if err := render(entity, []*string{&policy.Table}, &policy.Roles); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// renderValues renders each templated value of a list into a new slice
+func renderValues(values []string, profile string, data TemplateData) ([]string, error) {
+	if values == nil {
+		return nil, nil
+	}
+
+	rendered := make([]string, len(values))
+	for i, value := range values {
+		var err error
+		if rendered[i], err = renderValue(value, profile, data); err != nil {
+			return nil, err
+		}
+	}
+	return rendered, nil
+}
+
+// renderValue renders a Go text/template configuration value with the profile data
+func renderValue(text, profile string, data TemplateData) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+	if profile == "" {
+		return "", fmt.Errorf("templated value %q requires --profile", text)
+	}
+
+	tmpl, err := template.New("config").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse template %q: %w", text, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render template %q: %w", text, err)
+	}
+
+	return buf.String(), nil
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+func TestSelectProfileRendersTemplates(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewManager(logger)
+
+	config := &structs.Config{
+		Databases: []string{"app_{{ .Env }}"},
+		Profiles: map[string]structs.ProfileConfig{
+			"prod":    {Env: "production", Vars: map[string]string{"account": "111111111111"}},
+			"staging": {Vars: map[string]string{"account": "222222222222"}},
+			"dev":     {},
+		},
+		Users: []structs.UserConfig{
+			{
+				Username:  "app_user",
+				Databases: []string{"app_{{ .Env }}"},
+				IAMRole:   "arn:aws:iam::{{ .Vars.account }}:role/app",
+				Enabled:   true,
+			},
+		},
+		Groups: []structs.GroupConfig{
+			{Name: "readers_{{ .Cluster }}", Databases: []string{"app_{{ .Env }}"}},
+		},
+		Policies: []structs.PolicyConfig{
+			{Name: "{{ .Role }}_rows", Table: "orders", Roles: []string{"readers_{{ .Cluster }}"}, Using: "owner = '{{ .Role }}'"},
+		},
+	}
+
+	prod, err := manager.SelectProfile(config, "prod")
+	if err != nil {
+		t.Fatalf("SelectProfile failed: %v", err)
+	}
+
+	if prod.Databases[0] != "app_production" || prod.Users[0].Databases[0] != "app_production" {
+		t.Errorf("Expected databases rendered with the profile env, got %v and %v", prod.Databases, prod.Users[0].Databases)
+	}
+	if prod.Users[0].IAMRole != "arn:aws:iam::111111111111:role/app" {
+		t.Errorf("Unexpected IAM role: %s", prod.Users[0].IAMRole)
+	}
+	if prod.Groups[0].Name != "readers_prod" || prod.Policies[0].Roles[0] != "readers_prod" {
+		t.Errorf("Expected names rendered with the cluster, got %s and %v", prod.Groups[0].Name, prod.Policies[0].Roles)
+	}
+	// Policy templates are rendered per role at sync time
+	if prod.Policies[0].Name != "{{ .Role }}_rows" || prod.Policies[0].Using != "owner = '{{ .Role }}'" {
+		t.Errorf("Expected policy templates to be left alone, got %+v", prod.Policies[0])
+	}
+
+	// The env defaults to the profile name
+	staging, err := manager.SelectProfile(config, "staging")
+	if err != nil {
+		t.Fatalf("SelectProfile failed: %v", err)
+	}
+	if staging.Databases[0] != "app_staging" {
+		t.Errorf("Expected app_staging, got %s", staging.Databases[0])
+	}
+
+	// Missing variables are reported rather than rendered empty
+	if _, err := manager.SelectProfile(config, "dev"); err == nil || !strings.Contains(err.Error(), "account") {
+		t.Errorf("Expected an error for the missing account variable, got: %v", err)
+	}
+
+	// The loaded configuration keeps its templates
+	if config.Users[0].Databases[0] != "app_{{ .Env }}" || config.Policies[0].Roles[0] != "readers_{{ .Cluster }}" {
+		t.Errorf("SelectProfile modified the configuration: %+v", config)
+	}
+
+	if _, err := manager.SelectProfile(config, ""); err == nil || !strings.Contains(err.Error(), "requires --profile") {
+		t.Errorf("Expected templated values to require a profile, got: %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+// usernamePrefixPattern matches prefixes that make a name start with a letter on their own
+var usernamePrefixPattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// UsernameRules returns the username rules of the last loaded configuration file, or nil
+// when it has none
+func (m *Manager) UsernameRules() *structs.UsernameRulesConfig {
+	return m.usernameRules
+}
+
+// checkUsernameRules reports replacements without a pattern or whose pattern does not
+// compile, prefixes that would not make a name valid and lengths PostgreSQL cannot keep
+func checkUsernameRules(rules *structs.UsernameRulesConfig) []string {
+	if rules == nil {
+		return nil
+	}
+
+	var problems []string
+
+	for _, replacement := range rules.Replacements {
+		if replacement.Pattern == "" {
+			problems = append(problems, "username replacement without a pattern")
+			continue
+		}
+		if _, err := regexp.Compile(replacement.Pattern); err != nil {
+			problems = append(problems, fmt.Sprintf("username replacement %q: invalid pattern: %v", replacement.Pattern, err))
+		}
+	}
+
+	if rules.Prefix != "" {
+		if !usernamePrefixPattern.MatchString(rules.Prefix) {
+			problems = append(problems, fmt.Sprintf("username prefix %q must start with a lower-case letter and contain only lower-case letters, digits and underscores", rules.Prefix))
+		} else if strings.HasPrefix(rules.Prefix, "pg_") {
+			problems = append(problems, fmt.Sprintf("username prefix %q: role names starting with pg_ are reserved", rules.Prefix))
+		}
+	}
+
+	// Shortened names keep an underscore and eight hex digits of a hash
+	if rules.MaxLength != 0 && (rules.MaxLength < 10 || rules.MaxLength > 63) {
+		problems = append(problems, fmt.Sprintf("username max_length %d must be between 10 and 63", rules.MaxLength))
+	}
+
+	return problems
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+func TestValidateConfigUsernameRules(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewManager(logger)
+
+	config := &structs.Config{
+		UsernameRules: &structs.UsernameRulesConfig{
+			Replacements: []structs.UsernameReplacement{{Pattern: ""}, {Pattern: "corp-("}},
+			Prefix:       "pg_user_",
+			MaxLength:    64,
+		},
+	}
+
+	err := manager.ValidateConfig(config)
+	if err == nil {
+		t.Fatal("Expected invalid username rules to be rejected")
+	}
+	for _, expected := range []string{
+		"username replacement without a pattern",
+		`username replacement "corp-(": invalid pattern`,
+		`username prefix "pg_user_": role names starting with pg_ are reserved`,
+		"username max_length 64 must be between 10 and 63",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected %q in %v", expected, err)
+		}
+	}
+	if problems := err.(*ValidationError).Problems; len(problems) != 4 {
+		t.Errorf("Expected 4 problems, got %v", problems)
+	}
+
+	config.UsernameRules = &structs.UsernameRulesConfig{
+		Replacements: []structs.UsernameReplacement{{Pattern: `^corp-`, Replace: ""}},
+		Prefix:       "idp_",
+		MaxLength:    40,
+	}
+	if err := manager.ValidateConfig(config); err != nil {
+		t.Errorf("Expected valid username rules, got %v", err)
+	}
+}
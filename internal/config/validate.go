@@ -0,0 +1,682 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/secrets"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+// databasePrivileges lists the privileges that can be granted ON DATABASE
+var databasePrivileges = map[string]bool{
+	"CONNECT":        true,
+	"CREATE":         true,
+	"TEMPORARY":      true,
+	"TEMP":           true,
+	"ALL":            true,
+	"ALL PRIVILEGES": true,
+}
+
+// schemaPrivileges lists the privileges that can be granted ON SCHEMA
+var schemaPrivileges = map[string]bool{
+	"USAGE":  true,
+	"CREATE": true,
+	"ALL":    true,
+}
+
+// largeObjectPrivileges lists the privileges that can be granted ON LARGE OBJECT
+var largeObjectPrivileges = map[string]bool{
+	"SELECT": true,
+	"UPDATE": true,
+	"ALL":    true,
+}
+
+// authMethods lists the supported user authentication methods
+var authMethods = map[string]bool{
+	structs.AuthMethodPassword: true,
+	structs.AuthMethodIAM:      true,
+	structs.AuthMethodCert:     true,
+}
+
+// ValidationError collects every problem found in a configuration
+type ValidationError struct {
+	Problems []string
+}
+
+// Error implements the error interface
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("configuration has %d problem(s):\n  - %s", len(e.Problems), strings.Join(e.Problems, "\n  - "))
+}
+
+// JoinValidationErrors combines validation errors into one that reports all of their
+// problems. Nil errors are skipped and any other error is returned as it is.
+func JoinValidationErrors(errs ...error) error {
+	var problems []string
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+		var validationErr *ValidationError
+		if !errors.As(err, &validationErr) {
+			return err
+		}
+		problems = append(problems, validationErr.Problems...)
+	}
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// ValidateConfig checks a configuration for problems that would make sync behave
+// unexpectedly, reporting all of them at once
+func (m *Manager) ValidateConfig(config *structs.Config) error {
+	problems := checkIdentifiers(config)
+
+	usernames := make([]string, len(config.Users))
+	for i, user := range config.Users {
+		usernames[i] = user.Username
+	}
+	problems = append(problems, checkDuplicateNames("username", usernames)...)
+
+	groupNames := make([]string, len(config.Groups))
+	for i, group := range config.Groups {
+		groupNames[i] = group.Name
+	}
+	problems = append(problems, checkDuplicateNames("group", groupNames)...)
+	problems = append(problems, checkRoleNameCollisions(usernames, groupNames)...)
+	problems = append(problems, checkPreviousNames(config.Users, append(usernames, groupNames...))...)
+
+	problems = append(problems, checkGroupCycles(config.Groups)...)
+	problems = append(problems, checkSSLModes(config)...)
+	problems = append(problems, checkProfileConnections(config)...)
+	problems = append(problems, checkConnectionConfig(config.Connection)...)
+	problems = append(problems, checkHooks(config.Hooks)...)
+	problems = append(problems, checkGroupMappings(config.GroupMappings)...)
+	problems = append(problems, checkUsernameRules(config.UsernameRules)...)
+	problems = append(problems, checkChangeLimits(config.ChangeLimits)...)
+	problems = append(problems, checkRoleRemoval(config.RoleRemoval, config.Users)...)
+	problems = append(problems, checkRotation(config.Rotation)...)
+	problems = append(problems, checkNotifications(config.Notifications)...)
+	problems = append(problems, checkGlobalDefaults(config.GlobalDefaults)...)
+	problems = append(problems, checkSchemas(config.Schemas)...)
+
+	for i := range config.Users {
+		user := &config.Users[i]
+		entity := fmt.Sprintf("user %q", user.Username)
+		problems = append(problems, checkPrivileges(entity, user.Privileges, user.Databases, user.ExtensionSchemas, user.LargeObjects)...)
+		problems = append(problems, checkAuthMethods(entity, user)...)
+		problems = append(problems, checkConnectionLimit(entity, user.ConnectionLimit)...)
+		problems = append(problems, checkTemporaryGroups(entity, user)...)
+		problems = append(problems, checkNoInherit(entity, user)...)
+		problems = append(problems, checkSettings(entity, user.Settings)...)
+		if !user.Absent {
+			problems = append(problems, checkOwnership(entity, user.Owner, user.Team, user.Ticket, config.RequireOwner)...)
+		}
+	}
+	for _, group := range config.Groups {
+		entity := fmt.Sprintf("group %q", group.Name)
+		problems = append(problems, checkPrivileges(entity, group.Privileges, group.Databases, group.ExtensionSchemas, group.LargeObjects)...)
+		problems = append(problems, checkOwnership(entity, group.Owner, group.Team, group.Ticket, config.RequireOwner)...)
+		problems = append(problems, checkSettings(entity, group.Settings)...)
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+
+	m.logger.WithFields(logrus.Fields{
+		"users":  len(config.Users),
+		"groups": len(config.Groups),
+	}).Debug("Configuration validated")
+
+	return nil
+}
+
+// checkDuplicateNames reports names that are declared more than once, comparing
+// case-insensitively because PostgreSQL folds unquoted identifiers to lower case
+func checkDuplicateNames(kind string, names []string) []string {
+	var problems []string
+	seen := make(map[string]string)
+
+	for _, name := range names {
+		key := strings.ToLower(name)
+		first, exists := seen[key]
+		if !exists {
+			seen[key] = name
+			continue
+		}
+
+		if first == name {
+			problems = append(problems, fmt.Sprintf("duplicate %s %q", kind, name))
+		} else {
+			problems = append(problems, fmt.Sprintf("duplicate %s %q conflicts with %q (PostgreSQL folds unquoted identifiers to lower case)", kind, name, first))
+		}
+	}
+
+	return problems
+}
+
+// checkRoleNameCollisions reports names declared both as a user and as a group. Both are
+// roles in PostgreSQL and share one namespace, so sync would apply the user and the group
+// settings to the same role.
+func checkRoleNameCollisions(usernames, groupNames []string) []string {
+	var problems []string
+	groups := make(map[string]string, len(groupNames))
+	for _, name := range groupNames {
+		if _, exists := groups[strings.ToLower(name)]; !exists {
+			groups[strings.ToLower(name)] = name
+		}
+	}
+
+	reported := make(map[string]bool)
+	for _, name := range usernames {
+		key := strings.ToLower(name)
+		group, exists := groups[key]
+		if !exists || reported[key] {
+			continue
+		}
+		reported[key] = true
+
+		if group == name {
+			problems = append(problems, fmt.Sprintf("user %q is also declared as a group (users and groups are both roles and share one namespace)", name))
+		} else {
+			problems = append(problems, fmt.Sprintf("user %q conflicts with group %q (users and groups are both roles and share one namespace, and PostgreSQL folds unquoted identifiers to lower case)", name, group))
+		}
+	}
+
+	return problems
+}
+
+// checkPreviousNames reports previous names of users that are empty, still declared as a
+// role or claimed by more than one user, since sync could not tell which role to rename
+func checkPreviousNames(users []structs.UserConfig, declared []string) []string {
+	var problems []string
+	roles := make(map[string]bool, len(declared))
+	for _, name := range declared {
+		roles[strings.ToLower(name)] = true
+	}
+
+	claimed := make(map[string]string)
+	for _, user := range users {
+		for _, name := range user.PreviousNames {
+			key := strings.ToLower(name)
+			switch {
+			case name == "":
+				problems = append(problems, fmt.Sprintf("user %q: empty previous name", user.Username))
+			case roles[key]:
+				problems = append(problems, fmt.Sprintf("user %q: previous name %q is still declared as a role", user.Username, name))
+			case claimed[key] != "" && claimed[key] != user.Username:
+				problems = append(problems, fmt.Sprintf("user %q: previous name %q is also a previous name of user %q", user.Username, name, claimed[key]))
+			default:
+				claimed[key] = user.Username
+			}
+		}
+	}
+
+	return problems
+}
+
+// ValidateReferences checks that every group, role and database the configuration
+// refers to is declared in the configuration or, when a catalog is given, already
+// exists in the cluster
+func (m *Manager) ValidateReferences(config *structs.Config, catalog *structs.ClusterCatalog) error {
+	var problems []string
+
+	groups := make(map[string]bool)
+	roles := make(map[string]bool)
+	for _, group := range config.Groups {
+		groups[group.Name] = true
+		roles[group.Name] = true
+	}
+	for _, user := range config.Users {
+		roles[user.Username] = true
+	}
+
+	databases := make(map[string]bool)
+	for _, db := range config.Databases {
+		databases[db] = true
+	}
+	checkDatabases := len(config.Databases) > 0
+
+	if catalog != nil {
+		for _, role := range catalog.Roles {
+			groups[role] = true
+			roles[role] = true
+		}
+		for _, db := range catalog.Databases {
+			databases[db] = true
+		}
+		checkDatabases = true
+	}
+
+	hint := "declare it in the groups section"
+	if catalog == nil {
+		hint += " or validate with --against-db to accept roles that already exist in the cluster"
+	}
+
+	for _, user := range config.Users {
+		for _, group := range user.Groups {
+			if !groups[group] {
+				problems = append(problems, fmt.Sprintf("user %q references undeclared group %q (%s)", user.Username, group, hint))
+			}
+		}
+		for _, membership := range user.TemporaryGroups {
+			if !groups[membership.Group] {
+				problems = append(problems, fmt.Sprintf("user %q has a temporary membership in undeclared group %q (%s)", user.Username, membership.Group, hint))
+			}
+		}
+	}
+
+	for _, group := range config.DefaultGroups() {
+		if !groups[group] {
+			problems = append(problems, fmt.Sprintf("global_defaults references undeclared group %q (%s)", group, hint))
+		}
+	}
+
+	for _, group := range config.Groups {
+		for _, parent := range group.MemberOf {
+			if !groups[parent] {
+				problems = append(problems, fmt.Sprintf("group %q is a member of undeclared group %q (%s)", group.Name, parent, hint))
+			}
+		}
+	}
+
+	for _, policy := range config.Policies {
+		for _, role := range policy.Roles {
+			if !roles[role] {
+				problems = append(problems, fmt.Sprintf("policy %q references undeclared role %q", policy.Name, role))
+			}
+		}
+	}
+
+	roleHint := "declare it in the users or groups section"
+	if catalog == nil {
+		roleHint += " or validate with --against-db to accept roles that already exist in the cluster"
+	}
+	for _, schema := range config.Schemas {
+		if schema.Owner != "" && !roles[schema.Owner] {
+			problems = append(problems, fmt.Sprintf("schema %q is owned by undeclared role %q (%s)", schema.Name, schema.Owner, roleHint))
+		}
+		for _, grant := range schema.Grants {
+			if grant.Role != "" && !roles[grant.Role] {
+				problems = append(problems, fmt.Sprintf("schema %q grants to undeclared role %q (%s)", schema.Name, grant.Role, roleHint))
+			}
+		}
+	}
+
+	if removal := config.RoleRemoval; removal != nil && removal.ReassignTo != "" && !roles[removal.ReassignTo] {
+		problems = append(problems, fmt.Sprintf("role_removal reassigns objects to undeclared role %q (%s)", removal.ReassignTo, roleHint))
+	}
+
+	if checkDatabases {
+		for _, user := range config.Users {
+			entity := fmt.Sprintf("user %q", user.Username)
+			problems = append(problems, checkDatabaseReferences(entity, user.Databases, databases)...)
+			problems = append(problems, checkDatabaseReferences(entity, objectGrantDatabases(user.ExtensionSchemas, user.LargeObjects), databases)...)
+		}
+		for _, group := range config.Groups {
+			entity := fmt.Sprintf("group %q", group.Name)
+			problems = append(problems, checkDatabaseReferences(entity, group.Databases, databases)...)
+			problems = append(problems, checkDatabaseReferences(entity, objectGrantDatabases(group.ExtensionSchemas, group.LargeObjects), databases)...)
+		}
+		for _, schema := range config.Schemas {
+			if schema.Database != "" {
+				problems = append(problems, checkDatabaseReferences(fmt.Sprintf("schema %q", schema.Name), []string{schema.Database}, databases)...)
+			}
+		}
+		for _, policy := range config.Policies {
+			if policy.Database != "" {
+				problems = append(problems, checkDatabaseReferences(fmt.Sprintf("policy %q", policy.Name), []string{policy.Database}, databases)...)
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+
+	return nil
+}
+
+// checkGroupCycles reports group memberships that form a cycle, which sync cannot order
+func checkGroupCycles(groups []structs.GroupConfig) []string {
+	parents := make(map[string][]string, len(groups))
+	for _, group := range groups {
+		parents[group.Name] = group.MemberOf
+	}
+
+	const (
+		visiting = iota + 1
+		done
+	)
+	state := make(map[string]int, len(groups))
+
+	var problems []string
+	var visit func(name string, path []string)
+	visit = func(name string, path []string) {
+		switch state[name] {
+		case done:
+			return
+		case visiting:
+			problems = append(problems, fmt.Sprintf("group memberships form a cycle: %s -> %s", strings.Join(path, " -> "), name))
+			return
+		}
+
+		state[name] = visiting
+		for _, parent := range parents[name] {
+			if _, declared := parents[parent]; declared {
+				visit(parent, append(path, name))
+			}
+		}
+		state[name] = done
+	}
+
+	for _, group := range groups {
+		visit(group.Name, nil)
+	}
+
+	return problems
+}
+
+// checkPrivileges reports privileges that do not apply to the object type they are granted on
+func checkPrivileges(entity string, privileges, databases []string, schemas []structs.ExtensionSchemaGrant, largeObjects []structs.LargeObjectGrant) []string {
+	var problems []string
+
+	for _, priv := range privileges {
+		if !databasePrivileges[strings.ToUpper(priv)] {
+			problems = append(problems, fmt.Sprintf("%s: %s is not a database privilege (must be CONNECT, CREATE, TEMPORARY or ALL)", entity, priv))
+		}
+	}
+	if len(privileges) > 0 && len(databases) == 0 {
+		problems = append(problems, fmt.Sprintf("%s: privileges are configured but no databases to grant them on", entity))
+	}
+
+	for _, grant := range schemas {
+		for _, priv := range grant.Privileges {
+			if !schemaPrivileges[strings.ToUpper(priv)] {
+				problems = append(problems, fmt.Sprintf("%s: %s is not a schema privilege for extension %s (must be USAGE, CREATE or ALL)", entity, priv, grant.Extension))
+			}
+		}
+		if combinesAll(grant.Privileges) {
+			problems = append(problems, fmt.Sprintf("%s: ALL is listed with other privileges for extension %s, list it on its own", entity, grant.Extension))
+		}
+	}
+
+	for _, grant := range largeObjects {
+		if len(grant.Privileges) == 0 {
+			problems = append(problems, fmt.Sprintf("%s: no privileges configured for large object %d", entity, grant.OID))
+		}
+		for _, priv := range grant.Privileges {
+			if !largeObjectPrivileges[strings.ToUpper(priv)] {
+				problems = append(problems, fmt.Sprintf("%s: %s is not a large object privilege (must be SELECT, UPDATE or ALL)", entity, priv))
+			}
+		}
+		if combinesAll(grant.Privileges) {
+			problems = append(problems, fmt.Sprintf("%s: ALL is listed with other privileges for large object %d, list it on its own", entity, grant.OID))
+		}
+	}
+
+	return problems
+}
+
+// combinesAll reports whether ALL is listed with other privileges, which it already includes
+func combinesAll(privileges []string) bool {
+	if len(privileges) < 2 {
+		return false
+	}
+	for _, priv := range privileges {
+		if upper := strings.ToUpper(strings.TrimSpace(priv)); upper == "ALL" || upper == "ALL PRIVILEGES" {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTemporaryGroups reports temporary memberships without a group or expiry, and groups
+// that are listed more than once among a user's groups and temporary groups
+func checkTemporaryGroups(entity string, user *structs.UserConfig) []string {
+	var problems []string
+
+	seen := make(map[string]bool)
+	for _, group := range user.Groups {
+		seen[strings.ToLower(group)] = true
+	}
+
+	for _, membership := range user.TemporaryGroups {
+		if membership.Group == "" {
+			problems = append(problems, fmt.Sprintf("%s: temporary group without a group name", entity))
+			continue
+		}
+		if membership.ExpiresAt.IsZero() {
+			problems = append(problems, fmt.Sprintf("%s: temporary group %s has no expires_at", entity, membership.Group))
+		}
+		if seen[strings.ToLower(membership.Group)] {
+			problems = append(problems, fmt.Sprintf("%s: group %s is listed more than once in groups and temporary_groups", entity, membership.Group))
+		}
+		seen[strings.ToLower(membership.Group)] = true
+	}
+
+	return problems
+}
+
+// checkNoInherit reports NOINHERIT users without groups to SET ROLE to, for which the
+// attribute changes nothing
+func checkNoInherit(entity string, user *structs.UserConfig) []string {
+	if !user.NoInherit || user.Absent || len(user.Groups) > 0 || len(user.TemporaryGroups) > 0 {
+		return nil
+	}
+	return []string{fmt.Sprintf("%s: no_inherit is set but the user has no groups or temporary_groups to SET ROLE to", entity)}
+}
+
+// checkChangeLimits reports negative limits and percentages above 100
+func checkChangeLimits(limits *structs.ChangeLimitsConfig) []string {
+	if limits == nil {
+		return nil
+	}
+
+	var problems []string
+	if limits.MaxRemovals < 0 {
+		problems = append(problems, fmt.Sprintf("change_limits: max_removals %d must not be negative", limits.MaxRemovals))
+	}
+	if limits.MaxRemovalPercent < 0 || limits.MaxRemovalPercent > 100 {
+		problems = append(problems, fmt.Sprintf("change_limits: max_removal_percent %g must be between 0 and 100", limits.MaxRemovalPercent))
+	}
+	return problems
+}
+
+// checkRoleRemoval reports a role removal policy that both reassigns and drops the objects of
+// dropped roles, that reassigns them to a user the same sync drops, or that has a negative
+// grace period
+func checkRoleRemoval(removal *structs.RoleRemovalConfig, users []structs.UserConfig) []string {
+	if removal == nil {
+		return nil
+	}
+
+	var problems []string
+	if removal.ReassignTo != "" && removal.Cascade {
+		problems = append(problems, "role_removal: reassign_to and cascade cannot be combined, objects are either reassigned or dropped")
+	}
+	if removal.GracePeriodSeconds < 0 {
+		problems = append(problems, fmt.Sprintf("role_removal: grace_period_seconds %d must not be negative", removal.GracePeriodSeconds))
+	}
+	for _, user := range users {
+		if user.Absent && user.Username == removal.ReassignTo {
+			problems = append(problems, fmt.Sprintf("role_removal: reassign_to %q is an absent user, objects cannot be reassigned to a role that is dropped", removal.ReassignTo))
+		}
+	}
+	return problems
+}
+
+// checkOwnership reports ownership values that would break the role comment metadata they
+// are recorded in, and roles without an owner or team when every role must have one
+func checkOwnership(entity, owner, team, ticket string, required bool) []string {
+	var problems []string
+
+	for _, field := range []struct{ name, value string }{{"owner", owner}, {"team", team}, {"ticket", ticket}} {
+		if strings.ContainsAny(field.value, ";=|\n") {
+			problems = append(problems, fmt.Sprintf("%s: %s %q must not contain ';', '=', '|' or line breaks", entity, field.name, field.value))
+		}
+	}
+	if required && owner == "" && team == "" {
+		problems = append(problems, fmt.Sprintf("%s: no owner or team (require_owner is set)", entity))
+	}
+
+	return problems
+}
+
+// checkAuthMethods reports unknown, duplicated or inconsistent authentication methods
+func checkAuthMethods(entity string, user *structs.UserConfig) []string {
+	var problems []string
+
+	if user.AuthMethod != "" && !authMethods[user.AuthMethod] {
+		problems = append(problems, fmt.Sprintf("%s: invalid auth_method %s (must be password, iam or cert)", entity, user.AuthMethod))
+	}
+
+	seen := make(map[string]bool)
+	for _, method := range user.AuthMethods {
+		if !authMethods[method] {
+			problems = append(problems, fmt.Sprintf("%s: invalid auth method %s in auth_methods (must be password, iam or cert)", entity, method))
+		}
+		if seen[method] {
+			problems = append(problems, fmt.Sprintf("%s: auth method %s is listed more than once", entity, method))
+		}
+		seen[method] = true
+	}
+
+	if user.AuthMethod != "" && len(user.AuthMethods) > 0 && !seen[user.AuthMethod] {
+		problems = append(problems, fmt.Sprintf("%s: auth_method %s is not listed in auth_methods", entity, user.AuthMethod))
+	}
+
+	// Certificate users authenticate through pg_hba.conf and never have a password
+	if user.HasAuthMethod(structs.AuthMethodCert) {
+		if len(user.EffectiveAuthMethods()) > 1 {
+			problems = append(problems, fmt.Sprintf("%s: cert authentication cannot be combined with other auth methods", entity))
+		}
+		if user.Password != "" {
+			problems = append(problems, fmt.Sprintf("%s: cert authenticated users must not have a password", entity))
+		}
+		if user.CertCommonName != "" && user.CertSubjectDN != "" {
+			problems = append(problems, fmt.Sprintf("%s: only one of cert_cn and cert_dn can be set", entity))
+		}
+	} else if user.CertCommonName != "" || user.CertSubjectDN != "" {
+		problems = append(problems, fmt.Sprintf("%s: cert_cn and cert_dn require cert authentication", entity))
+	}
+
+	// IAM users log in with tokens, so a password without a password fallback is never used
+	if user.HasAuthMethod(structs.AuthMethodIAM) && !user.HasAuthMethod(structs.AuthMethodPassword) && user.Password != "" {
+		problems = append(problems, fmt.Sprintf("%s: iam authenticated users must not have a password (list password in auth_methods for a fallback)", entity))
+	}
+
+	// Generated passwords replace a configured one and need password authentication
+	if user.GeneratePassword {
+		if user.Password != "" {
+			problems = append(problems, fmt.Sprintf("%s: password and generate_password cannot both be set", entity))
+		}
+		if !user.HasAuthMethod(structs.AuthMethodPassword) {
+			problems = append(problems, fmt.Sprintf("%s: generate_password requires password authentication", entity))
+		}
+		if err := secrets.CheckPasswordPolicy(user.PasswordLength, user.PasswordCharset); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", entity, err))
+		}
+	} else if user.PasswordLength != 0 || user.PasswordCharset != "" {
+		problems = append(problems, fmt.Sprintf("%s: password_length and password_charset require generate_password", entity))
+	}
+
+	// A password fallback for an IAM user is only useful when the password is managed
+	if len(user.AuthMethods) > 1 && user.HasAuthMethod(structs.AuthMethodIAM) &&
+		user.HasAuthMethod(structs.AuthMethodPassword) && user.Password == "" && !user.GeneratePassword {
+		problems = append(problems, fmt.Sprintf("%s: a password is required when combining iam and password authentication", entity))
+	}
+
+	return problems
+}
+
+// checkConnectionLimit reports connection limits PostgreSQL rejects. An unset limit and -1
+// both mean unlimited; anything else must be positive and fit in a 32-bit integer.
+func checkConnectionLimit(entity string, limit int) []string {
+	if limit < -1 || limit > math.MaxInt32 {
+		return []string{fmt.Sprintf("%s: connection_limit %d must be -1 (unlimited) or between 1 and %d", entity, limit, math.MaxInt32)}
+	}
+	return nil
+}
+
+// checkSchemas reports schemas without a name or declared twice, and schema grants without
+// a role or with privileges that cannot be granted on a schema
+func checkSchemas(schemas []structs.SchemaConfig) []string {
+	var problems []string
+	names := make([]string, 0, len(schemas))
+	for _, schema := range schemas {
+		entity := fmt.Sprintf("schema %q", schema.Name)
+		switch {
+		case schema.Name == "":
+			problems = append(problems, "schemas: name is required")
+			continue
+		case len(schema.Name) > structs.MaxIdentifierLength:
+			problems = append(problems, fmt.Sprintf("%s: name is %d bytes long, PostgreSQL keeps only %d", entity, len(schema.Name), structs.MaxIdentifierLength))
+		}
+		// Schemas of the same name in different databases are different schemas
+		if schema.Database != "" {
+			names = append(names, fmt.Sprintf("%s (database %s)", schema.Name, schema.Database))
+		} else {
+			names = append(names, schema.Name)
+		}
+
+		for _, grant := range schema.Grants {
+			if grant.Role == "" {
+				problems = append(problems, fmt.Sprintf("%s: grant has no role", entity))
+			}
+			for _, priv := range grant.Privileges {
+				if !schemaPrivileges[strings.ToUpper(priv)] {
+					problems = append(problems, fmt.Sprintf("%s: %s is not a schema privilege (must be USAGE, CREATE or ALL)", entity, priv))
+				}
+			}
+		}
+	}
+	return append(problems, checkDuplicateNames("schema", names)...)
+}
+
+// checkSettings reports role setting names that cannot be set with ALTER ROLE ... SET
+func checkSettings(entity string, settings map[string]string) []string {
+	var problems []string
+	for name := range settings {
+		if err := structs.CheckSettingName(name); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: settings: %v (use lowercase names such as statement_timeout or app.tenant)", entity, err))
+		}
+	}
+	slices.Sort(problems)
+	return problems
+}
+
+// objectGrantDatabases returns the databases extension schema and large object grants are
+// applied in, other than the connected one
+func objectGrantDatabases(schemas []structs.ExtensionSchemaGrant, largeObjects []structs.LargeObjectGrant) []string {
+	var names []string
+	for _, grant := range schemas {
+		if grant.Database != "" && !slices.Contains(names, grant.Database) {
+			names = append(names, grant.Database)
+		}
+	}
+	for _, grant := range largeObjects {
+		if grant.Database != "" && !slices.Contains(names, grant.Database) {
+			names = append(names, grant.Database)
+		}
+	}
+	return names
+}
+
+// checkDatabaseReferences reports databases that are neither declared nor known to exist
+func checkDatabaseReferences(entity string, referenced []string, known map[string]bool) []string {
+	var problems []string
+	for _, db := range referenced {
+		if !known[db] {
+			problems = append(problems, fmt.Sprintf("%s references unknown database %q", entity, db))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,628 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+func TestValidateConfigDuplicates(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	manager := NewManager(logger)
+
+	tests := []struct {
+		name         string
+		config       *structs.Config
+		wantProblems int
+	}{
+		{
+			name: "unique names",
+			config: &structs.Config{
+				Users:  []structs.UserConfig{{Username: "app_user"}, {Username: "report_user"}},
+				Groups: []structs.GroupConfig{{Name: "app_group"}, {Name: "read_only"}},
+			},
+			wantProblems: 0,
+		},
+		{
+			name: "exact duplicate username",
+			config: &structs.Config{
+				Users: []structs.UserConfig{{Username: "app_user"}, {Username: "app_user"}},
+			},
+			wantProblems: 1,
+		},
+		{
+			name: "case-insensitive duplicate username",
+			config: &structs.Config{
+				Users: []structs.UserConfig{{Username: "AppUser"}, {Username: "appuser"}},
+			},
+			wantProblems: 1,
+		},
+		{
+			name: "duplicate users and groups reported together",
+			config: &structs.Config{
+				Users:  []structs.UserConfig{{Username: "AppUser"}, {Username: "appuser"}},
+				Groups: []structs.GroupConfig{{Name: "Admins"}, {Name: "ADMINS"}, {Name: "admins"}},
+			},
+			wantProblems: 3,
+		},
+		{
+			name: "user and group with the same name",
+			config: &structs.Config{
+				Users:  []structs.UserConfig{{Username: "reporting"}},
+				Groups: []structs.GroupConfig{{Name: "reporting"}},
+			},
+			wantProblems: 1,
+		},
+		{
+			name: "user and group differing only in case",
+			config: &structs.Config{
+				Users:  []structs.UserConfig{{Username: "Reporting"}},
+				Groups: []structs.GroupConfig{{Name: "reporting"}},
+			},
+			wantProblems: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := manager.ValidateConfig(tt.config)
+			if tt.wantProblems == 0 {
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				return
+			}
+
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("Expected ValidationError, got %v", err)
+			}
+			if len(validationErr.Problems) != tt.wantProblems {
+				t.Errorf("Expected %d problems, got %d: %v", tt.wantProblems, len(validationErr.Problems), validationErr.Problems)
+			}
+		})
+	}
+}
+
+func TestValidateConfigPrivileges(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	manager := NewManager(logger)
+
+	config := &structs.Config{
+		Users: []structs.UserConfig{
+			{Username: "app_user", Privileges: []string{"connect", "TEMPORARY"}, Databases: []string{"app_db"}},
+			{Username: "bad_user", Privileges: []string{"USAGE"}, Databases: []string{"app_db"}},
+			{Username: "no_db_user", Privileges: []string{"CONNECT"}},
+		},
+		Groups: []structs.GroupConfig{
+			{
+				Name: "ext_group",
+				ExtensionSchemas: []structs.ExtensionSchemaGrant{
+					{Extension: "postgis", Privileges: []string{"SELECT"}},
+					{Extension: "pg_cron", Privileges: []string{"ALL", "USAGE"}},
+				},
+				LargeObjects: []structs.LargeObjectGrant{{OID: 1234}, {OID: 5678, Privileges: []string{"select", "all"}}},
+			},
+		},
+	}
+
+	err := manager.ValidateConfig(config)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected ValidationError, got %v", err)
+	}
+
+	// USAGE on database, privileges without databases, SELECT on schema, large object without
+	// privileges and ALL listed with other privileges on a schema and a large object
+	if len(validationErr.Problems) != 6 {
+		t.Errorf("Expected 6 problems, got %d: %v", len(validationErr.Problems), validationErr.Problems)
+	}
+}
+
+func TestValidateReferences(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	manager := NewManager(logger)
+
+	config := &structs.Config{
+		Users: []structs.UserConfig{
+			{Username: "app_user", Groups: []string{"app_group", "rds_superuser"}, Databases: []string{"app_db"}},
+		},
+		Groups: []structs.GroupConfig{
+			{Name: "app_group", Databases: []string{"analytics_db"}},
+		},
+		Policies: []structs.PolicyConfig{
+			{Name: "tenant_isolation", Table: "orders", Roles: []string{"app_group", "tenant_role"}},
+		},
+	}
+
+	// Without a catalog, the undeclared group and policy role are reported but databases are not checked
+	err := manager.ValidateReferences(config, nil)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected ValidationError, got %v", err)
+	}
+	if len(validationErr.Problems) != 2 {
+		t.Errorf("Expected 2 problems, got %d: %v", len(validationErr.Problems), validationErr.Problems)
+	}
+
+	// Declaring databases enables database reference checks
+	config.Databases = []string{"app_db"}
+	err = manager.ValidateReferences(config, nil)
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected ValidationError, got %v", err)
+	}
+	if len(validationErr.Problems) != 3 {
+		t.Errorf("Expected 3 problems, got %d: %v", len(validationErr.Problems), validationErr.Problems)
+	}
+
+	// Roles and databases that exist in the cluster satisfy the references
+	catalog := &structs.ClusterCatalog{
+		Roles:     []string{"postgres", "rds_superuser", "tenant_role"},
+		Databases: []string{"postgres", "analytics_db"},
+	}
+	if err := manager.ValidateReferences(config, catalog); err != nil {
+		t.Errorf("Expected references to be satisfied by the catalog, got %v", err)
+	}
+}
+
+func TestValidateConfigGroupCycles(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	manager := NewManager(logger)
+
+	config := &structs.Config{
+		Groups: []structs.GroupConfig{
+			{Name: "a", MemberOf: []string{"b"}},
+			{Name: "b", MemberOf: []string{"c"}},
+			{Name: "c", MemberOf: []string{"a", "rds_superuser"}},
+		},
+	}
+
+	err := manager.ValidateConfig(config)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected ValidationError, got %v", err)
+	}
+	if len(validationErr.Problems) != 1 {
+		t.Errorf("Expected 1 cycle problem, got %d: %v", len(validationErr.Problems), validationErr.Problems)
+	}
+}
+
+func TestValidateConfigAuthMethods(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	manager := NewManager(logger)
+
+	valid := &structs.Config{
+		Users: []structs.UserConfig{
+			{Username: "iam_user", AuthMethod: "iam"},
+			{Username: "fallback_user", AuthMethods: []string{"iam", "password"}, Password: "secret"},
+			{Username: "both_fields", AuthMethod: "iam", AuthMethods: []string{"iam", "password"}, Password: "secret"},
+			{Username: "cert_user", AuthMethod: "cert", CertCommonName: "cert.example.com"},
+		},
+	}
+	if err := manager.ValidateConfig(valid); err != nil {
+		t.Errorf("Expected valid auth methods, got %v", err)
+	}
+
+	config := &structs.Config{
+		Users: []structs.UserConfig{
+			{Username: "bad_method", AuthMethod: "kerberos"},
+			{Username: "bad_methods", AuthMethods: []string{"iam", "ldap"}},
+			{Username: "duplicate", AuthMethods: []string{"password", "password"}},
+			{Username: "inconsistent", AuthMethod: "password", AuthMethods: []string{"iam"}},
+			{Username: "no_password", AuthMethods: []string{"iam", "password"}},
+			{Username: "cert_with_password", AuthMethod: "cert", Password: "secret"},
+			{Username: "cert_combined", AuthMethods: []string{"cert", "iam"}},
+			{Username: "cert_both_names", AuthMethod: "cert", CertCommonName: "a", CertSubjectDN: "CN=a"},
+			{Username: "cn_without_cert", AuthMethod: "password", CertCommonName: "a"},
+			{Username: "iam_with_password", AuthMethod: "iam", Password: "secret"},
+		},
+	}
+
+	err := manager.ValidateConfig(config)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected ValidationError, got %v", err)
+	}
+
+	if len(validationErr.Problems) != 10 {
+		t.Errorf("Expected 10 problems, got %d: %v", len(validationErr.Problems), validationErr.Problems)
+	}
+}
+
+func TestValidateConfigConnectionLimits(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	manager := NewManager(logger)
+
+	valid := &structs.Config{
+		Users: []structs.UserConfig{
+			{Username: "unset"},
+			{Username: "unlimited", ConnectionLimit: -1},
+			{Username: "limited", ConnectionLimit: 10},
+		},
+	}
+	if err := manager.ValidateConfig(valid); err != nil {
+		t.Errorf("Expected valid connection limits, got %v", err)
+	}
+
+	config := &structs.Config{
+		Users: []structs.UserConfig{
+			{Username: "negative", ConnectionLimit: -2},
+			{Username: "too_large", ConnectionLimit: 1 << 31},
+		},
+	}
+
+	err := manager.ValidateConfig(config)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected ValidationError, got %v", err)
+	}
+	if len(validationErr.Problems) != 2 || !strings.Contains(validationErr.Problems[0], "connection_limit -2") {
+		t.Errorf("Unexpected problems: %v", validationErr.Problems)
+	}
+}
+
+func TestValidateConfigSettings(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	manager := NewManager(logger)
+
+	config := &structs.Config{
+		Users: []structs.UserConfig{
+			{Username: "app_user", Settings: map[string]string{"statement_timeout": "30s", "app.tenant": "acme"}},
+		},
+		Groups: []structs.GroupConfig{
+			{Name: "readers", Settings: map[string]string{"search_path": "app, public"}},
+		},
+	}
+	if err := manager.ValidateConfig(config); err != nil {
+		t.Errorf("Expected valid settings, got %v", err)
+	}
+
+	config.Users[0].Settings["work_mem; DROP ROLE x"] = "4MB"
+	config.Groups[0].Settings["Search_Path"] = "app"
+
+	err := manager.ValidateConfig(config)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected ValidationError, got %v", err)
+	}
+	if len(validationErr.Problems) != 2 || !strings.Contains(validationErr.Problems[0], "work_mem; DROP ROLE x") || !strings.Contains(validationErr.Problems[1], "Search_Path") {
+		t.Errorf("Unexpected problems: %v", validationErr.Problems)
+	}
+}
+
+func TestValidateConfigSchemas(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	manager := NewManager(logger)
+
+	config := &structs.Config{
+		Groups: []structs.GroupConfig{{Name: "app_owner"}, {Name: "readers"}},
+		Schemas: []structs.SchemaConfig{
+			{Name: "app", Owner: "app_owner", Grants: []structs.SchemaGrant{{Role: "readers"}, {Role: "app_owner", Privileges: []string{"all"}}}},
+		},
+	}
+	if err := manager.ValidateConfig(config); err != nil {
+		t.Errorf("Expected valid schemas, got %v", err)
+	}
+	if err := manager.ValidateReferences(config, nil); err != nil {
+		t.Errorf("Expected schema roles to be declared, got %v", err)
+	}
+
+	config.Schemas = append(config.Schemas,
+		structs.SchemaConfig{Name: "app", Grants: []structs.SchemaGrant{{Privileges: []string{"SELECT"}}}},
+		structs.SchemaConfig{},
+	)
+	err := manager.ValidateConfig(config)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected ValidationError, got %v", err)
+	}
+	// The grant without a role, the table privilege, the schema without a name and the duplicate
+	if len(validationErr.Problems) != 4 {
+		t.Errorf("Expected 4 problems, got %d: %v", len(validationErr.Problems), validationErr.Problems)
+	}
+
+	config.Schemas = []structs.SchemaConfig{{Name: "app", Owner: "app_admin", Grants: []structs.SchemaGrant{{Role: "auditors"}}}}
+	err = manager.ValidateReferences(config, nil)
+	if !errors.As(err, &validationErr) || len(validationErr.Problems) != 2 {
+		t.Fatalf("Expected the undeclared owner and grant role, got %v", err)
+	}
+	if !strings.Contains(validationErr.Problems[0], "--against-db") {
+		t.Errorf("Expected a hint to validate against the database, got %q", validationErr.Problems[0])
+	}
+
+	// Schemas of the same name in different databases are not duplicates, but their
+	// databases must be declared
+	config.Schemas = []structs.SchemaConfig{{Name: "app"}, {Name: "app", Database: "reports"}}
+	if err := manager.ValidateConfig(config); err != nil {
+		t.Errorf("Expected schemas in different databases to be valid, got %v", err)
+	}
+	config.Databases = []string{"app_db"}
+	err = manager.ValidateReferences(config, nil)
+	if !errors.As(err, &validationErr) || len(validationErr.Problems) != 1 || !strings.Contains(validationErr.Problems[0], `schema "app" references unknown database "reports"`) {
+		t.Errorf("Expected the unknown schema database, got %v", err)
+	}
+}
+
+func TestJoinValidationErrors(t *testing.T) {
+	if err := JoinValidationErrors(nil, nil); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	err := JoinValidationErrors(&ValidationError{Problems: []string{"a"}}, nil, &ValidationError{Problems: []string{"b", "c"}})
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || strings.Join(validationErr.Problems, ",") != "a,b,c" {
+		t.Errorf("Expected problems a,b,c, got %v", err)
+	}
+
+	other := errors.New("connection refused")
+	if err := JoinValidationErrors(&ValidationError{Problems: []string{"a"}}, other); err != other {
+		t.Errorf("Expected other errors to be returned as they are, got %v", err)
+	}
+}
+
+func TestValidateConfigGeneratedPasswords(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	manager := NewManager(logger)
+
+	valid := &structs.Config{
+		Users: []structs.UserConfig{
+			{Username: "generated", GeneratePassword: true},
+			{Username: "custom", GeneratePassword: true, PasswordLength: 48, PasswordCharset: "0123456789abcdef"},
+			{Username: "fallback_user", AuthMethods: []string{"iam", "password"}, GeneratePassword: true},
+		},
+	}
+	if err := manager.ValidateConfig(valid); err != nil {
+		t.Errorf("Expected valid generated passwords, got %v", err)
+	}
+
+	config := &structs.Config{
+		Users: []structs.UserConfig{
+			{Username: "both", Password: "secret", GeneratePassword: true},
+			{Username: "iam_only", AuthMethod: "iam", GeneratePassword: true},
+			{Username: "too_short", GeneratePassword: true, PasswordLength: 6},
+			{Username: "one_character", GeneratePassword: true, PasswordCharset: "x"},
+			{Username: "not_generated", PasswordLength: 20},
+		},
+	}
+
+	err := manager.ValidateConfig(config)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected ValidationError, got %v", err)
+	}
+	if len(validationErr.Problems) != 5 {
+		t.Errorf("Expected 5 problems, got %d: %v", len(validationErr.Problems), validationErr.Problems)
+	}
+}
+
+func TestValidateConfigTemporaryGroups(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	manager := NewManager(logger)
+	expiresAt := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	valid := &structs.Config{
+		Groups: []structs.GroupConfig{{Name: "readers"}, {Name: "admins"}},
+		Users: []structs.UserConfig{
+			{Username: "alice", Groups: []string{"readers"}, TemporaryGroups: []structs.TemporaryMembership{{Group: "admins", ExpiresAt: expiresAt}}},
+		},
+	}
+	if err := manager.ValidateConfig(valid); err != nil {
+		t.Errorf("Expected valid temporary groups, got %v", err)
+	}
+	if err := manager.ValidateReferences(valid, nil); err != nil {
+		t.Errorf("Expected declared temporary groups, got %v", err)
+	}
+
+	config := &structs.Config{
+		Users: []structs.UserConfig{
+			{Username: "no_group", TemporaryGroups: []structs.TemporaryMembership{{ExpiresAt: expiresAt}}},
+			{Username: "no_expiry", TemporaryGroups: []structs.TemporaryMembership{{Group: "admins"}}},
+			{Username: "also_permanent", Groups: []string{"admins"}, TemporaryGroups: []structs.TemporaryMembership{{Group: "Admins", ExpiresAt: expiresAt}}},
+		},
+	}
+
+	err := manager.ValidateConfig(config)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected ValidationError, got %v", err)
+	}
+	if len(validationErr.Problems) != 3 {
+		t.Errorf("Expected 3 problems, got %d: %v", len(validationErr.Problems), validationErr.Problems)
+	}
+
+	if err := manager.ValidateReferences(config, nil); err == nil || !strings.Contains(err.Error(), `temporary membership in undeclared group "admins"`) {
+		t.Errorf("Expected undeclared temporary group to be reported, got %v", err)
+	}
+}
+
+func TestValidateConfigNoInherit(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	manager := NewManager(logger)
+	expiresAt := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	valid := &structs.Config{
+		Groups: []structs.GroupConfig{{Name: "readers"}, {Name: "admins"}},
+		Users: []structs.UserConfig{
+			{Username: "alice", Groups: []string{"readers"}, NoInherit: true},
+			{Username: "bob", TemporaryGroups: []structs.TemporaryMembership{{Group: "admins", ExpiresAt: expiresAt}}, NoInherit: true},
+			{Username: "gone", NoInherit: true, Absent: true},
+		},
+	}
+	if err := manager.ValidateConfig(valid); err != nil {
+		t.Errorf("Expected NOINHERIT users with groups to be valid, got %v", err)
+	}
+
+	config := &structs.Config{
+		Users: []structs.UserConfig{{Username: "loner", NoInherit: true}},
+	}
+	err := manager.ValidateConfig(config)
+	if err == nil || !strings.Contains(err.Error(), `user "loner": no_inherit is set but the user has no groups`) {
+		t.Errorf("Expected a NOINHERIT user without groups to be reported, got %v", err)
+	}
+}
+
+func TestValidateConfigPreviousNames(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	manager := NewManager(logger)
+
+	valid := &structs.Config{
+		Users: []structs.UserConfig{
+			{Username: "orders_svc", PreviousNames: []string{"old_svc", "legacy_svc"}},
+		},
+	}
+	if err := manager.ValidateConfig(valid); err != nil {
+		t.Errorf("Expected valid previous names, got %v", err)
+	}
+
+	config := &structs.Config{
+		Users: []structs.UserConfig{
+			{Username: "empty", PreviousNames: []string{""}},
+			{Username: "still_user", PreviousNames: []string{"Empty"}},
+			{Username: "still_group", PreviousNames: []string{"readers"}},
+			{Username: "first", PreviousNames: []string{"shared_svc"}},
+			{Username: "second", PreviousNames: []string{"Shared_Svc"}},
+		},
+		Groups: []structs.GroupConfig{{Name: "readers"}},
+	}
+
+	err := manager.ValidateConfig(config)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected ValidationError, got %v", err)
+	}
+	if len(validationErr.Problems) != 4 {
+		t.Errorf("Expected 4 problems, got %d: %v", len(validationErr.Problems), validationErr.Problems)
+	}
+}
+
+func TestValidateConfigOwnership(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	manager := NewManager(logger)
+
+	config := &structs.Config{
+		RequireOwner: true,
+		Users: []structs.UserConfig{
+			{Username: "owned", Owner: "jane", Ticket: "SEC-1"},
+			{Username: "team_only", Team: "payments"},
+			{Username: "unowned"},
+			{Username: "gone", Absent: true},
+			{Username: "broken", Owner: "jane; team=ops"},
+		},
+		Groups: []structs.GroupConfig{{Name: "readers"}},
+	}
+
+	err := manager.ValidateConfig(config)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected ValidationError, got %v", err)
+	}
+	for _, expected := range []string{
+		`user "unowned": no owner or team`,
+		`group "readers": no owner or team`,
+		`user "broken": owner "jane; team=ops" must not contain`,
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected %q in %v", expected, err)
+		}
+	}
+	if len(validationErr.Problems) != 3 {
+		t.Errorf("Expected 3 problems, got %d: %v", len(validationErr.Problems), validationErr.Problems)
+	}
+
+	config.RequireOwner = false
+	config.Users = config.Users[:4]
+	if err := manager.ValidateConfig(config); err != nil {
+		t.Errorf("Expected roles without an owner to be allowed, got %v", err)
+	}
+}
+
+func TestValidateConfigChangeLimits(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	manager := NewManager(logger)
+
+	config := &structs.Config{ChangeLimits: &structs.ChangeLimitsConfig{MaxRemovals: -1, MaxRemovalPercent: 150}}
+	err := manager.ValidateConfig(config)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected ValidationError, got %v", err)
+	}
+	if len(validationErr.Problems) != 2 {
+		t.Errorf("Expected 2 problems, got %d: %v", len(validationErr.Problems), validationErr.Problems)
+	}
+
+	config.ChangeLimits = &structs.ChangeLimitsConfig{MaxRemovals: 10, MaxRemovalPercent: 25}
+	if err := manager.ValidateConfig(config); err != nil {
+		t.Errorf("Expected valid change limits, got %v", err)
+	}
+}
+
+func TestValidateConfigRoleRemoval(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	manager := NewManager(logger)
+
+	config := &structs.Config{
+		Users: []structs.UserConfig{
+			{Username: "app_owner", CanLogin: true},
+			{Username: "old_user", Absent: true},
+		},
+		RoleRemoval: &structs.RoleRemovalConfig{ReassignTo: "old_user", Cascade: true, GracePeriodSeconds: -1},
+	}
+	err := manager.ValidateConfig(config)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected ValidationError, got %v", err)
+	}
+	if len(validationErr.Problems) != 3 {
+		t.Errorf("Expected 3 problems, got %d: %v", len(validationErr.Problems), validationErr.Problems)
+	}
+
+	config.RoleRemoval = &structs.RoleRemovalConfig{ReassignTo: "app_owner"}
+	if err := manager.ValidateConfig(config); err != nil {
+		t.Errorf("Expected a valid role removal policy, got %v", err)
+	}
+	if err := manager.ValidateReferences(config, nil); err != nil {
+		t.Errorf("Expected the declared reassign_to role to be accepted, got %v", err)
+	}
+
+	config.RoleRemoval.ReassignTo = "data_owner"
+	if err := manager.ValidateReferences(config, nil); err == nil {
+		t.Error("Expected an undeclared reassign_to role to be reported")
+	}
+	if err := manager.ValidateReferences(config, &structs.ClusterCatalog{Roles: []string{"data_owner"}}); err != nil {
+		t.Errorf("Expected a reassign_to role that exists in the cluster to be accepted, got %v", err)
+	}
+}
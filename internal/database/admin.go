@@ -0,0 +1,94 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// adminGrant is a membership the connected role granted itself to administer a group
+type adminGrant struct {
+	Group     string
+	WasMember bool // whether the role was already a direct member, without ADMIN OPTION
+}
+
+// SetAutoGrantAdmin lets the connected role grant itself ADMIN OPTION on groups it needs to
+// grant or revoke but cannot, as on RDS where the admin user is not a superuser. The
+// memberships it adds are revoked again by CleanupAdminMemberships.
+func (m *Manager) SetAutoGrantAdmin(auto bool) {
+	m.autoGrantAdmin = auto
+}
+
+// ensureAdminMembership makes sure the connected role can grant and revoke membership in a
+// group. Superusers, roles with ADMIN OPTION and, before PostgreSQL 16, roles with
+// CREATEROLE already can; otherwise, when automatic grants are enabled, the connected role
+// is granted the group WITH ADMIN OPTION for the rest of the sync.
+func (m *Manager) ensureAdminMembership(group string) error {
+	if !m.autoGrantAdmin {
+		return nil
+	}
+	for _, grant := range m.adminGrants {
+		if grant.Group == group {
+			return nil
+		}
+	}
+
+	var role string
+	var superuser, createRole, admin, member bool
+	var version int
+	err := m.executor().QueryRow(`
+		SELECT r.rolname, r.rolsuper, r.rolcreaterole,
+			pg_has_role(current_user, g.oid, 'MEMBER WITH ADMIN OPTION'),
+			EXISTS (SELECT 1 FROM pg_auth_members am WHERE am.roleid = g.oid AND am.member = r.oid),
+			current_setting('server_version_num')::int
+		FROM pg_roles r, pg_roles g
+		WHERE r.rolname = current_user AND g.rolname = $1`, group).
+		Scan(&role, &superuser, &createRole, &admin, &member, &version)
+	if err == sql.ErrNoRows {
+		// The group does not exist yet; the GRANT itself reports that
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check admin option on %s: %w", group, err)
+	}
+	if superuser || admin || (createRole && version < adminOptionVersion) {
+		return nil
+	}
+
+	m.logger.WithFields(logrus.Fields{
+		"role":  role,
+		"group": group,
+	}).Info("Granting connected role admin option on group")
+
+	query := fmt.Sprintf("GRANT %s TO CURRENT_USER WITH ADMIN OPTION", m.quoteIdentifier(group))
+	if err := m.execute(query); err != nil {
+		return fmt.Errorf("%s cannot grant membership in %s and could not grant itself ADMIN OPTION on it; "+
+			"run GRANT %s TO %s WITH ADMIN OPTION as a role that has it: %w",
+			role, group, m.quoteIdentifier(group), m.quoteIdentifier(role), err)
+	}
+
+	m.adminGrants = append(m.adminGrants, adminGrant{Group: group, WasMember: member})
+	return nil
+}
+
+// CleanupAdminMemberships revokes what ensureAdminMembership granted the connected role,
+// leaving it with the memberships it had before the sync: only the ADMIN OPTION when it
+// was already a member, the whole membership otherwise
+func (m *Manager) CleanupAdminMemberships() error {
+	var firstErr error
+	for _, grant := range m.adminGrants {
+		m.logger.WithField("group", grant.Group).Info("Revoking temporary admin membership of connected role")
+
+		query := fmt.Sprintf("REVOKE %s FROM CURRENT_USER", m.quoteIdentifier(grant.Group))
+		if grant.WasMember {
+			query = fmt.Sprintf("REVOKE ADMIN OPTION FOR %s FROM CURRENT_USER", m.quoteIdentifier(grant.Group))
+		}
+		if err := m.execute(query); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to revoke temporary membership in %s: %w", grant.Group, err)
+		}
+	}
+	m.adminGrants = nil
+
+	return firstErr
+}
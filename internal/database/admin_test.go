@@ -0,0 +1,45 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestCleanupAdminMemberships(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	m := &Manager{logger: logger, dryRun: true}
+	m.adminGrants = []adminGrant{
+		{Group: "rds_iam"},
+		{Group: "app_group", WasMember: true},
+	}
+
+	if err := m.CleanupAdminMemberships(); err != nil {
+		t.Fatalf("Cleanup failed: %v", err)
+	}
+	if len(m.adminGrants) != 0 {
+		t.Errorf("Expected temporary grants to be cleared, got %v", m.adminGrants)
+	}
+
+	var queries []string
+	for _, entry := range hook.AllEntries() {
+		if query, ok := entry.Data["query"]; ok && entry.Level == logrus.InfoLevel {
+			queries = append(queries, query.(string))
+		}
+	}
+
+	// A role that was already a member only loses the ADMIN OPTION it was given
+	expected := []string{
+		`REVOKE "rds_iam" FROM CURRENT_USER`,
+		`REVOKE ADMIN OPTION FOR "app_group" FROM CURRENT_USER`,
+	}
+	if len(queries) != len(expected) {
+		t.Fatalf("Expected queries %v, got %v", expected, queries)
+	}
+	for i := range expected {
+		if queries[i] != expected[i] {
+			t.Errorf("Expected %s, got %s", expected[i], queries[i])
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+)
+
+// setOptionVersion is the first server version (16) where each membership says whether the
+// member may SET ROLE to the group; before it, every member may
+const setOptionVersion = 160000
+
+// AssumableRoles lists, for each login role that is not a superuser, or only for the given
+// users, the roles it is a member of directly or through other groups, whether their
+// privileges apply without SET ROLE and whether it may SET ROLE to them, ordered by user and role
+func (m *Manager) AssumableRoles(users []string) ([]structs.AssumableRole, error) {
+	var version int
+	if err := m.executor().QueryRow("SELECT current_setting('server_version_num')::int").Scan(&version); err != nil {
+		return nil, fmt.Errorf("failed to read server version: %w", err)
+	}
+	setPrivilege := "SET"
+	if version < setOptionVersion {
+		setPrivilege = "MEMBER"
+	}
+
+	query := `
+		SELECT u.rolname, r.rolname, pg_has_role(u.oid, r.oid, 'USAGE'), pg_has_role(u.oid, r.oid, $1)
+		FROM pg_roles u
+		JOIN pg_roles r ON r.oid <> u.oid AND pg_has_role(u.oid, r.oid, 'MEMBER')
+		WHERE u.rolcanlogin AND NOT u.rolsuper AND u.rolname !~ '^pg_'
+			AND (cardinality($2::text[]) = 0 OR u.rolname = ANY($2))
+		ORDER BY u.rolname, r.rolname`
+
+	rows, err := m.executor().Query(query, setPrivilege, pq.Array(users))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list assumable roles: %w", err)
+	}
+	defer rows.Close()
+
+	roles := []structs.AssumableRole{}
+	for rows.Next() {
+		var role structs.AssumableRole
+		if err := rows.Scan(&role.User, &role.Role, &role.Inherited, &role.CanSet); err != nil {
+			return nil, fmt.Errorf("failed to scan assumable role: %w", err)
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+// CheckSetRoleReachability checks that NOINHERIT users can use the privileges their groups
+// are configured with: they must be allowed to SET ROLE to each group, and able to connect to
+// each database the group holds privileges on, since CONNECT is checked before any SET ROLE.
+// It returns what is unreachable; users and groups that do not exist yet are left to sync.
+func (m *Manager) CheckSetRoleReachability(config *structs.Config) ([]string, error) {
+	var names []string
+	for _, user := range config.Users {
+		if user.NoInherit && user.Enabled && !user.Absent {
+			names = append(names, user.Username)
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	assumable, err := m.AssumableRoles(names)
+	if err != nil {
+		return nil, err
+	}
+	canSet := make(map[string]bool, len(assumable))
+	for _, role := range assumable {
+		canSet[role.User+"/"+role.Role] = role.CanSet
+	}
+
+	groups := make(map[string]*structs.GroupConfig, len(config.Groups))
+	for i := range config.Groups {
+		groups[config.Groups[i].Name] = &config.Groups[i]
+	}
+
+	var problems []string
+	now := time.Now()
+	for i := range config.Users {
+		user := config.Users[i]
+		if !user.NoInherit || !user.Enabled || user.Absent {
+			continue
+		}
+		user.AddDefaultGroups(config.DefaultGroups())
+		for _, name := range user.ActiveGroups(now) {
+			set, member := canSet[user.Username+"/"+name]
+			if !member {
+				continue
+			}
+			if !set {
+				problems = append(problems, fmt.Sprintf("user %s cannot SET ROLE %s, so the privileges of %s are unreachable", user.Username, name, name))
+				continue
+			}
+
+			group := groups[name]
+			if group == nil || len(group.Privileges) == 0 {
+				continue
+			}
+			for _, db := range group.Databases {
+				var connect bool
+				err := m.executor().QueryRow("SELECT has_database_privilege($1, datname, 'CONNECT') FROM pg_database WHERE datname = $2", user.Username, db).Scan(&connect)
+				if err != nil {
+					// Missing roles and databases are reported by sync and validate --against-db
+					continue
+				}
+				if !connect {
+					problems = append(problems, fmt.Sprintf("user %s cannot connect to database %s, so the privileges of %s there are unreachable; grant it CONNECT", user.Username, db, name))
+				}
+			}
+		}
+	}
+
+	m.logger.WithFields(logrus.Fields{
+		"users":    len(names),
+		"problems": len(problems),
+	}).Debug("Checked SET ROLE reachability")
+
+	return problems, nil
+}
@@ -0,0 +1,77 @@
+package database
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+func TestUserAttributeChangesInherit(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	m := &Manager{logger: logger}
+
+	user := &structs.UserConfig{Username: "alice", CanLogin: true, NoInherit: true}
+	attributes := &structs.RoleAttributes{CanLogin: true, Inherit: true, ConnectionLimit: -1}
+
+	changes, err := m.userAttributeChanges(user, attributes)
+	if err != nil {
+		t.Fatalf("Failed to compare attributes: %v", err)
+	}
+	expected := structs.AttributeChange{Role: "alice", Attribute: "inherit", Current: "true", Desired: "false"}
+	if len(changes) != 1 || changes[0] != expected {
+		t.Errorf("Expected %+v, got %+v", expected, changes)
+	}
+
+	attributes.Inherit = false
+	if changes, _ := m.userAttributeChanges(user, attributes); len(changes) != 0 {
+		t.Errorf("Expected no changes for a NOINHERIT user, got %+v", changes)
+	}
+}
+
+func TestAssumableRolesAndReachability(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	config := &structs.Config{
+		Groups: []structs.GroupConfig{
+			{Name: "test_assume_admin", Privileges: []string{"CONNECT", "CREATE"}, Databases: []string{"testdb"}, Inherit: true},
+		},
+		Users: []structs.UserConfig{
+			{Username: "test_assume_user", Password: "assume_password", Groups: []string{"test_assume_admin"}, NoInherit: true, Enabled: true, CanLogin: true},
+		},
+	}
+	if _, err := setup.Manager.SyncConfiguration(config); err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+
+	roles, err := setup.Manager.AssumableRoles([]string{"test_assume_user"})
+	if err != nil {
+		t.Fatalf("Failed to list assumable roles: %v", err)
+	}
+	expected := structs.AssumableRole{User: "test_assume_user", Role: "test_assume_admin", Inherited: false, CanSet: true}
+	if len(roles) != 1 || roles[0] != expected {
+		t.Errorf("Expected %+v, got %+v", expected, roles)
+	}
+
+	// PUBLIC may connect to testdb, so the group's privileges are reachable until it may not
+	problems, err := setup.Manager.CheckSetRoleReachability(config)
+	if err != nil || len(problems) != 0 {
+		t.Fatalf("Expected no unreachable privileges, got %v (%v)", problems, err)
+	}
+	if _, err := setup.Manager.db.Exec("REVOKE CONNECT ON DATABASE testdb FROM PUBLIC"); err != nil {
+		t.Fatalf("Failed to revoke CONNECT from PUBLIC: %v", err)
+	}
+	defer setup.Manager.db.Exec("GRANT CONNECT ON DATABASE testdb TO PUBLIC")
+
+	problems, err = setup.Manager.CheckSetRoleReachability(config)
+	if err != nil {
+		t.Fatalf("Failed to check reachability: %v", err)
+	}
+	if len(problems) != 1 || !strings.Contains(problems[0], "user test_assume_user cannot connect to database testdb") {
+		t.Errorf("Expected the missing CONNECT to be reported, got %v", problems)
+	}
+}
@@ -0,0 +1,99 @@
+package database
+
+import (
+	"database/sql"
+	"regexp"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// roleDDLPattern matches statements that create, drop or rename roles and so change which
+// roles exist
+var roleDDLPattern = regexp.MustCompile(`(?i)^\s*(CREATE|DROP)\s+(ROLE|USER|GROUP)\b|^\s*ALTER\s+(ROLE|USER|GROUP)\b.*\bRENAME\s+TO\b`)
+
+// roleCache remembers which roles exist for the rest of a command, so looking up the same
+// name again does not query pg_roles again. The zero value is ready to use.
+type roleCache struct {
+	mu     sync.Mutex
+	exists map[string]bool
+}
+
+// SetCatalogCache turns caching of role lookups on or off. It is on by default, which suits
+// commands that run once; long-running processes such as serve should turn it off, since
+// roles may change outside of them between requests.
+func (m *Manager) SetCatalogCache(enabled bool) {
+	m.cacheDisabled = !enabled
+	m.InvalidateCatalogCache()
+}
+
+// InvalidateCatalogCache forgets every cached role lookup. Statements run through this
+// manager that create, drop or rename roles invalidate the cache themselves.
+func (m *Manager) InvalidateCatalogCache() {
+	m.roles.mu.Lock()
+	defer m.roles.mu.Unlock()
+	m.roles.exists = nil
+}
+
+// invalidateAfter forgets cached role lookups when a statement changes which roles exist
+func (m *Manager) invalidateAfter(query string) {
+	if roleDDLPattern.MatchString(query) {
+		m.logger.WithField("query", m.logQuery(query)).Debug("Invalidating cached role lookups")
+		m.InvalidateCatalogCache()
+	}
+}
+
+// rememberRoles caches the result of looking up several roles at once: those in found
+// exist and the rest do not
+func (m *Manager) rememberRoles(roles, found []string) {
+	if m.cacheDisabled {
+		return
+	}
+	m.roles.mu.Lock()
+	defer m.roles.mu.Unlock()
+	if m.roles.exists == nil {
+		m.roles.exists = make(map[string]bool)
+	}
+	for _, role := range roles {
+		m.roles.exists[role] = false
+	}
+	for _, role := range found {
+		m.roles.exists[role] = true
+	}
+}
+
+// roleExists reports whether a role exists, answering from the cache when the role has
+// been looked up before
+func (m *Manager) roleExists(role string) (bool, error) {
+	if !m.cacheDisabled {
+		m.roles.mu.Lock()
+		exists, cached := m.roles.exists[role]
+		m.roles.mu.Unlock()
+		if cached {
+			return exists, nil
+		}
+	}
+
+	// Use pg_roles instead of pg_user to include both login and nologin users
+	var found int
+	err := m.executor().QueryRow("SELECT 1 FROM pg_roles WHERE rolname = $1", role).Scan(&found)
+	if err != nil && err != sql.ErrNoRows {
+		return false, err
+	}
+	exists := err == nil
+
+	if !m.cacheDisabled {
+		m.roles.mu.Lock()
+		if m.roles.exists == nil {
+			m.roles.exists = make(map[string]bool)
+		}
+		m.roles.exists[role] = exists
+		m.roles.mu.Unlock()
+	}
+
+	m.logger.WithFields(logrus.Fields{
+		"role":   role,
+		"exists": exists,
+	}).Debug("Looked up role")
+	return exists, nil
+}
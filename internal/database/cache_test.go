@@ -0,0 +1,66 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+func TestRoleDDLPattern(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{`CREATE USER "app_user" WITH LOGIN`, true},
+		{`create role "app_group" NOLOGIN`, true},
+		{`DROP ROLE "app_group"`, true},
+		{`DROP USER IF EXISTS "app_user"`, true},
+		{`ALTER ROLE "old_name" RENAME TO "new_name"`, true},
+		{`ALTER ROLE "app_user" WITH NOLOGIN`, false},
+		{`GRANT "app_group" TO "app_user"`, false},
+		{`COMMENT ON ROLE "app_user" IS 'drop role'`, false},
+	}
+
+	for _, tt := range tests {
+		if got := roleDDLPattern.MatchString(tt.query); got != tt.want {
+			t.Errorf("roleDDLPattern.MatchString(%q) = %v, expected %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestRoleExistsCache(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	if exists, err := setup.Manager.UserExists("test_user"); err != nil || exists {
+		t.Fatalf("Expected test_user not to exist, got exists=%v err=%v", exists, err)
+	}
+
+	// Creating the role through the manager invalidates the cached lookup
+	if err := setup.Manager.CreateUser(&structs.UserConfig{Username: "test_user", Password: "test_pass", CanLogin: true}); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if exists, err := setup.Manager.UserExists("test_user"); err != nil || !exists {
+		t.Fatalf("Expected test_user to exist after creating it, got exists=%v err=%v", exists, err)
+	}
+
+	// A role dropped behind the manager's back is only noticed after invalidation
+	if _, err := setup.Manager.db.Exec(`DROP ROLE "test_user"`); err != nil {
+		t.Fatalf("Failed to drop user: %v", err)
+	}
+	if exists, _ := setup.Manager.UserExists("test_user"); !exists {
+		t.Error("Expected the cached lookup to be used")
+	}
+	setup.Manager.InvalidateCatalogCache()
+	if exists, _ := setup.Manager.UserExists("test_user"); exists {
+		t.Error("Expected test_user not to exist after invalidating the cache")
+	}
+
+	// With the cache off every lookup queries the catalog
+	setup.Manager.SetCatalogCache(false)
+	defer setup.Manager.SetCatalogCache(true)
+	if exists, _ := setup.Manager.GroupExists("test_user"); exists {
+		t.Error("Expected test_user not to exist with the cache off")
+	}
+}
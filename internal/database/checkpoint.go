@@ -0,0 +1,185 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+// Checkpoint records the entities a sync has completed, so a sync that was interrupted can
+// resume where it stopped instead of replaying every entity. Resuming is safe because every
+// sync operation checks the current state first; the checkpoint only saves the time.
+//
+// The file is a journal of JSON values: a header naming the configuration and cluster,
+// followed by one line per completed entity, appended as each completes.
+type Checkpoint struct {
+	Checksum  string // Checksum of the configuration being synced
+	Profile   string // Cluster (sync profile) being synced
+	StartedAt time.Time
+	Completed []string // Entities synced without errors, e.g. "user:app_user"
+
+	path      string
+	completed map[string]bool
+	started   bool // Whether the file holds this checkpoint's header, so entities are appended
+}
+
+// checkpointHeader is the first value of a checkpoint file
+type checkpointHeader struct {
+	Checksum  string    `json:"checksum"`
+	Profile   string    `json:"profile,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// NewCheckpoint starts an empty checkpoint that is written to path as entities complete,
+// replacing any checkpoint already there once the first entity completes
+func NewCheckpoint(path, checksum, profile string) *Checkpoint {
+	return &Checkpoint{
+		Checksum:  checksum,
+		Profile:   profile,
+		StartedAt: time.Now().UTC(),
+		Completed: []string{},
+		path:      path,
+		completed: make(map[string]bool),
+	}
+}
+
+// LoadCheckpoint reads the checkpoint of an interrupted sync, which further entities are
+// appended to. It refuses checkpoints written for another configuration or cluster, whose
+// completed entities would not mean the same. A last line cut short by the interruption is
+// ignored.
+func LoadCheckpoint(path, checksum, profile string) (*Checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no checkpoint to resume from at %s", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	var header checkpointHeader
+	if err := decoder.Decode(&header); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint %s: %w", path, err)
+	}
+	if header.Checksum != checksum {
+		return nil, fmt.Errorf("checkpoint %s was written for configuration %s, not %s; sync without --resume to start over",
+			path, header.Checksum, checksum)
+	}
+	if header.Profile != profile {
+		return nil, fmt.Errorf("checkpoint %s was written for profile %q, not %q", path, header.Profile, profile)
+	}
+
+	checkpoint := NewCheckpoint(path, checksum, profile)
+	checkpoint.StartedAt = header.StartedAt
+	checkpoint.started = true
+	end := decoder.InputOffset()
+	for {
+		var entity string
+		if err := decoder.Decode(&entity); err != nil {
+			break
+		}
+		end = decoder.InputOffset()
+		if !checkpoint.completed[entity] {
+			checkpoint.completed[entity] = true
+			checkpoint.Completed = append(checkpoint.Completed, entity)
+		}
+	}
+
+	// Drop the cut line, so the entities appended next start on a line of their own
+	if len(bytes.TrimSpace(data[end:])) > 0 {
+		if err := os.WriteFile(path, append(data[:end:end], '\n'), 0o600); err != nil {
+			return nil, fmt.Errorf("failed to repair checkpoint %s: %w", path, err)
+		}
+	}
+	return checkpoint, nil
+}
+
+// Done reports whether an entity was completed by the sync that wrote the checkpoint
+func (c *Checkpoint) Done(entity string) bool {
+	return c.completed[entity]
+}
+
+// MarkDone records a completed entity by appending it to the checkpoint file, writing the
+// header first for a new checkpoint. Each entity is written in one line, so a sync of many
+// entities does not rewrite the file for every one of them.
+func (c *Checkpoint) MarkDone(entity string) error {
+	if c.completed[entity] {
+		return nil
+	}
+
+	line, err := json.Marshal(entity)
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoint: %w", err)
+	}
+	data := append(line, '\n')
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	if !c.started {
+		header, err := json.Marshal(checkpointHeader{Checksum: c.Checksum, Profile: c.Profile, StartedAt: c.StartedAt})
+		if err != nil {
+			return fmt.Errorf("failed to marshal checkpoint: %w", err)
+		}
+		data = append(append(header, '\n'), data...)
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+
+	file, err := os.OpenFile(c.path, flags, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+
+	c.started = true
+	c.completed[entity] = true
+	c.Completed = append(c.Completed, entity)
+	return nil
+}
+
+// Remove deletes the checkpoint file once the sync it tracks has completed
+func (c *Checkpoint) Remove() error {
+	if err := os.Remove(c.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove checkpoint: %w", err)
+	}
+	return nil
+}
+
+// SetCheckpoint makes sync skip the entities a checkpoint records as completed and record
+// the ones it completes. Nothing is recorded in dry-run mode, or by a transactional sync
+// before it commits, as its entities are only completed then; the schemas and policies in
+// other databases it applies after the commit are recorded as they complete.
+func (m *Manager) SetCheckpoint(checkpoint *Checkpoint) {
+	m.checkpoint = checkpoint
+}
+
+// resumed reports whether an entity was completed by an interrupted sync, recording it as
+// skipped in the result
+func (m *Manager) resumed(entity string, result *structs.SyncResult) bool {
+	if m.checkpoint == nil || !m.checkpoint.Done(entity) {
+		return false
+	}
+	m.logger.WithField("entity", entity).Debug("Skipping entity completed by interrupted sync")
+	result.Resumed = append(result.Resumed, entity)
+	return true
+}
+
+// checkpointEntity records an entity as completed when syncing it added no errors. A
+// checkpoint that cannot be written is dropped with a warning rather than failing the sync.
+func (m *Manager) checkpointEntity(entity string, errorsBefore int, result *structs.SyncResult) {
+	if m.checkpoint == nil || m.dryRun || m.tx != nil || len(result.Errors) > errorsBefore {
+		return
+	}
+	if err := m.checkpoint.MarkDone(entity); err != nil {
+		result.Warn("", fmt.Sprintf("checkpointing stopped, an interrupted sync cannot resume: %v", err))
+		m.checkpoint = nil
+	}
+}
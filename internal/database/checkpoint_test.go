@@ -0,0 +1,130 @@
+package database
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestCheckpointRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json.checkpoint")
+
+	checkpoint := NewCheckpoint(path, "sha256:abc", "prod")
+	for _, entity := range []string{"group:app_group", "user:app_user", "user:app_user"} {
+		if err := checkpoint.MarkDone(entity); err != nil {
+			t.Fatalf("Failed to mark %s done: %v", entity, err)
+		}
+	}
+
+	loaded, err := LoadCheckpoint(path, "sha256:abc", "prod")
+	if err != nil {
+		t.Fatalf("Failed to load checkpoint: %v", err)
+	}
+	if len(loaded.Completed) != 2 || !loaded.Done("group:app_group") || !loaded.Done("user:app_user") || loaded.Done("user:other") {
+		t.Errorf("Unexpected completed entities: %v", loaded.Completed)
+	}
+
+	if _, err := LoadCheckpoint(path, "sha256:def", "prod"); err == nil {
+		t.Error("Expected a checkpoint of another configuration to be refused")
+	}
+	if _, err := LoadCheckpoint(path, "sha256:abc", "staging"); err == nil {
+		t.Error("Expected a checkpoint of another profile to be refused")
+	}
+
+	if err := loaded.Remove(); err != nil {
+		t.Fatalf("Failed to remove checkpoint: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected the checkpoint file to be removed, got %v", err)
+	}
+	if _, err := LoadCheckpoint(path, "sha256:abc", "prod"); err == nil || !strings.Contains(err.Error(), "no checkpoint") {
+		t.Errorf("Expected a missing checkpoint to be reported, got %v", err)
+	}
+}
+
+func TestCheckpointJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json.checkpoint")
+
+	checkpoint := NewCheckpoint(path, "sha256:abc", "")
+	for _, entity := range []string{"group:app_group", "user:app_user"} {
+		if err := checkpoint.MarkDone(entity); err != nil {
+			t.Fatalf("Failed to mark %s done: %v", entity, err)
+		}
+	}
+
+	// One line per entity after the header, with the last cut short by an interruption
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read checkpoint: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 3 || lines[2] != `"user:app_user"` {
+		t.Fatalf("Expected a header and one line per entity, got %q", lines)
+	}
+	if err := os.WriteFile(path, append(data, `"user:cut`...), 0o600); err != nil {
+		t.Fatalf("Failed to write checkpoint: %v", err)
+	}
+
+	// A resumed sync appends to the journal it loaded
+	loaded, err := LoadCheckpoint(path, "sha256:abc", "")
+	if err != nil {
+		t.Fatalf("Failed to load checkpoint: %v", err)
+	}
+	if len(loaded.Completed) != 2 || loaded.Done("user:cut") {
+		t.Errorf("Expected the cut entity to be ignored, got %v", loaded.Completed)
+	}
+	if err := loaded.MarkDone("policy:tenant"); err != nil {
+		t.Fatalf("Failed to mark policy done: %v", err)
+	}
+	reloaded, err := LoadCheckpoint(path, "sha256:abc", "")
+	if err != nil {
+		t.Fatalf("Failed to load checkpoint: %v", err)
+	}
+	if len(reloaded.Completed) != 3 || !reloaded.Done("policy:tenant") || !reloaded.StartedAt.Equal(checkpoint.StartedAt) {
+		t.Errorf("Expected the entity appended to the loaded checkpoint, got %v started %v", reloaded.Completed, reloaded.StartedAt)
+	}
+	if data, _ := os.ReadFile(path); !strings.HasSuffix(string(data), "\"user:app_user\"\n\"policy:tenant\"\n") {
+		t.Errorf("Expected the cut line to be replaced by the appended entity, got %q", data)
+	}
+
+	// A new checkpoint replaces the journal
+	if err := NewCheckpoint(path, "sha256:abc", "").MarkDone("user:other"); err != nil {
+		t.Fatalf("Failed to mark user done: %v", err)
+	}
+	if replaced, err := LoadCheckpoint(path, "sha256:abc", ""); err != nil || len(replaced.Completed) != 1 {
+		t.Errorf("Expected a new checkpoint to start over, got %+v (err: %v)", replaced, err)
+	}
+}
+
+func TestCheckpointEntity(t *testing.T) {
+	logger, _ := test.NewNullLogger()
+	dir := t.TempDir()
+	m := &Manager{logger: logger}
+	m.SetCheckpoint(NewCheckpoint(filepath.Join(dir, "checkpoint"), "sha256:abc", ""))
+	result := &structs.SyncResult{}
+
+	m.checkpointEntity("group:app_group", 0, result)
+
+	// Entities that added errors are synced again on resume
+	result.Errors = append(result.Errors, errors.New("failed"))
+	m.checkpointEntity("user:app_user", 0, result)
+
+	if !m.resumed("group:app_group", result) || m.resumed("user:app_user", result) {
+		t.Errorf("Expected only the entity without errors to be skipped, completed %v", m.checkpoint.Completed)
+	}
+	if len(result.Resumed) != 1 || result.Resumed[0] != "group:app_group" {
+		t.Errorf("Expected the skipped entity in the result, got %v", result.Resumed)
+	}
+
+	// A checkpoint that cannot be written is dropped with a warning
+	m.SetCheckpoint(NewCheckpoint(filepath.Join(dir, "missing", "checkpoint"), "sha256:abc", ""))
+	result = &structs.SyncResult{}
+	m.checkpointEntity("group:app_group", 0, result)
+	if m.checkpoint != nil || len(result.Warnings) != 1 || len(result.Errors) != 0 {
+		t.Errorf("Expected checkpointing to stop with a warning, got warnings=%v errors=%v", result.Warnings, result.Errors)
+	}
+}
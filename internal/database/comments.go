@@ -0,0 +1,172 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// commentMetadataSeparator separates the free-text description of a role comment from its metadata
+	commentMetadataSeparator = " | "
+
+	// externalIDMetadataKey records the identity provider ID a user was created for, so a
+	// different identity whose login sanitizes to the same name is not given the role
+	externalIDMetadataKey = "external_id"
+)
+
+// SetPrincipal sets the principal recorded in role comments for changes made by this manager
+func (m *Manager) SetPrincipal(principal string) {
+	m.principal = principal
+}
+
+// GetRoleComment returns the comment on a role, or an empty string when it has none
+func (m *Manager) GetRoleComment(role string) (string, error) {
+	var comment sql.NullString
+	err := m.executor().QueryRow("SELECT shobj_description(oid, 'pg_authid') FROM pg_roles WHERE rolname = $1", role).Scan(&comment)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get comment of role %s: %w", role, err)
+	}
+	return comment.String, nil
+}
+
+// RoleExternalID reports whether a role exists and the identity provider ID recorded when
+// it was created, which is empty for roles not created from identity provider events
+func (m *Manager) RoleExternalID(role string) (bool, string, error) {
+	var comment sql.NullString
+	err := m.executor().QueryRow("SELECT shobj_description(oid, 'pg_authid') FROM pg_roles WHERE rolname = $1", role).Scan(&comment)
+	if err == sql.ErrNoRows {
+		return false, "", nil
+	}
+	if err != nil {
+		return false, "", fmt.Errorf("failed to get comment of role %s: %w", role, err)
+	}
+	_, metadata := parseRoleComment(comment.String)
+	return true, metadata[externalIDMetadataKey], nil
+}
+
+// GetRoleDescription returns the free-text description in a role's comment, without the metadata
+func (m *Manager) GetRoleDescription(role string) (string, error) {
+	comment, err := m.GetRoleComment(role)
+	if err != nil {
+		return "", err
+	}
+	description, _ := parseRoleComment(comment)
+	return description, nil
+}
+
+// SetRoleDescription replaces the description in a role's comment, keeping its metadata and
+// leaving the comment untouched when it already matches. An empty description is ignored,
+// so descriptions written outside of the configuration are not wiped.
+func (m *Manager) SetRoleDescription(role, description string) error {
+	if description == "" {
+		return nil
+	}
+
+	current, err := m.GetRoleDescription(role)
+	if err != nil {
+		return err
+	}
+	if current == description {
+		return nil
+	}
+
+	m.logger.WithField("role", role).Info("Updating role description")
+	return m.stampRole(role, description, "described", nil)
+}
+
+// stampRole records an action, the initiating principal and any extra metadata in a role's
+// comment, keeping the existing description and metadata. A non-empty description replaces the existing one,
+// and extra metadata with an empty value removes the key.
+func (m *Manager) stampRole(role, description, action string, extra map[string]string) error {
+	if m.principal == "" && description == "" && len(extra) == 0 {
+		return nil
+	}
+
+	existing := ""
+	if !m.dryRun {
+		var err error
+		if existing, err = m.GetRoleComment(role); err != nil {
+			return err
+		}
+	}
+
+	currentDescription, metadata := parseRoleComment(existing)
+	if description == "" {
+		description = currentDescription
+	}
+	for key, value := range extra {
+		if value == "" {
+			delete(metadata, key)
+			continue
+		}
+		metadata[key] = value
+	}
+	if m.principal != "" {
+		metadata[action+"_by"] = m.principal
+	}
+	metadata[action+"_at"] = time.Now().UTC().Format(time.RFC3339)
+
+	query := fmt.Sprintf("COMMENT ON ROLE %s IS '%s'",
+		m.quoteIdentifier(role), m.escapeString(formatRoleComment(description, metadata)))
+	if err := m.execute(query); err != nil {
+		return fmt.Errorf("failed to comment on role %s: %w", role, err)
+	}
+
+	m.logger.WithFields(logrus.Fields{
+		"role":      role,
+		"action":    action,
+		"principal": m.principal,
+	}).Debug("Role comment updated")
+	return nil
+}
+
+// formatRoleComment formats a role comment as "description | key=value; key=value"
+// with the metadata keys in order
+func formatRoleComment(description string, metadata map[string]string) string {
+	if len(metadata) == 0 {
+		return description
+	}
+
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = key + "=" + metadata[key]
+	}
+
+	return description + commentMetadataSeparator + strings.Join(pairs, "; ")
+}
+
+// parseRoleComment splits a role comment into its description and metadata. Comments
+// that were not written by this tool are returned as the description.
+func parseRoleComment(comment string) (string, map[string]string) {
+	metadata := make(map[string]string)
+
+	idx := strings.LastIndex(comment, commentMetadataSeparator)
+	if idx < 0 {
+		return comment, metadata
+	}
+	description, rest := comment[:idx], comment[idx+len(commentMetadataSeparator):]
+
+	for _, pair := range strings.Split(rest, ";") {
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || key == "" {
+			return comment, map[string]string{}
+		}
+		metadata[key] = value
+	}
+
+	return description, metadata
+}
@@ -0,0 +1,146 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+func TestFormatRoleComment(t *testing.T) {
+	comment := formatRoleComment("Reporting user", map[string]string{
+		"created_by": "os:alice",
+		"created_at": "2024-01-02T03:04:05Z",
+	})
+
+	expected := "Reporting user | created_at=2024-01-02T03:04:05Z; created_by=os:alice"
+	if comment != expected {
+		t.Errorf("Expected %q, got %q", expected, comment)
+	}
+
+	if formatRoleComment("Plain", nil) != "Plain" {
+		t.Error("Expected comment without metadata to be the description")
+	}
+}
+
+func TestParseRoleComment(t *testing.T) {
+	tests := []struct {
+		name        string
+		comment     string
+		description string
+		metadata    map[string]string
+	}{
+		{
+			name:        "description and metadata",
+			comment:     "Reporting user | created_by=os:alice; disabled_by=aws:arn:aws:iam::1:user/bob",
+			description: "Reporting user",
+			metadata:    map[string]string{"created_by": "os:alice", "disabled_by": "aws:arn:aws:iam::1:user/bob"},
+		},
+		{
+			name:        "metadata only",
+			comment:     " | created_by=os:alice",
+			description: "",
+			metadata:    map[string]string{"created_by": "os:alice"},
+		},
+		{
+			name:        "foreign comment",
+			comment:     "Owned by the data team | ask in #data",
+			description: "Owned by the data team | ask in #data",
+			metadata:    map[string]string{},
+		},
+		{
+			name:        "empty",
+			comment:     "",
+			description: "",
+			metadata:    map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			description, metadata := parseRoleComment(tt.comment)
+			if description != tt.description {
+				t.Errorf("Expected description %q, got %q", tt.description, description)
+			}
+			if len(metadata) != len(tt.metadata) {
+				t.Fatalf("Expected metadata %v, got %v", tt.metadata, metadata)
+			}
+			for key, value := range tt.metadata {
+				if metadata[key] != value {
+					t.Errorf("Expected %s=%s, got %s", key, value, metadata[key])
+				}
+			}
+		})
+	}
+}
+
+func TestCreateUserRecordsPrincipal(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	setup.Manager.SetPrincipal("os:alice")
+	defer setup.Manager.SetPrincipal("")
+
+	userConfig := &structs.UserConfig{
+		Username:    "test_user",
+		Password:    "test_pass",
+		Description: "Test user",
+		CanLogin:    true,
+		Enabled:     true,
+	}
+	if err := setup.Manager.CreateUser(userConfig); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	comment, err := setup.Manager.GetRoleComment("test_user")
+	if err != nil {
+		t.Fatalf("Failed to get role comment: %v", err)
+	}
+
+	description, metadata := parseRoleComment(comment)
+	if description != "Test user" {
+		t.Errorf("Expected description 'Test user', got %q", description)
+	}
+	if metadata["created_by"] != "os:alice" || metadata["created_at"] == "" {
+		t.Errorf("Expected creation to be attributed to os:alice, got %v", metadata)
+	}
+}
+
+func TestSyncUpdatesRoleDescription(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	config := &structs.Config{
+		Groups: []structs.GroupConfig{{Name: "test_group", Description: "Readers", Inherit: true}},
+		Users: []structs.UserConfig{
+			{Username: "test_user", Password: "test_pass", Description: "Reporting user", Enabled: true, CanLogin: true},
+		},
+	}
+	if _, err := setup.Manager.SyncConfiguration(config); err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+
+	config.Users[0].Description = "Reporting service"
+	if _, err := setup.Manager.SyncConfiguration(config); err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+
+	info, err := setup.Manager.GetUserInfo("test_user")
+	if err != nil {
+		t.Fatalf("Failed to get user info: %v", err)
+	}
+	if info.Description != "Reporting service" {
+		t.Errorf("Expected the changed description to be applied, got %q", info.Description)
+	}
+
+	// Metadata written by earlier syncs survives the description change
+	comment, _ := setup.Manager.GetRoleComment("test_user")
+	if _, metadata := parseRoleComment(comment); metadata[managedMetadataKey] != ManagedKindUser {
+		t.Errorf("Expected managed metadata to be kept, got %q", comment)
+	}
+
+	if description, _ := setup.Manager.GetRoleDescription("test_group"); description != "Readers" {
+		t.Errorf("Expected group description 'Readers', got %q", description)
+	}
+}
@@ -0,0 +1,120 @@
+package database
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+// ConnectionInfo reports how the manager is connected: the connection settings, the role it
+// authenticated as and whether the connection is encrypted
+func (m *Manager) ConnectionInfo() (*structs.ConnectionInfo, error) {
+	info := &structs.ConnectionInfo{
+		Host:          m.conn.Host,
+		Port:          m.conn.Port,
+		Database:      m.conn.Database,
+		AuthMethod:    structs.AuthMethodPassword,
+		SSLMode:       m.conn.SSLMode,
+		SSLModeSource: m.conn.SSLModeSource,
+	}
+	if m.conn.IAMAuth {
+		info.AuthMethod = structs.AuthMethodIAM
+	}
+
+	query := `
+		SELECT session_user, current_user, r.rolsuper, r.rolcreaterole,
+			COALESCE(s.ssl, false), COALESCE(s.version, ''), current_setting('server_version')
+		FROM pg_roles r
+		LEFT JOIN pg_stat_ssl s ON s.pid = pg_backend_pid()
+		WHERE r.rolname = session_user`
+
+	err := m.executor().QueryRow(query).Scan(&info.Role, &info.CurrentRole, &info.Superuser, &info.CreateRole,
+		&info.SSL, &info.SSLVersion, &info.ServerVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection info: %w", err)
+	}
+
+	return info, nil
+}
+
+// GetConnectionUsage returns the connection limit and current connection count of every login role
+func (m *Manager) GetConnectionUsage() ([]structs.ConnectionUsage, error) {
+	query := `
+		SELECT r.rolname, r.rolconnlimit, count(a.pid)
+		FROM pg_roles r
+		LEFT JOIN pg_stat_activity a ON a.usename = r.rolname
+		WHERE r.rolcanlogin
+		GROUP BY r.rolname, r.rolconnlimit
+		ORDER BY r.rolname`
+
+	rows, err := m.executor().Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection usage: %w", err)
+	}
+	defer rows.Close()
+
+	usage := []structs.ConnectionUsage{}
+	for rows.Next() {
+		var u structs.ConnectionUsage
+		if err := rows.Scan(&u.Role, &u.Limit, &u.Connections); err != nil {
+			return nil, err
+		}
+		usage = append(usage, u)
+	}
+
+	return usage, rows.Err()
+}
+
+// SetConnectionLimit changes the connection limit of a role outside of sync, for example to
+// contain a service exhausting connections, and records who changed it in the role comment.
+// A limit of -1 is unlimited and 0 refuses new connections; existing sessions are kept. It
+// returns the previous limit.
+func (m *Manager) SetConnectionLimit(role string, limit int) (int, error) {
+	if limit < -1 || limit > math.MaxInt32 {
+		return 0, fmt.Errorf("invalid connection limit %d (must be -1 for unlimited or between 0 and %d)", limit, math.MaxInt32)
+	}
+
+	attributes, err := m.GetRoleAttributes(role)
+	if err != nil {
+		return 0, err
+	}
+	if attributes == nil {
+		return 0, fmt.Errorf("role %s does not exist", role)
+	}
+	if attributes.ConnectionLimit == limit {
+		m.logger.WithFields(logrus.Fields{
+			"role":  role,
+			"limit": limit,
+		}).Info("Connection limit is already set, skipping")
+		return limit, nil
+	}
+
+	m.logger.WithFields(logrus.Fields{
+		"role":      role,
+		"previous":  attributes.ConnectionLimit,
+		"limit":     limit,
+		"principal": m.principal,
+	}).Warn("Changing connection limit outside of sync")
+
+	query := fmt.Sprintf("ALTER ROLE %s CONNECTION LIMIT %d", m.quoteIdentifier(role), limit)
+	if err := m.execute(query); err != nil {
+		return attributes.ConnectionLimit, fmt.Errorf("failed to set connection limit of role %s: %w", role, err)
+	}
+
+	// Record who changed the limit
+	if err := m.stampRole(role, "", "connection_limit_changed", nil); err != nil {
+		return attributes.ConnectionLimit, err
+	}
+
+	return attributes.ConnectionLimit, nil
+}
+
+// Ping checks that the database is reachable
+func (m *Manager) Ping() error {
+	if err := m.db.PingContext(m.context()); err != nil {
+		return fmt.Errorf("failed to reach database: %w", err)
+	}
+	return nil
+}
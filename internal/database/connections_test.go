@@ -0,0 +1,92 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+func TestGetConnectionUsage(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	user := &structs.UserConfig{Username: "test_user", Password: "test_pass", CanLogin: true, ConnectionLimit: 5}
+	if err := setup.Manager.CreateUser(user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	usage, err := setup.Manager.GetConnectionUsage()
+	if err != nil {
+		t.Fatalf("Failed to get connection usage: %v", err)
+	}
+
+	found := false
+	for _, u := range usage {
+		if u.Role == "test_user" {
+			found = true
+			if u.Limit != 5 || u.Connections != 0 {
+				t.Errorf("Expected limit 5 and no connections, got %+v", u)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("Expected test_user in connection usage, got %+v", usage)
+	}
+}
+
+func TestSetConnectionLimit(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	user := &structs.UserConfig{Username: "test_user", Password: "test_pass", CanLogin: true, ConnectionLimit: 5}
+	if err := setup.Manager.CreateUser(user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	previous, err := setup.Manager.SetConnectionLimit("test_user", 0)
+	if err != nil || previous != 5 {
+		t.Fatalf("Expected previous limit 5, got %d (err: %v)", previous, err)
+	}
+	attributes, err := setup.Manager.GetRoleAttributes("test_user")
+	if err != nil || attributes.ConnectionLimit != 0 {
+		t.Fatalf("Expected connection limit 0, got %+v (err: %v)", attributes, err)
+	}
+
+	comment, _ := setup.Manager.GetRoleComment("test_user")
+	if _, metadata := parseRoleComment(comment); metadata["connection_limit_changed_at"] == "" {
+		t.Errorf("Expected the change to be recorded in the role comment, got %q", comment)
+	}
+
+	if _, err := setup.Manager.SetConnectionLimit("missing_user", 5); err == nil {
+		t.Error("Expected an error for a role that does not exist")
+	}
+}
+
+func TestSetConnectionLimitInvalid(t *testing.T) {
+	manager := &Manager{}
+	if _, err := manager.SetConnectionLimit("test_user", -2); err == nil {
+		t.Error("Expected an error for a connection limit below -1")
+	}
+}
+
+func TestConnectionInfo(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+
+	info, err := setup.Manager.ConnectionInfo()
+	if err != nil {
+		t.Fatalf("Failed to get connection info: %v", err)
+	}
+
+	if info.Role == "" || info.Role != info.CurrentRole {
+		t.Errorf("Expected the connected role as session and current role, got %+v", info)
+	}
+	if info.AuthMethod != structs.AuthMethodPassword || info.SSLMode != "disable" || info.SSL {
+		t.Errorf("Expected an unencrypted password connection, got %+v", info)
+	}
+	if info.ServerVersion == "" {
+		t.Error("Expected the server version")
+	}
+}
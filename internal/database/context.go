@@ -0,0 +1,54 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+// SetContext sets the context statements and queries run with from now on, so they are
+// cancelled when it is done, for example when a timeout expires. A sync stops before the
+// next user, group or policy once the context is done.
+func (m *Manager) SetContext(ctx context.Context) {
+	m.ctx = ctx
+}
+
+// context returns the context statements and queries run with
+func (m *Manager) context() context.Context {
+	if m.ctx == nil {
+		return context.Background()
+	}
+	return m.ctx
+}
+
+// stopSync reports whether a sync should stop before the next entity: because a
+// transactional sync failed, or because the context is done, which is recorded as an error
+func (m *Manager) stopSync(result *structs.SyncResult) bool {
+	if m.syncFailed(result) {
+		return true
+	}
+	err := m.context().Err()
+	if err == nil {
+		return false
+	}
+
+	// Record why the sync stopped once, unless a statement already failed with it
+	for _, recorded := range result.Errors {
+		if errors.Is(recorded, err) {
+			return true
+		}
+	}
+	result.Errors = append(result.Errors, fmt.Errorf("sync stopped: %w", err))
+	return true
+}
+
+// uncancelled runs fn with a context that is not cancelled with the manager's, for cleanup
+// that must happen even after a sync was stopped
+func (m *Manager) uncancelled(fn func()) {
+	ctx := m.ctx
+	m.ctx = context.WithoutCancel(m.context())
+	defer func() { m.ctx = ctx }()
+	fn()
+}
@@ -0,0 +1,41 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+func TestStopSyncRecordsCancellationOnce(t *testing.T) {
+	m := &Manager{}
+	result := &structs.SyncResult{}
+	if m.stopSync(result) {
+		t.Fatal("Expected a sync without a context to continue")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.SetContext(ctx)
+	if m.stopSync(result) {
+		t.Fatal("Expected a sync with a live context to continue")
+	}
+
+	cancel()
+	if !m.stopSync(result) || !m.stopSync(result) {
+		t.Fatal("Expected a sync with a cancelled context to stop")
+	}
+	if len(result.Errors) != 1 || !errors.Is(result.Errors[0], context.Canceled) {
+		t.Errorf("Expected one cancellation error, got %v", result.Errors)
+	}
+
+	// Cleanup still runs with a live context
+	m.uncancelled(func() {
+		if err := m.context().Err(); err != nil {
+			t.Errorf("Expected an uncancelled context, got %v", err)
+		}
+	})
+	if m.context().Err() == nil {
+		t.Error("Expected the cancelled context to be restored after cleanup")
+	}
+}
@@ -1,21 +1,70 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/secrets"
 	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
-	_ "github.com/lib/pq" // PostgreSQL driver
+	"github.com/lib/pq"
 	"github.com/sirupsen/logrus"
 )
 
 // Manager handles database operations
 type Manager struct {
-	db     *sql.DB
-	logger *logrus.Logger
-	dryRun bool
+	db                 *sql.DB
+	ctx                context.Context             // Cancels statements and queries when done, e.g. on a timeout
+	conn               *structs.DatabaseConnection // Connection details, to reach other databases of the cluster
+	logger             *logrus.Logger
+	dryRun             bool
+	slowThreshold      time.Duration
+	exactMemberships   bool
+	exactPrivileges    bool
+	principal          string
+	skipPreflight      bool
+	changeLimits       structs.ChangeLimitsConfig // Removals a sync may make, zero values unchecked
+	allowLargeChange   bool
+	rotateMaxAge       time.Duration // Age at which sync rotates generated passwords, zero to never rotate
+	overrideProtection bool
+	reassignTo         string        // Role that receives the objects of dropped roles, empty to leave them
+	cascade            bool          // Drop the objects of dropped roles when they are not reassigned
+	objectDatabases    []string      // Other databases the objects of dropped roles are reassigned or dropped in as well
+	terminateSessions  bool          // Terminate the sessions of users before dropping them
+	terminateGrace     time.Duration // How long sessions may disconnect on their own before they are terminated
+	prune              string
+	roleSource         string // Source tagged on the roles the manager creates or marks managed, empty to not tag
+	redactPasswords    bool
+	autoGrantAdmin     bool
+	adminGrants        []adminGrant
+	roles              roleCache // Role lookups cached for the rest of the command
+	cacheDisabled      bool
+	checkpoint         *Checkpoint // Entities completed by this or an interrupted sync, nil when not checkpointing
+	passwordsUnread    bool
+	entity             string                     // Entity the current sync operation applies to
+	statements         []structs.PlannedStatement // Dry-run statements collected during a sync, nil otherwise
+	plannedRoles       map[string]bool            // Roles a dry run would create (true) or drop (false)
+	grantWorkers       int
+	userWorkers        int // New users a sync creates at the same time
+	databasesMu        sync.Mutex
+	databases          map[string]*databaseConnection // Connections to other databases, opened on first use
+	transactional      bool
+	tx                 *sql.Tx                    // Transaction of a transactional sync, nil otherwise
+	deferredGrants     []deferredObjectGrants     // Grants in other databases waiting for the sync transaction to commit
+	hooks              []roleHook                 // Hooks run after a user or group is created
+	deferredHooks      []deferredHook             // Hooks with SQL in other databases or commands waiting for the sync transaction to commit
+	deferredApplies    []deferredApply            // Schemas and policies in other databases waiting for the sync transaction to commit
+	deferredSessions   []string                   // Users disabled in the sync transaction whose sessions are terminated once it commits
+	writableOnce       sync.Once                  // Checks once that the server is not a read replica
+	writableErr        error                      // Why the server cannot be written to, nil when it can
+	counts             statementCounts            // Statements and queries run on the connected database
+	deferElevated      bool                       // Leave statements needing privileges the connected role lacks to a script
+	elevated           *elevatedAccess            // What the connected role lacks for the current sync, nil when nothing is deferred
+	elevatedStatements []structs.PlannedStatement // Statements left to the elevated script during the current sync
 }
 
 const (
@@ -24,54 +73,84 @@ const (
 
 // NewManager creates a new database manager with support for IAM authentication
 func NewManager(conn *structs.DatabaseConnection, logger *logrus.Logger, dryRun bool) (*Manager, error) {
-	var connStr string
-	
-	if conn.IAMAuth {
-		// For IAM authentication, use the IAM token as password
-		// Note: In a real implementation, you'd generate the IAM token using AWS SDK
-		logger.Info("Setting up database connection with IAM authentication")
-		
-		password := conn.IAMToken
-		if password == "" {
-			// In production, you would generate the IAM token here using AWS SDK
-			// For now, we'll use a placeholder to indicate IAM auth is being used
-			logger.Warn("IAM token not provided - in production this would be generated using AWS SDK")
-			password = "PLACEHOLDER_IAM_TOKEN"
-		}
-		
-		connStr = fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
-			conn.Host, conn.Port, conn.Username, password, conn.Database, conn.SSLMode)
-	} else {
-		// Traditional password authentication
-		logger.Info("Setting up database connection with password authentication")
-		connStr = fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
-			conn.Host, conn.Port, conn.Username, conn.Password, conn.Database, conn.SSLMode)
+	return NewManagerContext(context.Background(), conn, logger, dryRun)
+}
+
+// NewManagerContext creates a new database manager whose connection, statements and queries
+// are cancelled when the context is done
+func NewManagerContext(ctx context.Context, conn *structs.DatabaseConnection, logger *logrus.Logger, dryRun bool) (*Manager, error) {
+	conn, err := resolveRootCert(ctx, conn, logger)
+	if err != nil {
+		return nil, err
 	}
 
-	db, err := sql.Open("postgres", connStr)
+	db, err := openDatabase(conn, logger)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database connection: %w", err)
+		return nil, err
 	}
 
-	// Test the connection (skip ping for dry run mode to avoid auth issues during development)
+	// Test the connection (skip ping for dry run mode to avoid auth issues during development),
+	// retrying while the cluster is unreachable or a paused serverless cluster resumes
 	if !dryRun {
-		if err := db.Ping(); err != nil {
+		if err := pingWithRetry(ctx, db, conn, logger); err != nil {
+			db.Close()
 			return nil, fmt.Errorf("failed to ping database: %w", err)
 		}
 		logger.Info("Database connection established successfully")
+
+		// With the cluster's endpoints listed, a read replica is swapped for the writer
+		if len(conn.Endpoints) > 0 {
+			db, conn = connectToWriter(ctx, db, conn, logger)
+		}
 	} else {
 		logger.Info("Database connection configured (skipping ping in dry-run mode)")
 	}
 
+	connected := *conn
 	return &Manager{
-		db:     db,
-		logger: logger,
-		dryRun: dryRun,
+		db:            db,
+		ctx:           ctx,
+		conn:          &connected,
+		logger:        logger,
+		dryRun:        dryRun,
+		slowThreshold: DefaultSlowOperationThreshold,
+		grantWorkers:  DefaultGrantWorkers,
+		userWorkers:   DefaultUserWorkers,
 	}, nil
 }
 
-// Close closes the database connection
+// openDatabase opens a connection pool with the authentication method of the connection
+func openDatabase(conn *structs.DatabaseConnection, logger *logrus.Logger) (*sql.DB, error) {
+	var db *sql.DB
+	var err error
+
+	switch {
+	case conn.IAMAuth && conn.IAMToken != "":
+		// An explicitly supplied token is used as is and is not refreshed
+		logger.Info("Setting up database connection with the supplied IAM auth token")
+		db, err = openConnection(conn, connectionString(conn, conn.IAMToken))
+	case conn.IAMAuth:
+		// Tokens are generated from the AWS credentials chain and refreshed before they expire
+		logger.Info("Setting up database connection with IAM authentication")
+		var connector *iamConnector
+		if connector, err = newIAMConnector(conn, logger); err == nil {
+			db = sql.OpenDB(connector)
+		}
+	default:
+		// Traditional password authentication
+		logger.Info("Setting up database connection with password authentication")
+		db, err = openConnection(conn, connectionString(conn, conn.Password))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database connection: %w", err)
+	}
+	configurePool(db, conn.Pool)
+	return db, nil
+}
+
+// Close closes the database connection and any connections opened to other databases
 func (m *Manager) Close() error {
+	m.closeDatabases()
 	if m.db != nil {
 		return m.db.Close()
 	}
@@ -81,10 +160,15 @@ func (m *Manager) Close() error {
 // CreateUser creates a new database user with support for IAM authentication
 func (m *Manager) CreateUser(user *structs.UserConfig) error {
 	m.logger.WithFields(logrus.Fields{
-		"username":    user.Username,
-		"auth_method": user.AuthMethod,
+		"username":     user.Username,
+		"auth_methods": user.EffectiveAuthMethods(),
 	}).Info("Creating user")
 
+	// PostgreSQL would truncate or reject the name rather than create the role asked for
+	if err := structs.CheckIdentifier(user.Username); err != nil {
+		return fmt.Errorf("cannot create user: %w", err)
+	}
+
 	// Check if user already exists
 	exists, err := m.UserExists(user.Username)
 	if err != nil {
@@ -96,45 +180,87 @@ func (m *Manager) CreateUser(user *structs.UserConfig) error {
 		return nil
 	}
 
+	// Users asking for a generated password get one here; it is filled into the user
+	// configuration once the user exists so the caller can hand it over
+	created := user
+	if user.GeneratePassword && user.Password == "" && user.HasAuthMethod(structs.AuthMethodPassword) {
+		password, err := secrets.GeneratePassword(user.PasswordLength, user.PasswordCharset)
+		if err != nil {
+			return fmt.Errorf("failed to generate password for user %s: %w", user.Username, err)
+		}
+		withPassword := *user
+		withPassword.Password = password
+		created = &withPassword
+	}
+
 	// Build CREATE USER query based on authentication method
-	query := m.buildCreateUserQuery(user)
+	query, err := m.buildCreateUserQuery(created)
+	if err != nil {
+		return fmt.Errorf("failed to build query for user %s: %w", user.Username, err)
+	}
 
 	if m.dryRun {
-		m.logger.WithField("query", query).Info(msgDryRunExecuteQuery)
-		return nil
+		m.dryRunQuery(query)
+		m.planRole(user.Username, true)
+		return m.runUserHooks(user)
 	}
 
-	if _, err := m.db.Exec(query); err != nil {
+	_, err = m.executor().Exec(query)
+	m.invalidateAfter(query)
+	if err != nil {
 		return fmt.Errorf("failed to create user %s: %w", user.Username, err)
 	}
+	user.Password = created.Password
 
 	// For IAM authentication, grant rds_iam role
-	if user.AuthMethod == "iam" {
+	if user.HasAuthMethod(structs.AuthMethodIAM) {
 		if err := m.grantRDSIAMRole(user.Username); err != nil {
 			return fmt.Errorf("failed to grant rds_iam role to user %s: %w", user.Username, err)
 		}
 	}
 
+	// Record who created the user, who is accountable for it and how it authenticates
+	metadata := ownershipMetadata(user.Owner, user.Team, user.Ticket)
+	metadata["auth"] = strings.Join(user.EffectiveAuthMethods(), ",")
+	// Separators would break the comment metadata, and identity provider IDs never contain them
+	if user.ExternalID != "" && !strings.ContainsAny(user.ExternalID, ";=|") {
+		metadata[externalIDMetadataKey] = user.ExternalID
+	}
+	if created.Password != "" && user.HasAuthMethod(structs.AuthMethodPassword) {
+		metadata[passwordChangedMetadataKey] = time.Now().UTC().Format(time.RFC3339)
+	}
+	if m.roleSource != "" {
+		metadata = m.managedMetadata(ManagedKindUser, metadata)
+	}
+	if err := m.stampRole(user.Username, user.Description, "created", metadata); err != nil {
+		return err
+	}
+
 	m.logger.WithField("username", user.Username).Info("User created successfully")
-	return nil
+	return m.runUserHooks(user)
 }
 
-// buildCreateUserQuery builds the appropriate CREATE USER query based on auth method
-func (m *Manager) buildCreateUserQuery(user *structs.UserConfig) string {
+// buildCreateUserQuery builds the appropriate CREATE USER query based on auth method.
+// Passwords are sent as SCRAM-SHA-256 verifiers, never as plain text.
+func (m *Manager) buildCreateUserQuery(user *structs.UserConfig) (string, error) {
 	query := fmt.Sprintf("CREATE USER %s", m.quoteIdentifier(user.Username))
-	
-	// Set authentication method specific options
-	switch user.AuthMethod {
-	case "iam":
-		// For IAM authentication, no password is needed
-		// The user will authenticate using AWS IAM
-		m.logger.WithField("username", user.Username).Info("Creating user for IAM authentication (no password)")
-		
-	default:
-		// Traditional password authentication
+
+	// Set a password for password authentication, including IAM users with a password fallback
+	if user.HasAuthMethod(structs.AuthMethodPassword) {
 		if user.Password != "" {
-			query += fmt.Sprintf(" WITH PASSWORD '%s'", m.escapeString(user.Password))
+			verifier, err := scramSHA256Verifier(user.Password)
+			if err != nil {
+				return "", err
+			}
+			query += " WITH PASSWORD " + pq.QuoteLiteral(verifier)
 		}
+	} else if user.HasAuthMethod(structs.AuthMethodCert) {
+		// Client certificate users authenticate through pg_hba.conf, never with a password
+		m.logger.WithField("username", user.Username).Info("Creating user for client certificate authentication (no password)")
+	} else {
+		// For IAM-only authentication, no password is needed
+		// The user will authenticate using AWS IAM
+		m.logger.WithField("username", user.Username).Info("Creating user for IAM authentication (no password)")
 	}
 	
 	// Add LOGIN/NOLOGIN based on CanLogin setting
@@ -143,7 +269,12 @@ func (m *Manager) buildCreateUserQuery(user *structs.UserConfig) string {
 	} else {
 		query += " NOLOGIN"
 	}
-	
+
+	// NOINHERIT users only get the privileges of their groups after SET ROLE
+	if user.NoInherit {
+		query += " NOINHERIT"
+	}
+
 	// Set connection limit if specified
 	if user.ConnectionLimit != 0 {
 		if user.ConnectionLimit == -1 {
@@ -152,22 +283,192 @@ func (m *Manager) buildCreateUserQuery(user *structs.UserConfig) string {
 			query += fmt.Sprintf(" CONNECTION LIMIT %d", user.ConnectionLimit)
 		}
 	}
-	
-	return query
+
+	// Set the password expiry if specified
+	if user.ValidUntil != nil {
+		query += " VALID UNTIL " + validUntilLiteral(*user.ValidUntil)
+	}
+
+	return query, nil
+}
+
+// AlterUser brings the login, inheritance, connection limit and password of an existing user
+// in line with its configuration, as CreateUser leaves existing users alone. It reports
+// whether the user was changed.
+func (m *Manager) AlterUser(user *structs.UserConfig) (bool, error) {
+	attributes, err := m.GetRoleAttributes(user.Username)
+	if err != nil {
+		return false, err
+	}
+	if attributes == nil {
+		return false, nil
+	}
+
+	changes, err := m.userAttributeChanges(user, attributes)
+	if err != nil || len(changes) == 0 {
+		return false, err
+	}
+
+	var clauses, changed []string
+	var metadata map[string]string
+	for _, change := range changes {
+		changed = append(changed, change.Attribute)
+		switch change.Attribute {
+		case "login":
+			if user.CanLogin {
+				clauses = append(clauses, "LOGIN")
+			} else {
+				clauses = append(clauses, "NOLOGIN")
+			}
+		case "inherit":
+			if user.NoInherit {
+				clauses = append(clauses, "NOINHERIT")
+			} else {
+				clauses = append(clauses, "INHERIT")
+			}
+		case "connection_limit":
+			clauses = append(clauses, fmt.Sprintf("CONNECTION LIMIT %d", desiredConnectionLimit(user)))
+		case "valid_until":
+			clauses = append(clauses, "VALID UNTIL "+validUntilLiteral(*user.ValidUntil))
+		case "password":
+			verifier, err := scramSHA256Verifier(user.Password)
+			if err != nil {
+				return false, err
+			}
+			clauses = append(clauses, "PASSWORD "+pq.QuoteLiteral(verifier))
+			metadata = map[string]string{passwordChangedMetadataKey: time.Now().UTC().Format(time.RFC3339)}
+		}
+	}
+
+	m.logger.WithFields(logrus.Fields{
+		"username": user.Username,
+		"changed":  changed,
+	}).Info("Altering user")
+
+	query := fmt.Sprintf("ALTER ROLE %s %s", m.quoteIdentifier(user.Username), strings.Join(clauses, " "))
+	if err := m.execute(query); err != nil {
+		return false, fmt.Errorf("failed to alter user %s: %w", user.Username, err)
+	}
+
+	// Record who changed the user, and when its password was rotated
+	if err := m.stampRole(user.Username, "", "modified", metadata); err != nil {
+		return true, err
+	}
+
+	m.logger.WithField("username", user.Username).Info("User altered successfully")
+	return true, nil
+}
+
+// userAttributeChanges compares the login, inheritance, connection limit and password of an
+// existing user with its configuration. Passwords are only compared when the connected role can
+// read the stored verifiers; otherwise they are left alone.
+func (m *Manager) userAttributeChanges(user *structs.UserConfig, attributes *structs.RoleAttributes) ([]structs.AttributeChange, error) {
+	var changes []structs.AttributeChange
+
+	if attributes.CanLogin != user.CanLogin {
+		changes = append(changes, structs.AttributeChange{
+			Role:      user.Username,
+			Attribute: "login",
+			Current:   strconv.FormatBool(attributes.CanLogin),
+			Desired:   strconv.FormatBool(user.CanLogin),
+		})
+	}
+
+	if attributes.Inherit == user.NoInherit {
+		changes = append(changes, structs.AttributeChange{
+			Role:      user.Username,
+			Attribute: "inherit",
+			Current:   strconv.FormatBool(attributes.Inherit),
+			Desired:   strconv.FormatBool(!user.NoInherit),
+		})
+	}
+
+	if limit := desiredConnectionLimit(user); attributes.ConnectionLimit != limit {
+		changes = append(changes, structs.AttributeChange{
+			Role:      user.Username,
+			Attribute: "connection_limit",
+			Current:   strconv.Itoa(attributes.ConnectionLimit),
+			Desired:   strconv.Itoa(limit),
+		})
+	}
+
+	// PostgreSQL keeps microseconds, so finer configured times would never match
+	if user.ValidUntil != nil {
+		desired := user.ValidUntil.Truncate(time.Microsecond)
+		if attributes.ValidUntil == nil || !attributes.ValidUntil.Equal(desired) {
+			current := "never"
+			if attributes.ValidUntil != nil {
+				current = attributes.ValidUntil.UTC().Format(time.RFC3339)
+			}
+			changes = append(changes, structs.AttributeChange{
+				Role:      user.Username,
+				Attribute: "valid_until",
+				Current:   current,
+				Desired:   desired.UTC().Format(time.RFC3339),
+			})
+		}
+	}
+
+	if user.HasAuthMethod(structs.AuthMethodPassword) && user.Password != "" {
+		verifier, readable, err := m.getPasswordVerifier(user.Username)
+		if err != nil {
+			return nil, err
+		}
+		if !readable {
+			if !m.passwordsUnread {
+				m.passwordsUnread = true
+				m.logger.Warn("Connected role cannot read stored passwords, so password changes in the configuration are not applied to existing users")
+			}
+		} else if !passwordMatchesVerifier(user.Username, user.Password, verifier) {
+			current := "(set)"
+			if verifier == "" {
+				current = "(none)"
+			}
+			changes = append(changes, structs.AttributeChange{
+				Role:      user.Username,
+				Attribute: "password",
+				Current:   current,
+				Desired:   "(changed)",
+			})
+		}
+	}
+
+	return changes, nil
+}
+
+// validUntilLiteral formats a password expiry as a timestamp literal for VALID UNTIL
+func validUntilLiteral(t time.Time) string {
+	return pq.QuoteLiteral(t.UTC().Format("2006-01-02 15:04:05.999999Z07:00"))
+}
+
+// desiredConnectionLimit returns the connection limit a user should have, where an unset
+// limit means unlimited (-1)
+func desiredConnectionLimit(user *structs.UserConfig) int {
+	if user.ConnectionLimit == 0 {
+		return -1
+	}
+	return user.ConnectionLimit
 }
 
 // grantRDSIAMRole grants the rds_iam role to a user for IAM authentication
 func (m *Manager) grantRDSIAMRole(username string) error {
 	m.logger.WithField("username", username).Info("Granting rds_iam role for IAM authentication")
-	
+
+	if err := m.ensureAdminMembership("rds_iam"); err != nil {
+		return err
+	}
+
 	query := fmt.Sprintf("GRANT rds_iam TO %s", m.quoteIdentifier(username))
-	
+	if m.leaveToElevated(query, m.elevated.membership("rds_iam")) {
+		return nil
+	}
+
 	if m.dryRun {
-		m.logger.WithField("query", query).Info(msgDryRunExecuteQuery)
+		m.dryRunQuery(query, m.membershipProblems(username, "rds_iam")...)
 		return nil
 	}
 
-	if _, err := m.db.Exec(query); err != nil {
+	if _, err := m.executor().Exec(query); err != nil {
 		return fmt.Errorf("failed to grant rds_iam role: %w", err)
 	}
 	
@@ -182,11 +483,11 @@ func (m *Manager) revokeRDSIAMRole(username string) error {
 	query := fmt.Sprintf("REVOKE rds_iam FROM %s", m.quoteIdentifier(username))
 	
 	if m.dryRun {
-		m.logger.WithField("query", query).Info(msgDryRunExecuteQuery)
+		m.dryRunQuery(query)
 		return nil
 	}
 
-	if _, err := m.db.Exec(query); err != nil {
+	if _, err := m.executor().Exec(query); err != nil {
 		return fmt.Errorf("failed to revoke rds_iam role: %w", err)
 	}
 	
@@ -194,6 +495,67 @@ func (m *Manager) revokeRDSIAMRole(username string) error {
 	return nil
 }
 
+// SetReassignTo makes DropUser and DropGroup reassign the objects a role owns in the
+// connected database, and during a sync in the other databases of the configuration, to
+// another role and drop its remaining privileges there before dropping it. An empty role leaves them, so a role that still owns objects cannot be dropped.
+func (m *Manager) SetReassignTo(role string) {
+	m.reassignTo = role
+}
+
+// SetCascade makes DropUser and DropGroup drop the objects a role owns in the connected
+// database, and during a sync in the other databases of the configuration, and its privileges
+// there before dropping it, unless they are reassigned
+func (m *Manager) SetCascade(cascade bool) {
+	m.cascade = cascade
+}
+
+// dropOwnedInDatabases runs the statements of dropOwnedQueries in each database of the
+// configuration being synced other than the connected one, so objects and privileges the
+// role has there do not keep it from being dropped. They are not part of a transactional
+// sync: other databases are reached on their own connections.
+func (m *Manager) dropOwnedInDatabases(role string) error {
+	queries := m.dropOwnedQueries(role)
+	if len(queries) == 0 {
+		return nil
+	}
+	for _, name := range m.objectDatabases {
+		if !m.otherDatabase(name) {
+			continue
+		}
+		err := m.InDatabase(name, func(db *Manager) error {
+			for _, query := range queries {
+				if db.dryRun {
+					db.dryRunQuery(query)
+					continue
+				}
+				if _, err := db.executor().Exec(query); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropOwnedQueries returns the statements that clear what a role owns and holds in the
+// connected database, so no dependent objects keep it from being dropped
+func (m *Manager) dropOwnedQueries(role string) []string {
+	switch {
+	case m.reassignTo != "":
+		return []string{
+			fmt.Sprintf("REASSIGN OWNED BY %s TO %s", m.quoteIdentifier(role), m.quoteIdentifier(m.reassignTo)),
+			fmt.Sprintf("DROP OWNED BY %s", m.quoteIdentifier(role)),
+		}
+	case m.cascade:
+		return []string{fmt.Sprintf("DROP OWNED BY %s", m.quoteIdentifier(role))}
+	}
+	return nil
+}
+
 // DropUser removes a database user
 func (m *Manager) DropUser(username string) error {
 	m.logger.WithField("username", username).Info("Dropping user")
@@ -209,16 +571,37 @@ func (m *Manager) DropUser(username string) error {
 		return nil
 	}
 
-	query := fmt.Sprintf("DROP USER %s", m.quoteIdentifier(username))
+	if err := m.checkDeletionProtection(username, false); err != nil {
+		return err
+	}
 
-	if m.dryRun {
-		m.logger.WithField("query", query).Info(msgDryRunExecuteQuery)
-		return nil
+	if m.terminateSessions {
+		if err := m.endSessions(username); err != nil {
+			return fmt.Errorf("failed to drop user %s: %w", username, err)
+		}
 	}
 
-	if _, err := m.db.Exec(query); err != nil {
+	if err := m.dropOwnedInDatabases(username); err != nil {
 		return fmt.Errorf("failed to drop user %s: %w", username, err)
 	}
+	queries := append(m.dropOwnedQueries(username), fmt.Sprintf("DROP USER %s", m.quoteIdentifier(username)))
+
+	for _, query := range queries {
+		if m.dryRun {
+			m.dryRunQuery(query)
+			continue
+		}
+
+		_, err = m.executor().Exec(query)
+		m.invalidateAfter(query)
+		if err != nil {
+			return fmt.Errorf("failed to drop user %s: %w", username, err)
+		}
+	}
+	if m.dryRun {
+		m.planRole(username, false)
+		return nil
+	}
 
 	m.logger.WithField("username", username).Info("User dropped successfully")
 	return nil
@@ -228,6 +611,10 @@ func (m *Manager) DropUser(username string) error {
 func (m *Manager) CreateGroup(group *structs.GroupConfig) error {
 	m.logger.WithField("group", group.Name).Info("Creating group")
 
+	if err := structs.CheckIdentifier(group.Name); err != nil {
+		return fmt.Errorf("cannot create group: %w", err)
+	}
+
 	// Check if group already exists
 	exists, err := m.GroupExists(group.Name)
 	if err != nil {
@@ -249,19 +636,114 @@ func (m *Manager) CreateGroup(group *structs.GroupConfig) error {
 	}
 
 	if m.dryRun {
-		m.logger.WithField("query", query).Info(msgDryRunExecuteQuery)
-		return nil
+		m.dryRunQuery(query)
+		m.planRole(group.Name, true)
+		return m.runGroupHooks(group)
 	}
 
-	if _, err := m.db.Exec(query); err != nil {
+	_, err = m.executor().Exec(query)
+	m.invalidateAfter(query)
+	if err != nil {
 		return fmt.Errorf("failed to create group %s: %w", group.Name, err)
 	}
 
+	// Record who created the group and who is accountable for it
+	metadata := ownershipMetadata(group.Owner, group.Team, group.Ticket)
+	if m.roleSource != "" {
+		metadata = m.managedMetadata(ManagedKindGroup, metadata)
+	}
+	if err := m.stampRole(group.Name, group.Description, "created", metadata); err != nil {
+		return err
+	}
+
 	m.logger.WithField("group", group.Name).Info("Group created successfully")
+	return m.runGroupHooks(group)
+}
+
+// DropGroup removes a group role. Its members lose the membership; objects it owns in the
+// connected database, and during a sync in the other databases of the configuration, are
+// handled as set with SetReassignTo and SetCascade
+func (m *Manager) DropGroup(groupName string) error {
+	m.logger.WithField("group", groupName).Info("Dropping group")
+
+	exists, canLogin, err := m.RoleCanLogin(groupName)
+	if err != nil {
+		return fmt.Errorf("failed to check if group exists: %w", err)
+	}
+
+	if !exists {
+		m.logger.WithField("group", groupName).Info("Group does not exist, skipping deletion")
+		return nil
+	}
+	if canLogin {
+		return fmt.Errorf("refusing to drop %s: it is a login role, use drop-user", groupName)
+	}
+
+	if err := m.checkDeletionProtection(groupName, false); err != nil {
+		return err
+	}
+
+	if err := m.dropOwnedInDatabases(groupName); err != nil {
+		return fmt.Errorf("failed to drop group %s: %w", groupName, err)
+	}
+	queries := append(m.dropOwnedQueries(groupName), fmt.Sprintf("DROP ROLE %s", m.quoteIdentifier(groupName)))
+
+	for _, query := range queries {
+		if m.dryRun {
+			m.dryRunQuery(query)
+			continue
+		}
+
+		_, err = m.executor().Exec(query)
+		m.invalidateAfter(query)
+		if err != nil {
+			return fmt.Errorf("failed to drop group %s: %w", groupName, err)
+		}
+	}
+	if m.dryRun {
+		m.planRole(groupName, false)
+		return nil
+	}
+
+	m.logger.WithField("group", groupName).Info("Group dropped successfully")
 	return nil
 }
 
-// GrantPrivileges grants privileges to a user or group
+// AlterGroup brings the attributes of an existing group in line with its configuration,
+// as CreateGroup leaves existing groups alone. It reports whether the group was changed.
+func (m *Manager) AlterGroup(group *structs.GroupConfig) (bool, error) {
+	attributes, err := m.GetRoleAttributes(group.Name)
+	if err != nil {
+		return false, err
+	}
+	if attributes == nil || attributes.Inherit == group.Inherit {
+		return false, nil
+	}
+
+	m.logger.WithFields(logrus.Fields{
+		"group":   group.Name,
+		"inherit": group.Inherit,
+	}).Info("Altering group")
+
+	query := fmt.Sprintf("ALTER ROLE %s NOINHERIT", m.quoteIdentifier(group.Name))
+	if group.Inherit {
+		query = fmt.Sprintf("ALTER ROLE %s INHERIT", m.quoteIdentifier(group.Name))
+	}
+	if err := m.execute(query); err != nil {
+		return false, fmt.Errorf("failed to alter group %s: %w", group.Name, err)
+	}
+
+	// Record who changed the group
+	if err := m.stampRole(group.Name, "", "modified", nil); err != nil {
+		return true, err
+	}
+
+	m.logger.WithField("group", group.Name).Info("Group altered successfully")
+	return true, nil
+}
+
+// GrantPrivileges grants privileges to a user or group. All privileges on all databases are
+// granted in one statement, which PostgreSQL applies entirely or not at all.
 func (m *Manager) GrantPrivileges(target string, privileges []string, databases []string) error {
 	m.logger.WithFields(logrus.Fields{
 		"target":     target,
@@ -269,27 +751,46 @@ func (m *Manager) GrantPrivileges(target string, privileges []string, databases
 		"databases":  databases,
 	}).Info("Granting privileges")
 
-	for _, db := range databases {
-		for _, priv := range privileges {
-			query := fmt.Sprintf("GRANT %s ON DATABASE %s TO %s", 
-				priv, m.quoteIdentifier(db), m.quoteIdentifier(target))
+	if len(privileges) == 0 || len(databases) == 0 {
+		return nil
+	}
 
-			if m.dryRun {
-				m.logger.WithField("query", query).Info(msgDryRunExecuteQuery)
-				continue
+	// Databases the connected role cannot grant on are left to the elevated script one by one
+	if m.elevated != nil {
+		var grantable []string
+		for _, db := range databases {
+			query := fmt.Sprintf("GRANT %s ON DATABASE %s TO %s",
+				privilegeList(privileges), m.quoteIdentifier(db), m.quoteIdentifier(target))
+			if !m.leaveToElevated(query, m.elevated.database(db)) {
+				grantable = append(grantable, db)
 			}
+		}
+		if databases = grantable; len(databases) == 0 {
+			return nil
+		}
+	}
 
-			if _, err := m.db.Exec(query); err != nil {
-				return fmt.Errorf("failed to grant %s on %s to %s: %w", priv, db, target, err)
-			}
+	query := fmt.Sprintf("GRANT %s ON DATABASE %s TO %s",
+		privilegeList(privileges), m.quoteIdentifierList(databases), m.quoteIdentifier(target))
+
+	if m.dryRun {
+		var problems []string
+		for _, db := range databases {
+			problems = appendProblems(problems, m.databaseProblems(target, db)...)
 		}
+		m.dryRunQuery(query, problems...)
+		return nil
+	}
+
+	if _, err := m.executor().Exec(query); err != nil {
+		return fmt.Errorf("failed to grant %s on %s to %s: %w", strings.Join(privileges, ", "), strings.Join(databases, ", "), target, err)
 	}
 
 	m.logger.WithField("target", target).Info("Privileges granted successfully")
 	return nil
 }
 
-// RevokePrivileges revokes privileges from a user or group
+// RevokePrivileges revokes privileges from a user or group, on all databases in one statement
 func (m *Manager) RevokePrivileges(target string, privileges []string, databases []string) error {
 	m.logger.WithFields(logrus.Fields{
 		"target":     target,
@@ -297,26 +798,38 @@ func (m *Manager) RevokePrivileges(target string, privileges []string, databases
 		"databases":  databases,
 	}).Info("Revoking privileges")
 
-	for _, db := range databases {
-		for _, priv := range privileges {
-			query := fmt.Sprintf("REVOKE %s ON DATABASE %s FROM %s", 
-				priv, m.quoteIdentifier(db), m.quoteIdentifier(target))
+	if len(privileges) == 0 || len(databases) == 0 {
+		return nil
+	}
 
-			if m.dryRun {
-				m.logger.WithField("query", query).Info(msgDryRunExecuteQuery)
-				continue
-			}
+	query := fmt.Sprintf("REVOKE %s ON DATABASE %s FROM %s",
+		privilegeList(privileges), m.quoteIdentifierList(databases), m.quoteIdentifier(target))
 
-			if _, err := m.db.Exec(query); err != nil {
-				return fmt.Errorf("failed to revoke %s on %s from %s: %w", priv, db, target, err)
-			}
-		}
+	if m.dryRun {
+		m.dryRunQuery(query)
+		return nil
+	}
+
+	if _, err := m.executor().Exec(query); err != nil {
+		return fmt.Errorf("failed to revoke %s on %s from %s: %w", strings.Join(privileges, ", "), strings.Join(databases, ", "), target, err)
 	}
 
 	m.logger.WithField("target", target).Info("Privileges revoked successfully")
 	return nil
 }
 
+// privilegeList joins privileges for one GRANT or REVOKE on databases, schemas, tables or
+// large objects. ALL cannot be listed with other privileges and already includes them, so it is
+// used on its own.
+func privilegeList(privileges []string) string {
+	for _, priv := range privileges {
+		if upper := strings.ToUpper(strings.TrimSpace(priv)); upper == "ALL" || upper == "ALL PRIVILEGES" {
+			return priv
+		}
+	}
+	return strings.Join(privileges, ", ")
+}
+
 // AddUserToGroup adds a user to a group
 func (m *Manager) AddUserToGroup(username, groupName string) error {
 	m.logger.WithFields(logrus.Fields{
@@ -324,14 +837,21 @@ func (m *Manager) AddUserToGroup(username, groupName string) error {
 		"group":    groupName,
 	}).Info("Adding user to group")
 
+	if err := m.ensureAdminMembership(groupName); err != nil {
+		return err
+	}
+
 	query := fmt.Sprintf("GRANT %s TO %s", m.quoteIdentifier(groupName), m.quoteIdentifier(username))
+	if m.leaveToElevated(query, m.elevated.membership(groupName)) {
+		return nil
+	}
 
 	if m.dryRun {
-		m.logger.WithField("query", query).Info(msgDryRunExecuteQuery)
+		m.dryRunQuery(query, m.membershipProblems(username, groupName)...)
 		return nil
 	}
 
-	if _, err := m.db.Exec(query); err != nil {
+	if _, err := m.executor().Exec(query); err != nil {
 		return fmt.Errorf("failed to add user %s to group %s: %w", username, groupName, err)
 	}
 
@@ -342,6 +862,84 @@ func (m *Manager) AddUserToGroup(username, groupName string) error {
 	return nil
 }
 
+// addToGroups adds a user or group to several groups in one statement, calling failed for
+// each group it could not be added to. When the statement fails outside a transaction, the
+// groups are granted one at a time, so a missing group does not hold back the others.
+func (m *Manager) addToGroups(member string, groups []string, failed func(group string, err error)) {
+	// Groups the connected role cannot grant are left to the elevated script one by one
+	if m.elevated != nil {
+		var grantable []string
+		for _, groupName := range groups {
+			if m.elevated.membership(groupName) == "" {
+				grantable = append(grantable, groupName)
+			} else if err := m.AddUserToGroup(member, groupName); err != nil {
+				failed(groupName, err)
+			}
+		}
+		groups = grantable
+	}
+	if len(groups) == 0 {
+		return
+	}
+
+	if len(groups) == 1 {
+		if err := m.AddUserToGroup(member, groups[0]); err != nil {
+			failed(groups[0], err)
+		}
+		return
+	}
+
+	grantable := make([]string, 0, len(groups))
+	for _, groupName := range groups {
+		if err := m.ensureAdminMembership(groupName); err != nil {
+			failed(groupName, err)
+			continue
+		}
+		grantable = append(grantable, groupName)
+	}
+	if len(grantable) == 0 {
+		return
+	}
+
+	m.logger.WithFields(logrus.Fields{
+		"member": member,
+		"groups": grantable,
+	}).Info("Adding role to groups")
+
+	query := fmt.Sprintf("GRANT %s TO %s", m.quoteIdentifierList(grantable), m.quoteIdentifier(member))
+
+	if m.dryRun {
+		var problems []string
+		for _, groupName := range grantable {
+			problems = appendProblems(problems, m.membershipProblems(member, groupName)...)
+		}
+		m.dryRunQuery(query, problems...)
+		return
+	}
+
+	if _, err := m.executor().Exec(query); err != nil {
+		// A failed statement aborts the transaction, so every group failed with it
+		if m.tx != nil {
+			for _, groupName := range grantable {
+				failed(groupName, err)
+			}
+			return
+		}
+		m.logger.WithError(err).WithField("member", member).Debug("Granting groups together failed, granting them one at a time")
+		for _, groupName := range grantable {
+			if err := m.AddUserToGroup(member, groupName); err != nil {
+				failed(groupName, err)
+			}
+		}
+		return
+	}
+
+	m.logger.WithFields(logrus.Fields{
+		"member": member,
+		"groups": grantable,
+	}).Info("Role added to groups successfully")
+}
+
 // RemoveUserFromGroup removes a user from a group
 func (m *Manager) RemoveUserFromGroup(username, groupName string) error {
 	m.logger.WithFields(logrus.Fields{
@@ -349,14 +947,18 @@ func (m *Manager) RemoveUserFromGroup(username, groupName string) error {
 		"group":    groupName,
 	}).Info("Removing user from group")
 
+	if err := m.ensureAdminMembership(groupName); err != nil {
+		return err
+	}
+
 	query := fmt.Sprintf("REVOKE %s FROM %s", m.quoteIdentifier(groupName), m.quoteIdentifier(username))
 
 	if m.dryRun {
-		m.logger.WithField("query", query).Info(msgDryRunExecuteQuery)
+		m.dryRunQuery(query)
 		return nil
 	}
 
-	if _, err := m.db.Exec(query); err != nil {
+	if _, err := m.executor().Exec(query); err != nil {
 		return fmt.Errorf("failed to remove user %s from group %s: %w", username, groupName, err)
 	}
 
@@ -369,35 +971,89 @@ func (m *Manager) RemoveUserFromGroup(username, groupName string) error {
 
 // UserExists checks if a user exists in the database
 func (m *Manager) UserExists(username string) (bool, error) {
-	// Use pg_roles instead of pg_user to include both login and nologin users
-	query := "SELECT 1 FROM pg_roles WHERE rolname = $1"
-	
-	var exists int
-	err := m.db.QueryRow(query, username).Scan(&exists)
-	if err == sql.ErrNoRows {
-		return false, nil
-	}
-	if err != nil {
-		return false, err
-	}
-	
-	return true, nil
+	return m.roleExists(username)
 }
 
 // GroupExists checks if a group/role exists in the database
 func (m *Manager) GroupExists(groupName string) (bool, error) {
-	query := "SELECT 1 FROM pg_roles WHERE rolname = $1"
-	
-	var exists int
-	err := m.db.QueryRow(query, groupName).Scan(&exists)
+	return m.roleExists(groupName)
+}
+
+// GetRoleAttributes returns the attributes of a role, or nil when it does not exist
+func (m *Manager) GetRoleAttributes(role string) (*structs.RoleAttributes, error) {
+	attributes := &structs.RoleAttributes{}
+	var validUntil sql.NullTime
+	var comment string
+	err := m.executor().QueryRow(`
+		SELECT rolcanlogin, rolinherit, rolsuper, rolcreaterole, rolconnlimit,
+			CASE WHEN rolvaliduntil = 'infinity' THEN NULL ELSE rolvaliduntil END,
+			COALESCE(shobj_description(oid, 'pg_authid'), '')
+		FROM pg_roles WHERE rolname = $1`, role).
+		Scan(&attributes.CanLogin, &attributes.Inherit, &attributes.Superuser, &attributes.CreateRole,
+			&attributes.ConnectionLimit, &validUntil, &comment)
 	if err == sql.ErrNoRows {
-		return false, nil
+		return nil, nil
 	}
 	if err != nil {
-		return false, err
+		return nil, fmt.Errorf("failed to get attributes of role %s: %w", role, err)
 	}
-	
-	return true, nil
+
+	if validUntil.Valid {
+		attributes.ValidUntil = &validUntil.Time
+	}
+
+	var metadata map[string]string
+	attributes.Description, metadata = parseRoleComment(comment)
+	attributes.DeletionProtection = metadata[protectionMetadataKey] == "true"
+	attributes.ManagedAs = metadata[managedMetadataKey]
+	attributes.Owner = metadata[ownerMetadataKey]
+	attributes.Team = metadata[teamMetadataKey]
+	attributes.Ticket = metadata[ticketMetadataKey]
+	attributes.PasswordChangedAt = metadataTime(metadata, passwordChangedMetadataKey)
+	if auth := metadata["auth"]; auth != "" {
+		attributes.AuthMethods = strings.Split(auth, ",")
+	}
+	return attributes, nil
+}
+
+// ListUsers returns every role except the built-in pg_ roles, with its login ability,
+// connection limit, password validity and direct memberships, ordered by name
+func (m *Manager) ListUsers() ([]structs.DatabaseUser, error) {
+	query := `
+		SELECT r.rolname, r.rolcanlogin, r.rolconnlimit,
+			CASE WHEN r.rolvaliduntil = 'infinity' THEN NULL ELSE r.rolvaliduntil END,
+			COALESCE(array_agg(g.rolname ORDER BY g.rolname) FILTER (WHERE g.rolname IS NOT NULL), '{}'),
+			COALESCE(shobj_description(r.oid, 'pg_authid'), '')
+		FROM pg_roles r
+		LEFT JOIN pg_auth_members am ON am.member = r.oid
+		LEFT JOIN pg_roles g ON g.oid = am.roleid
+		WHERE r.rolname !~ '^pg_'
+		GROUP BY r.oid, r.rolname, r.rolcanlogin, r.rolconnlimit, r.rolvaliduntil
+		ORDER BY r.rolname`
+
+	rows, err := m.executor().Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	users := []structs.DatabaseUser{}
+	for rows.Next() {
+		user := structs.DatabaseUser{Exists: true, LastChecked: now}
+		var validUntil sql.NullTime
+		var comment string
+		if err := rows.Scan(&user.Username, &user.CanLogin, &user.ConnectionLimit, &validUntil, pq.Array(&user.Groups), &comment); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		user.Description, _ = parseRoleComment(comment)
+		if validUntil.Valid {
+			user.ValidUntil = &validUntil.Time
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
 }
 
 // GetUserInfo retrieves information about a database user
@@ -419,6 +1075,10 @@ func (m *Manager) GetUserInfo(username string) (*structs.DatabaseUser, error) {
 		return user, nil
 	}
 
+	if user.Description, err = m.GetRoleDescription(username); err != nil {
+		return nil, err
+	}
+
 	// Get user's groups
 	groupQuery := `
 		SELECT r.rolname 
@@ -426,8 +1086,8 @@ func (m *Manager) GetUserInfo(username string) (*structs.DatabaseUser, error) {
 		JOIN pg_roles r ON m.roleid = r.oid 
 		JOIN pg_roles u ON m.member = u.oid 
 		WHERE u.rolname = $1`
-	
-	rows, err := m.db.Query(groupQuery, username)
+
+	rows, err := m.executor().Query(groupQuery, username)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user groups: %w", err)
 	}
@@ -444,66 +1104,129 @@ func (m *Manager) GetUserInfo(username string) (*structs.DatabaseUser, error) {
 	return user, nil
 }
 
-// SyncConfiguration synchronizes the database state with the configuration
-func (m *Manager) SyncConfiguration(config *structs.Config) (*structs.SyncResult, error) {
-	m.logger.Info("Starting configuration synchronization")
-	
-	result := &structs.SyncResult{}
+// GetClusterCatalog lists the roles and databases that exist in the cluster and the
+// privileges of the connected role
+func (m *Manager) GetClusterCatalog() (*structs.ClusterCatalog, error) {
+	catalog := &structs.ClusterCatalog{}
 
-	// Create groups first (since users might depend on them)
-	for _, group := range config.Groups {
-		if err := m.CreateGroup(&group); err != nil {
-			result.Errors = append(result.Errors, fmt.Errorf("failed to create group %s: %w", group.Name, err))
-			continue
-		}
-		result.GroupsCreated = append(result.GroupsCreated, group.Name)
+	roles, err := m.queryStrings("SELECT rolname FROM pg_roles ORDER BY rolname")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+	catalog.Roles = roles
 
-		// Grant group privileges
-		if err := m.GrantPrivileges(group.Name, group.Privileges, group.Databases); err != nil {
-			result.Errors = append(result.Errors, fmt.Errorf("failed to grant privileges to group %s: %w", group.Name, err))
-		}
+	databases, err := m.queryStrings("SELECT datname FROM pg_database WHERE NOT datistemplate ORDER BY datname")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list databases: %w", err)
 	}
+	catalog.Databases = databases
 
-	// Create and configure users
-	for _, user := range config.Users {
-		if !user.Enabled {
-			m.logger.WithField("username", user.Username).Info("User is disabled, skipping")
-			continue
-		}
+	err = m.executor().QueryRow("SELECT current_user, rolsuper, rolcreaterole FROM pg_roles WHERE rolname = current_user").
+		Scan(&catalog.CurrentUser, &catalog.Superuser, &catalog.CreateRole)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read connected role attributes: %w", err)
+	}
 
-		if err := m.CreateUser(&user); err != nil {
-			result.Errors = append(result.Errors, fmt.Errorf("failed to create user %s: %w", user.Username, err))
-			continue
-		}
-		result.UsersCreated = append(result.UsersCreated, user.Username)
+	// Owners and superusers hold every grant option implicitly
+	grantable, err := m.queryStrings("SELECT datname FROM pg_database WHERE NOT datistemplate AND has_database_privilege(datname, 'CONNECT WITH GRANT OPTION') ORDER BY datname")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list grantable databases: %w", err)
+	}
+	catalog.GrantableDatabases = grantable
 
-		// Add user to groups
-		for _, groupName := range user.Groups {
-			if err := m.AddUserToGroup(user.Username, groupName); err != nil {
-				result.Errors = append(result.Errors, fmt.Errorf("failed to add user %s to group %s: %w", user.Username, groupName, err))
-			}
+	return catalog, nil
+}
+
+// Helper methods
+
+// quoteIdentifier safely quotes database identifiers
+func (m *Manager) quoteIdentifier(name string) string {
+	return fmt.Sprintf(`"%s"`, strings.ReplaceAll(name, `"`, `""`))
+}
+
+// quoteIdentifierList quotes and joins a list of identifiers
+func (m *Manager) quoteIdentifierList(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = m.quoteIdentifier(name)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// queryStrings runs a query returning a single text column and collects the values
+func (m *Manager) queryStrings(query string, args ...interface{}) ([]string, error) {
+	rows, err := m.executor().Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := []string{}
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
 		}
+		values = append(values, value)
+	}
+
+	return values, rows.Err()
+}
 
-		// Grant user privileges
-		if err := m.GrantPrivileges(user.Username, user.Privileges, user.Databases); err != nil {
-			result.Errors = append(result.Errors, fmt.Errorf("failed to grant privileges to user %s: %w", user.Username, err))
+// execute runs a statement, or logs it when in dry-run mode
+func (m *Manager) execute(query string) error {
+	if m.dryRun {
+		m.dryRunQuery(query)
+		return nil
+	}
+
+	_, err := m.executor().Exec(query)
+	m.invalidateAfter(query)
+	return err
+}
+
+// dryRunQuery records a statement that dry-run mode skips, with the problems read-only
+// checks found that would make it fail. During a sync it is collected under the current
+// entity for the grouped preview; otherwise it is logged directly.
+func (m *Manager) dryRunQuery(query string, problems ...string) {
+	problem := strings.Join(problems, "; ")
+	if m.statements == nil {
+		if problem != "" {
+			m.logger.WithFields(logrus.Fields{
+				"query":   m.logQuery(query),
+				"problem": problem,
+			}).Warn("DRY RUN: Statement would fail")
+			return
 		}
+		m.logger.WithField("query", m.logQuery(query)).Info(msgDryRunExecuteQuery)
+		return
 	}
 
 	m.logger.WithFields(logrus.Fields{
-		"users_created":  len(result.UsersCreated),
-		"groups_created": len(result.GroupsCreated),
-		"errors":         len(result.Errors),
-	}).Info("Configuration synchronization completed")
+		"entity": m.entity,
+		"query":  m.logQuery(query),
+	}).Debug(msgDryRunExecuteQuery)
+	m.statements = append(m.statements, structs.PlannedStatement{Entity: m.entity, Query: m.loggableQuery(query), Problem: problem})
+}
 
-	return result, nil
+// CollectStatements makes dry-run statements outside of a sync collect, as a sync collects
+// them for its preview, until CollectedStatements returns them
+func (m *Manager) CollectStatements() {
+	m.statements = []structs.PlannedStatement{}
 }
 
-// Helper methods
+// CollectedStatements returns the dry-run statements collected since CollectStatements and
+// goes back to logging them
+func (m *Manager) CollectedStatements() []structs.PlannedStatement {
+	statements := m.statements
+	m.statements = nil
+	return statements
+}
 
-// quoteIdentifier safely quotes database identifiers
-func (m *Manager) quoteIdentifier(name string) string {
-	return fmt.Sprintf(`"%s"`, strings.ReplaceAll(name, `"`, `""`))
+// logQuery returns a statement as it is logged, with passwords and other credentials masked
+// whether or not password redaction is on
+func (m *Manager) logQuery(query string) string {
+	return secrets.MaskCredentials(query)
 }
 
 // escapeString safely escapes string literals
@@ -1,13 +1,16 @@
 package database
 
 import (
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
 )
 
 func TestNewManager(t *testing.T) {
-	setup := SetupFlexibleTestDatabase(t)
+	setup := SetupTestDatabase(t)
 	defer setup.Cleanup(t)
 
 	// Test successful connection
@@ -26,7 +29,7 @@ func TestNewManager(t *testing.T) {
 }
 
 func TestNewManagerWithInvalidConnection(t *testing.T) {
-	setup := SetupFlexibleTestDatabase(t)
+	setup := SetupTestDatabase(t)
 	defer setup.Cleanup(t)
 
 	// Test with invalid connection details
@@ -47,7 +50,7 @@ func TestNewManagerWithInvalidConnection(t *testing.T) {
 }
 
 func TestNewManagerDryRun(t *testing.T) {
-	setup := SetupFlexibleTestDatabase(t)
+	setup := SetupTestDatabase(t)
 	defer setup.Cleanup(t)
 
 	// Create a dry-run manager
@@ -62,8 +65,31 @@ func TestNewManagerDryRun(t *testing.T) {
 	}
 }
 
+func TestCollectStatements(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	m := &Manager{logger: logger, dryRun: true}
+
+	m.CollectStatements()
+	if err := m.AddUserToGroup("app_user", "readers"); err != nil {
+		t.Fatalf("Failed to add user to group: %v", err)
+	}
+	statements := m.CollectedStatements()
+	if len(statements) != 1 || statements[0].Query != `GRANT "readers" TO "app_user"` {
+		t.Errorf("Expected the GRANT to be collected, got %v", statements)
+	}
+
+	// Statements are logged again once collected
+	if err := m.AddUserToGroup("app_user", "writers"); err != nil {
+		t.Fatalf("Failed to add user to group: %v", err)
+	}
+	if statements := m.CollectedStatements(); statements != nil {
+		t.Errorf("Expected no statements after collecting, got %v", statements)
+	}
+}
+
 func TestUserExists(t *testing.T) {
-	setup := SetupFlexibleTestDatabase(t)
+	setup := SetupTestDatabase(t)
 	defer setup.Cleanup(t)
 	defer setup.ResetDatabase(t)
 
@@ -102,7 +128,7 @@ func TestUserExists(t *testing.T) {
 }
 
 func TestCreateUser(t *testing.T) {
-	setup := SetupFlexibleTestDatabase(t)
+	setup := SetupTestDatabase(t)
 	defer setup.Cleanup(t)
 	defer setup.ResetDatabase(t)
 
@@ -181,7 +207,7 @@ func TestCreateUser(t *testing.T) {
 }
 
 func TestCreateUserDuplicate(t *testing.T) {
-	setup := SetupFlexibleTestDatabase(t)
+	setup := SetupTestDatabase(t)
 	defer setup.Cleanup(t)
 	defer setup.ResetDatabase(t)
 
@@ -207,7 +233,7 @@ func TestCreateUserDuplicate(t *testing.T) {
 }
 
 func TestDropUser(t *testing.T) {
-	setup := SetupFlexibleTestDatabase(t)
+	setup := SetupTestDatabase(t)
 	defer setup.Cleanup(t)
 	defer setup.ResetDatabase(t)
 
@@ -250,8 +276,45 @@ func TestDropUser(t *testing.T) {
 	}
 }
 
+func TestDropUserReassignsOwnedObjects(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	user := &structs.UserConfig{Username: "test_user", Password: "test_pass", CanLogin: true, Enabled: true}
+	if err := setup.Manager.CreateUser(user); err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+	if _, err := setup.Manager.db.Exec("CREATE TABLE owned_table (id int)"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	defer setup.Manager.db.Exec("DROP TABLE IF EXISTS owned_table")
+	if _, err := setup.Manager.db.Exec(`ALTER TABLE owned_table OWNER TO "test_user"`); err != nil {
+		t.Fatalf("Failed to change table owner: %v", err)
+	}
+
+	// The owned table keeps the user from being dropped
+	err := setup.Manager.DropUser("test_user")
+	if kind := Classify(err); kind == nil || kind.Kind != ErrorKindDependentObjects {
+		t.Fatalf("Expected a dependent objects error, got %v", err)
+	}
+
+	setup.Manager.SetReassignTo("testuser")
+	if err := setup.Manager.DropUser("test_user"); err != nil {
+		t.Fatalf("Failed to drop user with --reassign-to: %v", err)
+	}
+
+	var owner string
+	if err := setup.Manager.db.QueryRow("SELECT tableowner FROM pg_tables WHERE tablename = 'owned_table'").Scan(&owner); err != nil {
+		t.Fatalf("Failed to read table owner: %v", err)
+	}
+	if owner != "testuser" {
+		t.Errorf("Expected the table to be reassigned to testuser, got %s", owner)
+	}
+}
+
 func TestDropNonExistentUser(t *testing.T) {
-	setup := SetupFlexibleTestDatabase(t)
+	setup := SetupTestDatabase(t)
 	defer setup.Cleanup(t)
 
 	// Try to drop a user that doesn't exist - should not error
@@ -260,3 +323,189 @@ func TestDropNonExistentUser(t *testing.T) {
 		t.Fatalf("Dropping non-existent user should not error: %v", err)
 	}
 }
+
+func TestGetClusterCatalog(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	if err := setup.Manager.CreateGroup(&structs.GroupConfig{Name: "test_group", Inherit: true}); err != nil {
+		t.Fatalf("Failed to create group: %v", err)
+	}
+
+	catalog, err := setup.Manager.GetClusterCatalog()
+	if err != nil {
+		t.Fatalf("Failed to get cluster catalog: %v", err)
+	}
+
+	if !containsString(catalog.Roles, "test_group") {
+		t.Errorf("Expected catalog roles to include test_group, got %v", catalog.Roles)
+	}
+
+	if !containsString(catalog.Databases, "testdb") {
+		t.Errorf("Expected catalog databases to include testdb, got %v", catalog.Databases)
+	}
+
+	if catalog.CurrentUser == "" || !(catalog.Superuser || catalog.CreateRole) {
+		t.Errorf("Expected the test connection to be able to create roles, got %+v", catalog)
+	}
+
+	if !containsString(catalog.GrantableDatabases, "testdb") {
+		t.Errorf("Expected catalog grantable databases to include testdb, got %v", catalog.GrantableDatabases)
+	}
+}
+
+func TestListUsers(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	if err := setup.Manager.CreateGroup(&structs.GroupConfig{Name: "test_group", Inherit: true}); err != nil {
+		t.Fatalf("Failed to create group: %v", err)
+	}
+
+	userConfig := &structs.UserConfig{
+		Username:        "test_user",
+		Password:        "test_pass",
+		AuthMethod:      "password",
+		CanLogin:        true,
+		Enabled:         true,
+		ConnectionLimit: 5,
+	}
+	if err := setup.Manager.CreateUser(userConfig); err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+	if err := setup.Manager.AddUserToGroup("test_user", "test_group"); err != nil {
+		t.Fatalf("Failed to add user to group: %v", err)
+	}
+
+	users, err := setup.Manager.ListUsers()
+	if err != nil {
+		t.Fatalf("Failed to list users: %v", err)
+	}
+
+	var found *structs.DatabaseUser
+	for i := range users {
+		if strings.HasPrefix(users[i].Username, "pg_") {
+			t.Errorf("Expected built-in role %s to be excluded", users[i].Username)
+		}
+		if users[i].Username == "test_user" {
+			found = &users[i]
+		}
+	}
+	if found == nil {
+		t.Fatalf("Expected test_user in %+v", users)
+	}
+
+	if !found.CanLogin || found.ConnectionLimit != 5 || found.ValidUntil != nil {
+		t.Errorf("Unexpected attributes for test_user: %+v", found)
+	}
+	if len(found.Groups) != 1 || found.Groups[0] != "test_group" {
+		t.Errorf("Expected test_user to be a member of test_group, got %v", found.Groups)
+	}
+}
+
+func TestAlterUser(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	userConfig := &structs.UserConfig{
+		Username: "test_user",
+		Password: "test_pass",
+		CanLogin: true,
+		Enabled:  true,
+	}
+	if err := setup.Manager.CreateUser(userConfig); err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	changed, err := setup.Manager.AlterUser(userConfig)
+	if err != nil || changed {
+		t.Fatalf("Expected no changes right after creation (changed=%v, err=%v)", changed, err)
+	}
+
+	userConfig.ConnectionLimit = 5
+	userConfig.CanLogin = false
+	userConfig.Password = "new_pass"
+	changed, err = setup.Manager.AlterUser(userConfig)
+	if err != nil || !changed {
+		t.Fatalf("Expected the user to be altered (changed=%v, err=%v)", changed, err)
+	}
+
+	attributes, err := setup.Manager.GetRoleAttributes("test_user")
+	if err != nil || attributes == nil {
+		t.Fatalf("Failed to get attributes: %v", err)
+	}
+	if attributes.CanLogin || attributes.ConnectionLimit != 5 {
+		t.Errorf("Unexpected attributes after alter: %+v", attributes)
+	}
+
+	verifier, readable, err := setup.Manager.getPasswordVerifier("test_user")
+	if err != nil || !readable || !passwordMatchesVerifier("test_user", "new_pass", verifier) {
+		t.Errorf("Expected the new password to be set (readable=%v, err=%v)", readable, err)
+	}
+
+	// Once applied there is nothing left to change
+	if changed, err := setup.Manager.AlterUser(userConfig); err != nil || changed {
+		t.Errorf("Expected no further changes (changed=%v, err=%v)", changed, err)
+	}
+}
+
+func TestBuildCreateUserQueryValidUntil(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	m := &Manager{logger: logger}
+
+	validUntil := time.Date(2025, 1, 31, 12, 30, 0, 0, time.FixedZone("CET", 3600))
+	user := &structs.UserConfig{Username: "contractor", AuthMethod: structs.AuthMethodIAM, CanLogin: true, ValidUntil: &validUntil}
+	query, err := m.buildCreateUserQuery(user)
+	if err != nil {
+		t.Fatalf("Failed to build query: %v", err)
+	}
+
+	if !strings.HasSuffix(query, " VALID UNTIL '2025-01-31 11:30:00Z'") {
+		t.Errorf("Expected the expiry in UTC, got %s", query)
+	}
+}
+
+func TestAlterUserValidUntil(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	validUntil := time.Now().Add(30 * 24 * time.Hour).Truncate(time.Second)
+	userConfig := &structs.UserConfig{
+		Username:   "test_user",
+		Password:   "test_pass",
+		CanLogin:   true,
+		Enabled:    true,
+		ValidUntil: &validUntil,
+	}
+	if err := setup.Manager.CreateUser(userConfig); err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	attributes, err := setup.Manager.GetRoleAttributes("test_user")
+	if err != nil || attributes.ValidUntil == nil || !attributes.ValidUntil.Equal(validUntil) {
+		t.Fatalf("Expected the user to expire at %s, got %+v, %v", validUntil, attributes, err)
+	}
+	if changed, err := setup.Manager.AlterUser(userConfig); err != nil || changed {
+		t.Fatalf("Expected no changes right after creation (changed=%v, err=%v)", changed, err)
+	}
+
+	extended := validUntil.Add(60 * 24 * time.Hour)
+	userConfig.ValidUntil = &extended
+	if changed, err := setup.Manager.AlterUser(userConfig); err != nil || !changed {
+		t.Fatalf("Expected the expiry to be extended (changed=%v, err=%v)", changed, err)
+	}
+	if attributes, err = setup.Manager.GetRoleAttributes("test_user"); err != nil || !attributes.ValidUntil.Equal(extended) {
+		t.Errorf("Expected the user to expire at %s, got %+v, %v", extended, attributes, err)
+	}
+
+	// Without valid_until the role keeps the expiry it has
+	userConfig.ValidUntil = nil
+	if changed, err := setup.Manager.AlterUser(userConfig); err != nil || changed {
+		t.Errorf("Expected an unset valid_until to leave the expiry alone (changed=%v, err=%v)", changed, err)
+	}
+}
@@ -0,0 +1,41 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/lib/pq"
+)
+
+// ListDatabases returns every database that is not a template with its owner, connection
+// limit and the roles holding CONNECT on it. A database without an ACL uses PostgreSQL's
+// default, under which its owner and PUBLIC may connect.
+func (m *Manager) ListDatabases() ([]structs.DatabaseAccess, error) {
+	query := `
+		SELECT d.datname, pg_get_userbyid(d.datdba), d.datconnlimit,
+			ARRAY(
+				SELECT CASE WHEN a.grantee = 0 THEN 'PUBLIC' ELSE pg_get_userbyid(a.grantee) END
+				FROM aclexplode(COALESCE(d.datacl, acldefault('d', d.datdba))) a
+				WHERE a.privilege_type = 'CONNECT'
+				ORDER BY 1)
+		FROM pg_database d
+		WHERE NOT d.datistemplate
+		ORDER BY d.datname`
+
+	rows, err := m.executor().Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list databases: %w", err)
+	}
+	defer rows.Close()
+
+	databases := []structs.DatabaseAccess{}
+	for rows.Next() {
+		var d structs.DatabaseAccess
+		if err := rows.Scan(&d.Name, &d.Owner, &d.ConnectionLimit, pq.Array(&d.Connect)); err != nil {
+			return nil, fmt.Errorf("failed to scan database: %w", err)
+		}
+		databases = append(databases, d)
+	}
+
+	return databases, rows.Err()
+}
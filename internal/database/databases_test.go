@@ -0,0 +1,44 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+func TestListDatabases(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	if err := setup.Manager.CreateGroup(&structs.GroupConfig{Name: "test_readers"}); err != nil {
+		t.Fatalf("Failed to create group: %v", err)
+	}
+	if err := setup.Manager.GrantPrivileges("test_readers", []string{"CONNECT"}, []string{"testdb"}); err != nil {
+		t.Fatalf("Failed to grant CONNECT: %v", err)
+	}
+
+	databases, err := setup.Manager.ListDatabases()
+	if err != nil {
+		t.Fatalf("Failed to list databases: %v", err)
+	}
+
+	for _, d := range databases {
+		if d.Name == "template0" || d.Name == "template1" {
+			t.Errorf("Expected templates to be omitted, got %s", d.Name)
+		}
+		if d.Name != "testdb" {
+			continue
+		}
+		if d.Owner == "" {
+			t.Errorf("Expected testdb to have an owner, got %+v", d)
+		}
+		for _, role := range d.Connect {
+			if role == "test_readers" {
+				return
+			}
+		}
+		t.Fatalf("Expected test_readers to have CONNECT on testdb, got %v", d.Connect)
+	}
+	t.Fatalf("Expected testdb in %+v", databases)
+}
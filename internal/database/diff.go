@@ -0,0 +1,277 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+// Diff compares the cluster with a configuration without changing anything, reporting
+// the roles, attributes, memberships, database privileges and schemas that differ. When pruning is
+// enabled, managed roles that are no longer configured are reported as well.
+func (m *Manager) Diff(config *structs.Config) (*structs.DriftReport, error) {
+	ordered, err := orderConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to order configuration: %w", err)
+	}
+
+	report := &structs.DriftReport{}
+	managedGroups := managedGroupSet(ordered.Groups)
+
+	for _, group := range ordered.Groups {
+		attributes, err := m.GetRoleAttributes(group.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check group %s: %w", group.Name, err)
+		}
+		if attributes == nil {
+			report.RolesMissing = append(report.RolesMissing, group.Name)
+			continue
+		}
+		if diffManagedKind(group.Name, ManagedKindGroup, attributes, report) {
+			continue
+		}
+		diffDescription(group.Name, attributes, group.Description, report)
+		diffOwnership(group.Name, attributes, group.Owner, group.Team, group.Ticket, report)
+		if attributes.Inherit != group.Inherit {
+			report.AttributesChanged = append(report.AttributesChanged, structs.AttributeChange{
+				Role:      group.Name,
+				Attribute: "inherit",
+				Current:   strconv.FormatBool(attributes.Inherit),
+				Desired:   strconv.FormatBool(group.Inherit),
+			})
+		}
+		if err := m.diffSettings(group.Name, group.Settings, report); err != nil {
+			return nil, err
+		}
+		if err := m.diffRole(group.Name, group.MemberOf, group.Privileges, group.Databases, managedGroups, report); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, user := range ordered.Users {
+		attributes, err := m.GetRoleAttributes(user.Username)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check user %s: %w", user.Username, err)
+		}
+		exists := attributes != nil
+
+		switch {
+		case user.Absent:
+			if exists {
+				report.UsersToRemove = append(report.UsersToRemove, user.Username)
+			}
+		case !exists:
+			from, err := m.previousName(&user)
+			if err != nil {
+				return nil, fmt.Errorf("failed to check previous names of user %s: %w", user.Username, err)
+			}
+			if from != "" {
+				report.RolesToRename = append(report.RolesToRename, structs.RoleRename{From: from, To: user.Username})
+				continue
+			}
+			report.RolesMissing = append(report.RolesMissing, user.Username)
+		case !user.Enabled:
+			// Disabled users are only locked, so their grants are not compared
+			if attributes.CanLogin {
+				report.UsersToDisable = append(report.UsersToDisable, user.Username)
+			}
+		default:
+			if diffManagedKind(user.Username, ManagedKindUser, attributes, report) {
+				continue
+			}
+			diffDescription(user.Username, attributes, user.Description, report)
+			diffOwnership(user.Username, attributes, user.Owner, user.Team, user.Ticket, report)
+			changes, err := m.userAttributeChanges(&user, attributes)
+			if err != nil {
+				return nil, err
+			}
+			report.AttributesChanged = append(report.AttributesChanged, changes...)
+			if attributes.DeletionProtection != user.DeletionProtection {
+				report.AttributesChanged = append(report.AttributesChanged, structs.AttributeChange{
+					Role:      user.Username,
+					Attribute: "deletion_protection",
+					Current:   strconv.FormatBool(attributes.DeletionProtection),
+					Desired:   strconv.FormatBool(user.DeletionProtection),
+				})
+			}
+			if err := m.diffSettings(user.Username, user.Settings, report); err != nil {
+				return nil, err
+			}
+			if err := m.diffRole(user.Username, user.ActiveGroups(time.Now()), user.Privileges, user.Databases, managedGroups, report); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := m.diffSchemas(ordered.Schemas, report); err != nil {
+		return nil, err
+	}
+
+	undeclared, err := m.undeclaredMemberships(config)
+	if err != nil {
+		return nil, err
+	}
+	report.MembershipsExtra = append(report.MembershipsExtra, undeclared...)
+
+	if m.prune != "" {
+		if err := m.diffPrune(config, report); err != nil {
+			return nil, err
+		}
+	}
+
+	m.logger.WithFields(logrus.Fields{
+		"roles_missing":       len(report.RolesMissing),
+		"users_to_remove":     len(report.UsersToRemove),
+		"users_to_disable":    len(report.UsersToDisable),
+		"roles_to_rename":     len(report.RolesToRename),
+		"memberships_missing": len(report.MembershipsMissing),
+		"memberships_extra":   len(report.MembershipsExtra),
+		"privileges_missing":  len(report.PrivilegesMissing),
+		"privileges_extra":    len(report.PrivilegesExtra),
+		"attributes_changed":  len(report.AttributesChanged),
+		"roles_to_prune":      len(report.RolesToPrune),
+		"role_conflicts":      len(report.RoleConflicts),
+		"schemas_missing":     len(report.SchemasMissing),
+	}).Info("Compared cluster with configuration")
+
+	return report, nil
+}
+
+// diffDescription reports a configured description that differs from the role's; roles
+// without a configured description keep theirs, as in sync
+func diffDescription(role string, attributes *structs.RoleAttributes, description string, report *structs.DriftReport) {
+	if description == "" || description == attributes.Description {
+		return
+	}
+	report.AttributesChanged = append(report.AttributesChanged, structs.AttributeChange{
+		Role:      role,
+		Attribute: "description",
+		Current:   attributes.Description,
+		Desired:   description,
+	})
+}
+
+// diffOwnership reports a configured owner, team or ticket that differs from the one
+// recorded on the role; values that are not configured are kept, as in sync
+func diffOwnership(role string, attributes *structs.RoleAttributes, owner, team, ticket string, report *structs.DriftReport) {
+	for _, field := range []struct{ attribute, current, desired string }{
+		{ownerMetadataKey, attributes.Owner, owner},
+		{teamMetadataKey, attributes.Team, team},
+		{ticketMetadataKey, attributes.Ticket, ticket},
+	} {
+		if field.desired == "" || field.desired == field.current {
+			continue
+		}
+		report.AttributesChanged = append(report.AttributesChanged, structs.AttributeChange{
+			Role:      role,
+			Attribute: field.attribute,
+			Current:   field.current,
+			Desired:   field.desired,
+		})
+	}
+}
+
+// diffSettings reports configured role settings that differ from those set on the role;
+// settings that are not configured are kept, as in sync
+func (m *Manager) diffSettings(role string, settings map[string]string, report *structs.DriftReport) error {
+	if len(settings) == 0 {
+		return nil
+	}
+	current, err := m.RoleSettings(role)
+	if err != nil {
+		return err
+	}
+	report.AttributesChanged = append(report.AttributesChanged, settingChanges(role, settings, current)...)
+	return nil
+}
+
+// diffManagedKind reports a role that sync manages as the other kind of role than the
+// configuration declares. Sync refuses such roles, so nothing else is compared for them.
+func diffManagedKind(role, kind string, attributes *structs.RoleAttributes, report *structs.DriftReport) bool {
+	if attributes.ManagedAs == "" || attributes.ManagedAs == kind {
+		return false
+	}
+	report.RoleConflicts = append(report.RoleConflicts, structs.RoleConflict{
+		Role:     role,
+		Existing: attributes.ManagedAs,
+		Declared: kind,
+	})
+	return true
+}
+
+// diffPrune reports the managed roles that sync would prune with the current prune action
+func (m *Manager) diffPrune(config *structs.Config, report *structs.DriftReport) error {
+	declared := declaredRoles(config)
+	for _, rename := range report.RolesToRename {
+		declared[rename.From] = true
+	}
+
+	users, groups, err := m.ManagedRoles()
+	if err != nil {
+		return err
+	}
+	// Groups are only pruned when they are dropped
+	if m.prune == PruneDrop {
+		users = append(users, groups...)
+	}
+	for _, role := range users {
+		if !declared[role] {
+			report.RolesToPrune = append(report.RolesToPrune, role)
+		}
+	}
+	return nil
+}
+
+// diffRole compares the memberships and database privileges of an existing role with the configured ones
+func (m *Manager) diffRole(role string, groups, privileges, databases []string, managedGroups map[string]bool, report *structs.DriftReport) error {
+	current, err := m.GetRoleMemberships(role)
+	if err != nil {
+		return err
+	}
+
+	live := make(map[string]bool, len(current))
+	for _, group := range current {
+		live[strings.ToLower(group)] = true
+	}
+	wanted := make(map[string]bool, len(groups))
+	for _, group := range groups {
+		wanted[strings.ToLower(group)] = true
+		if !live[strings.ToLower(group)] {
+			report.MembershipsMissing = append(report.MembershipsMissing, structs.Membership{Member: role, Group: group})
+		}
+	}
+	for _, group := range current {
+		if managedGroups[strings.ToLower(group)] && !wanted[strings.ToLower(group)] {
+			report.MembershipsExtra = append(report.MembershipsExtra, structs.Membership{Member: role, Group: group})
+		}
+	}
+
+	grants, err := m.GetDatabasePrivileges(role)
+	if err != nil {
+		return err
+	}
+
+	granted := make(map[string]bool, len(grants))
+	for _, grant := range grants {
+		granted[grant.Database+"/"+grant.Privilege] = true
+	}
+	desired := desiredDatabasePrivileges(privileges, databases)
+	for _, db := range databases {
+		for _, priv := range databasePrivilegeAliases["ALL"] {
+			if desired[db+"/"+priv] && !granted[db+"/"+priv] {
+				report.PrivilegesMissing = append(report.PrivilegesMissing, structs.PrivilegeGrant{Target: role, Privilege: priv, Database: db})
+			}
+		}
+	}
+	for _, grant := range grants {
+		if !desired[grant.Database+"/"+grant.Privilege] {
+			report.PrivilegesExtra = append(report.PrivilegesExtra, grant)
+		}
+	}
+
+	return nil
+}
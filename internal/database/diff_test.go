@@ -0,0 +1,152 @@
+package database
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+func TestDiffReportsDrift(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	config := &structs.Config{
+		Groups: []structs.GroupConfig{
+			{Name: "test_group", Inherit: true},
+			{Name: "test_role", Inherit: true},
+		},
+		Users: []structs.UserConfig{
+			{Username: "test_user", Password: "test_pass", Groups: []string{"test_group"}, Privileges: []string{"CONNECT"}, Databases: []string{"testdb"}, Enabled: true, CanLogin: true},
+			{Username: "test_user2", Password: "test_pass", Enabled: true, CanLogin: true},
+		},
+	}
+
+	if _, err := setup.Manager.SyncConfiguration(config); err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+
+	report, err := setup.Manager.Diff(config)
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	if report.Differences() != 0 {
+		t.Errorf("Expected no drift right after sync, got %+v", report)
+	}
+
+	// Change the configuration without syncing it
+	config.Users[0].Groups = []string{"test_role"}
+	config.Users[0].Privileges = []string{"CONNECT", "CREATE"}
+	config.Users[1].Enabled = false
+	config.Users = append(config.Users, structs.UserConfig{Username: "test_user3", Enabled: true, CanLogin: true})
+
+	report, err = setup.Manager.Diff(config)
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+
+	if len(report.RolesMissing) != 1 || report.RolesMissing[0] != "test_user3" {
+		t.Errorf("Expected test_user3 to be missing, got %v", report.RolesMissing)
+	}
+	if len(report.UsersToDisable) != 1 || report.UsersToDisable[0] != "test_user2" {
+		t.Errorf("Expected test_user2 to need disabling, got %v", report.UsersToDisable)
+	}
+	if len(report.MembershipsMissing) != 1 || report.MembershipsMissing[0].Group != "test_role" {
+		t.Errorf("Expected missing test_role membership, got %v", report.MembershipsMissing)
+	}
+	if len(report.MembershipsExtra) != 1 || report.MembershipsExtra[0].Group != "test_group" {
+		t.Errorf("Expected extra test_group membership, got %v", report.MembershipsExtra)
+	}
+	if len(report.PrivilegesMissing) != 1 || report.PrivilegesMissing[0].Privilege != "CREATE" {
+		t.Errorf("Expected missing CREATE privilege, got %v", report.PrivilegesMissing)
+	}
+
+	// Diff never changes the cluster
+	exists, err := setup.Manager.UserExists("test_user3")
+	if err != nil || exists {
+		t.Errorf("Expected diff not to create test_user3 (exists=%v, err=%v)", exists, err)
+	}
+}
+
+func TestDiffReportsAttributesAndPrune(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	config := &structs.Config{
+		Users: []structs.UserConfig{
+			{Username: "test_user", Password: "test_pass", Description: "Reporting user", Enabled: true, CanLogin: true},
+			{Username: "test_user2", Password: "test_pass", Enabled: true, CanLogin: true},
+		},
+	}
+	if _, err := setup.Manager.SyncConfiguration(config); err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+
+	config.Users[0].Description = "Reporting service"
+	config.Users[0].DeletionProtection = true
+	config.Users = config.Users[:1]
+
+	if err := setup.Manager.SetPrune(PruneDrop); err != nil {
+		t.Fatalf("Failed to set prune action: %v", err)
+	}
+	defer setup.Manager.SetPrune("")
+
+	report, err := setup.Manager.Diff(config)
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+
+	if len(report.AttributesChanged) != 2 {
+		t.Fatalf("Expected description and deletion protection changes, got %+v", report.AttributesChanged)
+	}
+	if change := report.AttributesChanged[0]; change.Attribute != "description" || change.Current != "Reporting user" || change.Desired != "Reporting service" {
+		t.Errorf("Unexpected description change: %+v", change)
+	}
+	if change := report.AttributesChanged[1]; change.Attribute != "deletion_protection" || change.Desired != "true" {
+		t.Errorf("Unexpected deletion protection change: %+v", change)
+	}
+	if len(report.RolesToPrune) != 1 || report.RolesToPrune[0] != "test_user2" {
+		t.Errorf("Expected test_user2 to be pruned, got %v", report.RolesToPrune)
+	}
+}
+
+func TestDiffAndSyncReportRoleConflicts(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	config := &structs.Config{
+		Users: []structs.UserConfig{
+			{Username: "test_user", Password: "test_pass", Enabled: true, CanLogin: true},
+		},
+	}
+	if _, err := setup.Manager.SyncConfiguration(config); err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+
+	// The same role is now declared as a group
+	config = &structs.Config{
+		Groups: []structs.GroupConfig{{Name: "test_user", Inherit: true}},
+	}
+
+	report, err := setup.Manager.Diff(config)
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	if len(report.RoleConflicts) != 1 {
+		t.Fatalf("Expected one role conflict, got %+v", report.RoleConflicts)
+	}
+	if conflict := report.RoleConflicts[0]; conflict.Role != "test_user" || conflict.Existing != "user" || conflict.Declared != "group" {
+		t.Errorf("Unexpected role conflict: %+v", conflict)
+	}
+
+	result, err := setup.Manager.SyncConfiguration(config)
+	if err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+	if len(result.Errors) != 1 || !strings.Contains(result.Errors[0].Error(), "share one role namespace") {
+		t.Errorf("Expected sync to refuse the conflicting group, got %v", result.Errors)
+	}
+}
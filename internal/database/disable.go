@@ -0,0 +1,185 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// sessionPollInterval is how often the sessions of a user are counted while they are given
+// time to disconnect before being terminated
+const sessionPollInterval = time.Second
+
+// DisableUser locks a user out without dropping it by revoking LOGIN and
+// terminating its active sessions. It reports whether the user was changed.
+func (m *Manager) DisableUser(username string) (bool, error) {
+	m.logger.WithField("username", username).Info("Disabling user")
+
+	exists, canLogin, err := m.RoleCanLogin(username)
+	if err != nil {
+		return false, fmt.Errorf("failed to check user %s: %w", username, err)
+	}
+
+	if !exists {
+		m.logger.WithField("username", username).Info("User does not exist, nothing to disable")
+		return false, nil
+	}
+
+	if !canLogin {
+		m.logger.WithField("username", username).Info("User is already locked, skipping")
+		return false, nil
+	}
+
+	query := fmt.Sprintf("ALTER ROLE %s NOLOGIN", m.quoteIdentifier(username))
+	if err := m.execute(query); err != nil {
+		return false, fmt.Errorf("failed to lock user %s: %w", username, err)
+	}
+
+	// Until a transactional sync commits, other sessions still see the user as able to log in
+	// and could reconnect, and a rollback would leave it able to, so its sessions are
+	// terminated after the commit
+	if m.tx != nil {
+		m.deferredSessions = append(m.deferredSessions, username)
+	} else if _, err := m.TerminateSessions(username); err != nil {
+		return true, err
+	}
+
+	// Record who disabled the user
+	if err := m.stampRole(username, "", "disabled", nil); err != nil {
+		return true, err
+	}
+
+	m.logger.WithField("username", username).Info("User disabled successfully")
+	return true, nil
+}
+
+// EnableUser restores LOGIN for a user locked by DisableUser. It reports whether the user was changed.
+func (m *Manager) EnableUser(username string) (bool, error) {
+	m.logger.WithField("username", username).Info("Enabling user")
+
+	exists, canLogin, err := m.RoleCanLogin(username)
+	if err != nil {
+		return false, fmt.Errorf("failed to check user %s: %w", username, err)
+	}
+
+	if !exists {
+		return false, fmt.Errorf("user %s does not exist", username)
+	}
+
+	if canLogin {
+		m.logger.WithField("username", username).Info("User can already log in, skipping")
+		return false, nil
+	}
+
+	query := fmt.Sprintf("ALTER ROLE %s LOGIN", m.quoteIdentifier(username))
+	if err := m.execute(query); err != nil {
+		return false, fmt.Errorf("failed to unlock user %s: %w", username, err)
+	}
+
+	// Record who enabled the user
+	if err := m.stampRole(username, "", "enabled", nil); err != nil {
+		return true, err
+	}
+
+	m.logger.WithField("username", username).Info("User enabled successfully")
+	return true, nil
+}
+
+// TerminateSessions terminates every active session of a role other than the
+// current one and returns the number of sessions terminated
+func (m *Manager) TerminateSessions(username string) (int, error) {
+	if m.dryRun {
+		query := fmt.Sprintf("SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE usename = '%s' AND pid <> pg_backend_pid()",
+			m.escapeString(username))
+		m.dryRunQuery(query)
+		return 0, nil
+	}
+
+	query := `
+		SELECT COUNT(*)
+		FROM (
+			SELECT pg_terminate_backend(pid) AS terminated
+			FROM pg_stat_activity
+			WHERE usename = $1 AND pid <> pg_backend_pid()
+		) sessions
+		WHERE terminated`
+
+	var terminated int
+	if err := m.executor().QueryRow(query, username).Scan(&terminated); err != nil {
+		return 0, fmt.Errorf("failed to terminate sessions for %s: %w", username, err)
+	}
+
+	m.logger.WithFields(logrus.Fields{
+		"username": username,
+		"sessions": terminated,
+	}).Info("Terminated active sessions")
+	return terminated, nil
+}
+
+// SetTerminateSessions makes DropUser terminate the active sessions of a user before dropping
+// it. With a grace period, sessions are first given that long to disconnect on their own.
+func (m *Manager) SetTerminateSessions(terminate bool, grace time.Duration) {
+	m.terminateSessions = terminate
+	m.terminateGrace = grace
+}
+
+// endSessions waits up to the grace period for the sessions of a user to disconnect and
+// terminates the ones that remain
+func (m *Manager) endSessions(username string) error {
+	if m.terminateGrace > 0 && !m.dryRun {
+		if err := m.waitForSessions(username, m.terminateGrace); err != nil {
+			return err
+		}
+	}
+	_, err := m.TerminateSessions(username)
+	return err
+}
+
+// waitForSessions waits until a user has no active sessions or the grace period is over. The
+// sessions are counted on the connection pool, as pg_stat_activity does not change within
+// the transaction of a transactional sync.
+func (m *Manager) waitForSessions(username string, grace time.Duration) error {
+	deadline := time.Now().Add(grace)
+	for {
+		var sessions int
+		err := m.db.QueryRowContext(m.context(),
+			"SELECT COUNT(*) FROM pg_stat_activity WHERE usename = $1 AND pid <> pg_backend_pid()", username).Scan(&sessions)
+		if err != nil {
+			return fmt.Errorf("failed to count sessions of %s: %w", username, err)
+		}
+		if sessions == 0 {
+			return nil
+		}
+
+		wait := min(sessionPollInterval, time.Until(deadline))
+		if wait <= 0 {
+			return nil
+		}
+		m.logger.WithFields(logrus.Fields{
+			"username":  username,
+			"sessions":  sessions,
+			"remaining": time.Until(deadline).Round(time.Second),
+		}).Info("Waiting for sessions to disconnect")
+
+		select {
+		case <-m.context().Done():
+			return m.context().Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// RoleCanLogin reports whether a role exists and whether it has the LOGIN attribute
+func (m *Manager) RoleCanLogin(name string) (bool, bool, error) {
+	var canLogin bool
+	err := m.executor().QueryRow("SELECT rolcanlogin FROM pg_roles WHERE rolname = $1", name).Scan(&canLogin)
+	if err == sql.ErrNoRows {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	return true, canLogin, nil
+}
@@ -0,0 +1,210 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+func TestDisableUser(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	// Disabling a missing user is a no-op
+	changed, err := setup.Manager.DisableUser("test_user")
+	if err != nil {
+		t.Fatalf("Unexpected error disabling missing user: %v", err)
+	}
+	if changed {
+		t.Error("Expected no change for missing user")
+	}
+
+	userConfig := &structs.UserConfig{
+		Username: "test_user",
+		Password: "test_pass",
+		CanLogin: true,
+		Enabled:  true,
+	}
+	if err := setup.Manager.CreateUser(userConfig); err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	changed, err = setup.Manager.DisableUser("test_user")
+	if err != nil {
+		t.Fatalf("Failed to disable user: %v", err)
+	}
+	if !changed {
+		t.Error("Expected user to be changed")
+	}
+
+	exists, canLogin, err := setup.Manager.RoleCanLogin("test_user")
+	if err != nil {
+		t.Fatalf("Failed to check login attribute: %v", err)
+	}
+	if !exists || canLogin {
+		t.Errorf("Expected existing user without LOGIN, got exists=%v canLogin=%v", exists, canLogin)
+	}
+
+	// Disabling again is idempotent
+	changed, err = setup.Manager.DisableUser("test_user")
+	if err != nil {
+		t.Fatalf("Failed to disable user again: %v", err)
+	}
+	if changed {
+		t.Error("Expected no change for already disabled user")
+	}
+
+	// Enabling restores LOGIN
+	changed, err = setup.Manager.EnableUser("test_user")
+	if err != nil {
+		t.Fatalf("Failed to enable user: %v", err)
+	}
+	if !changed {
+		t.Error("Expected user to be re-enabled")
+	}
+
+	_, canLogin, err = setup.Manager.RoleCanLogin("test_user")
+	if err != nil || !canLogin {
+		t.Errorf("Expected user to be able to log in again (err: %v)", err)
+	}
+}
+
+func TestSyncConfigurationDisabledAndAbsentUsers(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	for _, username := range []string{"test_user", "test_user_2"} {
+		userConfig := &structs.UserConfig{Username: username, Password: "test_pass", CanLogin: true, Enabled: true}
+		if err := setup.Manager.CreateUser(userConfig); err != nil {
+			t.Fatalf("Failed to create user %s: %v", username, err)
+		}
+	}
+
+	config := &structs.Config{
+		Users: []structs.UserConfig{
+			{Username: "test_user", Enabled: false, CanLogin: true},
+			{Username: "test_user_2", Absent: true},
+			{Username: "nologin_user", Enabled: false},
+		},
+	}
+
+	result, err := setup.Manager.SyncConfiguration(config)
+	if err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+	if len(result.Errors) > 0 {
+		t.Fatalf("Expected no sync errors, got %v", result.Errors)
+	}
+
+	if len(result.UsersDisabled) != 1 || result.UsersDisabled[0] != "test_user" {
+		t.Errorf("Expected test_user to be disabled, got %v", result.UsersDisabled)
+	}
+	if len(result.UsersRemoved) != 1 || result.UsersRemoved[0] != "test_user_2" {
+		t.Errorf("Expected test_user_2 to be removed, got %v", result.UsersRemoved)
+	}
+	// The disabled user that does not exist is a warning, not an error
+	if len(result.Warnings) != 1 || result.Warnings[0].Role != "nologin_user" {
+		t.Errorf("Expected a warning for nologin_user, got %v", result.Warnings)
+	}
+
+	exists, err := setup.Manager.UserExists("test_user")
+	if err != nil || !exists {
+		t.Errorf("Expected disabled user to still exist (err: %v)", err)
+	}
+
+	exists, err = setup.Manager.UserExists("test_user_2")
+	if err != nil || exists {
+		t.Errorf("Expected absent user to be dropped (err: %v)", err)
+	}
+
+	// Disabled users that were never created are not created
+	exists, err = setup.Manager.UserExists("nologin_user")
+	if err != nil || exists {
+		t.Errorf("Expected disabled user that never existed to stay absent (err: %v)", err)
+	}
+}
+
+func TestDropUserTerminatesSessions(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	userConfig := &structs.UserConfig{Username: "test_user", Password: "test_pass", CanLogin: true, Enabled: true}
+	if err := setup.Manager.CreateUser(userConfig); err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	// Hold a session of the user open
+	conn := *setup.ConnInfo
+	conn.Username = "test_user"
+	db, err := sql.Open("postgres", connectionString(&conn, "test_pass"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	session, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to connect as test_user: %v", err)
+	}
+	defer session.Close()
+
+	setup.Manager.SetTerminateSessions(true, 0)
+	defer setup.Manager.SetTerminateSessions(false, 0)
+	if err := setup.Manager.DropUser("test_user"); err != nil {
+		t.Fatalf("Failed to drop user: %v", err)
+	}
+
+	if err := session.PingContext(context.Background()); err == nil {
+		t.Error("Expected the session of the dropped user to be terminated")
+	}
+	if exists, _ := setup.Manager.UserExists("test_user"); exists {
+		t.Error("Expected test_user to be dropped")
+	}
+}
+
+func TestTransactionalSyncTerminatesSessionsAfterCommit(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	userConfig := &structs.UserConfig{Username: "test_user", Password: "test_pass", CanLogin: true, Enabled: true}
+	if err := setup.Manager.CreateUser(userConfig); err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	// Hold a session of the user open
+	conn := *setup.ConnInfo
+	conn.Username = "test_user"
+	db, err := sql.Open("postgres", connectionString(&conn, "test_pass"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	session, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to connect as test_user: %v", err)
+	}
+	defer session.Close()
+
+	setup.Manager.SetTransactional(true)
+	defer setup.Manager.SetTransactional(false)
+	config := &structs.Config{Users: []structs.UserConfig{{Username: "test_user", Enabled: false}}}
+	result, err := setup.Manager.SyncConfiguration(config)
+	if err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+	if len(result.Errors) > 0 {
+		t.Fatalf("Expected no sync errors, got %v", result.Errors)
+	}
+
+	if err := session.PingContext(context.Background()); err == nil {
+		t.Error("Expected the session of the disabled user to be terminated after commit")
+	}
+	if len(setup.Manager.deferredSessions) != 0 {
+		t.Errorf("Expected no sessions left to terminate, got %v", setup.Manager.deferredSessions)
+	}
+}
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/lib/pq"
+)
+
+// pgxSSLRefused is the error pgx reports for an encrypted connection to a server without
+// SSL, which has no error type of its own
+const pgxSSLRefused = "server refused TLS connection"
+
+// openConnection opens a database handle for a connection string with the driver of the
+// connection. Connections are only made when the handle is used.
+func openConnection(conn *structs.DatabaseConnection, dsn string) (*sql.DB, error) {
+	connector, err := newConnector(conn, dsn)
+	if err != nil {
+		return nil, err
+	}
+	return sql.OpenDB(connector), nil
+}
+
+// newConnector returns a connector for a connection string with the driver of the
+// connection: pgx when it is selected, lib/pq otherwise. Both take the same key/value
+// connection strings.
+func newConnector(conn *structs.DatabaseConnection, dsn string) (driver.Connector, error) {
+	if conn.Driver == structs.DriverPGX {
+		config, err := pgx.ParseConfig(dsn)
+		if err != nil {
+			return nil, err
+		}
+		return stdlib.GetConnector(*config), nil
+	}
+	return pq.NewConnector(dsn)
+}
+
+// sqlDriver returns the driver of a connection
+func sqlDriver(conn *structs.DatabaseConnection) driver.Driver {
+	if conn.Driver == structs.DriverPGX {
+		return stdlib.GetDefaultDriver()
+	}
+	return &pq.Driver{}
+}
+
+// sqlState returns the SQLSTATE and message of an error reported by the server, looking
+// through wrapped errors for the error types of both drivers
+func sqlState(err error) (code, message string, ok bool) {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return string(pqErr.Code), pqErr.Message, true
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code, pgErr.Message, true
+	}
+	return "", "", false
+}
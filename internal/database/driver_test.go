@@ -0,0 +1,41 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/lib/pq"
+)
+
+func TestNewConnector(t *testing.T) {
+	conn := &structs.DatabaseConnection{Host: "localhost", Port: 5432, Username: "admin", Database: "app db", SSLMode: "disable"}
+	dsn := connectionString(conn, `it's a \secret`)
+
+	connector, err := newConnector(conn, dsn)
+	if err != nil {
+		t.Fatalf("Failed to create lib/pq connector: %v", err)
+	}
+	if _, ok := connector.Driver().(*pq.Driver); !ok {
+		t.Errorf("Expected lib/pq without a driver, got %T", connector.Driver())
+	}
+
+	conn.Driver = structs.DriverPGX
+	connector, err = newConnector(conn, dsn)
+	if err != nil {
+		t.Fatalf("Failed to create pgx connector: %v", err)
+	}
+	if connector.Driver() != stdlib.GetDefaultDriver() || sqlDriver(conn) != stdlib.GetDefaultDriver() {
+		t.Errorf("Expected the pgx driver, got %T", connector.Driver())
+	}
+
+	// pgx reads the quoting of the connection string as lib/pq does
+	config, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		t.Fatalf("Failed to parse connection string: %v", err)
+	}
+	if config.Password != `it's a \secret` || config.Database != "app db" || config.User != "admin" {
+		t.Errorf("Unexpected pgx configuration: user %q, password %q, database %q", config.User, config.Password, config.Database)
+	}
+}
@@ -8,7 +8,7 @@ import (
 )
 
 func TestCreateUserWithInvalidCharacters(t *testing.T) {
-	setup := SetupFlexibleTestDatabase(t)
+	setup := SetupTestDatabase(t)
 	defer setup.Cleanup(t)
 	defer setup.ResetDatabase(t)
 
@@ -37,7 +37,7 @@ func TestCreateUserWithInvalidCharacters(t *testing.T) {
 }
 
 func TestCreateUserWithQuotesInUsername(t *testing.T) {
-	setup := SetupFlexibleTestDatabase(t)
+	setup := SetupTestDatabase(t)
 	defer setup.Cleanup(t)
 	defer setup.ResetDatabase(t)
 
@@ -66,7 +66,7 @@ func TestCreateUserWithQuotesInUsername(t *testing.T) {
 }
 
 func TestCreateUserWithQuotesInPassword(t *testing.T) {
-	setup := SetupFlexibleTestDatabase(t)
+	setup := SetupTestDatabase(t)
 	defer setup.Cleanup(t)
 	defer setup.ResetDatabase(t)
 
@@ -95,7 +95,7 @@ func TestCreateUserWithQuotesInPassword(t *testing.T) {
 }
 
 func TestCreateUserConnectionLimitVariations(t *testing.T) {
-	setup := SetupFlexibleTestDatabase(t)
+	setup := SetupTestDatabase(t)
 	defer setup.Cleanup(t)
 	defer setup.ResetDatabase(t)
 
@@ -153,7 +153,7 @@ func TestCreateUserConnectionLimitVariations(t *testing.T) {
 }
 
 func TestAddUserToNonExistentGroup(t *testing.T) {
-	setup := SetupFlexibleTestDatabase(t)
+	setup := SetupTestDatabase(t)
 	defer setup.Cleanup(t)
 	defer setup.ResetDatabase(t)
 
@@ -179,7 +179,7 @@ func TestAddUserToNonExistentGroup(t *testing.T) {
 }
 
 func TestRemoveUserFromNonExistentGroup(t *testing.T) {
-	setup := SetupFlexibleTestDatabase(t)
+	setup := SetupTestDatabase(t)
 	defer setup.Cleanup(t)
 	defer setup.ResetDatabase(t)
 
@@ -205,7 +205,7 @@ func TestRemoveUserFromNonExistentGroup(t *testing.T) {
 }
 
 func TestGrantPrivilegesToNonExistentUser(t *testing.T) {
-	setup := SetupFlexibleTestDatabase(t)
+	setup := SetupTestDatabase(t)
 	defer setup.Cleanup(t)
 
 	// Try to grant privileges to non-existent user - may or may not error depending on PostgreSQL behavior
@@ -221,7 +221,7 @@ func TestGrantPrivilegesToNonExistentUser(t *testing.T) {
 }
 
 func TestHelperMethods(t *testing.T) {
-	setup := SetupFlexibleTestDatabase(t)
+	setup := SetupTestDatabase(t)
 	defer setup.Cleanup(t)
 
 	// Test quoteIdentifier method
@@ -247,7 +247,7 @@ func TestHelperMethods(t *testing.T) {
 }
 
 func TestIAMAuthFlow(t *testing.T) {
-	setup := SetupFlexibleTestDatabase(t)
+	setup := SetupTestDatabase(t)
 	defer setup.Cleanup(t)
 	defer setup.ResetDatabase(t)
 
@@ -280,7 +280,7 @@ func TestIAMAuthFlow(t *testing.T) {
 }
 
 func TestCloseManager(t *testing.T) {
-	setup := SetupFlexibleTestDatabase(t)
+	setup := SetupTestDatabase(t)
 	defer setup.Cleanup(t)
 
 	// Test closing the manager
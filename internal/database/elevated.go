@@ -0,0 +1,153 @@
+package database
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+// elevatedAccess is what the connected role lacks for some of the statements of a sync. A
+// sync that defers them leaves those statements to a role with elevated access instead.
+type elevatedAccess struct {
+	groups    map[string]bool // Groups the role has no ADMIN OPTION on
+	databases map[string]bool // Databases the role cannot grant privileges on
+	schemas   map[string]bool // Extension schemas the role cannot grant privileges on
+	tables    map[string]bool // Policy tables the role does not own
+}
+
+// SetDeferElevated makes sync apply what the connected role has the privileges for and leave
+// the statements that need more, such as granting a predefined role without ADMIN OPTION on
+// it, to a script for a superuser to review and run. A role without CREATEROLE still cannot
+// sync, and neither can a configuration naming databases, schemas or tables that do not exist.
+func (m *Manager) SetDeferElevated(deferElevated bool) {
+	m.deferElevated = deferElevated
+}
+
+// preflight checks the privileges of the connected role before a sync. When statements
+// needing elevated access are deferred, the privileges only they need are not reported.
+func (m *Manager) preflight(config *structs.Config) error {
+	role, missing, err := m.missingSyncPrivileges(config)
+	if err != nil {
+		return err
+	}
+	if m.deferElevated {
+		m.elevated, missing = deferrablePrivileges(missing)
+	}
+	return preflightError(role, missing)
+}
+
+// deferrablePrivileges splits missing privileges into the access the statements left to an
+// elevated script need and the privileges every statement needs, or that no role can make up for
+func deferrablePrivileges(missing []missingPrivilege) (*elevatedAccess, []missingPrivilege) {
+	elevated := &elevatedAccess{
+		groups:    make(map[string]bool),
+		databases: make(map[string]bool),
+		schemas:   make(map[string]bool),
+		tables:    make(map[string]bool),
+	}
+	var rest []missingPrivilege
+	for _, privilege := range missing {
+		switch {
+		case privilege.group != "":
+			elevated.groups[privilege.group] = true
+		case privilege.database != "":
+			elevated.databases[privilege.database] = true
+		case privilege.schema != "":
+			elevated.schemas[privilege.schema] = true
+		case privilege.table != "":
+			elevated.tables[privilege.table] = true
+		default:
+			rest = append(rest, privilege)
+		}
+	}
+	return elevated, rest
+}
+
+// membership returns what granting membership in a group needs that the connected role
+// lacks, empty when it can grant it
+func (e *elevatedAccess) membership(group string) string {
+	if e == nil || !e.groups[group] {
+		return ""
+	}
+	return fmt.Sprintf("ADMIN OPTION on role %s", group)
+}
+
+// database returns what granting privileges on a database needs that the connected role
+// lacks, empty when it can grant them
+func (e *elevatedAccess) database(database string) string {
+	if e == nil || !e.databases[database] {
+		return ""
+	}
+	return fmt.Sprintf("grant option on database %s", database)
+}
+
+// schema returns what granting privileges on a schema needs that the connected role lacks,
+// empty when it can grant them
+func (e *elevatedAccess) schema(schema string) string {
+	if e == nil || !e.schemas[schema] {
+		return ""
+	}
+	return fmt.Sprintf("grant option on schema %s", schema)
+}
+
+// table returns what changing the policies of a table needs that the connected role lacks,
+// empty when it owns the table
+func (e *elevatedAccess) table(table string) string {
+	if e == nil || !e.tables[table] {
+		return ""
+	}
+	return fmt.Sprintf("ownership of table %s", table)
+}
+
+// leaveToElevated records a statement that needs access the connected role lacks, so it is
+// written to the elevated script instead of executed, and reports whether it did
+func (m *Manager) leaveToElevated(query, needs string) bool {
+	if needs == "" {
+		return false
+	}
+	m.logger.WithFields(logrus.Fields{
+		"query": m.logQuery(query),
+		"needs": needs,
+	}).Warn("Statement needs elevated access, leaving it to the elevated script")
+	m.elevatedStatements = append(m.elevatedStatements, structs.PlannedStatement{Entity: m.entity, Query: query, Problem: "needs " + needs})
+	return true
+}
+
+// executeUnlessElevated executes a statement, or leaves it to the elevated script when it
+// needs access the connected role lacks
+func (m *Manager) executeUnlessElevated(query, needs string) error {
+	if m.leaveToElevated(query, needs) {
+		return nil
+	}
+	return m.execute(query)
+}
+
+// WriteElevatedScript writes the statements a sync left to a role with elevated access as a
+// SQL script to review and run on the database the sync connected to. The statements run in
+// one transaction, each after a comment naming its entity and what it needs.
+func WriteElevatedScript(w io.Writer, database string, statements []structs.PlannedStatement) error {
+	var b strings.Builder
+	b.WriteString("-- Statements sync left to a role with elevated access, such as a superuser, because\n")
+	b.WriteString("-- the connected role lacks the privileges they need. Review them, then run them on\n")
+	fmt.Fprintf(&b, "-- database %s, e.g. with psql -v ON_ERROR_STOP=1 -d %s -f <this file>\n", database, database)
+	if len(statements) == 0 {
+		b.WriteString("\n-- Nothing needs elevated access.\n")
+		_, err := io.WriteString(w, b.String())
+		return err
+	}
+
+	b.WriteString("\nBEGIN;\n")
+	for _, statement := range statements {
+		entity := statement.Entity
+		if entity == "" {
+			entity = "sync"
+		}
+		fmt.Fprintf(&b, "\n-- %s: %s\n%s;\n", entity, statement.Problem, statement.Query)
+	}
+	b.WriteString("\nCOMMIT;\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,156 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+func TestDeferrablePrivileges(t *testing.T) {
+	missing := []missingPrivilege{
+		{description: "CREATEROLE"},
+		{description: "ADMIN OPTION on role pg_monitor (or use --auto-grant-admin)", group: "pg_monitor"},
+		{description: "grant option on database reports", database: "reports"},
+		{description: "database missing_db (does not exist)"},
+		{description: "ownership of table public.orders", table: "public.orders"},
+	}
+
+	elevated, rest := deferrablePrivileges(missing)
+	if len(rest) != 2 || rest[0].description != "CREATEROLE" || rest[1].description != "database missing_db (does not exist)" {
+		t.Errorf("Expected CREATEROLE and the missing database to still be reported, got %+v", rest)
+	}
+	if elevated.membership("pg_monitor") != "ADMIN OPTION on role pg_monitor" || elevated.membership("readers") != "" {
+		t.Errorf("Expected only memberships in pg_monitor to need elevated access")
+	}
+	if elevated.database("reports") == "" || elevated.table("public.orders") == "" || elevated.schema("public") != "" {
+		t.Errorf("Expected the database and table to need elevated access, got %+v", elevated)
+	}
+
+	// Nothing needs elevated access when statements are not deferred
+	var none *elevatedAccess
+	if none.membership("pg_monitor") != "" || none.database("reports") != "" {
+		t.Error("Expected no elevated access to be needed without deferral")
+	}
+}
+
+func TestElevatedStatementsAreLeftToScript(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	m := &Manager{logger: logger, ctx: context.Background(), dryRun: true, statements: []structs.PlannedStatement{}}
+	m.elevated, _ = deferrablePrivileges([]missingPrivilege{
+		{group: "pg_monitor"},
+		{database: "reports"},
+		{schema: "extensions"},
+	})
+
+	m.entity = "user:app_user"
+	m.addToGroups("app_user", []string{"readers", "pg_monitor"}, func(group string, err error) {
+		t.Errorf("Failed to add app_user to %s: %v", group, err)
+	})
+	if err := m.GrantPrivileges("app_user", []string{"CONNECT"}, []string{"app", "reports"}); err != nil {
+		t.Fatalf("Failed to grant privileges: %v", err)
+	}
+	if err := m.GrantExtensionSchema("app_user", &structs.ExtensionSchemaGrant{Extension: "pgcrypto", Schema: "extensions"}); err != nil {
+		t.Fatalf("Failed to grant extension schema: %v", err)
+	}
+
+	// What the connected role can run is planned as usual
+	var planned []string
+	for _, statement := range m.statements {
+		planned = append(planned, statement.Query)
+	}
+	expected := []string{`GRANT "readers" TO "app_user"`, `GRANT CONNECT ON DATABASE "app" TO "app_user"`}
+	if !reflect.DeepEqual(planned, expected) {
+		t.Errorf("Expected planned statements %q, got %q", expected, planned)
+	}
+
+	elevated := []structs.PlannedStatement{
+		{Entity: "user:app_user", Query: `GRANT "pg_monitor" TO "app_user"`, Problem: "needs ADMIN OPTION on role pg_monitor"},
+		{Entity: "user:app_user", Query: `GRANT CONNECT ON DATABASE "reports" TO "app_user"`, Problem: "needs grant option on database reports"},
+		{Entity: "user:app_user", Query: `GRANT USAGE ON SCHEMA "extensions" TO "app_user"`, Problem: "needs grant option on schema extensions"},
+	}
+	if !reflect.DeepEqual(m.elevatedStatements, elevated) {
+		t.Errorf("Expected elevated statements %+v, got %+v", elevated, m.elevatedStatements)
+	}
+}
+
+func TestWriteElevatedScript(t *testing.T) {
+	var script strings.Builder
+	statements := []structs.PlannedStatement{
+		{Entity: "user:app_user", Query: `GRANT "pg_monitor" TO "app_user"`, Problem: "needs ADMIN OPTION on role pg_monitor"},
+	}
+	if err := WriteElevatedScript(&script, "appdb", statements); err != nil {
+		t.Fatalf("Failed to write script: %v", err)
+	}
+
+	for _, expected := range []string{
+		"psql -v ON_ERROR_STOP=1 -d appdb",
+		"BEGIN;\n\n-- user:app_user: needs ADMIN OPTION on role pg_monitor\nGRANT \"pg_monitor\" TO \"app_user\";\n\nCOMMIT;\n",
+	} {
+		if !strings.Contains(script.String(), expected) {
+			t.Errorf("Expected the script to contain %q, got:\n%s", expected, script.String())
+		}
+	}
+
+	// A script with nothing to run says so, replacing any earlier one
+	script.Reset()
+	if err := WriteElevatedScript(&script, "appdb", nil); err != nil {
+		t.Fatalf("Failed to write empty script: %v", err)
+	}
+	if !strings.Contains(script.String(), "Nothing needs elevated access") || strings.Contains(script.String(), "BEGIN") {
+		t.Errorf("Expected an empty script, got:\n%s", script.String())
+	}
+}
+
+func TestSyncLeavesElevatedStatements(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	// A role that can create roles but cannot grant on the database it connects to
+	if _, err := setup.Manager.db.Exec("CREATE ROLE limited_user LOGIN CREATEROLE PASSWORD 'limited_pass'"); err != nil {
+		t.Fatalf("Failed to create limited role: %v", err)
+	}
+	conn := *setup.ConnInfo
+	conn.Username, conn.Password = "limited_user", "limited_pass"
+	limited, err := NewManager(&conn, setup.Logger, false)
+	if err != nil {
+		t.Fatalf("Failed to connect as limited role: %v", err)
+	}
+	defer limited.Close()
+
+	config := &structs.Config{
+		Users: []structs.UserConfig{
+			{Username: "test_user", Password: "test_pass", Privileges: []string{"CONNECT"}, Databases: []string{conn.Database}, Enabled: true, CanLogin: true},
+		},
+	}
+
+	var preflightErr *PreflightError
+	if _, err := limited.SyncConfiguration(config); !errors.As(err, &preflightErr) {
+		t.Fatalf("Expected the preflight check to fail without deferral, got %v", err)
+	}
+
+	limited.SetDeferElevated(true)
+	result, err := limited.SyncConfiguration(config)
+	if err != nil || len(result.Errors) != 0 {
+		t.Fatalf("Failed to sync configuration: %v %v", err, result.Errors)
+	}
+	if exists, _ := setup.Manager.UserExists("test_user"); !exists {
+		t.Error("Expected the user to be created by the limited role")
+	}
+
+	expected := []structs.PlannedStatement{{
+		Entity:  "user:test_user",
+		Query:   fmt.Sprintf("GRANT CONNECT ON DATABASE %q TO \"test_user\"", conn.Database),
+		Problem: "needs grant option on database " + conn.Database,
+	}}
+	if !reflect.DeepEqual(result.Elevated, expected) {
+		t.Errorf("Expected elevated statements %+v, got %+v", expected, result.Elevated)
+	}
+}
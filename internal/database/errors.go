@@ -0,0 +1,131 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// ErrorKind classifies a database failure by what an operator can do about it
+type ErrorKind string
+
+const (
+	// ErrorKindUnknown is a failure without a more specific kind
+	ErrorKindUnknown ErrorKind = "unknown"
+	// ErrorKindConnection is a server that could not be reached
+	ErrorKindConnection ErrorKind = "connection"
+	// ErrorKindAuthentication is a rejected password or IAM token
+	ErrorKindAuthentication ErrorKind = "authentication"
+	// ErrorKindHostRejected is a connection pg_hba.conf has no entry for
+	ErrorKindHostRejected ErrorKind = "host_rejected"
+	// ErrorKindSSLRequired is an unencrypted connection the server only accepts with SSL
+	ErrorKindSSLRequired ErrorKind = "ssl_required"
+	// ErrorKindSSLUnavailable is an encrypted connection to a server without SSL
+	ErrorKindSSLUnavailable ErrorKind = "ssl_unavailable"
+	// ErrorKindPermission is a statement the connected role lacks the privilege for
+	ErrorKindPermission ErrorKind = "permission"
+	// ErrorKindAlreadyExists is a role or other object created twice
+	ErrorKindAlreadyExists ErrorKind = "already_exists"
+	// ErrorKindAlreadyMember is a membership granted twice
+	ErrorKindAlreadyMember ErrorKind = "already_member"
+	// ErrorKindDependentObjects is a role that cannot be dropped while it owns objects or
+	// holds privileges
+	ErrorKindDependentObjects ErrorKind = "dependent_objects"
+	// ErrorKindDeletionProtected is a role that has deletion protection
+	ErrorKindDeletionProtected ErrorKind = "deletion_protected"
+	// ErrorKindTimeout is work stopped by --timeout
+	ErrorKindTimeout ErrorKind = "timeout"
+	// ErrorKindReadReplica is a change sent to a server in recovery, which only reads
+	ErrorKindReadReplica ErrorKind = "read_replica"
+)
+
+// Error is a database failure classified by kind, wrapping the error it was classified from
+type Error struct {
+	Kind ErrorKind
+	Code string // SQLSTATE reported by the server, empty for failures on the client side
+	Err  error
+}
+
+// Error implements the error interface
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the classified error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Classify returns the kind of a failure returned by the Manager, looking through wrapped
+// errors for the server's SQLSTATE and the client errors of lib/pq, pgx and the network. It
+// returns nil for a nil error.
+func Classify(err error) *Error {
+	if err == nil {
+		return nil
+	}
+
+	var classified *Error
+	if errors.As(err, &classified) {
+		return classified
+	}
+
+	// A statement cancelled by the deadline fails with the server's query_canceled
+	if errors.Is(err, context.DeadlineExceeded) {
+		return &Error{Kind: ErrorKindTimeout, Err: err}
+	}
+
+	// Checked before SQLSTATEs, since failing over wraps the errors of the endpoints tried
+	if errors.Is(err, ErrReadReplica) {
+		return &Error{Kind: ErrorKindReadReplica, Err: err}
+	}
+
+	if code, message, ok := sqlState(err); ok {
+		return &Error{Kind: serverErrorKind(code, message), Code: code, Err: err}
+	}
+
+	kind := ErrorKindUnknown
+	var netErr *net.OpError
+	switch {
+	case errors.Is(err, ErrDeletionProtected):
+		kind = ErrorKindDeletionProtected
+	case errors.Is(err, pq.ErrSSLNotSupported), strings.Contains(err.Error(), pgxSSLRefused):
+		kind = ErrorKindSSLUnavailable
+	case errors.As(err, &netErr):
+		kind = ErrorKindConnection
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+// serverErrorKind classifies an error reported by the server by its SQLSTATE and, where the
+// same SQLSTATE covers several causes, its message
+func serverErrorKind(code, message string) ErrorKind {
+	switch code {
+	case "28P01":
+		return ErrorKindAuthentication
+	case "28000":
+		// pg_hba.conf rejections name whether the attempt was encrypted
+		if strings.Contains(message, "no encryption") || strings.Contains(message, "SSL off") {
+			return ErrorKindSSLRequired
+		}
+		if strings.Contains(message, "pg_hba.conf") {
+			return ErrorKindHostRejected
+		}
+		return ErrorKindAuthentication
+	case "42501":
+		return ErrorKindPermission
+	case "42710":
+		return ErrorKindAlreadyExists
+	case "2BP01":
+		return ErrorKindDependentObjects
+	case "25006":
+		// A standby refuses writes as a read-only transaction
+		return ErrorKindReadReplica
+	}
+	if strings.Contains(message, "is already a member of role") {
+		return ErrorKindAlreadyMember
+	}
+	return ErrorKindUnknown
+}
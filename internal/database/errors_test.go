@@ -0,0 +1,53 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/lib/pq"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected ErrorKind
+	}{
+		{name: "wrong password", err: &pq.Error{Code: "28P01", Message: `password authentication failed for user "app"`}, expected: ErrorKindAuthentication},
+		{name: "ssl required", err: &pq.Error{Code: "28000", Message: `no pg_hba.conf entry for host "10.0.0.1", user "app", database "app", no encryption`}, expected: ErrorKindSSLRequired},
+		{name: "host rejected", err: &pq.Error{Code: "28000", Message: `no pg_hba.conf entry for host "10.0.0.1", user "app", database "app", SSL encryption`}, expected: ErrorKindHostRejected},
+		{name: "ssl unavailable", err: fmt.Errorf("failed to ping database: %w", pq.ErrSSLNotSupported), expected: ErrorKindSSLUnavailable},
+		{name: "permission", err: fmt.Errorf("failed to create user app: %w", &pq.Error{Code: "42501"}), expected: ErrorKindPermission},
+		{name: "dependent objects", err: fmt.Errorf("failed to drop user app: %w", &pq.Error{Code: "2BP01"}), expected: ErrorKindDependentObjects},
+		{name: "already exists", err: &pq.Error{Code: "42710"}, expected: ErrorKindAlreadyExists},
+		{name: "already member", err: &pq.Error{Code: "0LP01", Message: `role "app" is already a member of role "readers"`}, expected: ErrorKindAlreadyMember},
+		{name: "deletion protected", err: fmt.Errorf("refusing to drop app: %w", ErrDeletionProtected), expected: ErrorKindDeletionProtected},
+		{name: "read replica", err: fmt.Errorf("failed to connect: %w", errors.Join(ErrReadReplica, &pq.Error{Code: "28P01"})), expected: ErrorKindReadReplica},
+		{name: "read-only transaction", err: &pq.Error{Code: "25006", Message: "cannot execute CREATE ROLE in a read-only transaction"}, expected: ErrorKindReadReplica},
+		{name: "pgx wrong password", err: fmt.Errorf("failed to connect: %w", &pgconn.PgError{Code: "28P01", Message: `password authentication failed for user "app"`}), expected: ErrorKindAuthentication},
+		{name: "pgx ssl unavailable", err: errors.New("failed to connect to `host=localhost user=app database=app`: server refused TLS connection"), expected: ErrorKindSSLUnavailable},
+		{name: "timeout", err: fmt.Errorf("sync stopped: %w", context.DeadlineExceeded), expected: ErrorKindTimeout},
+		{name: "unreachable", err: &net.OpError{Op: "dial", Net: "tcp", Err: fmt.Errorf("connection refused")}, expected: ErrorKindConnection},
+		{name: "other", err: fmt.Errorf("something else"), expected: ErrorKindUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			classified := Classify(tt.err)
+			if classified.Kind != tt.expected {
+				t.Errorf("Expected kind %s, got %s", tt.expected, classified.Kind)
+			}
+			if classified.Error() != tt.err.Error() {
+				t.Errorf("Expected the original message, got %q", classified.Error())
+			}
+		})
+	}
+
+	if Classify(nil) != nil {
+		t.Error("Expected nil for a nil error")
+	}
+}
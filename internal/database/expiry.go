@@ -0,0 +1,113 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultExpiryWindow is how far ahead upcoming membership expirations are reported
+	DefaultExpiryWindow = 7 * 24 * time.Hour
+)
+
+// ExpireMemberships revokes the temporary memberships of users that have expired by now and
+// reports the ones that expire within the window. Users that do not exist, and expired
+// memberships that were already revoked, are skipped.
+func (m *Manager) ExpireMemberships(users []structs.UserConfig, now time.Time, window time.Duration) *structs.ExpiryResult {
+	result := &structs.ExpiryResult{}
+
+	for i := range users {
+		user := &users[i]
+		if len(user.TemporaryGroups) == 0 || user.Absent {
+			continue
+		}
+
+		expired, err := m.revokeExpiredMemberships(user, now)
+		result.Expired = append(result.Expired, expired...)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("failed to expire memberships of user %s: %w", user.Username, err))
+		}
+
+		for _, membership := range user.TemporaryGroups {
+			if now.Before(membership.ExpiresAt) && !now.Add(window).Before(membership.ExpiresAt) {
+				result.Upcoming = append(result.Upcoming, structs.MembershipExpiry{
+					Member:    user.Username,
+					Group:     membership.Group,
+					ExpiresAt: membership.ExpiresAt,
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(result.Upcoming, func(i, j int) bool {
+		return result.Upcoming[i].ExpiresAt.Before(result.Upcoming[j].ExpiresAt)
+	})
+
+	m.logger.WithFields(logrus.Fields{
+		"expired":  len(result.Expired),
+		"upcoming": len(result.Upcoming),
+		"errors":   len(result.Errors),
+	}).Info("Membership expiry completed")
+
+	return result
+}
+
+// revokeExpiredMemberships revokes the temporary memberships of a user that have expired by
+// now and that it still holds, returning the ones revoked
+func (m *Manager) revokeExpiredMemberships(user *structs.UserConfig, now time.Time) ([]structs.MembershipExpiry, error) {
+	var held map[string]bool
+	var expired []structs.MembershipExpiry
+
+	for _, membership := range user.TemporaryGroups {
+		if now.Before(membership.ExpiresAt) {
+			continue
+		}
+
+		// Only look up the live memberships when something has expired
+		if held == nil {
+			current, err := m.GetRoleMemberships(user.Username)
+			if err != nil {
+				return expired, err
+			}
+			held = make(map[string]bool, len(current))
+			for _, group := range current {
+				held[strings.ToLower(group)] = true
+			}
+		}
+		if !held[strings.ToLower(membership.Group)] {
+			continue
+		}
+
+		m.logger.WithFields(logrus.Fields{
+			"member":     user.Username,
+			"group":      membership.Group,
+			"expires_at": membership.ExpiresAt.Format(time.RFC3339),
+		}).Info("Temporary membership expired")
+
+		if err := m.RemoveUserFromGroup(user.Username, membership.Group); err != nil {
+			return expired, err
+		}
+		expired = append(expired, structs.MembershipExpiry{
+			Member:    user.Username,
+			Group:     membership.Group,
+			ExpiresAt: membership.ExpiresAt,
+		})
+	}
+
+	return expired, nil
+}
+
+// configuredGroups returns every group the configuration manages the membership of a user
+// in: its groups and its temporary groups, whether or not they have expired
+func configuredGroups(user *structs.UserConfig) []string {
+	groups := append([]string{}, user.Groups...)
+	for _, membership := range user.TemporaryGroups {
+		groups = append(groups, membership.Group)
+	}
+	return groups
+}
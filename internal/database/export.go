@@ -0,0 +1,94 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/lib/pq"
+)
+
+// ListClusterRoles returns every role except the built-in pg_ roles, with its attributes,
+// the metadata recorded in its comment, its direct memberships, its database grants and its
+// grants on the schemas of the connected database, ordered by name
+func (m *Manager) ListClusterRoles() ([]structs.ClusterRole, error) {
+	query := `
+		SELECT r.rolname, r.rolcanlogin, r.rolinherit, r.rolsuper, r.rolconnlimit,
+			CASE WHEN r.rolvaliduntil = 'infinity' THEN NULL ELSE r.rolvaliduntil END,
+			COALESCE(shobj_description(r.oid, 'pg_authid'), ''),
+			array_remove(ARRAY[
+				CASE WHEN r.rolcreaterole THEN 'CREATEROLE' END,
+				CASE WHEN r.rolcreatedb THEN 'CREATEDB' END,
+				CASE WHEN r.rolreplication THEN 'REPLICATION' END,
+				CASE WHEN r.rolbypassrls THEN 'BYPASSRLS' END], NULL),
+			ARRAY(
+				SELECT g.rolname FROM pg_auth_members am JOIN pg_roles g ON g.oid = am.roleid
+				WHERE am.member = r.oid ORDER BY 1),
+			ARRAY(
+				SELECT a.privilege_type || ' ON ' || d.datname
+				FROM pg_database d CROSS JOIN LATERAL aclexplode(d.datacl) a
+				WHERE a.grantee = r.oid AND d.datdba <> r.oid ORDER BY d.datname, a.privilege_type),
+			ARRAY(
+				SELECT a.privilege_type || ' ON ' || n.nspname || ' ' || COALESCE((
+					SELECT e.extname FROM pg_extension e WHERE e.extnamespace = n.oid ORDER BY 1 LIMIT 1), '')
+				FROM pg_namespace n CROSS JOIN LATERAL aclexplode(n.nspacl) a
+				WHERE a.grantee = r.oid AND n.nspowner <> r.oid
+				ORDER BY n.nspname, a.privilege_type)
+		FROM pg_roles r
+		WHERE r.rolname !~ '^pg_'
+		ORDER BY r.rolname`
+
+	rows, err := m.executor().Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list roles for export: %w", err)
+	}
+	defer rows.Close()
+
+	roles := []structs.ClusterRole{}
+	for rows.Next() {
+		var role structs.ClusterRole
+		var validUntil sql.NullTime
+		var comment string
+		var grants, schemaGrants []string
+		if err := rows.Scan(&role.Name, &role.CanLogin, &role.Inherit, &role.Superuser, &role.ConnectionLimit,
+			&validUntil, &comment, pq.Array(&role.Attributes), pq.Array(&role.MemberOf),
+			pq.Array(&grants), pq.Array(&schemaGrants)); err != nil {
+			return nil, fmt.Errorf("failed to scan role for export: %w", err)
+		}
+
+		var metadata map[string]string
+		role.Description, metadata = parseRoleComment(comment)
+		role.Kind = metadata[managedMetadataKey]
+		role.Owner = metadata[ownerMetadataKey]
+		role.Team = metadata[teamMetadataKey]
+		role.Ticket = metadata[ticketMetadataKey]
+		role.ExternalID = metadata[externalIDMetadataKey]
+		role.DeletionProtection = metadata[protectionMetadataKey] == "true"
+		if auth := metadata["auth"]; auth != "" {
+			role.AuthMethods = strings.Split(auth, ",")
+		}
+		if validUntil.Valid {
+			t := validUntil.Time.UTC()
+			role.ValidUntil = &t
+		}
+
+		for _, grant := range grants {
+			privilege, database, _ := strings.Cut(grant, " ON ")
+			role.Grants = append(role.Grants, structs.PrivilegeGrant{Target: role.Name, Privilege: privilege, Database: database})
+		}
+		for _, grant := range schemaGrants {
+			privilege, rest, _ := strings.Cut(grant, " ON ")
+			// Schema names may hold spaces, extension names never do
+			separator := strings.LastIndex(rest, " ")
+			role.SchemaGrants = append(role.SchemaGrants, structs.SchemaPrivilege{
+				Schema:    rest[:separator],
+				Privilege: privilege,
+				Extension: rest[separator+1:],
+			})
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
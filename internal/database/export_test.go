@@ -0,0 +1,70 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+func TestListClusterRoles(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	config := &structs.Config{
+		Groups: []structs.GroupConfig{
+			{Name: "test_export_group", Privileges: []string{"CONNECT"}, Databases: []string{"testdb"}, Inherit: false},
+		},
+		Users: []structs.UserConfig{
+			{Username: "test_export_user", Password: "export_password", Groups: []string{"test_export_group"}, Enabled: true, CanLogin: true, Team: "payments", Description: "Exported user"},
+		},
+	}
+	if _, err := setup.Manager.SyncConfiguration(config); err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+	for _, query := range []string{
+		"CREATE ROLE test_export_unmanaged CREATEDB",
+		"CREATE SCHEMA test_export_schema",
+		"GRANT USAGE ON SCHEMA test_export_schema TO test_export_unmanaged",
+	} {
+		if _, err := setup.Manager.db.Exec(query); err != nil {
+			t.Fatalf("Failed to run %s: %v", query, err)
+		}
+	}
+	defer setup.Manager.db.Exec("DROP SCHEMA test_export_schema")
+
+	roles, err := setup.Manager.ListClusterRoles()
+	if err != nil {
+		t.Fatalf("Failed to list cluster roles: %v", err)
+	}
+	byName := make(map[string]structs.ClusterRole)
+	for _, role := range roles {
+		byName[role.Name] = role
+	}
+
+	group := byName["test_export_group"]
+	if group.Kind != "group" || group.Inherit || group.CanLogin {
+		t.Errorf("Unexpected group: %+v", group)
+	}
+	if len(group.Grants) != 1 || group.Grants[0].Privilege != "CONNECT" || group.Grants[0].Database != "testdb" {
+		t.Errorf("Expected CONNECT on testdb, got %+v", group.Grants)
+	}
+
+	user := byName["test_export_user"]
+	if user.Kind != "user" || !user.CanLogin || user.Description != "Exported user" || user.Team != "payments" {
+		t.Errorf("Unexpected user: %+v", user)
+	}
+	if !reflect.DeepEqual(user.MemberOf, []string{"test_export_group"}) || !reflect.DeepEqual(user.AuthMethods, []string{"password"}) {
+		t.Errorf("Unexpected memberships or auth methods: %+v", user)
+	}
+
+	unmanaged := byName["test_export_unmanaged"]
+	if unmanaged.Kind != "" || !reflect.DeepEqual(unmanaged.Attributes, []string{"CREATEDB"}) {
+		t.Errorf("Unexpected unmanaged role: %+v", unmanaged)
+	}
+	expected := []structs.SchemaPrivilege{{Schema: "test_export_schema", Privilege: "USAGE"}}
+	if !reflect.DeepEqual(unmanaged.SchemaGrants, expected) {
+		t.Errorf("Expected schema grants %+v, got %+v", expected, unmanaged.SchemaGrants)
+	}
+}
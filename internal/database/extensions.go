@@ -0,0 +1,215 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+// validSchemaPrivileges lists the privileges that can be granted on a schema
+var validSchemaPrivileges = map[string]bool{
+	"USAGE":  true,
+	"CREATE": true,
+	"ALL":    true,
+}
+
+// validLargeObjectPrivileges lists the privileges that can be granted on a large object
+var validLargeObjectPrivileges = map[string]bool{
+	"SELECT": true,
+	"UPDATE": true,
+	"ALL":    true,
+}
+
+// largeObjectPrivilegesIn lists the privileges ALL stands for on a large object
+var largeObjectPrivilegesIn = map[string][]string{
+	"ALL":    {"SELECT", "UPDATE"},
+	"SELECT": {"SELECT"},
+	"UPDATE": {"UPDATE"},
+}
+
+// GrantExtensionSchema grants privileges on the schema of an installed extension, unless
+// the role already holds them
+func (m *Manager) GrantExtensionSchema(target string, grant *structs.ExtensionSchemaGrant) error {
+	m.logger.WithFields(logrus.Fields{
+		"target":    target,
+		"extension": grant.Extension,
+		"schema":    grant.Schema,
+	}).Info("Granting extension schema privileges")
+
+	privileges := grant.Privileges
+	if len(privileges) == 0 {
+		privileges = []string{"USAGE"}
+	}
+	privileges, err := normalizePrivileges(privileges, validSchemaPrivileges, "schema", "USAGE, CREATE or ALL")
+	if err != nil {
+		return fmt.Errorf("extension %s: %w", grant.Extension, err)
+	}
+
+	schema := grant.Schema
+	if schema == "" {
+		schema, err = m.getExtensionSchema(grant.Extension)
+		if err != nil {
+			return err
+		}
+	}
+
+	held, err := m.heldPrivileges(`
+		SELECT a.privilege_type
+		FROM pg_namespace n
+		CROSS JOIN LATERAL aclexplode(COALESCE(n.nspacl, acldefault('n', n.nspowner))) a
+		JOIN pg_roles r ON r.oid = a.grantee
+		WHERE n.nspname = $1 AND r.rolname = $2`, schema, target)
+	if err != nil {
+		return fmt.Errorf("failed to look up privileges on schema %s of %s: %w", schema, target, err)
+	}
+
+	needs := m.elevated.schema(schema)
+	if lacksPrivileges(privileges, schemaPrivilegesIn, held) {
+		query := fmt.Sprintf("GRANT %s ON SCHEMA %s TO %s",
+			privilegeList(privileges), m.quoteIdentifier(schema), m.quoteIdentifier(target))
+		if err := m.executeUnlessElevated(query, needs); err != nil {
+			return fmt.Errorf("failed to grant privileges on schema %s to %s: %w", schema, target, err)
+		}
+	}
+
+	lacking := false
+	if grant.Functions {
+		if lacking, err = m.lacksFunctionExecute(target, schema); err != nil {
+			return err
+		}
+	}
+	if lacking {
+		query := fmt.Sprintf("GRANT EXECUTE ON ALL FUNCTIONS IN SCHEMA %s TO %s",
+			m.quoteIdentifier(schema), m.quoteIdentifier(target))
+		if err := m.executeUnlessElevated(query, needs); err != nil {
+			return fmt.Errorf("failed to grant execute on functions in schema %s to %s: %w", schema, target, err)
+		}
+	}
+
+	m.logger.WithFields(logrus.Fields{
+		"target": target,
+		"schema": schema,
+	}).Info("Extension schema privileges granted successfully")
+	return nil
+}
+
+// GrantLargeObject grants privileges on a large object, unless the role already holds them
+func (m *Manager) GrantLargeObject(target string, grant *structs.LargeObjectGrant) error {
+	m.logger.WithFields(logrus.Fields{
+		"target": target,
+		"oid":    grant.OID,
+	}).Info("Granting large object privileges")
+
+	if len(grant.Privileges) == 0 {
+		return fmt.Errorf("no privileges configured for large object %d", grant.OID)
+	}
+	privileges, err := normalizePrivileges(grant.Privileges, validLargeObjectPrivileges, "large object", "SELECT, UPDATE or ALL")
+	if err != nil {
+		return err
+	}
+
+	held, err := m.heldPrivileges(`
+		SELECT a.privilege_type
+		FROM pg_largeobject_metadata l
+		CROSS JOIN LATERAL aclexplode(COALESCE(l.lomacl, acldefault('L', l.lomowner))) a
+		JOIN pg_roles r ON r.oid = a.grantee
+		WHERE l.oid = $1 AND r.rolname = $2`, grant.OID, target)
+	if err != nil {
+		return fmt.Errorf("failed to look up privileges on large object %d of %s: %w", grant.OID, target, err)
+	}
+	if !lacksPrivileges(privileges, largeObjectPrivilegesIn, held) {
+		return nil
+	}
+
+	query := fmt.Sprintf("GRANT %s ON LARGE OBJECT %d TO %s",
+		privilegeList(privileges), grant.OID, m.quoteIdentifier(target))
+	if err := m.execute(query); err != nil {
+		return fmt.Errorf("failed to grant privileges on large object %d to %s: %w", grant.OID, target, err)
+	}
+
+	return nil
+}
+
+// heldPrivileges returns the privileges a query over an ACL finds granted to a role itself,
+// not through its groups, so they are granted again when it leaves a group. Without a
+// connection, as in some dry runs, no privileges are held.
+func (m *Manager) heldPrivileges(query string, args ...any) (map[string]bool, error) {
+	held := make(map[string]bool)
+	if m.db == nil {
+		return held, nil
+	}
+
+	rows, err := m.executor().Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var privilege string
+		if err := rows.Scan(&privilege); err != nil {
+			return nil, err
+		}
+		held[privilege] = true
+	}
+	return held, rows.Err()
+}
+
+// lacksPrivileges reports whether any of the normalized privileges, expanded as ALL stands
+// for several, is not held
+func lacksPrivileges(privileges []string, expansions map[string][]string, held map[string]bool) bool {
+	for _, privilege := range privileges {
+		for _, expanded := range expansions[privilege] {
+			if !held[expanded] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// lacksFunctionExecute reports whether a role is missing EXECUTE, granted to it directly, on
+// any function in a schema
+func (m *Manager) lacksFunctionExecute(target, schema string) (bool, error) {
+	if m.db == nil {
+		return true, nil
+	}
+
+	var lacking bool
+	err := m.executor().QueryRow(`
+		SELECT EXISTS (
+			SELECT 1
+			FROM pg_proc p
+			JOIN pg_namespace n ON n.oid = p.pronamespace
+			WHERE n.nspname = $1 AND NOT EXISTS (
+				SELECT 1
+				FROM aclexplode(COALESCE(p.proacl, acldefault('f', p.proowner))) a
+				JOIN pg_roles r ON r.oid = a.grantee
+				WHERE r.rolname = $2 AND a.privilege_type = 'EXECUTE'))`, schema, target).Scan(&lacking)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up execute on functions in schema %s of %s: %w", schema, target, err)
+	}
+	return lacking, nil
+}
+
+// getExtensionSchema returns the schema an extension is installed in
+func (m *Manager) getExtensionSchema(extension string) (string, error) {
+	query := `
+		SELECT n.nspname
+		FROM pg_extension e
+		JOIN pg_namespace n ON n.oid = e.extnamespace
+		WHERE e.extname = $1`
+
+	var schema string
+	err := m.executor().QueryRow(query, extension).Scan(&schema)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("extension %s is not installed", extension)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up schema for extension %s: %w", extension, err)
+	}
+
+	return schema, nil
+}
@@ -0,0 +1,90 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+func TestGrantExtensionSchema(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	if err := setup.Manager.CreateGroup(&structs.GroupConfig{Name: "test_group", Inherit: true}); err != nil {
+		t.Fatalf("Failed to create group: %v", err)
+	}
+
+	// plpgsql is installed in every database, so its schema can always be resolved
+	grant := &structs.ExtensionSchemaGrant{Extension: "plpgsql"}
+	if err := setup.Manager.GrantExtensionSchema("test_group", grant); err != nil {
+		t.Fatalf("Failed to grant extension schema privileges: %v", err)
+	}
+
+	// Explicit schemas bypass the extension lookup
+	grant = &structs.ExtensionSchemaGrant{Extension: "pg_cron", Schema: "public", Privileges: []string{"usage"}, Functions: true}
+	if err := setup.Manager.GrantExtensionSchema("test_group", grant); err != nil {
+		t.Fatalf("Failed to grant explicit schema privileges: %v", err)
+	}
+
+	// ALL is granted on its own, and not again once it is held
+	grant = &structs.ExtensionSchemaGrant{Extension: "plpgsql", Privileges: []string{"usage", "all"}}
+	if err := setup.Manager.GrantExtensionSchema("test_group", grant); err != nil {
+		t.Fatalf("Failed to grant ALL with other privileges: %v", err)
+	}
+	statementsBefore := setup.Manager.counts.statements.Load()
+	if err := setup.Manager.GrantExtensionSchema("test_group", grant); err != nil {
+		t.Fatalf("Failed to grant held privileges: %v", err)
+	}
+	if executed := setup.Manager.counts.statements.Load() - statementsBefore; executed != 0 {
+		t.Errorf("Expected no statements for privileges already held, executed %d", executed)
+	}
+
+	// Uninstalled extensions without a schema cannot be resolved
+	grant = &structs.ExtensionSchemaGrant{Extension: "not_installed"}
+	if err := setup.Manager.GrantExtensionSchema("test_group", grant); err == nil {
+		t.Error("Expected error for uninstalled extension")
+	}
+
+	// Invalid privileges are rejected
+	grant = &structs.ExtensionSchemaGrant{Extension: "plpgsql", Privileges: []string{"SELECT"}}
+	if err := setup.Manager.GrantExtensionSchema("test_group", grant); err == nil {
+		t.Error("Expected error for invalid schema privilege")
+	}
+}
+
+func TestGrantLargeObject(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	if err := setup.Manager.CreateGroup(&structs.GroupConfig{Name: "test_group", Inherit: true}); err != nil {
+		t.Fatalf("Failed to create group: %v", err)
+	}
+
+	var oid uint32
+	if err := setup.Manager.db.QueryRow("SELECT lo_create(0)").Scan(&oid); err != nil {
+		t.Fatalf("Failed to create large object: %v", err)
+	}
+	defer setup.Manager.db.Exec("SELECT lo_unlink($1)", oid)
+
+	grant := &structs.LargeObjectGrant{OID: oid, Privileges: []string{"SELECT", "UPDATE"}}
+	if err := setup.Manager.GrantLargeObject("test_group", grant); err != nil {
+		t.Fatalf("Failed to grant large object privileges: %v", err)
+	}
+
+	// Privileges already held are not granted again
+	statementsBefore := setup.Manager.counts.statements.Load()
+	grant = &structs.LargeObjectGrant{OID: oid, Privileges: []string{"select", "ALL"}}
+	if err := setup.Manager.GrantLargeObject("test_group", grant); err != nil {
+		t.Fatalf("Failed to grant held large object privileges: %v", err)
+	}
+	if executed := setup.Manager.counts.statements.Load() - statementsBefore; executed != 0 {
+		t.Errorf("Expected no statements for privileges already held, executed %d", executed)
+	}
+
+	grant = &structs.LargeObjectGrant{OID: oid, Privileges: []string{"DELETE"}}
+	if err := setup.Manager.GrantLargeObject("test_group", grant); err == nil {
+		t.Error("Expected error for invalid large object privilege")
+	}
+}
@@ -0,0 +1,550 @@
+// Package fake provides an in-memory stand-in for the database manager. It keeps a catalog
+// of roles, memberships and database privileges and implements database.Syncer on it the way
+// PostgreSQL would: the role methods, and a sync of a configuration's users and groups. Code
+// written against these interfaces or a subset of them, such as the sync command and the
+// RoleManager interfaces of the server and events packages, can be tested without a database.
+package fake
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/database"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+// privilegeAliases expands database privileges to the privilege types PostgreSQL records
+var privilegeAliases = map[string][]string{
+	"CONNECT":        {"CONNECT"},
+	"CREATE":         {"CREATE"},
+	"TEMPORARY":      {"TEMPORARY"},
+	"TEMP":           {"TEMPORARY"},
+	"ALL":            {"CONNECT", "CREATE", "TEMPORARY"},
+	"ALL PRIVILEGES": {"CONNECT", "CREATE", "TEMPORARY"},
+}
+
+// Role is a role of the fake catalog
+type Role struct {
+	Name              string
+	CanLogin          bool
+	Inherit           bool
+	Superuser         bool
+	CreateRole        bool
+	ConnectionLimit   int
+	ExternalID        string // Identity provider ID recorded when the user was created
+	DeletionProtected bool   // Dropping the role fails with database.ErrDeletionProtected
+	Managed           string // database.ManagedKindUser or ManagedKindGroup when marked as managed
+}
+
+// Manager is an in-memory database.Syncer. It is safe for concurrent use.
+type Manager struct {
+	mu         sync.Mutex
+	roles      map[string]*Role
+	members    map[string]map[string]bool // Group -> member roles
+	privileges map[string]map[string]bool // Role -> "<database> <privilege>"
+	statements []string
+	pingErr    error
+	revisions  []structs.ConfigRevision
+
+	// Sync settings
+	exactMemberships   bool
+	exactPrivileges    bool
+	overrideProtection bool
+	prune              string
+}
+
+var _ database.Syncer = (*Manager)(nil)
+
+// NewManager creates a manager whose catalog holds the given roles
+func NewManager(roles ...Role) *Manager {
+	m := &Manager{
+		roles:      make(map[string]*Role),
+		members:    make(map[string]map[string]bool),
+		privileges: make(map[string]map[string]bool),
+	}
+	for _, role := range roles {
+		m.AddRole(role)
+	}
+	return m
+}
+
+// AddRole adds a role to the catalog, replacing a role of the same name, without recording
+// a statement. Use it to set up the cluster a test starts from.
+func (m *Manager) AddRole(role Role) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	added := role
+	m.roles[role.Name] = &added
+}
+
+// Role returns a copy of a role of the catalog, or nil when it does not exist
+func (m *Manager) Role(name string) *Role {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	role, exists := m.roles[name]
+	if !exists {
+		return nil
+	}
+	copied := *role
+	return &copied
+}
+
+// Roles returns the names of the roles of the catalog in name order
+func (m *Manager) Roles() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := make([]string, 0, len(m.roles))
+	for name := range m.roles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Statements returns the statements the manager would have run against PostgreSQL, in order
+func (m *Manager) Statements() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return slices.Clone(m.statements)
+}
+
+// SetPingError makes Ping fail with err, or succeed again when err is nil
+func (m *Manager) SetPingError(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.pingErr = err
+}
+
+// Ping reports the error set with SetPingError
+func (m *Manager) Ping() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.pingErr
+}
+
+// Close does nothing; the catalog stays readable
+func (m *Manager) Close() error {
+	return nil
+}
+
+// UserExists checks if a user exists
+func (m *Manager) UserExists(username string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, exists := m.roles[username]
+	return exists, nil
+}
+
+// GroupExists checks if a group exists
+func (m *Manager) GroupExists(groupName string) (bool, error) {
+	return m.UserExists(groupName)
+}
+
+// RoleCanLogin reports whether a role exists and whether it has the LOGIN attribute
+func (m *Manager) RoleCanLogin(name string) (bool, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	role, exists := m.roles[name]
+	if !exists {
+		return false, false, nil
+	}
+	return true, role.CanLogin, nil
+}
+
+// RoleExternalID reports whether a role exists and the identity provider ID recorded for it
+func (m *Manager) RoleExternalID(name string) (bool, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	role, exists := m.roles[name]
+	if !exists {
+		return false, "", nil
+	}
+	return true, role.ExternalID, nil
+}
+
+// ManagedKind reports how a role is marked as managed, empty when it does not exist or is
+// not marked. The roles the manager creates are marked.
+func (m *Manager) ManagedKind(role string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if r, exists := m.roles[role]; exists {
+		return r.Managed, nil
+	}
+	return "", nil
+}
+
+// GetRoleAttributes returns the attributes of a role, or nil when it does not exist
+func (m *Manager) GetRoleAttributes(name string) (*structs.RoleAttributes, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	role, exists := m.roles[name]
+	if !exists {
+		return nil, nil
+	}
+	return &structs.RoleAttributes{
+		CanLogin:           role.CanLogin,
+		Inherit:            role.Inherit,
+		Superuser:          role.Superuser,
+		CreateRole:         role.CreateRole,
+		ConnectionLimit:    role.ConnectionLimit,
+		DeletionProtection: role.DeletionProtected,
+		ManagedAs:          role.Managed,
+	}, nil
+}
+
+// CreateUser creates a user unless a role of the same name exists. IAM users are granted
+// rds_iam when it exists.
+func (m *Manager) CreateUser(user *structs.UserConfig) error {
+	if err := structs.CheckIdentifier(user.Username); err != nil {
+		return fmt.Errorf("cannot create user: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.roles[user.Username]; exists {
+		return nil
+	}
+
+	login := "NOLOGIN"
+	if user.CanLogin {
+		login = "LOGIN"
+	}
+	inherit := ""
+	if user.NoInherit {
+		inherit = " NOINHERIT"
+	}
+	m.record("CREATE USER %s %s%s", quote(user.Username), login, inherit)
+	m.roles[user.Username] = &Role{
+		Name:            user.Username,
+		CanLogin:        user.CanLogin,
+		Inherit:         !user.NoInherit,
+		ConnectionLimit: connectionLimit(user.ConnectionLimit),
+		ExternalID:      user.ExternalID,
+		Managed:         database.ManagedKindUser,
+	}
+
+	if user.HasAuthMethod(structs.AuthMethodIAM) && m.roles["rds_iam"] != nil {
+		m.grantMembership(user.Username, "rds_iam")
+	}
+	return nil
+}
+
+// DropUser drops a user, which loses its memberships and privileges. A user that does not
+// exist is skipped.
+func (m *Manager) DropUser(username string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.dropRole(username, "DROP USER")
+}
+
+// CreateGroup creates a group unless a role of the same name exists
+func (m *Manager) CreateGroup(group *structs.GroupConfig) error {
+	if err := structs.CheckIdentifier(group.Name); err != nil {
+		return fmt.Errorf("cannot create group: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.roles[group.Name]; exists {
+		return nil
+	}
+
+	inherit := "NOINHERIT"
+	if group.Inherit {
+		inherit = "INHERIT"
+	}
+	m.record("CREATE ROLE %s %s", quote(group.Name), inherit)
+	m.roles[group.Name] = &Role{Name: group.Name, Inherit: group.Inherit, ConnectionLimit: -1, Managed: database.ManagedKindGroup}
+	return nil
+}
+
+// DropGroup drops a group, whose members lose the membership. Login roles are refused and
+// a group that does not exist is skipped.
+func (m *Manager) DropGroup(groupName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if role, exists := m.roles[groupName]; exists && role.CanLogin {
+		return fmt.Errorf("refusing to drop %s: it is a login role, use drop-user", groupName)
+	}
+	return m.dropRole(groupName, "DROP ROLE")
+}
+
+// DisableUser revokes LOGIN from a user. It reports whether the user was changed.
+func (m *Manager) DisableUser(username string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	role, exists := m.roles[username]
+	if !exists || !role.CanLogin {
+		return false, nil
+	}
+	m.record("ALTER ROLE %s NOLOGIN", quote(username))
+	role.CanLogin = false
+	return true, nil
+}
+
+// EnableUser restores LOGIN for a user. It reports whether the user was changed.
+func (m *Manager) EnableUser(username string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	role, exists := m.roles[username]
+	if !exists {
+		return false, fmt.Errorf("user %s does not exist", username)
+	}
+	if role.CanLogin {
+		return false, nil
+	}
+	m.record("ALTER ROLE %s LOGIN", quote(username))
+	role.CanLogin = true
+	return true, nil
+}
+
+// SetConnectionLimit sets the connection limit of a role and returns its previous limit
+func (m *Manager) SetConnectionLimit(role string, limit int) (int, error) {
+	if limit < -1 || limit > math.MaxInt32 {
+		return 0, fmt.Errorf("invalid connection limit %d for role %s (must be -1 for unlimited or between 0 and %d)", limit, role, math.MaxInt32)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, exists := m.roles[role]
+	if !exists {
+		return 0, fmt.Errorf("role %s does not exist", role)
+	}
+	previous := existing.ConnectionLimit
+	if previous != limit {
+		m.record("ALTER ROLE %s CONNECTION LIMIT %d", quote(role), limit)
+		existing.ConnectionLimit = limit
+	}
+	return previous, nil
+}
+
+// IsDeletionProtected reports whether a role has deletion protection
+func (m *Manager) IsDeletionProtected(role string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, exists := m.roles[role]
+	return exists && existing.DeletionProtected, nil
+}
+
+// SetDeletionProtection sets or clears deletion protection on a role
+func (m *Manager) SetDeletionProtection(role string, protected bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, exists := m.roles[role]
+	if !exists {
+		return fmt.Errorf("role %s does not exist", role)
+	}
+	if existing.DeletionProtected != protected {
+		existing.DeletionProtected = protected
+	}
+	return nil
+}
+
+// AddUserToGroup grants a group to a user or group. Both roles must exist.
+func (m *Manager) AddUserToGroup(username, groupName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, name := range []string{groupName, username} {
+		if _, exists := m.roles[name]; !exists {
+			return fmt.Errorf("failed to add user %s to group %s: role %q does not exist", username, groupName, name)
+		}
+	}
+	if username == groupName || m.isMemberOf(groupName, username) {
+		return fmt.Errorf("failed to add user %s to group %s: role %q is a member of role %q", username, groupName, groupName, username)
+	}
+	m.grantMembership(username, groupName)
+	return nil
+}
+
+// RemoveUserFromGroup revokes a group from a user or group. The group must exist; revoking
+// a membership the role does not have changes nothing, as in PostgreSQL.
+func (m *Manager) RemoveUserFromGroup(username, groupName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.roles[groupName]; !exists {
+		return fmt.Errorf("failed to remove user %s from group %s: role %q does not exist", username, groupName, groupName)
+	}
+	m.record("REVOKE %s FROM %s", quote(groupName), quote(username))
+	delete(m.members[groupName], username)
+	return nil
+}
+
+// GetRoleMemberships returns the groups a role is a direct member of, in name order
+func (m *Manager) GetRoleMemberships(role string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var groups []string
+	for group, members := range m.members {
+		if members[role] {
+			groups = append(groups, group)
+		}
+	}
+	sort.Strings(groups)
+	return groups, nil
+}
+
+// GetGroupMembers returns the direct members of a group, in name order
+func (m *Manager) GetGroupMembers(group string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var members []string
+	for member := range m.members[group] {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members, nil
+}
+
+// GrantPrivileges grants database privileges to a role
+func (m *Manager) GrantPrivileges(target string, privileges []string, databases []string) error {
+	return m.changePrivileges(true, target, privileges, databases)
+}
+
+// RevokePrivileges revokes database privileges from a role
+func (m *Manager) RevokePrivileges(target string, privileges []string, databases []string) error {
+	return m.changePrivileges(false, target, privileges, databases)
+}
+
+// GetDatabasePrivileges returns the database privileges granted to a role, ordered by
+// database and privilege
+func (m *Manager) GetDatabasePrivileges(role string) ([]structs.PrivilegeGrant, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	grants := []structs.PrivilegeGrant{}
+	for granted := range m.privileges[role] {
+		db, privilege, _ := strings.Cut(granted, " ")
+		grants = append(grants, structs.PrivilegeGrant{Target: role, Privilege: privilege, Database: db})
+	}
+	sort.Slice(grants, func(i, j int) bool {
+		if grants[i].Database != grants[j].Database {
+			return grants[i].Database < grants[j].Database
+		}
+		return grants[i].Privilege < grants[j].Privilege
+	})
+	return grants, nil
+}
+
+// changePrivileges grants or revokes database privileges, expanding ALL and TEMP as
+// PostgreSQL does
+func (m *Manager) changePrivileges(grant bool, target string, privileges []string, databases []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.roles[target]; !exists {
+		return fmt.Errorf("role %q does not exist", target)
+	}
+
+	for _, db := range databases {
+		for _, priv := range privileges {
+			expanded, valid := privilegeAliases[strings.ToUpper(priv)]
+			if !valid {
+				return fmt.Errorf("invalid privilege type %s for database", priv)
+			}
+
+			if grant {
+				m.record("GRANT %s ON DATABASE %s TO %s", priv, quote(db), quote(target))
+			} else {
+				m.record("REVOKE %s ON DATABASE %s FROM %s", priv, quote(db), quote(target))
+			}
+			for _, privilege := range expanded {
+				if grant {
+					if m.privileges[target] == nil {
+						m.privileges[target] = make(map[string]bool)
+					}
+					m.privileges[target][db+" "+privilege] = true
+				} else {
+					delete(m.privileges[target], db+" "+privilege)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// dropRole drops a role with its memberships and privileges unless it has deletion
+// protection that is not overridden
+func (m *Manager) dropRole(name, statement string) error {
+	role, exists := m.roles[name]
+	if !exists {
+		return nil
+	}
+	if role.DeletionProtected && !m.overrideProtection {
+		return fmt.Errorf("refusing to drop %s: %w", name, database.ErrDeletionProtected)
+	}
+
+	m.record("%s %s", statement, quote(name))
+	delete(m.roles, name)
+	delete(m.members, name)
+	for _, members := range m.members {
+		delete(members, name)
+	}
+	delete(m.privileges, name)
+	return nil
+}
+
+// grantMembership makes a role a member of a group
+func (m *Manager) grantMembership(member, group string) {
+	m.record("GRANT %s TO %s", quote(group), quote(member))
+	if m.members[group] == nil {
+		m.members[group] = make(map[string]bool)
+	}
+	m.members[group][member] = true
+}
+
+// isMemberOf reports whether a role is a member of a group, directly or through other groups
+func (m *Manager) isMemberOf(role, group string) bool {
+	for member := range m.members[group] {
+		if member == role || m.isMemberOf(role, member) {
+			return true
+		}
+	}
+	return false
+}
+
+// record appends a statement to the statements the manager would have run
+func (m *Manager) record(format string, args ...any) {
+	m.statements = append(m.statements, fmt.Sprintf(format, args...))
+}
+
+// quote double-quotes an identifier as PostgreSQL requires
+func quote(identifier string) string {
+	return `"` + strings.ReplaceAll(identifier, `"`, `""`) + `"`
+}
+
+// connectionLimit returns the connection limit of a configured user, where an unset limit
+// is unlimited
+func connectionLimit(limit int) int {
+	if limit == 0 {
+		return -1
+	}
+	return limit
+}
@@ -0,0 +1,140 @@
+package fake_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/database"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/database/fake"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/events"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/server"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+// The fake stands in for the manager wherever a subset of it is accepted
+var (
+	_ server.RoleManager = (*fake.Manager)(nil)
+	_ events.RoleManager = (*fake.Manager)(nil)
+)
+
+func TestRoles(t *testing.T) {
+	manager := fake.NewManager(fake.Role{Name: "rds_iam"})
+
+	if err := manager.CreateUser(&structs.UserConfig{Username: "app_user", AuthMethod: structs.AuthMethodIAM, CanLogin: true, ExternalID: "1234"}); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if err := manager.CreateGroup(&structs.GroupConfig{Name: "readers", Inherit: true}); err != nil {
+		t.Fatalf("Failed to create group: %v", err)
+	}
+	// Creating an existing role is skipped
+	if err := manager.CreateUser(&structs.UserConfig{Username: "readers", CanLogin: true}); err != nil {
+		t.Fatalf("Expected an existing role to be skipped, got %v", err)
+	}
+
+	if exists, canLogin, _ := manager.RoleCanLogin("app_user"); !exists || !canLogin {
+		t.Errorf("Expected app_user to be a login role, got exists %t and can login %t", exists, canLogin)
+	}
+	if exists, canLogin, _ := manager.RoleCanLogin("readers"); !exists || canLogin {
+		t.Errorf("Expected readers to be a group, got exists %t and can login %t", exists, canLogin)
+	}
+	if _, externalID, _ := manager.RoleExternalID("app_user"); externalID != "1234" {
+		t.Errorf("Expected the external ID to be recorded, got %q", externalID)
+	}
+	if groups, _ := manager.GetRoleMemberships("app_user"); !slices.Equal(groups, []string{"rds_iam"}) {
+		t.Errorf("Expected the IAM user to be granted rds_iam, got %v", groups)
+	}
+
+	if err := manager.DropGroup("app_user"); err == nil {
+		t.Error("Expected dropping a login role as a group to fail")
+	}
+	if changed, _ := manager.DisableUser("app_user"); !changed || manager.Role("app_user").CanLogin {
+		t.Error("Expected app_user to be locked")
+	}
+	if changed, _ := manager.DisableUser("app_user"); changed {
+		t.Error("Expected a locked user to be left alone")
+	}
+	if _, err := manager.EnableUser("missing"); err == nil {
+		t.Error("Expected enabling a missing user to fail")
+	}
+
+	if err := manager.DropUser("app_user"); err != nil {
+		t.Fatalf("Failed to drop user: %v", err)
+	}
+	if members, _ := manager.GetGroupMembers("rds_iam"); len(members) != 0 {
+		t.Errorf("Expected the dropped user to lose its memberships, got %v", members)
+	}
+
+	expected := []string{
+		`CREATE USER "app_user" LOGIN`,
+		`GRANT "rds_iam" TO "app_user"`,
+		`CREATE ROLE "readers" INHERIT`,
+		`ALTER ROLE "app_user" NOLOGIN`,
+		`DROP USER "app_user"`,
+	}
+	if statements := manager.Statements(); !slices.Equal(statements, expected) {
+		t.Errorf("Expected statements %q, got %q", expected, statements)
+	}
+}
+
+func TestMemberships(t *testing.T) {
+	manager := fake.NewManager(fake.Role{Name: "readers"}, fake.Role{Name: "writers"}, fake.Role{Name: "alice", CanLogin: true})
+
+	if err := manager.AddUserToGroup("alice", "missing"); err == nil {
+		t.Error("Expected granting a missing group to fail")
+	}
+	if err := manager.AddUserToGroup("readers", "writers"); err != nil {
+		t.Fatalf("Failed to grant writers to readers: %v", err)
+	}
+	if err := manager.AddUserToGroup("writers", "readers"); err == nil {
+		t.Error("Expected a membership cycle to be refused")
+	}
+	if err := manager.AddUserToGroup("alice", "readers"); err != nil {
+		t.Fatalf("Failed to grant readers to alice: %v", err)
+	}
+
+	if err := manager.DropGroup("readers"); err != nil {
+		t.Fatalf("Failed to drop readers: %v", err)
+	}
+	if groups, _ := manager.GetRoleMemberships("alice"); len(groups) != 0 {
+		t.Errorf("Expected alice to lose the dropped group, got %v", groups)
+	}
+}
+
+func TestPrivileges(t *testing.T) {
+	manager := fake.NewManager(fake.Role{Name: "alice", CanLogin: true})
+
+	if err := manager.GrantPrivileges("alice", []string{"ALL"}, []string{"app_db"}); err != nil {
+		t.Fatalf("Failed to grant privileges: %v", err)
+	}
+	if err := manager.RevokePrivileges("alice", []string{"temp"}, []string{"app_db"}); err != nil {
+		t.Fatalf("Failed to revoke privileges: %v", err)
+	}
+	if err := manager.GrantPrivileges("alice", []string{"SELECT"}, []string{"app_db"}); err == nil {
+		t.Error("Expected a table privilege to be rejected")
+	}
+
+	grants, _ := manager.GetDatabasePrivileges("alice")
+	expected := []structs.PrivilegeGrant{
+		{Target: "alice", Privilege: "CONNECT", Database: "app_db"},
+		{Target: "alice", Privilege: "CREATE", Database: "app_db"},
+	}
+	if !slices.Equal(grants, expected) {
+		t.Errorf("Expected %v, got %v", expected, grants)
+	}
+}
+
+func TestDeletionProtection(t *testing.T) {
+	manager := fake.NewManager(fake.Role{Name: "svc_billing", CanLogin: true, DeletionProtected: true})
+
+	if err := manager.DropUser("svc_billing"); !errors.Is(err, database.ErrDeletionProtected) {
+		t.Errorf("Expected ErrDeletionProtected, got %v", err)
+	}
+
+	if err := manager.SetDeletionProtection("svc_billing", false); err != nil {
+		t.Fatalf("Failed to clear deletion protection: %v", err)
+	}
+	if err := manager.DropUser("svc_billing"); err != nil || manager.Role("svc_billing") != nil {
+		t.Errorf("Expected svc_billing to be dropped, got %v", err)
+	}
+}
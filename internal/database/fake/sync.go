@@ -0,0 +1,429 @@
+package fake
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/database"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+// SetExactMemberships controls whether sync revokes memberships in declared groups that the
+// configuration no longer lists
+func (m *Manager) SetExactMemberships(exact bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.exactMemberships = exact
+}
+
+// SetExactPrivileges controls whether sync revokes database privileges that the
+// configuration no longer lists
+func (m *Manager) SetExactPrivileges(exact bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.exactPrivileges = exact
+}
+
+// SetOverrideProtection lets roles with deletion protection be dropped
+func (m *Manager) SetOverrideProtection(override bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.overrideProtection = override
+}
+
+// SetPrune makes sync remove managed roles that are no longer in the configuration, as
+// Manager.SetPrune does
+func (m *Manager) SetPrune(action string) error {
+	switch action {
+	case "", database.PruneDrop, database.PruneDisable:
+	default:
+		return fmt.Errorf("invalid prune action: %s (must be '%s' or '%s')", action, database.PruneDrop, database.PruneDisable)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.prune = action
+	return nil
+}
+
+// The settings below tune how Manager reaches PostgreSQL, or act on objects, passwords and
+// checkpoints the catalog does not hold. The fake accepts them and they have no effect.
+
+// SetSlowOperationThreshold has no effect on the fake
+func (m *Manager) SetSlowOperationThreshold(threshold time.Duration) {}
+
+// SetAutoGrantAdmin has no effect on the fake
+func (m *Manager) SetAutoGrantAdmin(auto bool) {}
+
+// SetGrantWorkers has no effect on the fake
+func (m *Manager) SetGrantWorkers(workers int) {}
+
+// SetUserWorkers has no effect on the fake
+func (m *Manager) SetUserWorkers(workers int) {}
+
+// SetSkipPreflight has no effect on the fake
+func (m *Manager) SetSkipPreflight(skip bool) {}
+
+// SetDeferElevated has no effect on the fake
+func (m *Manager) SetDeferElevated(deferElevated bool) {}
+
+// SetChangeLimits has no effect on the fake
+func (m *Manager) SetChangeLimits(limits structs.ChangeLimitsConfig) {}
+
+// SetAllowLargeChange has no effect on the fake
+func (m *Manager) SetAllowLargeChange(allow bool) {}
+
+// SetReassignTo has no effect on the fake
+func (m *Manager) SetReassignTo(role string) {}
+
+// SetCascade has no effect on the fake
+func (m *Manager) SetCascade(cascade bool) {}
+
+// SetTerminateSessions has no effect on the fake
+func (m *Manager) SetTerminateSessions(terminate bool, grace time.Duration) {}
+
+// SetTransactional has no effect on the fake
+func (m *Manager) SetTransactional(transactional bool) {}
+
+// SetRotateExpired has no effect on the fake
+func (m *Manager) SetRotateExpired(maxAge time.Duration) {}
+
+// SetCheckpoint has no effect on the fake
+func (m *Manager) SetCheckpoint(checkpoint *database.Checkpoint) {}
+
+// RecordRevision records the configuration revision a sync applied
+func (m *Manager) RecordRevision(revision structs.ConfigRevision) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if revision.AppliedAt.IsZero() {
+		revision.AppliedAt = time.Now().UTC()
+	}
+	m.revisions = append(m.revisions, revision)
+	return nil
+}
+
+// Revisions returns the configuration revisions recorded so far, oldest first
+func (m *Manager) Revisions() []structs.ConfigRevision {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return slices.Clone(m.revisions)
+}
+
+// SyncConfiguration applies the users and groups of a configuration to the catalog the way
+// Manager.SyncConfiguration applies them to PostgreSQL. Groups are applied before users.
+// Absent users are dropped and disabled users locked. The others are created or altered,
+// marked as managed and granted their memberships and database privileges. Undeclared
+// memberships in declared groups and undeclared database privileges are reported, or revoked
+// with exact memberships and privileges. With prune, managed roles no longer declared are
+// removed last. Failures of single roles are collected in the result, as sync does.
+// Renames, passwords, role settings and grants on objects are not modelled.
+func (m *Manager) SyncConfiguration(config *structs.Config) (*structs.SyncResult, error) {
+	start := time.Now()
+	result := &structs.SyncResult{UsersDeclared: len(config.Users), GroupsDeclared: len(config.Groups)}
+
+	m.mu.Lock()
+	prune := m.prune
+	statementsBefore := len(m.statements)
+	m.mu.Unlock()
+
+	// An empty configuration would prune every managed role, which is never what was meant
+	if prune != "" && len(config.Users) == 0 && len(config.Groups) == 0 {
+		return nil, fmt.Errorf("refusing to prune with a configuration that declares no users or groups")
+	}
+
+	managedGroups := make(map[string]bool, len(config.Groups))
+	for _, group := range config.Groups {
+		managedGroups[group.Name] = true
+	}
+
+	// Every group exists before the memberships between groups are granted, so they need
+	// no dependency order
+	synced := make([]bool, len(config.Groups))
+	for i := range config.Groups {
+		synced[i] = m.syncGroup(&config.Groups[i], result)
+	}
+	for i, group := range config.Groups {
+		if synced[i] {
+			m.syncGrants("group", group.Name, group.MemberOf, group.Privileges, group.Databases, managedGroups, result)
+		}
+	}
+
+	for i := range config.Users {
+		m.syncUser(&config.Users[i], managedGroups, result)
+	}
+
+	if prune != "" {
+		m.pruneRoles(prune, config, result)
+	}
+
+	m.mu.Lock()
+	result.StatementsExecuted = len(m.statements) - statementsBefore
+	m.mu.Unlock()
+	result.Duration = time.Since(start)
+	return result, nil
+}
+
+// syncGroup creates or alters a group and marks it as managed. It reports whether the group
+// can be granted its memberships and privileges.
+func (m *Manager) syncGroup(group *structs.GroupConfig, result *structs.SyncResult) bool {
+	if err := m.checkManagedKind(group.Name, database.ManagedKindGroup); err != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("failed to sync group %s: %w", group.Name, err))
+		return false
+	}
+	if err := m.CreateGroup(group); err != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("failed to create group %s: %w", group.Name, err))
+		return false
+	}
+	result.GroupsCreated = append(result.GroupsCreated, group.Name)
+
+	if m.alterRole(group.Name, database.ManagedKindGroup, false, group.Inherit, -1) {
+		result.GroupsModified = append(result.GroupsModified, group.Name)
+	}
+	return true
+}
+
+// syncUser drops, locks or applies a user
+func (m *Manager) syncUser(user *structs.UserConfig, managedGroups map[string]bool, result *structs.SyncResult) {
+	// Absent users are removed entirely
+	if user.Absent {
+		existed, err := m.dropAbsentUser(user)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("failed to remove absent user %s: %w", user.Username, err))
+		} else if existed {
+			result.UsersRemoved = append(result.UsersRemoved, user.Username)
+		}
+		return
+	}
+
+	// Disabled users are locked out but kept, so their grants survive re-enabling
+	if !user.Enabled {
+		exists, _ := m.UserExists(user.Username)
+		if !exists {
+			result.Warn(user.Username, "disabled user does not exist and was not created")
+			return
+		}
+		if changed, _ := m.DisableUser(user.Username); changed {
+			result.UsersDisabled = append(result.UsersDisabled, user.Username)
+		}
+		return
+	}
+
+	if err := m.checkManagedKind(user.Username, database.ManagedKindUser); err != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("failed to sync user %s: %w", user.Username, err))
+		return
+	}
+	if err := m.CreateUser(user); err != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("failed to create user %s: %w", user.Username, err))
+		return
+	}
+	result.UsersCreated = append(result.UsersCreated, user.Username)
+
+	if m.alterRole(user.Username, database.ManagedKindUser, user.CanLogin, !user.NoInherit, connectionLimit(user.ConnectionLimit)) {
+		result.UsersModified = append(result.UsersModified, user.Username)
+	}
+	if err := m.SetDeletionProtection(user.Username, user.DeletionProtection); err != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("failed to update deletion protection of user %s: %w", user.Username, err))
+	}
+
+	m.syncGrants("user", user.Username, user.Groups, user.Privileges, user.Databases, managedGroups, result)
+}
+
+// dropAbsentUser drops a user the configuration marks as absent. Protection in the
+// configuration applies even before it has been recorded on the role.
+func (m *Manager) dropAbsentUser(user *structs.UserConfig) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	role, exists := m.roles[user.Username]
+	if !exists {
+		return false, nil
+	}
+	if user.DeletionProtection && !role.DeletionProtected && !m.overrideProtection {
+		return true, fmt.Errorf("refusing to drop %s: %w", user.Username, database.ErrDeletionProtected)
+	}
+	return true, m.dropRole(user.Username, "DROP USER")
+}
+
+// syncGrants grants a role the groups and database privileges it lacks, then reports or
+// revokes the memberships in declared groups and the database privileges it holds beyond them
+func (m *Manager) syncGrants(kind, name string, groups, privileges, databases []string, managedGroups map[string]bool, result *structs.SyncResult) {
+	memberships, _ := m.GetRoleMemberships(name)
+	for _, group := range groups {
+		if slices.Contains(memberships, group) {
+			continue
+		}
+		if err := m.AddUserToGroup(name, group); err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("failed to add %s %s to group %s: %w", kind, name, group, err))
+		}
+	}
+
+	m.mu.Lock()
+	exactMemberships, exactPrivileges := m.exactMemberships, m.exactPrivileges
+	m.mu.Unlock()
+
+	for _, group := range memberships {
+		if !managedGroups[group] || slices.Contains(groups, group) {
+			continue
+		}
+		membership := structs.Membership{Member: name, Group: group}
+		if !exactMemberships {
+			result.MembershipsExtra = append(result.MembershipsExtra, membership)
+			result.Warn(name, fmt.Sprintf("membership in %s is not in the configuration, left in place (use --exact-memberships to revoke it)", group))
+			continue
+		}
+		if err := m.RemoveUserFromGroup(name, group); err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("failed to reconcile memberships of %s %s: %w", kind, name, err))
+			continue
+		}
+		result.MembershipsRevoked = append(result.MembershipsRevoked, membership)
+	}
+
+	current, _ := m.GetDatabasePrivileges(name)
+	held := make(map[string]bool, len(current))
+	for _, grant := range current {
+		held[grant.Database+" "+grant.Privilege] = true
+	}
+	wanted := make(map[string]bool)
+	var missing []string
+	for _, db := range databases {
+		lacking := false
+		for _, privilege := range privileges {
+			for _, expanded := range privilegeAliases[strings.ToUpper(privilege)] {
+				wanted[db+" "+expanded] = true
+				lacking = lacking || !held[db+" "+expanded]
+			}
+		}
+		if lacking {
+			missing = append(missing, db)
+		}
+	}
+	if err := m.GrantPrivileges(name, privileges, missing); err != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("failed to grant privileges to %s %s: %w", kind, name, err))
+	}
+
+	for _, grant := range current {
+		if wanted[grant.Database+" "+grant.Privilege] {
+			continue
+		}
+		if !exactPrivileges {
+			result.PrivilegesExtra = append(result.PrivilegesExtra, grant)
+			result.Warn(name, fmt.Sprintf("%s on database %s is not in the configuration, left in place (use --exact-privileges to revoke it)", grant.Privilege, grant.Database))
+			continue
+		}
+		if err := m.RevokePrivileges(name, []string{grant.Privilege}, []string{grant.Database}); err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("failed to reconcile privileges of %s %s: %w", kind, name, err))
+			continue
+		}
+		result.PrivilegesRevoked = append(result.PrivilegesRevoked, grant)
+	}
+}
+
+// pruneRoles removes the managed roles the configuration no longer declares, users before
+// groups. Users are dropped or disabled depending on the prune action; groups are only dropped.
+func (m *Manager) pruneRoles(action string, config *structs.Config, result *structs.SyncResult) {
+	declared := make(map[string]bool, len(config.Users)+len(config.Groups))
+	for _, user := range config.Users {
+		declared[user.Username] = true
+	}
+	for _, group := range config.Groups {
+		declared[group.Name] = true
+	}
+
+	var users, groups []string
+	m.mu.Lock()
+	for name, role := range m.roles {
+		switch {
+		case declared[name]:
+		case role.Managed == database.ManagedKindUser:
+			users = append(users, name)
+		case role.Managed == database.ManagedKindGroup:
+			groups = append(groups, name)
+		}
+	}
+	m.mu.Unlock()
+	sort.Strings(users)
+	sort.Strings(groups)
+
+	for _, user := range users {
+		if action == database.PruneDisable {
+			if changed, _ := m.DisableUser(user); changed {
+				result.UsersDisabled = append(result.UsersDisabled, user)
+			}
+			continue
+		}
+		if err := m.DropUser(user); err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("failed to prune user %s: %w", user, err))
+			continue
+		}
+		result.UsersRemoved = append(result.UsersRemoved, user)
+	}
+
+	for _, group := range groups {
+		if action != database.PruneDrop {
+			result.Warn(group, "managed group is no longer in the configuration, left in place (use --prune-action drop to remove it)")
+			continue
+		}
+		if err := m.DropGroup(group); err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("failed to prune group %s: %w", group, err))
+			continue
+		}
+		result.GroupsRemoved = append(result.GroupsRemoved, group)
+	}
+}
+
+// checkManagedKind refuses to apply a role as a user when it is managed as a group, and the
+// other way around
+func (m *Manager) checkManagedKind(name, kind string) error {
+	existing, _ := m.ManagedKind(name)
+	if existing != "" && existing != kind {
+		return fmt.Errorf("role %s is managed as a %s but declared as a %s; users and groups share one role namespace, "+
+			"so rename one of them or drop the existing role first", name, existing, kind)
+	}
+	return nil
+}
+
+// alterRole brings the attributes of a role in line with its configuration and marks it as
+// managed. It reports whether an attribute changed.
+func (m *Manager) alterRole(name, kind string, canLogin, inherit bool, limit int) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	role := m.roles[name]
+	role.Managed = kind
+
+	var clauses []string
+	if role.CanLogin != canLogin {
+		login := "NOLOGIN"
+		if canLogin {
+			login = "LOGIN"
+		}
+		role.CanLogin = canLogin
+		clauses = append(clauses, login)
+	}
+	if role.Inherit != inherit {
+		inheritance := "NOINHERIT"
+		if inherit {
+			inheritance = "INHERIT"
+		}
+		role.Inherit = inherit
+		clauses = append(clauses, inheritance)
+	}
+	if role.ConnectionLimit != limit {
+		role.ConnectionLimit = limit
+		clauses = append(clauses, fmt.Sprintf("CONNECTION LIMIT %d", limit))
+	}
+	if len(clauses) == 0 {
+		return false
+	}
+	m.record("ALTER ROLE %s %s", quote(name), strings.Join(clauses, " "))
+	return true
+}
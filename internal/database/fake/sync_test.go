@@ -0,0 +1,196 @@
+package fake_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/database"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/database/fake"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+func syncConfig() *structs.Config {
+	return &structs.Config{
+		Groups: []structs.GroupConfig{
+			{Name: "readers", Inherit: true, Privileges: []string{"CONNECT"}, Databases: []string{"app"}},
+			{Name: "writers", Inherit: true, MemberOf: []string{"readers"}},
+		},
+		Users: []structs.UserConfig{
+			{Username: "alice", Groups: []string{"writers"}, Enabled: true, CanLogin: true, ConnectionLimit: 5},
+			{Username: "bob", Groups: []string{"readers"}, Privileges: []string{"TEMP"}, Databases: []string{"app"}, Enabled: true, CanLogin: true},
+		},
+	}
+}
+
+func TestSyncConfiguration(t *testing.T) {
+	manager := fake.NewManager(fake.Role{Name: "readers", Inherit: false, ConnectionLimit: -1})
+
+	result, err := manager.SyncConfiguration(syncConfig())
+	if err != nil || len(result.Errors) > 0 {
+		t.Fatalf("Sync failed: %v %v", err, result.Errors)
+	}
+
+	if !slices.Equal(result.UsersCreated, []string{"alice", "bob"}) || !slices.Equal(result.GroupsCreated, []string{"readers", "writers"}) {
+		t.Errorf("Expected every declared role to be applied, got users %v and groups %v", result.UsersCreated, result.GroupsCreated)
+	}
+	if !slices.Equal(result.GroupsModified, []string{"readers"}) {
+		t.Errorf("Expected the existing group to be altered to INHERIT, got %v", result.GroupsModified)
+	}
+	if kind, _ := manager.ManagedKind("readers"); kind != database.ManagedKindGroup {
+		t.Errorf("Expected the existing group to be marked as managed, got %q", kind)
+	}
+	if groups, _ := manager.GetRoleMemberships("writers"); !slices.Equal(groups, []string{"readers"}) {
+		t.Errorf("Expected writers in readers, got %v", groups)
+	}
+	if groups, _ := manager.GetRoleMemberships("alice"); !slices.Equal(groups, []string{"writers"}) {
+		t.Errorf("Expected alice in writers, got %v", groups)
+	}
+	if role := manager.Role("alice"); role.ConnectionLimit != 5 {
+		t.Errorf("Expected the connection limit of alice to be 5, got %d", role.ConnectionLimit)
+	}
+	if grants, _ := manager.GetDatabasePrivileges("bob"); len(grants) != 1 || grants[0].Privilege != "TEMPORARY" {
+		t.Errorf("Expected TEMPORARY on app for bob, got %v", grants)
+	}
+	if result.StatementsExecuted != len(manager.Statements()) {
+		t.Errorf("Expected %d statements, got %d", len(manager.Statements()), result.StatementsExecuted)
+	}
+
+	// A second sync finds nothing to change
+	result, err = manager.SyncConfiguration(syncConfig())
+	if err != nil || len(result.Errors) > 0 || result.StatementsExecuted != 0 {
+		t.Errorf("Expected a second sync to change nothing, got %d statements: %v %v", result.StatementsExecuted, err, result.Errors)
+	}
+}
+
+func TestSyncConfigurationExactMembershipsAndPrivileges(t *testing.T) {
+	manager := fake.NewManager()
+	if _, err := manager.SyncConfiguration(syncConfig()); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	config := syncConfig()
+	config.Users[1].Groups = nil
+	config.Users[1].Privileges = nil
+
+	result, err := manager.SyncConfiguration(config)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if len(result.MembershipsExtra) != 1 || len(result.PrivilegesExtra) != 1 || len(result.Warnings) != 2 {
+		t.Errorf("Expected the extra membership and privilege to be reported, got %v and %v", result.MembershipsExtra, result.PrivilegesExtra)
+	}
+	if groups, _ := manager.GetRoleMemberships("bob"); !slices.Equal(groups, []string{"readers"}) {
+		t.Errorf("Expected the membership to be left in place, got %v", groups)
+	}
+
+	manager.SetExactMemberships(true)
+	manager.SetExactPrivileges(true)
+	result, err = manager.SyncConfiguration(config)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	expected := structs.Membership{Member: "bob", Group: "readers"}
+	if !slices.Equal(result.MembershipsRevoked, []structs.Membership{expected}) || len(result.PrivilegesRevoked) != 1 {
+		t.Errorf("Expected the extra membership and privilege to be revoked, got %v and %v", result.MembershipsRevoked, result.PrivilegesRevoked)
+	}
+	if groups, _ := manager.GetRoleMemberships("bob"); len(groups) != 0 {
+		t.Errorf("Expected bob to be in no group, got %v", groups)
+	}
+	if grants, _ := manager.GetDatabasePrivileges("bob"); len(grants) != 0 {
+		t.Errorf("Expected bob to hold no privileges, got %v", grants)
+	}
+}
+
+func TestSyncConfigurationAbsentAndDisabledUsers(t *testing.T) {
+	manager := fake.NewManager()
+	if _, err := manager.SyncConfiguration(syncConfig()); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	config := syncConfig()
+	config.Users[0].Enabled = false
+	config.Users[1].Absent = true
+	config.Users[1].DeletionProtection = true
+	config.Users = append(config.Users, structs.UserConfig{Username: "carol"})
+
+	result, err := manager.SyncConfiguration(config)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if !slices.Equal(result.UsersDisabled, []string{"alice"}) || manager.Role("alice").CanLogin {
+		t.Errorf("Expected alice to be locked, got %v", result.UsersDisabled)
+	}
+	if len(result.Errors) != 1 || !errors.Is(result.Errors[0], database.ErrDeletionProtected) || manager.Role("bob") == nil {
+		t.Errorf("Expected the protected absent user to be kept, got %v", result.Errors)
+	}
+	if manager.Role("carol") != nil || len(result.Warnings) != 1 {
+		t.Errorf("Expected the missing disabled user to be warned about and not created, got %v", result.Warnings)
+	}
+
+	manager.SetOverrideProtection(true)
+	result, err = manager.SyncConfiguration(config)
+	if err != nil || len(result.Errors) > 0 {
+		t.Fatalf("Sync failed: %v %v", err, result.Errors)
+	}
+	if !slices.Equal(result.UsersRemoved, []string{"bob"}) || manager.Role("bob") != nil {
+		t.Errorf("Expected bob to be dropped with protection overridden, got %v", result.UsersRemoved)
+	}
+}
+
+func TestSyncConfigurationRefusesRoleOfOtherKind(t *testing.T) {
+	manager := fake.NewManager(fake.Role{Name: "readers", CanLogin: true, Managed: database.ManagedKindUser})
+
+	result, err := manager.SyncConfiguration(syncConfig())
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if len(result.Errors) == 0 || slices.Contains(result.GroupsCreated, "readers") {
+		t.Errorf("Expected the group managed as a user to be refused, got %v", result.Errors)
+	}
+}
+
+func TestSyncConfigurationPrune(t *testing.T) {
+	manager := fake.NewManager(fake.Role{Name: "app_owner", CanLogin: true})
+	if _, err := manager.SyncConfiguration(syncConfig()); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	if err := manager.SetPrune("archive"); err == nil {
+		t.Error("Expected an invalid prune action to be rejected")
+	}
+	if err := manager.SetPrune(database.PruneDisable); err != nil {
+		t.Fatalf("Failed to set prune action: %v", err)
+	}
+	if _, err := manager.SyncConfiguration(&structs.Config{}); err == nil {
+		t.Error("Expected pruning with an empty configuration to be refused")
+	}
+
+	config := syncConfig()
+	config.Users = config.Users[:1]
+	config.Groups[0].MemberOf = nil
+	config.Groups = config.Groups[:1]
+	config.Users[0].Groups = nil
+
+	result, err := manager.SyncConfiguration(config)
+	if err != nil || len(result.Errors) > 0 {
+		t.Fatalf("Sync failed: %v %v", err, result.Errors)
+	}
+	if !slices.Equal(result.UsersDisabled, []string{"bob"}) || manager.Role("writers") == nil || len(result.Warnings) != 1 {
+		t.Errorf("Expected bob to be disabled and writers kept, got %v and %v", result.UsersDisabled, result.Warnings)
+	}
+
+	if err := manager.SetPrune(database.PruneDrop); err != nil {
+		t.Fatalf("Failed to set prune action: %v", err)
+	}
+	result, err = manager.SyncConfiguration(config)
+	if err != nil || len(result.Errors) > 0 {
+		t.Fatalf("Sync failed: %v %v", err, result.Errors)
+	}
+	if !slices.Equal(result.UsersRemoved, []string{"bob"}) || !slices.Equal(result.GroupsRemoved, []string{"writers"}) {
+		t.Errorf("Expected bob and writers to be dropped, got %v and %v", result.UsersRemoved, result.GroupsRemoved)
+	}
+	if manager.Role("app_owner") == nil {
+		t.Error("Expected the unmanaged role to be kept")
+	}
+}
@@ -0,0 +1,132 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// validTablePrivileges lists the privileges that can be granted on a table
+var validTablePrivileges = map[string]bool{
+	"SELECT":         true,
+	"INSERT":         true,
+	"UPDATE":         true,
+	"DELETE":         true,
+	"TRUNCATE":       true,
+	"REFERENCES":     true,
+	"TRIGGER":        true,
+	"ALL":            true,
+	"ALL PRIVILEGES": true,
+}
+
+// allTablesSuffix selects every table of a schema, as in reporting.*
+const allTablesSuffix = ".*"
+
+// normalizePrivileges upper-cases privileges and rejects any that cannot be granted on the
+// kind of object, so nothing but a known keyword ends up in a statement
+func normalizePrivileges(privileges []string, valid map[string]bool, kind, allowed string) ([]string, error) {
+	if len(privileges) == 0 {
+		return nil, fmt.Errorf("no privileges given")
+	}
+	normalized := make([]string, len(privileges))
+	for i, priv := range privileges {
+		normalized[i] = strings.ToUpper(strings.Join(strings.Fields(priv), " "))
+		if !valid[normalized[i]] {
+			return nil, fmt.Errorf("invalid %s privilege %s (must be %s)", kind, priv, allowed)
+		}
+	}
+	return normalized, nil
+}
+
+// CheckDatabasePrivileges reports privileges that cannot be granted on a database
+func CheckDatabasePrivileges(privileges []string) error {
+	valid := make(map[string]bool, len(databasePrivilegeAliases))
+	for priv := range databasePrivilegeAliases {
+		valid[priv] = true
+	}
+	_, err := normalizePrivileges(privileges, valid, "database", "CONNECT, CREATE, TEMPORARY or ALL")
+	return err
+}
+
+// GrantSchemaPrivileges grants privileges on schemas of the connected database
+func (m *Manager) GrantSchemaPrivileges(target string, privileges, schemas []string) error {
+	return m.schemaPrivileges(true, target, privileges, schemas)
+}
+
+// RevokeSchemaPrivileges revokes privileges on schemas of the connected database
+func (m *Manager) RevokeSchemaPrivileges(target string, privileges, schemas []string) error {
+	return m.schemaPrivileges(false, target, privileges, schemas)
+}
+
+// schemaPrivileges grants or revokes privileges on schemas
+func (m *Manager) schemaPrivileges(grant bool, target string, privileges, schemas []string) error {
+	privileges, err := normalizePrivileges(privileges, validSchemaPrivileges, "schema", "USAGE, CREATE or ALL")
+	if err != nil {
+		return err
+	}
+
+	objects := make([]string, len(schemas))
+	for i, schema := range schemas {
+		objects[i] = "SCHEMA " + m.quoteIdentifier(schema)
+	}
+	return m.objectPrivileges(grant, target, privileges, schemas, objects)
+}
+
+// GrantTablePrivileges grants privileges on tables of the connected database. Tables are
+// given as schema.table, or as a table name in the public schema; schema.* grants on every
+// table currently in the schema.
+func (m *Manager) GrantTablePrivileges(target string, privileges, tables []string) error {
+	return m.tablePrivileges(true, target, privileges, tables)
+}
+
+// RevokeTablePrivileges revokes privileges on tables of the connected database, named as
+// for GrantTablePrivileges
+func (m *Manager) RevokeTablePrivileges(target string, privileges, tables []string) error {
+	return m.tablePrivileges(false, target, privileges, tables)
+}
+
+// tablePrivileges grants or revokes privileges on tables
+func (m *Manager) tablePrivileges(grant bool, target string, privileges, tables []string) error {
+	privileges, err := normalizePrivileges(privileges, validTablePrivileges, "table",
+		"SELECT, INSERT, UPDATE, DELETE, TRUNCATE, REFERENCES, TRIGGER or ALL")
+	if err != nil {
+		return err
+	}
+
+	objects := make([]string, len(tables))
+	for i, table := range tables {
+		if schema, ok := strings.CutSuffix(table, allTablesSuffix); ok {
+			objects[i] = "ALL TABLES IN SCHEMA " + m.quoteIdentifier(schema)
+			continue
+		}
+		schema, name := splitQualifiedName(table)
+		objects[i] = "TABLE " + m.quoteIdentifier(schema) + "." + m.quoteIdentifier(name)
+	}
+	return m.objectPrivileges(grant, target, privileges, tables, objects)
+}
+
+// objectPrivileges runs one GRANT or REVOKE statement per object, stopping at the first
+// that fails
+func (m *Manager) objectPrivileges(grant bool, target string, privileges, names, objects []string) error {
+	action, verb, preposition, done := "Granting", "GRANT", "TO", "granted"
+	if !grant {
+		action, verb, preposition, done = "Revoking", "REVOKE", "FROM", "revoked"
+	}
+	m.logger.WithFields(logrus.Fields{
+		"target":     target,
+		"privileges": privileges,
+		"objects":    names,
+	}).Info(action + " privileges")
+
+	list := privilegeList(privileges)
+	for i, object := range objects {
+		query := fmt.Sprintf("%s %s ON %s %s %s", verb, list, object, preposition, m.quoteIdentifier(target))
+		if err := m.execute(query); err != nil {
+			return fmt.Errorf("failed to %s %s on %s for %s: %w", strings.ToLower(verb), list, names[i], target, err)
+		}
+	}
+
+	m.logger.WithField("target", target).Info("Privileges " + done + " successfully")
+	return nil
+}
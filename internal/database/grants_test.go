@@ -0,0 +1,128 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+func TestObjectPrivilegeStatements(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	m := &Manager{logger: logger, ctx: context.Background(), dryRun: true, statements: []structs.PlannedStatement{}}
+
+	if err := m.GrantSchemaPrivileges("reporting", []string{"usage"}, []string{"sales"}); err != nil {
+		t.Fatalf("Failed to grant schema privileges: %v", err)
+	}
+	if err := m.GrantTablePrivileges("reporting", []string{"select", "insert"}, []string{"sales.*", "orders", `odd"schema.t`}); err != nil {
+		t.Fatalf("Failed to grant table privileges: %v", err)
+	}
+	if err := m.RevokeTablePrivileges("reporting", []string{"all  privileges"}, []string{"sales.invoices"}); err != nil {
+		t.Fatalf("Failed to revoke table privileges: %v", err)
+	}
+
+	expected := []string{
+		`GRANT USAGE ON SCHEMA "sales" TO "reporting"`,
+		`GRANT SELECT, INSERT ON ALL TABLES IN SCHEMA "sales" TO "reporting"`,
+		`GRANT SELECT, INSERT ON TABLE "public"."orders" TO "reporting"`,
+		`GRANT SELECT, INSERT ON TABLE "odd""schema"."t" TO "reporting"`,
+		`REVOKE ALL PRIVILEGES ON TABLE "sales"."invoices" FROM "reporting"`,
+	}
+	if len(m.statements) != len(expected) {
+		t.Fatalf("Expected %d statements, got %v", len(expected), m.statements)
+	}
+	for i, statement := range m.statements {
+		if statement.Query != expected[i] {
+			t.Errorf("Statement %d: expected %s, got %s", i, expected[i], statement.Query)
+		}
+	}
+}
+
+func TestObjectPrivilegesCollapseAll(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	m := &Manager{logger: logger, ctx: context.Background(), dryRun: true, statements: []structs.PlannedStatement{}}
+
+	// ALL already includes the other privileges and PostgreSQL rejects a list combining them
+	if err := m.GrantTablePrivileges("reporting", []string{"select", "all"}, []string{"orders"}); err != nil {
+		t.Fatalf("Failed to grant table privileges: %v", err)
+	}
+	if err := m.RevokeSchemaPrivileges("reporting", []string{"USAGE", "all"}, []string{"sales"}); err != nil {
+		t.Fatalf("Failed to revoke schema privileges: %v", err)
+	}
+
+	expected := []string{
+		`GRANT ALL ON TABLE "public"."orders" TO "reporting"`,
+		`REVOKE ALL ON SCHEMA "sales" FROM "reporting"`,
+	}
+	if len(m.statements) != len(expected) {
+		t.Fatalf("Expected %d statements, got %v", len(expected), m.statements)
+	}
+	for i, statement := range m.statements {
+		if statement.Query != expected[i] {
+			t.Errorf("Statement %d: expected %s, got %s", i, expected[i], statement.Query)
+		}
+	}
+}
+
+func TestObjectPrivilegesRejectUnknownPrivileges(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	m := &Manager{logger: logger, ctx: context.Background(), dryRun: true, statements: []structs.PlannedStatement{}}
+
+	if err := m.GrantSchemaPrivileges("reporting", []string{"SELECT"}, []string{"sales"}); err == nil {
+		t.Error("Expected SELECT to be rejected on a schema")
+	}
+	if err := m.GrantTablePrivileges("reporting", []string{"SELECT; DROP TABLE orders"}, []string{"orders"}); err == nil {
+		t.Error("Expected a statement in the privileges to be rejected")
+	}
+	if err := m.GrantTablePrivileges("reporting", nil, []string{"orders"}); err == nil {
+		t.Error("Expected a grant without privileges to be rejected")
+	}
+	if len(m.statements) != 0 {
+		t.Errorf("Expected no statements for rejected privileges, got %v", m.statements)
+	}
+
+	if err := CheckDatabasePrivileges([]string{"connect", "TEMP"}); err != nil {
+		t.Errorf("Expected database privileges to be accepted, got %v", err)
+	}
+	if err := CheckDatabasePrivileges([]string{"USAGE"}); err == nil {
+		t.Error("Expected USAGE to be rejected on a database")
+	}
+}
+
+func TestGrantAndRevokeTablePrivileges(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	if _, err := setup.Manager.db.Exec(`CREATE SCHEMA test_grants; CREATE TABLE test_grants.invoices (id int)`); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	defer setup.Manager.db.Exec(`DROP SCHEMA test_grants CASCADE`)
+	if err := setup.Manager.CreateGroup(&structs.GroupConfig{Name: "test_grants_reader"}); err != nil {
+		t.Fatalf("Failed to create group: %v", err)
+	}
+
+	if err := setup.Manager.GrantSchemaPrivileges("test_grants_reader", []string{"USAGE"}, []string{"test_grants"}); err != nil {
+		t.Fatalf("Failed to grant schema privileges: %v", err)
+	}
+	if err := setup.Manager.GrantTablePrivileges("test_grants_reader", []string{"SELECT"}, []string{"test_grants.*"}); err != nil {
+		t.Fatalf("Failed to grant table privileges: %v", err)
+	}
+
+	var canSelect bool
+	query := `SELECT has_table_privilege('test_grants_reader', 'test_grants.invoices', 'SELECT')`
+	if err := setup.Manager.db.QueryRow(query).Scan(&canSelect); err != nil || !canSelect {
+		t.Fatalf("Expected SELECT on the table to be granted (err=%v)", err)
+	}
+
+	if err := setup.Manager.RevokeTablePrivileges("test_grants_reader", []string{"SELECT"}, []string{"test_grants.invoices"}); err != nil {
+		t.Fatalf("Failed to revoke table privileges: %v", err)
+	}
+	if err := setup.Manager.db.QueryRow(query).Scan(&canSelect); err != nil || canSelect {
+		t.Errorf("Expected SELECT on the table to be revoked (err=%v)", err)
+	}
+}
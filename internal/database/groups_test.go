@@ -7,7 +7,7 @@ import (
 )
 
 func TestGroupExists(t *testing.T) {
-	setup := SetupFlexibleTestDatabase(t)
+	setup := SetupTestDatabase(t)
 	defer setup.Cleanup(t)
 	defer setup.ResetDatabase(t)
 
@@ -42,7 +42,7 @@ func TestGroupExists(t *testing.T) {
 }
 
 func TestCreateGroup(t *testing.T) {
-	setup := SetupFlexibleTestDatabase(t)
+	setup := SetupTestDatabase(t)
 	defer setup.Cleanup(t)
 	defer setup.ResetDatabase(t)
 
@@ -94,7 +94,7 @@ func TestCreateGroup(t *testing.T) {
 }
 
 func TestCreateGroupDuplicate(t *testing.T) {
-	setup := SetupFlexibleTestDatabase(t)
+	setup := SetupTestDatabase(t)
 	defer setup.Cleanup(t)
 	defer setup.ResetDatabase(t)
 
@@ -117,7 +117,7 @@ func TestCreateGroupDuplicate(t *testing.T) {
 }
 
 func TestAddUserToGroup(t *testing.T) {
-	setup := SetupFlexibleTestDatabase(t)
+	setup := SetupTestDatabase(t)
 	defer setup.Cleanup(t)
 	defer setup.ResetDatabase(t)
 
@@ -172,7 +172,7 @@ func TestAddUserToGroup(t *testing.T) {
 }
 
 func TestRemoveUserFromGroup(t *testing.T) {
-	setup := SetupFlexibleTestDatabase(t)
+	setup := SetupTestDatabase(t)
 	defer setup.Cleanup(t)
 	defer setup.ResetDatabase(t)
 
@@ -227,7 +227,7 @@ func TestRemoveUserFromGroup(t *testing.T) {
 }
 
 func TestGetUserInfo(t *testing.T) {
-	setup := SetupFlexibleTestDatabase(t)
+	setup := SetupTestDatabase(t)
 	defer setup.Cleanup(t)
 	defer setup.ResetDatabase(t)
 
@@ -272,3 +272,80 @@ func TestGetUserInfo(t *testing.T) {
 		t.Fatal("Expected groups slice to be initialized")
 	}
 }
+
+func TestSyncAltersGroupInherit(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	config := &structs.Config{
+		Groups: []structs.GroupConfig{{Name: "test_group", Inherit: true}},
+	}
+	if _, err := setup.Manager.SyncConfiguration(config); err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+
+	config.Groups[0].Inherit = false
+	result, err := setup.Manager.SyncConfiguration(config)
+	if err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+	if len(result.GroupsModified) != 1 || result.GroupsModified[0] != "test_group" {
+		t.Errorf("Expected test_group to be modified, got %v", result.GroupsModified)
+	}
+
+	attributes, err := setup.Manager.GetRoleAttributes("test_group")
+	if err != nil || attributes == nil {
+		t.Fatalf("Failed to get group attributes: %v", err)
+	}
+	if attributes.Inherit {
+		t.Error("Expected test_group to be altered to NOINHERIT")
+	}
+
+	// A second sync has nothing left to change
+	result, err = setup.Manager.SyncConfiguration(config)
+	if err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+	if len(result.GroupsModified) != 0 {
+		t.Errorf("Expected no group changes, got %v", result.GroupsModified)
+	}
+}
+
+func TestDropGroup(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	if err := setup.Manager.CreateGroup(&structs.GroupConfig{Name: "test_group", Inherit: true}); err != nil {
+		t.Fatalf("Failed to create group: %v", err)
+	}
+	if _, err := setup.Manager.db.Exec(`CREATE TABLE group_table (id int); ALTER TABLE group_table OWNER TO "test_group"`); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	defer setup.Manager.db.Exec("DROP TABLE IF EXISTS group_table")
+
+	if err := setup.Manager.DropGroup("test_group"); Classify(err).Kind != ErrorKindDependentObjects {
+		t.Fatalf("Expected a dependent objects error, got %v", err)
+	}
+
+	setup.Manager.SetCascade(true)
+	defer setup.Manager.SetCascade(false)
+	if err := setup.Manager.DropGroup("test_group"); err != nil {
+		t.Fatalf("Failed to drop group with cascade: %v", err)
+	}
+
+	exists, err := setup.Manager.GroupExists("test_group")
+	if err != nil || exists {
+		t.Errorf("Expected test_group to be dropped, got exists=%t err=%v", exists, err)
+	}
+	var tables int
+	if err := setup.Manager.db.QueryRow("SELECT count(*) FROM pg_tables WHERE tablename = 'group_table'").Scan(&tables); err != nil || tables != 0 {
+		t.Errorf("Expected the owned table to be dropped, got %d (%v)", tables, err)
+	}
+
+	// Dropping a missing group is not an error
+	if err := setup.Manager.DropGroup("test_group"); err != nil {
+		t.Errorf("Expected no error for a missing group, got %v", err)
+	}
+}
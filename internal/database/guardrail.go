@@ -0,0 +1,121 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+// LargeChangeError reports a sync that would remove more access than the change limits allow
+type LargeChangeError struct {
+	Removals     int // Roles, memberships and privileges the sync would remove
+	RoleRemovals int // Roles the sync would drop, disable or prune
+	ManagedRoles int
+	Limits       structs.ChangeLimitsConfig
+	Examples     []string // A few of the removals, for the error message
+}
+
+// Error implements the error interface
+func (e *LargeChangeError) Error() string {
+	var exceeded []string
+	if e.Limits.MaxRemovals > 0 && e.Removals > e.Limits.MaxRemovals {
+		exceeded = append(exceeded, fmt.Sprintf("%d removals exceed max_removals %d", e.Removals, e.Limits.MaxRemovals))
+	}
+	if percent := e.RolePercent(); e.Limits.MaxRemovalPercent > 0 && percent > e.Limits.MaxRemovalPercent {
+		exceeded = append(exceeded, fmt.Sprintf("removing %d of %d managed roles (%.0f%%) exceeds max_removal_percent %g",
+			e.RoleRemovals, e.ManagedRoles, percent, e.Limits.MaxRemovalPercent))
+	}
+	return fmt.Sprintf("refusing a large change: %s; check the configuration is complete, e.g. with plan, and pass --allow-large-change if it is intended (%s)",
+		strings.Join(exceeded, " and "), strings.Join(e.Examples, ", "))
+}
+
+// RolePercent returns the roles to remove as a percentage of the managed roles
+func (e *LargeChangeError) RolePercent() float64 {
+	if e.ManagedRoles == 0 {
+		return 0
+	}
+	return float64(e.RoleRemovals) * 100 / float64(e.ManagedRoles)
+}
+
+// largeChangeExamples is how many removals a LargeChangeError names
+const largeChangeExamples = 5
+
+// SetChangeLimits sets how much access a sync may remove before it refuses to run
+func (m *Manager) SetChangeLimits(limits structs.ChangeLimitsConfig) {
+	m.changeLimits = limits
+}
+
+// SetAllowLargeChange lets a sync exceed the change limits
+func (m *Manager) SetAllowLargeChange(allow bool) {
+	m.allowLargeChange = allow
+}
+
+// CheckChangeLimits compares the removals a sync of the configuration would make with the
+// change limits: users dropped as absent, disabled or pruned, and the memberships and
+// privileges revoked with exact memberships and privileges. Exceeding a limit is reported
+// as a *LargeChangeError.
+func (m *Manager) CheckChangeLimits(config *structs.Config) error {
+	limits := m.changeLimits
+	if limits.MaxRemovals <= 0 && limits.MaxRemovalPercent <= 0 {
+		return nil
+	}
+
+	report, err := m.Diff(config)
+	if err != nil {
+		return fmt.Errorf("failed to compare the cluster with the configuration: %w", err)
+	}
+
+	var roles []string
+	roles = append(roles, report.UsersToRemove...)
+	roles = append(roles, report.UsersToDisable...)
+	roles = append(roles, report.RolesToPrune...)
+
+	removals := append([]string{}, roles...)
+	if m.exactMemberships {
+		for _, membership := range report.MembershipsExtra {
+			removals = append(removals, membership.Member+" from "+membership.Group)
+		}
+	}
+	if m.exactPrivileges {
+		for _, grant := range report.PrivilegesExtra {
+			removals = append(removals, grant.Privilege+" on "+grant.Database+" from "+grant.Target)
+		}
+	}
+
+	users, groups, err := m.ManagedRoles()
+	if err != nil {
+		return err
+	}
+	return m.checkRemovals(removals, len(roles), len(users)+len(groups))
+}
+
+// checkRemovals compares removals, of which roleRemovals remove roles, with the change
+// limits, reporting a *LargeChangeError when they exceed them
+func (m *Manager) checkRemovals(removals []string, roleRemovals, managedRoles int) error {
+	limits := m.changeLimits
+	check := &LargeChangeError{
+		Removals:     len(removals),
+		RoleRemovals: roleRemovals,
+		ManagedRoles: managedRoles,
+		Limits:       limits,
+	}
+	m.logger.WithFields(logrus.Fields{
+		"removals":      check.Removals,
+		"role_removals": check.RoleRemovals,
+		"managed_roles": check.ManagedRoles,
+	}).Debug("Checked change limits")
+
+	exceedsCount := limits.MaxRemovals > 0 && check.Removals > limits.MaxRemovals
+	exceedsPercent := limits.MaxRemovalPercent > 0 && check.RolePercent() > limits.MaxRemovalPercent
+	if !exceedsCount && !exceedsPercent {
+		return nil
+	}
+
+	check.Examples = removals
+	if len(removals) > largeChangeExamples {
+		check.Examples = append(removals[:largeChangeExamples:largeChangeExamples], fmt.Sprintf("and %d more", len(removals)-largeChangeExamples))
+	}
+	return check
+}
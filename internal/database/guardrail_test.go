@@ -0,0 +1,88 @@
+package database
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+func TestLargeChangeErrorMessage(t *testing.T) {
+	err := &LargeChangeError{
+		Removals:     12,
+		RoleRemovals: 3,
+		ManagedRoles: 4,
+		Limits:       structs.ChangeLimitsConfig{MaxRemovals: 10, MaxRemovalPercent: 50},
+		Examples:     []string{"app_user", "and 11 more"},
+	}
+
+	message := err.Error()
+	for _, expected := range []string{
+		"12 removals exceed max_removals 10",
+		"removing 3 of 4 managed roles (75%) exceeds max_removal_percent 50",
+		"--allow-large-change",
+		"app_user, and 11 more",
+	} {
+		if !strings.Contains(message, expected) {
+			t.Errorf("Expected %q in %q", expected, message)
+		}
+	}
+
+	err.Removals = 5
+	if message := err.Error(); strings.Contains(message, "max_removals") {
+		t.Errorf("Expected only the exceeded limit in %q", message)
+	}
+}
+
+func TestSyncChangeLimits(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	config := &structs.Config{
+		Users: []structs.UserConfig{
+			{Username: "test_user", Password: "test_pass", Enabled: true, CanLogin: true},
+			{Username: "test_user_2", Password: "test_pass", Enabled: true, CanLogin: true},
+			{Username: "test_user_3", Password: "test_pass", Enabled: true, CanLogin: true},
+		},
+	}
+	if _, err := setup.Manager.SyncConfiguration(config); err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+
+	if err := setup.Manager.SetPrune(PruneDrop); err != nil {
+		t.Fatalf("Failed to set prune action: %v", err)
+	}
+	defer setup.Manager.SetPrune("")
+	setup.Manager.SetChangeLimits(structs.ChangeLimitsConfig{MaxRemovalPercent: 40})
+	defer setup.Manager.SetChangeLimits(structs.ChangeLimitsConfig{})
+
+	// A configuration cut down to one user would prune two of three managed users
+	truncated := &structs.Config{Users: config.Users[:1]}
+	_, err := setup.Manager.SyncConfiguration(truncated)
+	var largeChange *LargeChangeError
+	if !errors.As(err, &largeChange) || largeChange.RoleRemovals != 2 || largeChange.ManagedRoles != 3 {
+		t.Fatalf("Expected the sync to be refused, got %v", err)
+	}
+	if exists, _ := setup.Manager.UserExists("test_user_2"); !exists {
+		t.Fatal("Expected nothing to be pruned when the sync is refused")
+	}
+
+	// Removing one of three stays within the limit, but one of the two left would not
+	if _, err := setup.Manager.SyncConfiguration(&structs.Config{Users: config.Users[:2]}); err != nil {
+		t.Fatalf("Expected a small change to sync, got %v", err)
+	}
+	if _, err := setup.Manager.SyncConfiguration(truncated); !errors.As(err, &largeChange) {
+		t.Fatalf("Expected the sync to be refused, got %v", err)
+	}
+
+	setup.Manager.SetAllowLargeChange(true)
+	defer setup.Manager.SetAllowLargeChange(false)
+	if _, err := setup.Manager.SyncConfiguration(truncated); err != nil {
+		t.Fatalf("Expected --allow-large-change to sync, got %v", err)
+	}
+	if exists, _ := setup.Manager.UserExists("test_user_2"); exists {
+		t.Error("Expected test_user_2 to be pruned once the large change is allowed")
+	}
+}
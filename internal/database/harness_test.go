@@ -0,0 +1,646 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+const (
+	dockerSocketName    = "docker.sock"
+	defaultDockerSocket = "/var/run/docker.sock"
+)
+
+// TestDatabaseMode selects where the PostgreSQL server of a test comes from
+type TestDatabaseMode string
+
+const (
+	// TestDatabaseContainer starts a PostgreSQL container for each test
+	TestDatabaseContainer TestDatabaseMode = "container"
+	// TestDatabaseShared starts one PostgreSQL container for all tests and gives each test its own database
+	TestDatabaseShared TestDatabaseMode = "shared"
+	// TestDatabaseLocal connects to a running PostgreSQL server described by the POSTGRES_* variables
+	TestDatabaseLocal TestDatabaseMode = "local"
+)
+
+// TestDatabaseModeEnv is the environment variable that selects the mode of tests that do not set one
+const TestDatabaseModeEnv = "TEST_DATABASE_MODE"
+
+// TestDatabaseDriverEnv is the environment variable that selects the driver of tests that do
+// not set one: pq (default) or pgx
+const TestDatabaseDriverEnv = "TEST_DATABASE_DRIVER"
+
+// Test users and roles dropped when a test database is reset
+var (
+	testUsers = []string{
+		"test_user", "test_user_2", "iam_user", "nologin_user", "limited_user",
+		"invalid_user", "quoted_user", "password_user", "unlimited_user",
+		"zero_user", "positive_user", "group_user", "priv_user",
+	}
+	testRoles = []string{
+		"test_group", "test_role", "app_group", "read_only",
+		"admin_group", "user_group", "temp_group",
+	}
+)
+
+// DatabaseTestSetup is a common interface for all test database setups
+type DatabaseTestSetup interface {
+	GetManager() *Manager
+	Cleanup(testing.TB)
+	ResetDatabase(testing.TB)
+}
+
+// TestDatabaseOptions configures SetupTestDatabaseWithOptions
+type TestDatabaseOptions struct {
+	Mode   TestDatabaseMode // Where the server comes from (default: TEST_DATABASE_MODE, then container)
+	Driver string           // Driver the manager connects with (default: TEST_DATABASE_DRIVER, then pq)
+}
+
+// TestDatabaseSetup is a PostgreSQL database for a test with a manager connected to it
+type TestDatabaseSetup struct {
+	Container testcontainers.Container // Container started for the test, nil in shared and local mode
+	Manager   *Manager
+	ConnInfo  *structs.DatabaseConnection
+	Logger    *logrus.Logger
+	Mode      TestDatabaseMode
+	dbName    string // Database created for the test in shared mode
+}
+
+// sharedTestContainer is the container of shared mode, terminated when its last test cleans up
+type sharedTestContainer struct {
+	Container testcontainers.Container
+	ConnInfo  *structs.DatabaseConnection
+	refCount  int
+}
+
+var (
+	sharedContainer *sharedTestContainer
+	containerMutex  sync.Mutex
+)
+
+// SetupTestDatabase creates a PostgreSQL test database in the mode selected by TEST_DATABASE_MODE
+func SetupTestDatabase(t testing.TB) *TestDatabaseSetup {
+	return SetupTestDatabaseWithOptions(t, TestDatabaseOptions{})
+}
+
+// SetupTestDatabaseWithOptions creates a PostgreSQL test database as configured by the options
+func SetupTestDatabaseWithOptions(t testing.TB, options TestDatabaseOptions) *TestDatabaseSetup {
+	mode, err := testDatabaseMode(options.Mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver, err := testDatabaseDriver(options.Driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create logger with reduced verbosity for tests
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+
+	setup := &TestDatabaseSetup{Logger: logger, Mode: mode}
+	switch mode {
+	case TestDatabaseContainer:
+		container, connInfo, err := startPostgresContainer(t, "testdb")
+		if err != nil {
+			t.Fatalf("Failed to start PostgreSQL container: %v", err)
+		}
+		setup.Container = container
+		setup.ConnInfo = connInfo
+
+	case TestDatabaseShared:
+		connInfo, err := acquireSharedContainer(t)
+		if err != nil {
+			t.Fatalf("Failed to create shared container: %v", err)
+		}
+		// A database of its own isolates the test from the others using the container
+		setup.dbName = generateTestDBName(t)
+		if err := execAsAdmin(connInfo, logger, "CREATE DATABASE "+setup.dbName); err != nil {
+			releaseSharedContainer(t)
+			t.Fatalf("Failed to create test database: %v", err)
+		}
+		setup.ConnInfo = &structs.DatabaseConnection{
+			Host:     connInfo.Host,
+			Port:     connInfo.Port,
+			Database: setup.dbName,
+			Username: connInfo.Username,
+			Password: connInfo.Password,
+			SSLMode:  "disable",
+		}
+
+	case TestDatabaseLocal:
+		setup.ConnInfo = localConnInfo()
+	}
+
+	// The driver only changes how the manager connects; the container is set up with pq
+	setup.ConnInfo.Driver = driver
+	manager, err := connectWithRetry(t, setup.ConnInfo, logger)
+	if err != nil {
+		if mode == TestDatabaseLocal {
+			t.Skipf("Failed to connect to local PostgreSQL: %v", err)
+		}
+		setup.Cleanup(t)
+		t.Fatalf("Failed to create database manager: %v", err)
+	}
+	setup.Manager = manager
+
+	// Create the rds_iam role for IAM tests (simulate AWS RDS environment)
+	if err := createRDSIAMRole(manager); err != nil {
+		t.Logf("Warning: Failed to create rds_iam role (this is expected for non-AWS environments): %v", err)
+	}
+
+	return setup
+}
+
+// testDatabaseMode resolves the mode of a test: the one requested, TEST_DATABASE_MODE, local when
+// USE_LOCAL_POSTGRES is true, or a container per test
+func testDatabaseMode(requested TestDatabaseMode) (TestDatabaseMode, error) {
+	mode := requested
+	if mode == "" {
+		mode = TestDatabaseMode(os.Getenv(TestDatabaseModeEnv))
+	}
+	if mode == "" && os.Getenv("USE_LOCAL_POSTGRES") == "true" {
+		mode = TestDatabaseLocal
+	}
+	if mode == "" {
+		mode = TestDatabaseContainer
+	}
+
+	switch mode {
+	case TestDatabaseContainer, TestDatabaseShared, TestDatabaseLocal:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid %s: %s (must be '%s', '%s' or '%s')",
+			TestDatabaseModeEnv, mode, TestDatabaseContainer, TestDatabaseShared, TestDatabaseLocal)
+	}
+}
+
+// testDatabaseDriver resolves the driver of a test: the one requested, TEST_DATABASE_DRIVER, or pq
+func testDatabaseDriver(requested string) (string, error) {
+	driver := requested
+	if driver == "" {
+		driver = os.Getenv(TestDatabaseDriverEnv)
+	}
+	if driver == "" {
+		driver = structs.DriverPQ
+	}
+
+	switch driver {
+	case structs.DriverPQ, structs.DriverPGX:
+		return driver, nil
+	default:
+		return "", fmt.Errorf("invalid %s: %s (must be '%s' or '%s')",
+			TestDatabaseDriverEnv, driver, structs.DriverPQ, structs.DriverPGX)
+	}
+}
+
+// startPostgresContainer starts a PostgreSQL container with the given database
+func startPostgresContainer(t testing.TB, database string) (testcontainers.Container, *structs.DatabaseConnection, error) {
+	// Configure testcontainers for the current environment
+	configureTestcontainersEnvironment(t)
+
+	// Create a context with timeout to prevent indefinite hanging
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	postgresContainer, err := postgres.Run(ctx,
+		"postgres:15-alpine",
+		postgres.WithDatabase(database),
+		postgres.WithUsername("testuser"),
+		postgres.WithPassword("testpass"),
+		testcontainers.WithWaitStrategy(
+			wait.ForLog("database system is ready to accept connections").
+				WithOccurrence(2).
+				WithStartupTimeout(30*time.Second)),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Get connection details
+	host, err := postgresContainer.Host(ctx)
+	if err != nil {
+		postgresContainer.Terminate(ctx)
+		return nil, nil, fmt.Errorf("failed to get container host: %w", err)
+	}
+
+	port, err := postgresContainer.MappedPort(ctx, "5432")
+	if err != nil {
+		postgresContainer.Terminate(ctx)
+		return nil, nil, fmt.Errorf("failed to get container port: %w", err)
+	}
+
+	// Force IPv4 if host is localhost/127.0.0.1 to avoid IPv6 issues
+	if host == "localhost" {
+		host = "127.0.0.1"
+	}
+
+	t.Logf("PostgreSQL container ready at %s:%d", host, port.Int())
+
+	return postgresContainer, &structs.DatabaseConnection{
+		Host:     host,
+		Port:     port.Int(),
+		Database: database,
+		Username: "testuser",
+		Password: "testpass",
+		SSLMode:  "disable",
+	}, nil
+}
+
+// acquireSharedContainer starts the shared container unless it is running and counts the test
+// using it
+func acquireSharedContainer(t testing.TB) (*structs.DatabaseConnection, error) {
+	containerMutex.Lock()
+	defer containerMutex.Unlock()
+
+	if sharedContainer == nil {
+		t.Log("Creating shared PostgreSQL container...")
+		container, connInfo, err := startPostgresContainer(t, "postgres")
+		if err != nil {
+			return nil, err
+		}
+		sharedContainer = &sharedTestContainer{Container: container, ConnInfo: connInfo}
+	}
+
+	sharedContainer.refCount++
+	return sharedContainer.ConnInfo, nil
+}
+
+// releaseSharedContainer stops counting a test as using the shared container and terminates
+// the container when no test uses it
+func releaseSharedContainer(t testing.TB) {
+	containerMutex.Lock()
+	defer containerMutex.Unlock()
+
+	if sharedContainer == nil {
+		return
+	}
+	sharedContainer.refCount--
+	if sharedContainer.refCount > 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := sharedContainer.Container.Terminate(ctx); err != nil {
+		t.Logf("Error terminating shared container: %v", err)
+	}
+	sharedContainer = nil
+	t.Log("Shared container terminated")
+}
+
+// localConnInfo describes the local PostgreSQL server from the POSTGRES_* variables
+func localConnInfo() *structs.DatabaseConnection {
+	port := 5432
+	if p, err := strconv.Atoi(getEnvWithDefault("POSTGRES_PORT", "5432")); err == nil {
+		port = p
+	}
+
+	return &structs.DatabaseConnection{
+		Host:     getEnvWithDefault("POSTGRES_HOST", "localhost"),
+		Port:     port,
+		Database: getEnvWithDefault("POSTGRES_DB", "testdb"),
+		Username: getEnvWithDefault("POSTGRES_USER", "testuser"),
+		Password: getEnvWithDefault("POSTGRES_PASSWORD", "testpass"),
+		SSLMode:  "disable",
+	}
+}
+
+// connectWithRetry creates a database manager, retrying while a new server finishes starting up
+func connectWithRetry(t testing.TB, connInfo *structs.DatabaseConnection, logger *logrus.Logger) (*Manager, error) {
+	var dbErr error
+	maxRetries := 3
+	retryDelay := 1 * time.Second
+	for i := 0; i < maxRetries; i++ {
+		manager, err := NewManager(connInfo, logger, false)
+		if err == nil {
+			// Test the connection with a ping
+			if err = manager.db.Ping(); err == nil {
+				return manager, nil
+			}
+			manager.Close()
+		}
+		dbErr = err
+		t.Logf("Database connection attempt %d failed: %v", i+1, err)
+
+		if i < maxRetries-1 {
+			time.Sleep(retryDelay)
+		}
+	}
+	return nil, fmt.Errorf("failed after %d attempts: %w", maxRetries, dbErr)
+}
+
+// execAsAdmin runs a statement over a connection of its own, for statements such as CREATE
+// DATABASE that cannot use the connection of the test
+func execAsAdmin(connInfo *structs.DatabaseConnection, logger *logrus.Logger, query string) error {
+	manager, err := NewManager(connInfo, logger, false)
+	if err != nil {
+		return err
+	}
+	defer manager.Close()
+
+	_, err = manager.db.Exec(query)
+	return err
+}
+
+// configureTestcontainersEnvironment detects the Docker environment and applies appropriate configuration
+func configureTestcontainersEnvironment(t testing.TB) {
+	// Check if ryuk is already disabled
+	if os.Getenv("TESTCONTAINERS_RYUK_DISABLED") == "true" {
+		t.Logf("Ryuk already disabled via environment variable")
+		return
+	}
+
+	// Detect Docker environment and configure accordingly
+	dockerConfig := detectDockerEnvironment()
+
+	switch dockerConfig.Type {
+	case "colima":
+		t.Logf("Detected Colima Docker environment at %s", dockerConfig.SocketPath)
+		// Disable ryuk for Colima due to socket path issues
+		os.Setenv("TESTCONTAINERS_RYUK_DISABLED", "true")
+
+	case "docker-desktop":
+		t.Logf("Detected Docker Desktop environment")
+		// Docker Desktop usually works fine with ryuk, but we can disable it for consistency
+		if shouldDisableRyukForDockerDesktop() {
+			os.Setenv("TESTCONTAINERS_RYUK_DISABLED", "true")
+		}
+
+	case "lima":
+		t.Logf("Detected Lima Docker environment")
+		// Lima may have similar issues to Colima
+		os.Setenv("TESTCONTAINERS_RYUK_DISABLED", "true")
+
+	case "podman":
+		t.Logf("Detected Podman environment")
+		// Podman may have compatibility issues with ryuk
+		os.Setenv("TESTCONTAINERS_RYUK_DISABLED", "true")
+
+	case "unknown":
+		t.Logf("Unknown Docker environment, attempting to detect ryuk compatibility")
+		if !isRyukCompatible() {
+			t.Logf("Ryuk appears incompatible, disabling")
+			os.Setenv("TESTCONTAINERS_RYUK_DISABLED", "true")
+		}
+
+	default:
+		t.Logf("Using default testcontainers configuration")
+	}
+}
+
+// DockerEnvironment represents the detected Docker configuration
+type DockerEnvironment struct {
+	Type       string // colima, docker-desktop, lima, podman, unknown
+	SocketPath string
+}
+
+// detectDockerEnvironment attempts to identify the Docker environment being used
+func detectDockerEnvironment() DockerEnvironment {
+	// Check for common Docker socket paths and environment indicators
+	dockerHost := os.Getenv("DOCKER_HOST")
+
+	// Check for Colima
+	if dockerHost != "" {
+		if filepath.Base(dockerHost) == dockerSocketName &&
+			(containsPath(dockerHost, ".colima") || containsPath(dockerHost, "colima")) {
+			return DockerEnvironment{Type: "colima", SocketPath: dockerHost}
+		}
+	}
+
+	// Check for Lima
+	if dockerHost != "" && containsPath(dockerHost, ".lima") {
+		return DockerEnvironment{Type: "lima", SocketPath: dockerHost}
+	}
+
+	// Check for Podman
+	if dockerHost != "" && containsPath(dockerHost, "podman") {
+		return DockerEnvironment{Type: "podman", SocketPath: dockerHost}
+	}
+
+	// Check filesystem for Docker environments
+	homeDir, _ := os.UserHomeDir()
+
+	// Check for Colima socket
+	colimaSocket := filepath.Join(homeDir, ".colima", "default", dockerSocketName)
+	if fileExists(colimaSocket) {
+		return DockerEnvironment{Type: "colima", SocketPath: colimaSocket}
+	}
+
+	// Check for Lima socket
+	limaSocket := filepath.Join(homeDir, ".lima", "default", dockerSocketName)
+	if fileExists(limaSocket) {
+		return DockerEnvironment{Type: "lima", SocketPath: limaSocket}
+	}
+
+	// Check for Docker Desktop (standard locations)
+	if runtime.GOOS == "darwin" {
+		if fileExists(defaultDockerSocket) {
+			return DockerEnvironment{Type: "docker-desktop", SocketPath: defaultDockerSocket}
+		}
+	}
+
+	return DockerEnvironment{Type: "unknown", SocketPath: ""}
+}
+
+// shouldDisableRyukForDockerDesktop determines if ryuk should be disabled even for Docker Desktop
+func shouldDisableRyukForDockerDesktop() bool {
+	// Check if there's a preference to disable ryuk globally
+	if os.Getenv("TESTCONTAINERS_PREFER_NO_RYUK") == "true" {
+		return true
+	}
+
+	// For CI environments, we might want to disable ryuk for faster cleanup
+	if os.Getenv("CI") == "true" {
+		return true
+	}
+
+	return false
+}
+
+// isRyukCompatible performs a basic check to see if ryuk is likely to work
+func isRyukCompatible() bool {
+	// This is a simplified check - in practice, you might want to do more sophisticated detection
+	// For now, we'll assume unknown environments might have issues
+	return false
+}
+
+// containsPath checks if a path contains a specific substring with recursion limit
+func containsPath(path, substring string) bool {
+	// Add recursion limit to prevent infinite loops
+	return containsPathWithLimit(path, substring, 10)
+}
+
+// containsPathWithLimit checks if a path contains a specific substring with depth limit
+func containsPathWithLimit(path, substring string, limit int) bool {
+	if limit <= 0 {
+		return false
+	}
+
+	if filepath.Base(path) == substring {
+		return true
+	}
+
+	dir := filepath.Dir(path)
+	if dir == path || dir == "." || dir == "/" {
+		// We've reached the root, stop recursion
+		return false
+	}
+
+	return containsPathWithLimit(dir, substring, limit-1)
+}
+
+// fileExists checks if a file exists
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// getEnvWithDefault gets an environment variable or returns a default value
+func getEnvWithDefault(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// generateTestDBName creates a unique database name for the test
+func generateTestDBName(t testing.TB) string {
+	// Use simple name with timestamp and test name hash to ensure uniqueness
+	testHash := sanitizeDBName(t.Name())
+	if len(testHash) > 20 {
+		testHash = testHash[:20]
+	}
+	return fmt.Sprintf("testdb_%s_%d", testHash, time.Now().UnixNano())
+}
+
+// sanitizeDBName creates a valid PostgreSQL database name from test name
+func sanitizeDBName(name string) string {
+	// Replace all non-alphanumeric characters with underscores
+	reg := regexp.MustCompile(`[^a-zA-Z0-9]`)
+	return strings.ToLower(reg.ReplaceAllString(name, "_"))
+}
+
+// createRDSIAMRole creates the rds_iam role for testing IAM functionality
+func createRDSIAMRole(manager *Manager) error {
+	query := "CREATE ROLE rds_iam"
+	_, err := manager.db.Exec(query)
+	if err != nil && !strings.Contains(err.Error(), `role "rds_iam" already exists`) {
+		return err
+	}
+	return nil
+}
+
+// GetManager returns the database manager (implements DatabaseTestSetup interface)
+func (tds *TestDatabaseSetup) GetManager() *Manager {
+	return tds.Manager
+}
+
+// Cleanup closes the connection and releases the server: the container of the test is
+// terminated, and in shared and local mode, whose server outlives the test, the test data
+// and the database of the test are dropped
+func (tds *TestDatabaseSetup) Cleanup(t testing.TB) {
+	if tds.Mode != TestDatabaseContainer && tds.Manager != nil {
+		tds.ResetDatabase(t)
+	}
+
+	if tds.Manager != nil {
+		if err := tds.Manager.Close(); err != nil {
+			t.Logf("Error closing database manager: %v", err)
+		}
+	}
+
+	switch tds.Mode {
+	case TestDatabaseContainer:
+		if tds.Container != nil {
+			// Use a context with timeout for cleanup to prevent hanging
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			if err := tds.Container.Terminate(ctx); err != nil {
+				t.Logf("Error terminating container: %v", err)
+			}
+		}
+
+	case TestDatabaseShared:
+		if err := execAsAdmin(sharedContainer.ConnInfo, tds.Logger, "DROP DATABASE IF EXISTS "+tds.dbName); err != nil {
+			t.Logf("Error dropping test database: %v", err)
+		}
+		releaseSharedContainer(t)
+	}
+
+	// Clean up environment variable if we set it
+	if os.Getenv("TESTCONTAINERS_RYUK_DISABLED") == "true" {
+		// Only unset if we're not in a persistent environment where it should stay
+		if os.Getenv("TESTCONTAINERS_PERSIST_RYUK_DISABLED") != "true" {
+			os.Unsetenv("TESTCONTAINERS_RYUK_DISABLED")
+		}
+	}
+}
+
+// ResetDatabase cleans up any test data from the database
+func (tds *TestDatabaseSetup) ResetDatabase(t testing.TB) {
+	for _, user := range testUsers {
+		exists, err := tds.Manager.UserExists(user)
+		if err != nil {
+			t.Logf("Error checking if user %s exists: %v", user, err)
+			continue
+		}
+		if exists {
+			if err := tds.Manager.DropUser(user); err != nil {
+				t.Logf("Error dropping test user %s: %v", user, err)
+			}
+		}
+	}
+
+	for _, role := range testRoles {
+		exists, err := tds.Manager.GroupExists(role)
+		if err != nil {
+			t.Logf("Error checking if role %s exists: %v", role, err)
+			continue
+		}
+		if exists {
+			if err := tds.Manager.DropGroup(role); err != nil {
+				t.Logf("Error dropping test role %s: %v", role, err)
+			}
+		}
+	}
+
+	// Roles dropped directly are not seen by the role cache
+	tds.Manager.InvalidateCatalogCache()
+}
+
+// CreateTestDatabase creates a test database for privilege testing
+func (tds *TestDatabaseSetup) CreateTestDatabase(t testing.TB, dbName string) {
+	query := fmt.Sprintf("CREATE DATABASE %s", tds.Manager.quoteIdentifier(dbName))
+	if _, err := tds.Manager.db.Exec(query); err != nil {
+		t.Logf("Error creating test database %s (might already exist): %v", dbName, err)
+	}
+}
+
+// DropTestDatabase drops a test database
+func (tds *TestDatabaseSetup) DropTestDatabase(t testing.TB, dbName string) {
+	// Terminate connections to the database first
+	query := "SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname = $1"
+	tds.Manager.db.Exec(query, dbName)
+
+	query = fmt.Sprintf("DROP DATABASE IF EXISTS %s", tds.Manager.quoteIdentifier(dbName))
+	if _, err := tds.Manager.db.Exec(query); err != nil {
+		t.Logf("Error dropping test database %s: %v", dbName, err)
+	}
+}
@@ -0,0 +1,286 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+)
+
+// hookTimeout bounds a hook command so a stuck script does not stall a sync
+const hookTimeout = 30 * time.Second
+
+// hookFuncs are the functions available to hook SQL templates for quoting values
+var hookFuncs = template.FuncMap{
+	"ident":   pq.QuoteIdentifier,
+	"literal": pq.QuoteLiteral,
+}
+
+// HookData is the role a hook runs for, available to SQL templates and sent to commands as JSON
+type HookData struct {
+	Event       string            `json:"event"`
+	Role        string            `json:"role"`               // The created user or group
+	Username    string            `json:"username,omitempty"` // The created user, for user hooks
+	Database    string            `json:"database,omitempty"` // Database the SQL runs in, when the hook lists databases
+	AuthMethods []string          `json:"auth_methods"`
+	Groups      []string          `json:"groups"`
+	Source      string            `json:"source,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Owner       string            `json:"owner,omitempty"`
+	Team        string            `json:"team,omitempty"`
+	Ticket      string            `json:"ticket,omitempty"`
+	Metadata    map[string]string `json:"metadata"`
+}
+
+// roleHook is a configured hook with its SQL templates parsed
+type roleHook struct {
+	config    structs.HookConfig
+	templates []*template.Template
+}
+
+// deferredHook is a hook with SQL in other databases or a command, which a transactional sync
+// runs once it has committed, so the created role is visible to other connections and
+// commands never act on a role that is rolled back
+type deferredHook struct {
+	entity string
+	hook   roleHook
+	data   HookData
+}
+
+// SetHooks sets the hooks run after users and groups are created, parsing their SQL templates
+func (m *Manager) SetHooks(hooks []structs.HookConfig) error {
+	m.hooks = nil
+	for _, hook := range hooks {
+		if hook.Event != structs.HookEventUserCreated && hook.Event != structs.HookEventGroupCreated {
+			continue
+		}
+
+		parsed := roleHook{config: hook}
+		for _, statement := range hook.SQL {
+			tmpl, err := template.New(hook.Name).Funcs(hookFuncs).Option("missingkey=zero").Parse(statement)
+			if err != nil {
+				return fmt.Errorf("hook %s: failed to parse template %q: %w", hook.Name, statement, err)
+			}
+			parsed.templates = append(parsed.templates, tmpl)
+		}
+		m.hooks = append(m.hooks, parsed)
+	}
+	return nil
+}
+
+// runUserHooks runs the hooks that apply to a created user. In dry-run mode SQL statements
+// are previewed and commands are not run.
+func (m *Manager) runUserHooks(user *structs.UserConfig) error {
+	data := HookData{
+		Event:       structs.HookEventUserCreated,
+		Role:        user.Username,
+		Username:    user.Username,
+		AuthMethods: user.EffectiveAuthMethods(),
+		Groups:      user.Groups,
+		Source:      user.Source,
+		Description: user.Description,
+		Owner:       user.Owner,
+		Team:        user.Team,
+		Ticket:      user.Ticket,
+		Metadata:    user.Metadata,
+	}
+	if data.Metadata == nil {
+		data.Metadata = map[string]string{}
+	}
+
+	for _, hook := range m.hooks {
+		if hook.config.Event != structs.HookEventUserCreated {
+			continue
+		}
+		if len(hook.config.Groups) > 0 && !sharesGroup(user.Groups, hook.config.Groups) {
+			continue
+		}
+		if err := m.runHook(hook, data); err != nil {
+			return fmt.Errorf("user %s was created but hook %s failed: %w", user.Username, hook.config.Name, err)
+		}
+	}
+	return nil
+}
+
+// runGroupHooks runs the hooks that apply to a created group. In dry-run mode SQL statements
+// are previewed and commands are not run.
+func (m *Manager) runGroupHooks(group *structs.GroupConfig) error {
+	data := HookData{
+		Event:       structs.HookEventGroupCreated,
+		Role:        group.Name,
+		AuthMethods: []string{},
+		Groups:      []string{},
+		Description: group.Description,
+		Owner:       group.Owner,
+		Team:        group.Team,
+		Ticket:      group.Ticket,
+		Metadata:    map[string]string{},
+	}
+
+	for _, hook := range m.hooks {
+		if hook.config.Event != structs.HookEventGroupCreated {
+			continue
+		}
+		if len(hook.config.Groups) > 0 && !containsString(hook.config.Groups, group.Name) {
+			continue
+		}
+		if err := m.runHook(hook, data); err != nil {
+			return fmt.Errorf("group %s was created but hook %s failed: %w", group.Name, hook.config.Name, err)
+		}
+	}
+	return nil
+}
+
+// runHook runs the SQL of a hook, in each of its databases or on this connection, and then
+// its command. SQL in other databases and the command wait for a transactional sync to
+// commit.
+func (m *Manager) runHook(hook roleHook, data HookData) error {
+	m.logger.WithFields(logrus.Fields{
+		"hook":      hook.config.Name,
+		"role":      data.Role,
+		"databases": hook.config.Databases,
+	}).Info("Running hook")
+
+	if len(hook.config.Databases) == 0 {
+		if err := m.runHookSQL(hook, &data); err != nil {
+			return err
+		}
+	}
+	if m.tx != nil && !m.dryRun {
+		if len(hook.config.Databases) > 0 || len(hook.config.Command) > 0 {
+			m.deferredHooks = append(m.deferredHooks, deferredHook{entity: m.entity, hook: hook, data: data})
+		}
+		return nil
+	}
+	return m.runHookAfterSQL(hook, data)
+}
+
+// runHookAfterSQL runs what follows the SQL on this connection: the SQL of a hook in each of
+// its databases and then its command
+func (m *Manager) runHookAfterSQL(hook roleHook, data HookData) error {
+	if err := m.runHookDatabases(hook, data); err != nil {
+		return err
+	}
+	return m.runHookCommand(hook, &data)
+}
+
+// runHookDatabases runs the SQL of a hook in each of the databases it lists
+func (m *Manager) runHookDatabases(hook roleHook, data HookData) error {
+	for _, name := range hook.config.Databases {
+		data.Database = name
+
+		// Dry runs only render the statements, so they need no connection to the database
+		target := m
+		if !m.dryRun {
+			db, err := m.databaseManager(name)
+			if err != nil {
+				return err
+			}
+			target = db
+		}
+
+		if err := runHookSQLAs(target, strings.TrimSpace(fmt.Sprintf("%s (database %s)", m.entity, name)), hook, &data); err != nil {
+			return fmt.Errorf("database %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// runHookSQLAs runs the SQL of a hook on a manager with its statements attributed to an
+// entity, restoring the manager's own entity afterwards. The manager is the connected one in
+// a dry run, which must keep the entity of the role being synced.
+func runHookSQLAs(target *Manager, entity string, hook roleHook, data *HookData) error {
+	previous := target.entity
+	defer func() { target.entity = previous }()
+
+	target.entity = entity
+	return target.runHookSQL(hook, data)
+}
+
+// runHookSQL renders and executes the SQL statements of a hook, logging each statement it
+// executes for the audit trail
+func (m *Manager) runHookSQL(hook roleHook, data *HookData) error {
+	for _, tmpl := range hook.templates {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return fmt.Errorf("failed to render statement: %w", err)
+		}
+
+		query := strings.TrimSpace(buf.String())
+		if query == "" {
+			continue
+		}
+		if err := m.execute(query); err != nil {
+			return fmt.Errorf("failed to execute %q: %w", query, err)
+		}
+		if m.dryRun {
+			continue
+		}
+
+		database := data.Database
+		if database == "" && m.conn != nil {
+			database = m.conn.Database
+		}
+		m.logger.WithFields(logrus.Fields{
+			"hook":     hook.config.Name,
+			"role":     data.Role,
+			"database": database,
+			"query":    m.logQuery(query),
+		}).Info("Executed hook statement")
+	}
+	return nil
+}
+
+// runHookCommand runs the command of a hook with the role as JSON on stdin
+func (m *Manager) runHookCommand(hook roleHook, data *HookData) error {
+	if len(hook.config.Command) == 0 {
+		return nil
+	}
+	if m.dryRun {
+		m.logger.WithFields(logrus.Fields{
+			"hook":    hook.config.Name,
+			"command": hook.config.Command,
+		}).Info("DRY RUN: Would run hook command")
+		return nil
+	}
+
+	input, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode hook input: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(m.context(), hookTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, hook.config.Command[0], hook.config.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(input)
+	output, err := cmd.CombinedOutput()
+	if len(output) > 0 {
+		m.logger.WithFields(logrus.Fields{
+			"hook":   hook.config.Name,
+			"output": strings.TrimSpace(string(output)),
+		}).Info("Hook command output")
+	}
+	if err != nil {
+		return fmt.Errorf("command %s failed: %w", hook.config.Command[0], err)
+	}
+	return nil
+}
+
+// sharesGroup reports whether any of the groups is in the selection
+func sharesGroup(groups, selection []string) bool {
+	for _, group := range groups {
+		if containsString(selection, group) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,224 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+func newHookTestManager(dryRun bool) *Manager {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	return &Manager{logger: logger, ctx: context.Background(), dryRun: dryRun, statements: []structs.PlannedStatement{}}
+}
+
+func TestUserHooksSQL(t *testing.T) {
+	m := newHookTestManager(true)
+	err := m.SetHooks([]structs.HookConfig{
+		{
+			Name:  "resource-group",
+			Event: structs.HookEventUserCreated,
+			SQL: []string{
+				"ALTER ROLE {{ ident .Username }} RESOURCE GROUP {{ ident .Metadata.resource_group }}",
+				"{{ with .Metadata.priority }}SELECT set_priority({{ literal . }}){{ end }}",
+			},
+		},
+		{Name: "analysts", Event: structs.HookEventUserCreated, Groups: []string{"analysts"}, SQL: []string{"SELECT 1"}},
+	})
+	if err != nil {
+		t.Fatalf("SetHooks failed: %v", err)
+	}
+
+	user := &structs.UserConfig{Username: "app_user", Groups: []string{"app_group"}, Metadata: map[string]string{"resource_group": "batch"}}
+	if err := m.runUserHooks(user); err != nil {
+		t.Fatalf("runUserHooks failed: %v", err)
+	}
+
+	var queries []string
+	for _, statement := range m.statements {
+		queries = append(queries, statement.Query)
+	}
+	expected := []string{`ALTER ROLE "app_user" RESOURCE GROUP "batch"`}
+	if !slices.Equal(queries, expected) {
+		t.Errorf("Expected %v, got %v", expected, queries)
+	}
+}
+
+func TestUserHooksCommand(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "hook.json")
+	hooks := []structs.HookConfig{{
+		Name:    "priority",
+		Event:   structs.HookEventUserCreated,
+		Command: []string{"sh", "-c", `cat > "$0"`, output},
+	}}
+	user := &structs.UserConfig{Username: "app_user", AuthMethod: structs.AuthMethodIAM, Metadata: map[string]string{"priority": "high"}}
+
+	// Commands are not run in dry-run mode
+	m := newHookTestManager(true)
+	if err := m.SetHooks(hooks); err != nil {
+		t.Fatalf("SetHooks failed: %v", err)
+	}
+	if err := m.runUserHooks(user); err != nil {
+		t.Fatalf("runUserHooks failed: %v", err)
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Fatal("Expected the hook command not to run in dry-run mode")
+	}
+
+	m = newHookTestManager(false)
+	if err := m.SetHooks(hooks); err != nil {
+		t.Fatalf("SetHooks failed: %v", err)
+	}
+	if err := m.runUserHooks(user); err != nil {
+		t.Fatalf("runUserHooks failed: %v", err)
+	}
+
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("Expected the hook command to write its input: %v", err)
+	}
+	var input HookData
+	if err := json.Unmarshal(data, &input); err != nil {
+		t.Fatalf("Failed to decode hook input: %v", err)
+	}
+	if input.Event != structs.HookEventUserCreated || input.Username != "app_user" || input.Metadata["priority"] != "high" {
+		t.Errorf("Unexpected hook input %+v", input)
+	}
+	if !slices.Equal(input.AuthMethods, []string{structs.AuthMethodIAM}) {
+		t.Errorf("Expected auth methods [iam], got %v", input.AuthMethods)
+	}
+}
+
+func TestTransactionalSyncDefersHookCommands(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "hook.json")
+	m := newHookTestManager(false)
+	err := m.SetHooks([]structs.HookConfig{{
+		Name:    "priority",
+		Event:   structs.HookEventUserCreated,
+		Command: []string{"sh", "-c", `cat > "$0"`, output},
+	}})
+	if err != nil {
+		t.Fatalf("SetHooks failed: %v", err)
+	}
+
+	// The command waits for the sync transaction to commit
+	m.tx = &sql.Tx{}
+	if err := m.runUserHooks(&structs.UserConfig{Username: "app_user"}); err != nil {
+		t.Fatalf("runUserHooks failed: %v", err)
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Fatal("Expected the hook command not to run before commit")
+	}
+	if len(m.deferredHooks) != 1 {
+		t.Fatalf("Expected the hook to be deferred, got %+v", m.deferredHooks)
+	}
+
+	m.tx = nil
+	deferred := m.deferredHooks[0]
+	if err := m.runHookAfterSQL(deferred.hook, deferred.data); err != nil {
+		t.Fatalf("runHookAfterSQL failed: %v", err)
+	}
+	if _, err := os.Stat(output); err != nil {
+		t.Errorf("Expected the deferred hook command to run: %v", err)
+	}
+}
+
+func TestHookCommandWithoutContext(t *testing.T) {
+	m := newHookTestManager(false)
+	m.ctx = nil
+	if err := m.SetHooks([]structs.HookConfig{{Name: "noop", Event: structs.HookEventUserCreated, Command: []string{"true"}}}); err != nil {
+		t.Fatalf("SetHooks failed: %v", err)
+	}
+	if err := m.runUserHooks(&structs.UserConfig{Username: "app_user"}); err != nil {
+		t.Errorf("Expected a manager without a context to run the hook command, got %v", err)
+	}
+}
+
+func TestUserHooksCommandFailure(t *testing.T) {
+	m := newHookTestManager(false)
+	if err := m.SetHooks([]structs.HookConfig{{Name: "fails", Event: structs.HookEventUserCreated, Command: []string{"false"}}}); err != nil {
+		t.Fatalf("SetHooks failed: %v", err)
+	}
+	if err := m.runUserHooks(&structs.UserConfig{Username: "app_user"}); err == nil {
+		t.Error("Expected a failing hook command to be reported")
+	}
+}
+
+func TestSetHooksInvalidTemplate(t *testing.T) {
+	m := newHookTestManager(true)
+	err := m.SetHooks([]structs.HookConfig{{Name: "broken", Event: structs.HookEventUserCreated, SQL: []string{"SELECT {{ .Username"}}})
+	if err == nil {
+		t.Error("Expected an unparseable template to be rejected")
+	}
+}
+
+func TestGroupHooksDatabases(t *testing.T) {
+	m := newHookTestManager(true)
+	m.entity = "group reporting"
+	err := m.SetHooks([]structs.HookConfig{
+		{
+			Name:      "bootstrap-schema",
+			Event:     structs.HookEventGroupCreated,
+			Groups:    []string{"reporting"},
+			Databases: []string{"app", "warehouse"},
+			SQL:       []string{"CREATE SCHEMA IF NOT EXISTS {{ ident .Role }} AUTHORIZATION {{ ident .Role }} -- {{ .Database }}"},
+		},
+		{Name: "users-only", Event: structs.HookEventUserCreated, SQL: []string{"SELECT 1"}},
+		{Name: "other-group", Event: structs.HookEventGroupCreated, Groups: []string{"analysts"}, SQL: []string{"SELECT 2"}},
+	})
+	if err != nil {
+		t.Fatalf("SetHooks failed: %v", err)
+	}
+
+	if err := m.runGroupHooks(&structs.GroupConfig{Name: "reporting"}); err != nil {
+		t.Fatalf("runGroupHooks failed: %v", err)
+	}
+
+	expected := []structs.PlannedStatement{
+		{Entity: "group reporting (database app)", Query: `CREATE SCHEMA IF NOT EXISTS "reporting" AUTHORIZATION "reporting" -- app`},
+		{Entity: "group reporting (database warehouse)", Query: `CREATE SCHEMA IF NOT EXISTS "reporting" AUTHORIZATION "reporting" -- warehouse`},
+	}
+	if !slices.Equal(m.statements, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, m.statements)
+	}
+	if m.entity != "group reporting" {
+		t.Errorf("Expected the entity to be restored, got %q", m.entity)
+	}
+}
+
+func TestGroupHooksDatabasesRestoreEntity(t *testing.T) {
+	m := newHookTestManager(false)
+	m.entity = "group reporting"
+	err := m.SetHooks([]structs.HookConfig{{
+		Name:      "bootstrap-schema",
+		Event:     structs.HookEventGroupCreated,
+		Databases: []string{"warehouse"},
+		SQL:       []string{"CREATE SCHEMA IF NOT EXISTS {{ ident .Role }}"},
+	}})
+	if err != nil {
+		t.Fatalf("SetHooks failed: %v", err)
+	}
+
+	// The manager of the other database only records its statements
+	warehouse := newHookTestManager(true)
+	connection := &databaseConnection{manager: warehouse}
+	connection.once.Do(func() {})
+	m.databases = map[string]*databaseConnection{"warehouse": connection}
+
+	if err := m.runGroupHooks(&structs.GroupConfig{Name: "reporting"}); err != nil {
+		t.Fatalf("runGroupHooks failed: %v", err)
+	}
+	if len(warehouse.statements) != 1 || warehouse.statements[0].Entity != "group reporting (database warehouse)" {
+		t.Errorf("Expected the statement to be attributed to the group in warehouse, got %+v", warehouse.statements)
+	}
+	if warehouse.entity != "" || m.entity != "group reporting" {
+		t.Errorf("Expected both entities to be restored, got %q and %q", warehouse.entity, m.entity)
+	}
+}
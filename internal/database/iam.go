@@ -0,0 +1,130 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/rds/auth"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/secrets"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// iamTokenRefreshAfter is how long a generated RDS IAM auth token is reused. Tokens are
+	// valid for 15 minutes; refreshing early leaves room for slow connection attempts.
+	iamTokenRefreshAfter = 10 * time.Minute
+)
+
+// tokenBuilder generates an RDS IAM auth token, matching auth.BuildAuthToken
+type tokenBuilder func(ctx context.Context, endpoint, region, dbUser string, creds aws.CredentialsProvider, optFns ...func(options *auth.BuildAuthTokenOptions)) (string, error)
+
+// iamConnector opens PostgreSQL connections authenticated with RDS IAM auth tokens generated
+// from the AWS credentials chain. Tokens are only checked when a connection is opened, so
+// open connections outlive the token; new connections get a fresh token once it is stale.
+type iamConnector struct {
+	conn        *structs.DatabaseConnection
+	credentials aws.CredentialsProvider
+	buildToken  tokenBuilder
+	logger      *logrus.Logger
+
+	mu       sync.Mutex
+	token    string
+	issuedAt time.Time
+	now      func() time.Time
+}
+
+// newIAMConnector creates a connector that generates auth tokens with the default AWS credentials chain
+func newIAMConnector(conn *structs.DatabaseConnection, logger *logrus.Logger) (*iamConnector, error) {
+	cfg, err := awsconfig.LoadDefaultConfig(context.Background(), awsconfig.WithRegion(conn.AWSRegion))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
+
+	return &iamConnector{
+		conn:        conn,
+		credentials: cfg.Credentials,
+		buildToken:  auth.BuildAuthToken,
+		logger:      logger,
+		now:         time.Now,
+	}, nil
+}
+
+// Connect implements driver.Connector
+func (c *iamConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	token, err := c.authToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	connector, err := newConnector(c.conn, connectionString(c.conn, token))
+	if err != nil {
+		return nil, err
+	}
+	return connector.Connect(ctx)
+}
+
+// Driver implements driver.Connector
+func (c *iamConnector) Driver() driver.Driver {
+	return sqlDriver(c.conn)
+}
+
+// authToken returns the current auth token, generating a new one when it is stale
+func (c *iamConnector) authToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && c.now().Sub(c.issuedAt) < iamTokenRefreshAfter {
+		return c.token, nil
+	}
+
+	endpoint := fmt.Sprintf("%s:%d", c.conn.Host, c.conn.Port)
+	token, err := c.buildToken(ctx, endpoint, c.conn.AWSRegion, c.conn.Username, c.credentials)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate IAM auth token: %w", err)
+	}
+
+	c.token = token
+	c.issuedAt = c.now()
+	// Each connector masks only its current token, so long-running commands do not collect
+	// one per refresh
+	secrets.Replace(fmt.Sprintf("iam-token-%p", c), token)
+
+	c.logger.WithFields(logrus.Fields{
+		"endpoint": endpoint,
+		"username": c.conn.Username,
+		"region":   c.conn.AWSRegion,
+	}).Debug("Generated IAM auth token")
+
+	return token, nil
+}
+
+// connectionString builds a key/value connection string, quoting values so passwords and
+// auth tokens may contain spaces, quotes or backslashes. Dials time out after the dial
+// timeout of the connection, in whole seconds as libpq counts them.
+func connectionString(conn *structs.DatabaseConnection, password string) string {
+	quote := func(value string) string {
+		value = strings.ReplaceAll(value, `\`, `\\`)
+		value = strings.ReplaceAll(value, `'`, `\'`)
+		return "'" + value + "'"
+	}
+
+	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		quote(conn.Host), conn.Port, quote(conn.Username), quote(password), quote(conn.Database), quote(conn.SSLMode))
+	for _, param := range []struct{ name, value string }{{"sslrootcert", conn.SSLRootCert}, {"sslcert", conn.SSLCert}, {"sslkey", conn.SSLKey}} {
+		if param.value != "" {
+			dsn += fmt.Sprintf(" %s=%s", param.name, quote(param.value))
+		}
+	}
+	if timeout := conn.DialTimeout(); timeout > 0 {
+		dsn += fmt.Sprintf(" connect_timeout=%d", int(math.Ceil(timeout.Seconds())))
+	}
+	return dsn
+}
@@ -0,0 +1,69 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/rds/auth"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+func TestIAMConnectorRefreshesToken(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	calls := 0
+	connector := &iamConnector{
+		conn: &structs.DatabaseConnection{Host: "db.example.com", Port: 5432, Username: "admin", AWSRegion: "eu-west-1"},
+		buildToken: func(ctx context.Context, endpoint, region, dbUser string, creds aws.CredentialsProvider, optFns ...func(options *auth.BuildAuthTokenOptions)) (string, error) {
+			calls++
+			if endpoint != "db.example.com:5432" || region != "eu-west-1" || dbUser != "admin" {
+				t.Errorf("Unexpected token request for %s %s %s", endpoint, region, dbUser)
+			}
+			return fmt.Sprintf("token-%d", calls), nil
+		},
+		logger: logger,
+		now:    func() time.Time { return now },
+	}
+
+	token, err := connector.authToken(context.Background())
+	if err != nil || token != "token-1" {
+		t.Fatalf("Expected token-1, got %q (%v)", token, err)
+	}
+
+	// Reused while fresh
+	now = now.Add(5 * time.Minute)
+	if token, _ := connector.authToken(context.Background()); token != "token-1" {
+		t.Errorf("Expected the token to be reused, got %q", token)
+	}
+
+	// Regenerated before the 15 minute expiry
+	now = now.Add(6 * time.Minute)
+	if token, _ := connector.authToken(context.Background()); token != "token-2" {
+		t.Errorf("Expected a refreshed token, got %q", token)
+	}
+}
+
+func TestConnectionStringQuotesValues(t *testing.T) {
+	conn := &structs.DatabaseConnection{Host: "localhost", Port: 5432, Username: "admin", Database: "postgres", SSLMode: "require"}
+
+	expected := `host='localhost' port=5432 user='admin' password='it\'s a \\secret' dbname='postgres' sslmode='require'`
+	if got := connectionString(conn, `it's a \secret`); got != expected {
+		t.Errorf("Unexpected connection string:\n got: %s\nwant: %s", got, expected)
+	}
+}
+
+func TestConnectionStringSSLCertificates(t *testing.T) {
+	conn := &structs.DatabaseConnection{Host: "db", Port: 5432, Username: "admin", Database: "postgres", SSLMode: "verify-full",
+		SSLRootCert: "/etc/ssl/rds bundle.pem", SSLCert: "/certs/admin.crt", SSLKey: "/certs/admin.key"}
+
+	expected := `host='db' port=5432 user='admin' password='p' dbname='postgres' sslmode='verify-full' sslrootcert='/etc/ssl/rds bundle.pem' sslcert='/certs/admin.crt' sslkey='/certs/admin.key'`
+	if got := connectionString(conn, "p"); got != expected {
+		t.Errorf("Unexpected connection string:\n got: %s\nwant: %s", got, expected)
+	}
+}
@@ -0,0 +1,118 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+func TestNonASCIIIdentifierStatements(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	m := &Manager{logger: logger, ctx: context.Background(), dryRun: true, statements: []structs.PlannedStatement{}}
+	// Neither role exists yet, answered from the cache instead of the database
+	m.roles.exists = map[string]bool{"jürgen": false, `équipe "données"`: false}
+
+	if err := m.CreateUser(&structs.UserConfig{Username: "jürgen", AuthMethod: structs.AuthMethodCert, CanLogin: true}); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if err := m.CreateGroup(&structs.GroupConfig{Name: `équipe "données"`, Inherit: true}); err != nil {
+		t.Fatalf("Failed to create group: %v", err)
+	}
+	if err := m.AddUserToGroup("jürgen", `équipe "données"`); err != nil {
+		t.Fatalf("Failed to add user to group: %v", err)
+	}
+	if err := m.GrantPrivileges(`équipe "données"`, []string{"CONNECT"}, []string{"données"}); err != nil {
+		t.Fatalf("Failed to grant privileges: %v", err)
+	}
+	if err := m.GrantTablePrivileges("jürgen", []string{"SELECT"}, []string{"ventes.résumé"}); err != nil {
+		t.Fatalf("Failed to grant table privileges: %v", err)
+	}
+
+	expected := []string{
+		`CREATE USER "jürgen" LOGIN`,
+		`CREATE ROLE "équipe ""données""" INHERIT`,
+		`GRANT "équipe ""données""" TO "jürgen"`,
+		`GRANT CONNECT ON DATABASE "données" TO "équipe ""données"""`,
+		`GRANT SELECT ON TABLE "ventes"."résumé" TO "jürgen"`,
+	}
+	if len(m.statements) != len(expected) {
+		t.Fatalf("Expected %d statements, got %v", len(expected), m.statements)
+	}
+	for i, statement := range m.statements {
+		if statement.Query != expected[i] {
+			t.Errorf("Statement %d: expected %s, got %s", i, expected[i], statement.Query)
+		}
+	}
+}
+
+func TestCreateRejectsInvalidIdentifiers(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	m := &Manager{logger: logger, ctx: context.Background(), dryRun: true, statements: []structs.PlannedStatement{}}
+
+	// 32 two-byte characters fit in 63 characters but not in 63 bytes
+	long := strings.Repeat("é", 32)
+	if err := m.CreateUser(&structs.UserConfig{Username: long, CanLogin: true}); err == nil {
+		t.Error("Expected a name PostgreSQL would truncate to be rejected")
+	}
+	if err := m.CreateUser(&structs.UserConfig{Username: "jürgen\n", CanLogin: true}); err == nil {
+		t.Error("Expected a name with a control character to be rejected")
+	}
+	if err := m.CreateGroup(&structs.GroupConfig{Name: "\xff"}); err == nil {
+		t.Error("Expected a name that is not valid UTF-8 to be rejected")
+	}
+	if len(m.statements) != 0 {
+		t.Errorf("Expected no statements for rejected names, got %v", m.statements)
+	}
+}
+
+func TestNonASCIIRoles(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	user := &structs.UserConfig{Username: "test_jürgen", Password: "test_pass", CanLogin: true, Enabled: true}
+	if err := setup.Manager.CreateUser(user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if err := setup.Manager.CreateGroup(&structs.GroupConfig{Name: "test_équipe"}); err != nil {
+		t.Fatalf("Failed to create group: %v", err)
+	}
+	if err := setup.Manager.AddUserToGroup("test_jürgen", "test_équipe"); err != nil {
+		t.Fatalf("Failed to add user to group: %v", err)
+	}
+	if err := setup.Manager.GrantPrivileges("test_équipe", []string{"CONNECT"}, []string{setup.ConnInfo.Database}); err != nil {
+		t.Fatalf("Failed to grant privileges: %v", err)
+	}
+
+	groups, err := setup.Manager.GetRoleMemberships("test_jürgen")
+	if err != nil {
+		t.Fatalf("Failed to get memberships: %v", err)
+	}
+	if len(groups) != 1 || groups[0] != "test_équipe" {
+		t.Errorf("Expected membership in test_équipe, got %v", groups)
+	}
+
+	if err := setup.Manager.RevokePrivileges("test_équipe", []string{"CONNECT"}, []string{setup.ConnInfo.Database}); err != nil {
+		t.Fatalf("Failed to revoke privileges: %v", err)
+	}
+	if err := setup.Manager.DropUser("test_jürgen"); err != nil {
+		t.Fatalf("Failed to drop user: %v", err)
+	}
+	if err := setup.Manager.DropGroup("test_équipe"); err != nil {
+		t.Fatalf("Failed to drop group: %v", err)
+	}
+	for _, role := range []string{"test_jürgen", "test_équipe"} {
+		exists, err := setup.Manager.GroupExists(role)
+		if err != nil {
+			t.Fatalf("Failed to check role: %v", err)
+		}
+		if exists {
+			t.Errorf("Expected role %s to be dropped", role)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+// IdentityUser is a login role created for an identity provider identity
+type IdentityUser struct {
+	Username   string
+	ExternalID string
+	CanLogin   bool
+}
+
+// IdentityUsers returns the users that record the identity provider ID they were created
+// for, ordered by name. The connected role is never included.
+func (m *Manager) IdentityUsers() ([]IdentityUser, error) {
+	rows, err := m.executor().Query(`
+		SELECT rolname, rolcanlogin, COALESCE(shobj_description(oid, 'pg_authid'), '')
+		FROM pg_roles
+		WHERE rolname !~ '^pg_' AND rolname <> current_user
+		ORDER BY rolname`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list identity provider users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []IdentityUser
+	for rows.Next() {
+		var user IdentityUser
+		var comment string
+		if err := rows.Scan(&user.Username, &user.CanLogin, &comment); err != nil {
+			return nil, fmt.Errorf("failed to scan identity provider user: %w", err)
+		}
+
+		_, metadata := parseRoleComment(comment)
+		if metadata[externalIDMetadataKey] == "" || metadata[managedMetadataKey] == ManagedKindGroup {
+			continue
+		}
+		user.ExternalID = metadata[externalIDMetadataKey]
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+// ReconcileIdentities locks or drops the users whose recorded identity provider ID is not
+// among the active identities, so access does not outlive the identity. With PruneDisable
+// LOGIN is revoked and users that are already locked are left alone; with PruneDrop the
+// users are dropped. The change limits apply unless a large change is allowed, and an empty
+// list of active identities is refused, as it more likely means a misconfigured provider
+// than one with no users.
+func (m *Manager) ReconcileIdentities(active map[string]bool, action string) (*structs.IdentityReconcileResult, error) {
+	if action != PruneDisable && action != PruneDrop {
+		return nil, fmt.Errorf("invalid reconcile action: %s (must be '%s' or '%s')", action, PruneDisable, PruneDrop)
+	}
+	if len(active) == 0 {
+		return nil, fmt.Errorf("the identity provider reported no active identities, refusing to lock out every user")
+	}
+
+	users, err := m.IdentityUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &structs.IdentityReconcileResult{Checked: len(users)}
+	var orphans []IdentityUser
+	for _, user := range users {
+		if active[user.ExternalID] {
+			continue
+		}
+		if action == PruneDisable && !user.CanLogin {
+			m.logger.WithField("username", user.Username).Debug("Identity is gone but user is already locked, skipping")
+			continue
+		}
+		orphans = append(orphans, user)
+	}
+
+	// Users created from events are not marked managed, so the percentage limit is taken
+	// of the users with an identity provider ID
+	if !m.allowLargeChange && len(orphans) > 0 {
+		removals := make([]string, 0, len(orphans))
+		for _, user := range orphans {
+			removals = append(removals, user.Username)
+		}
+		if err := m.checkRemovals(removals, len(removals), len(users)); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, user := range orphans {
+		m.logger.WithFields(logrus.Fields{
+			"username":    user.Username,
+			"external_id": user.ExternalID,
+			"action":      action,
+		}).Warn("User's identity is no longer active in the identity provider")
+
+		orphan := structs.OrphanedIdentity{Username: user.Username, ExternalID: user.ExternalID}
+		switch action {
+		case PruneDrop:
+			err = m.DropUser(user.Username)
+			orphan.Action = "dropped"
+		default:
+			_, err = m.DisableUser(user.Username)
+			orphan.Action = "disabled"
+		}
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("failed to reconcile user %s: %w", user.Username, err))
+			continue
+		}
+		result.Orphaned = append(result.Orphaned, orphan)
+	}
+
+	m.logger.WithFields(logrus.Fields{
+		"checked":  result.Checked,
+		"orphaned": len(result.Orphaned),
+		"errors":   len(result.Errors),
+	}).Info("Identity reconciliation completed")
+
+	return result, nil
+}
@@ -0,0 +1,90 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+func TestReconcileIdentitiesRefusals(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := &Manager{logger: logger, ctx: context.Background()}
+
+	if _, err := manager.ReconcileIdentities(map[string]bool{"sub-1": true}, "delete"); err == nil || !strings.Contains(err.Error(), "invalid reconcile action") {
+		t.Errorf("Expected invalid action error, got %v", err)
+	}
+	if _, err := manager.ReconcileIdentities(map[string]bool{}, PruneDisable); err == nil || !strings.Contains(err.Error(), "no active identities") {
+		t.Errorf("Expected empty identity list to be refused, got %v", err)
+	}
+}
+
+func TestReconcileIdentities(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	for _, user := range []structs.UserConfig{
+		{Username: "test_user", Password: "test_pass", CanLogin: true, Enabled: true, ExternalID: "sub-1"},
+		{Username: "test_user_2", Password: "test_pass", CanLogin: true, Enabled: true, ExternalID: "sub-2"},
+		{Username: "test_user_3", Password: "test_pass", CanLogin: true, Enabled: true},
+	} {
+		if err := setup.Manager.CreateUser(&user); err != nil {
+			t.Fatalf("Failed to create user %s: %v", user.Username, err)
+		}
+	}
+
+	users, err := setup.Manager.IdentityUsers()
+	if err != nil {
+		t.Fatalf("Failed to list identity users: %v", err)
+	}
+	if len(users) != 2 || users[0].ExternalID != "sub-1" || users[1].ExternalID != "sub-2" {
+		t.Fatalf("Expected the two users with an external ID, got %+v", users)
+	}
+
+	// One orphan out of two identity provider users exceeds a 20% limit
+	setup.Manager.SetChangeLimits(structs.ChangeLimitsConfig{MaxRemovalPercent: 20})
+	_, err = setup.Manager.ReconcileIdentities(map[string]bool{"sub-1": true}, PruneDisable)
+	var largeChange *LargeChangeError
+	if !errors.As(err, &largeChange) {
+		t.Fatalf("Expected a large change error, got %v", err)
+	}
+	setup.Manager.SetChangeLimits(structs.ChangeLimitsConfig{})
+
+	result, err := setup.Manager.ReconcileIdentities(map[string]bool{"sub-1": true}, PruneDisable)
+	if err != nil {
+		t.Fatalf("Failed to reconcile identities: %v", err)
+	}
+	if result.Checked != 2 || len(result.Orphaned) != 1 || len(result.Errors) != 0 {
+		t.Fatalf("Expected one orphan of two checked users, got %+v", result)
+	}
+	if orphan := result.Orphaned[0]; orphan.Username != "test_user_2" || orphan.ExternalID != "sub-2" || orphan.Action != "disabled" {
+		t.Errorf("Unexpected orphan %+v", orphan)
+	}
+
+	exists, canLogin, err := setup.Manager.RoleCanLogin("test_user_2")
+	if err != nil || !exists || canLogin {
+		t.Errorf("Expected test_user_2 to be locked, got exists=%v canLogin=%v err=%v", exists, canLogin, err)
+	}
+
+	// Locked orphans are left alone when disabling, and dropped when dropping
+	result, err = setup.Manager.ReconcileIdentities(map[string]bool{"sub-1": true}, PruneDisable)
+	if err != nil || len(result.Orphaned) != 0 {
+		t.Errorf("Expected nothing to do for a locked orphan, got %+v (err: %v)", result, err)
+	}
+
+	result, err = setup.Manager.ReconcileIdentities(map[string]bool{"sub-1": true}, PruneDrop)
+	if err != nil || len(result.Orphaned) != 1 || result.Orphaned[0].Action != "dropped" {
+		t.Fatalf("Expected test_user_2 to be dropped, got %+v (err: %v)", result, err)
+	}
+	if exists, _ := setup.Manager.UserExists("test_user_2"); exists {
+		t.Error("Expected test_user_2 to be dropped")
+	}
+	if exists, _ := setup.Manager.UserExists("test_user"); !exists {
+		t.Error("Expected test_user with an active identity to remain")
+	}
+}
@@ -0,0 +1,187 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+)
+
+// SetExactMemberships controls whether sync revokes live memberships in managed groups
+// that are not listed in the configuration. When disabled, extra memberships are only reported.
+func (m *Manager) SetExactMemberships(exact bool) {
+	m.exactMemberships = exact
+}
+
+// GetRoleMemberships returns the roles a user or group is a direct member of
+func (m *Manager) GetRoleMemberships(role string) ([]string, error) {
+	query := `
+		SELECT r.rolname
+		FROM pg_auth_members m
+		JOIN pg_roles r ON m.roleid = r.oid
+		JOIN pg_roles u ON m.member = u.oid
+		WHERE u.rolname = $1
+		ORDER BY r.rolname`
+
+	groups, err := m.queryStrings(query, role)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get memberships of %s: %w", role, err)
+	}
+
+	return groups, nil
+}
+
+// GetGroupMembers returns the roles that are direct members of a group
+func (m *Manager) GetGroupMembers(group string) ([]string, error) {
+	query := `
+		SELECT u.rolname
+		FROM pg_auth_members m
+		JOIN pg_roles r ON m.roleid = r.oid
+		JOIN pg_roles u ON m.member = u.oid
+		WHERE r.rolname = $1
+		ORDER BY u.rolname`
+
+	members, err := m.queryStrings(query, group)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get members of %s: %w", group, err)
+	}
+
+	return members, nil
+}
+
+// missingMemberships returns the groups of a list a role is not a direct member of yet, so
+// sync only grants the memberships that changed
+func missingMemberships(groups, current []string) []string {
+	held := make(map[string]bool, len(current))
+	for _, group := range current {
+		held[strings.ToLower(group)] = true
+	}
+
+	var missing []string
+	for _, group := range groups {
+		if !held[strings.ToLower(group)] {
+			missing = append(missing, group)
+		}
+	}
+	return missing
+}
+
+// reconcileMemberships compares a role's live memberships in managed groups, as looked up
+// before sync granted the missing ones, with the configured ones, revoking the extras when
+// exact memberships are enabled and reporting them otherwise. Groups not managed by the
+// configuration are left alone.
+func (m *Manager) reconcileMemberships(member string, desired, current []string, managedGroups map[string]bool, result *structs.SyncResult) error {
+	wanted := make(map[string]bool, len(desired))
+	for _, group := range desired {
+		wanted[strings.ToLower(group)] = true
+	}
+
+	for _, group := range current {
+		if !managedGroups[strings.ToLower(group)] || wanted[strings.ToLower(group)] {
+			continue
+		}
+
+		membership := structs.Membership{Member: member, Group: group}
+
+		if !m.exactMemberships {
+			m.logger.WithFields(logrus.Fields{
+				"member": member,
+				"group":  group,
+			}).Debug("Membership is not in configuration")
+			result.MembershipsExtra = append(result.MembershipsExtra, membership)
+			result.Warn(member, fmt.Sprintf("membership in %s is not in the configuration, left in place (use --exact-memberships to revoke it)", group))
+			continue
+		}
+
+		if err := m.RemoveUserFromGroup(member, group); err != nil {
+			return err
+		}
+		result.MembershipsRevoked = append(result.MembershipsRevoked, membership)
+	}
+
+	return nil
+}
+
+// undeclaredMemberships returns the memberships in managed groups of roles the configuration
+// declares neither as a user nor as a group. Reconciling each declared role never visits
+// them. The connected role is left out, since PostgreSQL 16 makes the creator of a role a
+// member of it.
+func (m *Manager) undeclaredMemberships(config *structs.Config) ([]structs.Membership, error) {
+	if len(config.Groups) == 0 {
+		return nil, nil
+	}
+
+	groups := make([]string, len(config.Groups))
+	for i, group := range config.Groups {
+		groups[i] = group.Name
+	}
+	declared := make(map[string]bool, len(config.Users)+len(config.Groups))
+	for _, user := range config.Users {
+		declared[strings.ToLower(user.Username)] = true
+	}
+	for _, group := range config.Groups {
+		declared[strings.ToLower(group.Name)] = true
+	}
+
+	query := `
+		SELECT u.rolname, r.rolname
+		FROM pg_auth_members am
+		JOIN pg_roles r ON am.roleid = r.oid
+		JOIN pg_roles u ON am.member = u.oid
+		WHERE r.rolname = ANY($1) AND u.rolname <> current_user
+		ORDER BY r.rolname, u.rolname`
+
+	rows, err := m.executor().Query(query, pq.Array(groups))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get members of managed groups: %w", err)
+	}
+	defer rows.Close()
+
+	var memberships []structs.Membership
+	for rows.Next() {
+		var membership structs.Membership
+		if err := rows.Scan(&membership.Member, &membership.Group); err != nil {
+			return nil, err
+		}
+		if !declared[strings.ToLower(membership.Member)] {
+			memberships = append(memberships, membership)
+		}
+	}
+
+	return memberships, rows.Err()
+}
+
+// reconcileUndeclaredMembers revokes the memberships in managed groups of roles the
+// configuration does not declare when exact memberships are enabled, and reports them otherwise
+func (m *Manager) reconcileUndeclaredMembers(config *structs.Config, result *structs.SyncResult) error {
+	memberships, err := m.undeclaredMemberships(config)
+	if err != nil {
+		return err
+	}
+
+	for _, membership := range memberships {
+		if !m.exactMemberships {
+			result.MembershipsExtra = append(result.MembershipsExtra, membership)
+			result.Warn(membership.Member, fmt.Sprintf("membership in %s of a role that is not in the configuration, left in place (use --exact-memberships to revoke it)", membership.Group))
+			continue
+		}
+
+		if err := m.RemoveUserFromGroup(membership.Member, membership.Group); err != nil {
+			return err
+		}
+		result.MembershipsRevoked = append(result.MembershipsRevoked, membership)
+	}
+
+	return nil
+}
+
+// managedGroupSet returns the lower-cased names of the groups defined in the configuration
+func managedGroupSet(groups []structs.GroupConfig) map[string]bool {
+	managed := make(map[string]bool, len(groups))
+	for _, group := range groups {
+		managed[strings.ToLower(group.Name)] = true
+	}
+	return managed
+}
@@ -0,0 +1,190 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+func TestManagedGroupSet(t *testing.T) {
+	managed := managedGroupSet([]structs.GroupConfig{{Name: "App_Group"}, {Name: "read_only"}})
+
+	if !managed["app_group"] || !managed["read_only"] {
+		t.Errorf("Expected configured groups to be managed, got %v", managed)
+	}
+	if managed["rds_iam"] {
+		t.Error("Expected unconfigured group not to be managed")
+	}
+}
+
+func TestMissingMemberships(t *testing.T) {
+	missing := missingMemberships([]string{"App_Group", "read_only", "writers"}, []string{"app_group", "rds_iam"})
+
+	if len(missing) != 2 || missing[0] != "read_only" || missing[1] != "writers" {
+		t.Errorf("Expected read_only and writers to be missing, got %v", missing)
+	}
+	if missing := missingMemberships([]string{"read_only"}, nil); len(missing) != 1 {
+		t.Errorf("Expected every group to be missing without memberships, got %v", missing)
+	}
+}
+
+func TestSyncConfigurationExactMemberships(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	config := &structs.Config{
+		Groups: []structs.GroupConfig{
+			{Name: "test_group", Inherit: true},
+			{Name: "test_role", Inherit: true},
+		},
+		Users: []structs.UserConfig{
+			{Username: "test_user", Password: "test_pass", Groups: []string{"test_group", "test_role"}, Enabled: true, CanLogin: true},
+		},
+	}
+
+	if _, err := setup.Manager.SyncConfiguration(config); err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+
+	// Removing a group from the config only reports the extra membership by default
+	config.Users[0].Groups = []string{"test_group"}
+
+	result, err := setup.Manager.SyncConfiguration(config)
+	if err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+	if len(result.MembershipsExtra) != 1 || result.MembershipsExtra[0].Group != "test_role" {
+		t.Errorf("Expected test_role membership to be reported, got %v", result.MembershipsExtra)
+	}
+	if len(result.Warnings) != 1 || result.Warnings[0].Role != "test_user" {
+		t.Errorf("Expected a warning for the extra membership, got %v", result.Warnings)
+	}
+	if len(result.MembershipsRevoked) != 0 {
+		t.Errorf("Expected no revoked memberships, got %v", result.MembershipsRevoked)
+	}
+
+	// With exact memberships the extra membership is revoked
+	setup.Manager.SetExactMemberships(true)
+	defer setup.Manager.SetExactMemberships(false)
+
+	result, err = setup.Manager.SyncConfiguration(config)
+	if err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+	if len(result.MembershipsRevoked) != 1 || result.MembershipsRevoked[0].Group != "test_role" {
+		t.Errorf("Expected test_role membership to be revoked, got %v", result.MembershipsRevoked)
+	}
+
+	groups, err := setup.Manager.GetRoleMemberships("test_user")
+	if err != nil {
+		t.Fatalf("Failed to get memberships: %v", err)
+	}
+	if len(groups) != 1 || groups[0] != "test_group" {
+		t.Errorf("Expected test_user to only be in test_group, got %v", groups)
+	}
+}
+
+func TestSyncConfigurationUndeclaredMembers(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	config := &structs.Config{
+		Groups: []structs.GroupConfig{{Name: "test_group", Inherit: true}},
+		Users: []structs.UserConfig{
+			{Username: "test_user", Password: "test_pass", Groups: []string{"test_group"}, Enabled: true, CanLogin: true},
+		},
+	}
+	if _, err := setup.Manager.SyncConfiguration(config); err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+
+	// A user deleted from the configuration keeps its role, and its membership is reported
+	config.Users = nil
+	result, err := setup.Manager.SyncConfiguration(config)
+	if err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+	if len(result.MembershipsExtra) != 1 || result.MembershipsExtra[0].Member != "test_user" {
+		t.Errorf("Expected the membership of test_user to be reported, got %v", result.MembershipsExtra)
+	}
+
+	setup.Manager.SetExactMemberships(true)
+	defer setup.Manager.SetExactMemberships(false)
+
+	result, err = setup.Manager.SyncConfiguration(config)
+	if err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+	if len(result.MembershipsRevoked) != 1 || result.MembershipsRevoked[0].Member != "test_user" {
+		t.Errorf("Expected the membership of test_user to be revoked, got %v", result.MembershipsRevoked)
+	}
+
+	members, err := setup.Manager.GetGroupMembers("test_group")
+	if err != nil {
+		t.Fatalf("Failed to get members: %v", err)
+	}
+	for _, member := range members {
+		if member == "test_user" {
+			t.Errorf("Expected test_user to be removed from test_group, got %v", members)
+		}
+	}
+}
+
+func TestExpireTemporaryMemberships(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	expiresAt := time.Now().Add(time.Hour)
+	config := &structs.Config{
+		Groups: []structs.GroupConfig{
+			{Name: "test_group", Inherit: true},
+			{Name: "test_role", Inherit: true},
+		},
+		Users: []structs.UserConfig{
+			{
+				Username: "test_user", Password: "test_pass", Enabled: true, CanLogin: true,
+				TemporaryGroups: []structs.TemporaryMembership{
+					{Group: "test_group", ExpiresAt: expiresAt},
+					{Group: "test_role", ExpiresAt: expiresAt.Add(30 * 24 * time.Hour)},
+				},
+			},
+		},
+	}
+
+	if _, err := setup.Manager.SyncConfiguration(config); err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+	groups, _ := setup.Manager.GetRoleMemberships("test_user")
+	if len(groups) != 2 {
+		t.Fatalf("Expected both temporary memberships to be granted, got %v", groups)
+	}
+
+	// Two hours later the first membership has expired and the second is not due yet
+	result := setup.Manager.ExpireMemberships(config.Users, expiresAt.Add(time.Hour), DefaultExpiryWindow)
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	if len(result.Expired) != 1 || result.Expired[0].Group != "test_group" {
+		t.Errorf("Expected test_group to expire, got %v", result.Expired)
+	}
+	if len(result.Upcoming) != 0 {
+		t.Errorf("Expected no upcoming expirations within the window, got %v", result.Upcoming)
+	}
+	groups, _ = setup.Manager.GetRoleMemberships("test_user")
+	if len(groups) != 1 || groups[0] != "test_role" {
+		t.Errorf("Expected only test_role to remain, got %v", groups)
+	}
+
+	// An expired membership that is already revoked is not reported again
+	result = setup.Manager.ExpireMemberships(config.Users, expiresAt.Add(29*24*time.Hour), DefaultExpiryWindow)
+	if len(result.Expired) != 0 {
+		t.Errorf("Expected nothing more to expire, got %v", result.Expired)
+	}
+	if len(result.Upcoming) != 1 || result.Upcoming[0].Group != "test_role" {
+		t.Errorf("Expected test_role to be reported as upcoming, got %v", result.Upcoming)
+	}
+}
@@ -0,0 +1,272 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultGrantWorkers is how many databases object grants are applied to at the same time
+const DefaultGrantWorkers = 4
+
+// databaseConnection is a connection to another database of the cluster, opened once per run.
+// A database that cannot be reached keeps its error, so it fails once instead of stalling
+// every role that grants in it.
+type databaseConnection struct {
+	once    sync.Once
+	manager *Manager
+	err     error
+}
+
+// objectGrantBatch holds the object grants of one role that apply to a single database
+type objectGrantBatch struct {
+	Database     string // Empty for the connected database
+	Schemas      []structs.ExtensionSchemaGrant
+	LargeObjects []structs.LargeObjectGrant
+}
+
+// SetGrantWorkers sets how many databases object grants are applied to at the same time.
+// Values below one apply them one database at a time.
+func (m *Manager) SetGrantWorkers(workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+	m.grantWorkers = workers
+}
+
+// databaseManager returns a manager connected to another database of the cluster with the
+// connection details of this one, opening the connection on first use
+func (m *Manager) databaseManager(name string) (*Manager, error) {
+	m.databasesMu.Lock()
+	if m.databases == nil {
+		m.databases = make(map[string]*databaseConnection)
+	}
+	connection, exists := m.databases[name]
+	if !exists {
+		connection = &databaseConnection{}
+		m.databases[name] = connection
+	}
+	m.databasesMu.Unlock()
+
+	// Connections to different databases are opened concurrently
+	connection.once.Do(func() {
+		if m.conn == nil {
+			connection.err = fmt.Errorf("no connection details to reach database %s", name)
+			return
+		}
+		m.logger.WithField("database", name).Info("Connecting to database")
+
+		conn := *m.conn
+		conn.Database = name
+		connection.manager, connection.err = NewManagerContext(m.context(), &conn, m.logger, m.dryRun)
+		if connection.err != nil {
+			connection.err = fmt.Errorf("failed to connect to database %s: %w", name, connection.err)
+			return
+		}
+		connection.manager.redactPasswords = m.redactPasswords
+	})
+
+	return connection.manager, connection.err
+}
+
+// otherDatabase reports whether a database is another database of the cluster than the one
+// this manager is connected to. An empty name is the connected database.
+func (m *Manager) otherDatabase(name string) bool {
+	return name != "" && (m.conn == nil || name != m.conn.Database)
+}
+
+// InDatabase runs fn with a manager connected to a database of the cluster: this manager for
+// the connected database or an empty name, otherwise a connection opened to the other
+// database on first use and kept until Close. The dry-run statements of another database are
+// collected under the current entity.
+func (m *Manager) InDatabase(name string, fn func(db *Manager) error) error {
+	if !m.otherDatabase(name) {
+		return fn(m)
+	}
+
+	db, err := m.databaseManager(name)
+	if err != nil {
+		return err
+	}
+	db.entity = fmt.Sprintf("%s (database %s)", m.entity, name)
+	if m.statements != nil {
+		db.statements = []structs.PlannedStatement{}
+	}
+	err = fn(db)
+	if m.statements != nil {
+		m.statements = append(m.statements, db.statements...)
+	}
+	db.entity, db.statements = "", nil
+	if err != nil {
+		return fmt.Errorf("database %s: %w", name, err)
+	}
+	return nil
+}
+
+// closeDatabases closes the connections opened to other databases
+func (m *Manager) closeDatabases() {
+	m.databasesMu.Lock()
+	defer m.databasesMu.Unlock()
+
+	for name, connection := range m.databases {
+		if connection.manager == nil {
+			continue
+		}
+		if err := connection.manager.Close(); err != nil {
+			m.logger.WithError(err).WithField("database", name).Warn("Failed to close database connection")
+		}
+	}
+	m.databases = nil
+}
+
+// applyExtensionGrants applies extension schema and large object grants for a role,
+// returning every error encountered so one bad grant does not hide the others. Grants in
+// other databases are applied concurrently, at most grantWorkers databases at a time, and
+// errors in one database do not stop the others.
+func (m *Manager) applyExtensionGrants(target string, schemas []structs.ExtensionSchemaGrant, largeObjects []structs.LargeObjectGrant) []error {
+	connected := ""
+	if m.conn != nil {
+		connected = m.conn.Database
+	}
+	batches := batchObjectGrants(connected, schemas, largeObjects)
+
+	// Roles a transactional sync creates are invisible to other connections until it
+	// commits, so grants in other databases wait for the commit
+	if m.tx != nil {
+		var local, remote []objectGrantBatch
+		for _, batch := range batches {
+			if batch.Database == "" {
+				local = append(local, batch)
+			} else {
+				remote = append(remote, batch)
+			}
+		}
+		if len(remote) > 0 {
+			m.deferredGrants = append(m.deferredGrants, deferredObjectGrants{entity: m.entity, target: target, batches: remote})
+		}
+		batches = local
+	}
+
+	return m.applyObjectGrantBatches(target, batches)
+}
+
+// applyObjectGrantBatches applies batches of object grants, those in other databases
+// concurrently while the grants in the connected database use the main connection
+func (m *Manager) applyObjectGrantBatches(target string, batches []objectGrantBatch) []error {
+	errs := make([][]error, len(batches))
+	statements := make([][]structs.PlannedStatement, len(batches))
+	workers := make(chan struct{}, max(m.grantWorkers, 1))
+	var wg sync.WaitGroup
+
+	for i, batch := range batches {
+		if batch.Database == "" {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			workers <- struct{}{}
+			defer func() { <-workers }()
+
+			db, err := m.databaseManager(batch.Database)
+			if err != nil {
+				errs[i] = []error{err}
+				return
+			}
+
+			// Each database is used by one worker at a time, so its statements are its own
+			db.entity = fmt.Sprintf("%s (database %s)", m.entity, batch.Database)
+			if m.statements != nil {
+				db.statements = []structs.PlannedStatement{}
+			}
+			for _, err := range db.applyObjectGrantBatch(target, batch) {
+				errs[i] = append(errs[i], fmt.Errorf("database %s: %w", batch.Database, err))
+			}
+			statements[i], db.statements = db.statements, nil
+		}()
+	}
+
+	// Grants in the connected database use the main connection while the workers run
+	for i, batch := range batches {
+		if batch.Database == "" {
+			errs[i] = m.applyObjectGrantBatch(target, batch)
+		}
+	}
+	wg.Wait()
+
+	var all []error
+	for i := range batches {
+		all = append(all, errs[i]...)
+		if m.statements != nil {
+			m.statements = append(m.statements, statements[i]...)
+		}
+	}
+
+	if len(batches) > 1 {
+		m.logger.WithFields(logrus.Fields{
+			"target":    target,
+			"databases": len(batches),
+			"errors":    len(all),
+		}).Debug("Applied object grants across databases")
+	}
+
+	return all
+}
+
+// applyObjectGrantBatch applies the object grants of one database on this connection
+func (m *Manager) applyObjectGrantBatch(target string, batch objectGrantBatch) []error {
+	var errs []error
+
+	for i := range batch.Schemas {
+		if err := m.GrantExtensionSchema(target, &batch.Schemas[i]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for i := range batch.LargeObjects {
+		if err := m.GrantLargeObject(target, &batch.LargeObjects[i]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+// batchObjectGrants groups object grants by the database they apply to. Grants in the
+// connected database come first, under an empty name, followed by the other databases by name.
+func batchObjectGrants(connected string, schemas []structs.ExtensionSchemaGrant, largeObjects []structs.LargeObjectGrant) []objectGrantBatch {
+	byDatabase := make(map[string]*objectGrantBatch)
+	batch := func(database string) *objectGrantBatch {
+		if database == connected {
+			database = ""
+		}
+		if byDatabase[database] == nil {
+			byDatabase[database] = &objectGrantBatch{Database: database}
+		}
+		return byDatabase[database]
+	}
+
+	for _, grant := range schemas {
+		b := batch(grant.Database)
+		b.Schemas = append(b.Schemas, grant)
+	}
+	for _, grant := range largeObjects {
+		b := batch(grant.Database)
+		b.LargeObjects = append(b.LargeObjects, grant)
+	}
+
+	names := make([]string, 0, len(byDatabase))
+	for name := range byDatabase {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	batches := make([]objectGrantBatch, 0, len(names))
+	for _, name := range names {
+		batches = append(batches, *byDatabase[name])
+	}
+	return batches
+}
@@ -0,0 +1,96 @@
+package database
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestBatchObjectGrants(t *testing.T) {
+	schemas := []structs.ExtensionSchemaGrant{
+		{Extension: "postgis", Database: "maps"},
+		{Extension: "pg_cron"},
+		{Extension: "pgcrypto", Database: "app"},
+		{Extension: "hstore", Database: "analytics"},
+	}
+	largeObjects := []structs.LargeObjectGrant{
+		{OID: 1234, Privileges: []string{"SELECT"}, Database: "maps"},
+	}
+
+	batches := batchObjectGrants("app", schemas, largeObjects)
+
+	var names []string
+	for _, batch := range batches {
+		names = append(names, batch.Database)
+	}
+	// Grants in the connected database come first, whether or not they name it
+	if strings.Join(names, ",") != ",analytics,maps" {
+		t.Fatalf("Expected batches for the connected database, analytics and maps, got %q", names)
+	}
+	if len(batches[0].Schemas) != 2 {
+		t.Errorf("Expected pg_cron and pgcrypto in the connected database, got %+v", batches[0].Schemas)
+	}
+	if len(batches[2].Schemas) != 1 || len(batches[2].LargeObjects) != 1 {
+		t.Errorf("Expected one schema and one large object grant in maps, got %+v", batches[2])
+	}
+}
+
+func TestApplyExtensionGrantsIsolatesDatabaseErrors(t *testing.T) {
+	logger, _ := test.NewNullLogger()
+	m := &Manager{logger: logger, grantWorkers: 2}
+
+	// Without connection details no other database can be reached, so each one fails on
+	// its own and reports a single error however many grants it has
+	errs := m.applyExtensionGrants("test_role", []structs.ExtensionSchemaGrant{
+		{Extension: "postgis", Database: "maps"},
+		{Extension: "hstore", Database: "maps"},
+		{Extension: "pgcrypto", Database: "analytics"},
+	}, nil)
+
+	if len(errs) != 2 {
+		t.Fatalf("Expected one error per unreachable database, got %v", errs)
+	}
+	if !strings.Contains(errs[0].Error(), "analytics") || !strings.Contains(errs[1].Error(), "maps") {
+		t.Errorf("Expected errors for analytics and maps in order, got %v", errs)
+	}
+}
+
+func TestSetGrantWorkers(t *testing.T) {
+	m := &Manager{}
+	m.SetGrantWorkers(0)
+	if m.grantWorkers != 1 {
+		t.Errorf("Expected at least one grant worker, got %d", m.grantWorkers)
+	}
+	m.SetGrantWorkers(8)
+	if m.grantWorkers != 8 {
+		t.Errorf("Expected 8 grant workers, got %d", m.grantWorkers)
+	}
+}
+
+func TestInDatabase(t *testing.T) {
+	logger, _ := test.NewNullLogger()
+	m := &Manager{logger: logger, conn: &structs.DatabaseConnection{Database: "app"}}
+
+	// The connected database is used directly, whether or not it is named
+	for _, name := range []string{"", "app"} {
+		var used *Manager
+		if err := m.InDatabase(name, func(db *Manager) error { used = db; return nil }); err != nil || used != m {
+			t.Errorf("Expected %q to run on the connected manager, got %p (err: %v)", name, used, err)
+		}
+	}
+	if m.otherDatabase("app") || !m.otherDatabase("reports") {
+		t.Error("Expected only reports to be another database")
+	}
+
+	// Without connection details no other database can be reached
+	m.conn = nil
+	err := m.InDatabase("reports", func(db *Manager) error {
+		t.Error("Expected no manager for an unreachable database")
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "reports") {
+		t.Errorf("Expected an error naming reports, got %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+// orderedConfig is a copy of a configuration with every entity and list sorted
+// into the order sync applies them in
+type orderedConfig struct {
+	Groups   []structs.GroupConfig
+	Users    []structs.UserConfig
+	Policies []structs.PolicyConfig
+	Schemas  []structs.SchemaConfig
+}
+
+// orderConfig sorts a configuration so that groups come before their members,
+// parent groups before child groups, and everything else is ordered by name.
+// Enabled users get the default groups of global_defaults.
+// The result is stable across runs regardless of the order entries appear in
+// the config file, so dry-run output can be diffed between config versions.
+func orderConfig(config *structs.Config) (*orderedConfig, error) {
+	groups, err := orderGroups(config.Groups)
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]structs.UserConfig, len(config.Users))
+	copy(users, config.Users)
+	sort.SliceStable(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+	for i := range users {
+		users[i].AddDefaultGroups(config.DefaultGroups())
+		users[i].Groups = sortedStrings(users[i].Groups)
+		users[i].Privileges = sortedStrings(users[i].Privileges)
+		users[i].Databases = sortedStrings(users[i].Databases)
+	}
+
+	policies := make([]structs.PolicyConfig, len(config.Policies))
+	copy(policies, config.Policies)
+	sort.SliceStable(policies, func(i, j int) bool {
+		if policies[i].Table != policies[j].Table {
+			return policies[i].Table < policies[j].Table
+		}
+		return policies[i].Name < policies[j].Name
+	})
+
+	schemas := make([]structs.SchemaConfig, len(config.Schemas))
+	copy(schemas, config.Schemas)
+	sort.SliceStable(schemas, func(i, j int) bool {
+		return schemas[i].Name < schemas[j].Name
+	})
+	for i := range schemas {
+		grants := append([]structs.SchemaGrant{}, schemas[i].Grants...)
+		sort.SliceStable(grants, func(a, b int) bool {
+			return grants[a].Role < grants[b].Role
+		})
+		schemas[i].Grants = grants
+	}
+
+	return &orderedConfig{
+		Groups:   groups,
+		Users:    users,
+		Policies: policies,
+		Schemas:  schemas,
+	}, nil
+}
+
+// orderGroups sorts groups topologically so every group comes after the groups
+// it is a member of, breaking ties by name. Parents that are not declared in the
+// config are assumed to exist already and do not constrain the order.
+func orderGroups(groups []structs.GroupConfig) ([]structs.GroupConfig, error) {
+	byName := make(map[string]structs.GroupConfig, len(groups))
+	for _, group := range groups {
+		group.Privileges = sortedStrings(group.Privileges)
+		group.Databases = sortedStrings(group.Databases)
+		group.MemberOf = sortedStrings(group.MemberOf)
+		byName[group.Name] = group
+	}
+
+	pending := make(map[string]int, len(byName))
+	children := make(map[string][]string)
+	for name, group := range byName {
+		for _, parent := range group.MemberOf {
+			if _, declared := byName[parent]; declared && parent != name {
+				pending[name]++
+				children[parent] = append(children[parent], name)
+			} else if parent == name {
+				return nil, fmt.Errorf("group %s cannot be a member of itself", name)
+			}
+		}
+	}
+
+	var ready []string
+	for name := range byName {
+		if pending[name] == 0 {
+			ready = append(ready, name)
+		}
+	}
+	sort.Strings(ready)
+
+	ordered := make([]structs.GroupConfig, 0, len(byName))
+	for len(ready) > 0 {
+		name := ready[0]
+		ready = ready[1:]
+		ordered = append(ordered, byName[name])
+
+		for _, child := range children[name] {
+			pending[child]--
+			if pending[child] == 0 {
+				idx := sort.SearchStrings(ready, child)
+				ready = append(ready, "")
+				copy(ready[idx+1:], ready[idx:])
+				ready[idx] = child
+			}
+		}
+	}
+
+	if len(ordered) != len(byName) {
+		var cyclic []string
+		for name, count := range pending {
+			if count > 0 {
+				cyclic = append(cyclic, name)
+			}
+		}
+		sort.Strings(cyclic)
+		return nil, fmt.Errorf("group memberships form a cycle between: %s", strings.Join(cyclic, ", "))
+	}
+
+	return ordered, nil
+}
+
+// sortedStrings returns a sorted copy of a slice, leaving the original untouched
+func sortedStrings(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	sorted := make([]string, len(values))
+	copy(sorted, values)
+	sort.Strings(sorted)
+	return sorted
+}
@@ -0,0 +1,147 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+func TestOrderGroups(t *testing.T) {
+	groups := []structs.GroupConfig{
+		{Name: "team_leads", MemberOf: []string{"developers", "read_only"}},
+		{Name: "read_only"},
+		{Name: "developers", MemberOf: []string{"read_only", "rds_superuser"}},
+		{Name: "auditors"},
+	}
+
+	ordered, err := orderGroups(groups)
+	if err != nil {
+		t.Fatalf("Failed to order groups: %v", err)
+	}
+
+	var names []string
+	for _, group := range ordered {
+		names = append(names, group.Name)
+	}
+
+	// Parents come first, undeclared parents do not constrain the order, ties break by name
+	expected := []string{"auditors", "read_only", "developers", "team_leads"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected order %v, got %v", expected, names)
+	}
+}
+
+func TestOrderGroupsCycle(t *testing.T) {
+	groups := []structs.GroupConfig{
+		{Name: "a", MemberOf: []string{"b"}},
+		{Name: "b", MemberOf: []string{"a"}},
+		{Name: "c"},
+	}
+
+	if _, err := orderGroups(groups); err == nil {
+		t.Error("Expected error for cyclic group memberships")
+	}
+
+	if _, err := orderGroups([]structs.GroupConfig{{Name: "self", MemberOf: []string{"self"}}}); err == nil {
+		t.Error("Expected error for group that is a member of itself")
+	}
+}
+
+func TestOrderConfigIsStable(t *testing.T) {
+	config := &structs.Config{
+		Users: []structs.UserConfig{
+			{Username: "zoe", Groups: []string{"b", "a"}, Privileges: []string{"TEMPORARY", "CONNECT"}},
+			{Username: "adam", Databases: []string{"z_db", "a_db"}},
+		},
+		Groups: []structs.GroupConfig{{Name: "b"}, {Name: "a"}},
+	}
+
+	first, err := orderConfig(config)
+	if err != nil {
+		t.Fatalf("Failed to order config: %v", err)
+	}
+
+	// Reversing the config must not change the order sync applies it in
+	reversed := &structs.Config{
+		Users:  []structs.UserConfig{config.Users[1], config.Users[0]},
+		Groups: []structs.GroupConfig{config.Groups[1], config.Groups[0]},
+	}
+	second, err := orderConfig(reversed)
+	if err != nil {
+		t.Fatalf("Failed to order reversed config: %v", err)
+	}
+
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("Expected identical ordering, got %+v and %+v", first, second)
+	}
+
+	if first.Users[0].Username != "adam" || first.Users[1].Groups[0] != "a" {
+		t.Errorf("Expected users and their lists sorted by name, got %+v", first.Users)
+	}
+
+	// The original config is left untouched
+	if config.Users[0].Groups[0] != "b" {
+		t.Error("Expected original config lists to remain unsorted")
+	}
+}
+
+func TestOrderConfigDefaultGroups(t *testing.T) {
+	config := &structs.Config{
+		Users: []structs.UserConfig{
+			{Username: "app", Enabled: true, Groups: make([]string, 1, 4)},
+			{Username: "former", Enabled: false},
+			{Username: "gone", Enabled: true, Absent: true},
+		},
+		GlobalDefaults: &structs.GlobalDefaultsConfig{Groups: []string{"base_access", "audit"}},
+	}
+	config.Users[0].Groups[0] = "audit"
+
+	ordered, err := orderConfig(config)
+	if err != nil {
+		t.Fatalf("Failed to order config: %v", err)
+	}
+
+	// Groups the user already lists are not added twice
+	if !reflect.DeepEqual(ordered.Users[0].Groups, []string{"audit", "base_access"}) {
+		t.Errorf("Expected the default groups for app, got %v", ordered.Users[0].Groups)
+	}
+	if len(ordered.Users[1].Groups) != 0 || len(ordered.Users[2].Groups) != 0 {
+		t.Errorf("Expected no default groups for disabled and absent users, got %+v", ordered.Users[1:])
+	}
+
+	// The spare capacity of the original list is not written to
+	if groups := config.Users[0].Groups; len(groups) != 1 || groups[:2][1] != "" {
+		t.Errorf("Expected the original config to be left untouched, got %v", groups[:2])
+	}
+}
+
+func TestSyncConfigurationNestedGroups(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	// The child group is declared before its parent
+	config := &structs.Config{
+		Groups: []structs.GroupConfig{
+			{Name: "test_role", MemberOf: []string{"test_group"}, Inherit: true},
+			{Name: "test_group", Inherit: true},
+		},
+	}
+
+	result, err := setup.Manager.SyncConfiguration(config)
+	if err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+	if len(result.Errors) > 0 {
+		t.Fatalf("Expected no sync errors, got %v", result.Errors)
+	}
+
+	info, err := setup.Manager.GetUserInfo("test_role")
+	if err != nil {
+		t.Fatalf("Failed to get role info: %v", err)
+	}
+	if !containsString(info.Groups, "test_group") {
+		t.Errorf("Expected test_role to be a member of test_group, got %v", info.Groups)
+	}
+}
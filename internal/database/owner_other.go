@@ -0,0 +1,11 @@
+//go:build windows || plan9
+
+package database
+
+import "os"
+
+// ownedByCurrentUser reports whether a file is owned by the user running the process. File
+// ownership is not exposed here, so files in the user's own cache directory are trusted.
+func ownedByCurrentUser(info os.FileInfo) bool {
+	return true
+}
@@ -0,0 +1,14 @@
+//go:build !windows && !plan9
+
+package database
+
+import (
+	"os"
+	"syscall"
+)
+
+// ownedByCurrentUser reports whether a file is owned by the user running the process
+func ownedByCurrentUser(info os.FileInfo) bool {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	return ok && int(stat.Uid) == os.Getuid()
+}
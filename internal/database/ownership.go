@@ -0,0 +1,62 @@
+package database
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// ownerMetadataKey, teamMetadataKey and ticketMetadataKey record who is accountable for a
+	// role and why it exists in its comment metadata, so reports can name an owner for every role
+	ownerMetadataKey  = "owner"
+	teamMetadataKey   = "team"
+	ticketMetadataKey = "ticket"
+)
+
+// ownershipMetadata returns the comment metadata for a role's configured ownership,
+// leaving out values that are not set
+func ownershipMetadata(owner, team, ticket string) map[string]string {
+	metadata := make(map[string]string)
+	for key, value := range map[string]string{
+		ownerMetadataKey:  owner,
+		teamMetadataKey:   team,
+		ticketMetadataKey: ticket,
+	} {
+		if value != "" {
+			metadata[key] = value
+		}
+	}
+	return metadata
+}
+
+// SetRoleOwnership records the owner, team and ticket of a role in its comment, leaving the
+// comment untouched when they already match. Values that are not set are ignored, so
+// ownership recorded outside of the configuration is not wiped.
+func (m *Manager) SetRoleOwnership(role, owner, team, ticket string) error {
+	desired := ownershipMetadata(owner, team, ticket)
+	if len(desired) == 0 {
+		return nil
+	}
+
+	comment, err := m.GetRoleComment(role)
+	if err != nil {
+		return err
+	}
+	_, metadata := parseRoleComment(comment)
+	changed := false
+	for key, value := range desired {
+		if metadata[key] != value {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	m.logger.WithFields(logrus.Fields{
+		"role":   role,
+		"owner":  owner,
+		"team":   team,
+		"ticket": ticket,
+	}).Info("Updating role ownership")
+	return m.stampRole(role, "", "ownership_changed", desired)
+}
@@ -0,0 +1,56 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+func TestSyncRecordsOwnership(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	config := &structs.Config{
+		Groups: []structs.GroupConfig{{Name: "test_owned_group", Team: "data"}},
+		Users: []structs.UserConfig{
+			{Username: "test_owned_user", Description: "Billing service", Owner: "jane", Team: "payments", Ticket: "SEC-1", Enabled: true, CanLogin: true},
+		},
+	}
+	if _, err := setup.Manager.SyncConfiguration(config); err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+
+	attributes, err := setup.Manager.GetRoleAttributes("test_owned_user")
+	if err != nil {
+		t.Fatalf("Failed to get attributes: %v", err)
+	}
+	if attributes.Owner != "jane" || attributes.Team != "payments" || attributes.Ticket != "SEC-1" || attributes.Description != "Billing service" {
+		t.Errorf("Expected the ownership recorded at creation, got %+v", attributes)
+	}
+	if attributes, err = setup.Manager.GetRoleAttributes("test_owned_group"); err != nil || attributes.Team != "data" {
+		t.Errorf("Expected the group's team to be recorded, got %+v, %v", attributes, err)
+	}
+
+	// A changed owner is updated, and a ticket that is no longer configured is kept
+	config.Users[0].Owner = "omar"
+	config.Users[0].Ticket = ""
+	report, err := setup.Manager.Diff(config)
+	if err != nil {
+		t.Fatalf("Failed to diff configuration: %v", err)
+	}
+	if len(report.AttributesChanged) != 1 || report.AttributesChanged[0].Attribute != "owner" || report.AttributesChanged[0].Desired != "omar" {
+		t.Errorf("Expected the owner change to be reported, got %+v", report.AttributesChanged)
+	}
+	if _, err := setup.Manager.SyncConfiguration(config); err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+
+	attributes, err = setup.Manager.GetRoleAttributes("test_owned_user")
+	if err != nil {
+		t.Fatalf("Failed to get attributes: %v", err)
+	}
+	if attributes.Owner != "omar" || attributes.Team != "payments" || attributes.Ticket != "SEC-1" {
+		t.Errorf("Expected the owner to be updated and the rest kept, got %+v", attributes)
+	}
+}
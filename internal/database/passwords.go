@@ -0,0 +1,135 @@
+package database
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// scramIterations is the PBKDF2 iteration count of SCRAM-SHA-256 verifiers, PostgreSQL's default
+	scramIterations = 4096
+	// scramSaltLength is the salt length in bytes, as generated by PostgreSQL
+	scramSaltLength = 16
+	// redactedPassword replaces password literals in logged statements when redaction is on
+	redactedPassword = "PASSWORD '********'"
+)
+
+// passwordLiteralPattern matches the password literal of CREATE or ALTER ROLE statements.
+// Verifiers never contain quotes, so the literal ends at the first one.
+var passwordLiteralPattern = regexp.MustCompile(`PASSWORD '[^']*'`)
+
+// SetRedactPasswords makes dry-run output and logged statements show passwords as
+// '********' instead of their SCRAM-SHA-256 verifiers
+func (m *Manager) SetRedactPasswords(redact bool) {
+	m.redactPasswords = redact
+}
+
+// scramSHA256Verifier hashes a password into the SCRAM-SHA-256 verifier PostgreSQL stores in
+// pg_authid, so the server only ever receives the verifier and never the password itself:
+// SCRAM-SHA-256$<iterations>:<salt>$<StoredKey>:<ServerKey>
+func scramSHA256Verifier(password string) (string, error) {
+	salt := make([]byte, scramSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate password salt: %w", err)
+	}
+	return scramSHA256VerifierWithSalt(password, salt, scramIterations)
+}
+
+// scramSHA256VerifierWithSalt computes a SCRAM-SHA-256 verifier (RFC 5802, RFC 7677) for a
+// given salt and iteration count
+func scramSHA256VerifierWithSalt(password string, salt []byte, iterations int) (string, error) {
+	saltedPassword, err := pbkdf2.Key(sha256.New, password, salt, iterations, sha256.Size)
+	if err != nil {
+		return "", fmt.Errorf("failed to derive password key: %w", err)
+	}
+
+	clientKey := scramHMAC(saltedPassword, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+	serverKey := scramHMAC(saltedPassword, "Server Key")
+
+	encode := base64.StdEncoding.EncodeToString
+	return fmt.Sprintf("SCRAM-SHA-256$%d:%s$%s:%s",
+		iterations, encode(salt), encode(storedKey[:]), encode(serverKey)), nil
+}
+
+// scramHMAC computes HMAC-SHA-256 of a message with a key
+func scramHMAC(key []byte, message string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
+
+// loggableQuery returns a statement as dry-run output shows it, with password literals
+// redacted when redaction is on. Log entries are always redacted, see logQuery.
+func (m *Manager) loggableQuery(query string) string {
+	if !m.redactPasswords {
+		return query
+	}
+	return passwordLiteralPattern.ReplaceAllString(query, redactedPassword)
+}
+
+// passwordMatchesVerifier reports whether a password matches a verifier stored in
+// pg_authid, either SCRAM-SHA-256 or the legacy md5 format
+func passwordMatchesVerifier(username, password, verifier string) bool {
+	if strings.HasPrefix(verifier, "md5") {
+		sum := md5.Sum([]byte(password + username))
+		return verifier == "md5"+hex.EncodeToString(sum[:])
+	}
+
+	// SCRAM-SHA-256$<iterations>:<salt>$<StoredKey>:<ServerKey>
+	scheme, rest, ok := strings.Cut(verifier, "$")
+	if !ok || scheme != "SCRAM-SHA-256" {
+		return false
+	}
+	params, _, ok := strings.Cut(rest, "$")
+	if !ok {
+		return false
+	}
+	iterationText, encodedSalt, ok := strings.Cut(params, ":")
+	if !ok {
+		return false
+	}
+	iterations, err := strconv.Atoi(iterationText)
+	if err != nil || iterations <= 0 {
+		return false
+	}
+	salt, err := base64.StdEncoding.DecodeString(encodedSalt)
+	if err != nil {
+		return false
+	}
+
+	expected, err := scramSHA256VerifierWithSalt(password, salt, iterations)
+	return err == nil && hmac.Equal([]byte(expected), []byte(verifier))
+}
+
+// getPasswordVerifier returns the password verifier stored for a role. Reading pg_authid
+// needs superuser, so readable is false when the connected role is not allowed to.
+func (m *Manager) getPasswordVerifier(role string) (verifier string, readable bool, err error) {
+	// Check first rather than fail, since a failed query would abort a sync transaction
+	if err := m.executor().QueryRow("SELECT has_table_privilege('pg_catalog.pg_authid', 'SELECT')").Scan(&readable); err != nil {
+		return "", false, fmt.Errorf("failed to check access to stored passwords: %w", err)
+	}
+	if !readable {
+		return "", false, nil
+	}
+
+	var stored sql.NullString
+	err = m.executor().QueryRow("SELECT rolpassword FROM pg_authid WHERE rolname = $1", role).Scan(&stored)
+	if code, _, ok := sqlState(err); ok && code == "42501" {
+		return "", false, nil
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return "", false, fmt.Errorf("failed to read password of role %s: %w", role, err)
+	}
+	return stored.String, true, nil
+}
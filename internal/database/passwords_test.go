@@ -0,0 +1,117 @@
+package database
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestSCRAMSHA256Verifier(t *testing.T) {
+	// Salt from the RFC 7677 example exchange
+	salt, _ := base64.StdEncoding.DecodeString("W22ZaJ0SNY7soEsUEjb6gQ==")
+
+	verifier, err := scramSHA256VerifierWithSalt("pencil", salt, 4096)
+	if err != nil {
+		t.Fatalf("Failed to compute verifier: %v", err)
+	}
+
+	expected := "SCRAM-SHA-256$4096:W22ZaJ0SNY7soEsUEjb6gQ==$WG5d8oPm3OtcPnkdi4Uo7BkeZkBFzpcXkuLmtbsT4qY=:wfPLwcE6nTWhTAmQ7tl2KeoiWGPlZqQxSrmfPwDl2dU="
+	if verifier != expected {
+		t.Errorf("Expected %s, got %s", expected, verifier)
+	}
+
+	// Every verifier gets a fresh salt
+	first, _ := scramSHA256Verifier("pencil")
+	second, _ := scramSHA256Verifier("pencil")
+	if first == second {
+		t.Error("Expected verifiers of the same password to use different salts")
+	}
+}
+
+func TestBuildCreateUserQueryNeverContainsPassword(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	m := &Manager{logger: logger}
+
+	user := &structs.UserConfig{Username: "app_user", Password: "it's-a-secret", CanLogin: true}
+	query, err := m.buildCreateUserQuery(user)
+	if err != nil {
+		t.Fatalf("Failed to build query: %v", err)
+	}
+
+	if strings.Contains(query, "secret") {
+		t.Errorf("Expected the password not to appear in the query, got %s", query)
+	}
+	if !strings.Contains(query, "WITH PASSWORD 'SCRAM-SHA-256$4096:") {
+		t.Errorf("Expected a SCRAM-SHA-256 verifier, got %s", query)
+	}
+
+	if logged := m.loggableQuery(query); logged != query {
+		t.Errorf("Expected the query to be logged as is without redaction, got %s", logged)
+	}
+	m.SetRedactPasswords(true)
+	if logged := m.loggableQuery(query); strings.Contains(logged, "SCRAM") || !strings.Contains(logged, redactedPassword) {
+		t.Errorf("Expected the verifier to be redacted, got %s", logged)
+	}
+}
+
+func TestDryRunQueryLogsAreRedacted(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	m := &Manager{logger: logger, dryRun: true}
+
+	// Without password redaction the dry-run preview keeps the verifier, but the log does not
+	m.statements = []structs.PlannedStatement{}
+	m.dryRunQuery("ALTER ROLE app_user PASSWORD 'SCRAM-SHA-256$4096:abc'")
+	if !strings.Contains(m.statements[0].Query, "SCRAM") {
+		t.Errorf("Expected the preview to show the verifier, got %s", m.statements[0].Query)
+	}
+
+	m.statements = nil
+	m.dryRunQuery("ALTER ROLE app_user PASSWORD 'SCRAM-SHA-256$4096:abc'")
+	for _, entry := range hook.AllEntries() {
+		if query, _ := entry.Data["query"].(string); strings.Contains(query, "SCRAM") {
+			t.Errorf("Expected the logged query to be redacted, got %s", query)
+		}
+	}
+}
+
+func TestPasswordMatchesVerifier(t *testing.T) {
+	scram, err := scramSHA256Verifier("pencil")
+	if err != nil {
+		t.Fatalf("Failed to compute verifier: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		verifier string
+		expected bool
+	}{
+		{"scram match", "pencil", scram, true},
+		{"scram mismatch", "pen", scram, false},
+		// md5 of "pencil" + "app_user"
+		{"md5 match", "pencil", "md5" + md5Hex("pencilapp_user"), true},
+		{"md5 mismatch", "pen", "md5" + md5Hex("pencilapp_user"), false},
+		{"no password", "pencil", "", false},
+		{"malformed", "pencil", "SCRAM-SHA-256$x:abc$def:ghi", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if matches := passwordMatchesVerifier("app_user", tt.password, tt.verifier); matches != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, matches)
+			}
+		})
+	}
+}
+
+func md5Hex(value string) string {
+	sum := md5.Sum([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
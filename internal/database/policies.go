@@ -0,0 +1,289 @@
+package database
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+)
+
+// policyTemplateData is the data available to policy name and expression templates
+type policyTemplateData struct {
+	Role  string
+	Roles []string
+	Table string
+}
+
+// policyFuncs are the functions available to policy templates for quoting values, like the
+// functions of hook templates
+var policyFuncs = template.FuncMap{
+	"ident":   pq.QuoteIdentifier,
+	"literal": pq.QuoteLiteral,
+}
+
+// validPolicyCommands lists the commands a row level security policy can apply to
+var validPolicyCommands = map[string]bool{
+	"ALL":    true,
+	"SELECT": true,
+	"INSERT": true,
+	"UPDATE": true,
+	"DELETE": true,
+}
+
+// policyName returns the name a policy is reported and checkpointed under, with its database
+// when it names one, as policies of the same name in different databases are different
+// policies
+func policyName(policy *structs.PolicyConfig) string {
+	if policy.Database == "" {
+		return policy.Name
+	}
+	return fmt.Sprintf("%s (database %s)", policy.Name, policy.Database)
+}
+
+// ApplyPolicy attaches the configured roles to a row level security policy,
+// creating the policy from its templates when it does not exist yet, connected to the
+// database the table belongs to
+func (m *Manager) ApplyPolicy(policy *structs.PolicyConfig) error {
+	if m.otherDatabase(policy.Database) {
+		return m.InDatabase(policy.Database, func(db *Manager) error { return db.ApplyPolicy(policy) })
+	}
+
+	policies, err := expandPolicy(policy)
+	if err != nil {
+		return err
+	}
+
+	for i := range policies {
+		if err := m.applyPolicy(&policies[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applyPolicy applies a single, already expanded policy
+func (m *Manager) applyPolicy(policy *structs.PolicyConfig) error {
+	m.logger.WithFields(logrus.Fields{
+		"policy": policy.Name,
+		"table":  policy.Table,
+		"roles":  policy.Roles,
+	}).Info("Applying row level security policy")
+
+	schema, table := splitQualifiedName(policy.Table)
+	tableIdent := m.quoteIdentifier(schema) + "." + m.quoteIdentifier(table)
+	needs := m.elevated.table(policy.Table)
+
+	if policy.EnableRLS {
+		enabled, err := m.rowSecurityEnabled(schema, table)
+		if err != nil {
+			return fmt.Errorf("failed to look up row level security on %s: %w", policy.Table, err)
+		}
+		if !enabled {
+			query := fmt.Sprintf("ALTER TABLE %s ENABLE ROW LEVEL SECURITY", tableIdent)
+			if err := m.executeUnlessElevated(query, needs); err != nil {
+				return fmt.Errorf("failed to enable row level security on %s: %w", policy.Table, err)
+			}
+		}
+	}
+
+	existingRoles, exists, err := m.getPolicyRoles(schema, table, policy.Name)
+	if err != nil {
+		return fmt.Errorf("failed to look up policy %s on %s: %w", policy.Name, policy.Table, err)
+	}
+
+	if !exists {
+		if policy.Using == "" && policy.WithCheck == "" {
+			return fmt.Errorf("policy %s does not exist on %s and no using or with_check expression is configured to create it", policy.Name, policy.Table)
+		}
+
+		query := m.buildCreatePolicyQuery(policy, tableIdent)
+		if err := m.executeUnlessElevated(query, needs); err != nil {
+			return fmt.Errorf("failed to create policy %s on %s: %w", policy.Name, policy.Table, err)
+		}
+
+		m.logger.WithField("policy", policy.Name).Info("Policy created successfully")
+		return nil
+	}
+
+	// A policy granted to PUBLIC already applies to every role
+	if containsString(existingRoles, "public") {
+		m.logger.WithField("policy", policy.Name).Info("Policy applies to PUBLIC, skipping role attachment")
+		return nil
+	}
+
+	roles := existingRoles
+	for _, role := range policy.Roles {
+		if !containsString(roles, role) {
+			roles = append(roles, role)
+		}
+	}
+
+	if len(roles) == len(existingRoles) {
+		m.logger.WithField("policy", policy.Name).Info("Roles already attached to policy, skipping")
+		return nil
+	}
+
+	query := fmt.Sprintf("ALTER POLICY %s ON %s TO %s",
+		m.quoteIdentifier(policy.Name), tableIdent, m.quoteIdentifierList(roles))
+	if err := m.executeUnlessElevated(query, needs); err != nil {
+		return fmt.Errorf("failed to attach roles to policy %s on %s: %w", policy.Name, policy.Table, err)
+	}
+
+	m.logger.WithField("policy", policy.Name).Info("Roles attached to policy successfully")
+	return nil
+}
+
+// buildCreatePolicyQuery builds the CREATE POLICY statement for a policy
+func (m *Manager) buildCreatePolicyQuery(policy *structs.PolicyConfig, tableIdent string) string {
+	query := fmt.Sprintf("CREATE POLICY %s ON %s", m.quoteIdentifier(policy.Name), tableIdent)
+
+	if policy.Command != "" {
+		query += " FOR " + strings.ToUpper(policy.Command)
+	}
+
+	query += " TO " + m.quoteIdentifierList(policy.Roles)
+
+	if policy.Using != "" {
+		query += fmt.Sprintf(" USING (%s)", policy.Using)
+	}
+
+	if policy.WithCheck != "" {
+		query += fmt.Sprintf(" WITH CHECK (%s)", policy.WithCheck)
+	}
+
+	return query
+}
+
+// rowSecurityEnabled reports whether row level security is enabled on a table. A table that
+// does not exist is reported as not enabled, so enabling it fails with the usual error.
+func (m *Manager) rowSecurityEnabled(schema, table string) (bool, error) {
+	query := `
+		SELECT c.relrowsecurity
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1 AND c.relname = $2`
+
+	var enabled bool
+	err := m.executor().QueryRow(query, schema, table).Scan(&enabled)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return enabled, err
+}
+
+// getPolicyRoles returns the roles a policy applies to and whether the policy exists
+func (m *Manager) getPolicyRoles(schema, table, name string) ([]string, bool, error) {
+	query := `
+		SELECT roles::text[]
+		FROM pg_policies
+		WHERE schemaname = $1 AND tablename = $2 AND policyname = $3`
+
+	var roles []string
+	err := m.executor().QueryRow(query, schema, table, name).Scan(pq.Array(&roles))
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return roles, true, nil
+}
+
+// expandPolicy validates a policy config and renders its templates into the
+// concrete policies to apply, one per role when PerRole is set
+func expandPolicy(policy *structs.PolicyConfig) ([]structs.PolicyConfig, error) {
+	if policy.Name == "" {
+		return nil, fmt.Errorf("policy name is required")
+	}
+	if policy.Table == "" {
+		return nil, fmt.Errorf("policy %s: table is required", policy.Name)
+	}
+	if len(policy.Roles) == 0 {
+		return nil, fmt.Errorf("policy %s: at least one role is required", policy.Name)
+	}
+	if policy.Command != "" && !validPolicyCommands[strings.ToUpper(policy.Command)] {
+		return nil, fmt.Errorf("policy %s: invalid command %s (must be ALL, SELECT, INSERT, UPDATE or DELETE)", policy.Name, policy.Command)
+	}
+
+	if !policy.PerRole {
+		rendered, err := renderPolicy(policy, policyTemplateData{Roles: policy.Roles, Table: policy.Table}, policy.Roles)
+		if err != nil {
+			return nil, err
+		}
+		return []structs.PolicyConfig{*rendered}, nil
+	}
+
+	var policies []structs.PolicyConfig
+	for _, role := range policy.Roles {
+		data := policyTemplateData{Role: role, Roles: []string{role}, Table: policy.Table}
+		rendered, err := renderPolicy(policy, data, []string{role})
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, *rendered)
+	}
+
+	return policies, nil
+}
+
+// renderPolicy renders the templated fields of a policy for the given roles
+func renderPolicy(policy *structs.PolicyConfig, data policyTemplateData, roles []string) (*structs.PolicyConfig, error) {
+	rendered := *policy
+	rendered.Roles = roles
+
+	fields := []*string{&rendered.Name, &rendered.Using, &rendered.WithCheck}
+	for _, field := range fields {
+		value, err := renderTemplate(*field, data)
+		if err != nil {
+			return nil, fmt.Errorf("policy %s: %w", policy.Name, err)
+		}
+		*field = value
+	}
+
+	return &rendered, nil
+}
+
+// renderTemplate renders a Go text/template string with the given data and the ident and
+// literal quoting functions
+func renderTemplate(text string, data interface{}) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	tmpl, err := template.New("policy").Funcs(policyFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse template %q: %w", text, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render template %q: %w", text, err)
+	}
+
+	return buf.String(), nil
+}
+
+// splitQualifiedName splits a possibly schema-qualified name, defaulting to the public schema
+func splitQualifiedName(name string) (string, string) {
+	if idx := strings.Index(name, "."); idx >= 0 {
+		return name[:idx], name[idx+1:]
+	}
+	return "public", name
+}
+
+// containsString reports whether a slice contains the given value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+func TestExpandPolicy(t *testing.T) {
+	policy := &structs.PolicyConfig{
+		Name:    "{{ .Role }}_isolation",
+		Table:   "public.orders",
+		Roles:   []string{"tenant_a", "tenant_b"},
+		Using:   "tenant_id = {{ literal .Role }}",
+		PerRole: true,
+	}
+
+	policies, err := expandPolicy(policy)
+	if err != nil {
+		t.Fatalf("Failed to expand policy: %v", err)
+	}
+
+	if len(policies) != 2 {
+		t.Fatalf("Expected 2 policies, got %d", len(policies))
+	}
+
+	if policies[0].Name != "tenant_a_isolation" {
+		t.Errorf("Expected name 'tenant_a_isolation', got '%s'", policies[0].Name)
+	}
+
+	if policies[1].Using != "tenant_id = 'tenant_b'" {
+		t.Errorf("Expected rendered using expression, got '%s'", policies[1].Using)
+	}
+
+	if len(policies[1].Roles) != 1 || policies[1].Roles[0] != "tenant_b" {
+		t.Errorf("Expected per-role policy to target only tenant_b, got %v", policies[1].Roles)
+	}
+}
+
+func TestRenderTemplateQuotes(t *testing.T) {
+	data := policyTemplateData{Role: "o'brien", Table: "public.orders"}
+
+	rendered, err := renderTemplate("owner = {{ literal .Role }} AND pg_has_role({{ ident .Role }}, 'USAGE')", data)
+	if err != nil {
+		t.Fatalf("Failed to render template: %v", err)
+	}
+	if expected := `owner = 'o''brien' AND pg_has_role("o'brien", 'USAGE')`; rendered != expected {
+		t.Errorf("Expected %s, got %s", expected, rendered)
+	}
+}
+
+func TestPolicyName(t *testing.T) {
+	if name := policyName(&structs.PolicyConfig{Name: "tenant_isolation"}); name != "tenant_isolation" {
+		t.Errorf("Expected the bare name in the connected database, got %s", name)
+	}
+	if name := policyName(&structs.PolicyConfig{Name: "tenant_isolation", Database: "reports"}); name != "tenant_isolation (database reports)" {
+		t.Errorf("Expected the name with its database, got %s", name)
+	}
+}
+
+func TestExpandPolicyValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy structs.PolicyConfig
+	}{
+		{name: "missing name", policy: structs.PolicyConfig{Table: "orders", Roles: []string{"r"}}},
+		{name: "missing table", policy: structs.PolicyConfig{Name: "p", Roles: []string{"r"}}},
+		{name: "missing roles", policy: structs.PolicyConfig{Name: "p", Table: "orders"}},
+		{name: "invalid command", policy: structs.PolicyConfig{Name: "p", Table: "orders", Roles: []string{"r"}, Command: "TRUNCATE"}},
+		{name: "invalid template", policy: structs.PolicyConfig{Name: "{{ .Missing }}", Table: "orders", Roles: []string{"r"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := expandPolicy(&tt.policy); err == nil {
+				t.Error("Expected validation error")
+			}
+		})
+	}
+}
+
+func TestApplyPolicy(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	if _, err := setup.Manager.db.Exec("CREATE TABLE orders (id serial PRIMARY KEY, tenant_id text)"); err != nil {
+		t.Fatalf("Failed to create test table: %v", err)
+	}
+
+	for _, name := range []string{"test_group", "test_role"} {
+		if err := setup.Manager.CreateGroup(&structs.GroupConfig{Name: name, Inherit: true}); err != nil {
+			t.Fatalf("Failed to create group %s: %v", name, err)
+		}
+	}
+
+	// Create the policy from its template
+	policy := &structs.PolicyConfig{
+		Name:      "tenant_isolation",
+		Table:     "orders",
+		Roles:     []string{"test_group"},
+		Command:   "select",
+		Using:     "tenant_id = current_user",
+		EnableRLS: true,
+	}
+	if err := setup.Manager.ApplyPolicy(policy); err != nil {
+		t.Fatalf("Failed to create policy: %v", err)
+	}
+
+	// Attach another role to the existing policy
+	policy.Roles = []string{"test_role"}
+	if err := setup.Manager.ApplyPolicy(policy); err != nil {
+		t.Fatalf("Failed to attach role to policy: %v", err)
+	}
+
+	roles, exists, err := setup.Manager.getPolicyRoles("public", "orders", "tenant_isolation")
+	if err != nil {
+		t.Fatalf("Failed to get policy roles: %v", err)
+	}
+	if !exists {
+		t.Fatal("Expected policy to exist")
+	}
+	if !containsString(roles, "test_group") || !containsString(roles, "test_role") {
+		t.Errorf("Expected policy to apply to test_group and test_role, got %v", roles)
+	}
+
+	if _, err := setup.Manager.db.Exec("DROP TABLE orders"); err != nil {
+		t.Logf("Error dropping test table: %v", err)
+	}
+}
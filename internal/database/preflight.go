@@ -0,0 +1,303 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+// adminOptionVersion is the first server version (16) where granting role membership
+// requires ADMIN OPTION on the group rather than just CREATEROLE
+const adminOptionVersion = 160000
+
+// PreflightError lists the privileges the connected role is missing for a sync
+type PreflightError struct {
+	Role    string
+	Missing []string
+}
+
+// Error implements the error interface
+func (e *PreflightError) Error() string {
+	return fmt.Sprintf("%s is missing %d privilege(s) needed for sync:\n  - %s", e.Role, len(e.Missing), strings.Join(e.Missing, "\n  - "))
+}
+
+// SetSkipPreflight disables the privilege check that runs before sync changes anything
+func (m *Manager) SetSkipPreflight(skip bool) {
+	m.skipPreflight = skip
+}
+
+// missingPrivilege is a privilege the connected role lacks for a sync. Those that only some
+// statements need name the group, database, schema or table, so the statements can be left
+// to a role with elevated access instead.
+type missingPrivilege struct {
+	description string
+	group       string // Group the role has no ADMIN OPTION on
+	database    string // Database the role cannot grant privileges on
+	schema      string // Extension schema the role cannot grant privileges on
+	table       string // Policy table the role does not own
+}
+
+// CheckSyncPrivileges checks that the connected role holds every privilege the statements
+// of a sync need: CREATEROLE, ADMIN OPTION on existing groups (PostgreSQL 16+), grant options
+// on databases and extension schemas, and ownership of policy tables. Missing privileges
+// are reported together as a *PreflightError
+func (m *Manager) CheckSyncPrivileges(config *structs.Config) error {
+	role, missing, err := m.missingSyncPrivileges(config)
+	if err != nil {
+		return err
+	}
+	return preflightError(role, missing)
+}
+
+// preflightError reports missing privileges as a *PreflightError, nil when there are none
+func preflightError(role string, missing []missingPrivilege) error {
+	if len(missing) == 0 {
+		return nil
+	}
+	descriptions := make([]string, len(missing))
+	for i, privilege := range missing {
+		descriptions[i] = privilege.description
+	}
+	return &PreflightError{Role: role, Missing: descriptions}
+}
+
+// missingSyncPrivileges returns the connected role and the privileges it lacks for a sync
+func (m *Manager) missingSyncPrivileges(config *structs.Config) (string, []missingPrivilege, error) {
+	var role string
+	var superuser, createRole bool
+	var version int
+	err := m.executor().QueryRow("SELECT current_user, rolsuper, rolcreaterole, current_setting('server_version_num')::int FROM pg_roles WHERE rolname = current_user").
+		Scan(&role, &superuser, &createRole, &version)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read connected role attributes: %w", err)
+	}
+	if superuser {
+		return role, nil, nil
+	}
+
+	var missing []missingPrivilege
+	if !createRole && (len(config.Users) > 0 || len(config.Groups) > 0) {
+		missing = append(missing, missingPrivilege{description: "CREATEROLE"})
+	}
+
+	if version >= adminOptionVersion {
+		for _, group := range preflightMembershipGroups(config) {
+			var exists, admin bool
+			err := m.executor().QueryRow("SELECT true, pg_has_role(current_user, oid, 'MEMBER WITH ADMIN OPTION') FROM pg_roles WHERE rolname = $1", group).
+				Scan(&exists, &admin)
+			if err != nil && err != sql.ErrNoRows {
+				return "", nil, fmt.Errorf("failed to check admin option on %s: %w", group, err)
+			}
+			// Groups created by this sync are granted to their creator with ADMIN OPTION, and
+			// with automatic admin grants the connected role grants itself the others
+			if exists && !admin && !m.autoGrantAdmin {
+				missing = append(missing, missingPrivilege{description: fmt.Sprintf("ADMIN OPTION on role %s (or use --auto-grant-admin)", group), group: group})
+			}
+		}
+	}
+
+	for _, db := range preflightDatabases(config) {
+		var grantable sql.NullBool
+		err := m.executor().QueryRow("SELECT has_database_privilege(oid, 'CONNECT WITH GRANT OPTION') FROM pg_database WHERE datname = $1", db).
+			Scan(&grantable)
+		if err == sql.ErrNoRows {
+			missing = append(missing, missingPrivilege{description: fmt.Sprintf("database %s (does not exist)", db)})
+			continue
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to check grant option on database %s: %w", db, err)
+		}
+		if !grantable.Bool {
+			missing = append(missing, missingPrivilege{description: fmt.Sprintf("grant option on database %s", db), database: db})
+		}
+	}
+
+	// Schemas and tables in other databases are checked there, and what is missing there is
+	// never deferred because the elevated script runs on the connected database
+	for _, grant := range preflightExtensionSchemas(config) {
+		other := m.otherDatabase(grant.Database)
+		err := m.InDatabase(grant.Database, func(db *Manager) error {
+			schema := grant.Schema
+			if schema == "" {
+				var err error
+				if schema, err = db.getExtensionSchema(grant.Extension); err != nil {
+					missing = append(missing, missingPrivilege{description: err.Error()})
+					return nil
+				}
+			}
+
+			var grantable bool
+			err := db.executor().QueryRow("SELECT has_schema_privilege(oid, 'USAGE WITH GRANT OPTION') FROM pg_namespace WHERE nspname = $1", schema).
+				Scan(&grantable)
+			if err == sql.ErrNoRows {
+				missing = append(missing, missingPrivilege{description: fmt.Sprintf("schema %s%s (does not exist)", schema, inOtherDatabase(grant.Database, other))})
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to check grant option on schema %s: %w", schema, err)
+			}
+			if !grantable {
+				privilege := missingPrivilege{description: fmt.Sprintf("grant option on schema %s%s", schema, inOtherDatabase(grant.Database, other))}
+				if !other {
+					privilege.schema = schema
+				}
+				missing = append(missing, privilege)
+			}
+			return nil
+		})
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	for _, policyTable := range preflightPolicyTables(config) {
+		table := policyTable.table
+		other := m.otherDatabase(policyTable.database)
+		err := m.InDatabase(policyTable.database, func(db *Manager) error {
+			schema, name := splitQualifiedName(table)
+			var owner bool
+			err := db.executor().QueryRow(`
+				SELECT pg_has_role(current_user, c.relowner, 'USAGE')
+				FROM pg_class c
+				JOIN pg_namespace n ON n.oid = c.relnamespace
+				WHERE n.nspname = $1 AND c.relname = $2`, schema, name).Scan(&owner)
+			if err == sql.ErrNoRows {
+				missing = append(missing, missingPrivilege{description: fmt.Sprintf("table %s%s (does not exist)", table, inOtherDatabase(policyTable.database, other))})
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to check ownership of table %s: %w", table, err)
+			}
+			if !owner {
+				privilege := missingPrivilege{description: fmt.Sprintf("ownership of table %s%s", table, inOtherDatabase(policyTable.database, other))}
+				if !other {
+					privilege.table = table
+				}
+				missing = append(missing, privilege)
+			}
+			return nil
+		})
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	m.logger.WithFields(logrus.Fields{
+		"role":    role,
+		"missing": len(missing),
+	}).Debug("Checked sync privileges")
+
+	return role, missing, nil
+}
+
+// preflightMembershipGroups returns the groups a sync grants membership in
+func preflightMembershipGroups(config *structs.Config) []string {
+	var groups []string
+	for i := range config.Users {
+		user := &config.Users[i]
+		if user.Absent {
+			continue
+		}
+		groups = append(groups, configuredGroups(user)...)
+		if user.HasAuthMethod(structs.AuthMethodIAM) {
+			groups = append(groups, "rds_iam")
+		}
+	}
+	for _, group := range config.Groups {
+		groups = append(groups, group.MemberOf...)
+	}
+	return sortedUniqueStrings(groups)
+}
+
+// preflightDatabases returns the databases a sync grants privileges on
+func preflightDatabases(config *structs.Config) []string {
+	var databases []string
+	for _, user := range config.Users {
+		if !user.Absent && len(user.Privileges) > 0 {
+			databases = append(databases, user.Databases...)
+		}
+	}
+	for _, group := range config.Groups {
+		if len(group.Privileges) > 0 {
+			databases = append(databases, group.Databases...)
+		}
+	}
+	return sortedUniqueStrings(databases)
+}
+
+// preflightExtensionSchemas returns the extension schema grants of a sync, one per extension and schema
+func preflightExtensionSchemas(config *structs.Config) []structs.ExtensionSchemaGrant {
+	seen := make(map[string]bool)
+	var grants []structs.ExtensionSchemaGrant
+	add := func(schemas []structs.ExtensionSchemaGrant) {
+		for _, grant := range schemas {
+			key := grant.Database + "/" + grant.Extension + "/" + grant.Schema
+			if !seen[key] {
+				seen[key] = true
+				grants = append(grants, grant)
+			}
+		}
+	}
+	for _, user := range config.Users {
+		if !user.Absent {
+			add(user.ExtensionSchemas)
+		}
+	}
+	for _, group := range config.Groups {
+		add(group.ExtensionSchemas)
+	}
+	return grants
+}
+
+// preflightTable is a table in a database of the cluster, the connected one when database is empty
+type preflightTable struct {
+	database string
+	table    string
+}
+
+// preflightPolicyTables returns the tables a sync creates row level security policies on,
+// ordered by database and table
+func preflightPolicyTables(config *structs.Config) []preflightTable {
+	seen := make(map[preflightTable]bool)
+	tables := []preflightTable{}
+	for _, policy := range config.Policies {
+		table := preflightTable{database: policy.Database, table: policy.Table}
+		if !seen[table] {
+			seen[table] = true
+			tables = append(tables, table)
+		}
+	}
+	sort.Slice(tables, func(i, j int) bool {
+		if tables[i].database != tables[j].database {
+			return tables[i].database < tables[j].database
+		}
+		return tables[i].table < tables[j].table
+	})
+	return tables
+}
+
+// inOtherDatabase names the database of a missing privilege when it is not the connected one
+func inOtherDatabase(database string, other bool) string {
+	if !other {
+		return ""
+	}
+	return " in database " + database
+}
+
+// sortedUniqueStrings returns the distinct values of a slice in sorted order
+func sortedUniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := []string{}
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
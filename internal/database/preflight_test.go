@@ -0,0 +1,67 @@
+package database
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+func TestPreflightTargets(t *testing.T) {
+	config := &structs.Config{
+		Users: []structs.UserConfig{
+			{Username: "app_user", Groups: []string{"app_group"}, AuthMethod: "iam", Privileges: []string{"CONNECT"}, Databases: []string{"app_db"}},
+			{Username: "reader", Groups: []string{"read_only", "app_group"}, Databases: []string{"reports_db"}},
+			{Username: "old_user", Groups: []string{"legacy"}, Privileges: []string{"CONNECT"}, Databases: []string{"old_db"}, Absent: true},
+		},
+		Groups: []structs.GroupConfig{
+			{Name: "app_group", MemberOf: []string{"read_only"}, Privileges: []string{"CONNECT"}, Databases: []string{"app_db", "analytics_db"}},
+		},
+		Policies: []structs.PolicyConfig{
+			{Name: "p1", Table: "orders"},
+			{Name: "p2", Table: "orders"},
+			{Name: "p3", Table: "orders", Database: "reports_db"},
+		},
+	}
+
+	// Absent users are dropped, so their groups and databases are not needed
+	if groups := preflightMembershipGroups(config); !reflect.DeepEqual(groups, []string{"app_group", "rds_iam", "read_only"}) {
+		t.Errorf("Unexpected membership groups: %v", groups)
+	}
+
+	// Databases are only needed where privileges are granted on them
+	if databases := preflightDatabases(config); !reflect.DeepEqual(databases, []string{"analytics_db", "app_db"}) {
+		t.Errorf("Unexpected databases: %v", databases)
+	}
+
+	// Tables of the same name in different databases are different tables
+	expected := []preflightTable{{table: "orders"}, {database: "reports_db", table: "orders"}}
+	if tables := preflightPolicyTables(config); !reflect.DeepEqual(tables, expected) {
+		t.Errorf("Unexpected policy tables: %v", tables)
+	}
+}
+
+func TestPreflightErrorListsMissingPrivileges(t *testing.T) {
+	err := &PreflightError{Role: "deployer", Missing: []string{"CREATEROLE", "grant option on database app_db"}}
+
+	message := err.Error()
+	if !strings.Contains(message, "deployer is missing 2 privilege(s)") || !strings.Contains(message, "  - grant option on database app_db") {
+		t.Errorf("Unexpected error message: %s", message)
+	}
+}
+
+func TestCheckSyncPrivilegesAsSuperuser(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+
+	config := &structs.Config{
+		Users: []structs.UserConfig{
+			{Username: "preflight_user", Privileges: []string{"CONNECT"}, Databases: []string{"testdb"}, Enabled: true, CanLogin: true},
+		},
+	}
+
+	if err := setup.Manager.CheckSyncPrivileges(config); err != nil {
+		t.Errorf("Expected the test superuser to pass the preflight check, got: %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+// databasePrivilegeAliases expands configured database privileges to the privilege
+// types PostgreSQL records in database ACLs
+var databasePrivilegeAliases = map[string][]string{
+	"CONNECT":        {"CONNECT"},
+	"CREATE":         {"CREATE"},
+	"TEMPORARY":      {"TEMPORARY"},
+	"TEMP":           {"TEMPORARY"},
+	"ALL":            {"CONNECT", "CREATE", "TEMPORARY"},
+	"ALL PRIVILEGES": {"CONNECT", "CREATE", "TEMPORARY"},
+}
+
+// SetExactPrivileges controls whether sync revokes database privileges that a user or
+// group holds but its configuration no longer lists. When disabled, extra privileges are only reported.
+func (m *Manager) SetExactPrivileges(exact bool) {
+	m.exactPrivileges = exact
+}
+
+// GetDatabasePrivileges returns the database privileges explicitly granted to a role,
+// excluding databases the role owns
+func (m *Manager) GetDatabasePrivileges(role string) ([]structs.PrivilegeGrant, error) {
+	query := `
+		SELECT d.datname, a.privilege_type
+		FROM pg_database d
+		CROSS JOIN LATERAL aclexplode(d.datacl) a
+		JOIN pg_roles r ON r.oid = a.grantee
+		WHERE r.rolname = $1 AND d.datdba <> r.oid
+		ORDER BY d.datname, a.privilege_type`
+
+	rows, err := m.executor().Query(query, role)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database privileges of %s: %w", role, err)
+	}
+	defer rows.Close()
+
+	grants := []structs.PrivilegeGrant{}
+	for rows.Next() {
+		grant := structs.PrivilegeGrant{Target: role}
+		if err := rows.Scan(&grant.Database, &grant.Privilege); err != nil {
+			return nil, err
+		}
+		grants = append(grants, grant)
+	}
+
+	return grants, rows.Err()
+}
+
+// missingPrivilegeDatabases returns the databases a role lacks any of the configured
+// privileges on, so sync only grants on the databases whose privileges changed
+func missingPrivilegeDatabases(privileges, databases []string, current []structs.PrivilegeGrant) []string {
+	held := make(map[string]bool, len(current))
+	for _, grant := range current {
+		held[grant.Database+"/"+grant.Privilege] = true
+	}
+
+	var missing []string
+	for _, db := range databases {
+		for key := range desiredDatabasePrivileges(privileges, []string{db}) {
+			if !held[key] {
+				missing = append(missing, db)
+				break
+			}
+		}
+	}
+	return missing
+}
+
+// reconcilePrivileges compares a role's live database privileges, as looked up before sync
+// granted the missing ones, with the configured ones, revoking the extras when exact
+// privileges are enabled and reporting them otherwise
+func (m *Manager) reconcilePrivileges(target string, privileges []string, databases []string, current []structs.PrivilegeGrant, result *structs.SyncResult) error {
+	wanted := desiredDatabasePrivileges(privileges, databases)
+
+	for _, grant := range current {
+		if wanted[grant.Database+"/"+grant.Privilege] {
+			continue
+		}
+
+		if !m.exactPrivileges {
+			m.logger.WithFields(logrus.Fields{
+				"target":    target,
+				"privilege": grant.Privilege,
+				"database":  grant.Database,
+			}).Debug("Privilege is not in configuration")
+			result.PrivilegesExtra = append(result.PrivilegesExtra, grant)
+			result.Warn(target, fmt.Sprintf("%s on database %s is not in the configuration, left in place (use --exact-privileges to revoke it)", grant.Privilege, grant.Database))
+			continue
+		}
+
+		if err := m.RevokePrivileges(target, []string{grant.Privilege}, []string{grant.Database}); err != nil {
+			return err
+		}
+		result.PrivilegesRevoked = append(result.PrivilegesRevoked, grant)
+	}
+
+	return nil
+}
+
+// desiredDatabasePrivileges returns the set of "database/PRIVILEGE" pairs a configuration grants
+func desiredDatabasePrivileges(privileges []string, databases []string) map[string]bool {
+	wanted := make(map[string]bool)
+	for _, db := range databases {
+		for _, priv := range privileges {
+			expanded, ok := databasePrivilegeAliases[strings.ToUpper(strings.TrimSpace(priv))]
+			if !ok {
+				expanded = []string{strings.ToUpper(priv)}
+			}
+			for _, p := range expanded {
+				wanted[db+"/"+p] = true
+			}
+		}
+	}
+	return wanted
+}
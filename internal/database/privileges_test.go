@@ -1,9 +1,11 @@
 package database
 
 import (
+	"context"
 	"testing"
 
 	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
 )
 
 const (
@@ -11,7 +13,7 @@ const (
 )
 
 func TestGrantPrivileges(t *testing.T) {
-	setup := SetupFlexibleTestDatabase(t)
+	setup := SetupTestDatabase(t)
 	defer setup.Cleanup(t)
 	defer setup.ResetDatabase(t)
 
@@ -46,7 +48,7 @@ func TestGrantPrivileges(t *testing.T) {
 }
 
 func TestRevokePrivileges(t *testing.T) {
-	setup := SetupFlexibleTestDatabase(t)
+	setup := SetupTestDatabase(t)
 	defer setup.Cleanup(t)
 	defer setup.ResetDatabase(t)
 
@@ -87,7 +89,7 @@ func TestRevokePrivileges(t *testing.T) {
 }
 
 func TestGrantPrivilegesToGroup(t *testing.T) {
-	setup := SetupFlexibleTestDatabase(t)
+	setup := SetupTestDatabase(t)
 	defer setup.Cleanup(t)
 	defer setup.ResetDatabase(t)
 
@@ -119,7 +121,7 @@ func TestGrantPrivilegesToGroup(t *testing.T) {
 }
 
 func TestSyncConfiguration(t *testing.T) {
-	setup := SetupFlexibleTestDatabase(t)
+	setup := SetupTestDatabase(t)
 	defer setup.Cleanup(t)
 	defer setup.ResetDatabase(t)
 
@@ -270,7 +272,7 @@ func verifyUserMemberships(t *testing.T, setup DatabaseTestSetup) {
 }
 
 func TestSyncConfigurationWithErrors(t *testing.T) {
-	setup := SetupFlexibleTestDatabase(t)
+	setup := SetupTestDatabase(t)
 	defer setup.Cleanup(t)
 	defer setup.ResetDatabase(t)
 
@@ -317,7 +319,7 @@ func TestSyncConfigurationWithErrors(t *testing.T) {
 }
 
 func TestDryRunMode(t *testing.T) {
-	setup := SetupFlexibleTestDatabase(t)
+	setup := SetupTestDatabase(t)
 	defer setup.Cleanup(t)
 
 	// Create a dry-run manager
@@ -370,3 +372,146 @@ func TestDryRunMode(t *testing.T) {
 		t.Fatal("Group should not exist after dry-run operation")
 	}
 }
+
+func TestDesiredDatabasePrivileges(t *testing.T) {
+	wanted := desiredDatabasePrivileges([]string{"connect", "TEMP"}, []string{"app", "reports"})
+
+	for _, expected := range []string{"app/CONNECT", "app/TEMPORARY", "reports/CONNECT", "reports/TEMPORARY"} {
+		if !wanted[expected] {
+			t.Errorf("Expected %s to be desired, got %v", expected, wanted)
+		}
+	}
+	if len(wanted) != 4 {
+		t.Errorf("Expected 4 desired privileges, got %v", wanted)
+	}
+
+	all := desiredDatabasePrivileges([]string{"ALL PRIVILEGES"}, []string{"app"})
+	if !all["app/CONNECT"] || !all["app/CREATE"] || !all["app/TEMPORARY"] {
+		t.Errorf("Expected ALL PRIVILEGES to expand, got %v", all)
+	}
+}
+
+func TestMissingPrivilegeDatabases(t *testing.T) {
+	current := []structs.PrivilegeGrant{
+		{Database: "app", Privilege: "CONNECT"},
+		{Database: "app", Privilege: "TEMPORARY"},
+		{Database: "reports", Privilege: "CONNECT"},
+	}
+
+	missing := missingPrivilegeDatabases([]string{"connect", "TEMP"}, []string{"app", "reports", "audit"}, current)
+	if len(missing) != 2 || missing[0] != "reports" || missing[1] != "audit" {
+		t.Errorf("Expected reports and audit to be missing privileges, got %v", missing)
+	}
+
+	if missing := missingPrivilegeDatabases([]string{"CONNECT"}, []string{"app"}, current); len(missing) != 0 {
+		t.Errorf("Expected no databases to be missing privileges, got %v", missing)
+	}
+}
+
+func TestPrivilegeList(t *testing.T) {
+	tests := []struct {
+		privileges []string
+		expected   string
+	}{
+		{[]string{"CONNECT"}, "CONNECT"},
+		{[]string{"CONNECT", "TEMPORARY"}, "CONNECT, TEMPORARY"},
+		{[]string{"CONNECT", "all privileges"}, "all privileges"},
+	}
+
+	for _, test := range tests {
+		if got := privilegeList(test.privileges); got != test.expected {
+			t.Errorf("privilegeList(%q) = %s, expected %s", test.privileges, got, test.expected)
+		}
+	}
+}
+
+func TestBatchedGrantStatements(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	m := &Manager{logger: logger, ctx: context.Background(), dryRun: true, statements: []structs.PlannedStatement{}}
+
+	if err := m.GrantPrivileges("app_user", []string{"CONNECT", "TEMPORARY"}, []string{"app", "reports"}); err != nil {
+		t.Fatalf("Failed to grant privileges: %v", err)
+	}
+	if err := m.RevokePrivileges("app_user", []string{"CREATE"}, []string{"app", "reports"}); err != nil {
+		t.Fatalf("Failed to revoke privileges: %v", err)
+	}
+	// Nothing to grant plans no statement
+	if err := m.GrantPrivileges("app_user", nil, []string{"app"}); err != nil {
+		t.Fatalf("Failed to grant no privileges: %v", err)
+	}
+	m.addToGroups("app_user", []string{"readers", "writers"}, func(group string, err error) {
+		t.Errorf("Failed to add app_user to %s: %v", group, err)
+	})
+
+	expected := []string{
+		`GRANT CONNECT, TEMPORARY ON DATABASE "app", "reports" TO "app_user"`,
+		`REVOKE CREATE ON DATABASE "app", "reports" FROM "app_user"`,
+		`GRANT "readers", "writers" TO "app_user"`,
+	}
+	if len(m.statements) != len(expected) {
+		t.Fatalf("Expected %d statements, got %v", len(expected), m.statements)
+	}
+	for i, statement := range m.statements {
+		if statement.Query != expected[i] {
+			t.Errorf("Statement %d: expected %s, got %s", i, expected[i], statement.Query)
+		}
+	}
+}
+
+func TestSyncConfigurationExactPrivileges(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	setup.CreateTestDatabase(t, testDatabase)
+	defer setup.DropTestDatabase(t, testDatabase)
+
+	config := &structs.Config{
+		Users: []structs.UserConfig{
+			{
+				Username:   "test_user",
+				Password:   "test_pass",
+				Privileges: []string{"CONNECT", "CREATE"},
+				Databases:  []string{testDatabase},
+				Enabled:    true,
+				CanLogin:   true,
+			},
+		},
+	}
+
+	if _, err := setup.Manager.SyncConfiguration(config); err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+
+	// Shrinking the config only reports the extra privilege by default
+	config.Users[0].Privileges = []string{"CONNECT"}
+
+	result, err := setup.Manager.SyncConfiguration(config)
+	if err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+	if len(result.PrivilegesExtra) != 1 || result.PrivilegesExtra[0].Privilege != "CREATE" {
+		t.Errorf("Expected CREATE to be reported, got %v", result.PrivilegesExtra)
+	}
+
+	// With exact privileges the extra privilege is revoked
+	setup.Manager.SetExactPrivileges(true)
+	defer setup.Manager.SetExactPrivileges(false)
+
+	result, err = setup.Manager.SyncConfiguration(config)
+	if err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+	if len(result.PrivilegesRevoked) != 1 || result.PrivilegesRevoked[0].Privilege != "CREATE" {
+		t.Errorf("Expected CREATE to be revoked, got %v", result.PrivilegesRevoked)
+	}
+
+	grants, err := setup.Manager.GetDatabasePrivileges("test_user")
+	if err != nil {
+		t.Fatalf("Failed to get database privileges: %v", err)
+	}
+	if len(grants) != 1 || grants[0].Privilege != "CONNECT" {
+		t.Errorf("Expected only CONNECT to remain, got %v", grants)
+	}
+}
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// protectionMetadataKey records deletion protection in a role's comment metadata, so
+	// it is honoured even when the role is later removed from the configuration
+	protectionMetadataKey = "deletion_protection"
+)
+
+// ErrDeletionProtected is returned when dropping a role that has deletion protection
+var ErrDeletionProtected = errors.New("role has deletion protection")
+
+// SetOverrideProtection allows roles with deletion protection to be dropped
+func (m *Manager) SetOverrideProtection(override bool) {
+	m.overrideProtection = override
+}
+
+// IsDeletionProtected reports whether a role's comment records deletion protection
+func (m *Manager) IsDeletionProtected(role string) (bool, error) {
+	comment, err := m.GetRoleComment(role)
+	if err != nil {
+		return false, err
+	}
+	_, metadata := parseRoleComment(comment)
+	return metadata[protectionMetadataKey] == "true", nil
+}
+
+// SetDeletionProtection records or clears deletion protection on a role, leaving the
+// comment untouched when it already matches
+func (m *Manager) SetDeletionProtection(role string, protected bool) error {
+	current, err := m.IsDeletionProtected(role)
+	if err != nil {
+		return err
+	}
+	if current == protected {
+		return nil
+	}
+
+	m.logger.WithFields(logrus.Fields{
+		"role":      role,
+		"protected": protected,
+	}).Info("Updating deletion protection")
+
+	value := ""
+	if protected {
+		value = "true"
+	}
+	return m.stampRole(role, "", "protection_changed", map[string]string{protectionMetadataKey: value})
+}
+
+// checkDeletionProtection returns ErrDeletionProtected for a protected role unless protection is overridden
+func (m *Manager) checkDeletionProtection(role string, configured bool) error {
+	protected := configured
+	if !protected {
+		var err error
+		if protected, err = m.IsDeletionProtected(role); err != nil {
+			return err
+		}
+	}
+	if !protected {
+		return nil
+	}
+
+	if !m.overrideProtection {
+		return fmt.Errorf("refusing to drop %s (use --override-protection): %w", role, ErrDeletionProtected)
+	}
+
+	m.logger.WithField("role", role).Warn("Overriding deletion protection")
+	return nil
+}
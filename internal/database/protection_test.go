@@ -0,0 +1,65 @@
+package database
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+func TestDeletionProtection(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	config := &structs.Config{
+		Users: []structs.UserConfig{
+			{Username: "test_user", Password: "test_pass", DeletionProtection: true, Enabled: true, CanLogin: true},
+		},
+	}
+
+	if _, err := setup.Manager.SyncConfiguration(config); err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+
+	protected, err := setup.Manager.IsDeletionProtected("test_user")
+	if err != nil || !protected {
+		t.Fatalf("Expected deletion protection to be recorded on the role (protected=%v, err=%v)", protected, err)
+	}
+
+	// Protection survives the user being removed from the config
+	if err := setup.Manager.DropUser("test_user"); !errors.Is(err, ErrDeletionProtected) {
+		t.Errorf("Expected ErrDeletionProtected, got %v", err)
+	}
+
+	// Marking the user absent is refused as well
+	config.Users[0].Absent = true
+	result, err := setup.Manager.SyncConfiguration(config)
+	if err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+	if len(result.UsersRemoved) != 0 || len(result.Errors) != 1 || !errors.Is(result.Errors[0], ErrDeletionProtected) {
+		t.Errorf("Expected the absent protected user to be kept, got removed=%v errors=%v", result.UsersRemoved, result.Errors)
+	}
+
+	// Clearing protection in the config clears it on the role
+	config.Users[0].Absent = false
+	config.Users[0].DeletionProtection = false
+	if _, err := setup.Manager.SyncConfiguration(config); err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+	if protected, _ := setup.Manager.IsDeletionProtected("test_user"); protected {
+		t.Error("Expected deletion protection to be cleared")
+	}
+
+	// Overriding protection allows the drop
+	if err := setup.Manager.SetDeletionProtection("test_user", true); err != nil {
+		t.Fatalf("Failed to set deletion protection: %v", err)
+	}
+	setup.Manager.SetOverrideProtection(true)
+	defer setup.Manager.SetOverrideProtection(false)
+
+	if err := setup.Manager.DropUser("test_user"); err != nil {
+		t.Errorf("Expected override to allow the drop, got %v", err)
+	}
+}
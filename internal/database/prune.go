@@ -0,0 +1,259 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// managedMetadataKey marks a role in its comment metadata as owned by this tool and
+	// records whether it was declared as a user or a group, so prune only ever touches
+	// roles that sync created or adopted
+	managedMetadataKey = "managed"
+
+	// ManagedKindUser and ManagedKindGroup are the kinds of role ManagedKind reports
+	ManagedKindUser  = "user"
+	ManagedKindGroup = "group"
+
+	// sourceMetadataKey records where a tagged role is managed from, such as the file name
+	// of the configuration or the command that created it
+	sourceMetadataKey = "source"
+)
+
+const (
+	// PruneDrop drops managed roles that are no longer in the configuration
+	PruneDrop = "drop"
+	// PruneDisable revokes LOGIN from managed users that are no longer in the configuration
+	// and leaves managed groups in place
+	PruneDisable = "disable"
+)
+
+// RefuseGroup returns why the members of a role may not be changed from outside the
+// configuration, by events or the SCIM server, or an empty string when they may. Identity
+// provider groups that no mapping names keep their own name, so only roles a mapping names
+// or that sync manages as groups are changed. Login roles, reserved roles and roles that can
+// create roles or bypass all checks never are, so a group named after one cannot hand out
+// its privileges.
+func RefuseGroup(group string, attributes *structs.RoleAttributes, mapped bool) string {
+	name := strings.ToLower(group)
+	switch {
+	case strings.HasPrefix(name, "pg_") || strings.HasPrefix(name, "rds_"):
+		return "it is a reserved role"
+	case attributes.CanLogin:
+		return "it is a login role"
+	case attributes.Superuser || attributes.CreateRole:
+		return "it has SUPERUSER or CREATEROLE"
+	case !mapped && attributes.ManagedAs != ManagedKindGroup:
+		return "it is neither named by a group mapping nor managed as a group"
+	}
+	return ""
+}
+
+// SetPrune makes sync remove managed roles that are no longer in the configuration, either
+// by dropping them (PruneDrop) or by disabling users (PruneDisable). An empty action turns pruning off.
+func (m *Manager) SetPrune(action string) error {
+	switch action {
+	case "", PruneDrop, PruneDisable:
+		m.prune = action
+		return nil
+	default:
+		return fmt.Errorf("invalid prune action: %s (must be '%s' or '%s')", action, PruneDrop, PruneDisable)
+	}
+}
+
+// SetRoleSource tags every role the manager creates as managed, recording the source in its
+// comment, and records the source on the roles sync marks as managed. Managed roles tagged
+// with another source are then left out of ManagedRoles, so sync only prunes the roles of
+// its own configuration. An empty source turns tagging off.
+func (m *Manager) SetRoleSource(source string) {
+	m.roleSource = source
+}
+
+// ManagedRoles returns the users and groups marked as managed by this tool, ordered by
+// name. The connected role is never included, nor are roles tagged with a source other
+// than the one set with SetRoleSource.
+func (m *Manager) ManagedRoles() (users []string, groups []string, err error) {
+	rows, err := m.executor().Query(`
+		SELECT rolname, COALESCE(shobj_description(oid, 'pg_authid'), '')
+		FROM pg_roles
+		WHERE rolname !~ '^pg_' AND rolname <> current_user
+		ORDER BY rolname`)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list managed roles: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var role, comment string
+		if err := rows.Scan(&role, &comment); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan managed role: %w", err)
+		}
+
+		_, metadata := parseRoleComment(comment)
+		if source := metadata[sourceMetadataKey]; m.roleSource != "" && source != "" && source != m.roleSource {
+			continue
+		}
+		switch metadata[managedMetadataKey] {
+		case ManagedKindUser:
+			users = append(users, role)
+		case ManagedKindGroup:
+			groups = append(groups, role)
+		}
+	}
+
+	return users, groups, rows.Err()
+}
+
+// ManagedKind reports whether a role is marked as managed by this tool, as ManagedKindUser
+// or ManagedKindGroup. It is empty for roles that do not exist, are not marked or are
+// tagged with a source other than the one set with SetRoleSource, the same roles
+// ManagedRoles leaves out.
+func (m *Manager) ManagedKind(role string) (string, error) {
+	comment, err := m.GetRoleComment(role)
+	if err != nil {
+		return "", err
+	}
+	_, metadata := parseRoleComment(comment)
+	if source := metadata[sourceMetadataKey]; m.roleSource != "" && source != "" && source != m.roleSource {
+		return "", nil
+	}
+	return metadata[managedMetadataKey], nil
+}
+
+// markManaged records in a role's comment that it is managed by this tool, and from which
+// source when tagging, leaving the comment untouched when it is already marked the same way.
+// A role tagged with another source is adopted by this one.
+func (m *Manager) markManaged(role, kind string) error {
+	comment, err := m.GetRoleComment(role)
+	if err != nil {
+		return err
+	}
+	_, metadata := parseRoleComment(comment)
+	if metadata[managedMetadataKey] == kind && (m.roleSource == "" || metadata[sourceMetadataKey] == m.roleSource) {
+		return nil
+	}
+
+	return m.stampRole(role, "", "managed", m.managedMetadata(kind, nil))
+}
+
+// managedMetadata adds the managed marker of a kind of role to comment metadata, with the
+// source of the manager when it tags roles
+func (m *Manager) managedMetadata(kind string, metadata map[string]string) map[string]string {
+	if metadata == nil {
+		metadata = make(map[string]string)
+	}
+	metadata[managedMetadataKey] = kind
+	if m.roleSource != "" {
+		metadata[sourceMetadataKey] = m.roleSource
+	}
+	return metadata
+}
+
+// checkManagedKind refuses to sync a role as a user when sync manages it as a group, or the
+// other way round. Users and groups share the role namespace, so the configuration would
+// otherwise silently turn one into the other.
+func (m *Manager) checkManagedKind(role, kind string) error {
+	comment, err := m.GetRoleComment(role)
+	if err != nil {
+		return err
+	}
+	_, metadata := parseRoleComment(comment)
+	if existing := metadata[managedMetadataKey]; existing != "" && existing != kind {
+		return fmt.Errorf("role %s is managed as a %s but declared as a %s; users and groups share one role namespace, "+
+			"so rename one of them or drop the existing role first", role, existing, kind)
+	}
+	return nil
+}
+
+// pruneRoles removes managed roles that the configuration no longer declares. Users are
+// dropped or disabled depending on the prune action; groups are only dropped.
+func (m *Manager) pruneRoles(config *structs.Config, result *structs.SyncResult) error {
+	declared := declaredRoles(config)
+	// A dry run still finds renamed users under their previous name
+	for _, rename := range result.UsersRenamed {
+		declared[rename.From] = true
+	}
+
+	users, groups, err := m.ManagedRoles()
+	if err != nil {
+		return err
+	}
+
+	// Users are pruned before groups, the reverse of the order they are created in
+	for _, user := range users {
+		if declared[user] {
+			continue
+		}
+		m.pruneUser(user, result)
+	}
+
+	for _, group := range groups {
+		if declared[group] {
+			continue
+		}
+		if m.prune != PruneDrop {
+			result.Warn(group, "managed group is no longer in the configuration, left in place (use --prune-action drop to remove it)")
+			continue
+		}
+
+		// DropGroup refuses roles with deletion protection and login roles, and hands over
+		// or drops what the group owns as role_removal says, like DropUser does for users
+		m.logger.WithField("group", group).Info("Dropping group no longer in configuration")
+		if err := m.timed(result, "group:"+group, "prune", func() error { return m.DropGroup(group) }); err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("failed to prune group %s: %w", group, err))
+			continue
+		}
+		result.GroupsRemoved = append(result.GroupsRemoved, group)
+	}
+
+	m.logger.WithFields(logrus.Fields{
+		"action":         m.prune,
+		"users_removed":  len(result.UsersRemoved),
+		"groups_removed": len(result.GroupsRemoved),
+	}).Info("Pruned roles no longer in configuration")
+
+	return nil
+}
+
+// declaredRoles returns the names of every user and group in the configuration, including
+// absent and disabled users
+func declaredRoles(config *structs.Config) map[string]bool {
+	declared := make(map[string]bool, len(config.Users)+len(config.Groups))
+	for _, user := range config.Users {
+		declared[user.Username] = true
+	}
+	for _, group := range config.Groups {
+		declared[group.Name] = true
+	}
+	return declared
+}
+
+// pruneUser drops or disables a managed user that is no longer in the configuration
+func (m *Manager) pruneUser(user string, result *structs.SyncResult) {
+	entity := "user:" + user
+
+	if m.prune == PruneDisable {
+		var changed bool
+		err := m.timed(result, entity, "prune", func() error {
+			var err error
+			changed, err = m.DisableUser(user)
+			return err
+		})
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("failed to prune user %s: %w", user, err))
+		} else if changed {
+			result.UsersDisabled = append(result.UsersDisabled, user)
+		}
+		return
+	}
+
+	// DropUser refuses roles with deletion protection unless it is overridden
+	if err := m.timed(result, entity, "prune", func() error { return m.DropUser(user) }); err != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("failed to prune user %s: %w", user, err))
+		return
+	}
+	result.UsersRemoved = append(result.UsersRemoved, user)
+}
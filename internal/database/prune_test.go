@@ -0,0 +1,343 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+func TestSyncPrune(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	config := &structs.Config{
+		Groups: []structs.GroupConfig{
+			{Name: "test_group", Inherit: true},
+			{Name: "test_group_2", Inherit: true},
+		},
+		Users: []structs.UserConfig{
+			{Username: "test_user", Password: "test_pass", Groups: []string{"test_group"}, Enabled: true, CanLogin: true},
+			{Username: "test_user_2", Password: "test_pass", Enabled: true, CanLogin: true},
+		},
+	}
+	if _, err := setup.Manager.SyncConfiguration(config); err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+
+	// A role created outside of sync is not managed and must survive pruning
+	if err := setup.Manager.CreateUser(&structs.UserConfig{Username: "test_unmanaged", Password: "test_pass", CanLogin: true}); err != nil {
+		t.Fatalf("Failed to create unmanaged user: %v", err)
+	}
+
+	users, groups, err := setup.Manager.ManagedRoles()
+	if err != nil {
+		t.Fatalf("Failed to list managed roles: %v", err)
+	}
+	if len(users) != 2 || len(groups) != 2 {
+		t.Fatalf("Expected 2 managed users and 2 managed groups, got users=%v groups=%v", users, groups)
+	}
+
+	if err := setup.Manager.SetPrune(PruneDrop); err != nil {
+		t.Fatalf("Failed to set prune action: %v", err)
+	}
+	defer setup.Manager.SetPrune("")
+
+	config.Groups = config.Groups[:1]
+	config.Users = config.Users[:1]
+	result, err := setup.Manager.SyncConfiguration(config)
+	if err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected sync errors: %v", result.Errors)
+	}
+
+	if len(result.UsersRemoved) != 1 || result.UsersRemoved[0] != "test_user_2" {
+		t.Errorf("Expected test_user_2 to be pruned, got %v", result.UsersRemoved)
+	}
+	if len(result.GroupsRemoved) != 1 || result.GroupsRemoved[0] != "test_group_2" {
+		t.Errorf("Expected test_group_2 to be pruned, got %v", result.GroupsRemoved)
+	}
+
+	for _, role := range []string{"test_user", "test_group", "test_unmanaged"} {
+		if exists, _ := setup.Manager.UserExists(role); !exists {
+			t.Errorf("Expected %s to be kept", role)
+		}
+	}
+}
+
+func TestSyncPruneDisable(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	config := &structs.Config{
+		Users: []structs.UserConfig{
+			{Username: "test_user", Password: "test_pass", Enabled: true, CanLogin: true},
+			{Username: "test_user_2", Password: "test_pass", Enabled: true, CanLogin: true},
+		},
+	}
+	if _, err := setup.Manager.SyncConfiguration(config); err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+
+	if err := setup.Manager.SetPrune(PruneDisable); err != nil {
+		t.Fatalf("Failed to set prune action: %v", err)
+	}
+	defer setup.Manager.SetPrune("")
+
+	config.Users = config.Users[:1]
+	result, err := setup.Manager.SyncConfiguration(config)
+	if err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+
+	if len(result.UsersDisabled) != 1 || result.UsersDisabled[0] != "test_user_2" || len(result.UsersRemoved) != 0 {
+		t.Errorf("Expected test_user_2 to be disabled, got disabled=%v removed=%v", result.UsersDisabled, result.UsersRemoved)
+	}
+
+	exists, canLogin, err := setup.Manager.RoleCanLogin("test_user_2")
+	if err != nil || !exists || canLogin {
+		t.Errorf("Expected test_user_2 to exist without LOGIN (exists=%v, canLogin=%v, err=%v)", exists, canLogin, err)
+	}
+}
+
+func TestSyncPruneRefusesEmptyConfiguration(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+
+	if err := setup.Manager.SetPrune(PruneDrop); err != nil {
+		t.Fatalf("Failed to set prune action: %v", err)
+	}
+	defer setup.Manager.SetPrune("")
+
+	if _, err := setup.Manager.SyncConfiguration(&structs.Config{}); err == nil {
+		t.Error("Expected pruning with an empty configuration to be refused")
+	}
+}
+
+func TestSetPruneInvalidAction(t *testing.T) {
+	m := &Manager{}
+	if err := m.SetPrune("delete"); err == nil {
+		t.Error("Expected an invalid prune action to be rejected")
+	}
+	if err := m.SetPrune(PruneDisable); err != nil || m.prune != PruneDisable {
+		t.Errorf("Expected disable to be accepted, got %v", err)
+	}
+}
+
+func TestSyncPruneRoleSource(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+	defer setup.Manager.SetRoleSource("")
+
+	// A user created from the command line is tagged as managed from there
+	setup.Manager.SetRoleSource("cli")
+	if err := setup.Manager.CreateUser(&structs.UserConfig{Username: "test_user_2", Password: "test_pass", CanLogin: true}); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	comment, err := setup.Manager.GetRoleComment("test_user_2")
+	if err != nil {
+		t.Fatalf("Failed to get role comment: %v", err)
+	}
+	if _, metadata := parseRoleComment(comment); metadata[managedMetadataKey] != ManagedKindUser || metadata[sourceMetadataKey] != "cli" {
+		t.Errorf("Expected test_user_2 to be tagged as a user managed from cli, got %q", comment)
+	}
+
+	setup.Manager.SetRoleSource("config.json")
+	if err := setup.Manager.SetPrune(PruneDrop); err != nil {
+		t.Fatalf("Failed to set prune action: %v", err)
+	}
+	defer setup.Manager.SetPrune("")
+
+	config := &structs.Config{
+		Users: []structs.UserConfig{{Username: "test_user", Password: "test_pass", Enabled: true, CanLogin: true}},
+	}
+	result, err := setup.Manager.SyncConfiguration(config)
+	if err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+	if len(result.UsersRemoved) != 0 {
+		t.Errorf("Expected the user tagged from cli to be left alone, got %v removed", result.UsersRemoved)
+	}
+
+	users, _, err := setup.Manager.ManagedRoles()
+	if err != nil {
+		t.Fatalf("Failed to list managed roles: %v", err)
+	}
+	if len(users) != 1 || users[0] != "test_user" {
+		t.Errorf("Expected only test_user to be managed from config.json, got %v", users)
+	}
+	if kind, err := setup.Manager.ManagedKind("test_user_2"); err != nil || kind != "" {
+		t.Errorf("Expected test_user_2 not to be managed from config.json, got %q (%v)", kind, err)
+	}
+	if kind, err := setup.Manager.ManagedKind("test_user"); err != nil || kind != ManagedKindUser {
+		t.Errorf("Expected test_user to be a managed user, got %q (%v)", kind, err)
+	}
+
+	// Once the configuration declares the user, sync adopts it
+	config.Users = append(config.Users, structs.UserConfig{Username: "test_user_2", Password: "test_pass", Enabled: true, CanLogin: true})
+	if _, err := setup.Manager.SyncConfiguration(config); err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+	comment, _ = setup.Manager.GetRoleComment("test_user_2")
+	if _, metadata := parseRoleComment(comment); metadata[sourceMetadataKey] != "config.json" {
+		t.Errorf("Expected test_user_2 to be adopted by config.json, got %q", comment)
+	}
+}
+
+func TestManagedMetadata(t *testing.T) {
+	m := &Manager{}
+	if metadata := m.managedMetadata(ManagedKindGroup, nil); len(metadata) != 1 || metadata[managedMetadataKey] != ManagedKindGroup {
+		t.Errorf("Expected only the managed marker without a source, got %v", metadata)
+	}
+
+	m.SetRoleSource("config.json")
+	metadata := m.managedMetadata(ManagedKindUser, map[string]string{ownerMetadataKey: "alice"})
+	if metadata[managedMetadataKey] != ManagedKindUser || metadata[sourceMetadataKey] != "config.json" || metadata[ownerMetadataKey] != "alice" {
+		t.Errorf("Expected the marker and source added to the existing metadata, got %v", metadata)
+	}
+}
+
+func TestSyncPruneReassignsOwnedObjects(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	config := &structs.Config{
+		Users: []structs.UserConfig{
+			{Username: "test_user", Password: "test_pass", Enabled: true, CanLogin: true},
+			{Username: "test_user_2", Password: "test_pass", Enabled: true, CanLogin: true},
+		},
+	}
+	if _, err := setup.Manager.SyncConfiguration(config); err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+	if _, err := setup.Manager.db.Exec("CREATE TABLE owned_table (id int)"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	defer setup.Manager.db.Exec("DROP TABLE IF EXISTS owned_table")
+	if _, err := setup.Manager.db.Exec(`ALTER TABLE owned_table OWNER TO "test_user_2"`); err != nil {
+		t.Fatalf("Failed to change table owner: %v", err)
+	}
+
+	if err := setup.Manager.SetPrune(PruneDrop); err != nil {
+		t.Fatalf("Failed to set prune action: %v", err)
+	}
+	defer setup.Manager.SetPrune("")
+	setup.Manager.SetReassignTo("test_user")
+	defer setup.Manager.SetReassignTo("")
+
+	config.Users = config.Users[:1]
+	result, err := setup.Manager.SyncConfiguration(config)
+	if err != nil || len(result.Errors) > 0 {
+		t.Fatalf("Failed to sync configuration: %v %v", err, result.Errors)
+	}
+	if len(result.UsersRemoved) != 1 || result.UsersRemoved[0] != "test_user_2" {
+		t.Errorf("Expected test_user_2 to be pruned, got %v", result.UsersRemoved)
+	}
+
+	var owner string
+	if err := setup.Manager.db.QueryRow("SELECT tableowner FROM pg_tables WHERE tablename = 'owned_table'").Scan(&owner); err != nil {
+		t.Fatalf("Failed to read table owner: %v", err)
+	}
+	if owner != "test_user" {
+		t.Errorf("Expected the table to be reassigned to test_user, got %s", owner)
+	}
+}
+
+func TestSyncPruneReassignsGroupObjects(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	config := &structs.Config{
+		Users:  []structs.UserConfig{{Username: "test_user", Password: "test_pass", Enabled: true, CanLogin: true}},
+		Groups: []structs.GroupConfig{{Name: "test_group", Inherit: true}},
+	}
+	if _, err := setup.Manager.SyncConfiguration(config); err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+	if _, err := setup.Manager.db.Exec("CREATE TABLE group_table (id int)"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	defer setup.Manager.db.Exec("DROP TABLE IF EXISTS group_table")
+	if _, err := setup.Manager.db.Exec(`ALTER TABLE group_table OWNER TO "test_group"`); err != nil {
+		t.Fatalf("Failed to change table owner: %v", err)
+	}
+
+	if err := setup.Manager.SetPrune(PruneDrop); err != nil {
+		t.Fatalf("Failed to set prune action: %v", err)
+	}
+	defer setup.Manager.SetPrune("")
+	setup.Manager.SetReassignTo("test_user")
+	defer setup.Manager.SetReassignTo("")
+
+	config.Groups = nil
+	result, err := setup.Manager.SyncConfiguration(config)
+	if err != nil || len(result.Errors) > 0 {
+		t.Fatalf("Failed to sync configuration: %v %v", err, result.Errors)
+	}
+	if len(result.GroupsRemoved) != 1 || result.GroupsRemoved[0] != "test_group" {
+		t.Errorf("Expected test_group to be pruned, got %v", result.GroupsRemoved)
+	}
+
+	var owner string
+	if err := setup.Manager.db.QueryRow("SELECT tableowner FROM pg_tables WHERE tablename = 'group_table'").Scan(&owner); err != nil {
+		t.Fatalf("Failed to read table owner: %v", err)
+	}
+	if owner != "test_user" {
+		t.Errorf("Expected the table to be reassigned to test_user, got %s", owner)
+	}
+}
+
+func TestSyncPruneReassignsObjectsInOtherDatabases(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	setup.CreateTestDatabase(t, "owned_db")
+	defer setup.DropTestDatabase(t, "owned_db")
+
+	config := &structs.Config{
+		Users: []structs.UserConfig{
+			{Username: "test_user", Password: "test_pass", Enabled: true, CanLogin: true},
+			{Username: "test_user_2", Password: "test_pass", Enabled: true, CanLogin: true},
+		},
+		Schemas: []structs.SchemaConfig{{Name: "owned_schema", Database: "owned_db", Owner: "test_user_2"}},
+	}
+	if result, err := setup.Manager.SyncConfiguration(config); err != nil || len(result.Errors) > 0 {
+		t.Fatalf("Failed to sync configuration: %v %v", err, result.Errors)
+	}
+
+	if err := setup.Manager.SetPrune(PruneDrop); err != nil {
+		t.Fatalf("Failed to set prune action: %v", err)
+	}
+	defer setup.Manager.SetPrune("")
+	setup.Manager.SetReassignTo("test_user")
+	defer setup.Manager.SetReassignTo("")
+
+	// The schema stays in the configuration, only its owner is no longer declared
+	config.Users = config.Users[:1]
+	config.Schemas[0].Owner = ""
+	result, err := setup.Manager.SyncConfiguration(config)
+	if err != nil || len(result.Errors) > 0 {
+		t.Fatalf("Failed to sync configuration: %v %v", err, result.Errors)
+	}
+	if len(result.UsersRemoved) != 1 || result.UsersRemoved[0] != "test_user_2" {
+		t.Errorf("Expected test_user_2 to be pruned, got %v", result.UsersRemoved)
+	}
+
+	var owner string
+	err = setup.Manager.InDatabase("owned_db", func(db *Manager) error {
+		return db.db.QueryRow("SELECT pg_get_userbyid(nspowner) FROM pg_namespace WHERE nspname = 'owned_schema'").Scan(&owner)
+	})
+	if err != nil {
+		t.Fatalf("Failed to read the owner of owned_schema: %v", err)
+	}
+	if owner != "test_user" {
+		t.Errorf("Expected owned_schema to be reassigned to test_user, got %s", owner)
+	}
+}
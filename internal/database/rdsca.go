@@ -0,0 +1,181 @@
+package database
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+// rdsCABundleURL is where AWS publishes the certificate authorities of every RDS region
+var rdsCABundleURL = "https://truststore.pki.rds.amazonaws.com/global/global-bundle.pem"
+
+const (
+	// rdsCABundleTimeout bounds the download of the RDS CA bundle
+	rdsCABundleTimeout = 30 * time.Second
+	// rdsCABundleMaxAge is how long a cached RDS CA bundle is used before it is downloaded
+	// again, so certificate authorities AWS adds are picked up
+	rdsCABundleMaxAge = 7 * 24 * time.Hour
+)
+
+// rdsCABundleTemp is the bundle downloaded into a private temporary directory where there is
+// no cache directory, reused for the rest of the process
+var rdsCABundleTemp struct {
+	sync.Mutex
+	path string
+}
+
+// resolveRootCert returns the connection with the RDS CA bundle file in place of
+// SSLRootCertRDS, downloading the bundle on first use. Other connections are returned as
+// they are.
+func resolveRootCert(ctx context.Context, conn *structs.DatabaseConnection, logger *logrus.Logger) (*structs.DatabaseConnection, error) {
+	if conn.SSLRootCert != structs.SSLRootCertRDS {
+		return conn, nil
+	}
+
+	path, err := rdsCABundle(ctx, logger)
+	if err != nil {
+		return nil, err
+	}
+	resolved := *conn
+	resolved.SSLRootCert = path
+	return &resolved, nil
+}
+
+// rdsCABundle returns the path of the RDS CA bundle, kept in the user's cache directory. A
+// cached bundle is only used while it is younger than rdsCABundleMaxAge and is a regular
+// file owned by the user that nobody else can write to; otherwise it is downloaded again.
+// Where there is no cache directory, such as in Lambda, the bundle is downloaded once per
+// process into a private temporary directory.
+func rdsCABundle(ctx context.Context, logger *logrus.Logger) (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return tempRDSCABundle(ctx, logger)
+	}
+	dir := filepath.Join(cacheDir, "postgres-user-manager")
+	path := filepath.Join(dir, "rds-global-bundle.pem")
+
+	info, statErr := os.Lstat(path)
+	cached := statErr == nil && trustedCacheFile(info)
+	if cached && time.Since(info.ModTime()) < rdsCABundleMaxAge {
+		return path, nil
+	}
+	if statErr == nil && !cached {
+		logger.WithField("path", path).Warn("Ignoring the cached RDS CA bundle: it is not a file owned by the current user and writable only by it")
+	}
+
+	bundle, err := downloadRDSCABundle(ctx)
+	if err != nil {
+		if cached {
+			logger.WithError(err).WithField("path", path).Warn("Failed to refresh the RDS CA bundle, using the cached copy")
+			return path, nil
+		}
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("failed to cache the RDS CA bundle: %w", err)
+	}
+	if err := writeRDSCABundle(dir, path, bundle); err != nil {
+		return "", err
+	}
+
+	logger.WithFields(logrus.Fields{
+		"url":  rdsCABundleURL,
+		"path": path,
+	}).Info("Downloaded the RDS CA bundle")
+	return path, nil
+}
+
+// tempRDSCABundle downloads the RDS CA bundle into a new private temporary directory, once
+// per process
+func tempRDSCABundle(ctx context.Context, logger *logrus.Logger) (string, error) {
+	rdsCABundleTemp.Lock()
+	defer rdsCABundleTemp.Unlock()
+
+	if rdsCABundleTemp.path != "" {
+		return rdsCABundleTemp.path, nil
+	}
+
+	bundle, err := downloadRDSCABundle(ctx)
+	if err != nil {
+		return "", err
+	}
+	dir, err := os.MkdirTemp("", "postgres-user-manager-")
+	if err != nil {
+		return "", fmt.Errorf("failed to store the RDS CA bundle: %w", err)
+	}
+	path := filepath.Join(dir, "rds-global-bundle.pem")
+	if err := writeRDSCABundle(dir, path, bundle); err != nil {
+		return "", err
+	}
+
+	logger.WithFields(logrus.Fields{
+		"url":  rdsCABundleURL,
+		"path": path,
+	}).Info("Downloaded the RDS CA bundle")
+	rdsCABundleTemp.path = path
+	return path, nil
+}
+
+// writeRDSCABundle writes a bundle to path in dir, under another name first, so concurrent
+// runs never read a partial bundle
+func writeRDSCABundle(dir, path string, bundle []byte) error {
+	tmp, err := os.CreateTemp(dir, "rds-global-bundle-*.pem")
+	if err != nil {
+		return fmt.Errorf("failed to cache the RDS CA bundle: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(bundle); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to cache the RDS CA bundle: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to cache the RDS CA bundle: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to cache the RDS CA bundle: %w", err)
+	}
+	return nil
+}
+
+// trustedCacheFile reports whether a cached file can be trusted: a regular file, not a
+// symbolic link, owned by the current user and not writable by anyone else
+func trustedCacheFile(info os.FileInfo) bool {
+	return info.Mode().IsRegular() && info.Mode().Perm()&0o022 == 0 && ownedByCurrentUser(info)
+}
+
+// downloadRDSCABundle fetches the RDS CA bundle, checking it holds certificates
+func downloadRDSCABundle(ctx context.Context) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, rdsCABundleTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rdsCABundleURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create RDS CA bundle request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download the RDS CA bundle (set POSTGRES_SSLROOTCERT to a downloaded copy where there is no internet access): %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download the RDS CA bundle: %s returned %s", rdsCABundleURL, resp.Status)
+	}
+	bundle, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download the RDS CA bundle: %w", err)
+	}
+	if !x509.NewCertPool().AppendCertsFromPEM(bundle) {
+		return nil, fmt.Errorf("failed to download the RDS CA bundle: %s returned no PEM certificates", rdsCABundleURL)
+	}
+	return bundle, nil
+}
@@ -0,0 +1,154 @@
+package database
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+// testCABundle returns a PEM encoded self-signed CA certificate
+func testCABundle(t *testing.T) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test RDS Root CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestResolveRootCert(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	bundle := testCABundle(t)
+	downloads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads++
+		w.Write(bundle)
+	}))
+	defer server.Close()
+	original := rdsCABundleURL
+	rdsCABundleURL = server.URL
+	defer func() { rdsCABundleURL = original }()
+
+	// Files are used as they are
+	conn := &structs.DatabaseConnection{Host: "db", SSLRootCert: "/etc/ssl/ca.pem"}
+	if resolved, err := resolveRootCert(context.Background(), conn, logger); err != nil || resolved != conn {
+		t.Fatalf("Expected the connection unchanged, got %+v, %v", resolved, err)
+	}
+
+	conn = &structs.DatabaseConnection{Host: "db", SSLRootCert: structs.SSLRootCertRDS}
+	for i := 0; i < 2; i++ {
+		resolved, err := resolveRootCert(context.Background(), conn, logger)
+		if err != nil {
+			t.Fatalf("Failed to resolve the RDS CA bundle: %v", err)
+		}
+		data, err := os.ReadFile(resolved.SSLRootCert)
+		if err != nil || string(data) != string(bundle) {
+			t.Fatalf("Expected the bundle at %s, got %v", resolved.SSLRootCert, err)
+		}
+	}
+	if downloads != 1 {
+		t.Errorf("Expected the cached bundle to be reused, downloaded %d times", downloads)
+	}
+	if conn.SSLRootCert != structs.SSLRootCertRDS {
+		t.Error("Expected the original connection to be left untouched")
+	}
+}
+
+func TestRDSCABundleRefreshesUntrustedCache(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	bundle := testCABundle(t)
+	downloads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads++
+		w.Write(bundle)
+	}))
+	defer server.Close()
+	original := rdsCABundleURL
+	rdsCABundleURL = server.URL
+	defer func() { rdsCABundleURL = original }()
+
+	path, err := rdsCABundle(context.Background(), logger)
+	if err != nil {
+		t.Fatalf("Failed to download the RDS CA bundle: %v", err)
+	}
+	if info, err := os.Stat(filepath.Dir(path)); err != nil || info.Mode().Perm() != 0o700 {
+		t.Errorf("Expected a private cache directory, got %v, %v", info.Mode(), err)
+	}
+
+	// A bundle older than the maximum age is downloaded again
+	old := time.Now().Add(-rdsCABundleMaxAge - time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatalf("Failed to age the bundle: %v", err)
+	}
+	if _, err := rdsCABundle(context.Background(), logger); err != nil {
+		t.Fatalf("Failed to refresh the RDS CA bundle: %v", err)
+	}
+	if downloads != 2 {
+		t.Errorf("Expected a stale bundle to be downloaded again, downloaded %d times", downloads)
+	}
+
+	// So is a bundle others can write to
+	if err := os.WriteFile(path, []byte("tampered"), 0o666); err != nil {
+		t.Fatalf("Failed to replace the bundle: %v", err)
+	}
+	if err := os.Chmod(path, 0o666); err != nil {
+		t.Fatalf("Failed to change the bundle's mode: %v", err)
+	}
+	if _, err := rdsCABundle(context.Background(), logger); err != nil {
+		t.Fatalf("Failed to refresh the RDS CA bundle: %v", err)
+	}
+	if downloads != 3 {
+		t.Errorf("Expected a writable bundle to be downloaded again, downloaded %d times", downloads)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != string(bundle) {
+		t.Errorf("Expected the tampered bundle to be replaced, got %q, %v", data, err)
+	}
+}
+
+func TestDownloadRDSCABundleRejectsNonPEM(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html>captive portal</html>"))
+	}))
+	defer server.Close()
+	original := rdsCABundleURL
+	rdsCABundleURL = server.URL
+	defer func() { rdsCABundleURL = original }()
+
+	_, err := downloadRDSCABundle(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "no PEM certificates") {
+		t.Errorf("Expected a bundle without certificates to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+// RenameRole renames a role. Its attributes, memberships, grants and owned objects follow
+// the role, but PostgreSQL clears an MD5 password because the hash is salted with the name.
+func (m *Manager) RenameRole(from, to string) error {
+	m.logger.WithFields(logrus.Fields{
+		"from": from,
+		"to":   to,
+	}).Info("Renaming role")
+
+	exists, err := m.roleExists(to)
+	if err != nil {
+		return fmt.Errorf("failed to check if role exists: %w", err)
+	}
+	if exists {
+		return fmt.Errorf("cannot rename role %s to %s: role %s already exists", from, to, to)
+	}
+
+	query := fmt.Sprintf("ALTER ROLE %s RENAME TO %s", m.quoteIdentifier(from), m.quoteIdentifier(to))
+	if err := m.execute(query); err != nil {
+		return fmt.Errorf("failed to rename role %s to %s: %w", from, to, err)
+	}
+	if m.dryRun {
+		m.planRole(from, false)
+		m.planRole(to, true)
+		return nil
+	}
+
+	m.logger.WithFields(logrus.Fields{
+		"from": from,
+		"to":   to,
+	}).Info("Role renamed successfully")
+	return nil
+}
+
+// previousName returns the first previous name of a user that still exists while the user
+// itself does not, or an empty string when there is nothing to rename
+func (m *Manager) previousName(user *structs.UserConfig) (string, error) {
+	if len(user.PreviousNames) == 0 {
+		return "", nil
+	}
+
+	exists, err := m.roleExists(user.Username)
+	if err != nil || exists {
+		return "", err
+	}
+
+	for _, name := range user.PreviousNames {
+		exists, err := m.roleExists(name)
+		if err != nil {
+			return "", err
+		}
+		if exists {
+			return name, nil
+		}
+	}
+	return "", nil
+}
+
+// renameUser renames the role of a user that still exists under a previous name, so a
+// renamed service keeps its grants instead of getting a new role next to the old one. It
+// reports whether sync should go on with the user; a dry run stops after the rename because
+// the role cannot be compared under its new name until the rename has run.
+func (m *Manager) renameUser(user *structs.UserConfig, result *structs.SyncResult) bool {
+	var from string
+	err := m.timed(result, "user:"+user.Username, "rename", func() error {
+		var err error
+		if from, err = m.previousName(user); err != nil || from == "" {
+			return err
+		}
+		return m.RenameRole(from, user.Username)
+	})
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("failed to rename user %s: %w", user.Username, err))
+		return false
+	}
+	if from == "" {
+		return true
+	}
+
+	result.UsersRenamed = append(result.UsersRenamed, structs.RoleRename{From: from, To: user.Username})
+	if m.dryRun {
+		result.Warn(user.Username, fmt.Sprintf("would be renamed from %s; other changes to the user are shown once the rename has run", from))
+		return false
+	}
+	if user.HasAuthMethod(structs.AuthMethodPassword) && user.Password == "" {
+		result.Warn(user.Username, fmt.Sprintf("renamed from %s; PostgreSQL clears MD5 passwords on rename, so set the password again if it was stored as MD5", from))
+	}
+	return true
+}
@@ -0,0 +1,74 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+func TestSyncRenamesPreviousName(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	if err := setup.Manager.CreateGroup(&structs.GroupConfig{Name: "test_readers"}); err != nil {
+		t.Fatalf("Failed to create test group: %v", err)
+	}
+	legacy := &structs.UserConfig{Username: "test_old_svc", Password: "test_pass", CanLogin: true, Enabled: true}
+	if err := setup.Manager.CreateUser(legacy); err != nil {
+		t.Fatalf("Failed to create legacy user: %v", err)
+	}
+	if err := setup.Manager.AddUserToGroup("test_old_svc", "test_readers"); err != nil {
+		t.Fatalf("Failed to add legacy user to group: %v", err)
+	}
+
+	config := &structs.Config{
+		Groups: []structs.GroupConfig{{Name: "test_readers"}},
+		Users: []structs.UserConfig{{
+			Username:      "test_new_svc",
+			Password:      "test_pass",
+			Groups:        []string{"test_readers"},
+			CanLogin:      true,
+			Enabled:       true,
+			PreviousNames: []string{"test_old_svc"},
+		}},
+	}
+	result, err := setup.Manager.SyncConfiguration(config)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected sync errors: %v", result.Errors)
+	}
+	if len(result.UsersRenamed) != 1 || result.UsersRenamed[0] != (structs.RoleRename{From: "test_old_svc", To: "test_new_svc"}) {
+		t.Errorf("Expected test_old_svc to be renamed to test_new_svc, got %v", result.UsersRenamed)
+	}
+	if len(result.UsersCreated) != 0 {
+		t.Errorf("Expected no users created, got %v", result.UsersCreated)
+	}
+
+	exists, err := setup.Manager.UserExists("test_old_svc")
+	if err != nil {
+		t.Fatalf("Failed to check legacy user: %v", err)
+	}
+	if exists {
+		t.Error("Expected legacy user to be gone after the rename")
+	}
+
+	groups, err := setup.Manager.GetRoleMemberships("test_new_svc")
+	if err != nil {
+		t.Fatalf("Failed to get memberships: %v", err)
+	}
+	if len(groups) != 1 || groups[0] != "test_readers" {
+		t.Errorf("Expected renamed user to keep its membership, got %v", groups)
+	}
+
+	// Once renamed, a second sync leaves the user alone
+	result, err = setup.Manager.SyncConfiguration(config)
+	if err != nil {
+		t.Fatalf("Second sync failed: %v", err)
+	}
+	if len(result.UsersRenamed) != 0 {
+		t.Errorf("Expected no renames on the second sync, got %v", result.UsersRenamed)
+	}
+}
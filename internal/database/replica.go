@@ -0,0 +1,109 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrReadReplica is returned for changes on a server in recovery, such as an Aurora reader
+// or a streaming replica, which accepts connections but refuses every write
+var ErrReadReplica = errors.New("connected to a read replica")
+
+// inRecovery reports whether a server is a read replica
+func inRecovery(ctx context.Context, db *sql.DB) (bool, error) {
+	var recovery bool
+	if err := db.QueryRowContext(ctx, "SELECT pg_is_in_recovery()").Scan(&recovery); err != nil {
+		return false, fmt.Errorf("failed to check whether the server is in recovery: %w", err)
+	}
+	return recovery, nil
+}
+
+// checkWritable fails with ErrReadReplica when the connected server is a read replica. It
+// checks once, before the first change, so read-only commands still work on replicas.
+func (m *Manager) checkWritable() error {
+	if m.db == nil {
+		return nil
+	}
+
+	m.writableOnce.Do(func() {
+		recovery, err := inRecovery(m.context(), m.db)
+		switch {
+		case err != nil:
+			m.writableErr = err
+		case recovery:
+			host := ""
+			if m.conn != nil {
+				host = m.conn.Host
+			}
+			m.writableErr = fmt.Errorf("%w: %s is in recovery and cannot run DDL; connect to the writer (cluster) endpoint or list the cluster's endpoints in POSTGRES_ENDPOINTS", ErrReadReplica, host)
+		}
+	})
+	return m.writableErr
+}
+
+// connectToWriter makes sure a connection with a list of endpoints reaches the writer. When
+// the host is a read replica, the endpoints are tried in order and the first that is not in
+// recovery replaces it, returning its connection and details; the replica's is closed. When
+// no endpoint is the writer the replica's connection is kept, so read-only commands still
+// work and checkWritable stops the first change.
+func connectToWriter(ctx context.Context, db *sql.DB, conn *structs.DatabaseConnection, logger *logrus.Logger) (*sql.DB, *structs.DatabaseConnection) {
+	recovery, err := inRecovery(ctx, db)
+	if err != nil {
+		logger.WithError(err).Warn("Could not check whether the server is a read replica, keeping the connection")
+		return db, conn
+	}
+	if !recovery {
+		return db, conn
+	}
+
+	logger.WithFields(logrus.Fields{
+		"host":      conn.Host,
+		"endpoints": conn.Endpoints,
+	}).Warn("Connected to a read replica, looking for the writer among the cluster endpoints")
+
+	var failures []error
+	for _, endpoint := range conn.Endpoints {
+		host, port, err := structs.ParseEndpoint(endpoint, conn.Port)
+		if err != nil {
+			failures = append(failures, err)
+			continue
+		}
+		if host == conn.Host && port == conn.Port {
+			continue
+		}
+
+		candidate := *conn
+		candidate.Host, candidate.Port = host, port
+		candidateDB, err := openDatabase(&candidate, logger)
+		if err == nil {
+			err = pingWithRetry(ctx, candidateDB, &candidate, logger)
+		}
+		if err == nil {
+			if recovery, err = inRecovery(ctx, candidateDB); err == nil && !recovery {
+				logger.WithFields(logrus.Fields{
+					"from": conn.Host,
+					"to":   host,
+				}).Warn("Failed over to the writer")
+				db.Close()
+				return candidateDB, &candidate
+			}
+		}
+		if candidateDB != nil {
+			candidateDB.Close()
+		}
+		if err != nil {
+			failures = append(failures, fmt.Errorf("%s: %w", endpoint, err))
+		}
+	}
+
+	logger.WithFields(logrus.Fields{
+		"host":      conn.Host,
+		"endpoints": conn.Endpoints,
+	}).WithError(errors.Join(failures...)).Warn("None of the endpoints is the writer, staying on the read replica")
+	return db, conn
+}
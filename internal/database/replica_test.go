@@ -0,0 +1,59 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+func TestCheckWritable(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	// Without a connection, as in unit tests, there is nothing to check
+	manager := &Manager{logger: logger, ctx: context.Background()}
+	if err := manager.checkWritable(); err != nil {
+		t.Errorf("Expected no check without a connection, got %v", err)
+	}
+
+	// Nothing listens on port 1, so the check fails and no statement is sent
+	db, err := sql.Open("postgres", "host=127.0.0.1 port=1 sslmode=disable connect_timeout=1")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	manager = &Manager{logger: logger, ctx: context.Background(), db: db}
+	_, err = manager.executor().Exec("CREATE ROLE app")
+	if err == nil || !strings.Contains(err.Error(), "failed to check whether the server is in recovery") {
+		t.Fatalf("Expected the recovery check to fail, got %v", err)
+	}
+
+	// The outcome is kept, so the server is asked once per manager
+	db.Close()
+	if again := manager.checkWritable(); again != err {
+		t.Errorf("Expected the first outcome to be reused, got %v", again)
+	}
+}
+
+func TestConnectToWriterKeepsConnection(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	// A server that cannot be asked whether it is a replica is left to checkWritable
+	db, err := sql.Open("postgres", "host=127.0.0.1 port=1 sslmode=disable connect_timeout=1")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	conn := &structs.DatabaseConnection{Host: "127.0.0.1", Port: 1, Endpoints: []string{"127.0.0.1:2"}}
+	kept, keptConn := connectToWriter(context.Background(), db, conn, logger)
+	if kept != db || keptConn != conn {
+		t.Errorf("Expected the connection to be kept, got %p %+v", kept, keptConn)
+	}
+}
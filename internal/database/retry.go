@@ -0,0 +1,132 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+// Waits between connection attempts, doubling from the initial one
+const (
+	retryInitialBackoff = time.Second
+	retryMaxBackoff     = 10 * time.Second
+)
+
+// transientErrorCodes are the server errors of a cluster that is starting up or failing
+// over rather than refusing the connection: cannot_connect_now and the connection exception
+// class
+var transientErrorCodes = map[string]bool{
+	"57P03": true, // cannot_connect_now
+	"08000": true, // connection_exception
+	"08001": true, // sqlclient_unable_to_establish_sqlconnection
+	"08006": true, // connection_failure
+}
+
+// pingWithRetry checks that the database answers, retrying connection errors that may pass
+// with exponential backoff: up to the connection's retry count, or for as long as its resume
+// timeout allows. Aurora Serverless clusters pause when idle and take several seconds, up to
+// a minute for v1, to resume on the first connection: depending on the version the endpoint
+// holds the connection until the cluster is up, or refuses or drops it meanwhile. Retries
+// also stop when the deadline of the context, such as the command's --timeout, is about to
+// run out. Authentication and other errors fail at once.
+func pingWithRetry(ctx context.Context, db *sql.DB, conn *structs.DatabaseConnection, logger *logrus.Logger) error {
+	budget := ctx
+	if conn.ResumeTimeout > 0 {
+		var cancel context.CancelFunc
+		budget, cancel = context.WithTimeout(ctx, conn.ResumeTimeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	backoff := retryInitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := db.PingContext(budget)
+		if err == nil {
+			if attempt > 1 {
+				logger.WithFields(logrus.Fields{
+					"attempts": attempt,
+					"waited":   time.Since(start).Round(time.Millisecond),
+				}).Info("Database answered after retrying")
+			}
+			return nil
+		}
+		if ctx.Err() != nil || !transientError(err) {
+			return err
+		}
+
+		// A resume timeout retries until it is spent; otherwise the retries are counted
+		if conn.ResumeTimeout <= 0 && attempt > conn.ConnectRetries {
+			if attempt == 1 {
+				return err
+			}
+			return fmt.Errorf("database did not answer after %d attempts: %w", attempt, err)
+		}
+
+		// A wait that would outlast the budget cannot end in a successful attempt
+		if deadline, ok := budget.Deadline(); ok && time.Until(deadline) < backoff {
+			if conn.ResumeTimeout > 0 {
+				return fmt.Errorf("database did not resume within %s: %w", time.Since(start).Round(time.Second), err)
+			}
+			return fmt.Errorf("database did not answer before the deadline after %d attempts: %w", attempt, err)
+		}
+
+		logger.WithFields(logrus.Fields{
+			"attempt": attempt,
+			"waited":  time.Since(start).Round(time.Millisecond),
+			"backoff": backoff,
+			"error":   err,
+		}).Warn("Database is not answering, retrying")
+
+		select {
+		case <-budget.Done():
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("database did not resume within %s: %w", time.Since(start).Round(time.Second), err)
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, retryMaxBackoff)
+	}
+}
+
+// transientError reports whether a connection error may pass, as with a cluster that is
+// resuming or failing over, as opposed to one that answered and rejected the connection
+func transientError(err error) bool {
+	if code, _, ok := sqlState(err); ok {
+		return transientErrorCodes[code]
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET)
+}
+
+// configurePool applies the pool limits of a connection, keeping the database/sql default
+// of each limit that is not set. Behind RDS Proxy or with IAM authentication a maximum
+// lifetime makes the pool reconnect regularly, picking up rebalanced proxies and fresh
+// tokens instead of holding the first connections forever.
+func configurePool(db *sql.DB, pool structs.PoolConfig) {
+	if pool.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(pool.MaxOpenConns)
+	}
+	if pool.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(pool.MaxIdleConns)
+	}
+	if pool.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	}
+	if pool.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(pool.ConnMaxIdleTime)
+	}
+}
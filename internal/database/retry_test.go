@@ -0,0 +1,132 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+)
+
+func TestTransientError(t *testing.T) {
+	cases := []struct {
+		err       error
+		transient bool
+	}{
+		{&pq.Error{Code: "57P03", Message: "the database system is starting up"}, true},
+		{fmt.Errorf("failed to connect: %w", &pq.Error{Code: "08006"}), true},
+		{&pq.Error{Code: "28P01", Message: "password authentication failed"}, false},
+		{&pq.Error{Code: "53300", Message: "too many connections"}, false},
+		{fmt.Errorf("failed to connect: %w", &pgconn.PgError{Code: "57P03"}), true},
+		{&pgconn.PgError{Code: "28P01"}, false},
+		{&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, true},
+		{syscall.ECONNRESET, true},
+		{errors.New("pq: SSL is not enabled on the server"), false},
+	}
+	for _, c := range cases {
+		if got := transientError(c.err); got != c.transient {
+			t.Errorf("transientError(%v) = %t, expected %t", c.err, got, c.transient)
+		}
+	}
+}
+
+func TestPingWithRetry(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	// Nothing listens on the port, as while a paused cluster refuses connections
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to reserve a port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	conn := &structs.DatabaseConnection{Host: "127.0.0.1", Port: port, Username: "u", Database: "d", SSLMode: "disable"}
+	db, err := sql.Open("postgres", connectionString(conn, "p"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	// Without a resume timeout the first refusal fails
+	start := time.Now()
+	if err := pingWithRetry(context.Background(), db, conn, logger); err == nil {
+		t.Fatal("Expected a refused connection to fail")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected no retries without a resume timeout, took %s", elapsed)
+	}
+
+	// Retries are counted, with the wait doubling after each attempt
+	conn.ConnectRetries = 2
+	start = time.Now()
+	err = pingWithRetry(context.Background(), db, conn, logger)
+	if err == nil || !strings.Contains(err.Error(), "database did not answer after 3 attempts") {
+		t.Fatalf("Expected the attempts to be reported, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 3*time.Second || elapsed > 5*time.Second {
+		t.Errorf("Expected waits of one and two seconds, took %s", elapsed)
+	}
+	conn.ConnectRetries = 0
+
+	// With a resume timeout, refusals are retried until it is spent
+	conn.ResumeTimeout = 2 * time.Second
+	start = time.Now()
+	err = pingWithRetry(context.Background(), db, conn, logger)
+	if err == nil || !strings.Contains(err.Error(), "database did not resume") {
+		t.Fatalf("Expected the resume timeout to be reported, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second || elapsed > 3*time.Second {
+		t.Errorf("Expected retries within the resume timeout, took %s", elapsed)
+	}
+
+	// The deadline of the context bounds the wait as well
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	conn.ResumeTimeout = time.Minute
+	start = time.Now()
+	if err := pingWithRetry(ctx, db, conn, logger); err == nil {
+		t.Fatal("Expected the context deadline to end the wait")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected the context deadline to bound the wait, took %s", elapsed)
+	}
+}
+
+func TestConnectionStringDialTimeout(t *testing.T) {
+	conn := &structs.DatabaseConnection{Host: "h", Port: 5432, ConnectTimeout: 5 * time.Second}
+	if dsn := connectionString(conn, "p"); !strings.HasSuffix(dsn, " connect_timeout=5") {
+		t.Errorf("Expected the connect timeout in %q", dsn)
+	}
+	conn.ResumeTimeout = 1500 * time.Millisecond
+	conn.ConnectTimeout = 0
+	if dsn := connectionString(conn, "p"); !strings.HasSuffix(dsn, " connect_timeout=2") {
+		t.Errorf("Expected the resume timeout rounded up in %q", dsn)
+	}
+	if dsn := connectionString(&structs.DatabaseConnection{Host: "h"}, "p"); strings.Contains(dsn, "connect_timeout") {
+		t.Errorf("Expected no connect timeout in %q", dsn)
+	}
+}
+
+func TestConfigurePool(t *testing.T) {
+	db, err := sql.Open("postgres", "host=localhost")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	configurePool(db, structs.PoolConfig{MaxOpenConns: 3, ConnMaxLifetime: time.Minute})
+	if stats := db.Stats(); stats.MaxOpenConnections != 3 {
+		t.Errorf("Expected at most 3 open connections, got %d", stats.MaxOpenConnections)
+	}
+}
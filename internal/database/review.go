@@ -0,0 +1,111 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/lib/pq"
+)
+
+const (
+	// passwordChangedMetadataKey records when a user's password was last set by this tool,
+	// so access reviews can show how long ago credentials were rotated
+	passwordChangedMetadataKey = "password_changed_at"
+
+	// reviewKindUnmanaged is the kind of roles that sync neither created nor adopted
+	reviewKindUnmanaged = "unmanaged"
+)
+
+// AccessReview lists the roles managed by this tool, or every role except the built-in
+// pg_ roles when includeUnmanaged is set, with their attributes, direct memberships,
+// database grants and the history recorded in their comments, ordered by name
+func (m *Manager) AccessReview(includeUnmanaged bool) ([]structs.ReviewRole, error) {
+	query := `
+		SELECT r.rolname, r.rolcanlogin, r.rolsuper, r.rolcreaterole, r.rolcreatedb, r.rolconnlimit,
+			CASE WHEN r.rolvaliduntil = 'infinity' THEN NULL ELSE r.rolvaliduntil END,
+			COALESCE(shobj_description(r.oid, 'pg_authid'), ''),
+			ARRAY(
+				SELECT g.rolname FROM pg_auth_members am JOIN pg_roles g ON g.oid = am.roleid
+				WHERE am.member = r.oid ORDER BY 1),
+			ARRAY(
+				SELECT u.rolname FROM pg_auth_members am JOIN pg_roles u ON u.oid = am.member
+				WHERE am.roleid = r.oid ORDER BY 1),
+			ARRAY(
+				SELECT a.privilege_type || ' ON ' || d.datname
+				FROM pg_database d CROSS JOIN LATERAL aclexplode(d.datacl) a
+				WHERE a.grantee = r.oid AND d.datdba <> r.oid ORDER BY d.datname, a.privilege_type),
+			ARRAY(SELECT d.datname FROM pg_database d WHERE d.datdba = r.oid AND NOT d.datistemplate ORDER BY 1)
+		FROM pg_roles r
+		WHERE r.rolname !~ '^pg_'
+		ORDER BY r.rolname`
+
+	rows, err := m.executor().Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list roles for access review: %w", err)
+	}
+	defer rows.Close()
+
+	roles := []structs.ReviewRole{}
+	for rows.Next() {
+		var role structs.ReviewRole
+		var validUntil sql.NullTime
+		var comment string
+		var grants []string
+		if err := rows.Scan(&role.Name, &role.CanLogin, &role.Superuser, &role.CreateRole, &role.CreateDB,
+			&role.ConnectionLimit, &validUntil, &comment, pq.Array(&role.MemberOf), pq.Array(&role.Members),
+			pq.Array(&grants), pq.Array(&role.OwnedDatabases)); err != nil {
+			return nil, fmt.Errorf("failed to scan role for access review: %w", err)
+		}
+
+		var metadata map[string]string
+		role.Description, metadata = parseRoleComment(comment)
+		role.Kind = metadata[managedMetadataKey]
+		if role.Kind == "" {
+			if !includeUnmanaged {
+				continue
+			}
+			role.Kind = reviewKindUnmanaged
+		}
+		reviewMetadata(&role, metadata)
+		if validUntil.Valid {
+			role.ValidUntil = &validUntil.Time
+		}
+
+		role.Grants = []structs.PrivilegeGrant{}
+		for _, grant := range grants {
+			privilege, database, _ := strings.Cut(grant, " ON ")
+			role.Grants = append(role.Grants, structs.PrivilegeGrant{Target: role.Name, Privilege: privilege, Database: database})
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+// reviewMetadata fills in the ownership, auth methods, protection and change history of a
+// role from its comment metadata
+func reviewMetadata(role *structs.ReviewRole, metadata map[string]string) {
+	role.Owner = metadata[ownerMetadataKey]
+	role.Team = metadata[teamMetadataKey]
+	role.Ticket = metadata[ticketMetadataKey]
+	role.CreatedBy = metadata["created_by"]
+	role.Auth = metadata["auth"]
+	role.DeletionProtection = metadata[protectionMetadataKey] == "true"
+	role.ModifiedBy = metadata["modified_by"]
+	role.CreatedAt = metadataTime(metadata, "created_at")
+	role.ModifiedAt = metadataTime(metadata, "modified_at")
+	role.PasswordChangedAt = metadataTime(metadata, passwordChangedMetadataKey)
+}
+
+// metadataTime parses a timestamp recorded in comment metadata, or returns nil when it is
+// missing or not a timestamp
+func metadataTime(metadata map[string]string, key string) *time.Time {
+	t, err := time.Parse(time.RFC3339, metadata[key])
+	if err != nil {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,65 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+func TestAccessReview(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	config := &structs.Config{
+		Groups: []structs.GroupConfig{
+			{Name: "test_review_group", Description: "Reviewed group", Privileges: []string{"CONNECT"}, Databases: []string{"testdb"}},
+		},
+		Users: []structs.UserConfig{
+			{Username: "test_review_user", Password: "review_password", Groups: []string{"test_review_group"}, Enabled: true, CanLogin: true, Owner: "jane", Team: "payments"},
+		},
+	}
+	setup.Manager.SetPrincipal("os:auditor")
+	defer setup.Manager.SetPrincipal("")
+	if _, err := setup.Manager.SyncConfiguration(config); err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+	if err := setup.Manager.CreateGroup(&structs.GroupConfig{Name: "test_review_unmanaged"}); err != nil {
+		t.Fatalf("Failed to create group: %v", err)
+	}
+
+	roles, err := setup.Manager.AccessReview(false)
+	if err != nil {
+		t.Fatalf("Failed to export access review: %v", err)
+	}
+	byName := make(map[string]structs.ReviewRole)
+	for _, role := range roles {
+		byName[role.Name] = role
+	}
+
+	if _, ok := byName["test_review_unmanaged"]; ok {
+		t.Error("Expected roles not managed by sync to be left out")
+	}
+	group := byName["test_review_group"]
+	if group.Kind != "group" || group.Description != "Reviewed group" || len(group.Members) != 1 || group.Members[0] != "test_review_user" {
+		t.Errorf("Unexpected group in review: %+v", group)
+	}
+	if len(group.Grants) != 1 || group.Grants[0].Privilege != "CONNECT" || group.Grants[0].Database != "testdb" {
+		t.Errorf("Expected CONNECT on testdb, got %+v", group.Grants)
+	}
+	user := byName["test_review_user"]
+	if user.Kind != "user" || !user.CanLogin || user.CreatedBy != "os:auditor" || user.Owner != "jane" || user.Team != "payments" || user.PasswordChangedAt == nil {
+		t.Errorf("Unexpected user in review: %+v", user)
+	}
+
+	roles, err = setup.Manager.AccessReview(true)
+	if err != nil {
+		t.Fatalf("Failed to export access review: %v", err)
+	}
+	for _, role := range roles {
+		if role.Name == "test_review_unmanaged" && role.Kind == "unmanaged" {
+			return
+		}
+	}
+	t.Errorf("Expected test_review_unmanaged to be listed as unmanaged, got %+v", roles)
+}
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// RevisionRole is the marker role whose comment records the configuration revision last
+	// applied to the cluster. Role comments are shared by every database of the cluster, so
+	// the revision is found whichever database a later command connects to.
+	RevisionRole = "postgres_user_manager_revision"
+
+	revisionDescription = "Configuration revision applied by postgres-user-manager"
+	revisionChecksumKey = "config_checksum"
+	revisionProfileKey  = "profile"
+	revisionVersionKey  = "tool_version"
+)
+
+// RecordRevision records the configuration revision a sync applied in the comment of the
+// marker role, creating it as a role without login or privileges the first time
+func (m *Manager) RecordRevision(revision structs.ConfigRevision) error {
+	exists, err := m.roleExists(RevisionRole)
+	if err != nil {
+		return fmt.Errorf("failed to check revision marker role: %w", err)
+	}
+	if !exists {
+		if err := m.execute(fmt.Sprintf("CREATE ROLE %s NOLOGIN", m.quoteIdentifier(RevisionRole))); err != nil {
+			return fmt.Errorf("failed to create revision marker role: %w", err)
+		}
+	}
+
+	// The profile key is cleared for a sync without one so the record always describes a
+	// single run
+	metadata := map[string]string{
+		revisionChecksumKey: revision.Checksum,
+		revisionProfileKey:  revision.Profile,
+		revisionVersionKey:  revision.ToolVersion,
+	}
+	if err := m.stampRole(RevisionRole, revisionDescription, "applied", metadata); err != nil {
+		return err
+	}
+
+	m.logger.WithFields(logrus.Fields{
+		"checksum": revision.Checksum,
+		"profile":  revision.Profile,
+	}).Info("Recorded configuration revision")
+	return nil
+}
+
+// GetRevision returns the configuration revision last recorded in the cluster, or nil when
+// no sync has recorded one
+func (m *Manager) GetRevision() (*structs.ConfigRevision, error) {
+	comment, err := m.GetRoleComment(RevisionRole)
+	if err != nil {
+		return nil, err
+	}
+	_, metadata := parseRoleComment(comment)
+	if metadata[revisionChecksumKey] == "" {
+		return nil, nil
+	}
+
+	revision := &structs.ConfigRevision{
+		Checksum:    metadata[revisionChecksumKey],
+		Profile:     metadata[revisionProfileKey],
+		ToolVersion: metadata[revisionVersionKey],
+		AppliedBy:   metadata["applied_by"],
+	}
+	if appliedAt, err := time.Parse(time.RFC3339, metadata["applied_at"]); err == nil {
+		revision.AppliedAt = appliedAt
+	}
+	return revision, nil
+}
@@ -0,0 +1,50 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+func TestRecordRevision(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.Manager.DropGroup(RevisionRole)
+
+	revision, err := setup.Manager.GetRevision()
+	if err != nil {
+		t.Fatalf("Failed to get revision: %v", err)
+	}
+	if revision != nil {
+		t.Fatalf("Expected no revision before the first record, got %+v", revision)
+	}
+
+	setup.Manager.SetPrincipal("ci-pipeline")
+	defer setup.Manager.SetPrincipal("")
+	before := time.Now().Add(-time.Second)
+	if err := setup.Manager.RecordRevision(structs.ConfigRevision{Checksum: "sha256:abc", Profile: "prod", ToolVersion: "v1.2.3"}); err != nil {
+		t.Fatalf("Failed to record revision: %v", err)
+	}
+	if err := setup.Manager.RecordRevision(structs.ConfigRevision{Checksum: "sha256:def", ToolVersion: "v1.2.4"}); err != nil {
+		t.Fatalf("Failed to record revision again: %v", err)
+	}
+
+	revision, err = setup.Manager.GetRevision()
+	if err != nil {
+		t.Fatalf("Failed to get revision: %v", err)
+	}
+	if revision == nil || revision.Checksum != "sha256:def" || revision.ToolVersion != "v1.2.4" || revision.AppliedBy != "ci-pipeline" {
+		t.Fatalf("Expected the latest revision, got %+v", revision)
+	}
+	if revision.Profile != "" {
+		t.Errorf("Expected the profile of the earlier revision to be cleared, got %s", revision.Profile)
+	}
+	if revision.AppliedAt.Before(before) {
+		t.Errorf("Expected the revision to be applied now, got %s", revision.AppliedAt)
+	}
+
+	if exists, canLogin, err := setup.Manager.RoleCanLogin(RevisionRole); err != nil || !exists || canLogin {
+		t.Errorf("Expected a marker role without login, got exists=%t login=%t err=%v", exists, canLogin, err)
+	}
+}
@@ -0,0 +1,69 @@
+package database
+
+import (
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+// RoleManager is the part of Manager that creates, drops and looks up roles, their
+// memberships and their database privileges. Package fake implements it in memory, so code
+// that only needs these methods, such as the server and events packages, can accept a
+// subset of it and be tested without a database.
+type RoleManager interface {
+	Ping() error
+	Close() error
+	UserExists(username string) (bool, error)
+	GroupExists(groupName string) (bool, error)
+	RoleCanLogin(name string) (bool, bool, error)
+	RoleExternalID(name string) (bool, string, error)
+	ManagedKind(role string) (string, error)
+	GetRoleAttributes(name string) (*structs.RoleAttributes, error)
+	CreateUser(user *structs.UserConfig) error
+	DropUser(username string) error
+	CreateGroup(group *structs.GroupConfig) error
+	DropGroup(groupName string) error
+	DisableUser(username string) (bool, error)
+	EnableUser(username string) (bool, error)
+	SetConnectionLimit(role string, limit int) (int, error)
+	IsDeletionProtected(role string) (bool, error)
+	SetDeletionProtection(role string, protected bool) error
+	AddUserToGroup(username, groupName string) error
+	RemoveUserFromGroup(username, groupName string) error
+	GetRoleMemberships(role string) ([]string, error)
+	GetGroupMembers(group string) ([]string, error)
+	GrantPrivileges(target string, privileges []string, databases []string) error
+	RevokePrivileges(target string, privileges []string, databases []string) error
+	GetDatabasePrivileges(role string) ([]structs.PrivilegeGrant, error)
+}
+
+var _ RoleManager = (*Manager)(nil)
+
+// Syncer is the part of Manager the sync command drives: the role methods, the settings of a
+// sync, the sync itself and the revision recorded once it applied everything. Package fake
+// implements it on its catalog, so sync can be driven without a database.
+type Syncer interface {
+	RoleManager
+	SetSlowOperationThreshold(threshold time.Duration)
+	SetExactMemberships(exact bool)
+	SetExactPrivileges(exact bool)
+	SetAutoGrantAdmin(auto bool)
+	SetGrantWorkers(workers int)
+	SetUserWorkers(workers int)
+	SetSkipPreflight(skip bool)
+	SetDeferElevated(deferElevated bool)
+	SetChangeLimits(limits structs.ChangeLimitsConfig)
+	SetAllowLargeChange(allow bool)
+	SetReassignTo(role string)
+	SetCascade(cascade bool)
+	SetTerminateSessions(terminate bool, grace time.Duration)
+	SetOverrideProtection(override bool)
+	SetTransactional(transactional bool)
+	SetPrune(action string) error
+	SetRotateExpired(maxAge time.Duration)
+	SetCheckpoint(checkpoint *Checkpoint)
+	SyncConfiguration(config *structs.Config) (*structs.SyncResult, error)
+	RecordRevision(revision structs.ConfigRevision) error
+}
+
+var _ Syncer = (*Manager)(nil)
@@ -0,0 +1,102 @@
+package database
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/secrets"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+)
+
+// SetRotateExpired makes sync replace the generated passwords of users that were last set
+// maxAge ago or earlier. A zero maxAge disables rotation.
+func (m *Manager) SetRotateExpired(maxAge time.Duration) {
+	m.rotateMaxAge = maxAge
+}
+
+// PasswordExpired reports whether a password set at changedAt has reached the maximum age.
+// A password this tool never set has an unknown age and counts as expired.
+func PasswordExpired(changedAt *time.Time, maxAge time.Duration, now time.Time) bool {
+	if changedAt == nil {
+		return true
+	}
+	return !now.Before(changedAt.Add(maxAge))
+}
+
+// HasPasswordAuth reports whether a role can log in with a password: it can log in and was
+// either created for password authentication or before auth methods were recorded
+func HasPasswordAuth(attributes *structs.RoleAttributes) bool {
+	if !attributes.CanLogin {
+		return false
+	}
+	return len(attributes.AuthMethods) == 0 || slices.Contains(attributes.AuthMethods, structs.AuthMethodPassword)
+}
+
+// RotatePassword replaces the password of an existing user, sending only its SCRAM-SHA-256
+// verifier, and records when it was changed in the role's comment
+func (m *Manager) RotatePassword(username, password string) error {
+	exists, err := m.UserExists(username)
+	if err != nil {
+		return fmt.Errorf("failed to check if user exists: %w", err)
+	}
+	if !exists && !m.dryRun {
+		return fmt.Errorf("user %s does not exist", username)
+	}
+
+	verifier, err := scramSHA256Verifier(password)
+	if err != nil {
+		return err
+	}
+
+	m.logger.WithField("username", username).Info("Rotating password")
+
+	query := fmt.Sprintf("ALTER ROLE %s PASSWORD %s", m.quoteIdentifier(username), pq.QuoteLiteral(verifier))
+	if err := m.execute(query); err != nil {
+		return fmt.Errorf("failed to rotate password of user %s: %w", username, err)
+	}
+
+	metadata := map[string]string{passwordChangedMetadataKey: time.Now().UTC().Format(time.RFC3339)}
+	if err := m.stampRole(username, "", "password_rotated", metadata); err != nil {
+		return err
+	}
+
+	m.logger.WithField("username", username).Info("Password rotated successfully")
+	return nil
+}
+
+// rotateExpiredPassword replaces the password of a user whose generated password has reached
+// the maximum age, returning the new password, or an empty string when the user is not due.
+// Only users with generate_password are rotated: a password in the configuration would be
+// set back by the next sync, and IAM and certificate users have none. A user created by this
+// sync already holds its generated password and is skipped.
+func (m *Manager) rotateExpiredPassword(user *structs.UserConfig) (string, error) {
+	if !user.GeneratePassword || user.Password != "" || !user.HasAuthMethod(structs.AuthMethodPassword) {
+		return "", nil
+	}
+
+	attributes, err := m.GetRoleAttributes(user.Username)
+	if err != nil || attributes == nil || !HasPasswordAuth(attributes) {
+		return "", err
+	}
+	if !PasswordExpired(attributes.PasswordChangedAt, m.rotateMaxAge, time.Now()) {
+		return "", nil
+	}
+
+	m.logger.WithFields(logrus.Fields{
+		"username":            user.Username,
+		"password_changed_at": attributes.PasswordChangedAt,
+		"max_age":             m.rotateMaxAge.String(),
+	}).Info("Password has expired")
+
+	password, err := secrets.GeneratePassword(user.PasswordLength, user.PasswordCharset)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate password for user %s: %w", user.Username, err)
+	}
+	if err := m.RotatePassword(user.Username, password); err != nil {
+		return "", err
+	}
+	return password, nil
+}
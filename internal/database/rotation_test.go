@@ -0,0 +1,95 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+func TestPasswordExpired(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	maxAge := 90 * 24 * time.Hour
+	recent := now.AddDate(0, 0, -89)
+	due := now.AddDate(0, 0, -90)
+
+	if PasswordExpired(&recent, maxAge, now) {
+		t.Error("Expected a password set 89 days ago not to have expired")
+	}
+	if !PasswordExpired(&due, maxAge, now) {
+		t.Error("Expected a password set 90 days ago to have expired")
+	}
+	if !PasswordExpired(nil, maxAge, now) {
+		t.Error("Expected a password of unknown age to have expired")
+	}
+}
+
+func TestHasPasswordAuth(t *testing.T) {
+	tests := []struct {
+		attributes structs.RoleAttributes
+		want       bool
+	}{
+		{structs.RoleAttributes{CanLogin: true}, true},
+		{structs.RoleAttributes{CanLogin: true, AuthMethods: []string{"iam", "password"}}, true},
+		{structs.RoleAttributes{CanLogin: true, AuthMethods: []string{"iam"}}, false},
+		{structs.RoleAttributes{CanLogin: false, AuthMethods: []string{"password"}}, false},
+	}
+
+	for _, tt := range tests {
+		if got := HasPasswordAuth(&tt.attributes); got != tt.want {
+			t.Errorf("HasPasswordAuth(%+v) = %v, want %v", tt.attributes, got, tt.want)
+		}
+	}
+}
+
+func TestSyncRotatesExpiredPasswords(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	config := &structs.Config{
+		Users: []structs.UserConfig{
+			{Username: "test_rotated_user", GeneratePassword: true, Enabled: true, CanLogin: true},
+			{Username: "test_fixed_password_user", Password: "configured-password-1", Enabled: true, CanLogin: true},
+		},
+	}
+	setup.Manager.SetRotateExpired(30 * 24 * time.Hour)
+
+	// Users created by the sync hold fresh passwords
+	result, err := setup.Manager.SyncConfiguration(config)
+	if err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+	if len(result.RotatedPasswords) != 0 {
+		t.Errorf("Expected no rotation for new users, got %v", result.RotatedPasswords)
+	}
+
+	// Age both passwords past the maximum
+	old := map[string]string{passwordChangedMetadataKey: time.Now().AddDate(0, 0, -31).UTC().Format(time.RFC3339)}
+	for _, user := range config.Users {
+		if err := setup.Manager.stampRole(user.Username, "", "modified", old); err != nil {
+			t.Fatalf("Failed to backdate password of %s: %v", user.Username, err)
+		}
+	}
+
+	config.Users[0].Password = ""
+	result, err = setup.Manager.SyncConfiguration(config)
+	if err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+	if len(result.RotatedPasswords) != 1 || result.RotatedPasswords[0].Username != "test_rotated_user" || result.RotatedPasswords[0].Password == "" {
+		t.Fatalf("Expected only the generated password to be rotated, got %v", result.RotatedPasswords)
+	}
+
+	attributes, err := setup.Manager.GetRoleAttributes("test_rotated_user")
+	if err != nil {
+		t.Fatalf("Failed to get attributes: %v", err)
+	}
+	if attributes.PasswordChangedAt == nil || time.Since(*attributes.PasswordChangedAt) > time.Hour {
+		t.Errorf("Expected the rotation to be recorded, got %v", attributes.PasswordChangedAt)
+	}
+
+	if err := setup.Manager.RotatePassword("test_missing_user", "new-password-123"); err == nil {
+		t.Error("Expected rotating a missing user to fail")
+	}
+}
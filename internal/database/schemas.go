@@ -0,0 +1,187 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+// schemaPrivilegesIn lists the privileges ALL stands for on a schema
+var schemaPrivilegesIn = map[string][]string{
+	"ALL":    {"USAGE", "CREATE"},
+	"USAGE":  {"USAGE"},
+	"CREATE": {"CREATE"},
+}
+
+// schemaDrift is how a schema of the connected database differs from its configuration
+type schemaDrift struct {
+	Missing    bool                           // The schema does not exist
+	Owner      *structs.SchemaOwnerChange     // The schema is owned by another role, nil when it is not
+	Privileges []structs.SchemaPrivilegeGrant // Configured privileges not granted
+}
+
+// schemaName is how a sync reports a configured schema, naming its database when it is not
+// the connected one so schemas of the same name in different databases stay apart
+func schemaName(schema *structs.SchemaConfig) string {
+	if schema.Database == "" {
+		return schema.Name
+	}
+	return fmt.Sprintf("%s (database %s)", schema.Name, schema.Database)
+}
+
+// ApplySchema creates a configured schema when it does not exist, gives it to its configured
+// owner and grants the configured privileges that are missing, connected to the database the
+// schema belongs to. Privileges that are not configured are left alone. It reports whether
+// anything changed.
+func (m *Manager) ApplySchema(schema *structs.SchemaConfig) (bool, error) {
+	if m.otherDatabase(schema.Database) {
+		var changed bool
+		err := m.InDatabase(schema.Database, func(db *Manager) error {
+			var err error
+			changed, err = db.ApplySchema(schema)
+			return err
+		})
+		return changed, err
+	}
+
+	m.logger.WithFields(logrus.Fields{
+		"schema": schema.Name,
+		"owner":  schema.Owner,
+	}).Info("Applying schema")
+
+	drift, err := m.schemaDrift(schema)
+	if err != nil {
+		return false, err
+	}
+
+	schemaIdent := m.quoteIdentifier(schema.Name)
+	if drift.Missing {
+		query := "CREATE SCHEMA " + schemaIdent
+		if schema.Owner != "" {
+			query += " AUTHORIZATION " + m.quoteIdentifier(schema.Owner)
+		}
+		if err := m.execute(query); err != nil {
+			return false, fmt.Errorf("failed to create schema %s: %w", schema.Name, err)
+		}
+	}
+
+	if drift.Owner != nil {
+		query := fmt.Sprintf("ALTER SCHEMA %s OWNER TO %s", schemaIdent, m.quoteIdentifier(schema.Owner))
+		if err := m.execute(query); err != nil {
+			return false, fmt.Errorf("failed to change owner of schema %s: %w", schema.Name, err)
+		}
+	}
+
+	for _, grant := range drift.Privileges {
+		query := fmt.Sprintf("GRANT %s ON SCHEMA %s TO %s", grant.Privilege, schemaIdent, m.quoteIdentifier(grant.Target))
+		if err := m.execute(query); err != nil {
+			return false, fmt.Errorf("failed to grant %s on schema %s to %s: %w", grant.Privilege, schema.Name, grant.Target, err)
+		}
+	}
+
+	changed := drift.Missing || drift.Owner != nil || len(drift.Privileges) > 0
+	if changed {
+		m.logger.WithField("schema", schema.Name).Info("Schema applied successfully")
+	} else {
+		m.logger.WithField("schema", schema.Name).Info("Schema matches the configuration, skipping")
+	}
+	return changed, nil
+}
+
+// diffSchemas reports the configured schemas that do not exist, are owned by another role or
+// lack configured privileges
+func (m *Manager) diffSchemas(schemas []structs.SchemaConfig, report *structs.DriftReport) error {
+	for i := range schemas {
+		var drift *schemaDrift
+		err := m.InDatabase(schemas[i].Database, func(db *Manager) error {
+			var err error
+			drift, err = db.schemaDrift(&schemas[i])
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if drift.Missing {
+			report.SchemasMissing = append(report.SchemasMissing, schemaName(&schemas[i]))
+		}
+		if drift.Owner != nil {
+			report.SchemaOwnersChanged = append(report.SchemaOwnersChanged, *drift.Owner)
+		}
+		report.SchemaPrivilegesMissing = append(report.SchemaPrivilegesMissing, drift.Privileges...)
+	}
+	return nil
+}
+
+// schemaDrift compares a configured schema with the schema of the connected database. The
+// owner of a schema holds every privilege on it, so no grants to the owner are reported.
+func (m *Manager) schemaDrift(schema *structs.SchemaConfig) (*schemaDrift, error) {
+	drift := &schemaDrift{}
+
+	var owner string
+	err := m.executor().QueryRow(`
+		SELECT pg_get_userbyid(nspowner) FROM pg_namespace WHERE nspname = $1`, schema.Name).Scan(&owner)
+	if err == sql.ErrNoRows {
+		drift.Missing = true
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to look up schema %s: %w", schema.Name, err)
+	}
+
+	if !drift.Missing && schema.Owner != "" && owner != schema.Owner {
+		drift.Owner = &structs.SchemaOwnerChange{Schema: schemaName(schema), Current: owner, Desired: schema.Owner}
+	}
+	if schema.Owner != "" {
+		owner = schema.Owner
+	}
+
+	granted := make(map[string]bool)
+	if !drift.Missing {
+		rows, err := m.executor().Query(`
+			SELECT r.rolname, a.privilege_type
+			FROM pg_namespace n
+			CROSS JOIN LATERAL aclexplode(COALESCE(n.nspacl, acldefault('n', n.nspowner))) a
+			JOIN pg_roles r ON r.oid = a.grantee
+			WHERE n.nspname = $1`, schema.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list privileges on schema %s: %w", schema.Name, err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var role, privilege string
+			if err := rows.Scan(&role, &privilege); err != nil {
+				return nil, fmt.Errorf("failed to scan privilege on schema %s: %w", schema.Name, err)
+			}
+			granted[role+" "+privilege] = true
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, grant := range schema.Grants {
+		if grant.Role == owner {
+			continue
+		}
+		privileges, err := normalizePrivileges(grant.GrantPrivileges(), validSchemaPrivileges, "schema", "USAGE, CREATE or ALL")
+		if err != nil {
+			return nil, fmt.Errorf("invalid grant on schema %s to %s: %w", schema.Name, grant.Role, err)
+		}
+		for _, privilege := range privileges {
+			for _, expanded := range schemaPrivilegesIn[privilege] {
+				if granted[grant.Role+" "+expanded] {
+					continue
+				}
+				granted[grant.Role+" "+expanded] = true
+				drift.Privileges = append(drift.Privileges, structs.SchemaPrivilegeGrant{
+					Target:    grant.Role,
+					Privilege: expanded,
+					Schema:    schemaName(schema),
+				})
+			}
+		}
+	}
+
+	return drift, nil
+}
@@ -0,0 +1,132 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+func TestApplySchema(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	config := &structs.Config{
+		Groups: []structs.GroupConfig{{Name: "test_group"}, {Name: "read_only"}},
+		Schemas: []structs.SchemaConfig{
+			{Name: "test_schema", Owner: "test_group", Grants: []structs.SchemaGrant{
+				{Role: "read_only"},
+				{Role: "test_group", Privileges: []string{"ALL"}},
+			}},
+		},
+	}
+	// The schema is dropped before its owner
+	defer setup.Manager.db.Exec("DROP SCHEMA IF EXISTS test_schema")
+
+	report, err := setup.Manager.Diff(config)
+	if err != nil {
+		t.Fatalf("Failed to diff configuration: %v", err)
+	}
+	if len(report.SchemasMissing) != 1 || report.SchemasMissing[0] != "test_schema" {
+		t.Errorf("Expected test_schema to be missing, got %+v", report.SchemasMissing)
+	}
+
+	result, err := setup.Manager.SyncConfiguration(config)
+	if err != nil || len(result.Errors) != 0 {
+		t.Fatalf("Failed to sync configuration: %v %v", err, result.Errors)
+	}
+	if len(result.SchemasApplied) != 1 {
+		t.Errorf("Expected the schema to be applied, got %+v", result.SchemasApplied)
+	}
+
+	var owner string
+	var usage, create bool
+	err = setup.Manager.db.QueryRow(`
+		SELECT pg_get_userbyid(nspowner), has_schema_privilege('read_only', 'test_schema', 'USAGE'),
+			has_schema_privilege('read_only', 'test_schema', 'CREATE')
+		FROM pg_namespace WHERE nspname = 'test_schema'`).Scan(&owner, &usage, &create)
+	if err != nil {
+		t.Fatalf("Failed to read test_schema: %v", err)
+	}
+	if owner != "test_group" || !usage || create {
+		t.Errorf("Expected test_schema owned by test_group with USAGE for read_only, got owner %s, usage %t, create %t", owner, usage, create)
+	}
+
+	// An applied schema does not drift, and another owner does
+	report, err = setup.Manager.Diff(config)
+	if err != nil || len(report.SchemasMissing)+len(report.SchemaOwnersChanged)+len(report.SchemaPrivilegesMissing) != 0 {
+		t.Fatalf("Expected no schema drift after sync, got %+v (err: %v)", report, err)
+	}
+
+	config.Schemas[0].Owner = "read_only"
+	report, err = setup.Manager.Diff(config)
+	if err != nil || len(report.SchemaOwnersChanged) != 1 || report.SchemaOwnersChanged[0].Current != "test_group" {
+		t.Fatalf("Expected the owner of test_schema to drift, got %+v (err: %v)", report.SchemaOwnersChanged, err)
+	}
+	// test_group holds USAGE and CREATE in the ACL written by the first grant
+	if len(report.SchemaPrivilegesMissing) != 0 {
+		t.Errorf("Expected no missing privileges, got %+v", report.SchemaPrivilegesMissing)
+	}
+}
+
+func TestApplySchemaInOtherDatabase(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	// The database is dropped before the roles owning its schema
+	setup.CreateTestDatabase(t, "schemas_db")
+	defer setup.DropTestDatabase(t, "schemas_db")
+
+	config := &structs.Config{
+		Groups: []structs.GroupConfig{{Name: "test_group"}, {Name: "read_only"}},
+		Schemas: []structs.SchemaConfig{
+			{Name: "test_schema", Database: "schemas_db", Owner: "test_group", Grants: []structs.SchemaGrant{{Role: "read_only"}}},
+		},
+	}
+
+	// A transactional sync creates the schema once its roles are committed
+	setup.Manager.SetTransactional(true)
+	defer setup.Manager.SetTransactional(false)
+	checkpoint := NewCheckpoint(filepath.Join(t.TempDir(), "checkpoint"), "sha256:abc", "")
+	setup.Manager.SetCheckpoint(checkpoint)
+	defer setup.Manager.SetCheckpoint(nil)
+	result, err := setup.Manager.SyncConfiguration(config)
+	if err != nil || len(result.Errors) != 0 {
+		t.Fatalf("Failed to sync configuration: %v %v", err, result.Errors)
+	}
+	if len(result.SchemasApplied) != 1 || result.SchemasApplied[0] != "test_schema (database schemas_db)" {
+		t.Errorf("Expected the schema in schemas_db to be applied, got %+v", result.SchemasApplied)
+	}
+
+	// Only the schema applied after the commit is checkpointed
+	if !checkpoint.Done("schema:test_schema (database schemas_db)") || checkpoint.Done("group:test_group") {
+		t.Errorf("Expected only the deferred schema to be checkpointed, got %v", checkpoint.Completed)
+	}
+
+	var owner string
+	var usage bool
+	err = setup.Manager.InDatabase("schemas_db", func(db *Manager) error {
+		return db.db.QueryRow(`
+			SELECT pg_get_userbyid(nspowner), has_schema_privilege('read_only', 'test_schema', 'USAGE')
+			FROM pg_namespace WHERE nspname = 'test_schema'`).Scan(&owner, &usage)
+	})
+	if err != nil {
+		t.Fatalf("Failed to read test_schema in schemas_db: %v", err)
+	}
+	if owner != "test_group" || !usage {
+		t.Errorf("Expected test_schema owned by test_group with USAGE for read_only, got owner %s, usage %t", owner, usage)
+	}
+
+	// The connected database has no such schema
+	var exists bool
+	if err := setup.Manager.db.QueryRow("SELECT EXISTS (SELECT 1 FROM pg_namespace WHERE nspname = 'test_schema')").Scan(&exists); err != nil || exists {
+		t.Errorf("Expected no test_schema in the connected database (err: %v)", err)
+	}
+
+	report, err := setup.Manager.Diff(config)
+	if err != nil || len(report.SchemasMissing)+len(report.SchemaOwnersChanged)+len(report.SchemaPrivilegesMissing) != 0 {
+		t.Errorf("Expected no schema drift after sync, got %+v (err: %v)", report, err)
+	}
+}
@@ -0,0 +1,159 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+)
+
+// settingAttributePrefix prefixes the setting name in the attribute of a setting change
+const settingAttributePrefix = "settings."
+
+// listSettings are the settings that take a list of values. Each element is quoted on its
+// own, as a single quoted string would be read as one element.
+var listSettings = map[string]bool{
+	"search_path":               true,
+	"temp_tablespaces":          true,
+	"local_preload_libraries":   true,
+	"session_preload_libraries": true,
+}
+
+// RoleSettings returns the settings of a role that apply in every database, as set with
+// ALTER ROLE ... SET. A role that does not exist has none.
+func (m *Manager) RoleSettings(role string) (map[string]string, error) {
+	var config []string
+	err := m.executor().QueryRow(`
+		SELECT COALESCE(s.setconfig, '{}')
+		FROM pg_roles r
+		LEFT JOIN pg_db_role_setting s ON s.setrole = r.oid AND s.setdatabase = 0
+		WHERE r.rolname = $1`, role).Scan(pq.Array(&config))
+	if err == sql.ErrNoRows {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read settings of role %s: %w", role, err)
+	}
+
+	settings := make(map[string]string, len(config))
+	for _, entry := range config {
+		if name, value, ok := strings.Cut(entry, "="); ok {
+			settings[name] = value
+		}
+	}
+	return settings, nil
+}
+
+// ApplyRoleSettings sets the configured settings of a role that differ from its current
+// ones. Settings that are not configured are left alone. It reports whether any changed.
+func (m *Manager) ApplyRoleSettings(role string, settings map[string]string) (bool, error) {
+	if len(settings) == 0 {
+		return false, nil
+	}
+	for name := range settings {
+		// Setting names are part of the statement and cannot be quoted
+		if err := structs.CheckSettingName(name); err != nil {
+			return false, fmt.Errorf("cannot set settings of role %s: %w", role, err)
+		}
+	}
+
+	current, err := m.RoleSettings(role)
+	if err != nil {
+		return false, err
+	}
+	changes := settingChanges(role, settings, current)
+	if len(changes) == 0 {
+		return false, nil
+	}
+
+	for _, change := range changes {
+		name := strings.TrimPrefix(change.Attribute, settingAttributePrefix)
+		m.logger.WithFields(logrus.Fields{
+			"role":    role,
+			"setting": name,
+			"value":   change.Desired,
+		}).Info("Setting role setting")
+
+		query := fmt.Sprintf("ALTER ROLE %s SET %s = %s", m.quoteIdentifier(role), name, settingValue(name, settings[name]))
+		if err := m.execute(query); err != nil {
+			return false, fmt.Errorf("failed to set %s of role %s: %w", name, role, err)
+		}
+	}
+
+	// Record who changed the settings
+	if err := m.stampRole(role, "", "modified", nil); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// settingChanges compares the configured settings of a role with its current ones, in
+// name order
+func settingChanges(role string, settings, current map[string]string) []structs.AttributeChange {
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var changes []structs.AttributeChange
+	for _, name := range names {
+		value, set := current[name]
+		if set && sameSetting(name, value, settings[name]) {
+			continue
+		}
+		changes = append(changes, structs.AttributeChange{
+			Role:      role,
+			Attribute: settingAttributePrefix + name,
+			Current:   value,
+			Desired:   settings[name],
+		})
+	}
+	return changes
+}
+
+// settingValue quotes a configured setting value for ALTER ROLE ... SET
+func settingValue(name, value string) string {
+	if !listSettings[name] {
+		return pq.QuoteLiteral(value)
+	}
+
+	elements := settingElements(value)
+	if len(elements) == 0 {
+		return "''"
+	}
+	quoted := make([]string, len(elements))
+	for i, element := range elements {
+		quoted[i] = pq.QuoteLiteral(element)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// sameSetting reports whether a stored setting value matches a configured one. PostgreSQL
+// stores list settings with normalized spacing and quotes, so they are compared by element.
+func sameSetting(name, stored, configured string) bool {
+	if !listSettings[name] {
+		return stored == configured
+	}
+	return strings.Join(settingElements(stored), ",") == strings.Join(settingElements(configured), ",")
+}
+
+// settingElements splits a list setting value into its elements, without surrounding
+// spaces or double quotes
+func settingElements(value string) []string {
+	var elements []string
+	for _, element := range strings.Split(value, ",") {
+		element = strings.TrimSpace(element)
+		if len(element) >= 2 && strings.HasPrefix(element, `"`) && strings.HasSuffix(element, `"`) {
+			element = strings.ReplaceAll(element[1:len(element)-1], `""`, `"`)
+		}
+		if element != "" {
+			elements = append(elements, element)
+		}
+	}
+	return elements
+}
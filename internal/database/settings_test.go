@@ -0,0 +1,99 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+func TestSettingChanges(t *testing.T) {
+	current := map[string]string{
+		"search_path":       `"$user", public`,
+		"statement_timeout": "30s",
+		"work_mem":          "4MB",
+	}
+	settings := map[string]string{
+		"search_path":       "$user,public",
+		"statement_timeout": "60s",
+		"lock_timeout":      "5s",
+	}
+
+	changes := settingChanges("app_user", settings, current)
+	if len(changes) != 2 {
+		t.Fatalf("Expected 2 changes, got %+v", changes)
+	}
+	if changes[0] != (structs.AttributeChange{Role: "app_user", Attribute: "settings.lock_timeout", Current: "", Desired: "5s"}) {
+		t.Errorf("Expected the unset lock_timeout to change, got %+v", changes[0])
+	}
+	if changes[1] != (structs.AttributeChange{Role: "app_user", Attribute: "settings.statement_timeout", Current: "30s", Desired: "60s"}) {
+		t.Errorf("Expected statement_timeout to change, got %+v", changes[1])
+	}
+}
+
+func TestSettingValue(t *testing.T) {
+	tests := []struct {
+		name, value, expected string
+	}{
+		{"statement_timeout", "30s", `'30s'`},
+		{"app.tenant", "o'brien", `'o''brien'`},
+		{"search_path", `"$user", public`, `'$user', 'public'`},
+		{"search_path", "", `''`},
+	}
+
+	for _, test := range tests {
+		if got := settingValue(test.name, test.value); got != test.expected {
+			t.Errorf("settingValue(%q, %q) = %s, expected %s", test.name, test.value, got, test.expected)
+		}
+	}
+}
+
+func TestRoleSettings(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	config := &structs.Config{
+		Users: []structs.UserConfig{
+			{Username: "test_user", Password: "test_pass", Enabled: true, CanLogin: true, Settings: map[string]string{
+				"search_path":       "app, public",
+				"statement_timeout": "30s",
+			}},
+		},
+	}
+
+	result, err := setup.Manager.SyncConfiguration(config)
+	if err != nil || len(result.Errors) != 0 {
+		t.Fatalf("Failed to sync configuration: %v %v", err, result.Errors)
+	}
+
+	settings, err := setup.Manager.RoleSettings("test_user")
+	if err != nil {
+		t.Fatalf("Failed to read role settings: %v", err)
+	}
+	if settings["statement_timeout"] != "30s" || !sameSetting("search_path", settings["search_path"], "app,public") {
+		t.Errorf("Expected the configured settings on the role, got %v", settings)
+	}
+
+	// Applied settings do not drift, and a changed value does
+	report, err := setup.Manager.Diff(config)
+	if err != nil || len(report.AttributesChanged) != 0 {
+		t.Fatalf("Expected no drift after sync, got %+v (err: %v)", report.AttributesChanged, err)
+	}
+
+	config.Users[0].Settings["statement_timeout"] = "1min"
+	report, err = setup.Manager.Diff(config)
+	if err != nil || len(report.AttributesChanged) != 1 || report.AttributesChanged[0].Attribute != "settings.statement_timeout" {
+		t.Fatalf("Expected statement_timeout to drift, got %+v (err: %v)", report.AttributesChanged, err)
+	}
+
+	// Settings that are no longer configured are left alone
+	delete(config.Users[0].Settings, "search_path")
+	result, err = setup.Manager.SyncConfiguration(config)
+	if err != nil || len(result.UsersModified) != 1 {
+		t.Fatalf("Expected the user to be modified, got %+v (err: %v)", result, err)
+	}
+	settings, _ = setup.Manager.RoleSettings("test_user")
+	if settings["statement_timeout"] != "1min" || settings["search_path"] == "" {
+		t.Errorf("Expected statement_timeout to change and search_path to be kept, got %v", settings)
+	}
+}
@@ -7,7 +7,7 @@ import (
 )
 
 func TestSharedContainerApproach(t *testing.T) {
-	setup := SetupSharedTestDatabase(t)
+	setup := SetupTestDatabaseWithOptions(t, TestDatabaseOptions{Mode: TestDatabaseShared})
 	defer setup.Cleanup(t)
 
 	// Test basic functionality
@@ -39,10 +39,10 @@ func TestSharedContainerApproach(t *testing.T) {
 }
 
 func TestSharedContainerIsolation(t *testing.T) {
-	setup1 := SetupSharedTestDatabase(t)
+	setup1 := SetupTestDatabaseWithOptions(t, TestDatabaseOptions{Mode: TestDatabaseShared})
 	defer setup1.Cleanup(t)
 
-	setup2 := SetupSharedTestDatabase(t)
+	setup2 := SetupTestDatabaseWithOptions(t, TestDatabaseOptions{Mode: TestDatabaseShared})
 	defer setup2.Cleanup(t)
 
 	// Verify we have different database names (isolation)
@@ -95,7 +95,7 @@ func TestSharedContainerIsolation(t *testing.T) {
 }
 
 func TestSharedContainerWithIAM(t *testing.T) {
-	setup := SetupSharedTestDatabase(t)
+	setup := SetupTestDatabaseWithOptions(t, TestDatabaseOptions{Mode: TestDatabaseShared})
 	defer setup.Cleanup(t)
 
 	// Test IAM user creation (should work now with rds_iam role)
@@ -0,0 +1,761 @@
+package database
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultSlowOperationThreshold is the duration above which sync operations are logged as slow
+	DefaultSlowOperationThreshold = 2 * time.Second
+
+	// DefaultUserWorkers is how many new users a sync creates at the same time
+	DefaultUserWorkers = 4
+)
+
+// SetSlowOperationThreshold sets the duration above which sync operations are logged
+// as slow. A zero or negative threshold disables slow operation logging.
+func (m *Manager) SetSlowOperationThreshold(threshold time.Duration) {
+	m.slowThreshold = threshold
+}
+
+// SetUserWorkers sets how many new users a sync creates at the same time. Values below
+// one create them one at a time, as part of syncing each user.
+func (m *Manager) SetUserWorkers(workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+	m.userWorkers = workers
+}
+
+// SyncConfiguration synchronizes the database state with the configuration
+func (m *Manager) SyncConfiguration(config *structs.Config) (*structs.SyncResult, error) {
+	m.logger.WithField("principal", m.principal).Info("Starting configuration synchronization")
+
+	start := time.Now()
+	statementsBefore, queriesBefore := m.counts.statements.Load(), m.counts.queries.Load()
+	result := &structs.SyncResult{Principal: m.principal, UsersDeclared: len(config.Users), GroupsDeclared: len(config.Groups)}
+
+	// Order entities so dependencies are applied first and output is stable across runs
+	ordered, err := orderConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to order configuration: %w", err)
+	}
+
+	// An empty configuration would prune every managed role, which is never what was meant
+	if m.prune != "" && len(config.Users) == 0 && len(config.Groups) == 0 {
+		return nil, fmt.Errorf("refusing to prune with a configuration that declares no users or groups")
+	}
+
+	// A read replica refuses every change, so there is no point planning them
+	if err := m.checkWritable(); err != nil {
+		if !m.dryRun {
+			return nil, err
+		}
+		m.logger.WithError(err).Warn("DRY RUN: Connected to a server that cannot be written to, sync would stop here")
+		result.Warn("", fmt.Sprintf("sync would stop here: %v", err))
+	}
+
+	// Dropped roles may own objects in the other databases the configuration reaches
+	m.objectDatabases = config.ObjectDatabases()
+
+	// Fail before changing anything when the connected role cannot run every statement,
+	// unless the statements it lacks privileges for are left to an elevated script
+	m.elevated, m.elevatedStatements = nil, nil
+	if !m.skipPreflight {
+		if err := m.preflight(config); err != nil {
+			if !m.dryRun {
+				return nil, fmt.Errorf("preflight check failed: %w", err)
+			}
+			m.logger.WithError(err).Debug("DRY RUN: Preflight check failed, sync would stop here")
+			result.Warn("", fmt.Sprintf("preflight check failed, sync would stop here: %v", err))
+		}
+	}
+
+	// Refuse to remove more access in one run than the change limits allow
+	if !m.allowLargeChange {
+		if err := m.CheckChangeLimits(config); err != nil {
+			if !m.dryRun {
+				return nil, err
+			}
+			m.logger.WithError(err).Debug("DRY RUN: Change limits exceeded, sync would stop here")
+			result.Warn("", fmt.Sprintf("change limits exceeded, sync would stop here: %v", err))
+		}
+	}
+
+	// Collect dry-run statements per entity instead of logging them one by one, checking
+	// them against the roles the sync itself would create and drop
+	if m.dryRun {
+		m.statements = []structs.PlannedStatement{}
+		m.plannedRoles = nil
+	}
+
+	// In transactional mode everything below is applied in one transaction
+	if err := m.beginSync(); err != nil {
+		return nil, err
+	}
+
+	// Drop any admin memberships the connected role granted itself during the sync, commit
+	// or roll back a transactional sync and close the connections opened to other databases
+	defer func() {
+		if m.syncFailed(result) {
+			// Rolling back also undoes the admin memberships
+			m.adminGrants = nil
+		}
+		// Temporary admin memberships are revoked even when the sync was stopped
+		m.uncancelled(func() {
+			if err := m.CleanupAdminMemberships(); err != nil {
+				result.Errors = append(result.Errors, err)
+			}
+		})
+		m.finishSync(result)
+		if failing := m.countFailingStatements(); failing > 0 {
+			result.Warn("", fmt.Sprintf("%d planned statement(s) would fail, see the statement preview", failing))
+		}
+		result.Statements = m.statements
+		m.statements = nil
+		if len(m.elevatedStatements) > 0 {
+			result.Warn("", fmt.Sprintf("%d statement(s) need privileges the connected role lacks and were left to the elevated script", len(m.elevatedStatements)))
+		}
+		result.Elevated, m.elevatedStatements = m.elevatedStatements, nil
+		m.closeDatabases()
+	}()
+
+	// Memberships are only reconciled for groups this configuration manages
+	managedGroups := managedGroupSet(ordered.Groups)
+
+	// Create groups first (since users might depend on them), parents before children
+	for i := range ordered.Groups {
+		entity := "group:" + ordered.Groups[i].Name
+		if m.stopSync(result) {
+			break
+		}
+		if m.resumed(entity, result) {
+			continue
+		}
+		errorsBefore := len(result.Errors)
+		m.syncGroup(&ordered.Groups[i], managedGroups, result)
+		m.checkpointEntity(entity, errorsBefore, result)
+	}
+
+	// Create new users concurrently before configuring each of them in order
+	var createFailed map[string]bool
+	if !m.stopSync(result) {
+		createFailed = m.createUsers(ordered.Users, result)
+	}
+
+	// Create and configure users
+	for i := range ordered.Users {
+		entity := "user:" + ordered.Users[i].Username
+		if m.stopSync(result) {
+			break
+		}
+		if m.resumed(entity, result) || createFailed[ordered.Users[i].Username] {
+			continue
+		}
+		errorsBefore := len(result.Errors)
+		m.syncUser(&ordered.Users[i], managedGroups, result)
+		m.checkpointEntity(entity, errorsBefore, result)
+	}
+
+	// Memberships in managed groups of roles the configuration does not declare at all
+	if !m.stopSync(result) {
+		err := m.timed(result, "memberships", "membership_reconcile", func() error {
+			return m.reconcileUndeclaredMembers(config, result)
+		})
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("failed to reconcile members of managed groups: %w", err))
+		}
+	}
+
+	// Create schemas and grant on them once all roles exist
+	for i := range ordered.Schemas {
+		schema := &ordered.Schemas[i]
+		name := schemaName(schema)
+		entity := "schema:" + name
+		if m.stopSync(result) {
+			break
+		}
+		if m.resumed(entity, result) {
+			continue
+		}
+
+		// Roles a transactional sync creates are invisible to other connections until it
+		// commits, so schemas in other databases wait for the commit
+		if m.tx != nil && m.otherDatabase(schema.Database) {
+			m.deferredApplies = append(m.deferredApplies, deferredApply{entity: entity, apply: func(result *structs.SyncResult) error {
+				changed, err := m.ApplySchema(schema)
+				if err != nil {
+					return fmt.Errorf("failed to apply schema %s after commit: %w", name, err)
+				}
+				if changed {
+					result.SchemasApplied = append(result.SchemasApplied, name)
+				}
+				return nil
+			}})
+			continue
+		}
+
+		var changed bool
+		err := m.timed(result, entity, "apply", func() error {
+			var err error
+			changed, err = m.ApplySchema(schema)
+			return err
+		})
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("failed to apply schema %s: %w", name, err))
+			continue
+		}
+		if changed {
+			result.SchemasApplied = append(result.SchemasApplied, name)
+		}
+		m.checkpointEntity(entity, len(result.Errors), result)
+	}
+
+	// Attach roles to row level security policies once all roles exist
+	for i := range ordered.Policies {
+		policy := &ordered.Policies[i]
+		name := policyName(policy)
+		entity := "policy:" + name
+		if m.stopSync(result) {
+			break
+		}
+		if m.resumed(entity, result) {
+			continue
+		}
+
+		// Like schemas, policies in other databases wait for the commit of a transactional sync
+		if m.tx != nil && m.otherDatabase(policy.Database) {
+			m.deferredApplies = append(m.deferredApplies, deferredApply{entity: entity, apply: func(result *structs.SyncResult) error {
+				if err := m.ApplyPolicy(policy); err != nil {
+					return fmt.Errorf("failed to apply policy %s after commit: %w", name, err)
+				}
+				result.PoliciesApplied = append(result.PoliciesApplied, name)
+				return nil
+			}})
+			continue
+		}
+
+		err := m.timed(result, entity, "apply", func() error {
+			return m.ApplyPolicy(policy)
+		})
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("failed to apply policy %s: %w", name, err))
+			continue
+		}
+		result.PoliciesApplied = append(result.PoliciesApplied, name)
+		m.checkpointEntity(entity, len(result.Errors), result)
+	}
+
+	// Remove managed roles the configuration no longer declares
+	if m.prune != "" && !m.stopSync(result) {
+		if err := m.pruneRoles(config, result); err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("failed to prune roles: %w", err))
+		}
+	}
+
+	result.Duration = time.Since(start)
+	result.StatementsExecuted = int(m.counts.statements.Load() - statementsBefore)
+	result.QueriesRun = int(m.counts.queries.Load() - queriesBefore)
+
+	m.logger.WithFields(logrus.Fields{
+		"users_created":       len(result.UsersCreated),
+		"users_removed":       len(result.UsersRemoved),
+		"groups_created":      len(result.GroupsCreated),
+		"groups_removed":      len(result.GroupsRemoved),
+		"policies_applied":    len(result.PoliciesApplied),
+		"schemas_applied":     len(result.SchemasApplied),
+		"memberships_revoked": len(result.MembershipsRevoked),
+		"memberships_expired": len(result.MembershipsExpired),
+		"privileges_revoked":  len(result.PrivilegesRevoked),
+		"resumed":             len(result.Resumed),
+		"warnings":            len(result.Warnings),
+		"errors":              len(result.Errors),
+		"statements":          result.StatementsExecuted,
+		"queries":             result.QueriesRun,
+		"duration":            result.Duration.String(),
+	}).Info("Configuration synchronization completed")
+
+	return result, nil
+}
+
+// syncGroup creates a group and applies its memberships and grants
+func (m *Manager) syncGroup(group *structs.GroupConfig, managedGroups map[string]bool, result *structs.SyncResult) {
+	entity := "group:" + group.Name
+
+	if err := m.timed(result, entity, "check_kind", func() error { return m.checkManagedKind(group.Name, ManagedKindGroup) }); err != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("failed to sync group %s: %w", group.Name, err))
+		return
+	}
+
+	if err := m.timed(result, entity, "create", func() error { return m.CreateGroup(group) }); err != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("failed to create group %s: %w", group.Name, err))
+		return
+	}
+	result.GroupsCreated = append(result.GroupsCreated, group.Name)
+
+	// Apply attribute changes to a group that already existed
+	var altered bool
+	err := m.timed(result, entity, "alter", func() error {
+		var err error
+		altered, err = m.AlterGroup(group)
+		return err
+	})
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("failed to alter group %s: %w", group.Name, err))
+	}
+
+	// Apply the configured role settings
+	var settingsChanged bool
+	err = m.timed(result, entity, "settings", func() error {
+		var err error
+		settingsChanged, err = m.ApplyRoleSettings(group.Name, group.Settings)
+		return err
+	})
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("failed to apply settings of group %s: %w", group.Name, err))
+	}
+	if altered || settingsChanged {
+		result.GroupsModified = append(result.GroupsModified, group.Name)
+	}
+
+	// Mark the group as managed so it is pruned once it leaves the configuration
+	if err := m.timed(result, entity, "mark_managed", func() error { return m.markManaged(group.Name, ManagedKindGroup) }); err != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("failed to mark group %s as managed: %w", group.Name, err))
+	}
+
+	// Keep the role comment in line with the configured description and ownership
+	if err := m.timed(result, entity, "description", func() error { return m.SetRoleDescription(group.Name, group.Description) }); err != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("failed to update description of group %s: %w", group.Name, err))
+	}
+	if err := m.timed(result, entity, "ownership", func() error { return m.SetRoleOwnership(group.Name, group.Owner, group.Team, group.Ticket) }); err != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("failed to update ownership of group %s: %w", group.Name, err))
+	}
+
+	// Add group to the parent groups it is not a member of yet
+	var memberships []string
+	err = m.timed(result, entity, "membership_lookup", func() error {
+		var err error
+		memberships, err = m.GetRoleMemberships(group.Name)
+		return err
+	})
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("failed to look up memberships of group %s: %w", group.Name, err))
+	}
+	if parents := missingMemberships(group.MemberOf, memberships); len(parents) > 0 {
+		m.timed(result, entity, "membership", func() error {
+			m.addToGroups(group.Name, parents, func(parent string, err error) {
+				result.Errors = append(result.Errors, fmt.Errorf("failed to add group %s to group %s: %w", group.Name, parent, err))
+			})
+			return nil
+		})
+	}
+
+	// Revoke or report parent groups that are no longer configured
+	err = m.timed(result, entity, "membership_reconcile", func() error {
+		return m.reconcileMemberships(group.Name, group.MemberOf, memberships, managedGroups, result)
+	})
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("failed to reconcile memberships of group %s: %w", group.Name, err))
+	}
+
+	// Grant group privileges on the databases it lacks any of them on
+	var privileges []structs.PrivilegeGrant
+	err = m.timed(result, entity, "grant", func() error {
+		var err error
+		if privileges, err = m.GetDatabasePrivileges(group.Name); err != nil {
+			return err
+		}
+		return m.GrantPrivileges(group.Name, group.Privileges, missingPrivilegeDatabases(group.Privileges, group.Databases, privileges))
+	})
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("failed to grant privileges to group %s: %w", group.Name, err))
+	}
+
+	// Revoke or report database privileges that are no longer configured
+	err = m.timed(result, entity, "privilege_reconcile", func() error {
+		return m.reconcilePrivileges(group.Name, group.Privileges, group.Databases, privileges, result)
+	})
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("failed to reconcile privileges of group %s: %w", group.Name, err))
+	}
+
+	// Grant extension schema and large object privileges
+	var errs []error
+	m.timed(result, entity, "extension_grant", func() error {
+		errs = m.applyExtensionGrants(group.Name, group.ExtensionSchemas, group.LargeObjects)
+		return nil
+	})
+	for _, err := range errs {
+		result.Errors = append(result.Errors, fmt.Errorf("failed to grant extension privileges to group %s: %w", group.Name, err))
+	}
+}
+
+// syncUser creates a user and applies its memberships and grants
+func (m *Manager) syncUser(user *structs.UserConfig, managedGroups map[string]bool, result *structs.SyncResult) {
+	entity := "user:" + user.Username
+
+	// Absent users are removed entirely
+	if user.Absent {
+		var existed bool
+		err := m.timed(result, entity, "drop", func() error {
+			var err error
+			if existed, err = m.UserExists(user.Username); err != nil || !existed {
+				return err
+			}
+			// Protection in the config applies even before it has been recorded on the role
+			if err := m.checkDeletionProtection(user.Username, user.DeletionProtection); err != nil {
+				return err
+			}
+			return m.DropUser(user.Username)
+		})
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("failed to remove absent user %s: %w", user.Username, err))
+		} else if existed {
+			result.UsersRemoved = append(result.UsersRemoved, user.Username)
+		}
+		return
+	}
+
+	// A user declared under a new name takes over the role of its previous name
+	if !m.renameUser(user, result) {
+		return
+	}
+
+	// Disabled users are locked out but kept, so their grants survive re-enabling
+	if !user.Enabled {
+		var exists, changed bool
+		err := m.timed(result, entity, "disable", func() error {
+			var err error
+			if exists, err = m.UserExists(user.Username); err != nil || !exists {
+				return err
+			}
+			changed, err = m.DisableUser(user.Username)
+			return err
+		})
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("failed to disable user %s: %w", user.Username, err))
+		} else if !exists {
+			result.Warn(user.Username, "disabled user does not exist and was not created")
+		} else if changed {
+			result.UsersDisabled = append(result.UsersDisabled, user.Username)
+		}
+		return
+	}
+
+	if err := m.timed(result, entity, "check_kind", func() error { return m.checkManagedKind(user.Username, ManagedKindUser) }); err != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("failed to sync user %s: %w", user.Username, err))
+		return
+	}
+
+	generate := user.GeneratePassword && user.Password == ""
+	if err := m.timed(result, entity, "create", func() error { return m.CreateUser(user) }); err != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("failed to create user %s: %w", user.Username, err))
+		return
+	}
+	result.UsersCreated = append(result.UsersCreated, user.Username)
+	if generate && user.Password != "" {
+		result.GeneratedPasswords = append(result.GeneratedPasswords, structs.GeneratedPassword{Username: user.Username, Password: user.Password})
+	}
+
+	// Apply attribute and password changes to a user that already existed
+	var altered bool
+	err := m.timed(result, entity, "alter", func() error {
+		var err error
+		altered, err = m.AlterUser(user)
+		return err
+	})
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("failed to alter user %s: %w", user.Username, err))
+	}
+
+	// Apply the configured role settings
+	var settingsChanged bool
+	err = m.timed(result, entity, "settings", func() error {
+		var err error
+		settingsChanged, err = m.ApplyRoleSettings(user.Username, user.Settings)
+		return err
+	})
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("failed to apply settings of user %s: %w", user.Username, err))
+	}
+	if altered || settingsChanged {
+		result.UsersModified = append(result.UsersModified, user.Username)
+	}
+
+	// Replace an expired generated password. A user created by this sync already holds its
+	// fresh password and is left alone.
+	if m.rotateMaxAge > 0 {
+		var password string
+		err := m.timed(result, entity, "rotate", func() error {
+			var err error
+			password, err = m.rotateExpiredPassword(user)
+			return err
+		})
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("failed to rotate password of user %s: %w", user.Username, err))
+		} else if password != "" {
+			result.RotatedPasswords = append(result.RotatedPasswords, structs.GeneratedPassword{Username: user.Username, Password: password})
+		}
+	}
+
+	// Mark the user as managed so it is pruned once it leaves the configuration
+	err = m.timed(result, entity, "mark_managed", func() error { return m.markManaged(user.Username, ManagedKindUser) })
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("failed to mark user %s as managed: %w", user.Username, err))
+	}
+
+	// Keep the role comment in line with the configured description and ownership
+	err = m.timed(result, entity, "description", func() error { return m.SetRoleDescription(user.Username, user.Description) })
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("failed to update description of user %s: %w", user.Username, err))
+	}
+	err = m.timed(result, entity, "ownership", func() error {
+		return m.SetRoleOwnership(user.Username, user.Owner, user.Team, user.Ticket)
+	})
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("failed to update ownership of user %s: %w", user.Username, err))
+	}
+
+	// Record deletion protection on the role so it also guards drops outside of sync
+	err = m.timed(result, entity, "protection", func() error {
+		return m.SetDeletionProtection(user.Username, user.DeletionProtection)
+	})
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("failed to update deletion protection of user %s: %w", user.Username, err))
+	}
+
+	// Add user to the groups it is not a member of yet, including temporary groups that have
+	// not expired
+	now := time.Now()
+	var memberships []string
+	err = m.timed(result, entity, "membership_lookup", func() error {
+		var err error
+		memberships, err = m.GetRoleMemberships(user.Username)
+		return err
+	})
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("failed to look up memberships of user %s: %w", user.Username, err))
+	}
+	if groups := missingMemberships(user.ActiveGroups(now), memberships); len(groups) > 0 {
+		m.timed(result, entity, "membership", func() error {
+			m.addToGroups(user.Username, groups, func(groupName string, err error) {
+				result.Errors = append(result.Errors, fmt.Errorf("failed to add user %s to group %s: %w", user.Username, groupName, err))
+			})
+			return nil
+		})
+	}
+
+	// Revoke temporary groups that have expired
+	err = m.timed(result, entity, "membership_expiry", func() error {
+		expired, err := m.revokeExpiredMemberships(user, now)
+		result.MembershipsExpired = append(result.MembershipsExpired, expired...)
+		return err
+	})
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("failed to expire memberships of user %s: %w", user.Username, err))
+	}
+
+	// Revoke or report groups that are no longer configured
+	err = m.timed(result, entity, "membership_reconcile", func() error {
+		return m.reconcileMemberships(user.Username, configuredGroups(user), memberships, managedGroups, result)
+	})
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("failed to reconcile memberships of user %s: %w", user.Username, err))
+	}
+
+	// Grant user privileges on the databases it lacks any of them on
+	var privileges []structs.PrivilegeGrant
+	err = m.timed(result, entity, "grant", func() error {
+		var err error
+		if privileges, err = m.GetDatabasePrivileges(user.Username); err != nil {
+			return err
+		}
+		return m.GrantPrivileges(user.Username, user.Privileges, missingPrivilegeDatabases(user.Privileges, user.Databases, privileges))
+	})
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("failed to grant privileges to user %s: %w", user.Username, err))
+	}
+
+	// Revoke or report database privileges that are no longer configured
+	err = m.timed(result, entity, "privilege_reconcile", func() error {
+		return m.reconcilePrivileges(user.Username, user.Privileges, user.Databases, privileges, result)
+	})
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("failed to reconcile privileges of user %s: %w", user.Username, err))
+	}
+
+	// Grant extension schema and large object privileges
+	var errs []error
+	m.timed(result, entity, "extension_grant", func() error {
+		errs = m.applyExtensionGrants(user.Username, user.ExtensionSchemas, user.LargeObjects)
+		return nil
+	})
+	for _, err := range errs {
+		result.Errors = append(result.Errors, fmt.Errorf("failed to grant extension privileges to user %s: %w", user.Username, err))
+	}
+}
+
+// createUsers creates the users of a sync that do not exist yet, at most userWorkers at a
+// time, so a large first sync is not held up by one round trip after another. It returns
+// the users that could not be created, which the sync skips. Users are only created here
+// when creating them touches nothing but their own role: not in a transaction, which has a
+// single connection, nor with hooks, automatic admin grants or an rds_iam grant left to the
+// elevated script, which are run in order.
+func (m *Manager) createUsers(users []structs.UserConfig, result *structs.SyncResult) map[string]bool {
+	if m.userWorkers <= 1 || m.tx != nil || m.dryRun || len(m.hooks) > 0 {
+		return nil
+	}
+
+	var candidates []*structs.UserConfig
+	var names []string
+	for i := range users {
+		user := &users[i]
+		if user.Absent || !user.Enabled || len(user.PreviousNames) > 0 {
+			continue
+		}
+		if user.HasAuthMethod(structs.AuthMethodIAM) && (m.autoGrantAdmin || m.elevated.membership("rds_iam") != "") {
+			continue
+		}
+		if m.checkpoint != nil && m.checkpoint.Done("user:"+user.Username) {
+			continue
+		}
+		candidates = append(candidates, user)
+		names = append(names, user.Username)
+	}
+	if len(candidates) < 2 {
+		return nil
+	}
+
+	// One lookup finds the users that already exist, and answers their later lookups too
+	existing, err := m.queryStrings("SELECT rolname FROM pg_roles WHERE rolname = ANY($1)", pq.Array(names))
+	if err != nil {
+		m.logger.WithError(err).Debug("Could not look up users to create, creating them one at a time")
+		return nil
+	}
+	m.rememberRoles(names, existing)
+
+	var missing []*structs.UserConfig
+	for _, user := range candidates {
+		if !slices.Contains(existing, user.Username) {
+			missing = append(missing, user)
+		}
+	}
+	if len(missing) < 2 {
+		return nil
+	}
+
+	m.logger.WithFields(logrus.Fields{
+		"users":   len(missing),
+		"workers": m.userWorkers,
+	}).Info("Creating new users concurrently")
+
+	errs := make([]error, len(missing))
+	elapsed := make([]time.Duration, len(missing))
+	generate := make([]bool, len(missing))
+	workers := make(chan struct{}, m.userWorkers)
+	var wg sync.WaitGroup
+	for i, user := range missing {
+		generate[i] = user.GeneratePassword && user.Password == ""
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			workers <- struct{}{}
+			defer func() { <-workers }()
+
+			start := time.Now()
+			errs[i] = m.CreateUser(user)
+			elapsed[i] = time.Since(start)
+		}()
+	}
+	wg.Wait()
+
+	// Results are recorded in configuration order, whichever worker finished first
+	failed := make(map[string]bool)
+	for i, user := range missing {
+		m.recordTiming(result, "user:"+user.Username, "create", elapsed[i])
+		if errs[i] != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("failed to create user %s: %w", user.Username, errs[i]))
+			failed[user.Username] = true
+			continue
+		}
+		if generate[i] && user.Password != "" {
+			result.GeneratedPasswords = append(result.GeneratedPasswords, structs.GeneratedPassword{Username: user.Username, Password: user.Password})
+		}
+	}
+	return failed
+}
+
+// timed runs a sync operation, records how long it took in the sync result and
+// logs it when it is slower than the slow operation threshold
+func (m *Manager) timed(result *structs.SyncResult, entity, operation string, fn func() error) error {
+	// A failed transaction rejects every further statement, so the rest of the entity is skipped
+	if m.syncFailed(result) {
+		return nil
+	}
+
+	m.entity = entity
+	defer func() { m.entity = "" }()
+
+	start := time.Now()
+	err := fn()
+	m.recordTiming(result, entity, operation, time.Since(start))
+	return err
+}
+
+// recordTiming records how long a sync operation took, logging it when it was slow
+func (m *Manager) recordTiming(result *structs.SyncResult, entity, operation string, elapsed time.Duration) {
+	result.Timings = append(result.Timings, structs.OperationTiming{
+		Entity:    entity,
+		Operation: operation,
+		Duration:  elapsed,
+	})
+
+	if m.slowThreshold > 0 && elapsed >= m.slowThreshold {
+		m.logger.WithFields(logrus.Fields{
+			"entity":    entity,
+			"operation": operation,
+			"duration":  elapsed.String(),
+			"threshold": m.slowThreshold.String(),
+		}).Warn("Slow sync operation")
+	}
+}
+
+// SummarizeTimings aggregates operation timings by operation type, sorted by total duration
+func SummarizeTimings(timings []structs.OperationTiming) []structs.TimingSummary {
+	byOperation := make(map[string]*structs.TimingSummary)
+	for _, timing := range timings {
+		summary, exists := byOperation[timing.Operation]
+		if !exists {
+			summary = &structs.TimingSummary{Operation: timing.Operation}
+			byOperation[timing.Operation] = summary
+		}
+
+		summary.Count++
+		summary.Total += timing.Duration
+		if timing.Duration > summary.Max {
+			summary.Max = timing.Duration
+			summary.SlowestEntity = timing.Entity
+		}
+	}
+
+	summaries := make([]structs.TimingSummary, 0, len(byOperation))
+	for _, summary := range byOperation {
+		summaries = append(summaries, *summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].Total != summaries[j].Total {
+			return summaries[i].Total > summaries[j].Total
+		}
+		return summaries[i].Operation < summaries[j].Operation
+	})
+
+	return summaries
+}
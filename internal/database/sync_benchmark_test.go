@@ -0,0 +1,118 @@
+package database
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+// Budgets of the statements and queries a sync may send per declared role. They are ceilings
+// rather than measurements: lower them when an optimization lands, so it cannot quietly regress.
+const (
+	createStatementsPerRole = 4  // First sync: create the role, mark it as managed and grant to it
+	resyncStatementsPerRole = 0  // Unchanged configuration: every change is skipped
+	resyncQueriesPerRole    = 20 // Unchanged configuration: catalog lookups to compare against
+)
+
+// benchmarkGroups is the number of groups the users of a benchmark configuration share
+const benchmarkGroups = 10
+
+// BenchmarkSync syncs synthetic configurations against a test cluster. The first sync creates
+// every role and is reported as create-statements and create-s; the timed loop syncs the
+// unchanged configuration again. Both fail when they exceed the budgets above.
+func BenchmarkSync(b *testing.B) {
+	for _, users := range []int{100, 1000, 10000} {
+		b.Run(fmt.Sprintf("users=%d", users), func(b *testing.B) {
+			if testing.Short() && users > 1000 {
+				b.Skip("skipping the largest configuration in short mode")
+			}
+
+			setup := SetupTestDatabase(b)
+			defer setup.Cleanup(b)
+
+			config := benchmarkConfig(users, setup.ConnInfo.Database)
+			defer dropBenchmarkRoles(b, setup, config)
+			roles := len(config.Users) + len(config.Groups)
+
+			start := time.Now()
+			result := benchmarkSync(b, setup.Manager, config)
+			b.ReportMetric(float64(result.StatementsExecuted), "create-statements")
+			b.ReportMetric(time.Since(start).Seconds(), "create-s")
+			checkBudget(b, "first sync", result.StatementsExecuted, createStatementsPerRole*roles)
+
+			for b.Loop() {
+				result = benchmarkSync(b, setup.Manager, config)
+			}
+			b.ReportMetric(float64(result.StatementsExecuted), "statements/op")
+			b.ReportMetric(float64(result.QueriesRun), "queries/op")
+			checkBudget(b, "unchanged sync statements", result.StatementsExecuted, resyncStatementsPerRole*roles)
+			checkBudget(b, "unchanged sync queries", result.QueriesRun, resyncQueriesPerRole*roles)
+		})
+	}
+}
+
+// benchmarkConfig returns a configuration of password users spread over a few groups, which
+// are granted CONNECT on the database
+func benchmarkConfig(users int, database string) *structs.Config {
+	config := &structs.Config{}
+	for i := range benchmarkGroups {
+		config.Groups = append(config.Groups, structs.GroupConfig{
+			Name:       fmt.Sprintf("bench_group_%d", i),
+			Inherit:    true,
+			Privileges: []string{"CONNECT"},
+			Databases:  []string{database},
+		})
+	}
+	for i := range users {
+		config.Users = append(config.Users, structs.UserConfig{
+			Username: fmt.Sprintf("bench_user_%05d", i),
+			Password: "bench_pass",
+			Groups:   []string{config.Groups[i%benchmarkGroups].Name},
+			Enabled:  true,
+			CanLogin: true,
+		})
+	}
+	return config
+}
+
+// benchmarkSync syncs a configuration, stopping the benchmark when any operation failed
+func benchmarkSync(b *testing.B, manager *Manager, config *structs.Config) *structs.SyncResult {
+	result, err := manager.SyncConfiguration(config)
+	if err != nil {
+		b.Fatalf("Failed to sync configuration: %v", err)
+	}
+	if len(result.Errors) > 0 {
+		b.Fatalf("Sync failed with %d error(s), the first: %v", len(result.Errors), result.Errors[0])
+	}
+	return result
+}
+
+// checkBudget fails the benchmark when a count exceeds its budget
+func checkBudget(b *testing.B, what string, count, budget int) {
+	if count > budget {
+		b.Errorf("%s: %d exceeds the budget of %d", what, count, budget)
+	}
+}
+
+// dropBenchmarkRoles drops the roles of a benchmark configuration, which outlive the test
+// database unless the cluster is a container of its own
+func dropBenchmarkRoles(b *testing.B, setup *TestDatabaseSetup, config *structs.Config) {
+	if setup.Mode == TestDatabaseContainer {
+		return
+	}
+
+	setup.Manager.SetCascade(true)
+	defer setup.Manager.SetCascade(false)
+	for _, user := range config.Users {
+		if err := setup.Manager.DropUser(user.Username); err != nil {
+			b.Logf("Error dropping benchmark user %s: %v", user.Username, err)
+		}
+	}
+	for _, group := range config.Groups {
+		if err := setup.Manager.DropGroup(group.Name); err != nil {
+			b.Logf("Error dropping benchmark group %s: %v", group.Name, err)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package database
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+func TestSummarizeTimings(t *testing.T) {
+	timings := []structs.OperationTiming{
+		{Entity: "group:app_group", Operation: "create", Duration: 10 * time.Millisecond},
+		{Entity: "user:app_user", Operation: "create", Duration: 30 * time.Millisecond},
+		{Entity: "user:app_user", Operation: "grant", Duration: 100 * time.Millisecond},
+		{Entity: "user:report_user", Operation: "grant", Duration: 5 * time.Millisecond},
+	}
+
+	summaries := SummarizeTimings(timings)
+	if len(summaries) != 2 {
+		t.Fatalf("Expected 2 summaries, got %d", len(summaries))
+	}
+
+	// Sorted by total duration, slowest operation type first
+	grant := summaries[0]
+	if grant.Operation != "grant" || grant.Count != 2 || grant.Total != 105*time.Millisecond {
+		t.Errorf("Unexpected grant summary: %+v", grant)
+	}
+	if grant.Max != 100*time.Millisecond || grant.SlowestEntity != "user:app_user" {
+		t.Errorf("Expected slowest grant to be user:app_user at 100ms, got %+v", grant)
+	}
+
+	create := summaries[1]
+	if create.Operation != "create" || create.Count != 2 || create.SlowestEntity != "user:app_user" {
+		t.Errorf("Unexpected create summary: %+v", create)
+	}
+}
+
+func TestDryRunStatementsAreGroupedByEntity(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	m := &Manager{logger: logger, dryRun: true, statements: []structs.PlannedStatement{}}
+	result := &structs.SyncResult{}
+
+	m.timed(result, "group:app_group", "create", func() error { return m.execute("CREATE ROLE app_group") })
+	m.timed(result, "user:app_user", "alter", func() error { return m.execute("ALTER ROLE app_user PASSWORD 'SCRAM-SHA-256$4096:abc'") })
+	m.execute("REVOKE rds_iam FROM CURRENT_USER")
+
+	expected := []structs.PlannedStatement{
+		{Entity: "group:app_group", Query: "CREATE ROLE app_group"},
+		{Entity: "user:app_user", Query: "ALTER ROLE app_user PASSWORD 'SCRAM-SHA-256$4096:abc'"},
+		{Entity: "", Query: "REVOKE rds_iam FROM CURRENT_USER"},
+	}
+	if !reflect.DeepEqual(m.statements, expected) {
+		t.Errorf("Expected statements %+v, got %+v", expected, m.statements)
+	}
+
+	// Collected statements are redacted like logged ones
+	m.statements = []structs.PlannedStatement{}
+	m.SetRedactPasswords(true)
+	m.execute("ALTER ROLE app_user PASSWORD 'SCRAM-SHA-256$4096:abc'")
+	if m.statements[0].Query != "ALTER ROLE app_user "+redactedPassword {
+		t.Errorf("Expected the password to be redacted, got %s", m.statements[0].Query)
+	}
+}
+
+func TestSyncConfigurationRecordsTimings(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	config := &structs.Config{
+		Groups: []structs.GroupConfig{{Name: "test_group", Inherit: true}},
+		Users: []structs.UserConfig{
+			{Username: "test_user", Password: "test_pass", Groups: []string{"test_group"}, Enabled: true, CanLogin: true},
+		},
+	}
+
+	result, err := setup.Manager.SyncConfiguration(config)
+	if err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+
+	entities := make(map[string]bool)
+	for _, timing := range result.Timings {
+		entities[timing.Entity+"/"+timing.Operation] = true
+	}
+
+	for _, expected := range []string{"group:test_group/create", "user:test_user/create", "user:test_user/membership"} {
+		if !entities[expected] {
+			t.Errorf("Expected timing for %s, got %v", expected, result.Timings)
+		}
+	}
+
+	if result.Duration <= 0 {
+		t.Error("Expected total sync duration to be recorded")
+	}
+}
+
+func TestSyncCountsStatements(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	config := &structs.Config{
+		Groups: []structs.GroupConfig{{Name: "test_group", Inherit: true}},
+		Users: []structs.UserConfig{
+			{Username: "test_user", Password: "test_pass", Groups: []string{"test_group"}, Enabled: true, CanLogin: true},
+		},
+	}
+
+	result, err := setup.Manager.SyncConfiguration(config)
+	if err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+	if result.StatementsExecuted == 0 || result.QueriesRun == 0 {
+		t.Errorf("Expected the first sync to count statements and queries, got %d and %d", result.StatementsExecuted, result.QueriesRun)
+	}
+
+	// An unchanged configuration only reads the catalog
+	result, err = setup.Manager.SyncConfiguration(config)
+	if err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+	if result.StatementsExecuted != 0 || result.QueriesRun == 0 {
+		t.Errorf("Expected the second sync to only run queries, got %d statements and %d queries", result.StatementsExecuted, result.QueriesRun)
+	}
+}
+
+func TestSyncResumesFromCheckpoint(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	path := filepath.Join(t.TempDir(), "checkpoint")
+	checkpoint := NewCheckpoint(path, "sha256:abc", "")
+	if err := checkpoint.MarkDone("user:test_user"); err != nil {
+		t.Fatalf("Failed to write checkpoint: %v", err)
+	}
+
+	resumed, err := LoadCheckpoint(path, "sha256:abc", "")
+	if err != nil {
+		t.Fatalf("Failed to load checkpoint: %v", err)
+	}
+	setup.Manager.SetCheckpoint(resumed)
+	defer setup.Manager.SetCheckpoint(nil)
+
+	config := &structs.Config{
+		Users: []structs.UserConfig{
+			{Username: "test_user", Password: "test_pass", Enabled: true, CanLogin: true},
+			{Username: "test_user_2", Password: "test_pass", Enabled: true, CanLogin: true},
+		},
+	}
+	result, err := setup.Manager.SyncConfiguration(config)
+	if err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+
+	// The checkpointed user is skipped, so it is not created in this test
+	if len(result.Resumed) != 1 || result.Resumed[0] != "user:test_user" {
+		t.Errorf("Expected test_user to be skipped, got %v", result.Resumed)
+	}
+	if exists, _ := setup.Manager.UserExists("test_user"); exists {
+		t.Error("Expected the checkpointed user not to be synced again")
+	}
+	if exists, _ := setup.Manager.UserExists("test_user_2"); !exists {
+		t.Error("Expected test_user_2 to be synced")
+	}
+	if !resumed.Done("user:test_user_2") {
+		t.Errorf("Expected test_user_2 to be checkpointed, got %v", resumed.Completed)
+	}
+}
+
+func TestSyncGeneratesPasswordsForNewUsers(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	config := &structs.Config{
+		Users: []structs.UserConfig{
+			{Username: "test_user", GeneratePassword: true, PasswordLength: 20, Enabled: true, CanLogin: true},
+		},
+	}
+	result, err := setup.Manager.SyncConfiguration(config)
+	if err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+
+	if len(result.GeneratedPasswords) != 1 || len(result.GeneratedPasswords[0].Password) != 20 {
+		t.Fatalf("Expected one generated password of 20 characters, got %v", result.GeneratedPasswords)
+	}
+	verifier, readable, err := setup.Manager.getPasswordVerifier("test_user")
+	if err != nil || !readable || !passwordMatchesVerifier("test_user", result.GeneratedPasswords[0].Password, verifier) {
+		t.Errorf("Expected the generated password to be set (readable=%v, err=%v)", readable, err)
+	}
+
+	// Existing users keep their password, so it is only generated and reported once
+	result, err = setup.Manager.SyncConfiguration(config)
+	if err != nil {
+		t.Fatalf("Failed to sync configuration again: %v", err)
+	}
+	if len(result.GeneratedPasswords) != 0 {
+		t.Errorf("Expected no password to be generated for an existing user, got %v", result.GeneratedPasswords)
+	}
+}
+
+func TestSyncCreatesNewUsersConcurrently(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	setup.Manager.SetUserWorkers(4)
+	defer setup.Manager.SetUserWorkers(DefaultUserWorkers)
+
+	config := &structs.Config{Groups: []structs.GroupConfig{{Name: "test_group", Inherit: true}}}
+	for _, username := range []string{"test_user", "test_user_2", "password_user", "group_user", "priv_user"} {
+		config.Users = append(config.Users, structs.UserConfig{
+			Username:         username,
+			GeneratePassword: true,
+			Groups:           []string{"test_group"},
+			Enabled:          true,
+			CanLogin:         true,
+		})
+	}
+	// A user that cannot be created does not hold back the others
+	config.Users = append(config.Users, structs.UserConfig{Username: strings.Repeat("x", 64), Enabled: true, CanLogin: true})
+
+	result, err := setup.Manager.SyncConfiguration(config)
+	if err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+	if len(result.Errors) != 1 || !strings.Contains(result.Errors[0].Error(), "failed to create user xxx") {
+		t.Errorf("Expected only the invalid user to fail, got %v", result.Errors)
+	}
+
+	// Passwords are reported in configuration order, whichever user was created first
+	if len(result.GeneratedPasswords) != 5 {
+		t.Fatalf("Expected five generated passwords, got %v", result.GeneratedPasswords)
+	}
+	for i, generated := range result.GeneratedPasswords {
+		if generated.Username != config.Users[i].Username {
+			t.Errorf("Expected password %d to be for %s, got %s", i, config.Users[i].Username, generated.Username)
+		}
+		members, err := setup.Manager.GetRoleMemberships(generated.Username)
+		if err != nil || len(members) != 1 || members[0] != "test_group" {
+			t.Errorf("Expected %s to be created and added to test_group, got %v (err: %v)", generated.Username, members, err)
+		}
+	}
+}
+
+func TestSetUserWorkers(t *testing.T) {
+	m := &Manager{}
+	m.SetUserWorkers(0)
+	if m.userWorkers != 1 {
+		t.Errorf("Expected at least one user worker, got %d", m.userWorkers)
+	}
+	m.SetUserWorkers(8)
+	if m.userWorkers != 8 {
+		t.Errorf("Expected 8 user workers, got %d", m.userWorkers)
+	}
+}
+
+func TestTransactionalSyncRollsBackOnError(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+	defer setup.ResetDatabase(t)
+
+	setup.Manager.SetTransactional(true)
+	defer setup.Manager.SetTransactional(false)
+
+	config := &structs.Config{
+		Groups: []structs.GroupConfig{{Name: "test_group", Inherit: true}},
+		Users: []structs.UserConfig{
+			{Username: "test_user", Password: "test_pass", Groups: []string{"test_group"}, Enabled: true, CanLogin: true},
+			{Username: "test_user_2", Password: "test_pass", Privileges: []string{"CONNECT"}, Databases: []string{"no_such_database"}, Enabled: true, CanLogin: true},
+			{Username: "test_user_3", Password: "test_pass", Enabled: true, CanLogin: true},
+		},
+	}
+	result, err := setup.Manager.SyncConfiguration(config)
+	if err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+
+	if !result.RolledBack || len(result.Errors) == 0 {
+		t.Fatalf("Expected the sync to fail and roll back, got %+v", result)
+	}
+	if len(result.UsersCreated) != 0 || len(result.GroupsCreated) != 0 {
+		t.Errorf("Expected no changes to be reported, got users %v and groups %v", result.UsersCreated, result.GroupsCreated)
+	}
+	for _, role := range []string{"test_group", "test_user", "test_user_2", "test_user_3"} {
+		if exists, _ := setup.Manager.UserExists(role); exists {
+			t.Errorf("Expected %s to be rolled back", role)
+		}
+	}
+
+	// Without a transaction the roles before and after the failing one are kept
+	setup.Manager.SetTransactional(false)
+	result, err = setup.Manager.SyncConfiguration(config)
+	if err != nil {
+		t.Fatalf("Failed to sync configuration: %v", err)
+	}
+	if result.RolledBack {
+		t.Error("Expected a sync that continues on error not to roll back")
+	}
+	for _, role := range []string{"test_group", "test_user", "test_user_3"} {
+		if exists, _ := setup.Manager.UserExists(role); !exists {
+			t.Errorf("Expected %s to be created", role)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+// TestSetupTestDatabase validates that the test setup of the selected mode works
+func TestSetupTestDatabase(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+
+	// Test that we can connect and perform basic operations
+	if setup.Manager == nil {
+		t.Fatal("Expected non-nil manager")
+	}
+
+	if setup.Manager.db == nil {
+		t.Fatal("Expected non-nil database connection")
+	}
+
+	// Test that we can actually ping the database
+	if err := setup.Manager.db.Ping(); err != nil {
+		t.Fatalf("Failed to ping database: %v", err)
+	}
+
+	// Test basic database operation that requires a working connection
+	exists, err := setup.Manager.UserExists("nonexistent_user")
+	if err != nil {
+		t.Fatalf("Failed to check user existence: %v", err)
+	}
+	if exists {
+		t.Error("Expected nonexistent user to not exist")
+	}
+
+	t.Log("Database connection successful!")
+}
+
+// TestDockerEnvironmentDetection tests our Docker environment detection
+func TestDockerEnvironmentDetection(t *testing.T) {
+	env := detectDockerEnvironment()
+
+	t.Logf("Detected Docker environment: Type=%s, SocketPath=%s", env.Type, env.SocketPath)
+
+	// Ensure we get a valid environment type
+	validTypes := map[string]bool{
+		"colima":         true,
+		"docker-desktop": true,
+		"lima":           true,
+		"podman":         true,
+		"unknown":        true,
+	}
+
+	if !validTypes[env.Type] {
+		t.Errorf("Invalid environment type detected: %s", env.Type)
+	}
+}
+
+func TestTestDatabaseMode(t *testing.T) {
+	t.Setenv(TestDatabaseModeEnv, "")
+	t.Setenv("USE_LOCAL_POSTGRES", "")
+
+	if mode, err := testDatabaseMode(""); err != nil || mode != TestDatabaseContainer {
+		t.Errorf("Expected a container per test by default, got %q (err: %v)", mode, err)
+	}
+
+	t.Setenv("USE_LOCAL_POSTGRES", "true")
+	if mode, _ := testDatabaseMode(""); mode != TestDatabaseLocal {
+		t.Errorf("Expected USE_LOCAL_POSTGRES to select local mode, got %q", mode)
+	}
+
+	t.Setenv(TestDatabaseModeEnv, "shared")
+	if mode, _ := testDatabaseMode(""); mode != TestDatabaseShared {
+		t.Errorf("Expected %s to take precedence over USE_LOCAL_POSTGRES, got %q", TestDatabaseModeEnv, mode)
+	}
+
+	// A mode requested by the test takes precedence over the environment
+	if mode, _ := testDatabaseMode(TestDatabaseContainer); mode != TestDatabaseContainer {
+		t.Errorf("Expected the requested mode, got %q", mode)
+	}
+
+	t.Setenv(TestDatabaseModeEnv, "docker")
+	if _, err := testDatabaseMode(""); err == nil {
+		t.Error("Expected an invalid mode to be rejected")
+	}
+}
+
+func TestTestDatabaseDriver(t *testing.T) {
+	t.Setenv(TestDatabaseDriverEnv, "")
+
+	if driver, err := testDatabaseDriver(""); err != nil || driver != structs.DriverPQ {
+		t.Errorf("Expected pq by default, got %q (err: %v)", driver, err)
+	}
+
+	t.Setenv(TestDatabaseDriverEnv, structs.DriverPGX)
+	if driver, _ := testDatabaseDriver(""); driver != structs.DriverPGX {
+		t.Errorf("Expected %s to select pgx, got %q", TestDatabaseDriverEnv, driver)
+	}
+
+	// A driver requested by the test takes precedence over the environment
+	if driver, _ := testDatabaseDriver(structs.DriverPQ); driver != structs.DriverPQ {
+		t.Errorf("Expected the requested driver, got %q", driver)
+	}
+
+	t.Setenv(TestDatabaseDriverEnv, "mysql")
+	if _, err := testDatabaseDriver(""); err == nil {
+		t.Error("Expected an invalid driver to be rejected")
+	}
+}
@@ -0,0 +1,211 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+// sqlExecutor runs statements and queries, either on the connection pool or in the
+// transaction of a transactional sync
+type sqlExecutor interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// statementCounts counts the statements and queries run on the connected database, so a
+// sync can report how much work it sent to the server
+type statementCounts struct {
+	statements atomic.Int64
+	queries    atomic.Int64
+}
+
+// boundExecutor runs statements and queries with the context of the manager
+type boundExecutor struct {
+	ctx      context.Context
+	executor sqlExecutor
+	writable func() error // Checked before every statement, which changes the server
+	counts   *statementCounts
+}
+
+// Exec runs a statement, unless the server cannot be written to
+func (b boundExecutor) Exec(query string, args ...any) (sql.Result, error) {
+	if err := b.writable(); err != nil {
+		return nil, err
+	}
+	b.counts.statements.Add(1)
+	return b.executor.ExecContext(b.ctx, query, args...)
+}
+
+// Query runs a query returning rows
+func (b boundExecutor) Query(query string, args ...any) (*sql.Rows, error) {
+	b.counts.queries.Add(1)
+	return b.executor.QueryContext(b.ctx, query, args...)
+}
+
+// QueryRow runs a query returning at most one row
+func (b boundExecutor) QueryRow(query string, args ...any) *sql.Row {
+	b.counts.queries.Add(1)
+	return b.executor.QueryRowContext(b.ctx, query, args...)
+}
+
+// deferredObjectGrants are the object grants of an entity in other databases, which a
+// transactional sync applies once it has committed
+type deferredObjectGrants struct {
+	entity  string
+	target  string
+	batches []objectGrantBatch
+}
+
+// deferredApply is a schema or policy in another database, which a transactional sync applies
+// once it has committed
+type deferredApply struct {
+	entity string
+	apply  func(result *structs.SyncResult) error
+}
+
+// SetTransactional makes SyncConfiguration apply all role and grant changes in one
+// transaction, stopping and rolling everything back on the first error. Grants, schemas,
+// policies and hook SQL in other databases cannot share the transaction and are applied after
+// it commits. Dry runs are unaffected.
+func (m *Manager) SetTransactional(transactional bool) {
+	m.transactional = transactional
+}
+
+// executor returns where statements run: the open sync transaction, or the connection pool,
+// bound to the context of the manager
+func (m *Manager) executor() boundExecutor {
+	if m.tx != nil {
+		return boundExecutor{ctx: m.context(), executor: m.tx, writable: m.checkWritable, counts: &m.counts}
+	}
+	return boundExecutor{ctx: m.context(), executor: m.db, writable: m.checkWritable, counts: &m.counts}
+}
+
+// beginSync opens the transaction of a transactional sync
+func (m *Manager) beginSync() error {
+	if !m.transactional || m.dryRun {
+		return nil
+	}
+
+	// Checked before the transaction holds a connection the check may need
+	if err := m.checkWritable(); err != nil {
+		return err
+	}
+
+	tx, err := m.db.BeginTx(m.context(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin sync transaction: %w", err)
+	}
+	m.tx = tx
+	m.logger.Debug("Applying changes in a single transaction")
+	return nil
+}
+
+// syncFailed reports whether a transactional sync hit an error, after which nothing more is
+// applied because the transaction is rolled back
+func (m *Manager) syncFailed(result *structs.SyncResult) bool {
+	return m.tx != nil && len(result.Errors) > 0
+}
+
+// finishSync commits the transaction of a transactional sync, or rolls it back when the sync
+// failed, and then terminates the sessions of disabled users, applies the object grants,
+// schemas and policies and runs the hook SQL in other databases and hook commands deferred
+// until then
+func (m *Manager) finishSync(result *structs.SyncResult) {
+	if m.tx == nil {
+		return
+	}
+	tx := m.tx
+	m.tx = nil
+	deferred := m.deferredGrants
+	m.deferredGrants = nil
+	hooks := m.deferredHooks
+	m.deferredHooks = nil
+	applies := m.deferredApplies
+	m.deferredApplies = nil
+	sessions := m.deferredSessions
+	m.deferredSessions = nil
+
+	// A transaction whose context was cancelled has already been rolled back
+	if len(result.Errors) == 0 {
+		if err := tx.Commit(); err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("failed to commit sync transaction: %w", err))
+		}
+	} else if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+		result.Errors = append(result.Errors, fmt.Errorf("failed to roll back sync transaction: %w", err))
+	}
+
+	// Cached lookups may have seen roles that no longer exist
+	if len(result.Errors) > 0 {
+		m.InvalidateCatalogCache()
+		discardChanges(result)
+		m.logger.WithField("errors", len(result.Errors)).Warn("Sync failed, all changes were rolled back")
+		return
+	}
+	m.logger.Debug("Committed sync transaction")
+
+	for _, username := range sessions {
+		if _, err := m.TerminateSessions(username); err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("%s was disabled but its sessions could not be terminated after commit: %w", username, err))
+		}
+	}
+
+	for _, grants := range deferred {
+		m.entity = grants.entity
+		for _, err := range m.applyObjectGrantBatches(grants.target, grants.batches) {
+			result.Errors = append(result.Errors, fmt.Errorf("failed to grant extension privileges to %s after commit: %w", grants.target, err))
+		}
+		m.entity = ""
+	}
+	if len(deferred) > 0 {
+		m.logger.WithFields(logrus.Fields{
+			"entities": len(deferred),
+		}).Debug("Applied object grants in other databases after commit")
+	}
+
+	// Applied after the commit, they are checkpointed one by one like entities of other syncs
+	for _, deferred := range applies {
+		m.entity = deferred.entity
+		if err := deferred.apply(result); err != nil {
+			result.Errors = append(result.Errors, err)
+		} else {
+			m.checkpointEntity(deferred.entity, len(result.Errors), result)
+		}
+		m.entity = ""
+	}
+
+	for _, hook := range hooks {
+		m.entity = hook.entity
+		if err := m.runHookAfterSQL(hook.hook, hook.data); err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("%s was created but hook %s failed after commit: %w", hook.data.Role, hook.hook.config.Name, err))
+		}
+		m.entity = ""
+	}
+}
+
+// discardChanges clears the changes of a rolled back sync from its result, so it only reports
+// what went wrong
+func discardChanges(result *structs.SyncResult) {
+	result.RolledBack = true
+	result.UsersCreated = nil
+	result.UsersModified = nil
+	result.UsersRemoved = nil
+	result.UsersDisabled = nil
+	result.UsersRenamed = nil
+	result.GroupsCreated = nil
+	result.GroupsModified = nil
+	result.GroupsRemoved = nil
+	result.PoliciesApplied = nil
+	result.SchemasApplied = nil
+	result.MembershipsRevoked = nil
+	result.MembershipsExpired = nil
+	result.PrivilegesRevoked = nil
+	result.GeneratedPasswords = nil
+	result.RotatedPasswords = nil
+}
@@ -0,0 +1,125 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/sirupsen/logrus"
+)
+
+// errNotConnected is returned by dry-run checks of a manager without a connection, whose
+// statements are planned without being checked
+var errNotConnected = errors.New("no database connection to check against")
+
+// planRole records that a dry run would create or drop a role, so the statements planned
+// after it are checked against the roles that would exist by then
+func (m *Manager) planRole(role string, exists bool) {
+	if m.plannedRoles == nil {
+		m.plannedRoles = make(map[string]bool)
+	}
+	m.plannedRoles[role] = exists
+}
+
+// plannedRoleExists reports whether a role would exist at this point of a dry run: as
+// planned when an earlier statement creates or drops it, as it exists now otherwise
+func (m *Manager) plannedRoleExists(role string) (bool, error) {
+	if exists, planned := m.plannedRoles[role]; planned {
+		return exists, nil
+	}
+	if m.db == nil {
+		return false, errNotConnected
+	}
+	return m.roleExists(role)
+}
+
+// roleProblems returns why a statement on roles would fail because one of them would not
+// exist. A role that cannot be looked up is not reported, as the check only informs the plan.
+func (m *Manager) roleProblems(roles ...string) []string {
+	var problems []string
+	for _, role := range roles {
+		exists, err := m.plannedRoleExists(role)
+		if err != nil {
+			m.logger.WithError(err).WithField("role", role).Debug("DRY RUN: Could not check role")
+			continue
+		}
+		if !exists {
+			problems = append(problems, fmt.Sprintf("role %s does not exist", role))
+		}
+	}
+	return problems
+}
+
+// membershipProblems returns why granting membership in a group would fail: either role
+// does not exist, or the connected role cannot administer the group. A group the dry run
+// creates is administered by its creator, and with automatic admin grants the connected
+// role would grant itself ADMIN OPTION first.
+func (m *Manager) membershipProblems(member, group string) []string {
+	problems := m.roleProblems(group, member)
+	if len(problems) > 0 || m.autoGrantAdmin || m.plannedRoles[group] || m.db == nil {
+		return problems
+	}
+
+	var admin bool
+	err := m.executor().QueryRow(`
+		SELECT rolsuper
+			OR (rolcreaterole AND current_setting('server_version_num')::int < $2)
+			OR pg_has_role(current_user, $1, 'MEMBER WITH ADMIN OPTION')
+		FROM pg_roles WHERE rolname = current_user`, group, adminOptionVersion).Scan(&admin)
+	if err != nil {
+		m.logger.WithError(err).WithField("group", group).Debug("DRY RUN: Could not check admin option")
+		return nil
+	}
+	if !admin {
+		problems = append(problems, fmt.Sprintf("connected role has no ADMIN OPTION on role %s (or use --auto-grant-admin)", group))
+	}
+	return problems
+}
+
+// databaseProblems returns why granting privileges on a database to a role would fail
+// because the role or the database would not exist
+func (m *Manager) databaseProblems(target, database string) []string {
+	problems := m.roleProblems(target)
+	if m.db == nil {
+		return problems
+	}
+
+	var found int
+	err := m.executor().QueryRow("SELECT 1 FROM pg_database WHERE datname = $1", database).Scan(&found)
+	switch {
+	case err == sql.ErrNoRows:
+		problems = append(problems, fmt.Sprintf("database %s does not exist", database))
+	case err != nil:
+		m.logger.WithError(err).WithField("database", database).Debug("DRY RUN: Could not check database")
+	}
+	return problems
+}
+
+// appendProblems appends the problems not reported yet, as a statement on several roles or
+// databases checks the same role more than once
+func appendProblems(problems []string, more ...string) []string {
+	for _, problem := range more {
+		if !slices.Contains(problems, problem) {
+			problems = append(problems, problem)
+		}
+	}
+	return problems
+}
+
+// countFailingStatements returns how many planned statements would fail and logs each of them
+func (m *Manager) countFailingStatements() int {
+	failing := 0
+	for _, statement := range m.statements {
+		if statement.Problem == "" {
+			continue
+		}
+		failing++
+		m.logger.WithFields(logrus.Fields{
+			"entity":  statement.Entity,
+			"query":   m.logQuery(statement.Query),
+			"problem": statement.Problem,
+		}).Warn("DRY RUN: Statement would fail")
+	}
+	return failing
+}
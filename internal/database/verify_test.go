@@ -0,0 +1,87 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+func TestPlannedRolesOverrideLiveRoles(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	m := &Manager{logger: logger, dryRun: true}
+
+	// Planned roles are answered without querying the database
+	m.planRole("new_group", true)
+	m.planRole("old_user", false)
+
+	if problems := m.roleProblems("new_group"); len(problems) != 0 {
+		t.Errorf("Expected a role the dry run creates to exist, got %v", problems)
+	}
+	problems := m.roleProblems("old_user")
+	if len(problems) != 1 || problems[0] != "role old_user does not exist" {
+		t.Errorf("Expected a role the dry run drops to be missing, got %v", problems)
+	}
+
+	// A group the dry run creates is administered by the connected role
+	if problems := m.membershipProblems("old_user", "new_group"); len(problems) != 1 {
+		t.Errorf("Expected only the missing member to be reported, got %v", problems)
+	}
+}
+
+func TestDryRunSyncReportsFailingStatements(t *testing.T) {
+	setup := SetupTestDatabase(t)
+	defer setup.Cleanup(t)
+
+	dryRunManager, err := NewManager(setup.ConnInfo, setup.Logger, true)
+	if err != nil {
+		t.Fatalf("Failed to create dry-run manager: %v", err)
+	}
+	defer dryRunManager.Close()
+	dryRunManager.SetSkipPreflight(true)
+
+	config := &structs.Config{
+		Users: []structs.UserConfig{
+			{
+				Username:   "verify_user",
+				Password:   "test_pass",
+				AuthMethod: "password",
+				Groups:     []string{"verify_group", "unmanaged_group"},
+				Privileges: []string{"CONNECT"},
+				Databases:  []string{"testdb", "missing_db"},
+				Enabled:    true,
+				CanLogin:   true,
+			},
+		},
+		Groups: []structs.GroupConfig{
+			{Name: "verify_group", Inherit: true},
+		},
+	}
+
+	result, err := dryRunManager.SyncConfiguration(config)
+	if err != nil {
+		t.Fatalf("Dry-run sync failed: %v", err)
+	}
+
+	problems := make(map[string]string)
+	for _, statement := range result.Statements {
+		problems[statement.Query] = statement.Problem
+	}
+
+	// Memberships and privileges are granted together, and roles that only exist once the
+	// plan has run are not reported
+	expected := map[string]string{
+		`GRANT "verify_group", "unmanaged_group" TO "verify_user"`:          "role unmanaged_group does not exist",
+		`GRANT CONNECT ON DATABASE "testdb", "missing_db" TO "verify_user"`: "database missing_db does not exist",
+	}
+	for query, problem := range expected {
+		if actual, planned := problems[query]; !planned || actual != problem {
+			t.Errorf("Expected %s to fail with %q, got %q (planned: %v)", query, problem, actual, planned)
+		}
+	}
+
+	if len(result.Warnings) == 0 || result.Warnings[len(result.Warnings)-1].Message != "2 planned statement(s) would fail, see the statement preview" {
+		t.Errorf("Expected a warning about the failing statements, got %+v", result.Warnings)
+	}
+}
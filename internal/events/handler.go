@@ -9,18 +9,50 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// Event types the handler understands; the Cognito trigger sources share their names
+const (
+	EventPostConfirmation = "PostConfirmation_ConfirmSignUp"
+	EventGroupAdded       = "GroupMembership_GroupAdded"
+	EventGroupRemoved     = "GroupMembership_GroupRemoved"
+	EventUserMigration    = "UserMigration_Authentication"
+)
+
 // EventHandler handles AWS Cognito events for future integration
 type EventHandler struct {
-	logger *logrus.Logger
+	logger        *logrus.Logger
+	mapper        *GroupMapper
+	sanitizer     *Sanitizer
+	defaultGroups []string // Granted to every user provisioned from an event
 }
 
-// NewEventHandler creates a new event handler
+// NewEventHandler creates a new event handler using the default group mappings and
+// username rules
 func NewEventHandler(logger *logrus.Logger) *EventHandler {
+	mapper, _ := NewGroupMapper(DefaultGroupMappings)
+	sanitizer, _ := NewSanitizer(structs.UsernameRulesConfig{})
 	return &EventHandler{
-		logger: logger,
+		logger:    logger,
+		mapper:    mapper,
+		sanitizer: sanitizer,
 	}
 }
 
+// SetGroupMapper replaces the mapping of Cognito groups to PostgreSQL roles
+func (h *EventHandler) SetGroupMapper(mapper *GroupMapper) {
+	h.mapper = mapper
+}
+
+// SetSanitizer replaces the rules that turn logins into role names
+func (h *EventHandler) SetSanitizer(sanitizer *Sanitizer) {
+	h.sanitizer = sanitizer
+}
+
+// SetDefaultGroups sets the groups every user provisioned from an event is a member of, on
+// top of the roles its identity provider groups map to
+func (h *EventHandler) SetDefaultGroups(groups []string) {
+	h.defaultGroups = groups
+}
+
 // ProcessEvent processes an incoming event and returns corresponding user configuration
 func (h *EventHandler) ProcessEvent(eventData []byte) (*structs.UserConfig, error) {
 	h.logger.Debug("Processing incoming event")
@@ -30,6 +62,11 @@ func (h *EventHandler) ProcessEvent(eventData []byte) (*structs.UserConfig, erro
 		return nil, fmt.Errorf("failed to unmarshal event: %w", err)
 	}
 
+	return h.ProcessPayload(&event)
+}
+
+// ProcessPayload returns the user configuration for a decoded event payload
+func (h *EventHandler) ProcessPayload(event *structs.EventPayload) (*structs.UserConfig, error) {
 	h.logger.WithFields(logrus.Fields{
 		"event_type": event.EventType,
 		"user_id":    event.UserID,
@@ -38,27 +75,38 @@ func (h *EventHandler) ProcessEvent(eventData []byte) (*structs.UserConfig, erro
 
 	// Convert Cognito event to user configuration
 	userConfig := &structs.UserConfig{
-		Username:    event.Username,
+		Username:    h.SanitizeUsername(event.Username),
+		ExternalID:  event.UserID,
 		Groups:      event.Groups,
 		Enabled:     true,
 		Description: fmt.Sprintf("User created from Cognito event at %s", event.Timestamp.Format(time.RFC3339)),
 	}
 
+	// String metadata, such as Cognito user attributes, is passed on to user hooks
+	for name, value := range event.Metadata {
+		if text, ok := value.(string); ok {
+			if userConfig.Metadata == nil {
+				userConfig.Metadata = map[string]string{}
+			}
+			userConfig.Metadata[name] = text
+		}
+	}
+
 	// Handle different event types
 	switch event.EventType {
-	case "PostConfirmation_ConfirmSignUp":
+	case EventPostConfirmation:
 		h.logger.Info("Handling user signup confirmation")
 		// User has been confirmed, create PostgreSQL user
-		
-	case "GroupMembership_GroupAdded":
+
+	case EventGroupAdded:
 		h.logger.Info("Handling group membership addition")
 		// User added to group, update PostgreSQL roles
-		
-	case "GroupMembership_GroupRemoved":
+
+	case EventGroupRemoved:
 		h.logger.Info("Handling group membership removal")
 		// User removed from group, update PostgreSQL roles
-		
-	case "UserMigration_Authentication":
+
+	case EventUserMigration:
 		h.logger.Info("Handling user migration")
 		// User migration event
 		
@@ -72,35 +120,37 @@ func (h *EventHandler) ProcessEvent(eventData []byte) (*structs.UserConfig, erro
 
 // MapCognitoGroupsToRoles maps Cognito groups to PostgreSQL roles
 func (h *EventHandler) MapCognitoGroupsToRoles(groups []string) []string {
-	// This function will be implemented to map Cognito groups to PostgreSQL roles
-	// For now, it returns the groups as-is
 	h.logger.WithField("groups", groups).Debug("Mapping Cognito groups to PostgreSQL roles")
-	
-	roleMapping := map[string]string{
-		"Admins":     "admin_group",
-		"Users":      "app_group",
-		"ReadOnly":   "read_only",
-		"Developers": "dev_group",
-	}
+	return h.mapper.Map(groups)
+}
 
-	var roles []string
-	for _, group := range groups {
-		if role, exists := roleMapping[group]; exists {
-			roles = append(roles, role)
-		} else {
-			// If no mapping exists, use the group name as-is (sanitized)
-			roles = append(roles, group)
-		}
-	}
+// MappedRoles returns the roles the group mappings name for Cognito groups, without the
+// groups that keep their own name because no mapping matches them
+func (h *EventHandler) MappedRoles(groups []string) map[string]bool {
+	return h.mapper.Mapped(groups)
+}
 
-	return roles
+// NamesRole reports whether a group mapping names a database role
+func (h *EventHandler) NamesRole(role string) bool {
+	return h.mapper.Names(role)
 }
 
-// SanitizeUsername ensures the username is valid for PostgreSQL
+// SanitizeUsername turns a login, such as a Cognito email, into a valid PostgreSQL role name
 func (h *EventHandler) SanitizeUsername(username string) string {
-	// Implement username sanitization for PostgreSQL compatibility
-	// For now, return as-is
-	return username
+	sanitized := h.sanitizer.Sanitize(username)
+	if sanitized != username {
+		h.logger.WithFields(logrus.Fields{
+			"login":    username,
+			"username": sanitized,
+		}).Debug("Sanitized username")
+	}
+	return sanitized
+}
+
+// DisambiguateUsername returns the role name for a user whose sanitized name belongs to
+// another identity
+func (h *EventHandler) DisambiguateUsername(username, externalID string) string {
+	return h.sanitizer.Disambiguate(username, externalID)
 }
 
 // ValidateEvent validates that an event payload is properly formatted
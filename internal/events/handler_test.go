@@ -272,6 +272,11 @@ func TestSanitizeUsername(t *testing.T) {
 			input:    "",
 			expected: "",
 		},
+		{
+			name:     "email login",
+			input:    "Jane.Doe@example.com",
+			expected: "jane_doe",
+		},
 	}
 
 	for _, tt := range tests {
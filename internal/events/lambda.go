@@ -0,0 +1,222 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	lambdaevents "github.com/aws/aws-lambda-go/events"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/database"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrInvalidEvent is returned for events that cannot be applied, such as unknown event types
+var ErrInvalidEvent = errors.New("invalid event")
+
+// RoleManager is the subset of the database manager events are applied through
+type RoleManager interface {
+	CreateUser(user *structs.UserConfig) error
+	RoleCanLogin(name string) (bool, bool, error)
+	RoleExternalID(name string) (bool, string, error)
+	GetRoleAttributes(role string) (*structs.RoleAttributes, error)
+	AddUserToGroup(username, groupName string) error
+	RemoveUserFromGroup(username, groupName string) error
+}
+
+// Applier applies processed events to the database
+type Applier struct {
+	handler    *EventHandler
+	manager    RoleManager
+	authMethod string
+	logger     *logrus.Logger
+}
+
+// NewApplier creates an applier that provisions users with the given auth method
+func NewApplier(handler *EventHandler, manager RoleManager, authMethod string) *Applier {
+	return &Applier{
+		handler:    handler,
+		manager:    manager,
+		authMethod: authMethod,
+		logger:     handler.logger,
+	}
+}
+
+// HandleLambda is the Lambda entrypoint. It accepts Cognito user pool trigger events,
+// which are returned unchanged as Cognito requires, and event payloads such as group
+// membership changes published through EventBridge.
+func (a *Applier) HandleLambda(ctx context.Context, raw json.RawMessage) (json.RawMessage, error) {
+	trigger, isTrigger, err := CognitoTriggerPayload(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if isTrigger {
+		if trigger.EventType != EventPostConfirmation {
+			// Other triggers expect a response this handler does not produce, so they pass through
+			a.logger.WithField("trigger_source", trigger.EventType).Debug("Ignoring Cognito trigger")
+			return raw, nil
+		}
+		if err := a.ApplyPayload(trigger); err != nil {
+			return nil, err
+		}
+		return raw, nil
+	}
+
+	var event structs.EventPayload
+	if err := json.Unmarshal(raw, &event); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal event: %w", err)
+	}
+	if err := a.ApplyPayload(&event); err != nil {
+		return nil, err
+	}
+	return json.Marshal(map[string]string{"status": "applied", "username": a.handler.SanitizeUsername(event.Username)})
+}
+
+// ApplyPayload processes an event payload and applies the resulting user configuration
+func (a *Applier) ApplyPayload(event *structs.EventPayload) error {
+	user, err := a.handler.ProcessPayload(event)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+	}
+	if user.Username == "" {
+		return fmt.Errorf("%w: event %s has no username", ErrInvalidEvent, event.EventType)
+	}
+	if user.Username, err = a.resolveUsername(user); err != nil {
+		return err
+	}
+	mapped := a.handler.MappedRoles(user.Groups)
+	user.Groups = a.handler.MapCognitoGroupsToRoles(user.Groups)
+
+	switch event.EventType {
+	case EventPostConfirmation:
+		return a.provision(user, mapped)
+	case EventGroupAdded:
+		return a.changeMemberships(user, true, mapped)
+	case EventGroupRemoved:
+		return a.changeMemberships(user, false, mapped)
+	default:
+		return fmt.Errorf("%w: event type %s cannot be applied", ErrInvalidEvent, event.EventType)
+	}
+}
+
+// resolveUsername returns the role of the event's user. A sanitized name that belongs to the
+// role of another identity gets a hash of the user's identity provider ID appended, so two
+// logins that sanitize to the same name never share a role. Roles without a recorded ID,
+// such as roles created before IDs were recorded, are used as they are.
+func (a *Applier) resolveUsername(user *structs.UserConfig) (string, error) {
+	if user.ExternalID == "" {
+		return user.Username, nil
+	}
+
+	for _, name := range []string{user.Username, a.handler.DisambiguateUsername(user.Username, user.ExternalID)} {
+		exists, owner, err := a.manager.RoleExternalID(name)
+		if err != nil {
+			return "", err
+		}
+		if exists && owner != "" && owner != user.ExternalID {
+			continue
+		}
+
+		if name != user.Username {
+			a.logger.WithFields(logrus.Fields{
+				"username":    user.Username,
+				"external_id": user.ExternalID,
+				"role":        name,
+			}).Warn("Username belongs to another identity, using a disambiguated role name")
+		}
+		return name, nil
+	}
+	return "", fmt.Errorf("%w: username %s of %s collides with the roles of other identities", ErrInvalidEvent, user.Username, user.ExternalID)
+}
+
+// provision creates the user if it does not exist yet and grants its groups and the default
+// groups
+func (a *Applier) provision(user *structs.UserConfig, mapped map[string]bool) error {
+	user.AddDefaultGroups(a.handler.defaultGroups)
+	for _, group := range a.handler.defaultGroups {
+		mapped[group] = true
+	}
+
+	exists, canLogin, err := a.manager.RoleCanLogin(user.Username)
+	if err != nil {
+		return err
+	}
+	if exists && !canLogin {
+		return fmt.Errorf("role %s exists and is not a login role", user.Username)
+	}
+
+	if !exists {
+		user.AuthMethod = a.authMethod
+		user.CanLogin = true
+		if err := a.manager.CreateUser(user); err != nil {
+			return err
+		}
+		a.logger.WithField("username", user.Username).Info("User provisioned from event")
+	}
+
+	return a.changeMemberships(user, true, mapped)
+}
+
+// changeMemberships grants or revokes the user's groups, skipping groups without a role and
+// groups that events may not change the members of
+func (a *Applier) changeMemberships(user *structs.UserConfig, add bool, mapped map[string]bool) error {
+	for _, group := range user.Groups {
+		attributes, err := a.manager.GetRoleAttributes(group)
+		if err != nil {
+			return err
+		}
+		if attributes == nil {
+			a.logger.WithFields(logrus.Fields{
+				"username": user.Username,
+				"group":    group,
+			}).Warn("No database role for group, skipping")
+			continue
+		}
+		if reason := database.RefuseGroup(group, attributes, mapped[group]); reason != "" {
+			a.logger.WithFields(logrus.Fields{
+				"username": user.Username,
+				"group":    group,
+				"reason":   reason,
+			}).Warn("Refusing to change membership of group, skipping")
+			continue
+		}
+
+		if add {
+			err = a.manager.AddUserToGroup(user.Username, group)
+		} else {
+			err = a.manager.RemoveUserFromGroup(user.Username, group)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CognitoTriggerPayload converts a Cognito user pool trigger event into an event payload.
+// It reports false when the event is not a Cognito trigger.
+func CognitoTriggerPayload(raw []byte) (*structs.EventPayload, bool, error) {
+	var trigger lambdaevents.CognitoEventUserPoolsPostConfirmation
+	if err := json.Unmarshal(raw, &trigger); err != nil {
+		return nil, false, fmt.Errorf("failed to unmarshal event: %w", err)
+	}
+	if trigger.TriggerSource == "" {
+		return nil, false, nil
+	}
+
+	metadata := make(map[string]interface{}, len(trigger.Request.UserAttributes))
+	for name, value := range trigger.Request.UserAttributes {
+		metadata[name] = value
+	}
+
+	return &structs.EventPayload{
+		EventType: trigger.TriggerSource,
+		UserID:    trigger.Request.UserAttributes["sub"],
+		Username:  trigger.UserName,
+		Metadata:  metadata,
+		Timestamp: time.Now(),
+	}, true, nil
+}
@@ -0,0 +1,228 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/database"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/database/fake"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+// newFakeManager creates a fake manager whose catalog holds the given managed groups
+func newFakeManager(groups ...string) *fake.Manager {
+	manager := fake.NewManager()
+	for _, group := range groups {
+		manager.AddRole(fake.Role{Name: group, Inherit: true, Managed: database.ManagedKindGroup})
+	}
+	return manager
+}
+
+// memberships returns the groups a role of the fake catalog is a member of, in name order
+func memberships(manager *fake.Manager, role string) []string {
+	groups, _ := manager.GetRoleMemberships(role)
+	return groups
+}
+
+func newTestApplier(manager RoleManager) *Applier {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	return NewApplier(NewEventHandler(logger), manager, structs.AuthMethodIAM)
+}
+
+const postConfirmationTrigger = `{
+	"version": "1",
+	"triggerSource": "PostConfirmation_ConfirmSignUp",
+	"region": "eu-west-2",
+	"userPoolId": "eu-west-2_example",
+	"userName": "Jane.Doe@example.com",
+	"callerContext": {"awsSdkVersion": "aws-sdk-unknown-unknown", "clientId": "client"},
+	"request": {"userAttributes": {"sub": "1234-abcd", "email": "jane.doe@example.com"}},
+	"response": {}
+}`
+
+func TestHandleLambdaPostConfirmation(t *testing.T) {
+	manager := newFakeManager("rds_iam")
+	applier := newTestApplier(manager)
+
+	response, err := applier.HandleLambda(context.Background(), json.RawMessage(postConfirmationTrigger))
+	if err != nil {
+		t.Fatalf("HandleLambda failed: %v", err)
+	}
+	if string(response) != postConfirmationTrigger {
+		t.Error("Expected the Cognito trigger to be returned unchanged")
+	}
+
+	// The dot of the login is not allowed in role names
+	user := manager.Role("jane_doe")
+	if user == nil {
+		t.Fatalf("Expected user jane_doe to be created, got %v", manager.Roles())
+	}
+	if user.ExternalID != "1234-abcd" {
+		t.Errorf("Expected the Cognito sub to be recorded, got %q", user.ExternalID)
+	}
+	if groups := memberships(manager, "jane_doe"); !slices.Equal(groups, []string{"rds_iam"}) || !user.CanLogin {
+		t.Errorf("Expected an IAM login role, got memberships %v and can login %v", groups, user.CanLogin)
+	}
+}
+
+func TestApplyPayloadDefaultGroups(t *testing.T) {
+	manager := newFakeManager("base_access", "analysts")
+	applier := newTestApplier(manager)
+	applier.handler.SetDefaultGroups([]string{"base_access"})
+
+	signup := &structs.EventPayload{EventType: EventPostConfirmation, Username: "jane", Groups: []string{"analysts"}}
+	if err := applier.ApplyPayload(signup); err != nil {
+		t.Fatalf("ApplyPayload failed: %v", err)
+	}
+	if groups := memberships(manager, "jane"); strings.Join(groups, ",") != "analysts,base_access" {
+		t.Errorf("Expected the mapped and default groups to be granted, got %v", groups)
+	}
+
+	// Leaving an identity provider group does not take the baseline access away
+	removed := &structs.EventPayload{EventType: EventGroupRemoved, Username: "jane", Groups: []string{"analysts"}}
+	if err := applier.ApplyPayload(removed); err != nil {
+		t.Fatalf("ApplyPayload failed: %v", err)
+	}
+	if groups := memberships(manager, "jane"); strings.Join(groups, ",") != "base_access" {
+		t.Errorf("Expected only the removed group to be revoked, got %v", groups)
+	}
+}
+
+func TestHandleLambdaIgnoresOtherTriggers(t *testing.T) {
+	manager := newFakeManager()
+	applier := newTestApplier(manager)
+
+	trigger := `{"triggerSource": "PostConfirmation_ConfirmForgotPassword", "userName": "jane", "request": {"userAttributes": {}}}`
+	response, err := applier.HandleLambda(context.Background(), json.RawMessage(trigger))
+	if err != nil {
+		t.Fatalf("HandleLambda failed: %v", err)
+	}
+	if string(response) != trigger {
+		t.Error("Expected the trigger to pass through unchanged")
+	}
+	if roles := manager.Roles(); len(roles) != 0 {
+		t.Errorf("Expected no users to be created, got %v", roles)
+	}
+}
+
+func TestHandleLambdaGroupMembership(t *testing.T) {
+	manager := newFakeManager("app_group")
+	manager.AddRole(fake.Role{Name: "jane", CanLogin: true})
+	applier := newTestApplier(manager)
+
+	added, _ := json.Marshal(structs.EventPayload{
+		EventType: EventGroupAdded,
+		UserID:    "1234-abcd",
+		Username:  "jane@example.com",
+		Groups:    []string{"Users", "Developers"},
+		Timestamp: time.Now(),
+	})
+	if _, err := applier.HandleLambda(context.Background(), added); err != nil {
+		t.Fatalf("HandleLambda failed: %v", err)
+	}
+	// Developers maps to dev_group, which has no role and is skipped
+	if groups := memberships(manager, "jane"); !slices.Equal(groups, []string{"app_group"}) {
+		t.Errorf("Expected app_group to be granted, got %v", groups)
+	}
+
+	removed, _ := json.Marshal(structs.EventPayload{
+		EventType: EventGroupRemoved,
+		UserID:    "1234-abcd",
+		Username:  "jane",
+		Groups:    []string{"Users"},
+		Timestamp: time.Now(),
+	})
+	if _, err := applier.HandleLambda(context.Background(), removed); err != nil {
+		t.Fatalf("HandleLambda failed: %v", err)
+	}
+	if groups := memberships(manager, "jane"); len(groups) != 0 {
+		t.Errorf("Expected app_group to be revoked, got %v", groups)
+	}
+}
+
+func TestApplyPayloadRefusesUnsafeGroups(t *testing.T) {
+	manager := newFakeManager("rds_superuser")
+	manager.AddRole(fake.Role{Name: "jane", CanLogin: true})
+	manager.AddRole(fake.Role{Name: "app_owner", CanLogin: true})
+	manager.AddRole(fake.Role{Name: "dba", CreateRole: true})
+	manager.AddRole(fake.Role{Name: "legacy_reports"})
+	manager.AddRole(fake.Role{Name: "admin_group", Superuser: true})
+	manager.AddRole(fake.Role{Name: "app_group"})
+	applier := newTestApplier(manager)
+
+	// Users maps to app_group, which is granted although sync does not manage it
+	event := &structs.EventPayload{
+		EventType: EventGroupAdded,
+		Username:  "jane",
+		Groups:    []string{"rds_superuser", "app_owner", "dba", "legacy_reports", "Admins", "Users"},
+	}
+	if err := applier.ApplyPayload(event); err != nil {
+		t.Fatalf("ApplyPayload failed: %v", err)
+	}
+	if groups := memberships(manager, "jane"); !slices.Equal(groups, []string{"app_group"}) {
+		t.Errorf("Expected only app_group to be granted, got %v", groups)
+	}
+}
+
+func TestApplyPayloadRejectsGroupRole(t *testing.T) {
+	manager := newFakeManager("jane")
+	applier := newTestApplier(manager)
+
+	err := applier.ApplyPayload(&structs.EventPayload{
+		EventType: EventPostConfirmation,
+		UserID:    "1234-abcd",
+		Username:  "jane",
+	})
+	if err == nil {
+		t.Error("Expected provisioning over a group role to fail")
+	}
+}
+
+func TestApplyPayloadDisambiguatesCollidingUsernames(t *testing.T) {
+	manager := newFakeManager("app_group")
+	manager.AddRole(fake.Role{Name: "jane_doe", CanLogin: true, ExternalID: "1111-aaaa"})
+	applier := newTestApplier(manager)
+
+	event := &structs.EventPayload{
+		EventType: EventPostConfirmation,
+		UserID:    "2222-bbbb",
+		Username:  "jane-doe@example.org",
+		Groups:    []string{"Users"},
+	}
+	if err := applier.ApplyPayload(event); err != nil {
+		t.Fatalf("ApplyPayload failed: %v", err)
+	}
+
+	disambiguated := applier.handler.DisambiguateUsername("jane_doe", "2222-bbbb")
+	if user := manager.Role(disambiguated); user == nil || user.ExternalID != "2222-bbbb" {
+		t.Fatalf("Expected %s to be created for the second identity, got %v", disambiguated, manager.Roles())
+	}
+	if members, _ := manager.GetGroupMembers("app_group"); !slices.Equal(members, []string{disambiguated}) {
+		t.Errorf("Expected only the new role to be granted app_group, got %v", members)
+	}
+
+	// Later events of the same identity resolve to the same role
+	event.EventType = EventGroupRemoved
+	if err := applier.ApplyPayload(event); err != nil {
+		t.Fatalf("ApplyPayload failed: %v", err)
+	}
+	if members, _ := manager.GetGroupMembers("app_group"); len(members) != 0 {
+		t.Errorf("Expected app_group to be revoked from the new role, got %v", members)
+	}
+
+	// The first identity keeps its role
+	event.UserID = "1111-aaaa"
+	event.EventType = EventGroupAdded
+	if err := applier.ApplyPayload(event); err != nil {
+		t.Fatalf("ApplyPayload failed: %v", err)
+	}
+	if members, _ := manager.GetGroupMembers("app_group"); !slices.Equal(members, []string{"jane_doe"}) {
+		t.Errorf("Expected app_group to be granted to jane_doe, got %v", members)
+	}
+}
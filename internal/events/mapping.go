@@ -0,0 +1,123 @@
+package events
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+// DefaultGroupMappings are the mappings used when the configuration has no group_mappings
+var DefaultGroupMappings = structs.GroupMappingConfig{
+	Groups: map[string]string{
+		"Admins":     "admin_group",
+		"Users":      "app_group",
+		"ReadOnly":   "read_only",
+		"Developers": "dev_group",
+	},
+}
+
+// GroupMapper maps identity provider groups to database roles
+type GroupMapper struct {
+	config structs.GroupMappingConfig
+	rules  []*regexp.Regexp
+}
+
+// NewGroupMapper creates a mapper from group mappings, compiling their rules
+func NewGroupMapper(config structs.GroupMappingConfig) (*GroupMapper, error) {
+	mapper := &GroupMapper{config: config}
+	for _, rule := range config.Rules {
+		pattern, err := CompileRulePattern(rule.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		mapper.rules = append(mapper.rules, pattern)
+	}
+	return mapper, nil
+}
+
+// CompileRulePattern compiles the pattern of a mapping rule, anchored to the whole group name
+func CompileRulePattern(pattern string) (*regexp.Regexp, error) {
+	compiled, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid group mapping pattern %q: %w", pattern, err)
+	}
+	return compiled, nil
+}
+
+// Map returns the roles of the groups, in order and without duplicates. Group and role
+// names are put in NFC form, as the role names of the configuration are.
+func (m *GroupMapper) Map(groups []string) []string {
+	var roles []string
+	seen := make(map[string]bool, len(groups))
+	for _, group := range groups {
+		role, _ := m.role(structs.NormalizeIdentifier(group))
+		role = structs.NormalizeIdentifier(role)
+		if role == "" || seen[role] {
+			continue
+		}
+		seen[role] = true
+		roles = append(roles, role)
+	}
+	return roles
+}
+
+// Mapped returns the roles a mapping names for the groups, leaving out the groups no mapping
+// matches, which keep their own name
+func (m *GroupMapper) Mapped(groups []string) map[string]bool {
+	roles := make(map[string]bool, len(groups))
+	for _, group := range groups {
+		if role, mapped := m.role(structs.NormalizeIdentifier(group)); mapped && role != "" {
+			roles[structs.NormalizeIdentifier(role)] = true
+		}
+	}
+	return roles
+}
+
+// Names reports whether a mapping names a role: a group, the default or a rule maps to it
+// exactly, or it starts with the role name prefix of a prefix mapping. Rules whose role
+// refers to submatches cannot be reversed and name no role.
+func (m *GroupMapper) Names(role string) bool {
+	role = structs.NormalizeIdentifier(role)
+	if role == "" {
+		return false
+	}
+	for _, mapped := range m.config.Groups {
+		if structs.NormalizeIdentifier(mapped) == role {
+			return true
+		}
+	}
+	for _, prefix := range m.config.Prefixes {
+		if rest, ok := strings.CutPrefix(role, structs.NormalizeIdentifier(prefix.Replace)); ok && prefix.Replace != "" && rest != "" {
+			return true
+		}
+	}
+	for _, rule := range m.config.Rules {
+		if !strings.Contains(rule.Role, "$") && structs.NormalizeIdentifier(rule.Role) == role {
+			return true
+		}
+	}
+	return structs.NormalizeIdentifier(m.config.DefaultRole) == role
+}
+
+// role returns the role of a single group and whether a mapping matched it
+func (m *GroupMapper) role(group string) (string, bool) {
+	if role, ok := m.config.Groups[group]; ok {
+		return role, true
+	}
+	for _, prefix := range m.config.Prefixes {
+		if rest, ok := strings.CutPrefix(group, prefix.Prefix); ok && rest != "" {
+			return prefix.Replace + rest, true
+		}
+	}
+	for i, rule := range m.rules {
+		if match := rule.FindStringSubmatchIndex(group); match != nil {
+			return string(rule.ExpandString(nil, m.config.Rules[i].Role, group, match)), true
+		}
+	}
+	if m.config.DefaultRole != "" {
+		return m.config.DefaultRole, true
+	}
+	return group, false
+}
@@ -0,0 +1,88 @@
+package events
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+func TestGroupMapper(t *testing.T) {
+	mapper, err := NewGroupMapper(structs.GroupMappingConfig{
+		Groups:   map[string]string{"Admins": "admin_group", "team-platform": "platform_admins"},
+		Prefixes: []structs.PrefixMapping{{Prefix: "team-", Replace: "team_"}, {Prefix: "app:", Replace: ""}},
+		Rules: []structs.RuleMapping{
+			{Pattern: `dept-(?P<dept>[a-z]+)-(read|write)`, Role: "${dept}_$2"},
+			{Pattern: `ops-.*`, Role: "ops_group"},
+		},
+		DefaultRole: "app_group",
+	})
+	if err != nil {
+		t.Fatalf("NewGroupMapper failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		groups   []string
+		expected []string
+	}{
+		{name: "exact names win over prefixes", groups: []string{"Admins", "team-platform"}, expected: []string{"admin_group", "platform_admins"}},
+		{name: "prefixes are replaced", groups: []string{"team-data", "app:billing"}, expected: []string{"team_data", "billing"}},
+		{name: "rules expand submatches", groups: []string{"dept-finance-read", "ops-oncall"}, expected: []string{"finance_read", "ops_group"}},
+		{name: "rules match the whole name", groups: []string{"xdept-finance-read"}, expected: []string{"app_group"}},
+		{name: "unmatched groups share the default role once", groups: []string{"Guests", "Visitors", "ops-a"}, expected: []string{"app_group", "ops_group"}},
+		{name: "empty groups", groups: nil, expected: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if roles := mapper.Map(tt.groups); !slices.Equal(roles, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, roles)
+			}
+		})
+	}
+}
+
+func TestGroupMapperWithoutDefaultKeepsNames(t *testing.T) {
+	mapper, err := NewGroupMapper(structs.GroupMappingConfig{Groups: map[string]string{"Users": "app_group"}})
+	if err != nil {
+		t.Fatalf("NewGroupMapper failed: %v", err)
+	}
+	if roles := mapper.Map([]string{"Users", "analysts"}); !slices.Equal(roles, []string{"app_group", "analysts"}) {
+		t.Errorf("Expected unmatched groups to keep their names, got %v", roles)
+	}
+	if mapped := mapper.Mapped([]string{"Users", "analysts"}); len(mapped) != 1 || !mapped["app_group"] {
+		t.Errorf("Expected only app_group to be mapped, got %v", mapped)
+	}
+}
+
+func TestGroupMapperNames(t *testing.T) {
+	mapper, err := NewGroupMapper(structs.GroupMappingConfig{
+		Groups:   map[string]string{"Users": "app_group"},
+		Prefixes: []structs.PrefixMapping{{Prefix: "team-", Replace: "team_"}, {Prefix: "x-", Replace: ""}},
+		Rules:    []structs.RuleMapping{{Pattern: "ops", Role: "ops_group"}, {Pattern: "dept-(.*)", Role: "dept_$1"}},
+	})
+	if err != nil {
+		t.Fatalf("NewGroupMapper failed: %v", err)
+	}
+
+	for role, expected := range map[string]bool{
+		"app_group": true,
+		"team_data": true,
+		"team_":     false,
+		"ops_group": true,
+		"dept_hr":   false,
+		"analysts":  false,
+		"":          false,
+	} {
+		if named := mapper.Names(role); named != expected {
+			t.Errorf("Names(%q) = %v, expected %v", role, named, expected)
+		}
+	}
+}
+
+func TestNewGroupMapperRejectsInvalidPattern(t *testing.T) {
+	if _, err := NewGroupMapper(structs.GroupMappingConfig{Rules: []structs.RuleMapping{{Pattern: "dept-(", Role: "x"}}}); err == nil {
+		t.Error("Expected an invalid pattern to be rejected")
+	}
+}
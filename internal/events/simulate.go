@@ -0,0 +1,75 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+// Formats of the events the pipeline accepts
+const (
+	// FormatCognito is a Cognito user pool trigger, as Lambda receives it
+	FormatCognito = "cognito"
+	// FormatPayload is an event payload, as published through EventBridge or posted to /events
+	FormatPayload = "payload"
+)
+
+// GroupMapping is the role an identity provider group maps to, empty when it maps to none
+type GroupMapping struct {
+	Group string `json:"group"`
+	Role  string `json:"role"`
+}
+
+// Simulation is what each stage of the pipeline makes of an event, before anything is applied
+type Simulation struct {
+	Format     string                `json:"format"`
+	Event      *structs.EventPayload `json:"event"`
+	Ignored    bool                  `json:"ignored"`              // Cognito triggers other than PostConfirmation pass through untouched
+	Validation string                `json:"validation,omitempty"` // Problem ValidateEvent reports, empty when valid
+	Processing string                `json:"processing,omitempty"` // Why the event cannot be processed, empty when it can
+	Username   string                `json:"username"`             // Role name of the login, before disambiguation
+	Groups     []GroupMapping        `json:"groups"`
+}
+
+// Simulate runs an event through parsing, validation, username sanitization and group
+// mapping without applying it. Only events that cannot be parsed fail; later stages report
+// their problems in the simulation, so the stages after them still show their output.
+func (h *EventHandler) Simulate(raw []byte) (*Simulation, error) {
+	event, isTrigger, err := CognitoTriggerPayload(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	simulation := &Simulation{Format: FormatCognito, Event: event}
+	if isTrigger {
+		simulation.Ignored = event.EventType != EventPostConfirmation
+	} else {
+		simulation.Format = FormatPayload
+		simulation.Event = &structs.EventPayload{}
+		if err := json.Unmarshal(raw, simulation.Event); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal event: %w", err)
+		}
+	}
+
+	if err := h.ValidateEvent(simulation.Event); err != nil {
+		simulation.Validation = err.Error()
+	}
+
+	user, err := h.ProcessPayload(simulation.Event)
+	if err != nil {
+		simulation.Processing = err.Error()
+		user = &structs.UserConfig{Username: h.SanitizeUsername(simulation.Event.Username), Groups: simulation.Event.Groups}
+	}
+	simulation.Username = user.Username
+
+	simulation.Groups = make([]GroupMapping, len(user.Groups))
+	for i, group := range user.Groups {
+		simulation.Groups[i] = GroupMapping{Group: group}
+		if roles := h.MapCognitoGroupsToRoles([]string{group}); len(roles) > 0 {
+			simulation.Groups[i].Role = roles[0]
+		}
+	}
+
+	return simulation, nil
+}
@@ -0,0 +1,87 @@
+package events
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func newTestHandler() *EventHandler {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	return NewEventHandler(logger)
+}
+
+func TestSimulateCognitoTrigger(t *testing.T) {
+	simulation, err := newTestHandler().Simulate([]byte(postConfirmationTrigger))
+	if err != nil {
+		t.Fatalf("Simulate failed: %v", err)
+	}
+
+	if simulation.Format != FormatCognito || simulation.Ignored {
+		t.Errorf("Expected a Cognito trigger that is applied, got format %s, ignored %v", simulation.Format, simulation.Ignored)
+	}
+	if simulation.Event.UserID != "1234-abcd" {
+		t.Errorf("Expected the Cognito sub as the user ID, got %q", simulation.Event.UserID)
+	}
+	if simulation.Validation != "" || simulation.Processing != "" {
+		t.Errorf("Expected a valid event, got %q and %q", simulation.Validation, simulation.Processing)
+	}
+	if simulation.Username != "jane_doe" {
+		t.Errorf("Expected username jane_doe, got %s", simulation.Username)
+	}
+}
+
+func TestSimulateIgnoredTrigger(t *testing.T) {
+	trigger := `{"triggerSource": "PostConfirmation_ConfirmForgotPassword", "userName": "jane", "request": {"userAttributes": {}}}`
+	simulation, err := newTestHandler().Simulate([]byte(trigger))
+	if err != nil {
+		t.Fatalf("Simulate failed: %v", err)
+	}
+	if !simulation.Ignored {
+		t.Error("Expected the trigger to be ignored")
+	}
+}
+
+func TestSimulatePayload(t *testing.T) {
+	payload := `{"eventType": "GroupMembership_GroupAdded", "userId": "1234-abcd", "username": "jane@example.com", "groups": ["Users", "Sales"]}`
+	simulation, err := newTestHandler().Simulate([]byte(payload))
+	if err != nil {
+		t.Fatalf("Simulate failed: %v", err)
+	}
+
+	if simulation.Format != FormatPayload {
+		t.Errorf("Expected an event payload, got %s", simulation.Format)
+	}
+	if simulation.Username != "jane" {
+		t.Errorf("Expected username jane, got %s", simulation.Username)
+	}
+	expected := []GroupMapping{{Group: "Users", Role: "app_group"}, {Group: "Sales", Role: "Sales"}}
+	if !slices.Equal(simulation.Groups, expected) {
+		t.Errorf("Expected mappings %v, got %v", expected, simulation.Groups)
+	}
+}
+
+func TestSimulateReportsInvalidEvents(t *testing.T) {
+	handler := newTestHandler()
+
+	simulation, err := handler.Simulate([]byte(`{"eventType": "UserDeleted", "username": "Jane"}`))
+	if err != nil {
+		t.Fatalf("Simulate failed: %v", err)
+	}
+	if simulation.Validation != "user ID is required" {
+		t.Errorf("Expected the missing user ID to be reported, got %q", simulation.Validation)
+	}
+	if simulation.Processing != "unknown event type: UserDeleted" {
+		t.Errorf("Expected the unknown event type to be reported, got %q", simulation.Processing)
+	}
+	// The later stages still run
+	if simulation.Username != "jane" {
+		t.Errorf("Expected username jane, got %s", simulation.Username)
+	}
+
+	if _, err := handler.Simulate([]byte(`{"eventType": `)); err == nil {
+		t.Error("Expected an event that does not parse to fail")
+	}
+}
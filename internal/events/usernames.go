@@ -0,0 +1,132 @@
+package events
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+const (
+	// MaxIdentifierLength is the longest role name PostgreSQL keeps (NAMEDATALEN - 1); longer
+	// names are silently truncated, so two long logins could otherwise end up as one role
+	MaxIdentifierLength = structs.MaxIdentifierLength
+
+	// DefaultUsernamePrefix is prepended to names that do not start with a letter
+	DefaultUsernamePrefix = "u_"
+
+	// hashSuffixLength is the number of hex digits of the hash that keeps shortened and
+	// disambiguated names apart
+	hashSuffixLength = 8
+)
+
+// reservedUsernames cannot be used as role names, or refer to something else in GRANT statements
+var reservedUsernames = map[string]bool{
+	"public":       true,
+	"none":         true,
+	"current_user": true,
+	"current_role": true,
+	"session_user": true,
+}
+
+// invalidUsernameChars matches runs of characters that are not allowed in role names
+var invalidUsernameChars = regexp.MustCompile(`[^a-z0-9_]+`)
+
+// Sanitizer turns identity provider logins into valid PostgreSQL role names. The same login
+// always gives the same name, so later events for a user find the role created for it.
+type Sanitizer struct {
+	rules        structs.UsernameRulesConfig
+	replacements []*regexp.Regexp
+}
+
+// NewSanitizer creates a sanitizer from username rules, compiling their replacements
+func NewSanitizer(rules structs.UsernameRulesConfig) (*Sanitizer, error) {
+	if rules.Prefix == "" {
+		rules.Prefix = DefaultUsernamePrefix
+	}
+	if rules.MaxLength <= 0 || rules.MaxLength > MaxIdentifierLength {
+		rules.MaxLength = MaxIdentifierLength
+	}
+	if rules.MaxLength <= hashSuffixLength+1 {
+		return nil, fmt.Errorf("username max_length must be more than %d", hashSuffixLength+1)
+	}
+	if err := CheckUsernamePrefix(rules.Prefix); err != nil {
+		return nil, err
+	}
+
+	sanitizer := &Sanitizer{rules: rules}
+	for _, replacement := range rules.Replacements {
+		pattern, err := regexp.Compile(replacement.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid username replacement pattern %q: %w", replacement.Pattern, err)
+		}
+		sanitizer.replacements = append(sanitizer.replacements, pattern)
+	}
+	return sanitizer, nil
+}
+
+// CheckUsernamePrefix reports a prefix that would not itself make a name valid
+func CheckUsernamePrefix(prefix string) error {
+	if !regexp.MustCompile(`^[a-z][a-z0-9_]*$`).MatchString(prefix) {
+		return fmt.Errorf("invalid username prefix %q: must start with a lower-case letter and contain only lower-case letters, digits and underscores", prefix)
+	}
+	if strings.HasPrefix(prefix, "pg_") {
+		return fmt.Errorf("invalid username prefix %q: role names starting with pg_ are reserved", prefix)
+	}
+	return nil
+}
+
+// Sanitize returns the role name for a login: the domain of an email login is dropped
+// unless configured otherwise, the name is lower-cased, the replacements are applied and any
+// remaining character other than a letter, digit or underscore becomes an underscore. Names
+// that do not start with a letter, start with pg_ or are reserved get the prefix, and names
+// over the length limit are shortened with a hash of the login. An empty login stays empty.
+// The login is put in NFC form first, so an accented login gives the same name whether it
+// arrives precomposed or decomposed.
+func (s *Sanitizer) Sanitize(login string) string {
+	if login == "" {
+		return ""
+	}
+
+	login = structs.NormalizeIdentifier(login)
+	name := login
+	if !s.rules.KeepDomain {
+		if idx := strings.Index(name, "@"); idx > 0 {
+			name = name[:idx]
+		}
+	}
+	name = strings.ToLower(name)
+	for i, pattern := range s.replacements {
+		name = pattern.ReplaceAllString(name, s.rules.Replacements[i].Replace)
+	}
+	name = invalidUsernameChars.ReplaceAllString(name, "_")
+
+	if name == "" || name[0] < 'a' || name[0] > 'z' || strings.HasPrefix(name, "pg_") || reservedUsernames[name] {
+		name = s.rules.Prefix + name
+	}
+
+	if len(name) > s.rules.MaxLength {
+		name = withHashSuffix(name, login, s.rules.MaxLength)
+	}
+	return name
+}
+
+// Disambiguate returns the name for a user whose sanitized name already belongs to the role
+// of another identity: the name with a hash of the user's identity provider ID appended
+func (s *Sanitizer) Disambiguate(name, externalID string) string {
+	return withHashSuffix(name, externalID, s.rules.MaxLength)
+}
+
+// withHashSuffix shortens a name so that an underscore and a hash of the key fit within
+// the maximum length, and appends them
+func withHashSuffix(name, key string, maxLength int) string {
+	sum := sha256.Sum256([]byte(key))
+	suffix := "_" + hex.EncodeToString(sum[:])[:hashSuffixLength]
+	if len(name) > maxLength-len(suffix) {
+		name = name[:maxLength-len(suffix)]
+	}
+	return name + suffix
+}
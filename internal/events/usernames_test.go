@@ -0,0 +1,119 @@
+package events
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+func TestSanitize(t *testing.T) {
+	sanitizer, err := NewSanitizer(structs.UsernameRulesConfig{})
+	if err != nil {
+		t.Fatalf("NewSanitizer failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		login    string
+		expected string
+	}{
+		{name: "valid name", login: "test_user", expected: "test_user"},
+		{name: "email drops the domain", login: "Jane.Doe@example.com", expected: "jane_doe"},
+		{name: "runs of invalid characters", login: "o'brien--smith", expected: "o_brien_smith"},
+		{name: "leading digit", login: "9f1c7e2a-55b4-4c1e-9d7a-0c1b2d3e4f5a", expected: "u_9f1c7e2a_55b4_4c1e_9d7a_0c1b2d3e4f5a"},
+		{name: "leading underscore", login: "_svc", expected: "u__svc"},
+		{name: "reserved prefix", login: "pg_monitor", expected: "u_pg_monitor"},
+		{name: "reserved name", login: "Public", expected: "u_public"},
+		{name: "non-ASCII", login: "jürgen", expected: "j_rgen"},
+		{name: "decomposed non-ASCII", login: "ju\u0308rgen", expected: "j_rgen"},
+		{name: "empty", login: "", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := sanitizer.Sanitize(tt.login); result != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestSanitizeLongNames(t *testing.T) {
+	sanitizer, err := NewSanitizer(structs.UsernameRulesConfig{})
+	if err != nil {
+		t.Fatalf("NewSanitizer failed: %v", err)
+	}
+
+	first := sanitizer.Sanitize(strings.Repeat("a", 70) + "x")
+	second := sanitizer.Sanitize(strings.Repeat("a", 70) + "y")
+	if len(first) != MaxIdentifierLength || len(second) != MaxIdentifierLength {
+		t.Errorf("Expected names of %d characters, got %d and %d", MaxIdentifierLength, len(first), len(second))
+	}
+	if first == second {
+		t.Errorf("Expected long logins sharing a prefix to get different names, both got %s", first)
+	}
+	if first != sanitizer.Sanitize(strings.Repeat("a", 70)+"x") {
+		t.Error("Expected the same login to always give the same name")
+	}
+}
+
+func TestSanitizeNormalizesUnicode(t *testing.T) {
+	sanitizer, err := NewSanitizer(structs.UsernameRulesConfig{KeepDomain: true})
+	if err != nil {
+		t.Fatalf("NewSanitizer failed: %v", err)
+	}
+
+	// Long enough to be shortened with a hash of the login
+	suffix := strings.Repeat("x", 60) + "@example.com"
+	precomposed := sanitizer.Sanitize("Jos\u00e9" + suffix)
+	decomposed := sanitizer.Sanitize("Jose\u0301" + suffix)
+	if precomposed != decomposed {
+		t.Errorf("Expected precomposed and decomposed logins to give the same name, got %s and %s", precomposed, decomposed)
+	}
+}
+
+func TestSanitizeRules(t *testing.T) {
+	sanitizer, err := NewSanitizer(structs.UsernameRulesConfig{
+		KeepDomain: true,
+		Replacements: []structs.UsernameReplacement{
+			{Pattern: `@example\.com$`, Replace: ""},
+			{Pattern: `^(.*)@(.*)$`, Replace: "${2}_$1"},
+		},
+		Prefix:    "idp_",
+		MaxLength: 20,
+	})
+	if err != nil {
+		t.Fatalf("NewSanitizer failed: %v", err)
+	}
+
+	tests := map[string]string{
+		"jane@example.com": "jane",
+		"jane@partner.org": "partner_org_jane",
+		"42@example.com":   "idp_42",
+	}
+	for login, expected := range tests {
+		if result := sanitizer.Sanitize(login); result != expected {
+			t.Errorf("%s: expected %q, got %q", login, expected, result)
+		}
+	}
+
+	long := sanitizer.Sanitize("averyveryveryverylongname")
+	if len(long) != 20 || !strings.HasPrefix(long, "averyveryve_") {
+		t.Errorf("Expected the name shortened to 20 characters with a hash, got %q", long)
+	}
+}
+
+func TestNewSanitizerRejectsInvalidRules(t *testing.T) {
+	invalid := []structs.UsernameRulesConfig{
+		{Replacements: []structs.UsernameReplacement{{Pattern: "("}}},
+		{Prefix: "1_"},
+		{Prefix: "pg_"},
+		{MaxLength: 9},
+	}
+	for _, rules := range invalid {
+		if _, err := NewSanitizer(rules); err == nil {
+			t.Errorf("Expected an error for %+v", rules)
+		}
+	}
+}
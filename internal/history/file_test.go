@@ -0,0 +1,46 @@
+package history
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewFileStore(filepath.Join(t.TempDir(), "reports", "history.jsonl"))
+
+	entries, err := store.List(ctx, time.Time{})
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("Expected an empty history before the first append, got %v, %v", entries, err)
+	}
+
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i, profile := range []string{"prod", "staging", "prod"} {
+		entry := Entry{Time: base.AddDate(0, 0, i), Profile: profile, Users: i + 1}
+		if err := store.Append(ctx, entry); err != nil {
+			t.Fatalf("Failed to append entry: %v", err)
+		}
+	}
+
+	entries, err = store.List(ctx, base.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("Failed to list entries: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Profile != "staging" || entries[1].Users != 3 {
+		t.Errorf("Expected the last two entries, got %+v", entries)
+	}
+}
+
+func TestFileStoreRejectsCorruptLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	if err := os.WriteFile(path, []byte("{\"time\":\"2024-05-01T00:00:00Z\"}\nnot json\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write history file: %v", err)
+	}
+
+	if _, err := NewFileStore(path).List(context.Background(), time.Time{}); err == nil {
+		t.Error("Expected an error for a corrupt line")
+	}
+}
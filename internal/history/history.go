@@ -0,0 +1,187 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+// Entry is the summary of one sync kept for trend reporting. It holds counts only, never
+// role names or passwords, so the history can be shared with access reviewers.
+type Entry struct {
+	Time       time.Time      `json:"time"`
+	Profile    string         `json:"profile,omitempty"`
+	Principal  string         `json:"principal,omitempty"`
+	DryRun     bool           `json:"dry_run,omitempty"`
+	Users      int            `json:"users"`             // Users the configuration declared for the cluster
+	Groups     int            `json:"groups"`            // Groups the configuration declared for the cluster
+	Changes    map[string]int `json:"changes,omitempty"` // Changes made by kind, e.g. users_created
+	Warnings   int            `json:"warnings"`
+	Errors     int            `json:"errors"`
+	RolledBack bool           `json:"rolled_back,omitempty"`
+	Duration   float64        `json:"duration_seconds"`
+}
+
+// NewEntry summarizes a sync result for the history
+func NewEntry(result *structs.SyncResult, dryRun bool, now time.Time) Entry {
+	entry := Entry{
+		Time:       now.UTC(),
+		Profile:    result.Profile,
+		Principal:  result.Principal,
+		DryRun:     dryRun,
+		Users:      result.UsersDeclared,
+		Groups:     result.GroupsDeclared,
+		Warnings:   len(result.Warnings),
+		Errors:     len(result.Errors),
+		RolledBack: result.RolledBack,
+		Duration:   result.Duration.Seconds(),
+	}
+	for _, change := range result.Changes() {
+		if change.Count > 0 {
+			if entry.Changes == nil {
+				entry.Changes = make(map[string]int)
+			}
+			entry.Changes[change.Kind] = change.Count
+		}
+	}
+	return entry
+}
+
+// Drift returns the number of changes the sync made, or would have made in a dry run, to
+// bring the cluster in line with the configuration
+func (e Entry) Drift() int {
+	drift := 0
+	for _, count := range e.Changes {
+		drift += count
+	}
+	return drift
+}
+
+// Store keeps the history of sync runs
+type Store interface {
+	// Append records an entry
+	Append(ctx context.Context, entry Entry) error
+	// List returns the entries recorded at or after since, oldest first
+	List(ctx context.Context, since time.Time) ([]Entry, error)
+}
+
+// Open opens the history at a location: an s3://bucket/prefix URL or a local file
+func Open(ctx context.Context, location string) (Store, error) {
+	if location == "" {
+		return nil, fmt.Errorf("history location is required")
+	}
+	if strings.HasPrefix(location, "s3://") {
+		return NewS3Store(ctx, location)
+	}
+	return NewFileStore(location), nil
+}
+
+// Period groups history entries for a trend report
+type Period string
+
+const (
+	// PeriodDay reports one row per calendar day (UTC)
+	PeriodDay Period = "day"
+	// PeriodWeek reports one row per ISO week
+	PeriodWeek Period = "week"
+	// PeriodMonth reports one row per calendar month
+	PeriodMonth Period = "month"
+)
+
+// ParsePeriod validates a period name
+func ParsePeriod(name string) (Period, error) {
+	switch period := Period(name); period {
+	case PeriodDay, PeriodWeek, PeriodMonth:
+		return period, nil
+	default:
+		return "", fmt.Errorf("invalid period: %s (must be 'day', 'week' or 'month')", name)
+	}
+}
+
+// start returns the start of the period a time falls in
+func (p Period) start(t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch p {
+	case PeriodWeek:
+		// ISO weeks start on Monday
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case PeriodMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return day
+	}
+}
+
+// Trend summarizes the syncs of one period
+type Trend struct {
+	Start      time.Time      `json:"start"`
+	Runs       int            `json:"runs"`
+	FailedRuns int            `json:"failed_runs"` // Runs that ended with at least one error
+	ErrorRate  float64        `json:"error_rate"`  // Share of failed runs, from 0 to 1
+	Drift      int            `json:"drift"`       // Changes the syncs made to match the configuration
+	Changes    map[string]int `json:"changes,omitempty"`
+	Users      int            `json:"users"`                // Declared users at the end of the period, summed over profiles
+	Groups     int            `json:"groups"`               // Declared groups at the end of the period, summed over profiles
+	Principals map[string]int `json:"principals,omitempty"` // Runs that changed something, by who triggered them
+}
+
+// Summarize groups entries into one trend per period, oldest first. Dry runs count as runs
+// but not as drift, since they changed nothing.
+func Summarize(entries []Entry, period Period) []Trend {
+	sorted := append([]Entry{}, entries...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Time.Before(sorted[j].Time) })
+
+	var trends []Trend
+	// Profiles that were not synced in a period still count towards its size
+	latest := make(map[string]Entry)
+	for _, entry := range sorted {
+		start := period.start(entry.Time)
+		if len(trends) == 0 || !trends[len(trends)-1].Start.Equal(start) {
+			trends = append(trends, Trend{Start: start})
+		}
+		trend := &trends[len(trends)-1]
+
+		trend.Runs++
+		if entry.Errors > 0 || entry.RolledBack {
+			trend.FailedRuns++
+		}
+		trend.ErrorRate = float64(trend.FailedRuns) / float64(trend.Runs)
+
+		// A run that failed before reading the cluster declares nothing, so it keeps the last size
+		if !entry.DryRun && (entry.Users > 0 || entry.Groups > 0) {
+			latest[entry.Profile] = entry
+		}
+		if !entry.DryRun {
+			if drift := entry.Drift(); drift > 0 {
+				trend.Drift += drift
+				if trend.Changes == nil {
+					trend.Changes = make(map[string]int)
+				}
+				for kind, count := range entry.Changes {
+					trend.Changes[kind] += count
+				}
+				if trend.Principals == nil {
+					trend.Principals = make(map[string]int)
+				}
+				principal := entry.Principal
+				if principal == "" {
+					principal = "unknown"
+				}
+				trend.Principals[principal]++
+			}
+		}
+
+		trend.Users, trend.Groups = 0, 0
+		for _, last := range latest {
+			trend.Users += last.Users
+			trend.Groups += last.Groups
+		}
+	}
+
+	return trends
+}
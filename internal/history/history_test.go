@@ -0,0 +1,89 @@
+package history
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+func TestNewEntry(t *testing.T) {
+	result := &structs.SyncResult{
+		Profile:        "prod",
+		Principal:      "alice",
+		UsersCreated:   []string{"a", "b"},
+		GroupsRemoved:  []string{"old"},
+		Errors:         []error{errors.New("boom")},
+		UsersDeclared:  10,
+		GroupsDeclared: 3,
+		Duration:       1500 * time.Millisecond,
+	}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	entry := NewEntry(result, false, now)
+	if entry.Profile != "prod" || entry.Principal != "alice" || !entry.Time.Equal(now) {
+		t.Errorf("Unexpected entry identity: %+v", entry)
+	}
+	if entry.Users != 10 || entry.Groups != 3 || entry.Errors != 1 || entry.Duration != 1.5 {
+		t.Errorf("Unexpected entry counts: %+v", entry)
+	}
+	if entry.Changes["users_created"] != 2 || entry.Changes["groups_removed"] != 1 || len(entry.Changes) != 2 {
+		t.Errorf("Expected only the kinds with changes, got %v", entry.Changes)
+	}
+	if entry.Drift() != 3 {
+		t.Errorf("Expected drift 3, got %d", entry.Drift())
+	}
+}
+
+func TestParsePeriod(t *testing.T) {
+	for _, name := range []string{"day", "week", "month"} {
+		if _, err := ParsePeriod(name); err != nil {
+			t.Errorf("Expected %s to be valid, got %v", name, err)
+		}
+	}
+	if _, err := ParsePeriod("year"); err == nil {
+		t.Error("Expected an error for an unknown period")
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	day := func(d, hour int) time.Time { return time.Date(2024, 5, d, hour, 0, 0, 0, time.UTC) }
+	entries := []Entry{
+		// Wednesday 1 May and Friday 3 May fall in the same ISO week
+		{Time: day(3, 9), Profile: "prod", Principal: "bob", Users: 12, Groups: 4, Changes: map[string]int{"users_created": 2}},
+		{Time: day(1, 9), Profile: "prod", Principal: "alice", Users: 10, Groups: 4, Changes: map[string]int{"users_created": 1}},
+		{Time: day(1, 10), Profile: "staging", Users: 5, Groups: 2},
+		{Time: day(2, 9), Profile: "prod", Errors: 1},
+		{Time: day(2, 10), Profile: "prod", DryRun: true, Users: 99, Changes: map[string]int{"users_removed": 7}},
+		// Monday 6 May starts the next week
+		{Time: day(6, 9), Profile: "staging", Principal: "alice", Users: 6, Groups: 2, Changes: map[string]int{"users_created": 1}},
+	}
+
+	trends := Summarize(entries, PeriodWeek)
+	if len(trends) != 2 {
+		t.Fatalf("Expected 2 weeks, got %d: %+v", len(trends), trends)
+	}
+
+	first := trends[0]
+	if !first.Start.Equal(time.Date(2024, 4, 29, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the week to start on Monday 29 April, got %s", first.Start)
+	}
+	if first.Runs != 5 || first.FailedRuns != 1 || first.ErrorRate != 0.2 {
+		t.Errorf("Unexpected run counts: %+v", first)
+	}
+	if first.Drift != 3 || first.Changes["users_created"] != 3 || first.Changes["users_removed"] != 0 {
+		t.Errorf("Expected drift from the applied runs only, got %d %v", first.Drift, first.Changes)
+	}
+	if first.Principals["alice"] != 1 || first.Principals["bob"] != 1 || len(first.Principals) != 2 {
+		t.Errorf("Unexpected principals: %v", first.Principals)
+	}
+	if first.Users != 17 || first.Groups != 6 {
+		t.Errorf("Expected the latest size of both profiles, got %d users and %d groups", first.Users, first.Groups)
+	}
+
+	second := trends[1]
+	if second.Runs != 1 || second.Users != 18 || second.Groups != 6 {
+		t.Errorf("Expected prod to keep counting towards the size of the second week, got %+v", second)
+	}
+}
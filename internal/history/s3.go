@@ -0,0 +1,149 @@
+package history
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// s3API is the subset of the S3 client used to store and read the history
+type s3API interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+}
+
+// S3Store keeps the history in an S3 bucket with one object per entry. S3 objects cannot
+// be appended to, so runs from different machines never overwrite each other's entries.
+// Keys start with the date, e.g. prefix/2024/05/01/20240501T120000.000000000Z-prod.json,
+// so listing a time range only reads the keys of the days in it.
+type S3Store struct {
+	bucket string
+	prefix string
+	client s3API
+}
+
+// NewS3Store creates a history store for an s3://bucket/prefix URL using the default AWS
+// credential chain
+func NewS3Store(ctx context.Context, location string) (*S3Store, error) {
+	bucket, prefix, err := parseS3Location(location)
+	if err != nil {
+		return nil, err
+	}
+
+	awsConfig, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
+
+	return &S3Store{bucket: bucket, prefix: prefix, client: s3.NewFromConfig(awsConfig)}, nil
+}
+
+// parseS3Location splits an s3://bucket/prefix URL, returning the prefix with a trailing
+// slash when it is not empty
+func parseS3Location(location string) (string, string, error) {
+	parsed, err := url.Parse(location)
+	if err != nil || parsed.Scheme != "s3" || parsed.Host == "" {
+		return "", "", fmt.Errorf("invalid S3 history location: %s (expected s3://bucket/prefix)", location)
+	}
+
+	prefix := strings.Trim(parsed.Path, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return parsed.Host, prefix, nil
+}
+
+// key returns the object key of an entry
+func (s *S3Store) key(entry Entry) string {
+	profile := entry.Profile
+	if profile == "" {
+		profile = "default"
+	}
+	t := entry.Time.UTC()
+	return fmt.Sprintf("%s%s/%s-%s.json", s.prefix, t.Format("2006/01/02"), t.Format("20060102T150405.000000000Z"), url.PathEscape(profile))
+}
+
+// Append stores an entry as a new object
+func (s *S3Store) Append(ctx context.Context, entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal history entry: %w", err)
+	}
+
+	_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(s.key(entry)),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write history entry to s3://%s/%s: %w", s.bucket, s.prefix, err)
+	}
+	return nil
+}
+
+// List reads the entries recorded at or after since
+func (s *S3Store) List(ctx context.Context, since time.Time) ([]Entry, error) {
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(s.prefix),
+	}
+	if !since.IsZero() {
+		// Keys sort by date, so the days before since are skipped without being listed
+		input.StartAfter = aws.String(s.prefix + since.UTC().Format("2006/01/02/"))
+	}
+
+	var entries []Entry
+	paginator := s3.NewListObjectsV2Paginator(s.client, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list history in s3://%s/%s: %w", s.bucket, s.prefix, err)
+		}
+
+		for _, object := range page.Contents {
+			key := aws.ToString(object.Key)
+			if !strings.HasSuffix(key, ".json") {
+				continue
+			}
+			entry, err := s.read(ctx, key)
+			if err != nil {
+				return nil, err
+			}
+			if !entry.Time.Before(since) {
+				entries = append(entries, entry)
+			}
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time.Before(entries[j].Time) })
+	return entries, nil
+}
+
+// read fetches and decodes one entry
+func (s *S3Store) read(ctx context.Context, key string) (Entry, error) {
+	output, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return Entry{}, fmt.Errorf("failed to read history entry s3://%s/%s: %w", s.bucket, key, err)
+	}
+	defer output.Body.Close()
+
+	var entry Entry
+	if err := json.NewDecoder(output.Body).Decode(&entry); err != nil {
+		return Entry{}, fmt.Errorf("failed to parse history entry s3://%s/%s: %w", s.bucket, key, err)
+	}
+	return entry, nil
+}
@@ -0,0 +1,95 @@
+package history
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+type fakeS3 struct {
+	objects map[string][]byte
+}
+
+func (f *fakeS3) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	data, _ := io.ReadAll(params.Body)
+	f.objects[aws.ToString(params.Key)] = data
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (f *fakeS3) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(f.objects[aws.ToString(params.Key)]))}, nil
+}
+
+func (f *fakeS3) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, aws.ToString(params.Prefix)) && key > aws.ToString(params.StartAfter) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	output := &s3.ListObjectsV2Output{}
+	for _, key := range keys {
+		output.Contents = append(output.Contents, s3types.Object{Key: aws.String(key)})
+	}
+	return output, nil
+}
+
+func TestParseS3Location(t *testing.T) {
+	tests := []struct {
+		location string
+		bucket   string
+		prefix   string
+		wantErr  bool
+	}{
+		{location: "s3://audit-bucket", bucket: "audit-bucket"},
+		{location: "s3://audit-bucket/postgres/history/", bucket: "audit-bucket", prefix: "postgres/history/"},
+		{location: "s3:///history", wantErr: true},
+		{location: "https://audit-bucket/history", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		bucket, prefix, err := parseS3Location(tt.location)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: expected error %v, got %v", tt.location, tt.wantErr, err)
+			continue
+		}
+		if bucket != tt.bucket || prefix != tt.prefix {
+			t.Errorf("%s: expected %q and %q, got %q and %q", tt.location, tt.bucket, tt.prefix, bucket, prefix)
+		}
+	}
+}
+
+func TestS3Store(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeS3{objects: map[string][]byte{"history/README": []byte("not an entry")}}
+	store := &S3Store{bucket: "audit-bucket", prefix: "history/", client: client}
+
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i, profile := range []string{"", "prod", "prod"} {
+		if err := store.Append(ctx, Entry{Time: base.AddDate(0, 0, i), Profile: profile, Users: i + 1}); err != nil {
+			t.Fatalf("Failed to append entry: %v", err)
+		}
+	}
+
+	if _, ok := client.objects["history/2024/05/01/20240501T120000.000000000Z-default.json"]; !ok {
+		t.Errorf("Expected the default profile entry under its date, got keys %v", client.objects)
+	}
+
+	entries, err := store.List(ctx, base.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("Failed to list entries: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Users != 2 || entries[1].Users != 3 {
+		t.Errorf("Expected the last two entries, got %+v", entries)
+	}
+}
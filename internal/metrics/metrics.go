@@ -0,0 +1,165 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+const (
+	// DefaultJob is the pushgateway job name sync metrics are pushed under
+	DefaultJob = "postgres_user_manager"
+
+	// namespace prefixes every metric name
+	namespace = "postgres_user_manager"
+
+	// pushTimeout bounds a push so an unreachable pushgateway does not stall the exit of a run
+	pushTimeout = 10 * time.Second
+
+	// contentType is the Prometheus text exposition format
+	contentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// Pusher publishes the metrics of one-shot runs to a Prometheus pushgateway, so runs from
+// cron or CI that cannot be scraped still land in monitoring
+type Pusher struct {
+	URL    string // Base URL of the pushgateway, e.g. http://pushgateway:9091
+	Job    string // Job name of the grouping key
+	Client *http.Client
+}
+
+// NewPusher creates a pusher for a pushgateway, with the default job when job is empty
+func NewPusher(gatewayURL, job string) *Pusher {
+	if job == "" {
+		job = DefaultJob
+	}
+	return &Pusher{
+		URL:    strings.TrimRight(gatewayURL, "/"),
+		Job:    job,
+		Client: &http.Client{Timeout: pushTimeout},
+	}
+}
+
+// PushSyncResult pushes the metrics of a sync, replacing the metrics of the previous run of
+// the same job and profile. The profile is part of the grouping key, so clusters synced by
+// separate runs do not overwrite each other.
+func (p *Pusher) PushSyncResult(ctx context.Context, result *structs.SyncResult, dryRun bool) error {
+	var body bytes.Buffer
+	WriteSyncMetrics(&body, result, dryRun, time.Now())
+
+	grouping := map[string]string{}
+	if result.Profile != "" {
+		grouping["profile"] = result.Profile
+	}
+	return p.push(ctx, grouping, body.Bytes())
+}
+
+// push replaces the metrics of a group with a body in the text exposition format
+func (p *Pusher) push(ctx context.Context, grouping map[string]string, body []byte) error {
+	target := p.URL + "/metrics/job/" + labelPath(p.Job)
+
+	names := make([]string, 0, len(grouping))
+	for name := range grouping {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := grouping[name]
+		if value == "" || strings.Contains(value, "/") {
+			// Values the path cannot hold are base64 encoded, as the pushgateway supports
+			target += "/" + name + "@base64/" + base64.RawURLEncoding.EncodeToString([]byte(value))
+			if value == "" {
+				target += "="
+			}
+			continue
+		}
+		target += "/" + name + "/" + labelPath(value)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, pushTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, target, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create pushgateway request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to push metrics: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("pushgateway returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// labelPath escapes a job name or label value for the pushgateway URL
+func labelPath(value string) string {
+	return url.PathEscape(value)
+}
+
+// WriteSyncMetrics writes the metrics of a sync in the Prometheus text exposition format
+func WriteSyncMetrics(w io.Writer, result *structs.SyncResult, dryRun bool, finished time.Time) {
+	success := 0
+	if len(result.Errors) == 0 {
+		success = 1
+	}
+
+	gauge(w, "sync_success", "Whether the sync finished without errors.", float64(success))
+	gauge(w, "sync_dry_run", "Whether the sync was a dry run that changed nothing.", boolValue(dryRun))
+	gauge(w, "sync_last_run_timestamp_seconds", "When the sync finished, in seconds since the epoch.", float64(finished.Unix()))
+	gauge(w, "sync_duration_seconds", "How long the sync took.", result.Duration.Seconds())
+	gauge(w, "sync_warnings", "Problems the sync worked around without failing.", float64(len(result.Warnings)))
+	gauge(w, "sync_errors", "Operations that failed during the sync.", float64(len(result.Errors)))
+
+	name := namespace + "_sync_changes"
+	fmt.Fprintf(w, "# HELP %s Changes made by the sync, by kind.\n# TYPE %s gauge\n", name, name)
+	for _, change := range result.Changes() {
+		fmt.Fprintf(w, "%s{kind=%q} %d\n", name, change.Kind, change.Count)
+	}
+
+	// Time spent per operation type, e.g. create, grant or membership
+	totals := make(map[string]time.Duration)
+	for _, timing := range result.Timings {
+		totals[timing.Operation] += timing.Duration
+	}
+	operations := make([]string, 0, len(totals))
+	for operation := range totals {
+		operations = append(operations, operation)
+	}
+	sort.Strings(operations)
+
+	name = namespace + "_sync_operation_duration_seconds"
+	fmt.Fprintf(w, "# HELP %s Time spent in sync operations, by operation type.\n# TYPE %s gauge\n", name, name)
+	for _, operation := range operations {
+		fmt.Fprintf(w, "%s{operation=%q} %g\n", name, operation, totals[operation].Seconds())
+	}
+}
+
+// gauge writes a single unlabelled gauge with its help text
+func gauge(w io.Writer, name, help string, value float64) {
+	name = namespace + "_" + name
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %g\n", name, help, name, name, value)
+}
+
+// boolValue converts a flag to a gauge value
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
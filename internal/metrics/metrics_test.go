@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+func TestWriteSyncMetrics(t *testing.T) {
+	result := &structs.SyncResult{
+		UsersCreated: []string{"app_user", "report_user"},
+		Warnings:     []structs.SyncWarning{{Role: "app_user", Message: "extra membership"}},
+		Errors:       []error{errors.New("failed to grant")},
+		Duration:     1500 * time.Millisecond,
+		Timings: []structs.OperationTiming{
+			{Entity: "user:app_user", Operation: "create", Duration: 200 * time.Millisecond},
+			{Entity: "user:report_user", Operation: "create", Duration: 300 * time.Millisecond},
+			{Entity: "user:app_user", Operation: "grant", Duration: 100 * time.Millisecond},
+		},
+	}
+
+	var buf bytes.Buffer
+	WriteSyncMetrics(&buf, result, false, time.Unix(1700000000, 0))
+	out := buf.String()
+
+	for _, want := range []string{
+		"# TYPE postgres_user_manager_sync_success gauge\npostgres_user_manager_sync_success 0\n",
+		"postgres_user_manager_sync_dry_run 0\n",
+		"postgres_user_manager_sync_last_run_timestamp_seconds 1.7e+09\n",
+		"postgres_user_manager_sync_duration_seconds 1.5\n",
+		"postgres_user_manager_sync_warnings 1\n",
+		"postgres_user_manager_sync_errors 1\n",
+		`postgres_user_manager_sync_changes{kind="users_created"} 2` + "\n",
+		`postgres_user_manager_sync_changes{kind="groups_removed"} 0` + "\n",
+		`postgres_user_manager_sync_operation_duration_seconds{operation="create"} 0.5` + "\n",
+		`postgres_user_manager_sync_operation_duration_seconds{operation="grant"} 0.1` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestPushSyncResult(t *testing.T) {
+	var method, path, contentType, body string
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path, contentType = r.Method, r.URL.EscapedPath(), r.Header.Get("Content-Type")
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer gateway.Close()
+
+	pusher := NewPusher(gateway.URL+"/", "")
+	if err := pusher.PushSyncResult(context.Background(), &structs.SyncResult{Profile: "prod"}, true); err != nil {
+		t.Fatalf("Failed to push metrics: %v", err)
+	}
+
+	if method != http.MethodPut || path != "/metrics/job/postgres_user_manager/profile/prod" {
+		t.Errorf("Unexpected request %s %s", method, path)
+	}
+	if !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("Unexpected content type %q", contentType)
+	}
+	if !strings.Contains(body, "postgres_user_manager_sync_success 1\n") || !strings.Contains(body, "postgres_user_manager_sync_dry_run 1\n") {
+		t.Errorf("Unexpected body:\n%s", body)
+	}
+
+	// Label values the path cannot hold are base64 encoded
+	if err := pusher.push(context.Background(), map[string]string{"profile": "eu/prod"}, nil); err != nil {
+		t.Fatalf("Failed to push metrics: %v", err)
+	}
+	if path != "/metrics/job/postgres_user_manager/profile@base64/ZXUvcHJvZA" {
+		t.Errorf("Unexpected path for an encoded label: %s", path)
+	}
+}
+
+func TestPushSyncResultError(t *testing.T) {
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad metric", http.StatusBadRequest)
+	}))
+	defer gateway.Close()
+
+	err := NewPusher(gateway.URL, "nightly").PushSyncResult(context.Background(), &structs.SyncResult{}, false)
+	if err == nil || !strings.Contains(err.Error(), "400") || !strings.Contains(err.Error(), "bad metric") {
+		t.Errorf("Expected the pushgateway error to be reported, got %v", err)
+	}
+}
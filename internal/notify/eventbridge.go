@@ -0,0 +1,138 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+)
+
+// eventBridgeRequestTimeout bounds each request to EventBridge
+const eventBridgeRequestTimeout = 10 * time.Second
+
+// eventBridgeEntry is an entry of a PutEvents request
+type eventBridgeEntry struct {
+	Source       string `json:"Source"`
+	DetailType   string `json:"DetailType"`
+	Detail       string `json:"Detail"`
+	EventBusName string `json:"EventBusName,omitempty"`
+}
+
+// eventBridgeResponse is the response to a PutEvents request
+type eventBridgeResponse struct {
+	FailedEntryCount int `json:"FailedEntryCount"`
+	Entries          []struct {
+		ErrorCode    string `json:"ErrorCode"`
+		ErrorMessage string `json:"ErrorMessage"`
+	} `json:"Entries"`
+}
+
+// EventBridgeNotifier puts each event on an EventBridge event bus, with the event type as
+// the detail type and the event, or the CloudEvent, as the detail. Requests go to the
+// PutEvents JSON API, signed with the default AWS credential chain.
+type EventBridgeNotifier struct {
+	endpoint    string
+	region      string
+	bus         string
+	format      string
+	source      string
+	credentials aws.CredentialsProvider
+	signer      *v4.Signer
+	client      *http.Client
+}
+
+// NewEventBridgeNotifier creates an EventBridge notifier for an event bus, the default bus
+// when empty, in the region of the default AWS configuration
+func NewEventBridgeNotifier(ctx context.Context, bus, format, source string) (*EventBridgeNotifier, error) {
+	awsConfig, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
+	if awsConfig.Region == "" {
+		return nil, fmt.Errorf("AWS region is required to send events to EventBridge: set AWS_REGION")
+	}
+
+	return &EventBridgeNotifier{
+		endpoint:    fmt.Sprintf("https://events.%s.amazonaws.com/", awsConfig.Region),
+		region:      awsConfig.Region,
+		bus:         bus,
+		format:      format,
+		source:      source,
+		credentials: awsConfig.Credentials,
+		signer:      v4.NewSigner(),
+		client:      &http.Client{Timeout: eventBridgeRequestTimeout},
+	}, nil
+}
+
+// Notify puts the event on the bus, failing when EventBridge rejects it
+func (n *EventBridgeNotifier) Notify(ctx context.Context, event Event) error {
+	detail, err := Encode(event, n.format, n.source)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string][]eventBridgeEntry{"Entries": {{
+		Source:       n.source,
+		DetailType:   event.Type,
+		Detail:       string(detail),
+		EventBusName: n.bus,
+	}}})
+	if err != nil {
+		return fmt.Errorf("failed to marshal EventBridge request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create EventBridge request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "AWSEvents.PutEvents")
+
+	credentials, err := n.credentials.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve AWS credentials: %w", err)
+	}
+	hash := sha256.Sum256(body)
+	if err := n.signer.SignHTTP(ctx, credentials, req, hex.EncodeToString(hash[:]), "events", n.region, time.Now()); err != nil {
+		return fmt.Errorf("failed to sign EventBridge request: %w", err)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send %s event to EventBridge: %w", event.Type, err)
+	}
+	defer resp.Body.Close()
+
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("EventBridge returned %s for %s event: %s", resp.Status, event.Type, strings.TrimSpace(string(message)))
+	}
+
+	// PutEvents succeeds as a whole and reports entries it rejected in the response
+	var result eventBridgeResponse
+	if err := json.Unmarshal(message, &result); err != nil {
+		return fmt.Errorf("failed to parse EventBridge response: %w", err)
+	}
+	if result.FailedEntryCount > 0 && len(result.Entries) > 0 {
+		return fmt.Errorf("EventBridge rejected %s event: %s: %s", event.Type, result.Entries[0].ErrorCode, result.Entries[0].ErrorMessage)
+	}
+	return nil
+}
+
+// Location returns the event bus events are put on
+func (n *EventBridgeNotifier) Location() string {
+	bus := n.bus
+	if bus == "" {
+		bus = "default"
+	}
+	return "eventbridge:" + bus
+}
@@ -0,0 +1,87 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+// newTestEventBridgeNotifier returns a notifier sending to a test server
+func newTestEventBridgeNotifier(endpoint, bus string) *EventBridgeNotifier {
+	return &EventBridgeNotifier{
+		endpoint:    endpoint,
+		region:      "eu-west-1",
+		bus:         bus,
+		format:      structs.NotificationFormatCloudEvents,
+		source:      DefaultSource,
+		credentials: aws.NewCredentialsCache(credentials.NewStaticCredentialsProvider("AKID", "SECRET", "")),
+		signer:      v4.NewSigner(),
+		client:      http.DefaultClient,
+	}
+}
+
+func TestEventBridgeNotifier(t *testing.T) {
+	var request struct {
+		Entries []eventBridgeEntry `json:"Entries"`
+	}
+	var target, authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target = r.Header.Get("X-Amz-Target")
+		authorization = r.Header.Get("Authorization")
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &request); err != nil {
+			t.Errorf("Failed to decode request %s: %v", body, err)
+		}
+		w.Write([]byte(`{"FailedEntryCount":0,"Entries":[{"EventId":"1"}]}`))
+	}))
+	defer server.Close()
+
+	notifier := newTestEventBridgeNotifier(server.URL, "access-events")
+	event := Event{ID: "1", Type: TypeUserDisabled, Change: Change{Role: "app_user"}}
+	if err := notifier.Notify(context.Background(), event); err != nil {
+		t.Fatalf("Failed to notify: %v", err)
+	}
+
+	if target != "AWSEvents.PutEvents" || !strings.Contains(authorization, "/eu-west-1/events/aws4_request") {
+		t.Errorf("Expected a signed PutEvents request, got target %q and authorization %q", target, authorization)
+	}
+	if len(request.Entries) != 1 {
+		t.Fatalf("Expected one entry, got %+v", request.Entries)
+	}
+	entry := request.Entries[0]
+	if entry.Source != DefaultSource || entry.DetailType != TypeUserDisabled || entry.EventBusName != "access-events" {
+		t.Errorf("Unexpected entry %+v", entry)
+	}
+	var detail CloudEvent
+	if err := json.Unmarshal([]byte(entry.Detail), &detail); err != nil || detail.SpecVersion != "1.0" || detail.Subject != "app_user" {
+		t.Errorf("Expected a CloudEvent as the detail, got %s: %v", entry.Detail, err)
+	}
+	if notifier.Location() != "eventbridge:access-events" {
+		t.Errorf("Unexpected location %q", notifier.Location())
+	}
+}
+
+func TestEventBridgeNotifierRejectedEntry(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"FailedEntryCount":1,"Entries":[{"ErrorCode":"NotAuthorizedForSourceException","ErrorMessage":"Not authorized for the source."}]}`))
+	}))
+	defer server.Close()
+
+	notifier := newTestEventBridgeNotifier(server.URL, "")
+	err := notifier.Notify(context.Background(), Event{ID: "1", Type: TypeUserCreated})
+	if err == nil || !strings.Contains(err.Error(), "NotAuthorizedForSourceException") {
+		t.Errorf("Expected the rejected entry to fail, got %v", err)
+	}
+	if notifier.Location() != "eventbridge:default" {
+		t.Errorf("Unexpected location %q", notifier.Location())
+	}
+}
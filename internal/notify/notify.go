@@ -0,0 +1,169 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/google/uuid"
+)
+
+// DefaultSource identifies this tool as the source of events when no source is configured
+const DefaultSource = "postgres-user-manager"
+
+// Types of the events sent for the changes a sync makes, named as CloudEvents types are
+const (
+	TypeUserCreated       = "io.pgusermanager.user.created"
+	TypeUserModified      = "io.pgusermanager.user.modified"
+	TypeUserRemoved       = "io.pgusermanager.user.removed"
+	TypeUserDisabled      = "io.pgusermanager.user.disabled"
+	TypeUserRenamed       = "io.pgusermanager.user.renamed"
+	TypePasswordRotated   = "io.pgusermanager.user.password_rotated"
+	TypeGroupCreated      = "io.pgusermanager.group.created"
+	TypeGroupModified     = "io.pgusermanager.group.modified"
+	TypeGroupRemoved      = "io.pgusermanager.group.removed"
+	TypeMembershipRevoked = "io.pgusermanager.membership.revoked"
+	TypeMembershipExpired = "io.pgusermanager.membership.expired"
+	TypePrivilegeRevoked  = "io.pgusermanager.privilege.revoked"
+)
+
+// Change is what a sync changed about a role. It never holds passwords.
+type Change struct {
+	Role      string     `json:"role"`
+	Profile   string     `json:"profile,omitempty"`
+	Principal string     `json:"principal,omitempty"`
+	From      string     `json:"from,omitempty"`       // Previous name of a renamed user
+	Group     string     `json:"group,omitempty"`      // Group of a revoked or expired membership
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // When an expired membership expired
+	Privilege string     `json:"privilege,omitempty"`  // Revoked database privilege
+	Database  string     `json:"database,omitempty"`   // Database of a revoked privilege
+}
+
+// Event is a change made by a sync
+type Event struct {
+	ID     string    `json:"id"`
+	Type   string    `json:"type"`
+	Time   time.Time `json:"time"`
+	Change Change    `json:"change"`
+}
+
+// CloudEvent is an event in the CloudEvents 1.0 structured content mode
+type CloudEvent struct {
+	SpecVersion     string    `json:"specversion"`
+	ID              string    `json:"id"`
+	Source          string    `json:"source"`
+	Type            string    `json:"type"`
+	Subject         string    `json:"subject"`
+	Time            time.Time `json:"time"`
+	DataContentType string    `json:"datacontenttype"`
+	Data            Change    `json:"data"`
+}
+
+// ContentType is the media type of events sent in a format
+func ContentType(format string) string {
+	if format == structs.NotificationFormatCloudEvents {
+		return "application/cloudevents+json"
+	}
+	return "application/json"
+}
+
+// Encode returns an event as sent in a format, naming the source of CloudEvents
+func Encode(event Event, format, source string) ([]byte, error) {
+	var v interface{} = event
+	if format == structs.NotificationFormatCloudEvents {
+		v = CloudEvent{
+			SpecVersion:     "1.0",
+			ID:              event.ID,
+			Source:          source,
+			Type:            event.Type,
+			Subject:         event.Change.Role,
+			Time:            event.Time,
+			DataContentType: "application/json",
+			Data:            event.Change,
+		}
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal event: %w", err)
+	}
+	return data, nil
+}
+
+// Events returns an event for every change a sync made, in the order of its result. A
+// rolled back sync kept none of its changes, so it has no events.
+func Events(result *structs.SyncResult, now time.Time) []Event {
+	if result.RolledBack {
+		return nil
+	}
+
+	var events []Event
+	add := func(eventType string, change Change) {
+		change.Profile = result.Profile
+		change.Principal = result.Principal
+		events = append(events, Event{ID: uuid.NewString(), Type: eventType, Time: now.UTC(), Change: change})
+	}
+	roles := func(eventType string, names []string) {
+		for _, name := range names {
+			add(eventType, Change{Role: name})
+		}
+	}
+
+	roles(TypeUserCreated, result.UsersCreated)
+	roles(TypeUserModified, result.UsersModified)
+	roles(TypeUserRemoved, result.UsersRemoved)
+	roles(TypeUserDisabled, result.UsersDisabled)
+	for _, rename := range result.UsersRenamed {
+		add(TypeUserRenamed, Change{Role: rename.To, From: rename.From})
+	}
+	for _, rotated := range result.RotatedPasswords {
+		add(TypePasswordRotated, Change{Role: rotated.Username})
+	}
+	roles(TypeGroupCreated, result.GroupsCreated)
+	roles(TypeGroupModified, result.GroupsModified)
+	roles(TypeGroupRemoved, result.GroupsRemoved)
+	for _, membership := range result.MembershipsRevoked {
+		add(TypeMembershipRevoked, Change{Role: membership.Member, Group: membership.Group})
+	}
+	for _, membership := range result.MembershipsExpired {
+		expiresAt := membership.ExpiresAt
+		add(TypeMembershipExpired, Change{Role: membership.Member, Group: membership.Group, ExpiresAt: &expiresAt})
+	}
+	for _, grant := range result.PrivilegesRevoked {
+		add(TypePrivilegeRevoked, Change{Role: grant.Target, Privilege: grant.Privilege, Database: grant.Database})
+	}
+	return events
+}
+
+// Notifier sends events to a target
+type Notifier interface {
+	// Notify sends one event
+	Notify(ctx context.Context, event Event) error
+	// Location describes where events are sent, for logs
+	Location() string
+}
+
+// New creates the notifier of a target
+func New(ctx context.Context, config structs.NotificationConfig) (Notifier, error) {
+	format := config.Format
+	if format == "" {
+		format = structs.NotificationFormatJSON
+	}
+	source := config.Source
+	if source == "" {
+		source = DefaultSource
+	}
+
+	switch config.Type {
+	case structs.NotificationTypeWebhook:
+		return NewWebhookNotifier(config.URL, format, source), nil
+	case structs.NotificationTypeSNS:
+		return NewSNSNotifier(ctx, config.TopicARN, format, source)
+	case structs.NotificationTypeEventBridge:
+		return NewEventBridgeNotifier(ctx, config.EventBus, format, source)
+	default:
+		return nil, fmt.Errorf("invalid notification type: %s (must be '%s', '%s' or '%s')", config.Type,
+			structs.NotificationTypeWebhook, structs.NotificationTypeSNS, structs.NotificationTypeEventBridge)
+	}
+}
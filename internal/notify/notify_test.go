@@ -0,0 +1,111 @@
+package notify
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+func TestEvents(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	result := &structs.SyncResult{
+		Profile:            "prod",
+		Principal:          "os:alice",
+		UsersCreated:       []string{"app_user"},
+		UsersRenamed:       []structs.RoleRename{{From: "old_user", To: "new_user"}},
+		RotatedPasswords:   []structs.GeneratedPassword{{Username: "svc_user", Password: "secret"}},
+		GroupsRemoved:      []string{"legacy"},
+		MembershipsRevoked: []structs.Membership{{Member: "app_user", Group: "admins"}},
+		PrivilegesRevoked:  []structs.PrivilegeGrant{{Target: "app_user", Privilege: "CREATE", Database: "app"}},
+	}
+
+	events := Events(result, now)
+	want := []struct {
+		eventType string
+		role      string
+	}{
+		{TypeUserCreated, "app_user"},
+		{TypeUserRenamed, "new_user"},
+		{TypePasswordRotated, "svc_user"},
+		{TypeGroupRemoved, "legacy"},
+		{TypeMembershipRevoked, "app_user"},
+		{TypePrivilegeRevoked, "app_user"},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("Expected %d events, got %d: %+v", len(want), len(events), events)
+	}
+
+	ids := make(map[string]bool)
+	for i, event := range events {
+		if event.Type != want[i].eventType || event.Change.Role != want[i].role {
+			t.Errorf("Event %d: expected %s for %s, got %s for %s", i, want[i].eventType, want[i].role, event.Type, event.Change.Role)
+		}
+		if event.Change.Profile != "prod" || event.Change.Principal != "os:alice" || !event.Time.Equal(now) {
+			t.Errorf("Event %d: unexpected profile, principal or time: %+v", i, event)
+		}
+		if event.ID == "" || ids[event.ID] {
+			t.Errorf("Event %d: expected a unique ID, got %q", i, event.ID)
+		}
+		ids[event.ID] = true
+	}
+	if events[1].Change.From != "old_user" {
+		t.Errorf("Expected the rename to name the previous user, got %+v", events[1].Change)
+	}
+	if events[4].Change.Group != "admins" || events[5].Change.Database != "app" || events[5].Change.Privilege != "CREATE" {
+		t.Errorf("Unexpected membership or privilege change: %+v, %+v", events[4].Change, events[5].Change)
+	}
+
+	if events := Events(&structs.SyncResult{UsersCreated: []string{"app_user"}, RolledBack: true}, now); len(events) != 0 {
+		t.Errorf("Expected no events for a rolled back sync, got %+v", events)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	event := Event{
+		ID:     "5f1c7c0e-0000-4000-8000-000000000001",
+		Type:   TypeUserCreated,
+		Time:   time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC),
+		Change: Change{Role: "app_user", Profile: "prod"},
+	}
+
+	data, err := Encode(event, structs.NotificationFormatJSON, DefaultSource)
+	if err != nil {
+		t.Fatalf("Failed to encode event: %v", err)
+	}
+	var plain Event
+	if err := json.Unmarshal(data, &plain); err != nil || plain.Type != TypeUserCreated || plain.Change.Role != "app_user" {
+		t.Errorf("Unexpected JSON event %s: %v", data, err)
+	}
+
+	data, err = Encode(event, structs.NotificationFormatCloudEvents, "urn:example:pgum")
+	if err != nil {
+		t.Fatalf("Failed to encode event: %v", err)
+	}
+	var cloudEvent map[string]interface{}
+	if err := json.Unmarshal(data, &cloudEvent); err != nil {
+		t.Fatalf("Failed to decode CloudEvent %s: %v", data, err)
+	}
+	expected := map[string]string{
+		"specversion":     "1.0",
+		"id":              event.ID,
+		"source":          "urn:example:pgum",
+		"type":            "io.pgusermanager.user.created",
+		"subject":         "app_user",
+		"time":            "2025-03-01T12:00:00Z",
+		"datacontenttype": "application/json",
+	}
+	for attribute, value := range expected {
+		if cloudEvent[attribute] != value {
+			t.Errorf("Expected CloudEvent %s %q, got %v", attribute, value, cloudEvent[attribute])
+		}
+	}
+	if data, ok := cloudEvent["data"].(map[string]interface{}); !ok || data["role"] != "app_user" || data["profile"] != "prod" {
+		t.Errorf("Unexpected CloudEvent data: %v", cloudEvent["data"])
+	}
+
+	if ContentType(structs.NotificationFormatCloudEvents) != "application/cloudevents+json" || ContentType(structs.NotificationFormatJSON) != "application/json" {
+		t.Error("Unexpected content types")
+	}
+}
@@ -0,0 +1,59 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+)
+
+// snsAPI is the subset of the SNS client used to publish events
+type snsAPI interface {
+	Publish(ctx context.Context, params *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error)
+}
+
+// SNSNotifier publishes each event as a message to an SNS topic. The event type is also set
+// as the type message attribute, so subscriptions can filter on it.
+type SNSNotifier struct {
+	topicARN string
+	format   string
+	source   string
+	client   snsAPI
+}
+
+// NewSNSNotifier creates an SNS notifier using the default AWS credential chain
+func NewSNSNotifier(ctx context.Context, topicARN, format, source string) (*SNSNotifier, error) {
+	awsConfig, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
+	return &SNSNotifier{topicARN: topicARN, format: format, source: source, client: sns.NewFromConfig(awsConfig)}, nil
+}
+
+// Notify publishes the event to the topic
+func (n *SNSNotifier) Notify(ctx context.Context, event Event) error {
+	body, err := Encode(event, n.format, n.source)
+	if err != nil {
+		return err
+	}
+
+	input := &sns.PublishInput{
+		TopicArn: aws.String(n.topicARN),
+		Message:  aws.String(string(body)),
+		MessageAttributes: map[string]snstypes.MessageAttributeValue{
+			"type": {DataType: aws.String("String"), StringValue: aws.String(event.Type)},
+		},
+	}
+	if _, err := n.client.Publish(ctx, input); err != nil {
+		return fmt.Errorf("failed to publish %s event to topic %s: %w", event.Type, n.topicARN, err)
+	}
+	return nil
+}
+
+// Location returns the ARN of the topic
+func (n *SNSNotifier) Location() string {
+	return n.topicARN
+}
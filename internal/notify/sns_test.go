@@ -0,0 +1,46 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+type fakeSNS struct {
+	published []*sns.PublishInput
+}
+
+func (f *fakeSNS) Publish(ctx context.Context, params *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error) {
+	f.published = append(f.published, params)
+	return &sns.PublishOutput{}, nil
+}
+
+func TestSNSNotifier(t *testing.T) {
+	fake := &fakeSNS{}
+	topic := "arn:aws:sns:eu-west-1:123456789012:role-changes"
+	notifier := &SNSNotifier{topicARN: topic, format: structs.NotificationFormatJSON, source: DefaultSource, client: fake}
+
+	event := Event{ID: "1", Type: TypeUserRemoved, Change: Change{Role: "app_user"}}
+	if err := notifier.Notify(context.Background(), event); err != nil {
+		t.Fatalf("Failed to notify: %v", err)
+	}
+
+	if len(fake.published) != 1 {
+		t.Fatalf("Expected one message, got %d", len(fake.published))
+	}
+	message := fake.published[0]
+	if aws.ToString(message.TopicArn) != topic {
+		t.Errorf("Expected topic %s, got %s", topic, aws.ToString(message.TopicArn))
+	}
+	var published Event
+	if err := json.Unmarshal([]byte(aws.ToString(message.Message)), &published); err != nil || published.Type != TypeUserRemoved {
+		t.Errorf("Unexpected message %q: %v", aws.ToString(message.Message), err)
+	}
+	if attribute := message.MessageAttributes["type"]; aws.ToString(attribute.StringValue) != TypeUserRemoved {
+		t.Errorf("Expected the event type as a message attribute, got %+v", message.MessageAttributes)
+	}
+}
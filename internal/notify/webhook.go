@@ -0,0 +1,64 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// webhookRequestTimeout bounds each request to a webhook
+const webhookRequestTimeout = 10 * time.Second
+
+// WebhookNotifier POSTs each event to a URL. CloudEvents are sent in structured mode, with
+// the application/cloudevents+json content type.
+type WebhookNotifier struct {
+	url    string
+	format string
+	source string
+	client *http.Client
+}
+
+// NewWebhookNotifier creates a webhook notifier
+func NewWebhookNotifier(url, format, source string) *WebhookNotifier {
+	return &WebhookNotifier{
+		url:    url,
+		format: format,
+		source: source,
+		client: &http.Client{Timeout: webhookRequestTimeout},
+	}
+}
+
+// Notify POSTs the event, failing unless the webhook answers with a 2xx status
+func (n *WebhookNotifier) Notify(ctx context.Context, event Event) error {
+	body, err := Encode(event, n.format, n.source)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", ContentType(n.format))
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send %s event to webhook: %w", event.Type, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook returned %s for %s event: %s", resp.Status, event.Type, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// Location returns the URL of the webhook
+func (n *WebhookNotifier) Location() string {
+	return n.url
+}
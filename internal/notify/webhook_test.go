@@ -0,0 +1,56 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	var contentType string
+	var received CloudEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &received); err != nil {
+			t.Errorf("Failed to decode request %s: %v", body, err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	notifier := NewWebhookNotifier(server.URL, structs.NotificationFormatCloudEvents, DefaultSource)
+	event := Event{ID: "1", Type: TypeGroupCreated, Change: Change{Role: "readers"}}
+	if err := notifier.Notify(context.Background(), event); err != nil {
+		t.Fatalf("Failed to notify: %v", err)
+	}
+
+	if contentType != "application/cloudevents+json" {
+		t.Errorf("Expected the CloudEvents content type, got %q", contentType)
+	}
+	if received.SpecVersion != "1.0" || received.Type != TypeGroupCreated || received.Subject != "readers" || received.Source != DefaultSource {
+		t.Errorf("Unexpected CloudEvent %+v", received)
+	}
+	if notifier.Location() != server.URL {
+		t.Errorf("Unexpected location %q", notifier.Location())
+	}
+}
+
+func TestWebhookNotifierError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no such hook", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	notifier := NewWebhookNotifier(server.URL, structs.NotificationFormatJSON, DefaultSource)
+	err := notifier.Notify(context.Background(), Event{ID: "1", Type: TypeUserCreated})
+	if err == nil || !strings.Contains(err.Error(), "404") || !strings.Contains(err.Error(), "no such hook") {
+		t.Errorf("Expected the status and message of the webhook, got %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+package principal
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"time"
+
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// SourceAuto resolves the AWS caller identity when AWS credentials are in use, otherwise the OS user
+	SourceAuto = "auto"
+	// SourceOS uses the operating system user running the tool
+	SourceOS = "os"
+	// SourceAWS uses the AWS caller identity returned by STS
+	SourceAWS = "aws"
+	// SourceToken uses the subject of an API token
+	SourceToken = "token"
+	// SourceExplicit uses a principal given on the command line
+	SourceExplicit = "explicit"
+
+	// stsTimeout bounds the STS lookup so an unreachable endpoint does not stall a run
+	stsTimeout = 5 * time.Second
+)
+
+// Principal identifies who initiated a change
+type Principal struct {
+	Source  string // How the principal was determined: os, aws, token or explicit
+	Subject string // User name, caller ARN or token subject
+}
+
+// String formats the principal as source:subject
+func (p Principal) String() string {
+	if p.Subject == "" {
+		return ""
+	}
+	return p.Source + ":" + p.Subject
+}
+
+// FromOS returns the operating system user running the tool
+func FromOS() Principal {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return Principal{Source: SourceOS, Subject: u.Username}
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return Principal{Source: SourceOS, Subject: name}
+	}
+	return Principal{Source: SourceOS, Subject: "unknown"}
+}
+
+// FromToken returns the principal for an API token subject
+func FromToken(subject string) Principal {
+	return Principal{Source: SourceToken, Subject: subject}
+}
+
+// FromAWS returns the AWS caller identity of the configured credentials
+func FromAWS(ctx context.Context) (Principal, error) {
+	ctx, cancel := context.WithTimeout(ctx, stsTimeout)
+	defer cancel()
+
+	cfg, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return Principal{}, fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
+
+	identity, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return Principal{}, fmt.Errorf("failed to get AWS caller identity: %w", err)
+	}
+	if identity.Arn == nil {
+		return Principal{}, fmt.Errorf("AWS caller identity has no ARN")
+	}
+
+	return Principal{Source: SourceAWS, Subject: *identity.Arn}, nil
+}
+
+// Resolve determines the principal for a run. An explicit principal always wins;
+// with the auto source the AWS caller identity is used when IAM authentication is
+// enabled or AWS credentials are configured, falling back to the OS user.
+func Resolve(ctx context.Context, source, explicit string, iamAuth bool, logger *logrus.Logger) (Principal, error) {
+	if explicit != "" {
+		return Principal{Source: SourceExplicit, Subject: explicit}, nil
+	}
+
+	switch source {
+	case SourceOS:
+		return FromOS(), nil
+	case SourceAWS:
+		return FromAWS(ctx)
+	case SourceAuto, "":
+		if !iamAuth && !hasAWSCredentials() {
+			return FromOS(), nil
+		}
+		p, err := FromAWS(ctx)
+		if err != nil {
+			logger.WithError(err).Warn("Could not determine AWS caller identity, using OS user as principal")
+			return FromOS(), nil
+		}
+		return p, nil
+	default:
+		return Principal{}, fmt.Errorf("invalid principal source %s (must be auto, os or aws)", source)
+	}
+}
+
+// hasAWSCredentials reports whether AWS credentials are configured in the environment
+func hasAWSCredentials() bool {
+	for _, name := range []string{"AWS_ACCESS_KEY_ID", "AWS_PROFILE", "AWS_WEB_IDENTITY_TOKEN_FILE", "AWS_CONTAINER_CREDENTIALS_FULL_URI", "AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"} {
+		if os.Getenv(name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Hook is a logrus hook that adds the principal to every log entry
+type Hook struct {
+	Principal Principal
+}
+
+// Levels implements logrus.Hook
+func (h *Hook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire implements logrus.Hook
+func (h *Hook) Fire(entry *logrus.Entry) error {
+	if _, exists := entry.Data["principal"]; !exists {
+		entry.Data["principal"] = h.Principal.String()
+	}
+	return nil
+}
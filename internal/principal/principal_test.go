@@ -0,0 +1,63 @@
+package principal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestPrincipalString(t *testing.T) {
+	p := Principal{Source: SourceAWS, Subject: "arn:aws:iam::123456789012:user/alice"}
+	if p.String() != "aws:arn:aws:iam::123456789012:user/alice" {
+		t.Errorf("Unexpected principal string: %s", p.String())
+	}
+
+	if (Principal{Source: SourceOS}).String() != "" {
+		t.Error("Expected empty string for principal without subject")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	p, err := Resolve(context.Background(), SourceAWS, "ci-pipeline", true, logger)
+	if err != nil {
+		t.Fatalf("Failed to resolve explicit principal: %v", err)
+	}
+	if p.Source != SourceExplicit || p.Subject != "ci-pipeline" {
+		t.Errorf("Expected explicit principal to win, got %+v", p)
+	}
+
+	p, err = Resolve(context.Background(), SourceOS, "", false, logger)
+	if err != nil {
+		t.Fatalf("Failed to resolve OS principal: %v", err)
+	}
+	if p.Source != SourceOS || p.Subject == "" {
+		t.Errorf("Expected OS principal, got %+v", p)
+	}
+
+	if _, err := Resolve(context.Background(), "kerberos", "", false, logger); err == nil {
+		t.Error("Expected error for invalid principal source")
+	}
+}
+
+func TestHook(t *testing.T) {
+	hook := &Hook{Principal: FromToken("svc-provisioner")}
+
+	entry := &logrus.Entry{Data: logrus.Fields{}}
+	if err := hook.Fire(entry); err != nil {
+		t.Fatalf("Hook failed: %v", err)
+	}
+	if entry.Data["principal"] != "token:svc-provisioner" {
+		t.Errorf("Expected principal field, got %v", entry.Data["principal"])
+	}
+
+	// An explicit principal field is not overwritten
+	entry = &logrus.Entry{Data: logrus.Fields{"principal": "os:alice"}}
+	hook.Fire(entry)
+	if entry.Data["principal"] != "os:alice" {
+		t.Errorf("Expected existing principal field to be kept, got %v", entry.Data["principal"])
+	}
+}
@@ -0,0 +1,97 @@
+package review
+
+import (
+	"html/template"
+	"io"
+	"strings"
+	"time"
+)
+
+// htmlTemplate lays a report out as a self-contained page that prints cleanly
+var htmlTemplate = template.Must(template.New("review").Funcs(template.FuncMap{
+	"date": func(t *time.Time) string {
+		if t == nil {
+			return "-"
+		}
+		return t.UTC().Format("2006-01-02")
+	},
+	"list": func(values []string) string {
+		if len(values) == 0 {
+			return "-"
+		}
+		return strings.Join(values, ", ")
+	},
+	"yesno": func(value bool) string {
+		if value {
+			return "yes"
+		}
+		return "no"
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Access review: {{.Report.Host}}/{{.Report.Database}}</title>
+<style>
+body { font-family: sans-serif; font-size: 13px; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #f0f0f0; }
+.flag { color: #b00; font-weight: bold; }
+@media print { body { margin: 0; } tr { page-break-inside: avoid; } }
+</style>
+</head>
+<body>
+<h1>Access review</h1>
+<table>
+<tr><th>Cluster</th><td>{{.Report.Host}}/{{.Report.Database}}{{with .Report.Profile}} (profile {{.}}){{end}}</td></tr>
+<tr><th>Generated</th><td>{{.Report.GeneratedAt.UTC.Format "2006-01-02 15:04:05 MST"}}{{with .Report.GeneratedBy}} by {{.}}{{end}}</td></tr>
+<tr><th>Scope</th><td>{{if .Report.Unmanaged}}All roles except the built-in pg_ roles{{else}}Roles managed by postgres-user-manager{{end}}</td></tr>
+</table>
+
+<h2>Summary</h2>
+<table>
+<tr><th>Roles</th><td>{{.Summary.Roles}}</td></tr>
+<tr><th>Users</th><td>{{.Summary.Users}}</td></tr>
+<tr><th>Groups</th><td>{{.Summary.Groups}}</td></tr>
+{{if .Report.Unmanaged}}<tr><th>Unmanaged roles</th><td>{{.Summary.Unmanaged}}</td></tr>
+{{end}}<tr><th>Roles that can log in</th><td>{{.Summary.LoginRoles}}</td></tr>
+<tr><th>Roles without an owner or team</th><td{{if .Summary.Unowned}} class="flag"{{end}}>{{.Summary.Unowned}}</td></tr>
+<tr><th>Superusers</th><td{{if .Summary.Superusers}} class="flag"{{end}}>{{.Summary.Superusers}}</td></tr>
+<tr><th>Password users without a recorded rotation</th><td>{{.Summary.NeverRotated}}</td></tr>
+<tr><th>Passwords not rotated in {{.RotationDays}} days</th><td{{if .Summary.RotationOlderThan}} class="flag"{{end}}>{{.Summary.RotationOlderThan}}</td></tr>
+</table>
+
+<h2>Roles</h2>
+<table>
+<tr><th>Role</th><th>Kind</th><th>Description</th><th>Owner</th><th>Ticket</th><th>Login</th><th>Attributes</th><th>Auth</th><th>Member of</th><th>Members</th><th>Database grants</th><th>Created</th><th>Last modified</th><th>Password changed</th><th>Password expires</th></tr>
+{{range .Report.Roles}}<tr>
+<td>{{.Name}}</td>
+<td>{{.Kind}}</td>
+<td>{{.Description}}</td>
+<td>{{if or .Owner .Team}}{{.Owner}}{{if and .Owner .Team}}, {{end}}{{.Team}}{{else}}<span class="flag">none</span>{{end}}</td>
+<td>{{or .Ticket "-"}}</td>
+<td>{{yesno .CanLogin}}</td>
+<td>{{if .Superuser}}<span class="flag">SUPERUSER</span> {{end}}{{if .CreateRole}}CREATEROLE {{end}}{{if .CreateDB}}CREATEDB {{end}}{{if .DeletionProtection}}protected {{end}}{{if ge .ConnectionLimit 0}}limit {{.ConnectionLimit}}{{end}}</td>
+<td>{{or .Auth "-"}}</td>
+<td>{{list .MemberOf}}</td>
+<td>{{list .Members}}</td>
+<td>{{if or .Grants .OwnedDatabases}}{{range .Grants}}{{.Privilege}} on {{.Database}}<br>{{end}}{{range .OwnedDatabases}}owner of {{.}}<br>{{end}}{{else}}-{{end}}</td>
+<td>{{date .CreatedAt}}{{with .CreatedBy}} by {{.}}{{end}}</td>
+<td>{{date .ModifiedAt}}{{with .ModifiedBy}} by {{.}}{{end}}</td>
+<td>{{date .PasswordChangedAt}}</td>
+<td>{{date .ValidUntil}}</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// WriteHTML writes a report as a self-contained HTML page for reading and printing
+func WriteHTML(w io.Writer, report *Report) error {
+	return htmlTemplate.Execute(w, struct {
+		Report       *Report
+		Summary      Summary
+		RotationDays int
+	}{report, report.Summarize(), int(RotationAge.Hours() / 24)})
+}
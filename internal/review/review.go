@@ -0,0 +1,217 @@
+// Package review writes access review bundles: the managed roles of a cluster with their
+// memberships, grants and history, as CSV for spreadsheets, JSON for tooling and HTML for
+// reading, ready to hand to auditors.
+package review
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+// Report is an access review of one cluster
+type Report struct {
+	GeneratedAt time.Time            `json:"generated_at"`
+	GeneratedBy string               `json:"generated_by,omitempty"` // Principal that exported the review
+	Profile     string               `json:"profile,omitempty"`
+	Host        string               `json:"host"`
+	Database    string               `json:"database"`
+	Unmanaged   bool                 `json:"includes_unmanaged"` // Whether roles not managed by this tool are listed
+	Roles       []structs.ReviewRole `json:"roles"`
+}
+
+// Summary counts the roles of a report that reviewers look at first
+type Summary struct {
+	Roles             int
+	Users             int
+	Groups            int
+	Unmanaged         int
+	LoginRoles        int
+	Superusers        int
+	Unowned           int // Roles without an owner or team
+	NeverRotated      int // Password users without a recorded password change
+	RotationOlderThan int // Password changes older than the rotation age
+}
+
+// RotationAge is the password age the summary flags as overdue for rotation
+const RotationAge = 90 * 24 * time.Hour
+
+// Summarize counts the roles of the report
+func (r *Report) Summarize() Summary {
+	summary := Summary{Roles: len(r.Roles)}
+	for _, role := range r.Roles {
+		switch role.Kind {
+		case "user":
+			summary.Users++
+		case "group":
+			summary.Groups++
+		default:
+			summary.Unmanaged++
+		}
+		if role.CanLogin {
+			summary.LoginRoles++
+		}
+		if role.Superuser {
+			summary.Superusers++
+		}
+		if role.Owner == "" && role.Team == "" {
+			summary.Unowned++
+		}
+		if usesPassword(role) {
+			if role.PasswordChangedAt == nil {
+				summary.NeverRotated++
+			} else if r.GeneratedAt.Sub(*role.PasswordChangedAt) > RotationAge {
+				summary.RotationOlderThan++
+			}
+		}
+	}
+	return summary
+}
+
+// usesPassword reports whether a login role was created with password authentication
+func usesPassword(role structs.ReviewRole) bool {
+	if !role.CanLogin {
+		return false
+	}
+	for _, method := range strings.Split(role.Auth, ",") {
+		if method == structs.AuthMethodPassword {
+			return true
+		}
+	}
+	return false
+}
+
+// Files written by Export, in the order they are written
+const (
+	CSVFile  = "access-review.csv"
+	JSONFile = "access-review.json"
+	HTMLFile = "access-review.html"
+)
+
+// Export writes the CSV, JSON and HTML forms of a report to a directory, creating it when
+// needed, and returns the paths written
+func Export(dir string, report *Report) ([]string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create review directory: %w", err)
+	}
+
+	writers := []struct {
+		name  string
+		write func(io.Writer, *Report) error
+	}{
+		{CSVFile, WriteCSV},
+		{JSONFile, WriteJSON},
+		{HTMLFile, WriteHTML},
+	}
+
+	var paths []string
+	for _, writer := range writers {
+		path := filepath.Join(dir, writer.name)
+		if err := writeFile(path, report, writer.write); err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// writeFile writes one form of a report to a file
+func writeFile(path string, report *Report, write func(io.Writer, *Report) error) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer file.Close()
+
+	if err := write(file, report); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return file.Close()
+}
+
+// WriteJSON writes a report as indented JSON
+func WriteJSON(w io.Writer, report *Report) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// csvHeader names the columns of the CSV form, one row per role
+var csvHeader = []string{
+	"role", "kind", "description", "owner", "team", "ticket", "created_by", "can_login", "superuser", "create_role", "create_db",
+	"connection_limit", "auth", "deletion_protection", "member_of", "members", "grants",
+	"owned_databases", "created_at", "modified_by", "modified_at", "password_changed_at", "valid_until",
+}
+
+// WriteCSV writes one row per role. Lists are separated with semicolons, and times are
+// RFC 3339 in UTC.
+func WriteCSV(w io.Writer, report *Report) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, role := range report.Roles {
+		grants := make([]string, len(role.Grants))
+		for i, grant := range role.Grants {
+			grants[i] = grant.Privilege + " ON " + grant.Database
+		}
+
+		record := []string{
+			escapeFormula(role.Name),
+			role.Kind,
+			escapeFormula(role.Description),
+			escapeFormula(role.Owner),
+			escapeFormula(role.Team),
+			escapeFormula(role.Ticket),
+			escapeFormula(role.CreatedBy),
+			strconv.FormatBool(role.CanLogin),
+			strconv.FormatBool(role.Superuser),
+			strconv.FormatBool(role.CreateRole),
+			strconv.FormatBool(role.CreateDB),
+			strconv.Itoa(role.ConnectionLimit),
+			role.Auth,
+			strconv.FormatBool(role.DeletionProtection),
+			strings.Join(role.MemberOf, ";"),
+			strings.Join(role.Members, ";"),
+			strings.Join(grants, ";"),
+			strings.Join(role.OwnedDatabases, ";"),
+			formatTime(role.CreatedAt),
+			escapeFormula(role.ModifiedBy),
+			formatTime(role.ModifiedAt),
+			formatTime(role.PasswordChangedAt),
+			formatTime(role.ValidUntil),
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// escapeFormula keeps spreadsheets from evaluating free-text values, such as role
+// descriptions, that start like a formula
+func escapeFormula(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// formatTime formats an optional time as RFC 3339 in UTC, or an empty string when it is unset
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,147 @@
+package review
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+func testReport() *Report {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	recent := now.AddDate(0, 0, -10)
+	stale := now.AddDate(0, -6, 0)
+	return &Report{
+		GeneratedAt: now,
+		GeneratedBy: "os:alice",
+		Host:        "db.example.com",
+		Database:    "app",
+		Roles: []structs.ReviewRole{
+			{
+				Name:              "app_group",
+				Kind:              "group",
+				Description:       "=HYPERLINK(\"http://evil\")",
+				ConnectionLimit:   -1,
+				Members:           []string{"jane", "svc"},
+				Grants:            []structs.PrivilegeGrant{{Target: "app_group", Privilege: "CONNECT", Database: "app"}},
+				MemberOf:          []string{},
+				OwnedDatabases:    []string{},
+				PasswordChangedAt: nil,
+			},
+			{
+				Name:              "jane",
+				Kind:              "user",
+				Owner:             "jane.doe@example.com",
+				Team:              "payments",
+				Ticket:            "SEC-42",
+				CreatedBy:         "os:alice",
+				CanLogin:          true,
+				ConnectionLimit:   5,
+				Auth:              "password",
+				MemberOf:          []string{"app_group"},
+				CreatedAt:         &stale,
+				PasswordChangedAt: &stale,
+			},
+			{
+				Name:              "svc",
+				Kind:              "user",
+				CanLogin:          true,
+				ConnectionLimit:   -1,
+				Auth:              "iam,password",
+				MemberOf:          []string{"app_group"},
+				PasswordChangedAt: &recent,
+			},
+			{
+				Name:      "legacy",
+				Kind:      "unmanaged",
+				CanLogin:  true,
+				Superuser: true,
+				Auth:      "password",
+			},
+		},
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	summary := testReport().Summarize()
+
+	expected := Summary{Roles: 4, Users: 2, Groups: 1, Unmanaged: 1, LoginRoles: 3, Superusers: 1, Unowned: 3, NeverRotated: 1, RotationOlderThan: 1}
+	if summary != expected {
+		t.Errorf("Expected %+v, got %+v", expected, summary)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, testReport()); err != nil {
+		t.Fatalf("Failed to write CSV: %v", err)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to read CSV: %v", err)
+	}
+	if len(records) != 5 || strings.Join(records[0], ",") != strings.Join(csvHeader, ",") {
+		t.Fatalf("Expected a header and 4 rows, got %v", records)
+	}
+
+	group := records[1]
+	if group[2] != "'=HYPERLINK(\"http://evil\")" {
+		t.Errorf("Expected the formula-like description to be escaped, got %q", group[2])
+	}
+	if group[11] != "-1" {
+		t.Errorf("Expected an unlimited connection limit to stay -1, got %q", group[11])
+	}
+	if group[15] != "jane;svc" || group[16] != "CONNECT ON app" {
+		t.Errorf("Expected members and grants joined with semicolons, got %q and %q", group[15], group[16])
+	}
+	jane := records[2]
+	if jane[3] != "jane.doe@example.com" || jane[4] != "payments" || jane[5] != "SEC-42" || jane[6] != "os:alice" {
+		t.Errorf("Expected the ownership and creator of jane, got %q", jane[3:7])
+	}
+	if jane[21] != "2023-12-01T12:00:00Z" {
+		t.Errorf("Expected the password change time in RFC 3339, got %q", jane[21])
+	}
+}
+
+func TestExport(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "review")
+	paths, err := Export(dir, testReport())
+	if err != nil {
+		t.Fatalf("Failed to export review: %v", err)
+	}
+	if len(paths) != 3 {
+		t.Fatalf("Expected 3 files, got %v", paths)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, JSONFile))
+	if err != nil {
+		t.Fatalf("Failed to read JSON: %v", err)
+	}
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil || len(report.Roles) != 4 || report.GeneratedBy != "os:alice" {
+		t.Errorf("Expected the JSON to hold the report, got %+v, %v", report, err)
+	}
+
+	data, err = os.ReadFile(filepath.Join(dir, HTMLFile))
+	if err != nil {
+		t.Fatalf("Failed to read HTML: %v", err)
+	}
+	page := string(data)
+	for _, expected := range []string{
+		"db.example.com/app",
+		"CONNECT on app",
+		"<span class=\"flag\">SUPERUSER</span>",
+		"=HYPERLINK(&#34;http://evil&#34;)",
+	} {
+		if !strings.Contains(page, expected) {
+			t.Errorf("Expected %q in the HTML page", expected)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package rotation
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+// DefaultPrefix is prepended to usernames to name their secrets when no prefix is configured.
+// SSM parameter names in a hierarchy must start with a slash, so SSM gets one in front.
+const DefaultPrefix = "postgres-user-manager/"
+
+// Secret is a rotated password with what is needed to connect with it. It is published in
+// the same JSON shape as the secrets Secrets Manager keeps for RDS databases.
+type Secret struct {
+	Username  string    `json:"username"`
+	Password  string    `json:"password"`
+	Engine    string    `json:"engine"`
+	Host      string    `json:"host,omitempty"`
+	Port      int       `json:"port,omitempty"`
+	DBName    string    `json:"dbname,omitempty"`
+	RotatedAt time.Time `json:"rotated_at"`
+	Profile   string    `json:"-"` // Cluster (sync profile) the user belongs to, part of the secret name
+}
+
+// NewSecret returns the secret of a rotated password for a user of the database connection
+func NewSecret(username, password string, conn *structs.DatabaseConnection, profile string, now time.Time) Secret {
+	secret := Secret{
+		Username:  username,
+		Password:  password,
+		Engine:    "postgres",
+		RotatedAt: now.UTC(),
+		Profile:   profile,
+	}
+	if conn != nil {
+		secret.Host = conn.Host
+		secret.Port = conn.Port
+		secret.DBName = conn.Database
+	}
+	return secret
+}
+
+// Publisher stores rotated passwords where the users of the roles pick them up
+type Publisher interface {
+	// Publish stores the secret, replacing the previous password of the user
+	Publish(ctx context.Context, secret Secret) error
+	// Location describes where the secret of a user is published, for logs and reports
+	Location(secret Secret) string
+}
+
+// NewPublisher creates the publisher of a rotation configuration, writing to out with the
+// stdout backend. A nil configuration publishes to stdout.
+func NewPublisher(ctx context.Context, config *structs.RotationConfig, out io.Writer) (Publisher, error) {
+	if config == nil {
+		config = &structs.RotationConfig{}
+	}
+
+	switch config.Backend {
+	case "", structs.RotationBackendStdout:
+		return NewStdoutPublisher(out), nil
+	case structs.RotationBackendSecretsManager:
+		return NewSecretsManagerPublisher(ctx, prefix(config.Prefix, ""), config.KMSKeyID)
+	case structs.RotationBackendSSM:
+		return NewSSMPublisher(ctx, prefix(config.Prefix, "/"), config.KMSKeyID)
+	case structs.RotationBackendVault:
+		return NewVaultPublisher(config.VaultAddr, config.VaultMount, prefix(config.Prefix, ""))
+	default:
+		return nil, fmt.Errorf("invalid rotation backend: %s (must be '%s', '%s', '%s' or '%s')", config.Backend,
+			structs.RotationBackendStdout, structs.RotationBackendSecretsManager, structs.RotationBackendSSM, structs.RotationBackendVault)
+	}
+}
+
+// prefix returns the configured prefix, or the default one with lead in front of it
+func prefix(configured, lead string) string {
+	if configured != "" {
+		return configured
+	}
+	return lead + DefaultPrefix
+}
+
+// secretName names the secret of a user: the prefix, the profile when there is one, so the
+// same user on several clusters gets one secret each, and the username
+func secretName(prefix string, secret Secret) string {
+	name := prefix
+	if secret.Profile != "" {
+		name += secret.Profile + "/"
+	}
+	return name + secret.Username
+}
+
+// StdoutPublisher prints rotated passwords, for running by hand or piping into another tool
+type StdoutPublisher struct {
+	out     io.Writer
+	printed bool // Whether the heading was printed
+}
+
+// NewStdoutPublisher creates a publisher printing to out
+func NewStdoutPublisher(out io.Writer) *StdoutPublisher {
+	return &StdoutPublisher{out: out}
+}
+
+// Publish prints the username and new password, under a heading printed before the first
+func (p *StdoutPublisher) Publish(ctx context.Context, secret Secret) error {
+	if !p.printed {
+		fmt.Fprintln(p.out, "Rotated passwords (shown once, store them now):")
+		p.printed = true
+	}
+	user := secret.Username
+	if secret.Profile != "" {
+		user = secret.Profile + "/" + user
+	}
+	if _, err := fmt.Fprintf(p.out, "  %s: %s\n", user, secret.Password); err != nil {
+		return fmt.Errorf("failed to print password of user %s: %w", secret.Username, err)
+	}
+	return nil
+}
+
+// Location describes stdout as the location
+func (p *StdoutPublisher) Location(secret Secret) string {
+	return "stdout"
+}
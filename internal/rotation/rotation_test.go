@@ -0,0 +1,76 @@
+package rotation
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+func TestNewSecret(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	conn := &structs.DatabaseConnection{Host: "db.example.com", Port: 5432, Database: "app", Password: "admin-secret"}
+
+	secret := NewSecret("app_user", "new-password", conn, "prod", now)
+	if secret.Host != "db.example.com" || secret.Port != 5432 || secret.DBName != "app" {
+		t.Errorf("Expected the connection details in the secret, got %+v", secret)
+	}
+	if secret.Engine != "postgres" || !secret.RotatedAt.Equal(now) || secret.RotatedAt.Location() != time.UTC {
+		t.Errorf("Expected a postgres secret rotated at %s in UTC, got %+v", now, secret)
+	}
+}
+
+func TestSecretName(t *testing.T) {
+	tests := []struct {
+		prefix  string
+		profile string
+		want    string
+	}{
+		{prefix: DefaultPrefix, want: "postgres-user-manager/app_user"},
+		{prefix: "/" + DefaultPrefix, profile: "prod", want: "/postgres-user-manager/prod/app_user"},
+		{prefix: "db-", want: "db-app_user"},
+	}
+
+	for _, tt := range tests {
+		got := secretName(tt.prefix, Secret{Username: "app_user", Profile: tt.profile})
+		if got != tt.want {
+			t.Errorf("secretName(%q, %q) = %q, want %q", tt.prefix, tt.profile, got, tt.want)
+		}
+	}
+}
+
+func TestNewPublisher(t *testing.T) {
+	var out bytes.Buffer
+
+	publisher, err := NewPublisher(context.Background(), nil, &out)
+	if err != nil {
+		t.Fatalf("Expected a stdout publisher without configuration, got error: %v", err)
+	}
+	if _, ok := publisher.(*StdoutPublisher); !ok {
+		t.Errorf("Expected a stdout publisher without configuration, got %T", publisher)
+	}
+
+	if _, err := NewPublisher(context.Background(), &structs.RotationConfig{Backend: "keychain"}, &out); err == nil {
+		t.Error("Expected an unknown backend to be rejected")
+	}
+}
+
+func TestStdoutPublisher(t *testing.T) {
+	var out bytes.Buffer
+	publisher := NewStdoutPublisher(&out)
+
+	for _, secret := range []Secret{
+		{Username: "app_user", Password: "new-password", Profile: "prod"},
+		{Username: "report_user", Password: "other-password"},
+	} {
+		if err := publisher.Publish(context.Background(), secret); err != nil {
+			t.Fatalf("Failed to publish: %v", err)
+		}
+	}
+	want := "Rotated passwords (shown once, store them now):\n  prod/app_user: new-password\n  report_user: other-password\n"
+	if got := out.String(); got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
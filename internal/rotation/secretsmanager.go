@@ -0,0 +1,73 @@
+package rotation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	smtypes "github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+)
+
+// secretsManagerAPI is the subset of the Secrets Manager client used to publish passwords
+type secretsManagerAPI interface {
+	PutSecretValue(ctx context.Context, params *secretsmanager.PutSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.PutSecretValueOutput, error)
+	CreateSecret(ctx context.Context, params *secretsmanager.CreateSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.CreateSecretOutput, error)
+}
+
+// SecretsManagerPublisher stores rotated passwords as AWS Secrets Manager secrets named after
+// the user. Each rotation adds a new version, so the previous password stays available as
+// AWSPREVIOUS until the next one.
+type SecretsManagerPublisher struct {
+	prefix   string
+	kmsKeyID string
+	client   secretsManagerAPI
+}
+
+// NewSecretsManagerPublisher creates a Secrets Manager publisher using the default AWS
+// credential chain
+func NewSecretsManagerPublisher(ctx context.Context, prefix, kmsKeyID string) (*SecretsManagerPublisher, error) {
+	awsConfig, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
+	return &SecretsManagerPublisher{prefix: prefix, kmsKeyID: kmsKeyID, client: secretsmanager.NewFromConfig(awsConfig)}, nil
+}
+
+// Publish puts the secret as the current version, creating the secret on the first rotation
+func (p *SecretsManagerPublisher) Publish(ctx context.Context, secret Secret) error {
+	data, err := json.Marshal(secret)
+	if err != nil {
+		return fmt.Errorf("failed to marshal secret: %w", err)
+	}
+	name := secretName(p.prefix, secret)
+
+	_, err = p.client.PutSecretValue(ctx, &secretsmanager.PutSecretValueInput{
+		SecretId:     aws.String(name),
+		SecretString: aws.String(string(data)),
+	})
+	var notFound *smtypes.ResourceNotFoundException
+	if errors.As(err, &notFound) {
+		input := &secretsmanager.CreateSecretInput{
+			Name:         aws.String(name),
+			Description:  aws.String(fmt.Sprintf("Password of PostgreSQL user %s, rotated by postgres-user-manager", secret.Username)),
+			SecretString: aws.String(string(data)),
+		}
+		if p.kmsKeyID != "" {
+			input.KmsKeyId = aws.String(p.kmsKeyID)
+		}
+		_, err = p.client.CreateSecret(ctx, input)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to publish password of user %s to secret %s: %w", secret.Username, name, err)
+	}
+	return nil
+}
+
+// Location returns the name of the user's secret
+func (p *SecretsManagerPublisher) Location(secret Secret) string {
+	return "secretsmanager:" + secretName(p.prefix, secret)
+}
@@ -0,0 +1,60 @@
+package rotation
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	smtypes "github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+)
+
+type fakeSecretsManager struct {
+	secrets map[string]string
+	kmsKeys map[string]string
+}
+
+func (f *fakeSecretsManager) PutSecretValue(ctx context.Context, params *secretsmanager.PutSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.PutSecretValueOutput, error) {
+	name := aws.ToString(params.SecretId)
+	if _, ok := f.secrets[name]; !ok {
+		return nil, &smtypes.ResourceNotFoundException{Message: aws.String("Secrets Manager can't find the specified secret.")}
+	}
+	f.secrets[name] = aws.ToString(params.SecretString)
+	return &secretsmanager.PutSecretValueOutput{}, nil
+}
+
+func (f *fakeSecretsManager) CreateSecret(ctx context.Context, params *secretsmanager.CreateSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.CreateSecretOutput, error) {
+	name := aws.ToString(params.Name)
+	f.secrets[name] = aws.ToString(params.SecretString)
+	f.kmsKeys[name] = aws.ToString(params.KmsKeyId)
+	return &secretsmanager.CreateSecretOutput{}, nil
+}
+
+func TestSecretsManagerPublisher(t *testing.T) {
+	fake := &fakeSecretsManager{secrets: map[string]string{}, kmsKeys: map[string]string{}}
+	publisher := &SecretsManagerPublisher{prefix: DefaultPrefix, kmsKeyID: "alias/postgres", client: fake}
+	ctx := context.Background()
+
+	// The first rotation creates the secret, later ones add versions to it
+	for _, password := range []string{"first-password", "second-password"} {
+		if err := publisher.Publish(ctx, Secret{Username: "app_user", Password: password, Engine: "postgres"}); err != nil {
+			t.Fatalf("Failed to publish: %v", err)
+		}
+	}
+
+	name := "postgres-user-manager/app_user"
+	var stored Secret
+	if err := json.Unmarshal([]byte(fake.secrets[name]), &stored); err != nil {
+		t.Fatalf("Expected secret %s to hold JSON, got %q: %v", name, fake.secrets[name], err)
+	}
+	if stored.Username != "app_user" || stored.Password != "second-password" {
+		t.Errorf("Expected the latest password in secret %s, got %+v", name, stored)
+	}
+	if fake.kmsKeys[name] != "alias/postgres" {
+		t.Errorf("Expected the secret to be created with the configured KMS key, got %q", fake.kmsKeys[name])
+	}
+	if got := publisher.Location(Secret{Username: "app_user"}); got != "secretsmanager:"+name {
+		t.Errorf("Unexpected location %q", got)
+	}
+}
@@ -0,0 +1,62 @@
+package rotation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// ssmAPI is the subset of the SSM client used to publish passwords
+type ssmAPI interface {
+	PutParameter(ctx context.Context, params *ssm.PutParameterInput, optFns ...func(*ssm.Options)) (*ssm.PutParameterOutput, error)
+}
+
+// SSMPublisher stores rotated passwords as SecureString parameters of AWS Systems Manager
+// Parameter Store named after the user
+type SSMPublisher struct {
+	prefix   string
+	kmsKeyID string
+	client   ssmAPI
+}
+
+// NewSSMPublisher creates a Parameter Store publisher using the default AWS credential chain
+func NewSSMPublisher(ctx context.Context, prefix, kmsKeyID string) (*SSMPublisher, error) {
+	awsConfig, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
+	return &SSMPublisher{prefix: prefix, kmsKeyID: kmsKeyID, client: ssm.NewFromConfig(awsConfig)}, nil
+}
+
+// Publish overwrites the user's parameter with the secret, creating it on the first rotation
+func (p *SSMPublisher) Publish(ctx context.Context, secret Secret) error {
+	data, err := json.Marshal(secret)
+	if err != nil {
+		return fmt.Errorf("failed to marshal secret: %w", err)
+	}
+	name := secretName(p.prefix, secret)
+
+	input := &ssm.PutParameterInput{
+		Name:      aws.String(name),
+		Value:     aws.String(string(data)),
+		Type:      ssmtypes.ParameterTypeSecureString,
+		Overwrite: aws.Bool(true),
+	}
+	if p.kmsKeyID != "" {
+		input.KeyId = aws.String(p.kmsKeyID)
+	}
+	if _, err := p.client.PutParameter(ctx, input); err != nil {
+		return fmt.Errorf("failed to publish password of user %s to parameter %s: %w", secret.Username, name, err)
+	}
+	return nil
+}
+
+// Location returns the name of the user's parameter
+func (p *SSMPublisher) Location(secret Secret) string {
+	return "ssm:" + secretName(p.prefix, secret)
+}
@@ -0,0 +1,42 @@
+package rotation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+type fakeSSM struct {
+	inputs []*ssm.PutParameterInput
+}
+
+func (f *fakeSSM) PutParameter(ctx context.Context, params *ssm.PutParameterInput, optFns ...func(*ssm.Options)) (*ssm.PutParameterOutput, error) {
+	f.inputs = append(f.inputs, params)
+	return &ssm.PutParameterOutput{}, nil
+}
+
+func TestSSMPublisher(t *testing.T) {
+	fake := &fakeSSM{}
+	publisher := &SSMPublisher{prefix: "/" + DefaultPrefix, client: fake}
+
+	if err := publisher.Publish(context.Background(), Secret{Username: "app_user", Password: "new-password", Profile: "prod"}); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+
+	if len(fake.inputs) != 1 {
+		t.Fatalf("Expected one parameter to be put, got %d", len(fake.inputs))
+	}
+	input := fake.inputs[0]
+	if got := aws.ToString(input.Name); got != "/postgres-user-manager/prod/app_user" {
+		t.Errorf("Unexpected parameter name %q", got)
+	}
+	if input.Type != ssmtypes.ParameterTypeSecureString || !aws.ToBool(input.Overwrite) {
+		t.Errorf("Expected an overwritten SecureString parameter, got type %s overwrite %v", input.Type, aws.ToBool(input.Overwrite))
+	}
+	if input.KeyId != nil {
+		t.Errorf("Expected the AWS managed key without kms_key_id, got %q", aws.ToString(input.KeyId))
+	}
+}
@@ -0,0 +1,98 @@
+package rotation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultVaultMount is the mount of the KV version 2 secrets engine Vault enables by default
+	DefaultVaultMount = "secret"
+
+	// vaultRequestTimeout bounds each request to Vault
+	vaultRequestTimeout = 30 * time.Second
+)
+
+// VaultPublisher stores rotated passwords in a HashiCorp Vault KV version 2 secrets engine,
+// at a path named after the user. Vault keeps earlier versions, so the previous password can
+// be read back until it is pruned.
+type VaultPublisher struct {
+	addr      string
+	token     string
+	namespace string
+	mount     string
+	prefix    string
+	client    *http.Client
+}
+
+// NewVaultPublisher creates a Vault publisher for a server address, VAULT_ADDR when empty,
+// authenticating with VAULT_TOKEN and using VAULT_NAMESPACE when set
+func NewVaultPublisher(addr, mount, prefix string) (*VaultPublisher, error) {
+	if addr == "" {
+		addr = os.Getenv("VAULT_ADDR")
+	}
+	if addr == "" {
+		return nil, fmt.Errorf("vault address is required: set rotation.vault_addr or VAULT_ADDR")
+	}
+	token := os.Getenv("VAULT_TOKEN")
+	if token == "" {
+		return nil, fmt.Errorf("VAULT_TOKEN is required to publish passwords to vault")
+	}
+	if mount == "" {
+		mount = DefaultVaultMount
+	}
+
+	return &VaultPublisher{
+		addr:      strings.TrimRight(addr, "/"),
+		token:     token,
+		namespace: os.Getenv("VAULT_NAMESPACE"),
+		mount:     strings.Trim(mount, "/"),
+		prefix:    strings.TrimLeft(prefix, "/"),
+		client:    &http.Client{Timeout: vaultRequestTimeout},
+	}, nil
+}
+
+// Publish writes the secret as a new version of the user's path
+func (p *VaultPublisher) Publish(ctx context.Context, secret Secret) error {
+	body, err := json.Marshal(map[string]Secret{"data": secret})
+	if err != nil {
+		return fmt.Errorf("failed to marshal secret: %w", err)
+	}
+	path := secretName(p.prefix, secret)
+	target := fmt.Sprintf("%s/v1/%s/data/%s", p.addr, p.mount, path)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create vault request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Vault-Token", p.token)
+	if p.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.namespace)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to publish password of user %s to vault: %w", secret.Username, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("vault returned %s publishing password of user %s to %s/%s: %s",
+			resp.Status, secret.Username, p.mount, path, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// Location returns the mount and path of the user's secret
+func (p *VaultPublisher) Location(secret Secret) string {
+	return "vault:" + p.mount + "/" + secretName(p.prefix, secret)
+}
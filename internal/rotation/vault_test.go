@@ -0,0 +1,64 @@
+package rotation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVaultPublisher(t *testing.T) {
+	var gotPath, gotToken string
+	var gotBody struct {
+		Data Secret `json:"data"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotToken = r.Header.Get("X-Vault-Token")
+		json.NewDecoder(r.Body).Decode(&gotBody)
+		w.Write([]byte(`{"data":{"version":2}}`))
+	}))
+	defer server.Close()
+
+	t.Setenv("VAULT_ADDR", server.URL)
+	t.Setenv("VAULT_TOKEN", "vault-token")
+	publisher, err := NewVaultPublisher("", "", DefaultPrefix)
+	if err != nil {
+		t.Fatalf("Failed to create publisher: %v", err)
+	}
+
+	if err := publisher.Publish(context.Background(), Secret{Username: "app_user", Password: "new-password"}); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+	if gotPath != "/v1/secret/data/postgres-user-manager/app_user" {
+		t.Errorf("Unexpected path %q", gotPath)
+	}
+	if gotToken != "vault-token" {
+		t.Errorf("Expected the token from VAULT_TOKEN, got %q", gotToken)
+	}
+	if gotBody.Data.Password != "new-password" {
+		t.Errorf("Expected the password under data, got %+v", gotBody)
+	}
+}
+
+func TestVaultPublisherErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	t.Setenv("VAULT_TOKEN", "")
+	if _, err := NewVaultPublisher(server.URL, "", DefaultPrefix); err == nil {
+		t.Error("Expected an error without VAULT_TOKEN")
+	}
+
+	t.Setenv("VAULT_TOKEN", "vault-token")
+	publisher, err := NewVaultPublisher(server.URL, "kv", DefaultPrefix)
+	if err != nil {
+		t.Fatalf("Failed to create publisher: %v", err)
+	}
+	if err := publisher.Publish(context.Background(), Secret{Username: "app_user", Password: "new-password"}); err == nil {
+		t.Error("Expected a denied write to fail")
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package secrets
+
+// allocateMemory returns a zeroed buffer of size bytes. Memory cannot be locked on this
+// platform, so it may be swapped to disk.
+func allocateMemory(size int) []byte {
+	return make([]byte, size)
+}
+
+// releaseMemory zeroes a buffer returned by allocateMemory
+func releaseMemory(buf []byte) {
+	clear(buf)
+}
@@ -0,0 +1,24 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package secrets
+
+import "syscall"
+
+// allocateMemory returns a zeroed buffer of size bytes outside of the Go heap, locked into
+// memory so it is never swapped to disk. When the lock is refused, for example because
+// RLIMIT_MEMLOCK is exhausted, the buffer is used unlocked.
+func allocateMemory(size int) []byte {
+	buf, err := syscall.Mmap(-1, 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+	if err != nil {
+		return make([]byte, size)
+	}
+	_ = syscall.Mlock(buf)
+	return buf
+}
+
+// releaseMemory zeroes a buffer returned by allocateMemory and unmaps it. Buffers allocated
+// on the heap because mapping failed are not mapped, so unmapping them fails harmlessly.
+func releaseMemory(buf []byte) {
+	clear(buf)
+	_ = syscall.Munmap(buf)
+}
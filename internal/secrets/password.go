@@ -0,0 +1,70 @@
+package secrets
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+)
+
+const (
+	// DefaultPasswordLength is the length of generated passwords when none is configured
+	DefaultPasswordLength = 32
+	// MinPasswordLength is the shortest generated password allowed
+	MinPasswordLength = 12
+	// DefaultPasswordCharset is the characters generated passwords are drawn from when none
+	// is configured. It leaves out quotes, backslashes and spaces so passwords can be pasted
+	// into connection strings and shells unquoted.
+	DefaultPasswordCharset = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789!#%*+-.=?@^_~"
+)
+
+// GeneratePassword returns a cryptographically random password of the given length drawn
+// uniformly from charset, using the defaults for a zero length or an empty charset. The
+// password is registered as a secret so it is masked in log output.
+func GeneratePassword(length int, charset string) (string, error) {
+	if err := CheckPasswordPolicy(length, charset); err != nil {
+		return "", err
+	}
+	if length == 0 {
+		length = DefaultPasswordLength
+	}
+	if charset == "" {
+		charset = DefaultPasswordCharset
+	}
+
+	characters := []rune(charset)
+	limit := big.NewInt(int64(len(characters)))
+	password := make([]rune, length)
+	for i := range password {
+		n, err := rand.Int(rand.Reader, limit)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate password: %w", err)
+		}
+		password[i] = characters[n.Int64()]
+	}
+
+	Register(string(password))
+	return string(password), nil
+}
+
+// CheckPasswordPolicy checks a generated password length and charset, where zero and empty
+// select the defaults
+func CheckPasswordPolicy(length int, charset string) error {
+	if length != 0 && length < MinPasswordLength {
+		return fmt.Errorf("password length %d is shorter than the minimum of %d", length, MinPasswordLength)
+	}
+
+	seen := make(map[rune]bool)
+	for _, r := range charset {
+		if r < ' ' || r == 0x7f {
+			return fmt.Errorf("password charset must not contain control characters")
+		}
+		if seen[r] {
+			return fmt.Errorf("password charset contains %q more than once", r)
+		}
+		seen[r] = true
+	}
+	if charset != "" && len(seen) < 2 {
+		return fmt.Errorf("password charset must contain at least 2 characters")
+	}
+	return nil
+}
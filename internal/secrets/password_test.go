@@ -0,0 +1,73 @@
+package secrets
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGeneratePassword(t *testing.T) {
+	password, err := GeneratePassword(0, "")
+	if err != nil {
+		t.Fatalf("Failed to generate password: %v", err)
+	}
+	if len(password) != DefaultPasswordLength {
+		t.Errorf("Expected %d characters, got %d", DefaultPasswordLength, len(password))
+	}
+	for _, r := range password {
+		if !strings.ContainsRune(DefaultPasswordCharset, r) {
+			t.Errorf("Unexpected character %q in generated password", r)
+		}
+	}
+	if Redact(password) != Mask {
+		t.Error("Expected generated password to be registered as a secret")
+	}
+
+	other, err := GeneratePassword(0, "")
+	if err != nil {
+		t.Fatalf("Failed to generate password: %v", err)
+	}
+	if other == password {
+		t.Error("Expected two generated passwords to differ")
+	}
+
+	password, err = GeneratePassword(16, "ab")
+	if err != nil {
+		t.Fatalf("Failed to generate password: %v", err)
+	}
+	if len(password) != 16 || strings.Trim(password, "ab") != "" {
+		t.Errorf("Expected 16 characters from the charset, got %q", password)
+	}
+}
+
+func TestCheckPasswordPolicy(t *testing.T) {
+	valid := []struct {
+		length  int
+		charset string
+	}{
+		{0, ""},
+		{MinPasswordLength, ""},
+		{64, "0123456789"},
+		{20, "äöü"},
+	}
+	for _, tc := range valid {
+		if err := CheckPasswordPolicy(tc.length, tc.charset); err != nil {
+			t.Errorf("Expected length %d and charset %q to be valid, got %v", tc.length, tc.charset, err)
+		}
+	}
+
+	invalid := []struct {
+		length  int
+		charset string
+	}{
+		{MinPasswordLength - 1, ""},
+		{-1, ""},
+		{20, "a"},
+		{20, "aab"},
+		{20, "ab\n"},
+	}
+	for _, tc := range invalid {
+		if err := CheckPasswordPolicy(tc.length, tc.charset); err == nil {
+			t.Errorf("Expected length %d and charset %q to be rejected", tc.length, tc.charset)
+		}
+	}
+}
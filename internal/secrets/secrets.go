@@ -0,0 +1,280 @@
+package secrets
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Mask replaces secret values in log output
+const Mask = "********"
+
+const (
+	// initialArenaSize is the size of the first buffer a registry keeps its values in
+	initialArenaSize = 4 << 10
+	// maxArenaSize bounds the memory a registry keeps values in. Once it is full, the values
+	// registered first are forgotten to make room, and their bytes are zeroed.
+	maxArenaSize = 1 << 20
+)
+
+// Registry holds the secret values a run has seen, such as passwords from the configuration
+// and connection credentials, so they can be masked wherever they would be logged. Values
+// are kept back to back in a buffer locked into memory where the platform allows it, so
+// they are not swapped to disk, and their bytes are zeroed as soon as they are replaced,
+// forgotten or wiped. They are never written anywhere. The zero value is ready to use.
+type Registry struct {
+	mu      sync.RWMutex
+	arena   []byte  // Buffer the values are kept in
+	used    int     // Bytes of the arena in use, including those of removed values
+	entries []entry // Longest first, so a secret containing another is masked whole
+	added   int     // Number of values ever stored, to forget the oldest first
+}
+
+// entry is a value kept in the arena of a registry
+type entry struct {
+	key    string // Slot the value was set for, empty for values added without one
+	offset int
+	length int
+	seq    int // Order the value was stored in
+}
+
+// defaultRegistry collects the secrets of the running command
+var defaultRegistry = &Registry{}
+
+// Register adds secret values to the registry of the running command
+func Register(values ...string) {
+	defaultRegistry.Add(values...)
+}
+
+// Replace sets the secret of a slot in the registry of the running command, zeroing and
+// forgetting the value the slot held before. Use it for credentials that are renewed, such
+// as auth tokens, so the registry does not grow with every renewal.
+func Replace(key, value string) {
+	defaultRegistry.Set(key, value)
+}
+
+// Wipe zeroes and forgets every secret registered for the running command
+func Wipe() {
+	defaultRegistry.Wipe()
+}
+
+// Redact masks every secret registered for the running command in a string
+func Redact(s string) string {
+	return defaultRegistry.Redact(s)
+}
+
+// NewHook returns a logrus hook that masks every secret registered for the running command
+func NewHook() *Hook {
+	return &Hook{Registry: defaultRegistry}
+}
+
+// Add registers secret values. Empty values and values already registered are ignored.
+func (r *Registry) Add(values ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, value := range values {
+		if value == "" || r.contains(value) {
+			continue
+		}
+		r.store("", value)
+	}
+}
+
+// Set registers the secret of a slot, zeroing and forgetting the value the slot held before.
+// An empty value only clears the slot.
+func (r *Registry) Set(key, value string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.entries {
+		if r.entries[i].key == key {
+			r.remove(i)
+			break
+		}
+	}
+	if value != "" {
+		r.store(key, value)
+	}
+}
+
+// Wipe zeroes and forgets every registered secret and releases the memory they were kept in
+func (r *Registry) Wipe() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.arena != nil {
+		releaseMemory(r.arena)
+	}
+	r.arena, r.used, r.entries = nil, 0, nil
+}
+
+// Redact masks every registered secret in a string
+func (r *Registry) Redact(s string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.entries) == 0 {
+		return s
+	}
+
+	text := []byte(s)
+	redacted := false
+	for _, e := range r.entries {
+		value := r.value(e)
+		if bytes.Contains(text, value) {
+			text = bytes.ReplaceAll(text, value, []byte(Mask))
+			redacted = true
+		}
+	}
+	if !redacted {
+		return s
+	}
+	return string(text)
+}
+
+// value returns the bytes of an entry in the arena
+func (r *Registry) value(e entry) []byte {
+	return r.arena[e.offset : e.offset+e.length]
+}
+
+// contains reports whether a value is registered
+func (r *Registry) contains(value string) bool {
+	for _, e := range r.entries {
+		if e.length == len(value) && string(r.value(e)) == value {
+			return true
+		}
+	}
+	return false
+}
+
+// store copies a value into the arena, making room by compacting it, growing it up to
+// maxArenaSize and finally forgetting the oldest values
+func (r *Registry) store(key, value string) {
+	if len(value) > maxArenaSize {
+		return
+	}
+	if r.used+len(value) > len(r.arena) {
+		r.compact()
+		for r.used+len(value) > maxArenaSize {
+			r.remove(r.oldest())
+			r.compact()
+		}
+		if r.used+len(value) > len(r.arena) {
+			r.grow(r.used + len(value))
+		}
+	}
+
+	e := entry{key: key, offset: r.used, length: len(value), seq: r.added}
+	copy(r.arena[r.used:], value)
+	r.used += len(value)
+	r.added++
+
+	// Keep the entries longest first, after values of the same length
+	i := sort.Search(len(r.entries), func(i int) bool { return r.entries[i].length < e.length })
+	r.entries = slices.Insert(r.entries, i, e)
+}
+
+// remove zeroes the value of an entry and forgets it. Its bytes are reclaimed by compact.
+func (r *Registry) remove(i int) {
+	clear(r.value(r.entries[i]))
+	r.entries = slices.Delete(r.entries, i, i+1)
+}
+
+// oldest returns the index of the entry stored first
+func (r *Registry) oldest() int {
+	oldest := 0
+	for i, e := range r.entries {
+		if e.seq < r.entries[oldest].seq {
+			oldest = i
+		}
+	}
+	return oldest
+}
+
+// compact moves the values to the start of the arena in the order they were stored, and
+// zeroes the bytes behind them
+func (r *Registry) compact() {
+	order := make([]*entry, len(r.entries))
+	for i := range r.entries {
+		order[i] = &r.entries[i]
+	}
+	sort.Slice(order, func(i, j int) bool { return order[i].offset < order[j].offset })
+
+	used := 0
+	for _, e := range order {
+		copy(r.arena[used:], r.value(*e))
+		e.offset = used
+		used += e.length
+	}
+	clear(r.arena[used:r.used])
+	r.used = used
+}
+
+// grow moves the values to a larger arena that holds at least size bytes, zeroing and
+// releasing the previous one
+func (r *Registry) grow(size int) {
+	capacity := max(initialArenaSize, len(r.arena))
+	for capacity < size {
+		capacity *= 2
+	}
+	capacity = min(capacity, maxArenaSize)
+
+	arena := allocateMemory(capacity)
+	if r.arena != nil {
+		copy(arena, r.arena[:r.used])
+		releaseMemory(r.arena)
+	}
+	r.arena = arena
+}
+
+// Hook is a logrus hook that masks registered secrets, and anything shaped like a password
+// or token, in log messages and fields before they are formatted, so no output format or
+// log level can reveal them
+type Hook struct {
+	Registry *Registry
+}
+
+// redact masks registered secrets and credential material in a string
+func (h *Hook) redact(s string) string {
+	return MaskCredentials(h.Registry.Redact(s))
+}
+
+// Levels implements logrus.Hook
+func (h *Hook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire implements logrus.Hook
+func (h *Hook) Fire(entry *logrus.Entry) error {
+	entry.Message = h.redact(entry.Message)
+
+	for key, value := range entry.Data {
+		if s, ok := value.(string); ok && s != "" && SensitiveKey(key) {
+			entry.Data[key] = Mask
+			continue
+		}
+
+		switch v := value.(type) {
+		case string:
+			entry.Data[key] = h.redact(v)
+		case error:
+			if redacted := h.redact(v.Error()); redacted != v.Error() {
+				entry.Data[key] = errors.New(redacted)
+			}
+		default:
+			// Anything else is formatted the way the formatter would, and only replaced when
+			// that reveals a secret
+			text := fmt.Sprint(v)
+			if redacted := h.redact(text); redacted != text {
+				entry.Data[key] = redacted
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package secrets
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// newTestLogger returns a logger writing to a buffer with a hook for the given registry
+func newTestLogger(registry *Registry, formatter logrus.Formatter) (*logrus.Logger, *bytes.Buffer) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&out)
+	logger.SetFormatter(formatter)
+	logger.SetLevel(logrus.DebugLevel)
+	logger.AddHook(&Hook{Registry: registry})
+	return logger, &out
+}
+
+func TestRegistryRedact(t *testing.T) {
+	registry := &Registry{}
+	registry.Add("s3cret", "", "s3cret-and-more", "s3cret")
+
+	got := registry.Redact("ALTER USER alice WITH PASSWORD 's3cret-and-more'; -- s3cret")
+	want := "ALTER USER alice WITH PASSWORD '" + Mask + "'; -- " + Mask
+	if got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	if got := registry.Redact("nothing to hide"); got != "nothing to hide" {
+		t.Errorf("Expected text without secrets to be unchanged, got %q", got)
+	}
+	if len(registry.entries) != 2 {
+		t.Errorf("Expected empty and duplicate values to be ignored, got %d values", len(registry.entries))
+	}
+}
+
+func TestRegistrySetReplacesValue(t *testing.T) {
+	registry := &Registry{}
+	registry.Set("iam-token", "first-token")
+	old := registry.value(registry.entries[0])
+	registry.Set("iam-token", "second-token")
+
+	if len(registry.entries) != 1 {
+		t.Fatalf("Expected the token to be replaced, got %d values", len(registry.entries))
+	}
+	if got := registry.Redact("first-token second-token"); got != "first-token "+Mask {
+		t.Errorf("Expected only the current token to be masked, got %q", got)
+	}
+	if !bytes.Equal(old, make([]byte, len(old))) {
+		t.Errorf("Expected the replaced token to be zeroed, got %q", old)
+	}
+
+	registry.Wipe()
+	if got := registry.Redact("second-token"); got != "second-token" {
+		t.Errorf("Expected wiped secrets to be forgotten, got %q", got)
+	}
+}
+
+func TestRegistryIsBounded(t *testing.T) {
+	registry := &Registry{}
+	value := strings.Repeat("x", 1000)
+	for i := 0; i < 2*maxArenaSize/len(value); i++ {
+		registry.Add(fmt.Sprintf("%06d%s", i, value))
+	}
+
+	if len(registry.arena) > maxArenaSize {
+		t.Errorf("Expected at most %d bytes of secrets, got %d", maxArenaSize, len(registry.arena))
+	}
+	newest := fmt.Sprintf("%06d%s", 2*maxArenaSize/len(value)-1, value)
+	if got := registry.Redact(newest); got != Mask {
+		t.Error("Expected the newest secret to be kept")
+	}
+	if got := registry.Redact("000000" + value); got == Mask {
+		t.Error("Expected the oldest secret to be forgotten")
+	}
+}
+
+func TestHookMasksPasswords(t *testing.T) {
+	const password = "hunter2-Pa$$word"
+	registry := &Registry{}
+	registry.Add(password)
+
+	formatters := map[string]logrus.Formatter{
+		"text": &logrus.TextFormatter{DisableColors: true},
+		"json": &logrus.JSONFormatter{},
+	}
+	for name, formatter := range formatters {
+		t.Run(name, func(t *testing.T) {
+			logger, out := newTestLogger(registry, formatter)
+
+			logger.Debugf("Executing: CREATE USER alice WITH PASSWORD '%s'", password)
+			logger.WithField("password", password).Info("Creating user")
+			logger.WithError(fmt.Errorf("failed to connect: password %s rejected", password)).Error("Connection failed")
+			logger.WithFields(logrus.Fields{
+				"statements": []string{"ALTER USER bob PASSWORD '" + password + "'"},
+				"attempt":    2,
+			}).Warn("Retrying")
+
+			if strings.Contains(out.String(), password) {
+				t.Fatalf("Password reached log output:\n%s", out.String())
+			}
+			if strings.Count(out.String(), Mask) != 4 {
+				t.Errorf("Expected every entry to carry the mask, got:\n%s", out.String())
+			}
+			if !strings.Contains(out.String(), "attempt") || !strings.Contains(out.String(), "2") {
+				t.Errorf("Expected fields without secrets to be kept, got:\n%s", out.String())
+			}
+		})
+	}
+}
+
+func TestHookKeepsErrorsWithoutSecrets(t *testing.T) {
+	registry := &Registry{}
+	registry.Add("hunter2")
+
+	err := errors.New("connection refused")
+	entry := logrus.NewEntry(logrus.New()).WithError(err)
+	if fireErr := (&Hook{Registry: registry}).Fire(entry); fireErr != nil {
+		t.Fatalf("Hook failed: %v", fireErr)
+	}
+	if entry.Data[logrus.ErrorKey] != err {
+		t.Error("Expected an error without secrets to be left untouched")
+	}
+}
+
+func TestDefaultRegistry(t *testing.T) {
+	Register("default-registry-token")
+
+	if got := Redact("token=default-registry-token"); got != "token="+Mask {
+		t.Errorf("Expected registered token to be masked, got %q", got)
+	}
+
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&out)
+	logger.AddHook(NewHook())
+	logger.Info("using default-registry-token")
+	if strings.Contains(out.String(), "default-registry-token") {
+		t.Errorf("Token reached log output: %s", out.String())
+	}
+}
+
+func TestHookMasksUnregisteredCredentials(t *testing.T) {
+	logger, out := newTestLogger(&Registry{}, &logrus.TextFormatter{DisableColors: true})
+
+	logger.WithField("connection", "host=db port=5432 password=hunter2").Info("Connecting")
+	logger.WithField("bind_password", "hunter2").Debug("Binding")
+	logger.Info("DRY RUN: ALTER ROLE app PASSWORD 'hunter2'")
+
+	if strings.Contains(out.String(), "hunter2") {
+		t.Fatalf("Password reached log output:\n%s", out.String())
+	}
+}
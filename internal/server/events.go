@@ -0,0 +1,142 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/events"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// eventsPath receives event payloads
+	eventsPath = "/events"
+	// signatureHeader carries the HMAC-SHA256 signature of an event as sha256=<hex>, made over
+	// the timestamp, a dot and the body
+	signatureHeader = "X-Signature-256"
+	// timestampHeader carries the Unix time in seconds at which an event was signed
+	timestampHeader = "X-Signature-Timestamp"
+	// signatureTolerance bounds how far the timestamp of a signed event may be from the
+	// server's clock, so a captured request cannot be replayed later
+	signatureTolerance = 5 * time.Minute
+	// maxEventSize bounds the body of an event request
+	maxEventSize = 1 << 20
+)
+
+// EventApplier applies event payloads to the database
+type EventApplier interface {
+	ApplyPayload(event *structs.EventPayload) error
+}
+
+// handleHealth reports that the process is up
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, "application/json", map[string]string{"status": "ok"})
+}
+
+// handleReady reports whether the database is reachable
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	if err := s.manager.Ping(); err != nil {
+		s.logger.WithError(err).Warn("Readiness check failed")
+		writeJSON(w, http.StatusServiceUnavailable, "application/json", map[string]string{"status": "unavailable"})
+		return
+	}
+	writeJSON(w, http.StatusOK, "application/json", map[string]string{"status": "ready"})
+}
+
+// handleEvent applies an event payload. Requests are accepted with the admin bearer token or,
+// when an event secret is configured, a recent HMAC-SHA256 signature of the timestamp and body.
+func (s *Server) handleEvent(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxEventSize))
+	if err != nil {
+		writeEventError(w, http.StatusBadRequest, "failed to read event: "+err.Error())
+		return
+	}
+
+	if !s.authenticateEvent(r, body) {
+		s.logger.WithFields(logrus.Fields{
+			"path":   r.URL.Path,
+			"remote": r.RemoteAddr,
+		}).Warn("Rejected unauthenticated event")
+		writeEventError(w, http.StatusUnauthorized, "invalid or missing signature or bearer token")
+		return
+	}
+
+	var event structs.EventPayload
+	if err := json.Unmarshal(body, &event); err != nil {
+		writeEventError(w, http.StatusBadRequest, "invalid event: "+err.Error())
+		return
+	}
+	if event.EventType == "" || event.Username == "" {
+		writeEventError(w, http.StatusBadRequest, "eventType and username are required")
+		return
+	}
+
+	if err := s.options.Events.ApplyPayload(&event); err != nil {
+		if errors.Is(err, events.ErrInvalidEvent) {
+			writeEventError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		s.logger.WithError(err).Error("Event request failed")
+		writeEventError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"event_type": event.EventType,
+		"username":   event.Username,
+	}).Info("Event applied")
+	writeJSON(w, http.StatusOK, "application/json", map[string]string{"status": "applied"})
+}
+
+// authenticateEvent accepts the admin bearer token or a valid signature with a timestamp
+// within signatureTolerance of now. Delegated tokens are not accepted because events name
+// their groups before mapping.
+func (s *Server) authenticateEvent(r *http.Request, body []byte) bool {
+	if s.options.EventSecret != "" && s.verifySignature(r, body) {
+		return true
+	}
+
+	c := s.identify(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+	return c != nil && c.roles == nil
+}
+
+// verifySignature checks the signature of an event against the event secret, the timestamp
+// header and the body, and that the timestamp is recent
+func (s *Server) verifySignature(r *http.Request, body []byte) bool {
+	signature, ok := strings.CutPrefix(r.Header.Get(signatureHeader), "sha256=")
+	if !ok {
+		return false
+	}
+	timestamp := r.Header.Get(timestampHeader)
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	if age := time.Since(time.Unix(seconds, 0)); age > signatureTolerance || age < -signatureTolerance {
+		s.logger.WithFields(logrus.Fields{
+			"timestamp": timestamp,
+			"remote":    r.RemoteAddr,
+		}).Warn("Rejected event with a stale or future signature timestamp")
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(s.options.EventSecret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(strings.ToLower(signature)), []byte(expected))
+}
+
+// writeEventError writes an error response for the events endpoint
+func writeEventError(w http.ResponseWriter, status int, detail string) {
+	writeJSON(w, status, "application/json", map[string]string{"error": detail})
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/database/fake"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/events"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+const testEventSecret = "event-secret"
+
+func newEventsTestServer(t *testing.T) (*fake.Manager, http.Handler) {
+	t.Helper()
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	manager := fake.NewManager()
+	srv, err := NewServer(manager, logger, Options{
+		Token:       testToken,
+		Events:      events.NewApplier(events.NewEventHandler(logger), manager, ""),
+		EventSecret: testEventSecret,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	return manager, srv.Handler()
+}
+
+func postEvent(t *testing.T, handler http.Handler, body string, headers map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(body))
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// signAt returns the headers of an event signed at a time
+func signAt(body string, at time.Time) map[string]string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(testEventSecret))
+	mac.Write([]byte(timestamp + "." + body))
+	return map[string]string{
+		signatureHeader: "sha256=" + hex.EncodeToString(mac.Sum(nil)),
+		timestampHeader: timestamp,
+	}
+}
+
+// sign returns the headers of an event signed now
+func sign(body string) map[string]string {
+	return signAt(body, time.Now())
+}
+
+func TestEventsEndpoint(t *testing.T) {
+	manager, handler := newEventsTestServer(t)
+	manager.CreateGroup(&structs.GroupConfig{Name: "app_group"})
+
+	signup := `{"eventType": "PostConfirmation_ConfirmSignUp", "userId": "1", "username": "alice@example.com", "groups": ["Users"]}`
+
+	for name, headers := range map[string]map[string]string{
+		"no credentials":  {},
+		"wrong signature": sign(signup + " "),
+		"no timestamp":    {signatureHeader: sign(signup)[signatureHeader]},
+		"wrong token":     {"Authorization": "Bearer wrong-token"},
+	} {
+		if rec := postEvent(t, handler, signup, headers); rec.Code != http.StatusUnauthorized {
+			t.Errorf("Expected 401 with %s, got %d", name, rec.Code)
+		}
+	}
+
+	rec := postEvent(t, handler, signup, sign(signup))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 for a signed event, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !canLogin(manager, "alice") || !isMember(manager, "app_group", "alice") {
+		t.Errorf("Expected alice to be created in app_group, got roles %v", manager.Roles())
+	}
+
+	removed := `{"eventType": "GroupMembership_GroupRemoved", "userId": "1", "username": "alice", "groups": ["Users"]}`
+	rec = postEvent(t, handler, removed, map[string]string{"Authorization": "Bearer " + testToken})
+	if rec.Code != http.StatusOK || isMember(manager, "app_group", "alice") {
+		t.Errorf("Expected alice to be removed from app_group, got %d", rec.Code)
+	}
+
+	unknown := `{"eventType": "Unknown", "userId": "1", "username": "alice"}`
+	rec = postEvent(t, handler, unknown, sign(unknown))
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected 422 for an unknown event type, got %d", rec.Code)
+	}
+
+	rec = postEvent(t, handler, `{"eventType": "Unknown"}`, map[string]string{"Authorization": "Bearer " + testToken})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without a username, got %d", rec.Code)
+	}
+}
+
+func TestEventsEndpointRejectsReplays(t *testing.T) {
+	manager, handler := newEventsTestServer(t)
+	manager.CreateGroup(&structs.GroupConfig{Name: "app_group"})
+
+	added := `{"eventType": "GroupMembership_GroupAdded", "userId": "1", "username": "alice", "groups": ["Users"]}`
+	manager.CreateUser(&structs.UserConfig{Username: "alice", CanLogin: true})
+
+	// A request captured ten minutes ago is too old to be sent again
+	captured := signAt(added, time.Now().Add(-10*time.Minute))
+	if rec := postEvent(t, handler, added, captured); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a replayed event, got %d", rec.Code)
+	}
+
+	// Its signature does not cover a fresh timestamp
+	refreshed := map[string]string{
+		signatureHeader: captured[signatureHeader],
+		timestampHeader: strconv.FormatInt(time.Now().Unix(), 10),
+	}
+	if rec := postEvent(t, handler, added, refreshed); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a replayed signature with a new timestamp, got %d", rec.Code)
+	}
+
+	if rec := postEvent(t, handler, added, signAt(added, time.Now().Add(10*time.Minute))); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a timestamp in the future, got %d", rec.Code)
+	}
+	if isMember(manager, "app_group", "alice") {
+		t.Error("Expected alice not to be added by rejected events")
+	}
+
+	if rec := postEvent(t, handler, added, sign(added)); rec.Code != http.StatusOK || !isMember(manager, "app_group", "alice") {
+		t.Errorf("Expected a freshly signed event to be applied, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	manager, handler := newEventsTestServer(t)
+
+	for _, path := range []string{"/healthz", "/readyz"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("Expected 200 from %s without a token, got %d", path, rec.Code)
+		}
+	}
+
+	manager.SetPingError(errors.New("connection refused"))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 when the database is unreachable, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,762 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/database"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/sources"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	scimContentType = "application/scim+json"
+	scimBasePath    = "/scim/v2"
+
+	scimUserSchema     = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimGroupSchema    = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	scimListSchema     = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimErrorSchema    = "urn:ietf:params:scim:api:messages:2.0:Error"
+	scimProviderSchema = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+)
+
+// scimFilterPattern matches the equality filters identity providers use to look up resources
+var scimFilterPattern = regexp.MustCompile(`^(\w+)\s+eq\s+"((?:[^"\\]|\\.)*)"$`)
+
+// scimMemberFilterPattern matches a member path filter such as members[value eq "alice"]
+var scimMemberFilterPattern = regexp.MustCompile(`^members\[value\s+eq\s+"((?:[^"\\]|\\.)*)"\]$`)
+
+// scimReference is a reference to a user or group in a SCIM resource
+type scimReference struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+}
+
+// scimMeta is the metadata of a SCIM resource
+type scimMeta struct {
+	ResourceType string `json:"resourceType"`
+	Location     string `json:"location"`
+}
+
+// scimUser is a SCIM user resource
+type scimUser struct {
+	Schemas     []string        `json:"schemas"`
+	ID          string          `json:"id,omitempty"`
+	UserName    string          `json:"userName"`
+	DisplayName string          `json:"displayName,omitempty"`
+	Active      *bool           `json:"active,omitempty"`
+	Groups      []scimReference `json:"groups,omitempty"`
+	Meta        *scimMeta       `json:"meta,omitempty"`
+}
+
+// scimGroup is a SCIM group resource
+type scimGroup struct {
+	Schemas     []string        `json:"schemas"`
+	ID          string          `json:"id,omitempty"`
+	DisplayName string          `json:"displayName"`
+	Members     []scimReference `json:"members,omitempty"`
+	Meta        *scimMeta       `json:"meta,omitempty"`
+}
+
+// scimListResponse is a SCIM list response
+type scimListResponse struct {
+	Schemas      []string      `json:"schemas"`
+	TotalResults int           `json:"totalResults"`
+	StartIndex   int           `json:"startIndex"`
+	ItemsPerPage int           `json:"itemsPerPage"`
+	Resources    []interface{} `json:"Resources"`
+}
+
+// scimPatchRequest is a SCIM PATCH request
+type scimPatchRequest struct {
+	Operations []scimPatchOperation `json:"Operations"`
+}
+
+// scimPatchOperation is a single SCIM PATCH operation
+type scimPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// registerSCIMRoutes registers the SCIM 2.0 Users and Groups endpoints
+func (s *Server) registerSCIMRoutes() {
+	s.mux.HandleFunc("GET "+scimBasePath+"/ServiceProviderConfig", s.handleServiceProviderConfig)
+
+	s.mux.HandleFunc("GET "+scimBasePath+"/Users", s.handleListUsers)
+	s.mux.HandleFunc("POST "+scimBasePath+"/Users", s.handleCreateUser)
+	s.mux.HandleFunc("GET "+scimBasePath+"/Users/{id}", s.scoped(s.handleGetUser))
+	s.mux.HandleFunc("PUT "+scimBasePath+"/Users/{id}", s.scoped(s.handleReplaceUser))
+	s.mux.HandleFunc("PATCH "+scimBasePath+"/Users/{id}", s.scoped(s.handlePatchUser))
+	s.mux.HandleFunc("DELETE "+scimBasePath+"/Users/{id}", s.scoped(s.handleDeleteUser))
+
+	s.mux.HandleFunc("GET "+scimBasePath+"/Groups", s.handleListGroups)
+	s.mux.HandleFunc("POST "+scimBasePath+"/Groups", s.handleCreateGroup)
+	s.mux.HandleFunc("GET "+scimBasePath+"/Groups/{id}", s.scoped(s.handleGetGroup))
+	s.mux.HandleFunc("PUT "+scimBasePath+"/Groups/{id}", s.scoped(s.handleReplaceGroup))
+	s.mux.HandleFunc("PATCH "+scimBasePath+"/Groups/{id}", s.scoped(s.handlePatchGroup))
+	s.mux.HandleFunc("DELETE "+scimBasePath+"/Groups/{id}", s.scoped(s.handleDeleteGroup))
+}
+
+// handleServiceProviderConfig describes the supported SCIM features
+func (s *Server) handleServiceProviderConfig(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, scimContentType, map[string]interface{}{
+		"schemas":        []string{scimProviderSchema},
+		"patch":          map[string]bool{"supported": true},
+		"bulk":           map[string]interface{}{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]interface{}{"supported": true, "maxResults": 1},
+		"changePassword": map[string]bool{"supported": false},
+		"sort":           map[string]bool{"supported": false},
+		"etag":           map[string]bool{"supported": false},
+		"authenticationSchemes": []map[string]string{
+			{"type": "oauthbearertoken", "name": "Bearer token", "description": "Static bearer token"},
+		},
+	})
+}
+
+// handleListUsers looks up a user by a userName filter
+func (s *Server) handleListUsers(w http.ResponseWriter, r *http.Request) {
+	resources := []interface{}{}
+
+	attribute, value, err := parseSCIMFilter(r.URL.Query().Get("filter"))
+	if err != nil {
+		writeSCIMError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Listing every role is not supported; identity providers look users up by userName
+	if attribute != "" {
+		if attribute != "userName" {
+			writeSCIMError(w, http.StatusBadRequest, fmt.Sprintf("filtering on %s is not supported", attribute))
+			return
+		}
+
+		username := sources.UsernameFromLogin(value)
+		user, found, err := s.loadUser(username)
+		if err != nil {
+			s.writeInternalError(w, err)
+			return
+		}
+		if found && callerFrom(r.Context()).allows(username) {
+			resources = append(resources, user)
+		}
+	}
+
+	writeSCIMList(w, resources)
+}
+
+// handleCreateUser provisions a user
+func (s *Server) handleCreateUser(w http.ResponseWriter, r *http.Request) {
+	var request scimUser
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeSCIMError(w, http.StatusBadRequest, "invalid user resource: "+err.Error())
+		return
+	}
+	if request.UserName == "" {
+		writeSCIMError(w, http.StatusBadRequest, "userName is required")
+		return
+	}
+
+	username := sources.UsernameFromLogin(request.UserName)
+	if !s.authorize(w, r, username) {
+		return
+	}
+
+	exists, _, err := s.manager.RoleCanLogin(username)
+	if err != nil {
+		s.writeInternalError(w, err)
+		return
+	}
+	if exists {
+		writeSCIMError(w, http.StatusConflict, fmt.Sprintf("user %s already exists", username))
+		return
+	}
+
+	active := request.Active == nil || *request.Active
+	user := &structs.UserConfig{
+		Username:    username,
+		AuthMethod:  s.options.AuthMethod,
+		CanLogin:    active,
+		Enabled:     true,
+		Description: request.DisplayName,
+	}
+	if err := s.manager.CreateUser(user); err != nil {
+		s.writeInternalError(w, err)
+		return
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"username": username,
+		"active":   active,
+	}).Info("SCIM user provisioned")
+
+	s.writeUser(w, http.StatusCreated, username)
+}
+
+// handleGetUser returns a user
+func (s *Server) handleGetUser(w http.ResponseWriter, r *http.Request) {
+	s.writeUser(w, http.StatusOK, r.PathValue("id"))
+}
+
+// handleReplaceUser applies a full user resource; only the active flag can change
+func (s *Server) handleReplaceUser(w http.ResponseWriter, r *http.Request) {
+	var request scimUser
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeSCIMError(w, http.StatusBadRequest, "invalid user resource: "+err.Error())
+		return
+	}
+
+	id := r.PathValue("id")
+	if request.Active != nil {
+		if status, err := s.setActive(id, *request.Active); err != nil {
+			writeSCIMError(w, status, err.Error())
+			return
+		}
+	}
+
+	s.writeUser(w, http.StatusOK, id)
+}
+
+// handlePatchUser applies PATCH operations to a user; only the active flag can change
+func (s *Server) handlePatchUser(w http.ResponseWriter, r *http.Request) {
+	var request scimPatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeSCIMError(w, http.StatusBadRequest, "invalid patch request: "+err.Error())
+		return
+	}
+
+	id := r.PathValue("id")
+	for _, op := range request.Operations {
+		active, ok, err := patchActiveValue(op)
+		if err != nil {
+			writeSCIMError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if !ok {
+			// Attributes other than active have no database equivalent and are ignored
+			continue
+		}
+
+		if status, err := s.setActive(id, active); err != nil {
+			writeSCIMError(w, status, err.Error())
+			return
+		}
+	}
+
+	s.writeUser(w, http.StatusOK, id)
+}
+
+// handleDeleteUser deprovisions a user
+func (s *Server) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	if status, err := s.checkManagedUser(id); err != nil {
+		if status == http.StatusInternalServerError {
+			s.writeInternalError(w, err)
+			return
+		}
+		writeSCIMError(w, status, err.Error())
+		return
+	}
+
+	if err := s.manager.DropUser(id); err != nil {
+		if errors.Is(err, database.ErrDeletionProtected) {
+			writeSCIMError(w, http.StatusConflict, fmt.Sprintf("user %s has deletion protection", id))
+			return
+		}
+		s.writeInternalError(w, err)
+		return
+	}
+
+	s.logger.WithField("username", id).Info("SCIM user deprovisioned")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleListGroups looks up a group by a displayName filter
+func (s *Server) handleListGroups(w http.ResponseWriter, r *http.Request) {
+	resources := []interface{}{}
+
+	attribute, value, err := parseSCIMFilter(r.URL.Query().Get("filter"))
+	if err != nil {
+		writeSCIMError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if attribute != "" {
+		if attribute != "displayName" {
+			writeSCIMError(w, http.StatusBadRequest, fmt.Sprintf("filtering on %s is not supported", attribute))
+			return
+		}
+
+		name := s.groupRole(value)
+		group, found, err := s.loadGroup(name)
+		if err != nil {
+			s.writeInternalError(w, err)
+			return
+		}
+		if found && callerFrom(r.Context()).allows(name) {
+			resources = append(resources, group)
+		}
+	}
+
+	writeSCIMList(w, resources)
+}
+
+// handleCreateGroup provisions a group and its initial members
+func (s *Server) handleCreateGroup(w http.ResponseWriter, r *http.Request) {
+	var request scimGroup
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeSCIMError(w, http.StatusBadRequest, "invalid group resource: "+err.Error())
+		return
+	}
+	if request.DisplayName == "" {
+		writeSCIMError(w, http.StatusBadRequest, "displayName is required")
+		return
+	}
+
+	name := s.groupRole(request.DisplayName)
+	if !s.authorize(w, r, name) {
+		return
+	}
+	for _, member := range request.Members {
+		if !s.authorize(w, r, member.Value) {
+			return
+		}
+	}
+
+	// An existing role is refused when the server may not change it and otherwise conflicts.
+	// A new one would be managed as a group, so only its name can refuse it.
+	switch status, err := s.checkManagedGroup(name); status {
+	case http.StatusOK:
+		writeSCIMError(w, http.StatusConflict, fmt.Sprintf("group %s already exists", name))
+		return
+	case http.StatusNotFound:
+		attributes := &structs.RoleAttributes{ManagedAs: database.ManagedKindGroup}
+		if reason := database.RefuseGroup(name, attributes, true); reason != "" {
+			writeSCIMError(w, http.StatusForbidden, refusedGroup(name, reason).Error())
+			return
+		}
+	default:
+		writeSCIMError(w, status, err.Error())
+		return
+	}
+
+	if err := s.manager.CreateGroup(&structs.GroupConfig{Name: name, Inherit: true}); err != nil {
+		s.writeInternalError(w, err)
+		return
+	}
+
+	for _, member := range request.Members {
+		if err := s.manager.AddUserToGroup(member.Value, name); err != nil {
+			s.writeInternalError(w, err)
+			return
+		}
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"group":   name,
+		"members": len(request.Members),
+	}).Info("SCIM group provisioned")
+
+	s.writeGroup(w, http.StatusCreated, name)
+}
+
+// handleGetGroup returns a group
+func (s *Server) handleGetGroup(w http.ResponseWriter, r *http.Request) {
+	s.writeGroup(w, http.StatusOK, r.PathValue("id"))
+}
+
+// handleReplaceGroup replaces the members of a group
+func (s *Server) handleReplaceGroup(w http.ResponseWriter, r *http.Request) {
+	var request scimGroup
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeSCIMError(w, http.StatusBadRequest, "invalid group resource: "+err.Error())
+		return
+	}
+
+	id := r.PathValue("id")
+	if status, err := s.checkManagedGroup(id); err != nil {
+		writeSCIMError(w, status, err.Error())
+		return
+	}
+	if status, err := s.replaceMembers(callerFrom(r.Context()), id, request.Members); err != nil {
+		writeSCIMError(w, status, err.Error())
+		return
+	}
+
+	s.writeGroup(w, http.StatusOK, id)
+}
+
+// handlePatchGroup adds, removes or replaces group members
+func (s *Server) handlePatchGroup(w http.ResponseWriter, r *http.Request) {
+	var request scimPatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeSCIMError(w, http.StatusBadRequest, "invalid patch request: "+err.Error())
+		return
+	}
+
+	id := r.PathValue("id")
+	if status, err := s.checkManagedGroup(id); err != nil {
+		writeSCIMError(w, status, err.Error())
+		return
+	}
+
+	for _, op := range request.Operations {
+		if status, err := s.applyGroupOperation(callerFrom(r.Context()), id, op); err != nil {
+			writeSCIMError(w, status, err.Error())
+			return
+		}
+	}
+
+	s.writeGroup(w, http.StatusOK, id)
+}
+
+// handleDeleteGroup drops a group, removing it from its members
+func (s *Server) handleDeleteGroup(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if status, err := s.checkManagedGroup(id); err != nil {
+		writeSCIMError(w, status, err.Error())
+		return
+	}
+
+	if err := s.manager.DropGroup(id); err != nil {
+		if errors.Is(err, database.ErrDeletionProtected) {
+			writeSCIMError(w, http.StatusConflict, fmt.Sprintf("group %s has deletion protection", id))
+			return
+		}
+		s.writeInternalError(w, err)
+		return
+	}
+
+	s.logger.WithField("group", id).Info("SCIM group deleted")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// applyGroupOperation applies a single PATCH operation to a group's members
+func (s *Server) applyGroupOperation(c *caller, group string, op scimPatchOperation) (int, error) {
+	var members []scimReference
+	if len(op.Value) > 0 {
+		if err := json.Unmarshal(op.Value, &members); err != nil {
+			// Some identity providers send the members inside an object
+			var wrapped struct {
+				Members []scimReference `json:"members"`
+			}
+			if err := json.Unmarshal(op.Value, &wrapped); err != nil {
+				return http.StatusBadRequest, fmt.Errorf("invalid members value: %w", err)
+			}
+			members = wrapped.Members
+		}
+	}
+
+	// A path filter selects a single member, e.g. members[value eq "alice"]
+	if match := scimMemberFilterPattern.FindStringSubmatch(op.Path); match != nil {
+		members = []scimReference{{Value: unquoteSCIM(match[1])}}
+	} else if op.Path != "" && op.Path != "members" {
+		// Attributes other than members have no database equivalent and are ignored
+		return http.StatusOK, nil
+	}
+
+	for _, member := range members {
+		if !c.allows(member.Value) {
+			return http.StatusForbidden, c.forbidden(member.Value)
+		}
+	}
+
+	switch strings.ToLower(op.Op) {
+	case "add":
+		for _, member := range members {
+			if err := s.manager.AddUserToGroup(member.Value, group); err != nil {
+				return http.StatusInternalServerError, err
+			}
+		}
+	case "remove":
+		for _, member := range members {
+			if err := s.manager.RemoveUserFromGroup(member.Value, group); err != nil {
+				return http.StatusInternalServerError, err
+			}
+		}
+	case "replace":
+		return s.replaceMembers(c, group, members)
+	default:
+		return http.StatusBadRequest, fmt.Errorf("unsupported patch operation %s", op.Op)
+	}
+
+	return http.StatusOK, nil
+}
+
+// replaceMembers makes a group's members match the given list. Members outside the caller's
+// roles are left in place.
+func (s *Server) replaceMembers(c *caller, group string, members []scimReference) (int, error) {
+	for _, member := range members {
+		if !c.allows(member.Value) {
+			return http.StatusForbidden, c.forbidden(member.Value)
+		}
+	}
+
+	current, err := s.manager.GetGroupMembers(group)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	wanted := make(map[string]bool, len(members))
+	for _, member := range members {
+		wanted[member.Value] = true
+	}
+
+	existing := make(map[string]bool, len(current))
+	for _, member := range current {
+		existing[member] = true
+		if !wanted[member] && c.allows(member) {
+			if err := s.manager.RemoveUserFromGroup(member, group); err != nil {
+				return http.StatusInternalServerError, err
+			}
+		}
+	}
+
+	for _, member := range members {
+		if !existing[member.Value] {
+			if err := s.manager.AddUserToGroup(member.Value, group); err != nil {
+				return http.StatusInternalServerError, err
+			}
+		}
+	}
+
+	return http.StatusOK, nil
+}
+
+// setActive enables or disables a user
+func (s *Server) setActive(username string, active bool) (int, error) {
+	if status, err := s.checkManagedUser(username); err != nil {
+		return status, err
+	}
+
+	var err error
+	if active {
+		_, err = s.manager.EnableUser(username)
+	} else {
+		_, err = s.manager.DisableUser(username)
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"username": username,
+		"active":   active,
+	}).Info("SCIM user status updated")
+	return http.StatusOK, nil
+}
+
+// checkManagedUser makes sure a role is a user the server may change: one marked as a
+// managed user in its comment, with the server's source or none. Group roles, roles created
+// outside of this tool and roles of another configuration are not found, so the identity
+// provider cannot lock or drop them.
+func (s *Server) checkManagedUser(username string) (int, error) {
+	kind, err := s.manager.ManagedKind(username)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if kind != database.ManagedKindUser {
+		return http.StatusNotFound, fmt.Errorf("user %s not found", username)
+	}
+	return http.StatusOK, nil
+}
+
+// checkManagedGroup makes sure a role is a group the server may change the members of or
+// drop, following the rules events use: reserved roles, login roles, roles with SUPERUSER or
+// CREATEROLE and roles neither named by a group mapping nor managed as a group are refused,
+// so the identity provider cannot hand out or remove their privileges.
+func (s *Server) checkManagedGroup(group string) (int, error) {
+	attributes, err := s.manager.GetRoleAttributes(group)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if attributes == nil {
+		return http.StatusNotFound, fmt.Errorf("group %s not found", group)
+	}
+	if reason := database.RefuseGroup(group, attributes, s.options.NamesRole(group)); reason != "" {
+		return http.StatusForbidden, refusedGroup(group, reason)
+	}
+	return http.StatusOK, nil
+}
+
+// refusedGroup is the error of a group the server may not change
+func refusedGroup(group, reason string) error {
+	return fmt.Errorf("group %s may not be changed: %s", group, reason)
+}
+
+// loadUser builds the SCIM resource for a user
+func (s *Server) loadUser(username string) (*scimUser, bool, error) {
+	exists, canLogin, err := s.manager.RoleCanLogin(username)
+	if err != nil || !exists {
+		return nil, false, err
+	}
+
+	groups, err := s.manager.GetRoleMemberships(username)
+	if err != nil {
+		return nil, false, err
+	}
+
+	user := &scimUser{
+		Schemas:  []string{scimUserSchema},
+		ID:       username,
+		UserName: username,
+		Active:   &canLogin,
+		Meta:     &scimMeta{ResourceType: "User", Location: scimBasePath + "/Users/" + username},
+	}
+	for _, group := range groups {
+		user.Groups = append(user.Groups, scimReference{Value: group, Display: group})
+	}
+
+	return user, true, nil
+}
+
+// loadGroup builds the SCIM resource for a group
+func (s *Server) loadGroup(name string) (*scimGroup, bool, error) {
+	exists, err := s.manager.GroupExists(name)
+	if err != nil || !exists {
+		return nil, false, err
+	}
+
+	members, err := s.manager.GetGroupMembers(name)
+	if err != nil {
+		return nil, false, err
+	}
+
+	group := &scimGroup{
+		Schemas:     []string{scimGroupSchema},
+		ID:          name,
+		DisplayName: name,
+		Meta:        &scimMeta{ResourceType: "Group", Location: scimBasePath + "/Groups/" + name},
+	}
+	for _, member := range members {
+		group.Members = append(group.Members, scimReference{Value: member, Display: member})
+	}
+
+	return group, true, nil
+}
+
+// writeUser writes the SCIM resource for a user, or a 404 when it does not exist
+func (s *Server) writeUser(w http.ResponseWriter, status int, username string) {
+	user, found, err := s.loadUser(username)
+	if err != nil {
+		s.writeInternalError(w, err)
+		return
+	}
+	if !found {
+		writeSCIMError(w, http.StatusNotFound, fmt.Sprintf("user %s not found", username))
+		return
+	}
+	writeJSON(w, status, scimContentType, user)
+}
+
+// writeGroup writes the SCIM resource for a group, or a 404 when it does not exist
+func (s *Server) writeGroup(w http.ResponseWriter, status int, name string) {
+	group, found, err := s.loadGroup(name)
+	if err != nil {
+		s.writeInternalError(w, err)
+		return
+	}
+	if !found {
+		writeSCIMError(w, http.StatusNotFound, fmt.Sprintf("group %s not found", name))
+		return
+	}
+	writeJSON(w, status, scimContentType, group)
+}
+
+// writeInternalError logs an error and writes a generic SCIM error response
+func (s *Server) writeInternalError(w http.ResponseWriter, err error) {
+	s.logger.WithError(err).Error("SCIM request failed")
+	writeSCIMError(w, http.StatusInternalServerError, "internal error")
+}
+
+// groupRole maps an identity provider group name to a database role
+func (s *Server) groupRole(displayName string) string {
+	if roles := s.options.MapGroups([]string{displayName}); len(roles) > 0 {
+		return roles[0]
+	}
+	return displayName
+}
+
+// writeSCIMList writes a SCIM list response
+func writeSCIMList(w http.ResponseWriter, resources []interface{}) {
+	writeJSON(w, http.StatusOK, scimContentType, scimListResponse{
+		Schemas:      []string{scimListSchema},
+		TotalResults: len(resources),
+		StartIndex:   1,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+// writeSCIMError writes a SCIM error response
+func writeSCIMError(w http.ResponseWriter, status int, detail string) {
+	writeJSON(w, status, scimContentType, map[string]interface{}{
+		"schemas": []string{scimErrorSchema},
+		"status":  strconv.Itoa(status),
+		"detail":  detail,
+	})
+}
+
+// parseSCIMFilter parses an attribute eq "value" filter; an empty filter returns no attribute
+func parseSCIMFilter(filter string) (string, string, error) {
+	if filter == "" {
+		return "", "", nil
+	}
+
+	match := scimFilterPattern.FindStringSubmatch(strings.TrimSpace(filter))
+	if match == nil {
+		return "", "", fmt.Errorf("unsupported filter %q (only attribute eq \"value\" is supported)", filter)
+	}
+
+	return match[1], unquoteSCIM(match[2]), nil
+}
+
+// patchActiveValue extracts the active flag from a user PATCH operation, if it sets one
+func patchActiveValue(op scimPatchOperation) (bool, bool, error) {
+	if !strings.EqualFold(op.Op, "replace") && !strings.EqualFold(op.Op, "add") {
+		return false, false, nil
+	}
+
+	var raw json.RawMessage
+	switch op.Path {
+	case "active":
+		raw = op.Value
+	case "":
+		var value map[string]json.RawMessage
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return false, false, fmt.Errorf("invalid patch value: %w", err)
+		}
+		var ok bool
+		if raw, ok = value["active"]; !ok {
+			return false, false, nil
+		}
+	default:
+		return false, false, nil
+	}
+
+	// Some identity providers send booleans as strings
+	var active bool
+	if err := json.Unmarshal(raw, &active); err != nil {
+		var text string
+		if err := json.Unmarshal(raw, &text); err != nil {
+			return false, false, fmt.Errorf("invalid active value: %s", string(raw))
+		}
+		if active, err = strconv.ParseBool(text); err != nil {
+			return false, false, fmt.Errorf("invalid active value: %s", text)
+		}
+	}
+
+	return active, true, nil
+}
+
+// unquoteSCIM removes backslash escapes from a SCIM filter string
+func unquoteSCIM(value string) string {
+	return strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(value)
+}
@@ -0,0 +1,276 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/database"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/database/fake"
+	"github.com/sirupsen/logrus"
+)
+
+func TestSCIMUserLifecycle(t *testing.T) {
+	manager, handler := newTestServer(t)
+
+	// Provision
+	rec := doRequest(t, handler, http.MethodPost, "/scim/v2/Users", `{"userName": "Alice@example.com", "active": true}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var user scimUser
+	if err := json.Unmarshal(rec.Body.Bytes(), &user); err != nil {
+		t.Fatalf("Failed to decode user: %v", err)
+	}
+	if user.ID != "alice" || user.Active == nil || !*user.Active {
+		t.Errorf("Expected active user alice, got %+v", user)
+	}
+
+	// Duplicate
+	rec = doRequest(t, handler, http.MethodPost, "/scim/v2/Users", `{"userName": "alice"}`)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for duplicate user, got %d", rec.Code)
+	}
+
+	// Look up by filter
+	rec = doRequest(t, handler, http.MethodGet, `/scim/v2/Users?filter=userName+eq+%22alice%40example.com%22`, "")
+	var list scimListResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Failed to decode list: %v", err)
+	}
+	if list.TotalResults != 1 {
+		t.Errorf("Expected 1 result, got %d", list.TotalResults)
+	}
+
+	// Deactivate
+	rec = doRequest(t, handler, http.MethodPatch, "/scim/v2/Users/alice",
+		`{"Operations": [{"op": "replace", "value": {"active": false}}]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if canLogin(manager, "alice") {
+		t.Error("Expected alice to be locked")
+	}
+
+	// Reactivate with a string value
+	rec = doRequest(t, handler, http.MethodPatch, "/scim/v2/Users/alice",
+		`{"Operations": [{"op": "Replace", "path": "active", "value": "True"}]}`)
+	if rec.Code != http.StatusOK || !canLogin(manager, "alice") {
+		t.Errorf("Expected alice to be unlocked, got %d", rec.Code)
+	}
+
+	// Deprovision
+	rec = doRequest(t, handler, http.MethodDelete, "/scim/v2/Users/alice", "")
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d", rec.Code)
+	}
+	if manager.Role("alice") != nil {
+		t.Error("Expected alice to be dropped")
+	}
+
+	rec = doRequest(t, handler, http.MethodGet, "/scim/v2/Users/alice", "")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 after deletion, got %d", rec.Code)
+	}
+}
+
+func TestSCIMDeleteProtectedUser(t *testing.T) {
+	manager, handler := newTestServer(t)
+	manager.AddRole(fake.Role{Name: "svc_billing", CanLogin: true, DeletionProtected: true, Managed: database.ManagedKindUser})
+
+	rec := doRequest(t, handler, http.MethodDelete, "/scim/v2/Users/svc_billing", "")
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for a protected user, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if manager.Role("svc_billing") == nil {
+		t.Error("Expected svc_billing to be kept")
+	}
+}
+
+func TestSCIMUnmanagedUser(t *testing.T) {
+	manager, handler := newTestServer(t)
+	manager.AddRole(fake.Role{Name: "app_owner", CanLogin: true})
+
+	rec := doRequest(t, handler, http.MethodPatch, "/scim/v2/Users/app_owner",
+		`{"Operations": [{"op": "replace", "value": {"active": false}}]}`)
+	if rec.Code != http.StatusNotFound || !canLogin(manager, "app_owner") {
+		t.Errorf("Expected 404 for an unmanaged user, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, handler, http.MethodDelete, "/scim/v2/Users/app_owner", "")
+	if rec.Code != http.StatusNotFound || manager.Role("app_owner") == nil {
+		t.Errorf("Expected 404 for an unmanaged user, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestSCIMUserEndpointsRejectGroups(t *testing.T) {
+	manager, handler := newTestServer(t)
+	doRequest(t, handler, http.MethodPost, "/scim/v2/Groups", `{"displayName": "analysts"}`)
+
+	rec := doRequest(t, handler, http.MethodPut, "/scim/v2/Users/analysts", `{"userName": "analysts", "active": true}`)
+	if rec.Code != http.StatusNotFound || canLogin(manager, "analysts") {
+		t.Errorf("Expected 404 for a group, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, handler, http.MethodDelete, "/scim/v2/Users/analysts", "")
+	if rec.Code != http.StatusNotFound || manager.Role("analysts") == nil {
+		t.Errorf("Expected 404 for a group, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestSCIMGroupMembership(t *testing.T) {
+	manager, handler := newTestServer(t)
+
+	for _, username := range []string{"alice", "bob", "carol"} {
+		doRequest(t, handler, http.MethodPost, "/scim/v2/Users", `{"userName": "`+username+`"}`)
+	}
+
+	rec := doRequest(t, handler, http.MethodPost, "/scim/v2/Groups",
+		`{"displayName": "analysts", "members": [{"value": "alice"}]}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, handler, http.MethodPatch, "/scim/v2/Groups/analysts",
+		`{"Operations": [{"op": "add", "path": "members", "value": [{"value": "bob"}]}]}`)
+	if rec.Code != http.StatusOK || !isMember(manager, "analysts", "bob") {
+		t.Errorf("Expected bob to be added, got %d", rec.Code)
+	}
+
+	rec = doRequest(t, handler, http.MethodPatch, "/scim/v2/Groups/analysts",
+		`{"Operations": [{"op": "remove", "path": "members[value eq \"alice\"]"}]}`)
+	if rec.Code != http.StatusOK || isMember(manager, "analysts", "alice") {
+		t.Errorf("Expected alice to be removed, got %d", rec.Code)
+	}
+
+	rec = doRequest(t, handler, http.MethodPut, "/scim/v2/Groups/analysts",
+		`{"displayName": "analysts", "members": [{"value": "carol"}]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+
+	var group scimGroup
+	if err := json.Unmarshal(rec.Body.Bytes(), &group); err != nil {
+		t.Fatalf("Failed to decode group: %v", err)
+	}
+	if len(group.Members) != 1 || group.Members[0].Value != "carol" {
+		t.Errorf("Expected only carol after replace, got %v", group.Members)
+	}
+
+	rec = doRequest(t, handler, http.MethodPatch, "/scim/v2/Groups/missing",
+		`{"Operations": [{"op": "add", "path": "members", "value": [{"value": "bob"}]}]}`)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for missing group, got %d", rec.Code)
+	}
+}
+
+func TestSCIMDeleteGroup(t *testing.T) {
+	manager, handler := newTestServer(t)
+	doRequest(t, handler, http.MethodPost, "/scim/v2/Groups", `{"displayName": "analysts"}`)
+	doRequest(t, handler, http.MethodPost, "/scim/v2/Groups", `{"displayName": "admins"}`)
+	manager.SetDeletionProtection("admins", true)
+
+	rec := doRequest(t, handler, http.MethodDelete, "/scim/v2/Groups/analysts", "")
+	if rec.Code != http.StatusNoContent || manager.Role("analysts") != nil {
+		t.Errorf("Expected analysts to be dropped, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, handler, http.MethodDelete, "/scim/v2/Groups/analysts", "")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 after deletion, got %d", rec.Code)
+	}
+
+	rec = doRequest(t, handler, http.MethodDelete, "/scim/v2/Groups/admins", "")
+	if rec.Code != http.StatusConflict || manager.Role("admins") == nil {
+		t.Errorf("Expected 409 for a protected group, got %d", rec.Code)
+	}
+}
+
+func TestSCIMGroupEndpointsRefuseUnsafeRoles(t *testing.T) {
+	roles := []fake.Role{
+		{Name: "pg_monitor"},
+		{Name: "alice", CanLogin: true, Managed: database.ManagedKindUser},
+		{Name: "admins", Superuser: true, Managed: database.ManagedKindGroup},
+		{Name: "creators", CreateRole: true, Managed: database.ManagedKindGroup},
+		{Name: "legacy"},
+	}
+	requests := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{http.MethodPost, "/scim/v2/Groups", `{"displayName": "{role}", "members": [{"value": "bob"}]}`},
+		{http.MethodPut, "/scim/v2/Groups/{role}", `{"members": [{"value": "bob"}]}`},
+		{http.MethodPatch, "/scim/v2/Groups/{role}", `{"Operations": [{"op": "add", "path": "members", "value": [{"value": "bob"}]}]}`},
+		{http.MethodPatch, "/scim/v2/Groups/{role}", `{"Operations": [{"op": "replace", "path": "members", "value": [{"value": "bob"}]}]}`},
+		{http.MethodDelete, "/scim/v2/Groups/{role}", ""},
+	}
+
+	for _, role := range roles {
+		for _, request := range requests {
+			t.Run(request.method+" "+role.Name, func(t *testing.T) {
+				manager, handler := newTestServer(t)
+				manager.AddRole(role)
+				doRequest(t, handler, http.MethodPost, "/scim/v2/Users", `{"userName": "bob"}`)
+
+				path := strings.ReplaceAll(request.path, "{role}", role.Name)
+				body := strings.ReplaceAll(request.body, "{role}", role.Name)
+				rec := doRequest(t, handler, request.method, path, body)
+				if rec.Code != http.StatusForbidden {
+					t.Errorf("Expected 403, got %d: %s", rec.Code, rec.Body.String())
+				}
+				if manager.Role(role.Name) == nil || isMember(manager, role.Name, "bob") {
+					t.Errorf("Expected %s to be left unchanged", role.Name)
+				}
+			})
+		}
+	}
+}
+
+func TestSCIMCreateGroupRefusesReservedName(t *testing.T) {
+	manager, handler := newTestServer(t)
+
+	rec := doRequest(t, handler, http.MethodPost, "/scim/v2/Groups", `{"displayName": "rds_superuser_copy"}`)
+	if rec.Code != http.StatusForbidden || manager.Role("rds_superuser_copy") != nil {
+		t.Errorf("Expected 403 for a reserved name, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestSCIMChangesMappedGroup(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	manager := fake.NewManager()
+	manager.AddRole(fake.Role{Name: "app_group"})
+	srv, err := NewServer(manager, logger, Options{
+		Token:     testToken,
+		NamesRole: func(role string) bool { return role == "app_group" },
+	})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	handler := srv.Handler()
+	doRequest(t, handler, http.MethodPost, "/scim/v2/Users", `{"userName": "bob"}`)
+
+	rec := doRequest(t, handler, http.MethodPatch, "/scim/v2/Groups/app_group",
+		`{"Operations": [{"op": "add", "path": "members", "value": [{"value": "bob"}]}]}`)
+	if rec.Code != http.StatusOK || !isMember(manager, "app_group", "bob") {
+		t.Errorf("Expected bob to be added to a mapped group, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestParseSCIMFilter(t *testing.T) {
+	attribute, value, err := parseSCIMFilter(`userName eq "o\"brien"`)
+	if err != nil {
+		t.Fatalf("Failed to parse filter: %v", err)
+	}
+	if attribute != "userName" || value != `o"brien` {
+		t.Errorf("Unexpected filter parse: %s %s", attribute, value)
+	}
+
+	if _, _, err := parseSCIMFilter(`userName sw "a"`); err == nil {
+		t.Error("Expected error for unsupported operator")
+	}
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// shutdownTimeout bounds how long in-flight requests may run after a shutdown signal
+	shutdownTimeout = 10 * time.Second
+)
+
+// RoleManager is the subset of the database manager the server translates requests into
+type RoleManager interface {
+	CreateUser(user *structs.UserConfig) error
+	DropUser(username string) error
+	DisableUser(username string) (bool, error)
+	EnableUser(username string) (bool, error)
+	RoleCanLogin(name string) (bool, bool, error)
+	ManagedKind(role string) (string, error)
+	GetRoleAttributes(role string) (*structs.RoleAttributes, error)
+	GetRoleMemberships(role string) ([]string, error)
+	CreateGroup(group *structs.GroupConfig) error
+	GroupExists(groupName string) (bool, error)
+	DropGroup(groupName string) error
+	GetGroupMembers(group string) ([]string, error)
+	AddUserToGroup(username, groupName string) error
+	RemoveUserFromGroup(username, groupName string) error
+	Ping() error
+}
+
+// Options configures the server
+type Options struct {
+	Token           string                  // Bearer token with access to every role
+	DelegatedTokens []DelegatedToken        // Tokens limited to the roles matching their patterns
+	AuthMethod      string                  // Auth method for users provisioned over SCIM (default: iam)
+	MapGroups       func([]string) []string // Maps identity provider group names to database roles
+	NamesRole       func(string) bool       // Reports whether a group mapping names a database role
+	Events          EventApplier            // Applies payloads posted to /events, nil to disable the endpoint
+	EventSecret     string                  // Secret of HMAC-SHA256 signatures accepted on /events
+}
+
+// Server exposes role management over HTTP
+type Server struct {
+	manager RoleManager
+	logger  *logrus.Logger
+	options Options
+	mux     *http.ServeMux
+}
+
+// NewServer creates a new server backed by a role manager
+func NewServer(manager RoleManager, logger *logrus.Logger, options Options) (*Server, error) {
+	if options.Token == "" && len(options.DelegatedTokens) == 0 && options.EventSecret == "" {
+		return nil, errors.New("an API token is required")
+	}
+	for _, token := range options.DelegatedTokens {
+		if err := token.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if options.AuthMethod == "" {
+		options.AuthMethod = structs.AuthMethodIAM
+	}
+	if options.MapGroups == nil {
+		options.MapGroups = func(groups []string) []string { return groups }
+	}
+	if options.NamesRole == nil {
+		options.NamesRole = func(string) bool { return false }
+	}
+
+	s := &Server{
+		manager: manager,
+		logger:  logger,
+		options: options,
+		mux:     http.NewServeMux(),
+	}
+	s.registerSCIMRoutes()
+
+	return s, nil
+}
+
+// Handler returns the HTTP handler: health checks are open, events authenticate themselves
+// and every other route is behind token authentication
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", s.handleHealth)
+	mux.HandleFunc("GET /readyz", s.handleReady)
+	if s.options.Events != nil {
+		mux.HandleFunc("POST "+eventsPath, s.handleEvent)
+	}
+	mux.Handle("/", s.authenticate(s.mux))
+	return mux
+}
+
+// ListenAndServe serves requests on addr until the context is cancelled
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	httpServer := &http.Server{
+		Addr:              addr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		s.logger.WithField("addr", addr).Info("Server listening")
+		errCh <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		s.logger.Info("Shutting down server")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		return httpServer.Shutdown(shutdownCtx)
+	}
+}
+
+// authenticate rejects requests that do not carry a known bearer token and records the
+// caller the token belongs to
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		c := s.identify(token)
+		if c == nil {
+			s.logger.WithFields(logrus.Fields{
+				"method": r.Method,
+				"path":   r.URL.Path,
+				"remote": r.RemoteAddr,
+			}).Warn("Rejected unauthenticated request")
+			writeSCIMError(w, http.StatusUnauthorized, "invalid or missing bearer token")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), callerKey{}, c)))
+	})
+}
+
+// authorize reports whether the caller of a request may manage a role, writing a 403
+// response when it may not
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, role string) bool {
+	c := callerFrom(r.Context())
+	if c.allows(role) {
+		return true
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"subject": c.subject,
+		"role":    role,
+		"method":  r.Method,
+		"path":    r.URL.Path,
+	}).Warn("Rejected request outside the token's roles")
+	writeSCIMError(w, http.StatusForbidden, c.forbidden(role).Error())
+	return false
+}
+
+// scoped wraps a handler of a /{id} route so it only runs for roles the caller may manage
+func (s *Server) scoped(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.authorize(w, r, r.PathValue("id")) {
+			next(w, r)
+		}
+	}
+}
+
+// writeJSON writes a JSON response with the given status
+func writeJSON(w http.ResponseWriter, status int, contentType string, body interface{}) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/database/fake"
+	"github.com/sirupsen/logrus"
+)
+
+const testToken = "test-token"
+
+// canLogin reports whether a role of the fake catalog exists and can log in
+func canLogin(manager *fake.Manager, name string) bool {
+	role := manager.Role(name)
+	return role != nil && role.CanLogin
+}
+
+// isMember reports whether a role is a direct member of a group of the fake catalog
+func isMember(manager *fake.Manager, group, member string) bool {
+	members, _ := manager.GetGroupMembers(group)
+	return slices.Contains(members, member)
+}
+
+func newTestServer(t *testing.T) (*fake.Manager, http.Handler) {
+	t.Helper()
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	manager := fake.NewManager()
+	srv, err := NewServer(manager, logger, Options{Token: testToken})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	return manager, srv.Handler()
+}
+
+func doRequest(t *testing.T, handler http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestNewServerRequiresToken(t *testing.T) {
+	if _, err := NewServer(fake.NewManager(), logrus.New(), Options{}); err == nil {
+		t.Error("Expected error without token")
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	_, handler := newTestServer(t)
+
+	for _, authorization := range []string{"", "Bearer wrong-token"} {
+		req := httptest.NewRequest(http.MethodGet, "/scim/v2/Users", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("Expected 401 for %q, got %d", authorization, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DelegatedToken is an API token limited to the roles whose names match its patterns, so a
+// team can manage its own roles through the API without access to everyone else's
+type DelegatedToken struct {
+	Subject     string   `json:"subject" yaml:"subject"`           // Name the token's requests are logged under
+	TokenSHA256 string   `json:"token_sha256" yaml:"token_sha256"` // Hex SHA-256 digest of the token
+	Roles       []string `json:"roles" yaml:"roles"`               // Role name patterns, e.g. svc_team_a_*
+}
+
+// tokensFile is the layout of a delegated tokens file
+type tokensFile struct {
+	Tokens []DelegatedToken `json:"tokens" yaml:"tokens"`
+}
+
+// LoadTokens reads delegated tokens from a YAML or JSON file. The file holds token digests
+// rather than tokens, so it can be kept alongside the configuration.
+func LoadTokens(filename string) ([]DelegatedToken, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tokens file: %w", err)
+	}
+
+	var file tokensFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse tokens file: %w", err)
+	}
+
+	for _, token := range file.Tokens {
+		if err := token.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return file.Tokens, nil
+}
+
+// validate checks that a delegated token has a subject, a SHA-256 digest and valid patterns
+func (t DelegatedToken) validate() error {
+	if t.Subject == "" {
+		return fmt.Errorf("delegated token without a subject")
+	}
+	if digest, err := hex.DecodeString(t.TokenSHA256); err != nil || len(digest) != sha256.Size {
+		return fmt.Errorf("delegated token %s: token_sha256 must be a hex SHA-256 digest", t.Subject)
+	}
+	if len(t.Roles) == 0 {
+		return fmt.Errorf("delegated token %s: no role patterns", t.Subject)
+	}
+	for _, pattern := range t.Roles {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("delegated token %s: invalid role pattern %q: %w", t.Subject, pattern, err)
+		}
+	}
+	return nil
+}
+
+// caller is the authenticated client of a request
+type caller struct {
+	subject string
+	roles   []string // Role name patterns the caller may manage, nil for every role
+}
+
+// allows reports whether the caller may manage a role
+func (c *caller) allows(role string) bool {
+	if c == nil || c.roles == nil {
+		return true
+	}
+	for _, pattern := range c.roles {
+		if matched, _ := path.Match(pattern, role); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// forbidden returns the error for a role the caller may not manage
+func (c *caller) forbidden(role string) error {
+	return fmt.Errorf("token %s may not manage role %s", c.subject, role)
+}
+
+// callerKey is the request context key of the caller
+type callerKey struct{}
+
+// callerFrom returns the caller of a request
+func callerFrom(ctx context.Context) *caller {
+	c, _ := ctx.Value(callerKey{}).(*caller)
+	return c
+}
+
+// identify returns the caller presenting a bearer token, or nil when the token is unknown
+func (s *Server) identify(token string) *caller {
+	if token == "" {
+		return nil
+	}
+	if s.options.Token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.options.Token)) == 1 {
+		return &caller{subject: "admin"}
+	}
+
+	sum := sha256.Sum256([]byte(token))
+	presented := hex.EncodeToString(sum[:])
+	for _, delegated := range s.options.DelegatedTokens {
+		if subtle.ConstantTimeCompare([]byte(presented), []byte(strings.ToLower(delegated.TokenSHA256))) == 1 {
+			return &caller{subject: delegated.Subject, roles: delegated.Roles}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/database/fake"
+	"github.com/sirupsen/logrus"
+)
+
+const teamToken = "team-a-token"
+
+func tokenDigest(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newDelegatedTestServer(t *testing.T) (*fake.Manager, http.Handler) {
+	t.Helper()
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	manager := fake.NewManager()
+	srv, err := NewServer(manager, logger, Options{
+		Token: testToken,
+		DelegatedTokens: []DelegatedToken{
+			{Subject: "team-a", TokenSHA256: tokenDigest(teamToken), Roles: []string{"svc_team_a_*"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	return manager, srv.Handler()
+}
+
+func doTeamRequest(t *testing.T, handler http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+teamToken)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestDelegatedTokenScope(t *testing.T) {
+	manager, handler := newDelegatedTestServer(t)
+
+	rec := doTeamRequest(t, handler, http.MethodPost, "/scim/v2/Users", `{"userName": "svc_team_a_etl"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 for a role in scope, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doTeamRequest(t, handler, http.MethodPost, "/scim/v2/Users", `{"userName": "svc_team_b_etl"}`)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a role out of scope, got %d", rec.Code)
+	}
+	if manager.Role("svc_team_b_etl") != nil {
+		t.Error("Expected the out of scope user not to be created")
+	}
+
+	// The admin token manages every role
+	doRequest(t, handler, http.MethodPost, "/scim/v2/Users", `{"userName": "alice"}`)
+	for _, request := range []struct{ method, path string }{
+		{http.MethodGet, "/scim/v2/Users/alice"},
+		{http.MethodDelete, "/scim/v2/Users/alice"},
+		{http.MethodPatch, "/scim/v2/Users/alice"},
+	} {
+		rec = doTeamRequest(t, handler, request.method, request.path, `{"Operations": []}`)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("Expected 403 for %s %s, got %d", request.method, request.path, rec.Code)
+		}
+	}
+	if manager.Role("alice") == nil {
+		t.Error("Expected alice not to be dropped by the team token")
+	}
+
+	rec = doTeamRequest(t, handler, http.MethodGet, `/scim/v2/Users?filter=userName%20eq%20%22alice%22`, "")
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "alice") {
+		t.Errorf("Expected lookups out of scope to find nothing, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestDelegatedTokenMemberships(t *testing.T) {
+	manager, handler := newDelegatedTestServer(t)
+
+	doRequest(t, handler, http.MethodPost, "/scim/v2/Users", `{"userName": "alice"}`)
+	doRequest(t, handler, http.MethodPost, "/scim/v2/Users", `{"userName": "svc_team_a_etl"}`)
+	doRequest(t, handler, http.MethodPost, "/scim/v2/Users", `{"userName": "svc_team_a_api"}`)
+
+	rec := doTeamRequest(t, handler, http.MethodPost, "/scim/v2/Groups",
+		`{"displayName": "svc_team_a_readers", "members": [{"value": "alice"}]}`)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a member out of scope, got %d", rec.Code)
+	}
+
+	rec = doTeamRequest(t, handler, http.MethodPost, "/scim/v2/Groups",
+		`{"displayName": "svc_team_a_readers", "members": [{"value": "svc_team_a_etl"}]}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// The admin token adds a member the team token may not manage
+	doRequest(t, handler, http.MethodPatch, "/scim/v2/Groups/svc_team_a_readers",
+		`{"Operations": [{"op": "add", "path": "members", "value": [{"value": "alice"}]}]}`)
+
+	rec = doTeamRequest(t, handler, http.MethodPatch, "/scim/v2/Groups/svc_team_a_readers",
+		`{"Operations": [{"op": "remove", "path": "members[value eq \"alice\"]"}]}`)
+	if rec.Code != http.StatusForbidden || !isMember(manager, "svc_team_a_readers", "alice") {
+		t.Errorf("Expected removing alice to be forbidden, got %d", rec.Code)
+	}
+
+	// Replacing the members leaves members out of scope in place
+	rec = doTeamRequest(t, handler, http.MethodPut, "/scim/v2/Groups/svc_team_a_readers",
+		`{"displayName": "svc_team_a_readers", "members": [{"value": "svc_team_a_api"}]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	members, _ := manager.GetGroupMembers("svc_team_a_readers")
+	if !slices.Equal(members, []string{"alice", "svc_team_a_api"}) {
+		t.Errorf("Expected alice and svc_team_a_api, got %v", members)
+	}
+}
+
+func TestLoadTokens(t *testing.T) {
+	dir := t.TempDir()
+
+	valid := filepath.Join(dir, "tokens.yaml")
+	content := "tokens:\n  - subject: team-a\n    token_sha256: " + tokenDigest(teamToken) + "\n    roles: [\"svc_team_a_*\"]\n"
+	if err := os.WriteFile(valid, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write tokens file: %v", err)
+	}
+	tokens, err := LoadTokens(valid)
+	if err != nil {
+		t.Fatalf("LoadTokens failed: %v", err)
+	}
+	if len(tokens) != 1 || tokens[0].Subject != "team-a" || tokens[0].Roles[0] != "svc_team_a_*" {
+		t.Errorf("Unexpected tokens %+v", tokens)
+	}
+
+	for name, content := range map[string]string{
+		"plain token": `{"tokens": [{"subject": "team-a", "token_sha256": "team-a-token", "roles": ["svc_*"]}]}`,
+		"no roles":    `{"tokens": [{"subject": "team-a", "token_sha256": "` + tokenDigest(teamToken) + `"}]}`,
+		"bad pattern": `{"tokens": [{"subject": "team-a", "token_sha256": "` + tokenDigest(teamToken) + `", "roles": ["svc_["]}]}`,
+	} {
+		invalid := filepath.Join(dir, "invalid.json")
+		if err := os.WriteFile(invalid, []byte(content), 0o600); err != nil {
+			t.Fatalf("Failed to write tokens file: %v", err)
+		}
+		if _, err := LoadTokens(invalid); err == nil {
+			t.Errorf("Expected %s to be rejected", name)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package sources
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+// managedKindUser is the kind this tool records in the comment of the users it manages
+const managedKindUser = "user"
+
+// clusterMetadata is what this tool recorded about a role it manages, and the grants that
+// only a live cluster shows. Roles read from dumps leave it empty.
+type clusterMetadata struct {
+	kind             string
+	owner            string
+	team             string
+	ticket           string
+	externalID       string
+	authMethods      []string
+	protected        bool
+	extensionSchemas []structs.ExtensionSchemaGrant
+}
+
+// ExportClusterRoles creates a configuration from the roles of a live cluster, mapping them
+// as ParseRoleDump maps the roles of a dump. Users this tool disabled are exported as
+// disabled users, and the description, ownership, auth methods and deletion protection it
+// recorded are carried over. Grants on schemas an extension is installed in become
+// extension_schemas; grants on other schemas cannot be configured and are reported.
+func ExportClusterRoles(roles []structs.ClusterRole, exclude []string) *RoleDump {
+	p := &roleDumpParser{
+		roles:   make(map[string]*dumpRole),
+		grants:  make(map[string]map[string][]string),
+		skipped: make(map[string]int),
+	}
+	excluded := make(map[string]bool, len(exclude))
+	for _, name := range exclude {
+		excluded[name] = true
+	}
+
+	for _, clusterRole := range roles {
+		role := p.role(clusterRole.Name)
+		role.login = clusterRole.CanLogin
+		role.inherit = clusterRole.Inherit
+		role.superuser = clusterRole.Superuser
+		role.connectionLimit = clusterRole.ConnectionLimit
+		role.validUntil = clusterRole.ValidUntil
+		role.comment = clusterRole.Description
+		role.attributes = clusterRole.Attributes
+		role.managed = clusterMetadata{
+			kind:        clusterRole.Kind,
+			owner:       clusterRole.Owner,
+			team:        clusterRole.Team,
+			ticket:      clusterRole.Ticket,
+			externalID:  clusterRole.ExternalID,
+			authMethods: clusterRole.AuthMethods,
+			protected:   clusterRole.DeletionProtection,
+		}
+
+		for _, group := range clusterRole.MemberOf {
+			p.memberships = append(p.memberships, dumpMembership{member: clusterRole.Name, group: group})
+		}
+		for _, grant := range clusterRole.Grants {
+			if p.grants[clusterRole.Name] == nil {
+				p.grants[clusterRole.Name] = make(map[string][]string)
+			}
+			databaseGrants := p.grants[clusterRole.Name]
+			for _, privilege := range databasePrivileges([]string{grant.Privilege}) {
+				databaseGrants[grant.Database] = appendUnique(databaseGrants[grant.Database], privilege)
+			}
+		}
+		// Roles that are left out need no warnings about their schema grants
+		if !excluded[clusterRole.Name] && !clusterRole.Superuser && !strings.HasPrefix(clusterRole.Name, "pg_") {
+			role.managed.extensionSchemas = p.extensionSchemas(clusterRole)
+		}
+	}
+
+	return p.config(exclude)
+}
+
+// extensionSchemas returns the schema grants of a role as grants on extension schemas, one
+// per schema, and warns about grants on schemas no extension is installed in
+func (p *roleDumpParser) extensionSchemas(role structs.ClusterRole) []structs.ExtensionSchemaGrant {
+	var grants []structs.ExtensionSchemaGrant
+	bySchema := make(map[string]int)
+	for _, grant := range role.SchemaGrants {
+		if grant.Extension == "" {
+			p.warnings = append(p.warnings, fmt.Sprintf("role %s: %s on schema %s cannot be configured, left out; grant it with the grant command", role.Name, grant.Privilege, grant.Schema))
+			continue
+		}
+		i, ok := bySchema[grant.Schema]
+		if !ok {
+			i = len(grants)
+			bySchema[grant.Schema] = i
+			grants = append(grants, structs.ExtensionSchemaGrant{Extension: grant.Extension, Schema: grant.Schema})
+		}
+		grants[i].Privileges = appendUnique(grants[i].Privileges, grant.Privilege)
+	}
+	for i := range grants {
+		sort.Strings(grants[i].Privileges)
+	}
+	return grants
+}
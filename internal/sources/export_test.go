@@ -0,0 +1,73 @@
+package sources
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+func TestExportClusterRoles(t *testing.T) {
+	roles := []structs.ClusterRole{
+		{Name: "admin", CanLogin: true, Inherit: true, Superuser: true, ConnectionLimit: -1},
+		{
+			Name: "analytics", Kind: "group", Inherit: true, ConnectionLimit: -1, Team: "data",
+			Grants: []structs.PrivilegeGrant{{Target: "analytics", Privilege: "CONNECT", Database: "app"}},
+			SchemaGrants: []structs.SchemaPrivilege{
+				{Schema: "cron", Privilege: "USAGE", Extension: "pg_cron"},
+				{Schema: "reporting", Privilege: "USAGE"},
+			},
+		},
+		{
+			Name: "app_user", Kind: "user", CanLogin: true, Inherit: true, ConnectionLimit: 5,
+			Description: "Application", AuthMethods: []string{"iam", "password"}, DeletionProtection: true,
+			MemberOf: []string{"analytics", "rds_iam"},
+			Grants: []structs.PrivilegeGrant{
+				{Target: "app_user", Privilege: "CONNECT", Database: "app"},
+				{Target: "app_user", Privilege: "TEMPORARY", Database: "app"},
+			},
+		},
+		{Name: "iam_user", CanLogin: true, Inherit: true, ConnectionLimit: -1, MemberOf: []string{"rds_iam"}},
+		{Name: "old_user", Kind: "user", Inherit: true, ConnectionLimit: -1, ExternalID: "00u1"},
+		{Name: "rds_iam", Inherit: true, ConnectionLimit: -1},
+	}
+
+	export := ExportClusterRoles(roles, []string{"rds_iam"})
+
+	expectedUsers := []structs.UserConfig{
+		{
+			Username: "app_user", Groups: []string{"analytics"}, Privileges: []string{"CONNECT", "TEMPORARY"}, Databases: []string{"app"},
+			Enabled: true, DeletionProtection: true, Description: "Application", AuthMethods: []string{"iam", "password"},
+			CanLogin: true, ConnectionLimit: 5,
+		},
+		{Username: "iam_user", Groups: []string{}, Privileges: []string{}, Databases: []string{}, Enabled: true, AuthMethod: structs.AuthMethodIAM, CanLogin: true},
+		{Username: "old_user", Groups: []string{}, Privileges: []string{}, Databases: []string{}, Enabled: false, ExternalID: "00u1", CanLogin: true},
+	}
+	if !reflect.DeepEqual(export.Config.Users, expectedUsers) {
+		t.Errorf("Unexpected users:\n%+v\nexpected:\n%+v", export.Config.Users, expectedUsers)
+	}
+
+	expectedGroups := []structs.GroupConfig{
+		{
+			Name: "analytics", Privileges: []string{"CONNECT"}, Databases: []string{"app"}, Inherit: true, Team: "data",
+			ExtensionSchemas: []structs.ExtensionSchemaGrant{{Extension: "pg_cron", Schema: "cron", Privileges: []string{"USAGE"}}},
+		},
+	}
+	if !reflect.DeepEqual(export.Config.Groups, expectedGroups) {
+		t.Errorf("Unexpected groups:\n%+v\nexpected:\n%+v", export.Config.Groups, expectedGroups)
+	}
+
+	warnings := strings.Join(export.Warnings, "\n")
+	for _, expected := range []string{
+		"role admin: superusers are not managed",
+		"role analytics: USAGE on schema reporting cannot be configured",
+	} {
+		if !strings.Contains(warnings, expected) {
+			t.Errorf("Expected a warning containing %q, got:\n%s", expected, warnings)
+		}
+	}
+	if strings.Contains(warnings, "rds_iam") {
+		t.Errorf("Expected no warnings about rds_iam, got:\n%s", warnings)
+	}
+}
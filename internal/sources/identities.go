@@ -0,0 +1,146 @@
+package sources
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
+)
+
+const (
+	// CognitoSourceName identifies a Cognito user pool as an identity source
+	CognitoSourceName = "cognito"
+
+	// scimPageSize is how many users are requested per SCIM page
+	scimPageSize = 100
+)
+
+// IdentitySource lists the identities of an identity provider, to find database users whose
+// identity is gone
+type IdentitySource interface {
+	// Name returns the source name
+	Name() string
+	// ActiveIdentities returns the IDs of the identities that may still have access, as
+	// recorded on users created from identity provider events
+	ActiveIdentities(ctx context.Context) (map[string]bool, error)
+}
+
+// cognitoAPI is the subset of the Cognito user pool client used to list users
+type cognitoAPI interface {
+	ListUsers(ctx context.Context, params *cognitoidentityprovider.ListUsersInput, optFns ...func(*cognitoidentityprovider.Options)) (*cognitoidentityprovider.ListUsersOutput, error)
+}
+
+// CognitoSource lists the users of a Cognito user pool
+type CognitoSource struct {
+	userPoolID string
+	client     cognitoAPI
+}
+
+// NewCognitoSource creates a new Cognito user pool source using the given AWS configuration
+func NewCognitoSource(userPoolID string, awsConfig aws.Config) (*CognitoSource, error) {
+	if userPoolID == "" {
+		return nil, fmt.Errorf("Cognito user pool ID is required")
+	}
+	return &CognitoSource{userPoolID: userPoolID, client: cognitoidentityprovider.NewFromConfig(awsConfig)}, nil
+}
+
+// Name implements IdentitySource
+func (s *CognitoSource) Name() string {
+	return CognitoSourceName
+}
+
+// ActiveIdentities implements IdentitySource, returning the sub of every enabled user
+func (s *CognitoSource) ActiveIdentities(ctx context.Context) (map[string]bool, error) {
+	active := make(map[string]bool)
+	var paginationToken *string
+
+	for {
+		output, err := s.client.ListUsers(ctx, &cognitoidentityprovider.ListUsersInput{
+			UserPoolId:      aws.String(s.userPoolID),
+			AttributesToGet: []string{"sub"},
+			PaginationToken: paginationToken,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list users of user pool %s: %w", s.userPoolID, err)
+		}
+
+		for _, user := range output.Users {
+			// Disabled users cannot sign in, so they lose database access too
+			if !user.Enabled {
+				continue
+			}
+			for _, attribute := range user.Attributes {
+				if aws.ToString(attribute.Name) == "sub" {
+					active[aws.ToString(attribute.Value)] = true
+				}
+			}
+		}
+
+		if aws.ToString(output.PaginationToken) == "" {
+			return active, nil
+		}
+		paginationToken = output.PaginationToken
+	}
+}
+
+// ActiveIdentities implements IdentitySource, returning the ID of every user that is not
+// suspended or deactivated
+func (s *OktaSource) ActiveIdentities(ctx context.Context) (map[string]bool, error) {
+	active := make(map[string]bool)
+
+	next := s.config.URL + "/api/v1/users?limit=200"
+	for next != "" {
+		var users []struct {
+			ID     string `json:"id"`
+			Status string `json:"status"`
+		}
+
+		var err error
+		if next, err = s.get(ctx, next, &users); err != nil {
+			return nil, err
+		}
+
+		for _, user := range users {
+			if user.Status == "ACTIVE" || user.Status == "PASSWORD_EXPIRED" || user.Status == "LOCKED_OUT" {
+				active[user.ID] = true
+			}
+		}
+	}
+
+	return active, nil
+}
+
+// ActiveIdentities implements IdentitySource, returning the ID of every active user
+func (s *SCIMSource) ActiveIdentities(ctx context.Context) (map[string]bool, error) {
+	active := make(map[string]bool)
+
+	for startIndex := 1; ; {
+		var page struct {
+			TotalResults int `json:"totalResults"`
+			Resources    []struct {
+				ID     string `json:"id"`
+				Active *bool  `json:"active"`
+			} `json:"Resources"`
+		}
+
+		query := url.Values{"startIndex": {strconv.Itoa(startIndex)}, "count": {strconv.Itoa(scimPageSize)}}
+		if _, err := getJSON(ctx, s.client, s.config.URL+"/Users?"+query.Encode(), "Bearer "+s.config.Token, &page); err != nil {
+			return nil, err
+		}
+
+		for _, user := range page.Resources {
+			if user.Active == nil || *user.Active {
+				active[user.ID] = true
+			}
+		}
+
+		// SCIM pages are 1-based; an empty page also ends the listing
+		startIndex += len(page.Resources)
+		if len(page.Resources) == 0 || startIndex > page.TotalResults {
+			return active, nil
+		}
+	}
+}
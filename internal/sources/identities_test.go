@@ -0,0 +1,124 @@
+package sources
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
+	cognitotypes "github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
+)
+
+type fakeCognito struct{}
+
+func (f *fakeCognito) ListUsers(ctx context.Context, params *cognitoidentityprovider.ListUsersInput, optFns ...func(*cognitoidentityprovider.Options)) (*cognitoidentityprovider.ListUsersOutput, error) {
+	user := func(sub string, enabled bool) cognitotypes.UserType {
+		return cognitotypes.UserType{
+			Enabled:    enabled,
+			Attributes: []cognitotypes.AttributeType{{Name: aws.String("sub"), Value: aws.String(sub)}},
+		}
+	}
+
+	if aws.ToString(params.PaginationToken) == "" {
+		return &cognitoidentityprovider.ListUsersOutput{
+			Users:           []cognitotypes.UserType{user("sub-alice", true), user("sub-bob", false)},
+			PaginationToken: aws.String("page2"),
+		}, nil
+	}
+	return &cognitoidentityprovider.ListUsersOutput{
+		Users: []cognitotypes.UserType{user("sub-carol", true)},
+	}, nil
+}
+
+func TestCognitoSourceActiveIdentities(t *testing.T) {
+	if _, err := NewCognitoSource("", aws.Config{}); err == nil {
+		t.Error("Expected error without a user pool ID")
+	}
+
+	source := &CognitoSource{userPoolID: "eu-west-1_abc", client: &fakeCognito{}}
+	active, err := source.ActiveIdentities(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to list identities: %v", err)
+	}
+	if len(active) != 2 || !active["sub-alice"] || !active["sub-carol"] {
+		t.Errorf("Expected enabled users across pages, got %v", active)
+	}
+}
+
+func TestOktaSourceActiveIdentities(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "SSWS test-token" || r.URL.Path != "/api/v1/users" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if r.URL.Query().Get("after") == "" {
+			w.Header().Set("Link", `<`+server.URL+`/api/v1/users?limit=200&after=u2>; rel="next"`)
+			json.NewEncoder(w).Encode([]map[string]string{
+				{"id": "u1", "status": "ACTIVE"},
+				{"id": "u2", "status": "DEPROVISIONED"},
+			})
+			return
+		}
+		json.NewEncoder(w).Encode([]map[string]string{{"id": "u3", "status": "LOCKED_OUT"}})
+	}))
+	defer server.Close()
+
+	source, err := NewOktaSource(IdPConfig{URL: server.URL, Token: "test-token"})
+	if err != nil {
+		t.Fatalf("Failed to create Okta source: %v", err)
+	}
+
+	active, err := source.ActiveIdentities(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to list identities: %v", err)
+	}
+	if len(active) != 2 || !active["u1"] || !active["u3"] {
+		t.Errorf("Expected active users across pages, got %v", active)
+	}
+}
+
+func TestSCIMSourceActiveIdentities(t *testing.T) {
+	users := []map[string]interface{}{
+		{"id": "1", "active": true},
+		{"id": "2", "active": false},
+		{"id": "3"},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" || r.URL.Path != "/Users" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		// Serve two users per page, whatever count was asked for
+		start, _ := strconv.Atoi(r.URL.Query().Get("startIndex"))
+		end := start + 1
+		if end > len(users) {
+			end = len(users)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"totalResults": len(users),
+			"Resources":    users[start-1 : end],
+		})
+	}))
+	defer server.Close()
+
+	source, err := NewSCIMSource(IdPConfig{URL: server.URL, Token: "test-token"})
+	if err != nil {
+		t.Fatalf("Failed to create SCIM source: %v", err)
+	}
+
+	active, err := source.ActiveIdentities(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to list identities: %v", err)
+	}
+	if len(active) != 2 || !active["1"] || !active["3"] {
+		t.Errorf("Expected active users across pages, got %v", active)
+	}
+}
@@ -0,0 +1,276 @@
+package sources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// OktaSourceName identifies users imported from Okta in the config
+	OktaSourceName = "okta"
+	// SCIMSourceName identifies users imported from a SCIM 2.0 identity provider in the config
+	SCIMSourceName = "scim"
+
+	// idpRequestTimeout bounds each request to the identity provider
+	idpRequestTimeout = 30 * time.Second
+)
+
+// GroupSource reads the members of identity provider groups
+type GroupSource interface {
+	// Name returns the source name recorded on imported users
+	Name() string
+	// GroupMembers returns the login names of the members of a group
+	GroupMembers(ctx context.Context, group string) ([]string, error)
+}
+
+// IdPConfig configures an identity provider API
+type IdPConfig struct {
+	URL   string // Okta org URL or SCIM base URL
+	Token string // API token
+}
+
+// FetchGroupUsers reads the members of the given identity provider groups and maps each
+// group to database roles with the mapper, returning one entry per user
+func FetchGroupUsers(ctx context.Context, source GroupSource, groups []string, mapper func([]string) []string, logger *logrus.Logger) ([]DirectoryUser, error) {
+	byUsername := make(map[string]*DirectoryUser)
+
+	sortedGroups := sortedUnique(groups)
+	for _, group := range sortedGroups {
+		members, err := source.GroupMembers(ctx, group)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read members of %s group %s: %w", source.Name(), group, err)
+		}
+
+		roles := mapper([]string{group})
+
+		logger.WithFields(logrus.Fields{
+			"source":  source.Name(),
+			"group":   group,
+			"roles":   roles,
+			"members": len(members),
+		}).Info("Read identity provider group members")
+
+		for _, login := range members {
+			username := UsernameFromLogin(login)
+			user, exists := byUsername[username]
+			if !exists {
+				user = &DirectoryUser{Username: username}
+				byUsername[username] = user
+			}
+			user.Groups = append(user.Groups, roles...)
+		}
+	}
+
+	users := make([]DirectoryUser, 0, len(byUsername))
+	for _, user := range byUsername {
+		users = append(users, *user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+
+	return users, nil
+}
+
+// UsernameFromLogin derives a database username from an identity provider login,
+// dropping the domain of email-style logins. The name is put in NFC form, so an accented
+// login gives the same username however the provider encoded it.
+func UsernameFromLogin(login string) string {
+	if idx := strings.Index(login, "@"); idx > 0 {
+		login = login[:idx]
+	}
+	return strings.ToLower(structs.NormalizeIdentifier(login))
+}
+
+// OktaSource reads group membership from the Okta management API
+type OktaSource struct {
+	config IdPConfig
+	client *http.Client
+}
+
+// NewOktaSource creates a new Okta group source
+func NewOktaSource(config IdPConfig) (*OktaSource, error) {
+	if err := validateIdPConfig(config); err != nil {
+		return nil, err
+	}
+	return &OktaSource{config: config, client: &http.Client{Timeout: idpRequestTimeout}}, nil
+}
+
+// Name implements GroupSource
+func (s *OktaSource) Name() string {
+	return OktaSourceName
+}
+
+// GroupMembers implements GroupSource
+func (s *OktaSource) GroupMembers(ctx context.Context, group string) ([]string, error) {
+	var groups []struct {
+		ID      string `json:"id"`
+		Profile struct {
+			Name string `json:"name"`
+		} `json:"profile"`
+	}
+
+	query := url.Values{"q": {group}}
+	if _, err := s.get(ctx, s.config.URL+"/api/v1/groups?"+query.Encode(), &groups); err != nil {
+		return nil, err
+	}
+
+	// The q parameter is a prefix match, so pick the exact name
+	groupID := ""
+	for _, g := range groups {
+		if g.Profile.Name == group {
+			groupID = g.ID
+			break
+		}
+	}
+	if groupID == "" {
+		return nil, fmt.Errorf("group %s not found", group)
+	}
+
+	var logins []string
+	next := s.config.URL + "/api/v1/groups/" + url.PathEscape(groupID) + "/users?limit=200"
+	for next != "" {
+		var users []struct {
+			Status  string `json:"status"`
+			Profile struct {
+				Login string `json:"login"`
+			} `json:"profile"`
+		}
+
+		var err error
+		if next, err = s.get(ctx, next, &users); err != nil {
+			return nil, err
+		}
+
+		for _, user := range users {
+			// Suspended and deactivated users lose database access
+			if user.Status == "ACTIVE" || user.Status == "PASSWORD_EXPIRED" || user.Status == "LOCKED_OUT" {
+				logins = append(logins, user.Profile.Login)
+			}
+		}
+	}
+
+	return logins, nil
+}
+
+// get performs an authenticated GET request, decodes the JSON response and returns
+// the URL of the next page from the Link header
+func (s *OktaSource) get(ctx context.Context, requestURL string, target interface{}) (string, error) {
+	header, err := getJSON(ctx, s.client, requestURL, "SSWS "+s.config.Token, target)
+	if err != nil {
+		return "", err
+	}
+	return nextLink(header), nil
+}
+
+// SCIMSource reads group membership from a SCIM 2.0 service provider
+type SCIMSource struct {
+	config IdPConfig
+	client *http.Client
+}
+
+// NewSCIMSource creates a new SCIM group source
+func NewSCIMSource(config IdPConfig) (*SCIMSource, error) {
+	if err := validateIdPConfig(config); err != nil {
+		return nil, err
+	}
+	return &SCIMSource{config: config, client: &http.Client{Timeout: idpRequestTimeout}}, nil
+}
+
+// Name implements GroupSource
+func (s *SCIMSource) Name() string {
+	return SCIMSourceName
+}
+
+// GroupMembers implements GroupSource
+func (s *SCIMSource) GroupMembers(ctx context.Context, group string) ([]string, error) {
+	var groups struct {
+		Resources []struct {
+			Members []struct {
+				Value string `json:"value"`
+			} `json:"members"`
+		} `json:"Resources"`
+	}
+
+	query := url.Values{"filter": {fmt.Sprintf("displayName eq %q", group)}}
+	if _, err := getJSON(ctx, s.client, s.config.URL+"/Groups?"+query.Encode(), "Bearer "+s.config.Token, &groups); err != nil {
+		return nil, err
+	}
+	if len(groups.Resources) == 0 {
+		return nil, fmt.Errorf("group %s not found", group)
+	}
+
+	var logins []string
+	for _, member := range groups.Resources[0].Members {
+		var user struct {
+			UserName string `json:"userName"`
+			Active   *bool  `json:"active"`
+		}
+		if _, err := getJSON(ctx, s.client, s.config.URL+"/Users/"+url.PathEscape(member.Value), "Bearer "+s.config.Token, &user); err != nil {
+			return nil, err
+		}
+		if user.Active != nil && !*user.Active {
+			continue
+		}
+		logins = append(logins, user.UserName)
+	}
+
+	return logins, nil
+}
+
+// validateIdPConfig checks that an identity provider URL and token are configured
+func validateIdPConfig(config IdPConfig) error {
+	if config.URL == "" {
+		return fmt.Errorf("identity provider URL is required")
+	}
+	if config.Token == "" {
+		return fmt.Errorf("identity provider API token is required")
+	}
+	return nil
+}
+
+// getJSON performs an authenticated GET request and decodes the JSON response
+func getJSON(ctx context.Context, client *http.Client, requestURL, authorization string, target interface{}) (http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("request to %s failed with status %s", req.URL.Path, resp.Status)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(target); err != nil {
+		return nil, fmt.Errorf("failed to decode response from %s: %w", req.URL.Path, err)
+	}
+
+	return resp.Header, nil
+}
+
+// nextLink returns the rel="next" URL of a Link header, or an empty string
+func nextLink(header http.Header) string {
+	for _, link := range header.Values("Link") {
+		for _, part := range strings.Split(link, ",") {
+			target, params, ok := strings.Cut(part, ";")
+			if ok && strings.Contains(params, `rel="next"`) {
+				return strings.Trim(strings.TrimSpace(target), "<>")
+			}
+		}
+	}
+	return ""
+}
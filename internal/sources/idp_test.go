@@ -0,0 +1,155 @@
+package sources
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestUsernameFromLogin(t *testing.T) {
+	tests := map[string]string{
+		"Alice.Smith@example.com": "alice.smith",
+		"bob":                     "bob",
+		"@weird":                  "@weird",
+		"Jose\u0301@example.com":  "jos\u00e9",
+	}
+
+	for login, expected := range tests {
+		if username := UsernameFromLogin(login); username != expected {
+			t.Errorf("UsernameFromLogin(%q) = %q, expected %q", login, username, expected)
+		}
+	}
+}
+
+func TestOktaSourceGroupMembers(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "SSWS test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch {
+		case r.URL.Path == "/api/v1/groups":
+			json.NewEncoder(w).Encode([]map[string]interface{}{
+				{"id": "g2", "profile": map[string]string{"name": "Admins-EU"}},
+				{"id": "g1", "profile": map[string]string{"name": "Admins"}},
+			})
+		case r.URL.Path == "/api/v1/groups/g1/users" && r.URL.Query().Get("after") == "":
+			w.Header().Set("Link", `<`+server.URL+`/api/v1/groups/g1/users?limit=200&after=u2>; rel="next"`)
+			json.NewEncoder(w).Encode([]map[string]interface{}{
+				{"status": "ACTIVE", "profile": map[string]string{"login": "alice@example.com"}},
+				{"status": "SUSPENDED", "profile": map[string]string{"login": "bob@example.com"}},
+			})
+		case r.URL.Path == "/api/v1/groups/g1/users":
+			json.NewEncoder(w).Encode([]map[string]interface{}{
+				{"status": "ACTIVE", "profile": map[string]string{"login": "carol@example.com"}},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	source, err := NewOktaSource(IdPConfig{URL: server.URL, Token: "test-token"})
+	if err != nil {
+		t.Fatalf("Failed to create Okta source: %v", err)
+	}
+
+	members, err := source.GroupMembers(context.Background(), "Admins")
+	if err != nil {
+		t.Fatalf("Failed to read group members: %v", err)
+	}
+	if len(members) != 2 || members[0] != "alice@example.com" || members[1] != "carol@example.com" {
+		t.Errorf("Expected active members across pages, got %v", members)
+	}
+
+	if _, err := source.GroupMembers(context.Background(), "Missing"); err == nil {
+		t.Error("Expected error for missing group")
+	}
+}
+
+func TestSCIMSourceGroupMembers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/Groups":
+			if r.URL.Query().Get("filter") != `displayName eq "Developers"` {
+				json.NewEncoder(w).Encode(map[string]interface{}{"Resources": []interface{}{}})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"Resources": []map[string]interface{}{
+					{"members": []map[string]string{{"value": "1"}, {"value": "2"}}},
+				},
+			})
+		case "/Users/1":
+			json.NewEncoder(w).Encode(map[string]interface{}{"userName": "dave@example.com", "active": true})
+		case "/Users/2":
+			json.NewEncoder(w).Encode(map[string]interface{}{"userName": "erin@example.com", "active": false})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	source, err := NewSCIMSource(IdPConfig{URL: server.URL, Token: "test-token"})
+	if err != nil {
+		t.Fatalf("Failed to create SCIM source: %v", err)
+	}
+
+	members, err := source.GroupMembers(context.Background(), "Developers")
+	if err != nil {
+		t.Fatalf("Failed to read group members: %v", err)
+	}
+	if len(members) != 1 || members[0] != "dave@example.com" {
+		t.Errorf("Expected only active members, got %v", members)
+	}
+
+	if _, err := source.GroupMembers(context.Background(), "Missing"); err == nil {
+		t.Error("Expected error for missing group")
+	}
+}
+
+// staticSource is a GroupSource backed by a fixed membership list
+type staticSource map[string][]string
+
+func (s staticSource) Name() string { return "static" }
+
+func (s staticSource) GroupMembers(ctx context.Context, group string) ([]string, error) {
+	return s[group], nil
+}
+
+func TestFetchGroupUsers(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	source := staticSource{
+		"Admins":   {"alice@example.com"},
+		"ReadOnly": {"alice@example.com", "bob@example.com"},
+	}
+	mapper := func(groups []string) []string {
+		roles := map[string]string{"Admins": "admin_group", "ReadOnly": "read_only"}
+		return []string{roles[groups[0]]}
+	}
+
+	users, err := FetchGroupUsers(context.Background(), source, []string{"ReadOnly", "Admins"}, mapper, logger)
+	if err != nil {
+		t.Fatalf("Failed to fetch group users: %v", err)
+	}
+
+	if len(users) != 2 || users[0].Username != "alice" || users[1].Username != "bob" {
+		t.Fatalf("Expected alice and bob, got %+v", users)
+	}
+	if len(users[0].Groups) != 2 || users[0].Groups[0] != "admin_group" || users[0].Groups[1] != "read_only" {
+		t.Errorf("Expected alice in admin_group and read_only, got %v", users[0].Groups)
+	}
+}
@@ -0,0 +1,67 @@
+package sources
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestMemberFilter(t *testing.T) {
+	groupDN := "CN=DB Readers (EU),OU=Groups,DC=example,DC=com"
+
+	if filter := memberFilter(groupDN, false); filter != `(memberOf=CN=DB Readers \28EU\29,OU=Groups,DC=example,DC=com)` {
+		t.Errorf("Unexpected filter: %s", filter)
+	}
+
+	if filter := memberFilter(groupDN, true); filter != `(memberOf:1.2.840.113556.1.4.1941:=CN=DB Readers \28EU\29,OU=Groups,DC=example,DC=com)` {
+		t.Errorf("Unexpected nested filter: %s", filter)
+	}
+}
+
+func TestParseGroupMap(t *testing.T) {
+	groupMap, err := ParseGroupMap([]string{"read_only=CN=Readers,OU=Groups,DC=example,DC=com"})
+	if err != nil {
+		t.Fatalf("Failed to parse group map: %v", err)
+	}
+	if groupMap["CN=Readers,OU=Groups,DC=example,DC=com"] != "read_only" {
+		t.Errorf("Unexpected group map: %v", groupMap)
+	}
+
+	for _, invalid := range []string{"read_only", "=CN=Readers", "read_only="} {
+		if _, err := ParseGroupMap([]string{invalid}); err == nil {
+			t.Errorf("Expected error for mapping %q", invalid)
+		}
+	}
+}
+
+func TestNewLDAPSourceValidation(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	groupMap := map[string]string{"CN=Readers,DC=example,DC=com": "read_only"}
+
+	tests := []struct {
+		name   string
+		config LDAPConfig
+	}{
+		{name: "missing url", config: LDAPConfig{BaseDN: "DC=example,DC=com", GroupMap: groupMap}},
+		{name: "missing base dn", config: LDAPConfig{URL: "ldaps://ldap.example.com", GroupMap: groupMap}},
+		{name: "missing group map", config: LDAPConfig{URL: "ldaps://ldap.example.com", BaseDN: "DC=example,DC=com"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewLDAPSource(tt.config, logger); err == nil {
+				t.Error("Expected validation error")
+			}
+		})
+	}
+
+	source, err := NewLDAPSource(LDAPConfig{URL: "ldaps://ldap.example.com", BaseDN: "DC=example,DC=com", GroupMap: groupMap}, logger)
+	if err != nil {
+		t.Fatalf("Failed to create LDAP source: %v", err)
+	}
+	if source.config.UsernameAttribute != "uid" {
+		t.Errorf("Expected default username attribute uid, got %s", source.config.UsernameAttribute)
+	}
+}
@@ -0,0 +1,714 @@
+package sources
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+// rdsIAMRole is the role RDS grants to users that authenticate with IAM tokens
+const rdsIAMRole = "rds_iam"
+
+// RoleDump is a configuration read from the SQL of a pg_dumpall --roles-only dump or a
+// pgAdmin role export, with what could not be carried over
+type RoleDump struct {
+	Config   *structs.Config
+	Warnings []string
+}
+
+// dumpRole is a role as created and altered by the statements of a dump
+type dumpRole struct {
+	name            string
+	login           bool
+	inherit         bool
+	superuser       bool
+	password        bool
+	connectionLimit int
+	validUntil      *time.Time
+	comment         string
+	attributes      []string // Attributes the configuration cannot express, e.g. CREATEDB
+	managed         clusterMetadata
+}
+
+// dumpMembership is a role granted to another role
+type dumpMembership struct {
+	member string
+	group  string
+}
+
+// roleDumpParser collects the roles, memberships and database grants of a dump
+type roleDumpParser struct {
+	roles       map[string]*dumpRole
+	order       []string
+	memberships []dumpMembership
+	grants      map[string]map[string][]string // Database privileges by role and database
+	skipped     map[string]int                 // Statements that were skipped, by what they do
+	warnings    []string
+}
+
+// ParseRoleDump reads the roles of a pg_dumpall --roles-only dump, or a pgAdmin role export,
+// into a configuration. LOGIN roles become users and NOLOGIN roles become groups; role
+// memberships become groups and member_of, database grants become privileges and databases,
+// and role comments become descriptions. Superusers, roles named pg_* and the excluded roles
+// are left out. Passwords are not imported: dumps only hold their hashes, and sync keeps the
+// password of existing roles that have none configured.
+func ParseRoleDump(data []byte, exclude []string) (*RoleDump, error) {
+	statements, err := splitSQL(string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	p := &roleDumpParser{
+		roles:   make(map[string]*dumpRole),
+		grants:  make(map[string]map[string][]string),
+		skipped: make(map[string]int),
+	}
+	for _, statement := range statements {
+		if err := p.statement(&tokenReader{tokens: statement}); err != nil {
+			return nil, err
+		}
+	}
+	if len(p.roles) == 0 {
+		return nil, fmt.Errorf("no CREATE ROLE statements found")
+	}
+
+	return p.config(exclude), nil
+}
+
+// statement records what a statement does to roles. Statements that do not concern roles,
+// such as SET or CREATE DATABASE, are ignored.
+func (p *roleDumpParser) statement(r *tokenReader) error {
+	switch {
+	case r.words("create", "role"):
+		return p.createRole(r, false)
+	case r.words("create", "user"):
+		return p.createRole(r, true)
+	case r.words("create", "group"):
+		return p.createRole(r, false)
+	case r.words("alter", "role"), r.words("alter", "user"), r.words("alter", "group"):
+		return p.alterRole(r)
+	case r.words("comment", "on", "role"):
+		return p.comment(r)
+	case r.words("grant"):
+		return p.grant(r)
+	case r.words("revoke"):
+		p.skipped["REVOKE statements"]++
+	}
+	return nil
+}
+
+// role returns the role of a name, creating it with PostgreSQL's defaults
+func (p *roleDumpParser) role(name string) *dumpRole {
+	role, ok := p.roles[name]
+	if !ok {
+		role = &dumpRole{name: name, inherit: true, connectionLimit: -1}
+		p.roles[name] = role
+		p.order = append(p.order, name)
+	}
+	return role
+}
+
+// createRole handles CREATE ROLE, and CREATE USER, which implies LOGIN
+func (p *roleDumpParser) createRole(r *tokenReader, login bool) error {
+	name, err := r.identifier()
+	if err != nil {
+		return fmt.Errorf("invalid CREATE ROLE statement: %w", err)
+	}
+	role := p.role(name)
+	role.login = login
+	return p.options(r, role)
+}
+
+// alterRole handles ALTER ROLE with options. Role settings and renames are not carried over.
+func (p *roleDumpParser) alterRole(r *tokenReader) error {
+	name, err := r.identifier()
+	if err != nil {
+		return fmt.Errorf("invalid ALTER ROLE statement: %w", err)
+	}
+	switch {
+	case r.words("set"), r.words("reset"), r.words("in", "database"):
+		p.skipped["role settings (ALTER ROLE ... SET)"]++
+		return nil
+	case r.words("rename"):
+		p.warnings = append(p.warnings, fmt.Sprintf("role %s: ALTER ROLE ... RENAME skipped", name))
+		return nil
+	}
+	return p.options(r, p.role(name))
+}
+
+// options applies the options of CREATE ROLE and ALTER ROLE to a role
+func (p *roleDumpParser) options(r *tokenReader, role *dumpRole) error {
+	for !r.done() {
+		option := r.next()
+		if option.kind != tokenWord {
+			return fmt.Errorf("role %s: unexpected %q in role options", role.name, option.text)
+		}
+
+		switch option.text {
+		case "with", "encrypted", "unencrypted":
+		case "login":
+			role.login = true
+		case "nologin":
+			role.login = false
+		case "inherit":
+			role.inherit = true
+		case "noinherit":
+			role.inherit = false
+		case "superuser":
+			role.superuser = true
+		case "nosuperuser":
+			role.superuser = false
+		case "createdb", "createrole", "replication", "bypassrls":
+			role.attributes = appendUnique(role.attributes, strings.ToUpper(option.text))
+		case "nocreatedb", "nocreaterole", "noreplication", "nobypassrls":
+			role.attributes = removeValue(role.attributes, strings.ToUpper(strings.TrimPrefix(option.text, "no")))
+		case "password":
+			value := r.next()
+			role.password = value.kind == tokenString
+		case "connection":
+			if !r.words("limit") {
+				return fmt.Errorf("role %s: expected LIMIT after CONNECTION", role.name)
+			}
+			limit, err := strconv.Atoi(r.next().text)
+			if err != nil {
+				return fmt.Errorf("role %s: invalid connection limit: %w", role.name, err)
+			}
+			role.connectionLimit = limit
+		case "valid":
+			if !r.words("until") {
+				return fmt.Errorf("role %s: expected UNTIL after VALID", role.name)
+			}
+			validUntil, err := parseValidUntil(r.next().text)
+			if err != nil {
+				return fmt.Errorf("role %s: %w", role.name, err)
+			}
+			role.validUntil = validUntil
+		case "in":
+			r.words("role")
+			r.words("group")
+			groups, err := r.identifiers()
+			if err != nil {
+				return fmt.Errorf("role %s: %w", role.name, err)
+			}
+			for _, group := range groups {
+				p.memberships = append(p.memberships, dumpMembership{member: role.name, group: group})
+			}
+		case "role", "user", "admin":
+			members, err := r.identifiers()
+			if err != nil {
+				return fmt.Errorf("role %s: %w", role.name, err)
+			}
+			for _, member := range members {
+				p.memberships = append(p.memberships, dumpMembership{member: member, group: role.name})
+			}
+		case "sysid":
+			r.next()
+		default:
+			return fmt.Errorf("role %s: unknown role option %s", role.name, strings.ToUpper(option.text))
+		}
+	}
+	return nil
+}
+
+// comment handles COMMENT ON ROLE
+func (p *roleDumpParser) comment(r *tokenReader) error {
+	name, err := r.identifier()
+	if err != nil || !r.words("is") {
+		return fmt.Errorf("invalid COMMENT ON ROLE statement")
+	}
+	value := r.next()
+	if value.kind == tokenString {
+		p.role(name).comment = value.text
+	}
+	return nil
+}
+
+// grant handles GRANT of roles and of database privileges. Grants on other objects are
+// counted as skipped.
+func (p *roleDumpParser) grant(r *tokenReader) error {
+	var granted []string
+	for !r.done() && !r.peekWord("on") && !r.peekWord("to") {
+		token := r.next()
+		if token.text != "," {
+			granted = append(granted, token.text)
+		}
+	}
+
+	if r.words("on") {
+		if !r.words("database") {
+			p.skipped["grants on schemas, tables and other objects"]++
+			return nil
+		}
+		databases, err := r.identifiers()
+		if err != nil || !r.words("to") {
+			return fmt.Errorf("invalid GRANT ON DATABASE statement")
+		}
+		roles, err := r.identifiers()
+		if err != nil {
+			return fmt.Errorf("invalid GRANT ON DATABASE statement: %w", err)
+		}
+		for _, role := range roles {
+			if role == "public" {
+				continue
+			}
+			if p.grants[role] == nil {
+				p.grants[role] = make(map[string][]string)
+			}
+			for _, database := range databases {
+				for _, privilege := range databasePrivileges(granted) {
+					p.grants[role][database] = appendUnique(p.grants[role][database], privilege)
+				}
+			}
+		}
+		return nil
+	}
+
+	if !r.words("to") {
+		return fmt.Errorf("invalid GRANT statement")
+	}
+	members, err := r.identifiers()
+	if err != nil {
+		return fmt.Errorf("invalid GRANT statement: %w", err)
+	}
+	for _, group := range granted {
+		for _, member := range members {
+			p.memberships = append(p.memberships, dumpMembership{member: member, group: structs.NormalizeIdentifier(group)})
+		}
+	}
+	return nil
+}
+
+// databasePrivileges returns the privileges of a GRANT ON DATABASE as the configuration
+// names them
+func databasePrivileges(granted []string) []string {
+	var privileges []string
+	for _, privilege := range granted {
+		switch privilege = strings.ToUpper(privilege); privilege {
+		case "PRIVILEGES":
+			// ALL PRIVILEGES
+		case "TEMP":
+			privileges = append(privileges, "TEMPORARY")
+		default:
+			privileges = append(privileges, privilege)
+		}
+	}
+	return privileges
+}
+
+// config builds the configuration of the parsed roles
+func (p *roleDumpParser) config(exclude []string) *RoleDump {
+	dump := &RoleDump{Config: &structs.Config{Users: []structs.UserConfig{}, Groups: []structs.GroupConfig{}}}
+	warn := func(format string, args ...interface{}) {
+		dump.Warnings = append(dump.Warnings, fmt.Sprintf(format, args...))
+	}
+
+	excluded := make(map[string]bool, len(exclude))
+	for _, name := range exclude {
+		excluded[name] = true
+	}
+	imported := func(name string) bool {
+		role, ok := p.roles[name]
+		return ok && !excluded[name] && !role.superuser && !strings.HasPrefix(name, "pg_")
+	}
+
+	users := make(map[string]*structs.UserConfig)
+	groups := make(map[string]*structs.GroupConfig)
+	for _, name := range p.order {
+		role := p.roles[name]
+		if !imported(name) {
+			if role.superuser && !excluded[name] {
+				warn("role %s: superusers are not managed, left out", name)
+			}
+			continue
+		}
+		for _, attribute := range role.attributes {
+			warn("role %s: %s cannot be configured, grant it by hand", name, attribute)
+		}
+		privileges, databases := p.databaseGrants(name, warn)
+
+		if !role.login && role.managed.kind != managedKindUser {
+			if role.password {
+				warn("role %s: has a password but cannot log in, imported as a group; move it to users with enabled false if it is a locked user", name)
+			}
+			dump.Config.Groups = append(dump.Config.Groups, structs.GroupConfig{
+				Name:             name,
+				Privileges:       privileges,
+				Databases:        databases,
+				Description:      role.comment,
+				Inherit:          role.inherit,
+				ExtensionSchemas: role.managed.extensionSchemas,
+				Owner:            role.managed.owner,
+				Team:             role.managed.team,
+				Ticket:           role.managed.ticket,
+			})
+			continue
+		}
+
+		// Users this tool disabled are NOLOGIN roles still recorded as users
+		user := structs.UserConfig{
+			Username:           name,
+			Groups:             []string{},
+			Privileges:         privileges,
+			Databases:          databases,
+			Enabled:            role.login,
+			DeletionProtection: role.managed.protected,
+			Description:        role.comment,
+			ExternalID:         role.managed.externalID,
+			CanLogin:           true,
+			NoInherit:          !role.inherit,
+			ValidUntil:         role.validUntil,
+			ExtensionSchemas:   role.managed.extensionSchemas,
+			Owner:              role.managed.owner,
+			Team:               role.managed.team,
+			Ticket:             role.managed.ticket,
+		}
+		switch methods := role.managed.authMethods; {
+		case len(methods) == 1 && methods[0] != structs.AuthMethodPassword:
+			user.AuthMethod = methods[0]
+		case len(methods) > 1:
+			user.AuthMethods = methods
+		}
+		switch {
+		case role.connectionLimit > 0:
+			user.ConnectionLimit = role.connectionLimit
+		case role.connectionLimit == 0:
+			warn("role %s: CONNECTION LIMIT 0 cannot be configured, imported as unlimited; disable the user instead", name)
+		}
+		dump.Config.Users = append(dump.Config.Users, user)
+	}
+	for i := range dump.Config.Users {
+		users[dump.Config.Users[i].Username] = &dump.Config.Users[i]
+	}
+	for i := range dump.Config.Groups {
+		groups[dump.Config.Groups[i].Name] = &dump.Config.Groups[i]
+	}
+
+	undeclared := make(map[string]bool)
+	for _, membership := range p.memberships {
+		if users[membership.group] != nil {
+			warn("role %s: membership in user %s cannot be configured, left out", membership.member, membership.group)
+			continue
+		}
+		if groups[membership.group] == nil && membership.group != rdsIAMRole {
+			undeclared[membership.group] = true
+		}
+
+		switch {
+		case users[membership.member] != nil && membership.group == rdsIAMRole:
+			// Auth methods recorded by this tool already say whether IAM is a fallback
+			if user := users[membership.member]; len(user.AuthMethods) == 0 {
+				user.AuthMethod = structs.AuthMethodIAM
+			}
+		case users[membership.member] != nil:
+			user := users[membership.member]
+			user.Groups = appendUnique(user.Groups, membership.group)
+		case groups[membership.member] != nil:
+			group := groups[membership.member]
+			group.MemberOf = appendUnique(group.MemberOf, membership.group)
+		}
+	}
+	for i := range dump.Config.Users {
+		sort.Strings(dump.Config.Users[i].Groups)
+	}
+	for i := range dump.Config.Groups {
+		sort.Strings(dump.Config.Groups[i].MemberOf)
+	}
+
+	for _, name := range sortedKeys(undeclared) {
+		warn("role %s: granted to imported roles but not imported itself; validate with --against-db to accept it", name)
+	}
+	for _, what := range sortedKeys(p.skipped) {
+		warn("skipped %d %s", p.skipped[what], what)
+	}
+	dump.Warnings = append(p.warnings, dump.Warnings...)
+	return dump
+}
+
+// databaseGrants returns the database privileges of a role as privileges and databases. The
+// configuration grants every privilege on every database, so a role with different
+// privileges on different databases keeps only the privileges it has on all of them.
+func (p *roleDumpParser) databaseGrants(name string, warn func(string, ...interface{})) ([]string, []string) {
+	grants := p.grants[name]
+	privileges, databases := []string{}, []string{}
+	if len(grants) == 0 {
+		return privileges, databases
+	}
+
+	databases = sortedKeys(grants)
+	for _, privilege := range grants[databases[0]] {
+		onAll := true
+		for _, database := range databases[1:] {
+			if !containsValue(grants[database], privilege) {
+				onAll = false
+			}
+		}
+		if onAll {
+			privileges = append(privileges, privilege)
+		}
+	}
+	for _, database := range databases {
+		for _, privilege := range grants[database] {
+			if !containsValue(privileges, privilege) {
+				warn("role %s: %s on database %s is not granted on all its databases, left out; grant it with the grant command", name, privilege, database)
+			}
+		}
+	}
+	sort.Strings(privileges)
+	return privileges, databases
+}
+
+// parseValidUntil parses the timestamp of VALID UNTIL, nil for infinity
+func parseValidUntil(value string) (*time.Time, error) {
+	if value == "infinity" {
+		return nil, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05-07", "2006-01-02 15:04:05-07:00", "2006-01-02 15:04:05", "2006-01-02", time.RFC3339} {
+		if t, err := time.Parse(layout, value); err == nil {
+			t = t.UTC()
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid VALID UNTIL timestamp %q", value)
+}
+
+// Kinds of SQL tokens
+const (
+	tokenWord   = iota // Keyword or unquoted identifier, folded to lower case
+	tokenQuoted        // Quoted identifier, as written
+	tokenString        // String literal, unescaped
+	tokenSymbol        // Punctuation
+)
+
+// sqlToken is a token of a SQL statement
+type sqlToken struct {
+	kind int
+	text string
+}
+
+// splitSQL splits a SQL script into statements of tokens, skipping comments and psql
+// meta-commands such as \connect
+func splitSQL(script string) ([][]sqlToken, error) {
+	var statements [][]sqlToken
+	var statement []sqlToken
+	line := 1
+	// Every delimiter is ASCII, so the script is scanned by byte and only words are decoded
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		rest := script[i:]
+		switch {
+		case c == '\n':
+			line++
+		case c == ' ' || c == '\t' || c == '\r':
+		case strings.HasPrefix(rest, "--") || (c == '\\' && len(statement) == 0):
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				end = len(rest)
+			}
+			i += end - 1
+		case strings.HasPrefix(rest, "/*"):
+			end := strings.Index(rest, "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated comment", line)
+			}
+			line += strings.Count(rest[:end], "\n")
+			i += end + 1
+		case c == ';':
+			if len(statement) > 0 {
+				statements = append(statements, statement)
+				statement = nil
+			}
+		case c == '\'' || ((c == 'E' || c == 'e') && strings.HasPrefix(rest[1:], "'")):
+			escapes := c != '\''
+			if escapes {
+				i++
+			}
+			text, end, ok := quoted(script, i, '\'', escapes)
+			if !ok {
+				return nil, fmt.Errorf("line %d: unterminated string", line)
+			}
+			line += strings.Count(script[i:end], "\n")
+			statement = append(statement, sqlToken{kind: tokenString, text: text})
+			i = end
+		case c == '"':
+			text, end, ok := quoted(script, i, '"', false)
+			if !ok {
+				return nil, fmt.Errorf("line %d: unterminated quoted identifier", line)
+			}
+			statement = append(statement, sqlToken{kind: tokenQuoted, text: text})
+			i = end
+		case c == '$' && len(rest) > 1 && (rest[1] == '$' || isWordStart(rest[1:])):
+			tagEnd := strings.IndexByte(rest[1:], '$')
+			if tagEnd < 0 {
+				return nil, fmt.Errorf("line %d: invalid dollar quote", line)
+			}
+			tag := rest[:tagEnd+2]
+			end := strings.Index(rest[len(tag):], tag)
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated dollar-quoted string", line)
+			}
+			text := rest[len(tag) : len(tag)+end]
+			line += strings.Count(text, "\n")
+			statement = append(statement, sqlToken{kind: tokenString, text: text})
+			i += len(tag)*2 + end - 1
+		case isWordStart(rest) || (c == '-' && len(rest) > 1 && rest[1] >= '0' && rest[1] <= '9'):
+			end := 1
+			for end < len(rest) {
+				r, size := utf8.DecodeRuneInString(rest[end:])
+				if !isWordRune(r) {
+					break
+				}
+				end += size
+			}
+			statement = append(statement, sqlToken{kind: tokenWord, text: strings.ToLower(rest[:end])})
+			i += end - 1
+		default:
+			statement = append(statement, sqlToken{kind: tokenSymbol, text: string(c)})
+		}
+	}
+	if len(statement) > 0 {
+		statements = append(statements, statement)
+	}
+	return statements, nil
+}
+
+// quoted reads a string or identifier quoted with quote starting at script[start], where a
+// doubled quote stands for itself and, with escapes, a backslash escapes the next character.
+// It returns the unquoted text and the index of the closing quote.
+func quoted(script string, start int, quote byte, escapes bool) (string, int, bool) {
+	var text strings.Builder
+	for i := start + 1; i < len(script); i++ {
+		switch {
+		case escapes && script[i] == '\\' && i+1 < len(script):
+			i++
+			text.WriteByte(script[i])
+		case script[i] == quote && i+1 < len(script) && script[i+1] == quote:
+			i++
+			text.WriteByte(quote)
+		case script[i] == quote:
+			return text.String(), i, true
+		default:
+			text.WriteByte(script[i])
+		}
+	}
+	return "", 0, false
+}
+
+// isWordStart reports whether text starts with a keyword, unquoted identifier or number
+func isWordStart(text string) bool {
+	r, _ := utf8.DecodeRuneInString(text)
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// isWordRune reports whether a character can be part of a keyword, unquoted identifier or number
+func isWordRune(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_' || c == '$' || c == '.'
+}
+
+// tokenReader reads the tokens of a statement in order
+type tokenReader struct {
+	tokens []sqlToken
+	pos    int
+}
+
+// done reports whether every token was read
+func (r *tokenReader) done() bool {
+	return r.pos >= len(r.tokens)
+}
+
+// next returns the next token, or an empty symbol at the end of the statement
+func (r *tokenReader) next() sqlToken {
+	if r.done() {
+		return sqlToken{kind: tokenSymbol}
+	}
+	r.pos++
+	return r.tokens[r.pos-1]
+}
+
+// peekWord reports whether the next token is the keyword
+func (r *tokenReader) peekWord(word string) bool {
+	return !r.done() && r.tokens[r.pos].kind == tokenWord && r.tokens[r.pos].text == word
+}
+
+// words reads the keywords when the next tokens are exactly these, and reports whether they were
+func (r *tokenReader) words(words ...string) bool {
+	if r.pos+len(words) > len(r.tokens) {
+		return false
+	}
+	for i, word := range words {
+		if token := r.tokens[r.pos+i]; token.kind != tokenWord || token.text != word {
+			return false
+		}
+	}
+	r.pos += len(words)
+	return true
+}
+
+// identifier reads a role or database name
+func (r *tokenReader) identifier() (string, error) {
+	token := r.next()
+	if token.kind != tokenWord && token.kind != tokenQuoted {
+		return "", fmt.Errorf("expected a name, got %q", token.text)
+	}
+	return structs.NormalizeIdentifier(token.text), nil
+}
+
+// identifiers reads a comma-separated list of names
+func (r *tokenReader) identifiers() ([]string, error) {
+	var names []string
+	for {
+		name, err := r.identifier()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		if r.done() || r.tokens[r.pos].text != "," || r.tokens[r.pos].kind != tokenSymbol {
+			return names, nil
+		}
+		r.pos++
+	}
+}
+
+// appendUnique appends a value to a slice unless it already holds it
+func appendUnique(values []string, value string) []string {
+	if containsValue(values, value) {
+		return values
+	}
+	return append(values, value)
+}
+
+// removeValue returns a slice without a value
+func removeValue(values []string, value string) []string {
+	var kept []string
+	for _, v := range values {
+		if v != value {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
+
+// containsValue reports whether a slice holds a value
+func containsValue(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
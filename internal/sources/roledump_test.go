@@ -0,0 +1,193 @@
+package sources
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+const pgDumpallRoles = `--
+-- PostgreSQL database cluster dump
+--
+
+\restrict 3fG7kQ
+
+SET default_transaction_read_only = off;
+
+SET client_encoding = 'UTF8';
+SET standard_conforming_strings = on;
+
+--
+-- Roles
+--
+
+CREATE ROLE app_user;
+ALTER ROLE app_user WITH NOSUPERUSER INHERIT NOCREATEROLE NOCREATEDB LOGIN NOREPLICATION NOBYPASSRLS CONNECTION LIMIT 10 PASSWORD 'SCRAM-SHA-256$4096:c2FsdA==$a2V5:c2VydmVy' VALID UNTIL '2030-01-31 00:00:00+00';
+CREATE ROLE "Report User";
+ALTER ROLE "Report User" WITH NOSUPERUSER INHERIT NOCREATEROLE CREATEDB LOGIN NOREPLICATION NOBYPASSRLS;
+CREATE ROLE iam_user;
+ALTER ROLE iam_user WITH NOSUPERUSER INHERIT NOCREATEROLE NOCREATEDB LOGIN NOREPLICATION NOBYPASSRLS;
+CREATE ROLE postgres;
+ALTER ROLE postgres WITH SUPERUSER INHERIT CREATEROLE CREATEDB LOGIN REPLICATION BYPASSRLS;
+CREATE ROLE rdsadmin;
+ALTER ROLE rdsadmin WITH NOSUPERUSER INHERIT CREATEROLE CREATEDB LOGIN REPLICATION BYPASSRLS;
+CREATE ROLE readers;
+ALTER ROLE readers WITH NOSUPERUSER NOINHERIT NOCREATEROLE NOCREATEDB NOLOGIN NOREPLICATION NOBYPASSRLS;
+CREATE ROLE writers;
+ALTER ROLE writers WITH NOSUPERUSER INHERIT NOCREATEROLE NOCREATEDB NOLOGIN NOREPLICATION NOBYPASSRLS;
+COMMENT ON ROLE app_user IS 'Application user; owned by the ''orders'' team';
+ALTER ROLE app_user SET search_path TO 'app', 'public';
+
+--
+-- Role memberships
+--
+
+GRANT readers TO app_user WITH INHERIT TRUE GRANTED BY postgres;
+GRANT readers TO writers GRANTED BY postgres;
+GRANT writers TO app_user GRANTED BY postgres;
+GRANT pg_monitor TO "Report User" GRANTED BY postgres;
+GRANT rds_iam TO iam_user GRANTED BY rdsadmin;
+
+GRANT CONNECT, TEMP ON DATABASE app TO app_user;
+GRANT CONNECT ON DATABASE reports TO app_user;
+GRANT CONNECT ON DATABASE app, reports TO readers;
+GRANT SELECT ON ALL TABLES IN SCHEMA public TO readers;
+
+--
+-- PostgreSQL database cluster dump complete
+--
+`
+
+func TestParseRoleDump(t *testing.T) {
+	dump, err := ParseRoleDump([]byte(pgDumpallRoles), []string{"rdsadmin"})
+	if err != nil {
+		t.Fatalf("Failed to parse dump: %v", err)
+	}
+	config := dump.Config
+
+	validUntil := time.Date(2030, 1, 31, 0, 0, 0, 0, time.UTC)
+	expectedUsers := []structs.UserConfig{
+		{
+			Username:        "app_user",
+			Groups:          []string{"readers", "writers"},
+			Privileges:      []string{"CONNECT"},
+			Databases:       []string{"app", "reports"},
+			Enabled:         true,
+			Description:     "Application user; owned by the 'orders' team",
+			CanLogin:        true,
+			ConnectionLimit: 10,
+			ValidUntil:      &validUntil,
+		},
+		{
+			Username:   "Report User",
+			Groups:     []string{"pg_monitor"},
+			Privileges: []string{},
+			Databases:  []string{},
+			Enabled:    true,
+			CanLogin:   true,
+		},
+		{
+			Username:   "iam_user",
+			Groups:     []string{},
+			Privileges: []string{},
+			Databases:  []string{},
+			Enabled:    true,
+			AuthMethod: structs.AuthMethodIAM,
+			CanLogin:   true,
+		},
+	}
+	if !reflect.DeepEqual(config.Users, expectedUsers) {
+		t.Errorf("Unexpected users:\n%+v\nexpected:\n%+v", config.Users, expectedUsers)
+	}
+
+	expectedGroups := []structs.GroupConfig{
+		{Name: "readers", Privileges: []string{"CONNECT"}, Databases: []string{"app", "reports"}, Inherit: false},
+		{Name: "writers", Privileges: []string{}, Databases: []string{}, Inherit: true, MemberOf: []string{"readers"}},
+	}
+	if !reflect.DeepEqual(config.Groups, expectedGroups) {
+		t.Errorf("Unexpected groups:\n%+v\nexpected:\n%+v", config.Groups, expectedGroups)
+	}
+
+	warnings := strings.Join(dump.Warnings, "\n")
+	for _, expected := range []string{
+		"role postgres: superusers are not managed",
+		"role Report User: CREATEDB cannot be configured",
+		"role app_user: TEMPORARY on database app is not granted on all its databases",
+		"role pg_monitor: granted to imported roles but not imported itself",
+		"skipped 1 grants on schemas, tables and other objects",
+		"skipped 1 role settings",
+	} {
+		if !strings.Contains(warnings, expected) {
+			t.Errorf("Expected a warning containing %q, got:\n%s", expected, warnings)
+		}
+	}
+	if strings.Contains(warnings, "rdsadmin") {
+		t.Errorf("Expected no warnings about the excluded role, got:\n%s", warnings)
+	}
+}
+
+func TestParseRoleDumpPgAdmin(t *testing.T) {
+	export := `-- Role: analyst
+-- DROP ROLE IF EXISTS analyst;
+
+CREATE ROLE analyst WITH
+  LOGIN
+  NOSUPERUSER
+  INHERIT
+  NOCREATEDB
+  NOCREATEROLE
+  NOREPLICATION
+  CONNECTION LIMIT -1
+  ENCRYPTED PASSWORD 'md5d41d8cd98f00b204e9800998ecf8427e'
+  VALID UNTIL 'infinity';
+
+GRANT "Data Team" TO analyst;
+
+COMMENT ON ROLE analyst IS E'Ad hoc \'queries\'';
+
+CREATE GROUP "Data Team";
+`
+	dump, err := ParseRoleDump([]byte(export), nil)
+	if err != nil {
+		t.Fatalf("Failed to parse export: %v", err)
+	}
+
+	if len(dump.Config.Users) != 1 || len(dump.Config.Groups) != 1 {
+		t.Fatalf("Expected one user and one group, got %+v", dump.Config)
+	}
+	user := dump.Config.Users[0]
+	if user.Username != "analyst" || user.ValidUntil != nil || user.ConnectionLimit != 0 || user.Description != "Ad hoc 'queries'" {
+		t.Errorf("Unexpected user %+v", user)
+	}
+	if !reflect.DeepEqual(user.Groups, []string{"Data Team"}) || dump.Config.Groups[0].Name != "Data Team" {
+		t.Errorf("Expected analyst to be a member of Data Team, got %+v", dump.Config)
+	}
+	if len(dump.Warnings) != 0 {
+		t.Errorf("Expected no warnings, got %v", dump.Warnings)
+	}
+}
+
+func TestParseRoleDumpErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		sql      string
+		expected string
+	}{
+		{"no roles", "SET client_encoding = 'UTF8';", "no CREATE ROLE statements found"},
+		{"unterminated string", "CREATE ROLE app_user;\nCOMMENT ON ROLE app_user IS 'open;", "line 2: unterminated string"},
+		{"unknown option", "CREATE ROLE app_user WITH LOGIN FLY;", "unknown role option FLY"},
+		{"invalid valid until", "CREATE ROLE app_user VALID UNTIL 'tomorrow';", `invalid VALID UNTIL timestamp "tomorrow"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseRoleDump([]byte(tt.sql), nil)
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("Expected an error containing %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
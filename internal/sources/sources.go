@@ -0,0 +1,116 @@
+package sources
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+// DirectoryUser is a user and the database groups it should belong to, as reported by an identity source
+type DirectoryUser struct {
+	Username    string
+	Groups      []string
+	Description string
+}
+
+// MergeResult reports how an identity source changed the users section of a config
+type MergeResult struct {
+	Added    []string
+	Updated  []string
+	Disabled []string
+}
+
+// MergeUsers updates the users section of a config from an identity source. New users are
+// added from the template, users previously imported from the same source get their groups
+// replaced, and users imported from the source that are no longer reported are disabled.
+// Users managed by hand or by another source are left untouched.
+func MergeUsers(config *structs.Config, source string, users []DirectoryUser, template structs.UserConfig) *MergeResult {
+	result := &MergeResult{}
+
+	reported := make(map[string]bool, len(users))
+	for _, directoryUser := range users {
+		username := strings.ToLower(directoryUser.Username)
+		reported[username] = true
+
+		groups := sortedUnique(directoryUser.Groups)
+
+		existing := findUser(config, username)
+		if existing == nil {
+			user := template
+			user.Username = username
+			user.Groups = groups
+			user.Enabled = true
+			user.Source = source
+			if directoryUser.Description != "" {
+				user.Description = directoryUser.Description
+			}
+			config.Users = append(config.Users, user)
+			result.Added = append(result.Added, username)
+			continue
+		}
+
+		if existing.Source != source {
+			continue
+		}
+
+		if !equalStrings(existing.Groups, groups) || !existing.Enabled {
+			existing.Groups = groups
+			existing.Enabled = true
+			result.Updated = append(result.Updated, username)
+		}
+	}
+
+	// Users that left the directory are locked rather than dropped
+	for i := range config.Users {
+		user := &config.Users[i]
+		if user.Source != source || reported[strings.ToLower(user.Username)] || !user.Enabled {
+			continue
+		}
+		user.Enabled = false
+		result.Disabled = append(result.Disabled, user.Username)
+	}
+
+	sort.Strings(result.Added)
+	sort.Strings(result.Updated)
+	sort.Strings(result.Disabled)
+
+	return result
+}
+
+// findUser returns the config entry for a username, compared case-insensitively
+func findUser(config *structs.Config, username string) *structs.UserConfig {
+	for i := range config.Users {
+		if strings.EqualFold(config.Users[i].Username, username) {
+			return &config.Users[i]
+		}
+	}
+	return nil
+}
+
+// sortedUnique returns the distinct values of a slice in order
+func sortedUnique(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := []string{}
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
+
+// equalStrings reports whether two slices hold the same values in the same order
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,60 @@
+package sources
+
+import (
+	"testing"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+func TestMergeUsers(t *testing.T) {
+	config := &structs.Config{
+		Users: []structs.UserConfig{
+			{Username: "manual_user", Groups: []string{"app_group"}, Enabled: true},
+			{Username: "alice", Groups: []string{"read_only"}, Enabled: true, Source: "ldap"},
+			{Username: "bob", Groups: []string{"read_only"}, Enabled: true, Source: "ldap"},
+			{Username: "carol", Groups: []string{"app_group"}, Enabled: false, Source: "ldap"},
+		},
+	}
+
+	users := []DirectoryUser{
+		{Username: "Alice", Groups: []string{"read_only", "app_group", "read_only"}},
+		{Username: "carol", Groups: []string{"app_group"}},
+		{Username: "dave", Groups: []string{"read_only"}, Description: "Dave Jones"},
+		{Username: "manual_user", Groups: []string{"read_only"}},
+	}
+
+	template := structs.UserConfig{AuthMethod: structs.AuthMethodIAM, CanLogin: true}
+	result := MergeUsers(config, "ldap", users, template)
+
+	if len(result.Added) != 1 || result.Added[0] != "dave" {
+		t.Errorf("Expected dave to be added, got %v", result.Added)
+	}
+	if len(result.Updated) != 2 || result.Updated[0] != "alice" || result.Updated[1] != "carol" {
+		t.Errorf("Expected alice and carol to be updated, got %v", result.Updated)
+	}
+	if len(result.Disabled) != 1 || result.Disabled[0] != "bob" {
+		t.Errorf("Expected bob to be disabled, got %v", result.Disabled)
+	}
+
+	alice := findUser(config, "alice")
+	if len(alice.Groups) != 2 || alice.Groups[0] != "app_group" || alice.Groups[1] != "read_only" {
+		t.Errorf("Expected alice's groups to be replaced and sorted, got %v", alice.Groups)
+	}
+
+	dave := findUser(config, "dave")
+	if dave == nil || dave.AuthMethod != structs.AuthMethodIAM || dave.Source != "ldap" || !dave.Enabled || dave.Description != "Dave Jones" {
+		t.Errorf("Expected dave to be created from the template, got %+v", dave)
+	}
+
+	// Users not imported from this source are never modified
+	manual := findUser(config, "manual_user")
+	if len(manual.Groups) != 1 || manual.Groups[0] != "app_group" {
+		t.Errorf("Expected manual user to be untouched, got %v", manual.Groups)
+	}
+
+	// Merging the same users again changes nothing
+	result = MergeUsers(config, "ldap", users, template)
+	if len(result.Added)+len(result.Updated)+len(result.Disabled) != 0 {
+		t.Errorf("Expected second merge to be a no-op, got %+v", result)
+	}
+}
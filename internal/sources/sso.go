@@ -0,0 +1,208 @@
+package sources
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/identitystore"
+	identitystoretypes "github.com/aws/aws-sdk-go-v2/service/identitystore/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssoadmin"
+	ssoadmintypes "github.com/aws/aws-sdk-go-v2/service/ssoadmin/types"
+	"github.com/sirupsen/logrus"
+)
+
+// SSOSourceName identifies users imported from AWS IAM Identity Center in the config
+const SSOSourceName = "sso"
+
+// SSOConfig selects the IAM Identity Center assignments to import
+type SSOConfig struct {
+	InstanceArn      string // IAM Identity Center instance ARN
+	IdentityStoreID  string // identity store backing the instance
+	AccountID        string // AWS account the permission set is assigned in
+	PermissionSetArn string // permission set granting database access
+}
+
+// ssoAdminAPI is the subset of the SSO admin client used to list assignments
+type ssoAdminAPI interface {
+	ListAccountAssignments(ctx context.Context, params *ssoadmin.ListAccountAssignmentsInput, optFns ...func(*ssoadmin.Options)) (*ssoadmin.ListAccountAssignmentsOutput, error)
+}
+
+// identityStoreAPI is the subset of the identity store client used to resolve principals
+type identityStoreAPI interface {
+	DescribeGroup(ctx context.Context, params *identitystore.DescribeGroupInput, optFns ...func(*identitystore.Options)) (*identitystore.DescribeGroupOutput, error)
+	DescribeUser(ctx context.Context, params *identitystore.DescribeUserInput, optFns ...func(*identitystore.Options)) (*identitystore.DescribeUserOutput, error)
+	ListGroupMemberships(ctx context.Context, params *identitystore.ListGroupMembershipsInput, optFns ...func(*identitystore.Options)) (*identitystore.ListGroupMembershipsOutput, error)
+}
+
+// SSOSource reads users assigned to a permission set in AWS IAM Identity Center
+type SSOSource struct {
+	config        SSOConfig
+	admin         ssoAdminAPI
+	identityStore identityStoreAPI
+	logger        *logrus.Logger
+}
+
+// NewSSOSource creates a new IAM Identity Center source using the given AWS configuration
+func NewSSOSource(config SSOConfig, awsConfig aws.Config, logger *logrus.Logger) (*SSOSource, error) {
+	if config.InstanceArn == "" {
+		return nil, fmt.Errorf("IAM Identity Center instance ARN is required")
+	}
+	if config.IdentityStoreID == "" {
+		return nil, fmt.Errorf("identity store ID is required")
+	}
+	if config.AccountID == "" {
+		return nil, fmt.Errorf("AWS account ID is required")
+	}
+	if config.PermissionSetArn == "" {
+		return nil, fmt.Errorf("permission set ARN is required")
+	}
+
+	return &SSOSource{
+		config:        config,
+		admin:         ssoadmin.NewFromConfig(awsConfig),
+		identityStore: identitystore.NewFromConfig(awsConfig),
+		logger:        logger,
+	}, nil
+}
+
+// FetchUsers reads the users and groups assigned to the permission set in the account.
+// Groups are mapped to database roles with the mapper by display name; users assigned
+// directly are imported without any groups
+func (s *SSOSource) FetchUsers(ctx context.Context, mapper func([]string) []string) ([]DirectoryUser, error) {
+	assignments, err := s.listAssignments(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	byUsername := make(map[string]*DirectoryUser)
+	addUser := func(userID string, roles []string) error {
+		username, err := s.username(ctx, userID)
+		if err != nil {
+			return err
+		}
+		user, exists := byUsername[username]
+		if !exists {
+			user = &DirectoryUser{Username: username}
+			byUsername[username] = user
+		}
+		user.Groups = append(user.Groups, roles...)
+		return nil
+	}
+
+	for _, assignment := range assignments {
+		principalID := aws.ToString(assignment.PrincipalId)
+
+		switch assignment.PrincipalType {
+		case ssoadmintypes.PrincipalTypeUser:
+			if err := addUser(principalID, nil); err != nil {
+				return nil, err
+			}
+
+		case ssoadmintypes.PrincipalTypeGroup:
+			group, err := s.identityStore.DescribeGroup(ctx, &identitystore.DescribeGroupInput{
+				IdentityStoreId: aws.String(s.config.IdentityStoreID),
+				GroupId:         aws.String(principalID),
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to describe group %s: %w", principalID, err)
+			}
+
+			members, err := s.groupMembers(ctx, principalID)
+			if err != nil {
+				return nil, err
+			}
+
+			groupName := aws.ToString(group.DisplayName)
+			roles := mapper([]string{groupName})
+
+			s.logger.WithFields(logrus.Fields{
+				"source":  SSOSourceName,
+				"group":   groupName,
+				"roles":   roles,
+				"members": len(members),
+			}).Info("Read IAM Identity Center group members")
+
+			for _, userID := range members {
+				if err := addUser(userID, roles); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	users := make([]DirectoryUser, 0, len(byUsername))
+	for _, user := range byUsername {
+		user.Groups = sortedUnique(user.Groups)
+		users = append(users, *user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+
+	return users, nil
+}
+
+// listAssignments pages through the permission set assignments in the account
+func (s *SSOSource) listAssignments(ctx context.Context) ([]ssoadmintypes.AccountAssignment, error) {
+	var assignments []ssoadmintypes.AccountAssignment
+	var nextToken *string
+
+	for {
+		output, err := s.admin.ListAccountAssignments(ctx, &ssoadmin.ListAccountAssignmentsInput{
+			InstanceArn:      aws.String(s.config.InstanceArn),
+			AccountId:        aws.String(s.config.AccountID),
+			PermissionSetArn: aws.String(s.config.PermissionSetArn),
+			NextToken:        nextToken,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list account assignments: %w", err)
+		}
+
+		assignments = append(assignments, output.AccountAssignments...)
+		if aws.ToString(output.NextToken) == "" {
+			return assignments, nil
+		}
+		nextToken = output.NextToken
+	}
+}
+
+// groupMembers pages through the memberships of a group and returns the member user IDs
+func (s *SSOSource) groupMembers(ctx context.Context, groupID string) ([]string, error) {
+	var members []string
+	var nextToken *string
+
+	for {
+		output, err := s.identityStore.ListGroupMemberships(ctx, &identitystore.ListGroupMembershipsInput{
+			IdentityStoreId: aws.String(s.config.IdentityStoreID),
+			GroupId:         aws.String(groupID),
+			NextToken:       nextToken,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list members of group %s: %w", groupID, err)
+		}
+
+		for _, membership := range output.GroupMemberships {
+			// Only users can be group members today; skip anything else
+			if member, ok := membership.MemberId.(*identitystoretypes.MemberIdMemberUserId); ok {
+				members = append(members, member.Value)
+			}
+		}
+
+		if aws.ToString(output.NextToken) == "" {
+			return members, nil
+		}
+		nextToken = output.NextToken
+	}
+}
+
+// username resolves an identity store user ID to a database username
+func (s *SSOSource) username(ctx context.Context, userID string) (string, error) {
+	user, err := s.identityStore.DescribeUser(ctx, &identitystore.DescribeUserInput{
+		IdentityStoreId: aws.String(s.config.IdentityStoreID),
+		UserId:          aws.String(userID),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to describe user %s: %w", userID, err)
+	}
+	return UsernameFromLogin(aws.ToString(user.UserName)), nil
+}
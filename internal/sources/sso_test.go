@@ -0,0 +1,92 @@
+package sources
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/identitystore"
+	identitystoretypes "github.com/aws/aws-sdk-go-v2/service/identitystore/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssoadmin"
+	ssoadmintypes "github.com/aws/aws-sdk-go-v2/service/ssoadmin/types"
+	"github.com/sirupsen/logrus"
+)
+
+type fakeSSOAdmin struct{}
+
+func (f *fakeSSOAdmin) ListAccountAssignments(ctx context.Context, params *ssoadmin.ListAccountAssignmentsInput, optFns ...func(*ssoadmin.Options)) (*ssoadmin.ListAccountAssignmentsOutput, error) {
+	if aws.ToString(params.NextToken) == "" {
+		return &ssoadmin.ListAccountAssignmentsOutput{
+			AccountAssignments: []ssoadmintypes.AccountAssignment{
+				{PrincipalId: aws.String("g-admins"), PrincipalType: ssoadmintypes.PrincipalTypeGroup},
+			},
+			NextToken: aws.String("page2"),
+		}, nil
+	}
+	return &ssoadmin.ListAccountAssignmentsOutput{
+		AccountAssignments: []ssoadmintypes.AccountAssignment{
+			{PrincipalId: aws.String("u-carol"), PrincipalType: ssoadmintypes.PrincipalTypeUser},
+		},
+	}, nil
+}
+
+type fakeIdentityStore struct {
+	users map[string]string
+}
+
+func (f *fakeIdentityStore) DescribeGroup(ctx context.Context, params *identitystore.DescribeGroupInput, optFns ...func(*identitystore.Options)) (*identitystore.DescribeGroupOutput, error) {
+	return &identitystore.DescribeGroupOutput{DisplayName: aws.String("Admins")}, nil
+}
+
+func (f *fakeIdentityStore) DescribeUser(ctx context.Context, params *identitystore.DescribeUserInput, optFns ...func(*identitystore.Options)) (*identitystore.DescribeUserOutput, error) {
+	return &identitystore.DescribeUserOutput{UserName: aws.String(f.users[aws.ToString(params.UserId)])}, nil
+}
+
+func (f *fakeIdentityStore) ListGroupMemberships(ctx context.Context, params *identitystore.ListGroupMembershipsInput, optFns ...func(*identitystore.Options)) (*identitystore.ListGroupMembershipsOutput, error) {
+	return &identitystore.ListGroupMembershipsOutput{
+		GroupMemberships: []identitystoretypes.GroupMembership{
+			{MemberId: &identitystoretypes.MemberIdMemberUserId{Value: "u-alice"}},
+			{MemberId: &identitystoretypes.MemberIdMemberUserId{Value: "u-carol"}},
+		},
+	}, nil
+}
+
+func TestSSOSourceFetchUsers(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	source := &SSOSource{
+		config: SSOConfig{InstanceArn: "arn", IdentityStoreID: "d-123", AccountID: "123456789012", PermissionSetArn: "ps"},
+		admin:  &fakeSSOAdmin{},
+		identityStore: &fakeIdentityStore{users: map[string]string{
+			"u-alice": "Alice@example.com",
+			"u-carol": "carol",
+		}},
+		logger: logger,
+	}
+
+	mapper := func(groups []string) []string {
+		roles := make([]string, len(groups))
+		for i, group := range groups {
+			roles[i] = strings.ToLower(group)
+		}
+		return roles
+	}
+
+	users, err := source.FetchUsers(context.Background(), mapper)
+	if err != nil {
+		t.Fatalf("FetchUsers failed: %v", err)
+	}
+
+	if len(users) != 2 {
+		t.Fatalf("Expected 2 users, got %d: %+v", len(users), users)
+	}
+	if users[0].Username != "alice" || !equalStrings(users[0].Groups, []string{"admins"}) {
+		t.Errorf("Unexpected first user: %+v", users[0])
+	}
+	// carol is assigned directly and through the group; the group roles are kept
+	if users[1].Username != "carol" || !equalStrings(users[1].Groups, []string{"admins"}) {
+		t.Errorf("Unexpected second user: %+v", users[1])
+	}
+}
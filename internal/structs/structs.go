@@ -1,45 +1,646 @@
 package structs
 
-import "time"
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
 
 // Config represents the overall configuration for the user manager
 type Config struct {
-	Users  []UserConfig  `json:"users"`
-	Groups []GroupConfig `json:"groups"`
+	Users           []UserConfig             `json:"users"`
+	Groups          []GroupConfig            `json:"groups"`
+	Policies        []PolicyConfig           `json:"policies,omitempty"`
+	Schemas         []SchemaConfig           `json:"schemas,omitempty"`           // Schemas of the connected database created and granted on by sync
+	Databases       []string                 `json:"databases,omitempty"`         // Databases referenced by users and groups (optional, used for validation)
+	Profiles        map[string]ProfileConfig `json:"profiles,omitempty"`          // Metadata for template variables, by cluster (sync profile) name
+	SSLMode         *SSLModeConfig           `json:"ssl_mode,omitempty"`          // Default SSL mode of the database connection, by authentication method
+	SSLCertificates *SSLCertificatesConfig   `json:"ssl_certificates,omitempty"`  // Certificate files of the database connection not set by POSTGRES_SSL* variables
+	Hooks           []HookConfig             `json:"hooks,omitempty"`             // SQL statements or commands run after role changes
+	GroupMappings   *GroupMappingConfig      `json:"group_mappings,omitempty"`    // Maps identity provider groups to database roles
+	UsernameRules   *UsernameRulesConfig     `json:"username_rules,omitempty"`    // Turns identity provider logins into role names
+	RequireOwner    bool                     `json:"require_owner,omitempty"`     // Reject users and groups without an owner or team
+	ChangeLimits    *ChangeLimitsConfig      `json:"change_limits,omitempty"`     // Refuse syncs that would remove more access than this
+	RoleRemoval     *RoleRemovalConfig       `json:"role_removal,omitempty"`      // What happens to the objects of the roles sync drops
+	Rotation        *RotationConfig          `json:"rotation,omitempty"`          // When passwords are rotated and where rotated passwords are published
+	Notifications   []NotificationConfig     `json:"notifications,omitempty"`     // Targets sent an event for every change a sync makes
+	Connection      *ConnectionConfig        `json:"connection,omitempty"`        // Connection retries and pool limits not set by POSTGRES_* variables
+	GlobalDefaults  *GlobalDefaultsConfig    `json:"global_defaults,omitempty"`   // Settings every enabled user gets without declaring them
+	TagCreatedRoles bool                     `json:"tag_created_roles,omitempty"` // Mark every role the tool creates as managed and record its source
+}
+
+// GlobalDefaultsConfig holds settings applied to every enabled user, such as a baseline
+// access group, so they are not repeated in each user
+type GlobalDefaultsConfig struct {
+	Groups []string `json:"groups,omitempty"` // Groups every enabled user is a member of
+}
+
+// DefaultGroups returns the groups every enabled user of the configuration is a member of
+func (c *Config) DefaultGroups() []string {
+	if c.GlobalDefaults == nil {
+		return nil
+	}
+	return c.GlobalDefaults.Groups
+}
+
+// ObjectDatabases returns the databases the configuration grants on or creates objects in
+// besides the connected one, sorted: those of extension schema and large object grants,
+// schemas, policies and hooks
+func (c *Config) ObjectDatabases() []string {
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if name != "" {
+			seen[name] = true
+		}
+	}
+	addGrants := func(extensions []ExtensionSchemaGrant, largeObjects []LargeObjectGrant) {
+		for _, grant := range extensions {
+			add(grant.Database)
+		}
+		for _, grant := range largeObjects {
+			add(grant.Database)
+		}
+	}
+	for _, user := range c.Users {
+		addGrants(user.ExtensionSchemas, user.LargeObjects)
+	}
+	for _, group := range c.Groups {
+		addGrants(group.ExtensionSchemas, group.LargeObjects)
+	}
+	for _, schema := range c.Schemas {
+		add(schema.Database)
+	}
+	for _, policy := range c.Policies {
+		add(policy.Database)
+	}
+	for _, hook := range c.Hooks {
+		for _, name := range hook.Databases {
+			add(name)
+		}
+	}
+
+	databases := make([]string, 0, len(seen))
+	for name := range seen {
+		databases = append(databases, name)
+	}
+	sort.Strings(databases)
+	return databases
+}
+
+// ConnectionConfig sets the driver of connections and how they are retried and pooled. The
+// POSTGRES_* environment variables of the same settings take precedence.
+type ConnectionConfig struct {
+	Driver                 string `json:"driver,omitempty"`                     // Database driver: DriverPQ (default) or DriverPGX
+	ConnectRetries         int    `json:"connect_retries,omitempty"`            // Retries of a connection attempt that failed with a transient error
+	MaxOpenConns           int    `json:"max_open_conns,omitempty"`             // Connections open at most (0: unlimited)
+	MaxIdleConns           int    `json:"max_idle_conns,omitempty"`             // Idle connections kept at most (0: the database/sql default of 2)
+	ConnMaxLifetimeSeconds int    `json:"conn_max_lifetime_seconds,omitempty"`  // Close connections after this long (0: never)
+	ConnMaxIdleTimeSeconds int    `json:"conn_max_idle_time_seconds,omitempty"` // Close connections idle for this long (0: never)
+}
+
+// Database drivers a connection can use
+const (
+	DriverPQ  = "pq"  // lib/pq, kept for compatibility
+	DriverPGX = "pgx" // jackc/pgx through its database/sql adapter
+)
+
+// PoolConfig holds the connection pool limits of a connection
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// Targets change notifications are sent to
+const (
+	NotificationTypeWebhook     = "webhook"
+	NotificationTypeSNS         = "sns"
+	NotificationTypeEventBridge = "eventbridge"
+)
+
+// Formats change notifications are sent in
+const (
+	NotificationFormatJSON        = "json"
+	NotificationFormatCloudEvents = "cloudevents"
+)
+
+// NotificationConfig is a target sync sends an event to for every change it makes
+type NotificationConfig struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`                // webhook, sns or eventbridge
+	Format   string `json:"format,omitempty"`    // json or cloudevents, CloudEvents 1.0 in structured mode (default: json)
+	Source   string `json:"source,omitempty"`    // CloudEvents and EventBridge source (default: postgres-user-manager)
+	URL      string `json:"url,omitempty"`       // URL the webhook POSTs events to
+	TopicARN string `json:"topic_arn,omitempty"` // SNS topic events are published to
+	EventBus string `json:"event_bus,omitempty"` // EventBridge event bus name or ARN (default: the default bus)
+}
+
+// Backends rotated passwords are published to
+const (
+	RotationBackendStdout         = "stdout"
+	RotationBackendSecretsManager = "secretsmanager"
+	RotationBackendSSM            = "ssm"
+	RotationBackendVault          = "vault"
+)
+
+// RotationConfig sets the maximum age of generated passwords, after which sync
+// --rotate-expired replaces them, and the backend rotated passwords are published to
+type RotationConfig struct {
+	MaxAgeDays int    `json:"max_age_days,omitempty"` // Rotate passwords last set this many days ago or earlier (0: never)
+	Backend    string `json:"backend,omitempty"`      // stdout, secretsmanager, ssm or vault (default: stdout)
+	Prefix     string `json:"prefix,omitempty"`       // Prepended to the username to name the secret, parameter or Vault path
+	KMSKeyID   string `json:"kms_key_id,omitempty"`   // KMS key encrypting Secrets Manager secrets and SSM parameters (default: the AWS managed key)
+	VaultAddr  string `json:"vault_addr,omitempty"`   // Vault server address (default: VAULT_ADDR)
+	VaultMount string `json:"vault_mount,omitempty"`  // Mount of the Vault KV version 2 secrets engine (default: secret)
+}
+
+// MaxAge returns the maximum password age, zero when passwords are not rotated by age
+func (r *RotationConfig) MaxAge() time.Duration {
+	if r == nil {
+		return 0
+	}
+	return time.Duration(r.MaxAgeDays) * 24 * time.Hour
+}
+
+// ChangeLimitsConfig caps how much access a single sync may remove, so a truncated or
+// mistaken configuration cannot wipe out access in one run. Zero values are not checked.
+type ChangeLimitsConfig struct {
+	MaxRemovals       int     `json:"max_removals,omitempty"`        // Roles dropped, disabled or pruned plus memberships and privileges revoked
+	MaxRemovalPercent float64 `json:"max_removal_percent,omitempty"` // Roles dropped, disabled or pruned, as a percentage of the managed roles
+}
+
+// RoleRemovalConfig sets what happens to the objects a role owns and the privileges it holds
+// in the connected database when sync drops it. PostgreSQL refuses to drop a role that has
+// either, so without it absent and pruned users that own objects are left in place.
+type RoleRemovalConfig struct {
+	ReassignTo         string `json:"reassign_to,omitempty"`          // Role that receives the objects of dropped roles
+	Cascade            bool   `json:"cascade,omitempty"`              // Drop the objects of dropped roles instead of reassigning them
+	TerminateSessions  bool   `json:"terminate_sessions,omitempty"`   // Terminate the sessions of users before dropping them
+	GracePeriodSeconds int    `json:"grace_period_seconds,omitempty"` // How long sessions may disconnect on their own before they are terminated
+}
+
+// GracePeriod returns how long the sessions of a dropped user may disconnect on their own
+func (r *RoleRemovalConfig) GracePeriod() time.Duration {
+	if r == nil {
+		return 0
+	}
+	return time.Duration(r.GracePeriodSeconds) * time.Second
+}
+
+// UsernameRulesConfig controls how logins from identity providers, such as Cognito emails,
+// become role names. Names are lower-cased, replacements run in order, and characters other
+// than letters, digits and underscores are replaced before the length limit is applied.
+type UsernameRulesConfig struct {
+	KeepDomain   bool                  `json:"keep_domain,omitempty"`  // Keep the domain of email logins instead of dropping it
+	Replacements []UsernameReplacement `json:"replacements,omitempty"` // Regular expression replacements applied in order
+	Prefix       string                `json:"prefix,omitempty"`       // Prepended to names that do not start with a letter (default: "u_")
+	MaxLength    int                   `json:"max_length,omitempty"`   // Maximum name length (default and upper bound: 63)
+}
+
+// UsernameReplacement replaces the parts of a login matching a regular expression
+type UsernameReplacement struct {
+	Pattern string `json:"pattern"`
+	Replace string `json:"replace"` // Replacement text, which can refer to submatches as $1 or ${name}
+}
+
+// GroupMappingConfig maps identity provider groups, such as Cognito groups, to database roles.
+// Exact names are tried first, then prefixes and rules in order; unmatched groups get the
+// default role, or keep their name when there is none.
+type GroupMappingConfig struct {
+	Groups      map[string]string `json:"groups,omitempty"`       // Exact group names and their roles
+	Prefixes    []PrefixMapping   `json:"prefixes,omitempty"`     // Group name prefixes replaced with role name prefixes
+	Rules       []RuleMapping     `json:"rules,omitempty"`        // Regular expressions over group names
+	DefaultRole string            `json:"default_role,omitempty"` // Role for unmatched groups (default: the group name)
+}
+
+// PrefixMapping maps the groups starting with a prefix, replacing the prefix
+type PrefixMapping struct {
+	Prefix  string `json:"prefix"`
+	Replace string `json:"replace"` // Role name prefix, may be empty to strip the prefix
+}
+
+// RuleMapping maps the groups matching a regular expression
+type RuleMapping struct {
+	Pattern string `json:"pattern"` // Regular expression matched against the whole group name
+	Role    string `json:"role"`    // Role name, which can refer to submatches as $1 or ${name}
+}
+
+// Events a hook runs on
+const (
+	HookEventUserCreated  = "user_created"  // After a user is created
+	HookEventGroupCreated = "group_created" // After a group is created
+)
+
+// HookConfig runs SQL statements or a command after a role change, e.g. to assign a new
+// user to a resource group or a workload priority, or to bootstrap a new group's schema
+type HookConfig struct {
+	Name      string   `json:"name"`
+	Event     string   `json:"event"`               // Event the hook runs on: user_created or group_created
+	Groups    []string `json:"groups,omitempty"`    // Only run for users in, or for, one of these groups (default: all roles)
+	Databases []string `json:"databases,omitempty"` // Databases the SQL runs in, one after the other (default: the connected database)
+	SQL       []string `json:"sql,omitempty"`       // Statements run as templates over the role; empty statements are skipped
+	Command   []string `json:"command,omitempty"`   // Command and arguments run with the role as JSON on stdin
+}
+
+// ProfileConfig holds the template variables and connection overrides of a cluster (sync profile)
+type ProfileConfig struct {
+	Env                  string                 `json:"env,omitempty"`                    // Environment name available as {{ .Env }} (default: the profile name)
+	Vars                 map[string]string      `json:"vars,omitempty"`                   // Additional values available as {{ .Vars.name }}
+	Host                 string                 `json:"host,omitempty"`                   // Database host of the cluster, overriding POSTGRES_HOST
+	Port                 int                    `json:"port,omitempty"`                   // Database port of the cluster, overriding POSTGRES_PORT
+	Database             string                 `json:"database,omitempty"`               // Database to connect to, overriding POSTGRES_DB
+	SSLMode              *SSLModeConfig         `json:"ssl_mode,omitempty"`               // SSL mode of the cluster's connection, overriding POSTGRES_SSLMODE
+	ResumeTimeoutSeconds int                    `json:"resume_timeout_seconds,omitempty"` // Wait for a paused serverless cluster to resume, overriding POSTGRES_RESUME_TIMEOUT
+	Endpoints            []string               `json:"endpoints,omitempty"`              // Endpoints tried for the writer when host is a read replica, overriding POSTGRES_ENDPOINTS
+	SSLCertificates      *SSLCertificatesConfig `json:"ssl_certificates,omitempty"`       // Certificate files of the cluster's connection, overriding POSTGRES_SSL* variables
+}
+
+// SSLModeConfig sets the sslmode of the database connection for each authentication method
+type SSLModeConfig struct {
+	Password string `json:"password,omitempty"` // SSL mode when connecting with a password
+	IAM      string `json:"iam,omitempty"`      // SSL mode when connecting with an IAM token
+}
+
+// SSLRootCertRDS is the root_cert value that verifies servers with the CA bundle AWS
+// publishes for RDS, downloaded on first use
+const SSLRootCertRDS = "rds"
+
+// SSLCertificatesConfig sets the certificate files of the database connection, as libpq's
+// sslrootcert, sslcert and sslkey do
+type SSLCertificatesConfig struct {
+	RootCert string `json:"root_cert,omitempty"` // CA certificates the server certificate is verified with, or "rds" for the RDS CA bundle
+	Cert     string `json:"cert,omitempty"`      // Client certificate presented to the server
+	Key      string `json:"key,omitempty"`       // Private key of the client certificate
+}
+
+// For returns the SSL mode configured for the authentication method, or an empty string
+// when none is
+func (s *SSLModeConfig) For(iamAuth bool) string {
+	if s == nil {
+		return ""
+	}
+	if iamAuth {
+		return s.IAM
+	}
+	return s.Password
 }
 
 // UserConfig represents a user configuration from the config file
 type UserConfig struct {
-	Username        string   `json:"username"`
-	Password        string   `json:"password,omitempty"`        // Optional, not used for IAM auth
-	Groups          []string `json:"groups"`
-	Privileges      []string `json:"privileges"`
-	Databases       []string `json:"databases"`
-	Enabled         bool     `json:"enabled"`
-	Description     string   `json:"description,omitempty"`
-	AuthMethod      string   `json:"auth_method,omitempty"`     // "iam" or "password" (default: "password")
-	IAMRole         string   `json:"iam_role,omitempty"`        // AWS IAM role ARN for IAM authentication
-	CanLogin        bool     `json:"can_login"`                 // Whether user can login (default: true)
-	ConnectionLimit int      `json:"connection_limit,omitempty"` // Max connections (default: -1, unlimited)
+	Username           string                 `json:"username"`
+	Password           string                 `json:"password,omitempty"`          // Optional, not used for IAM auth
+	GeneratePassword   bool                   `json:"generate_password,omitempty"` // Generate a random password when the user is created
+	PasswordLength     int                    `json:"password_length,omitempty"`   // Length of a generated password (default: 32)
+	PasswordCharset    string                 `json:"password_charset,omitempty"`  // Characters a generated password is drawn from
+	Groups             []string               `json:"groups"`
+	TemporaryGroups    []TemporaryMembership  `json:"temporary_groups,omitempty"` // Groups granted until they expire
+	Privileges         []string               `json:"privileges"`
+	Databases          []string               `json:"databases"`
+	Enabled            bool                   `json:"enabled"`                       // Disabled users are locked (NOLOGIN) rather than dropped
+	Absent             bool                   `json:"absent,omitempty"`              // Remove the user from the database
+	DeletionProtection bool                   `json:"deletion_protection,omitempty"` // Refuse to drop the role unless protection is overridden
+	Description        string                 `json:"description,omitempty"`
+	AuthMethod         string                 `json:"auth_method,omitempty"`       // "iam" or "password" (default: "password")
+	AuthMethods        []string               `json:"auth_methods,omitempty"`      // Several auth methods, e.g. ["iam", "password"] for a password fallback
+	CertCommonName     string                 `json:"cert_cn,omitempty"`           // Client certificate CN mapped to this user (cert auth, default: username)
+	CertSubjectDN      string                 `json:"cert_dn,omitempty"`           // Client certificate subject DN mapped to this user (cert auth, PostgreSQL 14+)
+	Source             string                 `json:"source,omitempty"`            // Identity source the user was imported from, e.g. "ldap"
+	Clusters           []string               `json:"clusters,omitempty"`          // Clusters (sync profiles) the user applies to (default: all)
+	IAMRole            string                 `json:"iam_role,omitempty"`          // AWS IAM role ARN for IAM authentication
+	CanLogin           bool                   `json:"can_login"`                   // Whether user can login (default: true)
+	NoInherit          bool                   `json:"no_inherit,omitempty"`        // NOINHERIT: group privileges only apply after SET ROLE
+	ConnectionLimit    int                    `json:"connection_limit,omitempty"`  // Max connections (default: -1, unlimited)
+	ValidUntil         *time.Time             `json:"valid_until,omitempty"`       // Password expiry set with VALID UNTIL; unset leaves the role's expiry alone
+	ExtensionSchemas   []ExtensionSchemaGrant `json:"extension_schemas,omitempty"` // Grants on extension-owned schemas
+	LargeObjects       []LargeObjectGrant     `json:"large_objects,omitempty"`     // Grants on large objects
+	Metadata           map[string]string      `json:"metadata,omitempty"`          // Free-form values passed to hooks, e.g. a workload priority
+	PreviousNames      []string               `json:"previous_names,omitempty"`    // Legacy names the user is renamed from instead of being created
+	ExternalID         string                 `json:"external_id,omitempty"`       // Identity provider ID the user was created for, e.g. a Cognito sub
+	Owner              string                 `json:"owner,omitempty"`             // Person accountable for the role, recorded in its comment
+	Team               string                 `json:"team,omitempty"`              // Team accountable for the role, recorded in its comment
+	Ticket             string                 `json:"ticket,omitempty"`            // Ticket that requested the role, recorded in its comment
+	Settings           map[string]string      `json:"settings,omitempty"`          // Role settings set with ALTER ROLE ... SET, e.g. search_path or statement_timeout
+}
+
+const (
+	// AuthMethodPassword authenticates a user with a managed password
+	AuthMethodPassword = "password"
+	// AuthMethodIAM authenticates a user with AWS RDS IAM tokens through the rds_iam role
+	AuthMethodIAM = "iam"
+	// AuthMethodCert authenticates a user with a client certificate, without a password
+	AuthMethodCert = "cert"
+)
+
+// TemporaryMembership is a group membership that is granted until it expires and revoked after
+type TemporaryMembership struct {
+	Group     string    `json:"group"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ActiveGroups returns the groups a user is meant to be a member of at a point in time: its
+// groups and the temporary groups that have not expired yet
+func (u *UserConfig) ActiveGroups(now time.Time) []string {
+	groups := append([]string{}, u.Groups...)
+	for _, membership := range u.TemporaryGroups {
+		if now.Before(membership.ExpiresAt) {
+			groups = append(groups, membership.Group)
+		}
+	}
+	return groups
+}
+
+// AddDefaultGroups adds the default groups a user does not list yet to its groups. Disabled
+// and absent users get none. The groups are copied, so a user copied from a configuration
+// can be changed without changing the configuration.
+func (u *UserConfig) AddDefaultGroups(defaults []string) {
+	if !u.Enabled || u.Absent || len(defaults) == 0 {
+		return
+	}
+
+	groups := append([]string{}, u.Groups...)
+	for _, group := range defaults {
+		listed := false
+		for _, existing := range groups {
+			if existing == group {
+				listed = true
+				break
+			}
+		}
+		if !listed {
+			groups = append(groups, group)
+		}
+	}
+	u.Groups = groups
+}
+
+// EffectiveAuthMethods returns the auth methods of a user, combining auth_method and
+// auth_methods and defaulting to password authentication
+func (u *UserConfig) EffectiveAuthMethods() []string {
+	if len(u.AuthMethods) > 0 {
+		return u.AuthMethods
+	}
+	if u.AuthMethod != "" {
+		return []string{u.AuthMethod}
+	}
+	return []string{AuthMethodPassword}
+}
+
+// HasAuthMethod reports whether a user authenticates with the given method
+func (u *UserConfig) HasAuthMethod(method string) bool {
+	for _, m := range u.EffectiveAuthMethods() {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// MaxIdentifierLength is the longest role name PostgreSQL keeps, in bytes (NAMEDATALEN - 1).
+// Longer names are silently truncated, and non-ASCII characters take two to four bytes each.
+const MaxIdentifierLength = 63
+
+// NormalizeIdentifier returns a role name in Unicode NFC form. The same name typed on
+// different systems, such as an accented Cognito login, can arrive precomposed or decomposed;
+// PostgreSQL compares names byte by byte, so without normalizing it would be two roles.
+func NormalizeIdentifier(name string) string {
+	return norm.NFC.String(name)
 }
 
+// CheckIdentifier reports a role name PostgreSQL would reject or silently change: an empty
+// name, invalid UTF-8, control characters or more than MaxIdentifierLength bytes
+func CheckIdentifier(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("empty role name")
+	case !utf8.ValidString(name):
+		return fmt.Errorf("role name %q is not valid UTF-8", name)
+	case strings.IndexFunc(name, unicode.IsControl) >= 0:
+		return fmt.Errorf("role name %q contains a control character", name)
+	case len(name) > MaxIdentifierLength:
+		return fmt.Errorf("role name %q is %d bytes long, PostgreSQL keeps only %d", name, len(name), MaxIdentifierLength)
+	}
+	return nil
+}
+
+// CheckSettingName reports a role setting name that cannot be set with ALTER ROLE ... SET:
+// names are lowercase letters, digits and underscores, with a dot for custom settings such
+// as app.tenant
+func CheckSettingName(name string) error {
+	if !settingNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid setting name %q", name)
+	}
+	return nil
+}
+
+// settingNamePattern matches the setting names CheckSettingName accepts
+var settingNamePattern = regexp.MustCompile(`^[a-z_][a-z0-9_]*(\.[a-z_][a-z0-9_]*)?$`)
+
 // GroupConfig represents a group/role configuration
 type GroupConfig struct {
-	Name        string   `json:"name"`
-	Privileges  []string `json:"privileges"`
-	Databases   []string `json:"databases"`
-	Description string   `json:"description,omitempty"`
-	Inherit     bool     `json:"inherit"`
+	Name             string                 `json:"name"`
+	Privileges       []string               `json:"privileges"`
+	Databases        []string               `json:"databases"`
+	Description      string                 `json:"description,omitempty"`
+	Inherit          bool                   `json:"inherit"`
+	MemberOf         []string               `json:"member_of,omitempty"`         // Parent groups this group is granted to
+	Clusters         []string               `json:"clusters,omitempty"`          // Clusters (sync profiles) the group applies to (default: all)
+	ExtensionSchemas []ExtensionSchemaGrant `json:"extension_schemas,omitempty"` // Grants on extension-owned schemas
+	LargeObjects     []LargeObjectGrant     `json:"large_objects,omitempty"`     // Grants on large objects
+	Owner            string                 `json:"owner,omitempty"`             // Person accountable for the role, recorded in its comment
+	Team             string                 `json:"team,omitempty"`              // Team accountable for the role, recorded in its comment
+	Ticket           string                 `json:"ticket,omitempty"`            // Ticket that requested the role, recorded in its comment
+	Settings         map[string]string      `json:"settings,omitempty"`          // Role settings set with ALTER ROLE ... SET; members do not inherit them
+}
+
+// ExtensionSchemaGrant grants access to the schema of an installed extension (e.g. cron, postgis)
+type ExtensionSchemaGrant struct {
+	Extension  string   `json:"extension"`            // Extension name, e.g. "pg_cron" or "postgis"
+	Schema     string   `json:"schema,omitempty"`     // Schema to grant on (default: the schema the extension is installed in)
+	Privileges []string `json:"privileges,omitempty"` // Schema privileges (default: USAGE)
+	Functions  bool     `json:"functions,omitempty"`  // Also grant EXECUTE on all functions in the schema
+	Database   string   `json:"database,omitempty"`   // Database the extension is installed in (default: the connected database)
+}
+
+// LargeObjectGrant grants privileges on a large object
+type LargeObjectGrant struct {
+	OID        uint32   `json:"oid"`                // Large object OID
+	Privileges []string `json:"privileges"`         // SELECT and/or UPDATE
+	Database   string   `json:"database,omitempty"` // Database the large object is stored in (default: the connected database)
+}
+
+// SchemaConfig is a schema that sync creates when it does not exist, gives to its owner and
+// grants privileges on
+type SchemaConfig struct {
+	Name     string        `json:"name"`
+	Owner    string        `json:"owner,omitempty"`    // Role that owns the schema (default: the connected role when created, unchanged otherwise)
+	Grants   []SchemaGrant `json:"grants,omitempty"`   // Privileges granted on the schema
+	Database string        `json:"database,omitempty"` // Database the schema belongs to (default: the connected database)
+}
+
+// SchemaGrant grants privileges on a schema to a role
+type SchemaGrant struct {
+	Role       string   `json:"role"`
+	Privileges []string `json:"privileges,omitempty"` // USAGE, CREATE or ALL (default: USAGE)
+}
+
+// GrantPrivileges returns the privileges of a schema grant, USAGE when none are configured
+func (g SchemaGrant) GrantPrivileges() []string {
+	if len(g.Privileges) == 0 {
+		return []string{"USAGE"}
+	}
+	return g.Privileges
+}
+
+// PolicyConfig attaches roles to a row level security policy, creating the policy when it does not exist
+type PolicyConfig struct {
+	Name      string   `json:"name"`                 // Policy name (template when per_role is set)
+	Table     string   `json:"table"`                // Table the policy is defined on, optionally schema-qualified (default schema: public)
+	Roles     []string `json:"roles"`                // Roles the policy applies to
+	Command   string   `json:"command,omitempty"`    // ALL, SELECT, INSERT, UPDATE or DELETE (default: ALL)
+	Using     string   `json:"using,omitempty"`      // USING expression template, used when creating the policy
+	WithCheck string   `json:"with_check,omitempty"` // WITH CHECK expression template, used when creating the policy
+	PerRole   bool     `json:"per_role,omitempty"`   // Generate one policy per role from the name and expression templates
+	EnableRLS bool     `json:"enable_rls,omitempty"` // Enable row level security on the table
+	Database  string   `json:"database,omitempty"`   // Database the table belongs to (default: the connected database)
 }
 
 // DatabaseUser represents an actual database user
 type DatabaseUser struct {
-	Username    string
-	Groups      []string
-	Privileges  []string
-	Databases   []string
-	Exists      bool
-	LastChecked time.Time
+	Username        string     `json:"username"`
+	Description     string     `json:"description,omitempty"`
+	Groups          []string   `json:"groups"`
+	Privileges      []string   `json:"privileges,omitempty"`
+	Databases       []string   `json:"databases,omitempty"`
+	Exists          bool       `json:"-"`
+	LastChecked     time.Time  `json:"-"`
+	CanLogin        bool       `json:"can_login"`
+	ConnectionLimit int        `json:"connection_limit"`      // -1 when unlimited
+	ValidUntil      *time.Time `json:"valid_until,omitempty"` // Password expiry, nil when it never expires
+}
+
+// ConnectionUsage compares a login role's connection limit with its current connections
+type ConnectionUsage struct {
+	Role        string `json:"role"`
+	Limit       int    `json:"limit"` // CONNECTION LIMIT, -1 when unlimited
+	Connections int    `json:"connections"`
+}
+
+// Utilization returns the fraction of the connection limit in use, or 0 when the role is
+// unlimited or not allowed to connect at all
+func (u *ConnectionUsage) Utilization() float64 {
+	if u.Limit <= 0 {
+		return 0
+	}
+	return float64(u.Connections) / float64(u.Limit)
+}
+
+// ConnectionInfo describes an established database connection and the role it authenticated as
+type ConnectionInfo struct {
+	Host          string `json:"host"`
+	Port          int    `json:"port"`
+	Database      string `json:"database"`
+	Role          string `json:"role"`         // Role the connection authenticated as (session_user)
+	CurrentRole   string `json:"current_role"` // Role privileges are checked against (current_user)
+	Superuser     bool   `json:"superuser"`
+	CreateRole    bool   `json:"create_role"`
+	AuthMethod    string `json:"auth_method"`     // password or iam
+	SSLMode       string `json:"ssl_mode"`        // sslmode the connection was opened with
+	SSLModeSource string `json:"ssl_mode_source"` // Where the SSL mode came from: profile, env, config or default
+	SSL           bool   `json:"ssl"`             // Whether the connection is encrypted
+	SSLVersion    string `json:"ssl_version,omitempty"`
+	ServerVersion string `json:"server_version"`
+}
+
+// ConfigRevision identifies the configuration last applied to a cluster
+type ConfigRevision struct {
+	Checksum    string    `json:"checksum"` // Checksum of the configuration file, sha256:<hex>
+	Profile     string    `json:"profile,omitempty"`
+	ToolVersion string    `json:"tool_version,omitempty"`
+	AppliedAt   time.Time `json:"applied_at"`
+	AppliedBy   string    `json:"applied_by,omitempty"`
+}
+
+// DatabaseAccess describes a database, its owner and the roles allowed to connect to it
+type DatabaseAccess struct {
+	Name            string   `json:"name"`
+	Owner           string   `json:"owner"`
+	ConnectionLimit int      `json:"connection_limit"` // CONNECTION LIMIT, -1 when unlimited
+	Connect         []string `json:"connect"`          // Roles holding CONNECT, PUBLIC when everyone may connect
+}
+
+// ReviewRole is a role as listed in an access review, with everything an auditor asks
+// about: what it may do, who it belongs to, who created it and when its password changed
+type ReviewRole struct {
+	Name               string           `json:"name"`
+	Kind               string           `json:"kind"` // user or group when managed by this tool, otherwise unmanaged
+	Description        string           `json:"description,omitempty"`
+	Owner              string           `json:"owner,omitempty"` // Person accountable for the role
+	Team               string           `json:"team,omitempty"`
+	Ticket             string           `json:"ticket,omitempty"`
+	CreatedBy          string           `json:"created_by,omitempty"` // Principal that created the role
+	CanLogin           bool             `json:"can_login"`
+	Superuser          bool             `json:"superuser"`
+	CreateRole         bool             `json:"create_role"`
+	CreateDB           bool             `json:"create_db"`
+	ConnectionLimit    int              `json:"connection_limit"` // -1 when unlimited
+	Auth               string           `json:"auth,omitempty"`   // Auth methods recorded when the user was created, e.g. iam,password
+	DeletionProtection bool             `json:"deletion_protection"`
+	MemberOf           []string         `json:"member_of"`
+	Members            []string         `json:"members"`
+	Grants             []PrivilegeGrant `json:"grants"`
+	OwnedDatabases     []string         `json:"owned_databases"` // Databases the role owns and so holds every privilege on
+	CreatedAt          *time.Time       `json:"created_at,omitempty"`
+	ModifiedBy         string           `json:"modified_by,omitempty"`
+	ModifiedAt         *time.Time       `json:"modified_at,omitempty"`
+	PasswordChangedAt  *time.Time       `json:"password_changed_at,omitempty"` // When this tool last set the password
+	ValidUntil         *time.Time       `json:"valid_until,omitempty"`         // Password expiry, nil when it never expires
+}
+
+// ClusterRole is a role as it exists in the cluster, read to export a configuration
+type ClusterRole struct {
+	Name               string
+	Kind               string // user or group when managed by this tool, empty otherwise
+	CanLogin           bool
+	Inherit            bool
+	Superuser          bool
+	ConnectionLimit    int        // -1 when unlimited
+	ValidUntil         *time.Time // Password expiry, nil when it never expires
+	Description        string
+	Owner              string
+	Team               string
+	Ticket             string
+	ExternalID         string
+	AuthMethods        []string // Auth methods recorded when the user was created
+	DeletionProtection bool
+	Attributes         []string // Attributes the configuration cannot express, e.g. CREATEDB
+	MemberOf           []string
+	Grants             []PrivilegeGrant  // Database privileges, excluding databases the role owns
+	SchemaGrants       []SchemaPrivilege // Schema privileges in the connected database
+}
+
+// SchemaPrivilege is a privilege a role holds on a schema of the connected database
+type SchemaPrivilege struct {
+	Schema    string
+	Privilege string
+	Extension string // Extension installed in the schema, empty when there is none
+}
+
+// AssumableRole is a role a user is a member of, directly or through other groups, with how
+// the user gets its privileges
+type AssumableRole struct {
+	User      string `json:"user"`
+	Role      string `json:"role"`
+	Inherited bool   `json:"inherited"`    // The privileges apply without SET ROLE
+	CanSet    bool   `json:"can_set_role"` // The user may SET ROLE to it
 }
 
 // DatabaseGroup represents an actual database role/group
@@ -52,6 +653,17 @@ type DatabaseGroup struct {
 	LastChecked time.Time
 }
 
+// ClusterCatalog lists the roles and databases that already exist in a cluster, and
+// what the connected admin role is allowed to do
+type ClusterCatalog struct {
+	Roles              []string
+	Databases          []string
+	CurrentUser        string   // Role the manager is connected as
+	Superuser          bool     // Whether the connected role is a superuser
+	CreateRole         bool     // Whether the connected role has CREATEROLE
+	GrantableDatabases []string // Databases the connected role can grant privileges on
+}
+
 // OperationResult represents the result of a user management operation
 type OperationResult struct {
 	Operation string
@@ -63,26 +675,392 @@ type OperationResult struct {
 
 // SyncResult represents the result of a synchronization operation
 type SyncResult struct {
-	UsersCreated   []string
-	UsersModified  []string
-	UsersRemoved   []string
-	GroupsCreated  []string
-	GroupsModified []string
-	GroupsRemoved  []string
-	Errors         []error
+	UsersCreated       []string
+	UsersModified      []string
+	UsersRemoved       []string
+	UsersDisabled      []string
+	UsersRenamed       []RoleRename
+	GroupsCreated      []string
+	GroupsModified     []string
+	GroupsRemoved      []string
+	PoliciesApplied    []string
+	SchemasApplied     []string            // Configured schemas created, given to their owner or granted on
+	MembershipsRevoked []Membership        // Live memberships in managed groups revoked because they are not in config
+	MembershipsExpired []MembershipExpiry  // Temporary memberships revoked because they expired
+	MembershipsExtra   []Membership        // Live memberships in managed groups not in config, left in place
+	PrivilegesRevoked  []PrivilegeGrant    // Live database privileges revoked because they are not in config
+	PrivilegesExtra    []PrivilegeGrant    // Live database privileges not in config, left in place
+	Warnings           []SyncWarning       // Conditions sync worked around without failing
+	Resumed            []string            // Entities skipped because an interrupted sync already completed them
+	GeneratedPasswords []GeneratedPassword // Passwords generated for users created by this sync, reported once
+	RotatedPasswords   []GeneratedPassword // Expired passwords replaced by this sync, to be published once it is done
+	RolledBack         bool                // A transactional sync failed and none of its changes were kept
+	Statements         []PlannedStatement  // Statements a dry run would have executed, in order
+	Elevated           []PlannedStatement  // Statements left to a role with elevated access, each with what it needs as the problem
+	Errors             []error
+	Timings            []OperationTiming // Execution time of every operation, in the order they ran
+	Duration           time.Duration     // Total sync duration
+	StatementsExecuted int               // Statements the sync ran on the connected database, none in a dry run
+	QueriesRun         int               // Catalog queries the sync ran on the connected database
+	Principal          string            // Who initiated the sync, e.g. "aws:arn:aws:iam::123456789012:user/alice"
+	Profile            string            // Cluster (sync profile) the result applies to, empty for the default
+	UsersDeclared      int               // Users the configuration declares for the cluster
+	GroupsDeclared     int               // Groups the configuration declares for the cluster
+}
+
+// Warn records a warning about a role, or about the whole sync when the role is empty
+func (r *SyncResult) Warn(role, message string) {
+	r.Warnings = append(r.Warnings, SyncWarning{Role: role, Message: message})
+}
+
+// ChangeCount is the number of changes of one kind a sync made
+type ChangeCount struct {
+	Kind  string `json:"kind"`
+	Count int    `json:"count"`
+}
+
+// Changes returns the number of changes the sync made by kind, in a fixed order
+func (r *SyncResult) Changes() []ChangeCount {
+	return []ChangeCount{
+		{"users_created", len(r.UsersCreated)},
+		{"users_modified", len(r.UsersModified)},
+		{"users_removed", len(r.UsersRemoved)},
+		{"users_disabled", len(r.UsersDisabled)},
+		{"users_renamed", len(r.UsersRenamed)},
+		{"passwords_rotated", len(r.RotatedPasswords)},
+		{"groups_created", len(r.GroupsCreated)},
+		{"groups_modified", len(r.GroupsModified)},
+		{"groups_removed", len(r.GroupsRemoved)},
+		{"policies_applied", len(r.PoliciesApplied)},
+		{"schemas_applied", len(r.SchemasApplied)},
+		{"memberships_revoked", len(r.MembershipsRevoked)},
+		{"memberships_expired", len(r.MembershipsExpired)},
+		{"privileges_revoked", len(r.PrivilegesRevoked)},
+	}
+}
+
+// RoleRename is a role renamed from a legacy name to the name the configuration declares
+type RoleRename struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// MembershipExpiry is a temporary membership with the time it expires
+type MembershipExpiry struct {
+	Member    string    `json:"member"`
+	Group     string    `json:"group"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ExpiryResult is the outcome of revoking expired temporary memberships
+type ExpiryResult struct {
+	Expired  []MembershipExpiry // Memberships revoked because they expired
+	Upcoming []MembershipExpiry // Memberships that expire within the reporting window, soonest first
+	Errors   []error
+}
+
+// OrphanedIdentity is a user provisioned for an identity provider identity that no longer
+// exists or is no longer active there
+type OrphanedIdentity struct {
+	Username   string `json:"username"`
+	ExternalID string `json:"external_id"`
+	Action     string `json:"action"` // What was done: disabled or dropped
+}
+
+// IdentityReconcileResult is the outcome of reconciling users with an identity provider
+type IdentityReconcileResult struct {
+	Checked  int                // Users with a recorded identity provider ID
+	Orphaned []OrphanedIdentity // Users locked or dropped because their identity is gone
+	Errors   []error
+}
+
+// GeneratedPassword is the password generated for a user when it was created
+type GeneratedPassword struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// PlannedStatement is a statement a dry run would have executed, with the entity it belongs to
+type PlannedStatement struct {
+	Entity  string `json:"entity"` // e.g. "user:app_user"; empty for statements of the sync as a whole
+	Query   string `json:"query"`
+	Problem string `json:"problem,omitempty"` // Why the statement would fail, found by read-only checks; empty when none
+}
+
+// SyncWarning is a condition sync noticed and worked around without failing, such as a
+// disabled user that does not exist or a membership left in place
+type SyncWarning struct {
+	Role    string `json:"role,omitempty"` // Role the warning is about; empty for the whole sync
+	Message string `json:"message"`
+}
+
+// PrivilegeGrant is a privilege held by a role on a database
+type PrivilegeGrant struct {
+	Target    string `json:"target"`
+	Privilege string `json:"privilege"`
+	Database  string `json:"database"`
+}
+
+// Membership is a member role's direct membership in a group
+type Membership struct {
+	Member string `json:"member"`
+	Group  string `json:"group"`
+}
+
+// DriftReport describes how far a cluster is from a configuration
+type DriftReport struct {
+	Profile                 string                 `json:"profile,omitempty"`
+	RolesMissing            []string               `json:"roles_missing,omitempty"`             // Configured users and groups that do not exist
+	UsersToRemove           []string               `json:"users_to_remove,omitempty"`           // Absent users that still exist
+	UsersToDisable          []string               `json:"users_to_disable,omitempty"`          // Disabled users that can still log in
+	RolesToRename           []RoleRename           `json:"roles_to_rename,omitempty"`           // Users that exist under a previous name
+	MembershipsMissing      []Membership           `json:"memberships_missing,omitempty"`       // Configured memberships of existing roles not granted
+	MembershipsExtra        []Membership           `json:"memberships_extra,omitempty"`         // Live memberships in managed groups not in config
+	PrivilegesMissing       []PrivilegeGrant       `json:"privileges_missing,omitempty"`        // Configured database privileges of existing roles not granted
+	PrivilegesExtra         []PrivilegeGrant       `json:"privileges_extra,omitempty"`          // Live database privileges not in config
+	AttributesChanged       []AttributeChange      `json:"attributes_changed,omitempty"`        // Attributes of existing roles that sync would change
+	RolesToPrune            []string               `json:"roles_to_prune,omitempty"`            // Managed roles no longer in config, when pruning
+	RoleConflicts           []RoleConflict         `json:"role_conflicts,omitempty"`            // Managed roles declared as the other kind of role
+	SchemasMissing          []string               `json:"schemas_missing,omitempty"`           // Configured schemas that do not exist
+	SchemaOwnersChanged     []SchemaOwnerChange    `json:"schema_owners_changed,omitempty"`     // Configured schemas owned by another role
+	SchemaPrivilegesMissing []SchemaPrivilegeGrant `json:"schema_privileges_missing,omitempty"` // Configured schema privileges not granted
+	Error                   string                 `json:"error,omitempty"`                     // Why the cluster could not be compared
+}
+
+// Differences returns the number of differences between the cluster and the configuration
+func (r *DriftReport) Differences() int {
+	return len(r.RolesMissing) + len(r.UsersToRemove) + len(r.UsersToDisable) + len(r.RolesToRename) +
+		len(r.MembershipsMissing) + len(r.MembershipsExtra) +
+		len(r.PrivilegesMissing) + len(r.PrivilegesExtra) +
+		len(r.AttributesChanged) + len(r.RolesToPrune) + len(r.RoleConflicts) +
+		len(r.SchemasMissing) + len(r.SchemaOwnersChanged) + len(r.SchemaPrivilegesMissing)
+}
+
+// SchemaOwnerChange is a configured schema owned by another role than the configuration declares
+type SchemaOwnerChange struct {
+	Schema  string `json:"schema"`
+	Current string `json:"current"`
+	Desired string `json:"desired"`
+}
+
+// SchemaPrivilegeGrant is a privilege of a role on a configured schema
+type SchemaPrivilegeGrant struct {
+	Target    string `json:"target"`
+	Privilege string `json:"privilege"`
+	Schema    string `json:"schema"`
+}
+
+// PlannedAction is one action of a plan, as compared between two saved plans
+type PlannedAction struct {
+	Kind   string `json:"kind"`             // "add", "change", "destroy" or "conflict"
+	Target string `json:"target"`           // What the action applies to, e.g. "membership app_user in readers"
+	Detail string `json:"detail,omitempty"` // How the target changes, e.g. "login: true -> false"
+}
+
+// Actions returns the actions of a plan in the order plan prints them
+func (r *DriftReport) Actions() []PlannedAction {
+	var actions []PlannedAction
+	add := func(kind, target, detail string) {
+		actions = append(actions, PlannedAction{Kind: kind, Target: target, Detail: detail})
+	}
+
+	for _, conflict := range r.RoleConflicts {
+		add("conflict", conflict.Declared+" "+conflict.Role, "managed as a "+conflict.Existing)
+	}
+	for _, role := range r.RolesMissing {
+		add("add", "role "+role, "")
+	}
+	for _, attribute := range r.AttributesChanged {
+		add("change", "role "+attribute.Role+" "+attribute.Attribute, fmt.Sprintf("%q -> %q", attribute.Current, attribute.Desired))
+	}
+	for _, rename := range r.RolesToRename {
+		add("change", "user "+rename.From, "renamed to "+rename.To)
+	}
+	for _, user := range r.UsersToDisable {
+		add("change", "user "+user, "login: true -> false")
+	}
+	for _, membership := range r.MembershipsMissing {
+		add("add", "membership "+membership.Member+" in "+membership.Group, "")
+	}
+	for _, membership := range r.MembershipsExtra {
+		add("destroy", "membership "+membership.Member+" in "+membership.Group, "")
+	}
+	for _, grant := range r.PrivilegesMissing {
+		add("add", "grant "+grant.Privilege+" on database "+grant.Database+" to "+grant.Target, "")
+	}
+	for _, grant := range r.PrivilegesExtra {
+		add("destroy", "grant "+grant.Privilege+" on database "+grant.Database+" from "+grant.Target, "")
+	}
+	for _, schema := range r.SchemasMissing {
+		add("add", "schema "+schema, "")
+	}
+	for _, owner := range r.SchemaOwnersChanged {
+		add("change", "schema "+owner.Schema+" owner", fmt.Sprintf("%q -> %q", owner.Current, owner.Desired))
+	}
+	for _, grant := range r.SchemaPrivilegesMissing {
+		add("add", "grant "+grant.Privilege+" on schema "+grant.Schema+" to "+grant.Target, "")
+	}
+	for _, user := range r.UsersToRemove {
+		add("destroy", "user "+user, "absent")
+	}
+	for _, role := range r.RolesToPrune {
+		add("destroy", "role "+role, "pruned")
+	}
+
+	return actions
+}
+
+// PlanComparison describes how the actions of a plan differ from those of a previous plan
+type PlanComparison struct {
+	Added   []PlannedAction       `json:"added"`   // Actions only the new plan takes
+	Removed []PlannedAction       `json:"removed"` // Actions only the previous plan takes
+	Changed []PlannedActionChange `json:"changed"` // Actions both plans take on a target, differently
+}
+
+// PlannedActionChange is an action both plans take on the same target with different details
+type PlannedActionChange struct {
+	Previous PlannedAction `json:"previous"`
+	Current  PlannedAction `json:"current"`
+}
+
+// ComparePlans compares the actions of two plans. Actions match when they are of the same
+// kind and apply to the same target; matching actions with different details are changed.
+func ComparePlans(previous, current *DriftReport) *PlanComparison {
+	key := func(action PlannedAction) string {
+		return action.Kind + " " + action.Target
+	}
+
+	previousActions := make(map[string]PlannedAction)
+	for _, action := range previous.Actions() {
+		previousActions[key(action)] = action
+	}
+	currentActions := make(map[string]bool)
+
+	comparison := &PlanComparison{Added: []PlannedAction{}, Removed: []PlannedAction{}, Changed: []PlannedActionChange{}}
+	for _, action := range current.Actions() {
+		currentActions[key(action)] = true
+		old, ok := previousActions[key(action)]
+		switch {
+		case !ok:
+			comparison.Added = append(comparison.Added, action)
+		case old.Detail != action.Detail:
+			comparison.Changed = append(comparison.Changed, PlannedActionChange{Previous: old, Current: action})
+		}
+	}
+	for _, action := range previous.Actions() {
+		if !currentActions[key(action)] {
+			comparison.Removed = append(comparison.Removed, action)
+		}
+	}
+
+	return comparison
+}
+
+// Differences returns the number of actions that differ between the plans
+func (c *PlanComparison) Differences() int {
+	return len(c.Added) + len(c.Removed) + len(c.Changed)
+}
+
+// RoleConflict is a role that sync manages as a user but the configuration declares as a
+// group, or the other way round. Users and groups are both roles in PostgreSQL and share
+// one namespace, so sync refuses to turn one into the other.
+type RoleConflict struct {
+	Role     string `json:"role"`
+	Existing string `json:"existing"` // "user" or "group", as recorded on the role
+	Declared string `json:"declared"` // "user" or "group", as declared in the configuration
+}
+
+// AttributeChange is an attribute of an existing role that differs from the configuration
+type AttributeChange struct {
+	Role      string `json:"role"`
+	Attribute string `json:"attribute"` // e.g. "description" or "deletion_protection"
+	Current   string `json:"current"`
+	Desired   string `json:"desired"`
+}
+
+// RoleAttributes are the attributes of a live role that the configuration controls
+type RoleAttributes struct {
+	CanLogin           bool
+	Inherit            bool
+	Superuser          bool
+	CreateRole         bool
+	ConnectionLimit    int        // -1 when unlimited
+	ValidUntil         *time.Time // Password expiry, nil when it never expires
+	Description        string
+	DeletionProtection bool
+	ManagedAs          string // "user" or "group" once sync manages the role, empty otherwise
+	Owner              string
+	Team               string
+	Ticket             string
+	PasswordChangedAt  *time.Time // When this tool last set the password, nil when it never did
+	AuthMethods        []string   // Auth methods recorded when the user was created, empty when unknown
+}
+
+// OperationTiming records how long a single sync operation took
+type OperationTiming struct {
+	Entity    string // Entity the operation applied to, e.g. "user:app_user"
+	Operation string // Operation type, e.g. "create", "membership" or "grant"
+	Duration  time.Duration
+}
+
+// TimingSummary aggregates the timings of one operation type
+type TimingSummary struct {
+	Operation     string
+	Count         int
+	Total         time.Duration
+	Max           time.Duration
+	SlowestEntity string
 }
 
 // DatabaseConnection represents database connection configuration
 type DatabaseConnection struct {
-	Host          string
-	Port          int
-	Database      string
-	Username      string
-	Password      string
-	SSLMode       string
-	IAMAuth       bool   // Whether to use IAM authentication for connection
-	AWSRegion     string // AWS region for IAM auth
-	IAMToken      string // IAM auth token (if using IAM authentication)
+	Host           string
+	Port           int
+	Database       string
+	Username       string
+	Password       string
+	Driver         string // Database driver, DriverPQ when empty
+	SSLMode        string
+	SSLModeSource  string        // Where the SSL mode came from: profile, env, config or default
+	SSLRootCert    string        // CA certificates file the server certificate is verified with, or SSLRootCertRDS
+	SSLCert        string        // Client certificate file
+	SSLKey         string        // Private key file of the client certificate
+	IAMAuth        bool          // Whether to use IAM authentication for connection
+	AWSRegion      string        // AWS region for IAM auth
+	IAMToken       string        // IAM auth token (if using IAM authentication)
+	ConnectTimeout time.Duration // Dial timeout of a connection attempt (zero: bounded only by the command)
+	ResumeTimeout  time.Duration // How long to wait for a paused serverless cluster to resume (zero: do not wait)
+	ConnectRetries int           // Connection attempts retried after a transient error, with exponential backoff
+	Pool           PoolConfig    // Connection pool limits (zero values keep the database/sql defaults)
+	Endpoints      []string      // Other endpoints of the cluster, host or host:port, tried for the writer when Host is a read replica
+}
+
+// ParseEndpoint splits a cluster endpoint given as host or host:port, using the default
+// port when it has none
+func ParseEndpoint(endpoint string, defaultPort int) (string, int, error) {
+	// Without a port the whole endpoint is the host
+	host, portText := endpoint, ""
+	if h, p, err := net.SplitHostPort(endpoint); err == nil {
+		host, portText = h, p
+	}
+	if host == "" {
+		return "", 0, fmt.Errorf("invalid endpoint %q: no host", endpoint)
+	}
+	if portText == "" {
+		return host, defaultPort, nil
+	}
+	port, err := strconv.Atoi(portText)
+	if err != nil || port < 1 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid endpoint %q: bad port %q", endpoint, portText)
+	}
+	return host, port, nil
+}
+
+// DialTimeout returns the dial timeout of a connection attempt. A cluster that may be
+// resuming gets the whole resume timeout, since the endpoint holds the connection until the
+// cluster is up.
+func (c *DatabaseConnection) DialTimeout() time.Duration {
+	return max(c.ConnectTimeout, c.ResumeTimeout)
 }
 
 // EventPayload represents a future AWS Cognito event payload
@@ -2,6 +2,7 @@ package structs
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
 	"time"
 )
@@ -217,6 +218,19 @@ func TestSyncResult(t *testing.T) {
 	}
 }
 
+func TestSyncResultWarn(t *testing.T) {
+	result := SyncResult{}
+	result.Warn("app_user", "disabled user does not exist and was not created")
+	result.Warn("", "preflight check failed")
+
+	if len(result.Warnings) != 2 || len(result.Errors) != 0 {
+		t.Fatalf("Expected 2 warnings and no errors, got %+v", result)
+	}
+	if result.Warnings[0].Role != "app_user" || result.Warnings[1].Role != "" {
+		t.Errorf("Unexpected warnings: %+v", result.Warnings)
+	}
+}
+
 func TestEventPayload(t *testing.T) {
 	now := time.Now()
 	event := EventPayload{
@@ -301,3 +315,219 @@ func TestConfigCompleteStructure(t *testing.T) {
 		t.Errorf("Expected connection limit 10, got %d", user.ConnectionLimit)
 	}
 }
+
+func TestUserConfigAuthMethods(t *testing.T) {
+	tests := []struct {
+		name        string
+		user        UserConfig
+		hasPassword bool
+		hasIAM      bool
+	}{
+		{name: "default", user: UserConfig{}, hasPassword: true},
+		{name: "iam", user: UserConfig{AuthMethod: AuthMethodIAM}, hasIAM: true},
+		{name: "iam with password fallback", user: UserConfig{AuthMethods: []string{AuthMethodIAM, AuthMethodPassword}}, hasPassword: true, hasIAM: true},
+		{name: "auth_methods wins", user: UserConfig{AuthMethod: AuthMethodPassword, AuthMethods: []string{AuthMethodIAM}}, hasIAM: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.user.HasAuthMethod(AuthMethodPassword) != tt.hasPassword {
+				t.Errorf("Expected password auth %v, methods %v", tt.hasPassword, tt.user.EffectiveAuthMethods())
+			}
+			if tt.user.HasAuthMethod(AuthMethodIAM) != tt.hasIAM {
+				t.Errorf("Expected IAM auth %v, methods %v", tt.hasIAM, tt.user.EffectiveAuthMethods())
+			}
+		})
+	}
+}
+
+func TestNormalizeIdentifier(t *testing.T) {
+	if name := NormalizeIdentifier("jose\u0301"); name != "jos\u00e9" {
+		t.Errorf("Expected the decomposed name in NFC form, got %q", name)
+	}
+	if name := NormalizeIdentifier("jos\u00e9"); name != "jos\u00e9" {
+		t.Errorf("Expected a name in NFC form to be unchanged, got %q", name)
+	}
+}
+
+func TestCheckIdentifier(t *testing.T) {
+	tests := []struct {
+		name  string
+		role  string
+		valid bool
+	}{
+		{name: "ASCII", role: "app_user", valid: true},
+		{name: "non-ASCII", role: "jürgen", valid: true},
+		{name: "non-Latin", role: "пользователь", valid: true},
+		{name: "63 bytes", role: strings.Repeat("é", 31) + "x", valid: true},
+		{name: "64 bytes", role: strings.Repeat("é", 32)},
+		{name: "empty", role: ""},
+		{name: "invalid UTF-8", role: "j\xfcrgen"},
+		{name: "control character", role: "app\x00user"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckIdentifier(tt.role)
+			if tt.valid && err != nil {
+				t.Errorf("Expected %q to be valid, got %v", tt.role, err)
+			}
+			if !tt.valid && err == nil {
+				t.Errorf("Expected %q to be rejected", tt.role)
+			}
+		})
+	}
+}
+
+func TestUserConfigActiveGroups(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	user := UserConfig{
+		Username: "alice",
+		Groups:   []string{"readers"},
+		TemporaryGroups: []TemporaryMembership{
+			{Group: "admins", ExpiresAt: now.Add(time.Hour)},
+			{Group: "oncall", ExpiresAt: now},
+			{Group: "auditors", ExpiresAt: now.Add(-time.Hour)},
+		},
+	}
+
+	groups := user.ActiveGroups(now)
+	if len(groups) != 2 || groups[0] != "readers" || groups[1] != "admins" {
+		t.Errorf("Expected readers and admins, got %v", groups)
+	}
+	if len(user.Groups) != 1 {
+		t.Errorf("Expected the configured groups to be left alone, got %v", user.Groups)
+	}
+
+	var decoded UserConfig
+	if err := json.Unmarshal([]byte(`{"username":"bob","temporary_groups":[{"group":"admins","expires_at":"2024-06-30T00:00:00Z"}]}`), &decoded); err != nil {
+		t.Fatalf("Failed to decode temporary groups: %v", err)
+	}
+	if len(decoded.TemporaryGroups) != 1 || !decoded.TemporaryGroups[0].ExpiresAt.Equal(time.Date(2024, 6, 30, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected temporary groups: %+v", decoded.TemporaryGroups)
+	}
+}
+
+func TestConnectionUsageUtilization(t *testing.T) {
+	tests := []struct {
+		usage    ConnectionUsage
+		expected float64
+	}{
+		{usage: ConnectionUsage{Limit: 10, Connections: 8}, expected: 0.8},
+		{usage: ConnectionUsage{Limit: -1, Connections: 50}, expected: 0},
+		{usage: ConnectionUsage{Limit: 0, Connections: 0}, expected: 0},
+		{usage: ConnectionUsage{Limit: 4, Connections: 5}, expected: 1.25},
+	}
+
+	for _, tt := range tests {
+		if got := tt.usage.Utilization(); got != tt.expected {
+			t.Errorf("Utilization() of %+v = %v, expected %v", tt.usage, got, tt.expected)
+		}
+	}
+}
+
+func TestParseEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		host     string
+		port     int
+		wantErr  bool
+	}{
+		{endpoint: "writer.cluster-abc.eu-west-1.rds.amazonaws.com", host: "writer.cluster-abc.eu-west-1.rds.amazonaws.com", port: 5432},
+		{endpoint: "10.0.0.5:6432", host: "10.0.0.5", port: 6432},
+		{endpoint: "[::1]:5433", host: "::1", port: 5433},
+		{endpoint: ":5432", wantErr: true},
+		{endpoint: "db:0", wantErr: true},
+		{endpoint: "db:postgres", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		host, port, err := ParseEndpoint(tt.endpoint, 5432)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseEndpoint(%q) error = %v, wantErr %v", tt.endpoint, err, tt.wantErr)
+			continue
+		}
+		if host != tt.host || port != tt.port {
+			t.Errorf("ParseEndpoint(%q) = %s, %d, expected %s, %d", tt.endpoint, host, port, tt.host, tt.port)
+		}
+	}
+}
+
+func TestUserConfigAddDefaultGroups(t *testing.T) {
+	user := UserConfig{Username: "app", Enabled: true, Groups: []string{"audit"}}
+	user.AddDefaultGroups([]string{"base_access", "audit"})
+	if strings.Join(user.Groups, ",") != "audit,base_access" {
+		t.Errorf("Expected the missing default group to be added, got %v", user.Groups)
+	}
+
+	disabled := UserConfig{Username: "former"}
+	disabled.AddDefaultGroups([]string{"base_access"})
+	if len(disabled.Groups) != 0 {
+		t.Errorf("Expected no default groups for a disabled user, got %v", disabled.Groups)
+	}
+
+	if groups := (&Config{}).DefaultGroups(); groups != nil {
+		t.Errorf("Expected no default groups without global_defaults, got %v", groups)
+	}
+}
+
+func TestConfigObjectDatabases(t *testing.T) {
+	config := &Config{
+		Users: []UserConfig{{
+			Username:         "app",
+			ExtensionSchemas: []ExtensionSchemaGrant{{Extension: "postgis", Database: "maps"}, {Extension: "pgcrypto"}},
+		}},
+		Groups:   []GroupConfig{{Name: "readers", LargeObjects: []LargeObjectGrant{{OID: 1234, Database: "archive"}}}},
+		Schemas:  []SchemaConfig{{Name: "reporting", Database: "warehouse"}, {Name: "app"}},
+		Policies: []PolicyConfig{{Name: "tenant", Table: "orders", Database: "maps"}},
+		Hooks:    []HookConfig{{Name: "bootstrap", Databases: []string{"warehouse", "analytics"}}},
+	}
+
+	expected := "analytics,archive,maps,warehouse"
+	if databases := strings.Join(config.ObjectDatabases(), ","); databases != expected {
+		t.Errorf("Expected %s, got %s", expected, databases)
+	}
+	if databases := (&Config{}).ObjectDatabases(); len(databases) != 0 {
+		t.Errorf("Expected no databases, got %v", databases)
+	}
+}
+
+func TestComparePlans(t *testing.T) {
+	previous := &DriftReport{
+		RolesMissing:       []string{"analyst"},
+		MembershipsMissing: []Membership{{Member: "app_user", Group: "readers"}},
+		AttributesChanged:  []AttributeChange{{Role: "app_user", Attribute: "connection_limit", Current: "10", Desired: "5"}},
+		UsersToRemove:      []string{"old_user"},
+	}
+	current := &DriftReport{
+		RolesMissing:       []string{"analyst"},
+		MembershipsMissing: []Membership{{Member: "app_user", Group: "readers"}},
+		MembershipsExtra:   []Membership{{Member: "legacy_user", Group: "writers"}},
+		AttributesChanged:  []AttributeChange{{Role: "app_user", Attribute: "connection_limit", Current: "10", Desired: "8"}},
+	}
+
+	comparison := ComparePlans(previous, current)
+	if comparison.Differences() != 3 {
+		t.Fatalf("Expected 3 differences, got %+v", comparison)
+	}
+	if len(comparison.Added) != 1 || comparison.Added[0] != (PlannedAction{Kind: "destroy", Target: "membership legacy_user in writers"}) {
+		t.Errorf("Expected the extra membership to be newly planned, got %+v", comparison.Added)
+	}
+	if len(comparison.Removed) != 1 || comparison.Removed[0] != (PlannedAction{Kind: "destroy", Target: "user old_user", Detail: "absent"}) {
+		t.Errorf("Expected the removal of old_user to be no longer planned, got %+v", comparison.Removed)
+	}
+	if len(comparison.Changed) != 1 || comparison.Changed[0].Previous.Detail != `"10" -> "5"` || comparison.Changed[0].Current.Detail != `"10" -> "8"` {
+		t.Errorf("Expected the connection limit to be planned differently, got %+v", comparison.Changed)
+	}
+
+	// A membership planned for removal instead of addition is a different action
+	swapped := &DriftReport{MembershipsExtra: []Membership{{Member: "app_user", Group: "readers"}}}
+	comparison = ComparePlans(&DriftReport{MembershipsMissing: swapped.MembershipsExtra}, swapped)
+	if len(comparison.Added) != 1 || len(comparison.Removed) != 1 || len(comparison.Changed) != 0 {
+		t.Errorf("Expected one added and one removed action, got %+v", comparison)
+	}
+
+	if comparison := ComparePlans(current, current); comparison.Differences() != 0 {
+		t.Errorf("Expected identical plans not to differ, got %+v", comparison)
+	}
+}
@@ -0,0 +1,29 @@
+// Package postgresusermanager embeds PostgreSQL user management in other Go programs, such
+// as platform services and Lambdas, with the same configuration format and behaviour as the
+// postgres-user-manager command line tool.
+//
+// A program loads or builds a Config, connects a Manager to a cluster and syncs it:
+//
+//	cfg, err := postgresusermanager.LoadConfig("config.json")
+//	if err != nil {
+//		return err
+//	}
+//	conn, err := postgresusermanager.ConnectionFromEnv(cfg, "")
+//	if err != nil {
+//		return err
+//	}
+//	manager, err := postgresusermanager.NewManager(ctx, conn, postgresusermanager.Options{})
+//	if err != nil {
+//		return err
+//	}
+//	defer manager.Close()
+//
+//	result, err := manager.Sync(cfg)
+//
+// Cognito and group membership events are applied with an EventHandler, whose HandleLambda
+// method can be passed to lambda.Start.
+//
+// This package is the supported API. The types it exposes are aliases of the types the
+// tool itself uses, so a configuration file always decodes into a Config, and they only
+// change in backward compatible ways. Packages under internal/ are not part of the API.
+package postgresusermanager
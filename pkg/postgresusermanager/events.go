@@ -0,0 +1,57 @@
+package postgresusermanager
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/events"
+)
+
+// EventHandler applies Cognito triggers and group membership events to the cluster of a
+// Manager, as serve-lambda does
+type EventHandler struct {
+	applier *events.Applier
+}
+
+// NewEventHandler creates a handler that provisions users with the given authentication
+// method, mapping identity provider groups and logins with the group_mappings and
+// username_rules of the configuration, granting the groups of its global_defaults and
+// running its user hooks. Role lookups are no longer cached by the manager, since roles may
+// change between events.
+func (m *Manager) NewEventHandler(cfg *Config, authMethod string) (*EventHandler, error) {
+	handler := events.NewEventHandler(m.logger)
+	if cfg.GroupMappings != nil {
+		mapper, err := events.NewGroupMapper(*cfg.GroupMappings)
+		if err != nil {
+			return nil, err
+		}
+		handler.SetGroupMapper(mapper)
+	}
+	if cfg.UsernameRules != nil {
+		sanitizer, err := events.NewSanitizer(*cfg.UsernameRules)
+		if err != nil {
+			return nil, err
+		}
+		handler.SetSanitizer(sanitizer)
+	}
+	handler.SetDefaultGroups(cfg.DefaultGroups())
+	if err := m.db.SetHooks(cfg.Hooks); err != nil {
+		return nil, err
+	}
+	m.db.SetCatalogCache(false)
+
+	return &EventHandler{applier: events.NewApplier(handler, m.db, authMethod)}, nil
+}
+
+// Apply applies an event. Events that cannot be applied return an error wrapping
+// ErrInvalidEvent.
+func (h *EventHandler) Apply(event *EventPayload) error {
+	return h.applier.ApplyPayload(event)
+}
+
+// HandleLambda is a Lambda handler for Cognito user pool triggers, which are returned
+// unchanged as Cognito requires, and event payloads such as those published through
+// EventBridge
+func (h *EventHandler) HandleLambda(ctx context.Context, raw json.RawMessage) (json.RawMessage, error) {
+	return h.applier.HandleLambda(ctx, raw)
+}
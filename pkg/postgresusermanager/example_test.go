@@ -0,0 +1,39 @@
+package postgresusermanager_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/pkg/postgresusermanager"
+)
+
+func ExampleManager_Sync() {
+	cfg := &postgresusermanager.Config{
+		Groups: []postgresusermanager.GroupConfig{
+			{Name: "readers", Privileges: []string{"CONNECT"}, Databases: []string{"app"}, Inherit: true},
+		},
+		Users: []postgresusermanager.UserConfig{
+			{Username: "app_user", Groups: []string{"readers"}, AuthMethod: postgresusermanager.AuthMethodIAM, Enabled: true, CanLogin: true},
+		},
+	}
+
+	conn, err := postgresusermanager.ConnectionFromEnv(cfg, "")
+	if err != nil {
+		log.Fatal(err)
+	}
+	manager, err := postgresusermanager.NewManager(context.Background(), conn, postgresusermanager.Options{
+		Principal:     "platform-service",
+		Transactional: true,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer manager.Close()
+
+	result, err := manager.Sync(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("created %d users and %d groups\n", len(result.UsersCreated), len(result.GroupsCreated))
+}
@@ -0,0 +1,160 @@
+package postgresusermanager
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/config"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/database"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/secrets"
+	"github.com/sirupsen/logrus"
+)
+
+// Options configures a Manager. The zero value logs nothing and applies changes one
+// statement at a time, as sync --continue-on-error does.
+type Options struct {
+	Logger           *logrus.Logger // Where the manager logs (default: nowhere)
+	DryRun           bool           // Plan statements without executing them or pinging the cluster
+	Principal        string         // Who makes the changes, recorded in role comments
+	Transactional    bool           // Apply each sync in one transaction, rolled back on the first error
+	ExactMemberships bool           // Revoke memberships of managed groups that the configuration does not declare
+	ExactPrivileges  bool           // Revoke database privileges that the configuration does not declare
+	RoleSource       string         // Source tagged on the roles the manager creates, so sync only prunes its own (default: no tagging)
+}
+
+// Manager manages the roles of one cluster
+type Manager struct {
+	db     *database.Manager
+	logger *logrus.Logger
+}
+
+// NewManager connects to a cluster. Work stops when the context is cancelled. The context
+// also bounds the wait for a paused serverless cluster to resume.
+func NewManager(ctx context.Context, conn *DatabaseConnection, options Options) (*Manager, error) {
+	logger := options.Logger
+	if logger == nil {
+		logger = discardLogger()
+	}
+
+	db, err := database.NewManagerContext(ctx, conn, logger, options.DryRun)
+	if err != nil {
+		return nil, err
+	}
+	if options.Principal != "" {
+		db.SetPrincipal(options.Principal)
+	}
+	db.SetTransactional(options.Transactional)
+	db.SetExactMemberships(options.ExactMemberships)
+	db.SetExactPrivileges(options.ExactPrivileges)
+	db.SetRoleSource(options.RoleSource)
+
+	return &Manager{db: db, logger: logger}, nil
+}
+
+// Close closes the connections of the manager
+func (m *Manager) Close() error {
+	return m.db.Close()
+}
+
+// Sync validates a configuration and brings the cluster in line with it. Its hooks run for
+// the users and groups the sync creates. In a dry run the result holds the statements the
+// sync would have executed.
+func (m *Manager) Sync(cfg *Config) (*SyncResult, error) {
+	if err := ValidateConfig(cfg); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	if err := m.db.SetHooks(cfg.Hooks); err != nil {
+		return nil, err
+	}
+	return m.db.SyncConfiguration(cfg)
+}
+
+// Diff compares the cluster with a configuration without changing anything
+func (m *Manager) Diff(cfg *Config) (*DriftReport, error) {
+	return m.db.Diff(cfg)
+}
+
+// CreateUser creates a user that does not exist yet
+func (m *Manager) CreateUser(user *UserConfig) error {
+	return m.db.CreateUser(user)
+}
+
+// DropUser drops a user
+func (m *Manager) DropUser(username string) error {
+	return m.db.DropUser(username)
+}
+
+// CreateGroup creates a group that does not exist yet
+func (m *Manager) CreateGroup(group *GroupConfig) error {
+	return m.db.CreateGroup(group)
+}
+
+// DropGroup drops a group
+func (m *Manager) DropGroup(name string) error {
+	return m.db.DropGroup(name)
+}
+
+// AddUserToGroup grants membership of a group to a user
+func (m *Manager) AddUserToGroup(username, group string) error {
+	return m.db.AddUserToGroup(username, group)
+}
+
+// RemoveUserFromGroup revokes membership of a group from a user
+func (m *Manager) RemoveUserFromGroup(username, group string) error {
+	return m.db.RemoveUserFromGroup(username, group)
+}
+
+// UserExists reports whether a user exists
+func (m *Manager) UserExists(username string) (bool, error) {
+	return m.db.UserExists(username)
+}
+
+// GroupExists reports whether a group exists
+func (m *Manager) GroupExists(name string) (bool, error) {
+	return m.db.GroupExists(name)
+}
+
+// LoadConfig reads a JSON or YAML configuration file
+func LoadConfig(path string) (*Config, error) {
+	return config.NewManager(discardLogger()).LoadConfig(path)
+}
+
+// ValidateConfig checks a configuration as the validate command does, returning every
+// problem found in one error
+func ValidateConfig(cfg *Config) error {
+	return config.NewManager(discardLogger()).ValidateConfig(cfg)
+}
+
+// SelectProfile returns the part of a configuration that applies to a cluster (sync
+// profile), with templated values rendered for it
+func SelectProfile(cfg *Config, profile string) (*Config, error) {
+	return config.NewManager(discardLogger()).SelectProfile(cfg, profile)
+}
+
+// ConnectionFromEnv reads the connection details from the POSTGRES_* environment variables
+// as the command line tool does, overridden by the settings of the profile in the
+// configuration. Pass a nil configuration to use the environment only.
+func ConnectionFromEnv(cfg *Config, profile string) (*DatabaseConnection, error) {
+	manager := config.NewManager(discardLogger())
+	if cfg != nil {
+		manager.SetConfig(cfg)
+		if _, err := manager.SelectProfile(cfg, profile); err != nil {
+			return nil, err
+		}
+	}
+	return manager.GetDatabaseConnection()
+}
+
+// RedactionHook returns a logrus hook that masks the passwords and tokens the package has
+// seen. Add it to the logger given in Options to keep them out of log output.
+func RedactionHook() logrus.Hook {
+	return secrets.NewHook()
+}
+
+// discardLogger returns a logger that writes nowhere
+func discardLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
@@ -0,0 +1,82 @@
+package postgresusermanager
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadAndValidateConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := `{
+		"groups": [{"name": "readers", "privileges": ["CONNECT"], "databases": ["app"], "inherit": true}],
+		"users": [{"username": "app_user", "groups": ["readers"], "enabled": true, "can_login": true, "auth_method": "iam"}]
+	}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("Failed to write configuration: %v", err)
+	}
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+	if len(cfg.Users) != 1 || cfg.Users[0].AuthMethod != AuthMethodIAM {
+		t.Fatalf("Unexpected users %+v", cfg.Users)
+	}
+	if err := ValidateConfig(cfg); err != nil {
+		t.Errorf("Expected the configuration to be valid, got %v", err)
+	}
+
+	cfg.Users = append(cfg.Users, UserConfig{Username: "app_user", Enabled: true})
+	if err := ValidateConfig(cfg); err == nil || !strings.Contains(err.Error(), "app_user") {
+		t.Errorf("Expected the duplicate user to be reported, got %v", err)
+	}
+}
+
+func TestConnectionFromEnv(t *testing.T) {
+	t.Setenv("POSTGRES_HOST", "default.example.com")
+	t.Setenv("POSTGRES_PASSWORD", "secret")
+	t.Setenv("POSTGRES_IAM_AUTH", "")
+	t.Setenv("POSTGRES_SSLMODE", "")
+
+	cfg := &Config{Profiles: map[string]ProfileConfig{
+		"analytics": {Host: "analytics.example.com", ResumeTimeoutSeconds: 60},
+	}}
+
+	conn, err := ConnectionFromEnv(cfg, "analytics")
+	if err != nil {
+		t.Fatalf("Failed to read connection: %v", err)
+	}
+	if conn.Host != "analytics.example.com" || conn.ResumeTimeout.Seconds() != 60 || conn.Password != "secret" {
+		t.Errorf("Expected the profile's connection settings, got %+v", conn)
+	}
+
+	if conn, err = ConnectionFromEnv(nil, ""); err != nil || conn.Host != "default.example.com" {
+		t.Errorf("Expected the environment's host, got %+v (%v)", conn, err)
+	}
+	if _, err := ConnectionFromEnv(cfg, "unknown"); err == nil {
+		t.Error("Expected an unknown profile to be rejected")
+	}
+}
+
+func TestEventHandlerRejectsUnknownEvents(t *testing.T) {
+	// Dry runs do not ping, so no server is needed to reject an event before it is applied
+	conn := &DatabaseConnection{Host: "localhost", Port: 5432, Username: "postgres", Database: "postgres", SSLMode: "disable"}
+	manager, err := NewManager(context.Background(), conn, Options{DryRun: true})
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	defer manager.Close()
+
+	handler, err := manager.NewEventHandler(&Config{}, AuthMethodIAM)
+	if err != nil {
+		t.Fatalf("Failed to create event handler: %v", err)
+	}
+	err = handler.Apply(&EventPayload{EventType: "UserDeleted", Username: "jane"})
+	if !errors.Is(err, ErrInvalidEvent) {
+		t.Errorf("Expected ErrInvalidEvent, got %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package postgresusermanager
+
+import (
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/events"
+	"github.com/ben-vaughan-nttd/postgres-user-manager/internal/structs"
+)
+
+// Configuration types, as read from configuration files
+type (
+	// Config is a configuration of users, groups and settings for one or more clusters
+	Config = structs.Config
+	// UserConfig is a user (login role) of a configuration
+	UserConfig = structs.UserConfig
+	// GroupConfig is a group (role without login) of a configuration
+	GroupConfig = structs.GroupConfig
+	// ProfileConfig holds the connection overrides and template variables of a cluster
+	ProfileConfig = structs.ProfileConfig
+	// HookConfig runs SQL statements or a command after a user or group is created
+	HookConfig = structs.HookConfig
+	// GlobalDefaultsConfig holds settings every enabled user gets, such as default groups
+	GlobalDefaultsConfig = structs.GlobalDefaultsConfig
+	// SSLCertificatesConfig sets the CA, client certificate and key files of connections
+	SSLCertificatesConfig = structs.SSLCertificatesConfig
+	// SchemaConfig is a schema sync creates, gives to its owner and grants privileges on
+	SchemaConfig = structs.SchemaConfig
+	// SchemaGrant grants privileges on a schema to a role
+	SchemaGrant = structs.SchemaGrant
+)
+
+// DatabaseConnection holds the connection details of a cluster
+type DatabaseConnection = structs.DatabaseConnection
+
+// Results of syncing and comparing a cluster
+type (
+	// SyncResult reports the changes a sync made, or would make in a dry run, and its errors
+	SyncResult = structs.SyncResult
+	// DriftReport lists how a cluster differs from a configuration
+	DriftReport = structs.DriftReport
+	// PlannedStatement is a statement a dry run would have executed
+	PlannedStatement = structs.PlannedStatement
+)
+
+// EventPayload is a user or group membership event, such as a Cognito sign-up
+type EventPayload = structs.EventPayload
+
+// SSLRootCertRDS is the root_cert that verifies RDS servers with the CA bundle AWS publishes
+const SSLRootCertRDS = structs.SSLRootCertRDS
+
+// Database drivers of a DatabaseConnection
+const (
+	DriverPQ  = structs.DriverPQ
+	DriverPGX = structs.DriverPGX
+)
+
+// Authentication methods of users
+const (
+	AuthMethodPassword = structs.AuthMethodPassword
+	AuthMethodIAM      = structs.AuthMethodIAM
+	AuthMethodCert     = structs.AuthMethodCert
+)
+
+// Types of events an EventHandler applies
+const (
+	EventPostConfirmation = events.EventPostConfirmation
+	EventGroupAdded       = events.EventGroupAdded
+	EventGroupRemoved     = events.EventGroupRemoved
+)
+
+// ErrInvalidEvent is returned for events that cannot be applied, such as unknown event types
+var ErrInvalidEvent = events.ErrInvalidEvent